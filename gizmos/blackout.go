@@ -0,0 +1,308 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	blackout
+	Abstract:	Blackout periods: site defined intervals during which reservations may not be
+				active. A blackout is either a single interval or one which recurs daily or
+				weekly. The spec given to Mk_blackout() is one of:
+					start-end					unix timestamps
+					daily@hh:mm+duration		every day starting at hh:mm (UTC)
+					weekly@day@hh:mm+duration	every week on day (sun, mon...) at hh:mm (UTC)
+				where duration is a Go style duration (e.g. 90m or 4h).
+
+				The list of blackouts is global; managers set it from the config and test
+				windows against it with Blackout_check() and Blackout_split().
+				A single period can also be tested on its own (Covers() and Next()); the agent
+				manager uses them for the windows in which disruptive actions may run.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Added Covers() and Next().
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+const (
+	bo_daily	int64 = 86400
+	bo_weekly	int64 = 86400 * 7
+)
+
+type Blackout struct {
+	Name	string
+	Spec	string
+	start	int64				// start; seconds into the period if recurring
+	length	int64
+	period	int64				// 0 (once), daily or weekly
+}
+
+var (
+	bo_lock		sync.RWMutex
+	blackouts	[]*Blackout
+	bo_days		= map[string]int64{ "thu": 0, "fri": 1, "sat": 2, "sun": 3, "mon": 4, "tue": 5, "wed": 6 }	// offset from the epoch (a Thursday)
+)
+
+/*
+	Parse hh:mm+duration returning the seconds into the day and the length.
+*/
+func bo_time_len( s string ) ( start int64, length int64, err error ) {
+	toks := strings.SplitN( s, "+", 2 )
+	if len( toks ) != 2 {
+		return 0, 0, fmt.Errorf( "expected hh:mm+duration: %s", s )
+	}
+
+	t, err := time.Parse( "15:04", toks[0] )
+	if err != nil {
+		return 0, 0, fmt.Errorf( "bad time of day: %s", toks[0] )
+	}
+	d, err := time.ParseDuration( toks[1] )
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf( "bad duration: %s", toks[1] )
+	}
+
+	return int64( t.Hour() * 3600 + t.Minute() * 60 ), int64( d / time.Second ), nil
+}
+
+/*
+	Make a blackout from the spec (see the abstract).
+*/
+func Mk_blackout( name string, spec string ) ( b *Blackout, err error ) {
+	b = &Blackout{ Name: name, Spec: spec }
+
+	switch {
+		case strings.HasPrefix( spec, "daily@" ):
+			b.period = bo_daily
+			b.start, b.length, err = bo_time_len( spec[6:] )
+
+		case strings.HasPrefix( spec, "weekly@" ):
+			b.period = bo_weekly
+			toks := strings.SplitN( spec[7:], "@", 2 )
+			day, ok := bo_days[strings.ToLower( toks[0] )]
+			if len( toks ) != 2 || ! ok {
+				return nil, fmt.Errorf( "blackout %s: expected weekly@day@hh:mm+duration: %s", name, spec )
+			}
+			b.start, b.length, err = bo_time_len( toks[1] )
+			b.start += day * bo_daily
+
+		default:
+			toks := strings.SplitN( spec, "-", 2 )
+			if len( toks ) != 2 {
+				return nil, fmt.Errorf( "blackout %s: expected start-end, daily@... or weekly@...: %s", name, spec )
+			}
+			b.start = clike.Atoll( toks[0] )
+			b.length = clike.Atoll( toks[1] ) - b.start
+			if b.start <= 0 || b.length <= 0 {
+				return nil, fmt.Errorf( "blackout %s: end must be after start: %s", name, spec )
+			}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf( "blackout %s: %s", name, err )
+	}
+	if b.period > 0 && b.length >= b.period {
+		return nil, fmt.Errorf( "blackout %s: duration must be less than the period: %s", name, spec )
+	}
+
+	return b, nil
+}
+
+/*
+	Return the occurrences of the blackout which overlap the window [start, end).
+*/
+func (b *Blackout) occurrences( start int64, end int64 ) ( list []*pledge_window ) {
+	if b == nil || end <= start {
+		return nil
+	}
+
+	w := &pledge_window{ commence: start, expiry: end }
+	if b.period == 0 {
+		if o := ( &pledge_window{ commence: b.start, expiry: b.start + b.length } ); o.overlaps( w ) {
+			list = append( list, o )
+		}
+		return list
+	}
+
+	k := (start - b.start - b.length) / b.period			// first occurrence that might reach into the window
+	if k < 0 {
+		k = 0
+	}
+	for t := k * b.period + b.start; t < end; t += b.period {
+		o := &pledge_window{ commence: t, expiry: t + b.length }
+		if o.overlaps( w ) {
+			list = append( list, o )
+		}
+	}
+
+	return list
+}
+
+/*
+	Return the recurrence of the blackout: once, daily or weekly.
+*/
+func (b *Blackout) Recurs( ) ( string ) {
+	switch b.period {
+		case bo_daily:
+			return "daily"
+		case bo_weekly:
+			return "weekly"
+	}
+	return "once"
+}
+
+/*
+	Return true if the time falls within an occurrence of the period.
+*/
+func (b *Blackout) Covers( ts int64 ) ( bool ) {
+	return len( b.occurrences( ts, ts + 1 ) ) > 0
+}
+
+/*
+	Return the start of the first occurrence at or after ts; 0 if there is none (a single
+	period which has already started).
+*/
+func (b *Blackout) Next( ts int64 ) ( int64 ) {
+	if b == nil {
+		return 0
+	}
+	if b.period == 0 {
+		if b.start >= ts {
+			return b.start
+		}
+		return 0
+	}
+
+	k := (ts - b.start + b.period - 1) / b.period
+	if k < 0 {
+		k = 0
+	}
+	return k * b.period + b.start
+}
+
+/*
+	Replace the list of blackouts.
+*/
+func Set_blackouts( list []*Blackout ) {
+	bo_lock.Lock()
+	defer bo_lock.Unlock()
+
+	blackouts = list
+}
+
+/*
+	Return the number of blackouts defined.
+*/
+func Num_blackouts( ) ( int ) {
+	bo_lock.RLock()
+	defer bo_lock.RUnlock()
+
+	return len( blackouts )
+}
+
+/*
+	Test the window against the blackouts. If a blackout overlaps the window its name
+	and the start and end of the first occurrence which does are returned; name is
+	empty if there is no overlap.
+*/
+func Blackout_check( commence int64, expiry int64 ) ( name string, bstart int64, bend int64 ) {
+	bo_lock.RLock()
+	defer bo_lock.RUnlock()
+
+	for _, b := range blackouts {
+		if ol := b.occurrences( commence, expiry ); len( ol ) > 0 {
+			if name == "" || ol[0].commence < bstart {
+				name, bstart, bend = b.Name, ol[0].commence, ol[0].expiry
+			}
+		}
+	}
+
+	return
+}
+
+/*
+	Remove the blackouts from the window and return the windows that are left, in time
+	order. The list is empty if blackouts cover the whole window; it has just the window
+	if none overlap it.
+*/
+func Blackout_split( commence int64, expiry int64 ) ( [][2]int64 ) {
+	bo_lock.RLock()
+	defer bo_lock.RUnlock()
+
+	left := []*pledge_window{ &pledge_window{ commence: commence, expiry: expiry } }
+	for _, b := range blackouts {
+		for _, o := range b.occurrences( commence, expiry ) {
+			nleft := make( []*pledge_window, 0, len( left ) + 1 )
+			for _, w := range left {
+				nleft = append( nleft, w.subtract( o )... )
+			}
+			left = nleft
+		}
+	}
+
+	sort.Slice( left, func( i, j int ) bool { return left[i].commence < left[j].commence } )
+	wins := make( [][2]int64, 0, len( left ) )
+	for _, w := range left {
+		if w.duration() > 0 {
+			wins = append( wins, [2]int64{ w.commence, w.expiry } )
+		}
+	}
+	return wins
+}
+
+/*
+	Generate a json array of the blackout occurrences which overlap [start, end) in
+	time order.
+*/
+func Blackouts_json( start int64, end int64 ) ( string ) {
+	type bo_occ struct {
+		b	*Blackout
+		w	*pledge_window
+	}
+
+	bo_lock.RLock()
+	occs := make( []bo_occ, 0 )
+	for _, b := range blackouts {
+		for _, w := range b.occurrences( start, end ) {
+			occs = append( occs, bo_occ{ b, w } )
+		}
+	}
+	bo_lock.RUnlock()
+
+	sort.SliceStable( occs, func( i, j int ) bool { return occs[i].w.commence < occs[j].w.commence } )
+	jstr := "[ "
+	sep := ""
+	for _, o := range occs {
+		jstr += fmt.Sprintf( `%s{ "name": %q, "spec": %q, "recurs": %q, "start": %d, "end": %d }`, sep, o.b.Name, o.b.Spec, o.b.Recurs(), o.w.commence, o.w.expiry )
+		sep = ", "
+	}
+
+	return jstr + " ]"
+}
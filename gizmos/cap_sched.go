@@ -0,0 +1,212 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	cap_sched
+	Abstract:	Time of day schedule for the reservable ceiling of links. The schedule is a
+				list of periods, each giving the percentage of a link's capacity that may be
+				reserved while it is in effect:
+
+					[days/]hh:mm-hh:mm=pct
+
+				Days are a comma separated list of day names or ranges (mon-fri,sun); the
+				period applies every day if they aren't given. A period whose end is before its
+				start runs over midnight and belongs to the day it starts. Outside of all
+				periods the whole capacity may be reserved; where periods overlap the lowest
+				percentage is used. Times are in the local time zone unless one is set.
+
+				A window is held to the lowest percentage of any period that it overlaps
+				(Cap_sched_pct), so a reservation which runs into business hours is limited
+				as though it were entirely within them. The obligation applies it to each
+				slice of time separately (Fits_schedule) so that only the part of the window
+				with the lowest ceiling needs to be under it.
+
+				The schedule is global to gizmos; set it once before paths are found.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type cap_period struct {
+	days	[7]bool						// indexed by time.Weekday
+	start	int							// minutes after midnight
+	end		int
+	pct		int64
+}
+
+var (
+	cap_periods	[]*cap_period			// empty when there is no schedule
+	cap_loc		*time.Location = time.Local
+)
+
+var day_names = map[string]time.Weekday {
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+/*
+	Convert hh:mm to minutes after midnight.
+*/
+func hhmm2min( s string ) ( int, error ) {
+	var h, m int
+
+	if n, err := fmt.Sscanf( s, "%d:%d", &h, &m ); err != nil || n != 2 || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf( "bad time, expected hh:mm: %s", s )
+	}
+
+	return h * 60 + m, nil
+}
+
+/*
+	Parse one period: [days/]hh:mm-hh:mm=pct.
+*/
+func mk_cap_period( spec string ) ( cp *cap_period, err error ) {
+	cp = &cap_period{ }
+
+	toks := strings.SplitN( spec, "=", 2 )
+	if len( toks ) < 2 {
+		return nil, fmt.Errorf( "schedule period must be [days/]hh:mm-hh:mm=pct: %s", spec )
+	}
+	if _, err = fmt.Sscanf( toks[1], "%d", &cp.pct ); err != nil || cp.pct < 0 || cp.pct > 100 {
+		return nil, fmt.Errorf( "schedule percentage must be 0-100: %s", spec )
+	}
+
+	hours := toks[0]
+	if i := strings.Index( hours, "/" ); i >= 0 {
+		for _, d := range strings.Split( hours[:i], "," ) {
+			dtoks := strings.SplitN( strings.ToLower( d ), "-", 2 )
+			first, ok := day_names[dtoks[0]]
+			if ! ok {
+				return nil, fmt.Errorf( "unknown day in schedule: %s", d )
+			}
+			last := first
+			if len( dtoks ) > 1 {
+				if last, ok = day_names[dtoks[1]]; ! ok {
+					return nil, fmt.Errorf( "unknown day in schedule: %s", d )
+				}
+			}
+			for wd := first; ; wd = (wd + 1) % 7 {			// allows fri-mon
+				cp.days[wd] = true
+				if wd == last {
+					break
+				}
+			}
+		}
+		hours = hours[i+1:]
+	} else {
+		for i := range cp.days {
+			cp.days[i] = true
+		}
+	}
+
+	htoks := strings.SplitN( hours, "-", 2 )
+	if len( htoks ) < 2 {
+		return nil, fmt.Errorf( "schedule period must be [days/]hh:mm-hh:mm=pct: %s", spec )
+	}
+	if cp.start, err = hhmm2min( htoks[0] ); err != nil {
+		return nil, err
+	}
+	if cp.end, err = hhmm2min( htoks[1] ); err != nil {
+		return nil, err
+	}
+	if cp.start == cp.end {
+		return nil, fmt.Errorf( "schedule period has no length: %s", spec )
+	}
+
+	return cp, nil
+}
+
+/*
+	Set the schedule from a space separated list of periods. An empty list removes the
+	schedule. The time zone (e.g. America/New_York) is used if not empty. The schedule
+	is left unchanged if there is an error.
+*/
+func Set_cap_schedule( spec string, tz string ) ( err error ) {
+	loc := time.Local
+	if tz != "" {
+		if loc, err = time.LoadLocation( tz ); err != nil {
+			return err
+		}
+	}
+
+	periods := make( []*cap_period, 0, 8 )
+	for _, ps := range strings.Fields( spec ) {
+		cp, err := mk_cap_period( ps )
+		if err != nil {
+			return err
+		}
+		periods = append( periods, cp )
+	}
+
+	cap_periods = periods
+	cap_loc = loc
+	return nil
+}
+
+/*
+	Return the lowest percentage of link capacity that may be reserved at any time in
+	the window commence to conclude; 100 if no period overlaps it.
+*/
+func Cap_sched_pct( commence int64, conclude int64 ) ( pct int64 ) {
+	pct = 100
+	if len( cap_periods ) == 0 || conclude <= commence {
+		return
+	}
+
+	if conclude - commence > 8 * 86400 {					// the pattern repeats each week; more than a week covers it all
+		conclude = commence + 8 * 86400
+	}
+
+	st := time.Unix( commence, 0 ).In( cap_loc )
+	y, m, d := st.Date()
+	for day := d - 1; ; day++ {								// day before for periods which run over midnight into the window
+		midnight := time.Date( y, m, day, 0, 0, 0, 0, cap_loc )
+		if midnight.Unix() >= conclude {
+			return
+		}
+
+		wd := midnight.Weekday()
+		for _, cp := range cap_periods {
+			if ! cp.days[wd] || cp.pct >= pct {
+				continue
+			}
+
+			ps := time.Date( y, m, day, 0, cp.start, 0, 0, cap_loc ).Unix()
+			pe := time.Date( y, m, day, 0, cp.end, 0, 0, cap_loc ).Unix()
+			if cp.end < cp.start {
+				pe = time.Date( y, m, day + 1, 0, cp.end, 0, 0, cap_loc ).Unix()
+			}
+			if ps < conclude && pe > commence {
+				pct = cp.pct
+			}
+		}
+	}
+}
@@ -119,3 +119,43 @@ func TestPledgeWindowOverlap( t *testing.T ) {
 	gizmos.Test_pwo( t )
 }
 */
+
+func TestSingleSwitchPath( t *testing.T ) {
+	fails := false
+	swid := "s1"
+	sw := gizmos.Mk_switch( &swid )
+	h1 := gizmos.Mk_host( "fa:16:3e:00:00:01", "10.0.0.1", "" )
+	h2 := gizmos.Mk_host( "fa:16:3e:00:00:02", "10.0.0.2", "" )
+
+	p := gizmos.Mk_path( h1, h2 )
+	p.Add_switch( sw )
+	p.Set_local( true )
+	if ! p.Is_single_switch() || ! p.Is_local() {
+		fmt.Fprintf( os.Stderr, "FAIL:  local path not single switch/local: %v/%v\n", p.Is_single_switch(), p.Is_local() )
+		fails = true
+	}
+
+	qid := "res1"
+	if err := p.Set_queue( &qid, 0, 3600, 1000, nil ); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL:  setting queues on a local path failed: %s\n", err )
+		fails = true
+	}
+	if e0, e1 := p.Get_endpoint_spq( &qid, 10 ); e0 != nil || e1 != nil {
+		fmt.Fprintf( os.Stderr, "FAIL:  local path has endpoints\n" )
+		fails = true
+	}
+
+	p = gizmos.Mk_path( h1, h2 )
+	p.Add_switch( sw )
+	p.Add_switch( sw )
+	if p.Is_single_switch() {
+		fmt.Fprintf( os.Stderr, "FAIL:  two switch path reported as single switch\n" )
+		fails = true
+	}
+
+	if fails {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:    single switch and local path checks\n" )
+	}
+}
@@ -112,3 +112,142 @@ func TestAnyKey( t *testing.T ) {
 		fmt.Fprintf( os.Stderr, "[OK]   All key checks passed\n" )
 	}
 }
+
+func TestRedact( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------ redaction testing ------\n" )
+	errs := 0
+
+	if s := gizmos.Mask( "mycookie1234" ); s != "********1234" {
+		fmt.Fprintf( os.Stderr, "[FAIL] mask of cookie: %s\n", s )
+		errs++
+	}
+	if s := gizmos.Mask( "abc" ); s != "***" {
+		fmt.Fprintf( os.Stderr, "[FAIL] mask of short cookie: %s\n", s )
+		errs++
+	}
+
+	cs := `{ "id": "res1", "usrkey": "secretcookie", "ptype": 1 }`
+	if s := gizmos.Redact_chkpt( cs ); strings.Index( s, "secretcookie" ) >= 0 || strings.Index( s, `"********okie"` ) < 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] checkpoint cookie not masked: %s\n", s )
+		errs++
+	}
+
+	cs = `{ "id": "res1", "usrkey": "secretcookie", "owners": ["teamcookie1","teamcookie2"], "ptype": 1 }`
+	if s := gizmos.Redact_chkpt( cs ); strings.Index( s, "teamcookie" ) >= 0 || strings.Index( s, `"owners": ["*******kie1","*******kie2"]` ) < 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] owner group cookies not masked: %s\n", s )
+		errs++
+	}
+
+	tok := "0123456789abcdef0123456789abcdef"
+	if s := gizmos.Redact_tokens( "reserve 10M +30 " + tok + "/proj/vm1,proj/vm2" ); strings.Index( s, tok ) >= 0 || strings.Index( s, "/proj/vm1" ) < 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] token not masked: %s\n", s )
+		errs++
+	}
+
+	gizmos.Set_redaction( false )
+	if s := gizmos.Mask( "mycookie1234" ); s != "mycookie1234" {
+		fmt.Fprintf( os.Stderr, "[FAIL] masked when redaction was off: %s\n", s )
+		errs++
+	}
+	gizmos.Set_redaction( true )
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   All redaction checks passed\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+func TestAgent_strings( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------ agent string vetting ------\n" )
+	errs := 0
+
+	for _, h := range []string{ "qos101", "qos101.research.att.com", "vm_name-1" } {
+		if ! gizmos.Valid_hostname( h ) {
+			fmt.Fprintf( os.Stderr, "[FAIL] good host name rejected: %s\n", h )
+			errs++
+		}
+	}
+	for _, h := range []string{ "", "-o", "vm1;reboot", "vm1 vm2", "$(id)", "vm`id`" } {
+		if gizmos.Valid_hostname( h ) {
+			fmt.Fprintf( os.Stderr, "[FAIL] bad host name accepted: %s\n", h )
+			errs++
+		}
+	}
+
+	if ! gizmos.Shell_safe( "-T 90 -t 30 --match -m 0x01/0x01 -i fa:16:3e:00:00:01", false ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] flow-mod string rejected\n" )
+		errs++
+	}
+	if gizmos.Shell_safe( "fa:16:3e:00:00:01 -x", true ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] token with embedded space accepted\n" )
+		errs++
+	}
+	if gizmos.Shell_safe( "10.0.0.1; rm -rf /", false ) || gizmos.Shell_safe( "a|b", true ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] shell meta characters accepted\n" )
+		errs++
+	}
+
+	sdata := map[string]string{ "resid": "res-1", "cid": "c0001" }			// a steering flow-mod as fq-mgr builds it
+	sfdata := []string{ "-T 90 -t 3600 -p 210 --match -m 0x00/0x01 -i 7 -d fa:16:3e:00:00:02 -P tcp:80 --action -d fa:16:3e:00:00:09 -R ,90 -R ,0 -N add 0xedde br-int" }
+	if err := gizmos.Vet_action( "flowmod", []string{ "host3" }, sdata, sfdata, nil, "" ); err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] steering action refused: %s\n", err )
+		errs++
+	}
+	sdata["match"] = "-p 210 --match -i 7"
+	if gizmos.Vet_action( "flowmod", []string{ "host3" }, sdata, sfdata, nil, "" ) == nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] data value with spaces accepted\n" )
+		errs++
+	}
+	if gizmos.Vet_action( "bw_fmod", []string{ "host1;id" }, nil, nil, nil, "" ) == nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] action with bad host accepted\n" )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   All agent string checks passed\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+func TestZframe( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------ compression framing ------\n" )
+	errs := 0
+
+	msg := []byte( `{ "ctype": "action_list", "actions": [ ` + strings.Repeat( `{ "atype": "flowmod", "hosts": [ "qos101" ] }, `, 50 ) + `{ } ] }` )
+	for _, zenc := range gizmos.Zencodings {
+		frame := gizmos.Zwrap( zenc, msg, 512 )
+		if len( frame ) >= len( msg ) {
+			fmt.Fprintf( os.Stderr, "[FAIL] %s frame was not smaller: %d >= %d\n", zenc, len( frame ), len( msg ) )
+			errs++
+		}
+
+		umsg, err := gizmos.Zunwrap( frame )
+		if err != nil || string( umsg ) != string( msg ) {
+			fmt.Fprintf( os.Stderr, "[FAIL] %s unwrap did not return the original: %v\n", zenc, err )
+			errs++
+		}
+	}
+
+	short := []byte( `{ "ctype": "hello" }` )
+	if f := gizmos.Zwrap( "gzip", short, 512 ); string( f ) != string( short ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] short message was compressed\n" )
+		errs++
+	}
+	if u, _ := gizmos.Zunwrap( short ); string( u ) != string( short ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] unframed message was altered by unwrap\n" )
+		errs++
+	}
+
+	if z := gizmos.Zselect( []string{ "lz4", "gzip" } ); z != "gzip" {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected gzip to be selected, got %q\n", z )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   All compression framing checks passed\n" )
+	} else {
+		t.Fail()
+	}
+}
@@ -29,6 +29,8 @@
 					bleat id to gizmos.
 				24 Jun 2014 : Added new constants for steering pledges.
 				17 Feb 2015 : Added mirroring
+				16 Oct 2026 : Added multicast.
+				16 Oct 2026 : Added dscp trust.
 */
 
 package gizmos
@@ -50,6 +52,8 @@ const (
 	PT_MIRRORING
 	PT_OWBANDWIDTH							// one way bandwidth
 	PT_PASSTHRU								// passthrough dscp marking reservation
+	PT_MULTICAST							// multicast (one source, many receivers) bandwidth
+	PT_TRUST								// dscp trust (markings kept, nothing reserved) for a vm or project
 )
 
 var (
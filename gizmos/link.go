@@ -58,6 +58,8 @@
 				05 Sep 2014 - Pick up late binding port info if port is <0 rather than 0.
 				19 Oct 2014 - Comment change
 				18 Jun 2015 - Added nil pointer check.
+				16 Oct 2026 - Added Get_slice_window().
+				16 Oct 2026 - Has_capacity also checks the time of day ceiling (cap_sched).
 */
 
 package gizmos
@@ -344,6 +346,9 @@ func (l *Link) Has_capacity( commence int64, conclude int64, amt int64, usr *str
 	}
 
 	able, err = l.allotment.Has_capacity( commence, conclude, amt, usr )
+	if able {
+		able, err = l.allotment.Fits_schedule( commence, conclude, amt )		// time of day ceiling (cap_sched)
+	}
 	//if err != nil {
 		//obj_sheep.Baa( 2, "no capacity on link %s: %s", *l.id, err )
 	//}
@@ -540,6 +545,18 @@ func (l *Link) Add_lbp( s string ) {
 
 // -------- human and/or interface output generation -------------------------------------------------------------
 
+/*
+	Return the commence and conclude times of the link's timeslice which includes the timestamp;
+	ok is false if there isn't one.
+*/
+func (l *Link) Get_slice_window( ts int64 ) ( commence int64, conclude int64, ok bool ) {
+	if l == nil {
+		return 0, 0, false
+	}
+
+	return l.allotment.Get_slice_window( ts )
+}
+
 /*
 	Returns a list of queue information that an outside thing (human or programme) might need to actually
 	set the queues on a switch. The queue settings are for the point in time as indicated by the unix timestamp
@@ -25,7 +25,7 @@
 	Date:		24 June 2014
 	Author:		E. Scott Daniels
 
-	Mods:		
+	Mods:		16 Oct 2026 - Added Json_mbox so that middleboxes can be restored from a checkpoint.
 */
 
 package gizmos
@@ -52,6 +52,16 @@ type Mbox struct {
 	swport	int					// port that the box is attached to (may be -128 for late binding)
 }
 
+/*
+	Work struct used to decode the json generated by To_json(); the json package needs exported fields.
+*/
+type Json_mbox struct {
+	Id		*string
+	Mac		*string
+	Swid	*string
+	Swport	int
+}
+
 /*
 	Constructor; creates a middle box
 */
@@ -69,6 +79,26 @@ func Mk_mbox( id *string, mac *string, swid *string, swport int ) ( mb *Mbox ) {
 	return
 }
 
+/*
+	Create a middle box from the decoded json. Nil is returned if the id is missing.
+*/
+func (jm *Json_mbox) Mk_mbox( ) ( *Mbox ) {
+	if jm == nil || jm.Id == nil {
+		return nil
+	}
+
+	mac := jm.Mac
+	if mac == nil {
+		mac = &empty_str
+	}
+	swid := jm.Swid
+	if swid == nil {
+		swid = &empty_str
+	}
+
+	return Mk_mbox( jm.Id, mac, swid, jm.Swport )
+}
+
 /*
 	Returns the id/name -- which ever was given when created.
 */
@@ -58,6 +58,9 @@
 					empty. Some cleanup of commented lines.
 				22 Jun 2015 : Corrected cause of core dump when updating utilisation on mlag.
 				05 Jul 2016 : Changed the max date to 2026/01/01 00:00:00
+				16 Oct 2026 : Added Get_slice_window().
+				16 Oct 2026 : Added Fits_schedule() for the time of day ceiling (cap_sched).
+				16 Oct 2026 : Added Compact() and Get_nslices().
 */
 
 package gizmos
@@ -282,6 +285,40 @@ func (ob *Obligation) Has_capacity( commence int64, conclude int64, amt int64, u
 	return					// assume that the last block in the list ends earlier than the conclusion passed in
 }
 
+/*
+	Returns true if the capacity increase (amt) stays under the reservable ceiling of the
+	time of day schedule (cap_sched) across the window. Each slice overlapping the window
+	is held to the lowest ceiling during the part of the window it covers.
+*/
+func (ob *Obligation) Fits_schedule( commence int64, conclude int64, amt int64 ) ( bool, error ) {
+	if len( cap_periods ) == 0 {
+		return true, nil
+	}
+
+	for ts := ob.tslist; ts != nil; ts = ts.Next {
+		if ts.Is_after( conclude ) {
+			break
+		}
+		if ts.conclude <= commence {						// slices wholly inside the window count too
+			continue
+		}
+
+		c := commence
+		if ts.commence > c {
+			c = ts.commence
+		}
+		e := conclude
+		if ts.conclude < e {
+			e = ts.conclude
+		}
+		if pct := Cap_sched_pct( c, e ); pct < 100 && ts.Amt + amt > (ob.Max_capacity * pct) / 100 {
+			return false, fmt.Errorf( "link lacks capacity under the %d%% scheduled ceiling: need %d have %d", pct, ts.Amt + amt, (ob.Max_capacity * pct) / 100 )
+		}
+	}
+
+	return true, nil
+}
+
 /*
 	Adds a queue to the obligation starting with the commence and ending with the conclude timestamps.
 	This function does NOT check to see if the obligaion can support the amount being added assuming that
@@ -359,6 +396,47 @@ func (ob *Obligation) Prune( ) {
 	return
  }
 
+/*
+	Merge adjacent time slices that are the same. Slices are split as reservations are
+	added, but deleting or expiring a reservation leaves the pieces, so a long running link
+	collects slices which differ in nothing but their windows. Returns the number removed.
+*/
+func (ob *Obligation) merge_slices( ) ( n int ) {
+	for ts := ob.tslist; ts != nil; {
+		if ts.same( ts.Next ) {
+			ts.absorb( )
+			n++
+		} else {
+			ts = ts.Next
+		}
+	}
+
+	return n
+}
+
+/*
+	Prune the slices that are in the past and merge those that are the same. Returns the
+	number of slices removed.
+*/
+func (ob *Obligation) Compact( ) ( int ) {
+	before := ob.Get_nslices()
+	ob.Prune( )
+	pruned := before - ob.Get_nslices()
+
+	return pruned + ob.merge_slices( )
+}
+
+/*
+	Return the number of slices in the obligation.
+*/
+func (ob *Obligation) Get_nslices( ) ( n int ) {
+	for ts := ob.tslist; ts != nil; ts = ts.Next {
+		n++
+	}
+
+	return n
+}
+
 /*
 	return the obligation for the indicated time
 */
@@ -440,6 +518,25 @@ func (ob *Obligation) Queues2str( usr_ts int64 ) ( string ) {
 	return ""
 }
 
+/*
+	Return the commence and conclude times of the timeslice which includes the
+	timestamp; ok is false if there isn't one.
+*/
+func (ob *Obligation) Get_slice_window( usr_ts int64 ) ( commence int64, conclude int64, ok bool ) {
+	if ob == nil {
+		return 0, 0, false
+	}
+
+	for ts := ob.tslist; ts != nil; ts = ts.Next {
+		if ts.Includes( usr_ts ) {
+			c, e := ts.Get_window( )
+			return c, e, true
+		}
+	}
+
+	return 0, 0, false
+}
+
 /*
 	Generate a json blob that represents the obligation. The json will list the max capacity
 	for the obligation and then an entry for each timeslice.
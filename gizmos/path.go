@@ -63,6 +63,11 @@
 				29 Oct 2014 - Added Get_nlinks() function.
 				12 Apr 2016 - Added ability to compare paths based on 'anchors' (dup refresh support).
 				12 May 2016 - Correct potential for segfault in has_anchors.
+				16 Oct 2026 - Added Has_switch().
+				16 Oct 2026 - Added Set_tree_queue() for multicast trees.
+				16 Oct 2026 - Added Get_link_ids().
+				16 Oct 2026 - Added Get_switch_ids().
+				16 Oct 2026 - Added single switch and local (hosts share a port) support.
 */
 
 package gizmos
@@ -96,6 +101,7 @@ type Path struct {
 	extflag	*string			// flag indicating whether external IP is source (-S) or dest (-D) needed by flow mod generator
 	is_reverse	bool		// set to indicate that the path was saved in reverse order
 	is_scramble bool		// if the path is not a true path, but a list of links involved in all possible paths between hosts
+	is_local	bool		// hosts are behind the same port of the one switch; there is nothing to queue or obligate
 }
 
 // ---------------------------------------------------------------------------------------
@@ -187,6 +193,29 @@ func (p *Path) Is_scramble( ) ( bool ) {
 	return p.is_scramble
 }
 
+/*
+	Mark the path as local: both hosts are behind the same port of a single switch and their
+	traffic doesn't pass through it. A local path has no links; setting its queues does nothing.
+*/
+func (p *Path) Set_local( state bool ) {
+	p.is_local = state
+}
+
+/*
+	Returns the state of the local setting.
+*/
+func (p *Path) Is_local( ) ( bool ) {
+	return p.is_local
+}
+
+/*
+	Returns true if both hosts are attached to the one switch in the path; either to different
+	ports with a virtual link between them, or to the same port if the path is local.
+*/
+func (p *Path) Is_single_switch( ) ( bool ) {
+	return p.sidx == 1 && ! p.is_scramble
+}
+
 /*
 	Adds the link passed in to the path. Links should be added in
 	order from the origin switch to the termination switch.  If
@@ -357,6 +386,15 @@ func (p *Path) Set_extip( extip *string, flag *string ) {
 
 */
 func (p *Path) Set_queue( qid *string, commence int64, conclude int64, bw_amt int64, usr *Fence ) (err error) {
+	return p.Set_tree_queue( qid, commence, conclude, bw_amt, usr, nil )
+}
+
+/*
+	Set the queues as Set_queue() does, but skip any link that is already in the seen map,
+	adding those that are set. When the branches of a multicast tree are set with the same
+	map the links the branches share are obligated only once. A nil map sets every link.
+*/
+func (p *Path) Set_tree_queue( qid *string, commence int64, conclude int64, bw_amt int64, usr *Fence, seen map[*Link]bool ) (err error) {
 	err = nil
 	poutstr := "priority-out"		// names for priority queue in the proper direction
 
@@ -366,6 +404,10 @@ func (p *Path) Set_queue( qid *string, commence int64, conclude int64, bw_amt in
 		return
 	}
 
+	if p.is_local {				// nothing between the hosts that we manage
+		return
+	}
+
 	if p.lidx == 0 {			// this should _never_ happen
 		obj_sheep.Baa( 0, "set_queue: no links in the path!" )
 		err = fmt.Errorf( "path has no links" )
@@ -373,43 +415,57 @@ func (p *Path) Set_queue( qid *string, commence int64, conclude int64, bw_amt in
 	}
 
 	if p.is_reverse {				// path was saved backwards, so we run it from last to first
-		err = p.links[p.lidx-1].Set_forward_queue( qid, commence, conclude, bw_amt, usr )		// set first outbound queue from h1 on the ingress to a specific queue
+		err = set_link_queue( p.links[p.lidx-1], seen, qid, commence, conclude, bw_amt, usr )		// set first outbound queue from h1 on the ingress to a specific queue
 		if err != nil { return }
 
 		for i := p.lidx-2; i > 0; i-- {						// set priority queues for all interediate links; set in both directions
-			err = p.links[i].Set_forward_queue( &poutstr, commence, conclude, bw_amt, usr )
+			err = set_link_queue( p.links[i], seen, &poutstr, commence, conclude, bw_amt, usr )
 			if err != nil { return }
 
 		}
 
 		if p.lidx > 1 {																		// when only one link, there is no priority queue inbound to h2
-			err = p.links[0].Set_forward_queue( &poutstr, commence, conclude, bw_amt, usr )		// for the last link set the last priority in direction of h2 to amt-out
+			err = set_link_queue( p.links[0], seen, &poutstr, commence, conclude, bw_amt, usr )		// for the last link set the last priority in direction of h2 to amt-out
 		}
 
 	} else {
-		err = p.links[0].Set_forward_queue( qid, commence, conclude, bw_amt, usr )			// set the specific queue on the ingress switch side of the link
+		err = set_link_queue( p.links[0], seen, qid, commence, conclude, bw_amt, usr )			// set the specific queue on the ingress switch side of the link
 		if err != nil { return }
 
 		for i := 1; i < p.lidx-1; i++ {
-			err = p.links[i].Set_forward_queue( &poutstr, commence, conclude, bw_amt, usr )
+			err = set_link_queue( p.links[i], seen, &poutstr, commence, conclude, bw_amt, usr )
 			if err != nil { return }
 		}
 
 		if p.lidx > 1 {																				// when just one link there is no priority queue into last switch
-			err = p.links[p.lidx-1].Set_forward_queue( &poutstr, commence, conclude, bw_amt, usr )		// and priority for this is the limit out from h1
+			err = set_link_queue( p.links[p.lidx-1], seen, &poutstr, commence, conclude, bw_amt, usr )		// and priority for this is the limit out from h1
 			if err != nil { return }
 		}
 	}
 
 	if p.endpts[1] != nil {			// endpoints are added in h1,h2 order (regardless of path order), so always looking for ep[1] here	
 		eqid := "E1" + *qid;
-		err = p.endpts[1].Set_forward_queue( &eqid, commence, conclude, bw_amt, usr )		// amount out from h1 into h2
+		err = set_link_queue( p.endpts[1], seen, &eqid, commence, conclude, bw_amt, usr )		// amount out from h1 into h2
 		if err != nil { return }
 	}
 
 	return
 }
 
+/*
+	Set the forward queue on the link unless it is in the seen map. Seen may be nil.
+*/
+func set_link_queue( l *Link, seen map[*Link]bool, qid *string, commence int64, conclude int64, amt int64, usr *Fence ) ( err error ) {
+	if seen != nil {
+		if seen[l] {
+			return nil
+		}
+		seen[l] = true
+	}
+
+	return l.Set_forward_queue( qid, commence, conclude, amt, usr )
+}
+
 /*
 	Return the usr name associated with the path.
 */
@@ -614,9 +670,9 @@ func (p *Path) Get_intermed_spq( tstamp int64 )  ( []*Spq ){
 	attached host.  This is _not_ the same as the ingress link and egress link which are
 	the information related to the first true link on the path.
 
-	This function will return nil pointers when both hosts are on the same switch as
-	that case is managed as a virtual link and not as endpoints (probably should be
-	changed, but for now that's the way it is).
+	When both hosts are on the same switch the path is a virtual link between their ports,
+	and the endpoints are the links from the switch to each of the ports. A local path (both
+	hosts on the same port) has no endpoints and nil pointers are returned.
 
 	Qid is the queue base name that we'll attach E0 and E1 to as a prefix.
 
@@ -730,6 +786,61 @@ func (p *Path) Has_anchors( a1 *string, a2 *string ) ( bool ) {
 	}
 }
 
+/*
+	Returns true if the named switch is on the path. Match is applied to each switch
+	id and should return true if the id is considered the same as the name (allows
+	the caller to deal with domain suffixes and the like).
+*/
+func (p *Path) Has_switch( match func( id string ) bool ) ( bool ) {
+	if p == nil {
+		return false
+	}
+
+	for i := 0; i < p.sidx; i++ {
+		if id := p.switches[i].Get_id(); id != nil && match( *id ) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Returns the ids of the links on the path.
+*/
+func (p *Path) Get_link_ids( ) ( ids []string ) {
+	if p == nil {
+		return nil
+	}
+
+	ids = make( []string, 0, p.lidx )
+	for i := 0; i < p.lidx; i++ {
+		if id := p.links[i].Get_id(); id != nil {
+			ids = append( ids, *id )
+		}
+	}
+
+	return ids
+}
+
+/*
+	Returns the ids of the switches on the path.
+*/
+func (p *Path) Get_switch_ids( ) ( ids []string ) {
+	if p == nil {
+		return nil
+	}
+
+	ids = make( []string, 0, p.sidx )
+	for i := 0; i < p.sidx; i++ {
+		if id := p.switches[i].Get_id(); id != nil {
+			ids = append( ids, *id )
+		}
+	}
+
+	return ids
+}
+
 // ------------------------ string/json/human output functions ------------------------------------
 
 /*
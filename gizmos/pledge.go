@@ -38,13 +38,26 @@
 
 	Mods:		16 Aug 2015 - listed funcs provided by Pledge_base, and those that must be written per Pledge type
 				12 Apr 2016 - Support for duplicate refresh capability.
+				16 Oct 2026 - Added correlation id get/set.
+				16 Oct 2026 - Added consent get/set.
+				16 Oct 2026 - Json2pledge uses the pledge type registry.
+				16 Oct 2026 - Added Get_state().
+				16 Oct 2026 - Added metadata get/set.
+				16 Oct 2026 - Added name (and description) get/set.
+				16 Oct 2026 - Json2pledge decodes strictly; no pledge is returned on error.
+				16 Oct 2026 - Added Get_touched().
+				16 Oct 2026 - Added SLA breach get/set.
+				16 Oct 2026 - Added origin get/set.
+				16 Oct 2026 - Added late start get/clear.
+				16 Oct 2026 - Added Get_transitions().
+				16 Oct 2026 - Added owner group add/del/get.
+				16 Oct 2026 - Added Snapshot().
 */
 
 package gizmos
 
 import (
 	"fmt"
-	"encoding/json"
 )
 
 /*
@@ -53,24 +66,48 @@ import (
  */
 type Pledge interface {
 	// The following are implemented by Pledge_base
+	Add_owner( c string ) ( error )
+	Clear_late_start( )
 	Concluded_recently( window int64 ) ( bool )
 	Commenced_recently( window int64 ) ( bool )
+	Del_owner( c string ) ( error )
+	Get_cid( ) ( string )
+	Get_consent( ) ( string )
+	Get_depends( ) ( string )
+	Get_meta( ) ( map[string]string )
+	Get_name( ) ( string, string )
+	Get_origin( ) ( *Origin )
+	Get_owners( ) ( []string )
 	Get_id( ) ( *string )
+	Get_late_start( ) ( int64 )
+	Get_state( ) ( string )
+	Get_touched( ) ( []Touch, int )
+	Get_transitions( ) ( []Transition )
 	Get_window( ) ( int64, int64 )
 	Is_active( ) ( bool )
 	Is_active_soon( window int64 ) ( bool )
+	Is_awaiting_approval( ) ( bool )
 	Is_expired( ) ( bool )
 	Is_extinct( window int64 ) ( bool )
 	Is_pending( ) ( bool )
 	Is_pushed( ) (bool)
 	Is_paused( ) ( bool )
+	Is_sla_breach( ) ( bool )
 	Is_valid_cookie( c *string ) ( bool )
 	Pause( bool )
 	Reset_pushed( )
 	Resume( bool )
 	Same_anchors( *string, *string ) ( bool )
+	Set_awaiting_approval( bool )
+	Set_cid( string )
+	Set_consent( string )
+	Set_depends( string )
+	Set_meta( key string, value string ) ( error )
+	Set_name( name string, desc string ) ( error )
+	Set_origin( *Origin )
 	Set_expiry( expiry int64 )
 	Set_pushed()
+	Set_sla_breach( bool )
 
 	// The following must be implemented by each separate Pledge type
 	Equals( *Pledge ) ( bool )
@@ -78,6 +115,7 @@ type Pledge interface {
 	Has_host( *string ) ( bool )
 	Nuke()
 	String() ( string )
+	Snapshot( ) ( Pledge )
 	To_chkpt( ) ( string )
 	To_json( ) ( string )
 	To_str() ( string )
@@ -96,49 +134,39 @@ type J2p struct {
 
 /*
 	Given a string that contains valid json, unpack it and examine
-	the ptype. Based on ptype, allocate a specific pledge block and
-	invoke it's function to unpack the string.
+	the ptype. Based on ptype, find the registered kind and invoke
+	its decoder to unpack the string (see pledge_reg.go). Decoders are
+	strict (pledge_json.go): an unknown field, a value of the wrong type,
+	or a missing id is an error and no pledge is returned; the error gives
+	the position in the record.
 */
 func Json2pledge( jstr *string ) ( p *Pledge, err error ) {
 	var pi Pledge
 
 	jp := new( J2p )
-	err = json.Unmarshal( []byte( *jstr ), &jp )
-	if err == nil {
-		if jp.Ptype != nil {
-			switch *jp.Ptype {
-				case PT_BANDWIDTH:
-					bp := new( Pledge_bw )
-					bp.From_json( jstr )
-					pi = Pledge( bp )			// convert to interface type
-
-				case PT_OWBANDWIDTH:			// one way bandwidth
-					obp := new( Pledge_bwow )
-					obp.From_json( jstr)
-					pi = Pledge( obp )
-	
-				case PT_MIRRORING:
-					mp := new( Pledge_mirror )
-					mp.From_json( jstr )
-					pi = Pledge( mp )			// convert to interface type
-					
-				case PT_STEERING:
-					mp := new( Pledge_steer )
-					mp.From_json( jstr )
-					pi = Pledge( mp )			// convert to interface type
-	
-				case PT_PASSTHRU:
-					pt := new( Pledge_pass )
-					pt.From_json( jstr )
-					pi = Pledge( pt )			// convert to interface type
-
-				default:
-					err = fmt.Errorf( "unknown pledge type in json: %d: %s", *jp.Ptype, *jstr )
-					return
-			}
-		} else {
-			err = fmt.Errorf( "no ptype found in json, unable to convert to pledge: %s", *jstr )
-		}
+	if err = Decode_json( jstr, jp, false ); err != nil {
+		err = fmt.Errorf( "bad pledge json: %s: %s", err, *jstr )
+		return
+	}
+
+	if jp.Ptype == nil {
+		err = fmt.Errorf( "no ptype found in json, unable to convert to pledge: %s", *jstr )
+		return
+	}
+
+	k := Pledge_kind_of_ptype( *jp.Ptype )
+	if k == nil || k.Decode == nil {
+		err = fmt.Errorf( "unknown pledge type in json: %d: %s", *jp.Ptype, *jstr )
+		return
+	}
+
+	if pi, err = k.Decode( jstr ); err != nil {
+		err = fmt.Errorf( "unable to decode %s pledge: %s: %s", k.Name, err, *jstr )
+		return
+	}
+	if id := pi.Get_id(); id == nil || *id == "" {
+		err = fmt.Errorf( "unable to decode %s pledge: no id: %s", k.Name, *jstr )
+		return
 	}
 
 	p = &pi
@@ -35,16 +35,52 @@
 	Author:		E. Scott Daniels / Robert Eby
 
 	Mods:		12 Apr 2016 - Duplicate refresh support.
+				16 Oct 2026 - Added correlation id.
+				16 Oct 2026 - Added awaiting approval state.
+				16 Oct 2026 - Added consent (cross-tenant) state.
+				16 Oct 2026 - Added Get_state().
+				16 Oct 2026 - Added dependency (depends) on another pledge.
+				16 Oct 2026 - Added user metadata (pledge_meta.go).
+				16 Oct 2026 - Added name and description.
+				16 Oct 2026 - Added switches touched by the last push (pledge_touch.go).
+				16 Oct 2026 - Added SLA breach mark.
+				16 Oct 2026 - Added request origin (pledge_origin.go).
+				16 Oct 2026 - Added late start (commence moved forward when made or reloaded).
+				16 Oct 2026 - Added Get_transitions().
+				16 Oct 2026 - Cookie check includes the owner group (pledge_owners.go).
+				16 Oct 2026 - Added snapshot_base() for Snapshot().
 */
 
 package gizmos
 
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MAX_NAME_LEN	int = 64				// bytes in a user supplied name
+	MAX_DESC_LEN	int = 256				// bytes in a user supplied description
+)
+
 type Pledge_base struct {
 	id			*string			// name that the client can use to manage (modify/delete)
 	window		*pledge_window	// the window of time for which the pledge is active
 	pushed		bool			// set when pledge has been pushed into openflow or openvswitch
 	paused		bool			// set if reservation has been paused
 	usrkey		*string			// a 'cookie' supplied by the user to prevent any other user from modifying
+	owners		[]string		// further cookies which may manage the pledge (pledge_owners.go); nil if none
+	cid			string			// correlation id of the request that created the pledge
+	awaiting	bool			// set while the pledge is waiting for admin approval; must not be pushed
+	consent		string			// project whose consent the pledge is waiting for (cross-tenant); empty if none
+	depends		string			// id of the pledge which must be pushed before this one is; empty if none
+	meta		map[string]string	// user supplied key/value metadata (pledge_meta.go); nil if none
+	name		string			// user supplied name (not unique, not the id); empty if none
+	desc		string			// user supplied description; empty if none
+	touched		*touch_list		// switch/port/queues programmed by the last push (pledge_touch.go); nil until pushed
+	sla_breach	bool			// set while traffic is held below the guarantee (managers/res_mgr_sla.go); not checkpointed
+	origin		*Origin			// where the request came from (pledge_origin.go); nil if not known; not checkpointed
 }
 
 /*
@@ -79,6 +115,26 @@ func (p *Pledge_base) Get_id( ) ( *string ) {
 	return p.id
 }
 
+/*
+	Returns the correlation id of the request which created the pledge; empty if not known
+	(e.g. pledge was loaded from a checkpoint written before the id was saved).
+*/
+func (p *Pledge_base) Get_cid( ) ( string ) {
+	if p == nil {
+		return ""
+	}
+	return p.cid
+}
+
+/*
+	Sets the correlation id.
+*/
+func (p *Pledge_base) Set_cid( cid string ) {
+	if p != nil {
+		p.cid = cid
+	}
+}
+
 /*
 	Return the commence and expiry times.
 */
@@ -89,6 +145,36 @@ func (p *Pledge_base) Get_window( ) ( int64, int64 ) {
 	return p.window.get_values()
 }
 
+/*
+	Return the times that the pledge's state changes (see pledge_window.transitions()).
+*/
+func (p *Pledge_base) Get_transitions( ) ( []Transition ) {
+	if p == nil {
+		return nil
+	}
+	return p.window.transitions()
+}
+
+/*
+	Return the commence time that was asked for if it had already passed when the pledge was
+	made, or reloaded from a checkpoint, and was moved forward to then; 0 otherwise.
+*/
+func (p *Pledge_base) Get_late_start( ) ( int64 ) {
+	if p == nil {
+		return 0
+	}
+	return p.window.late_start()
+}
+
+/*
+	Forget the late start once it has been dealt with.
+*/
+func (p *Pledge_base) Clear_late_start( ) {
+	if p != nil {
+		p.window.clear_late_start()
+	}
+}
+
 /*
 	Returns true if the pledge is currently active (the commence time is <= than the current time
 	and the expiry time is > the current time.
@@ -163,15 +249,78 @@ func (p *Pledge_base) Is_paused( ) ( bool ) {
 	return p.paused
 }
 
+/*
+	Returns the project whose consent the pledge is waiting for; empty string if it isn't.
+*/
+func (p *Pledge_base) Get_consent( ) ( string ) {
+	if p == nil {
+		return ""
+	}
+	return p.consent
+}
+
+/*
+	Returns the user supplied name and description; empty strings if not given.
+*/
+func (p *Pledge_base) Get_name( ) ( name string, desc string ) {
+	if p == nil {
+		return "", ""
+	}
+	return p.name, p.desc
+}
+
+/*
+	Returns the id of the pledge that this one depends on; empty string if none.
+*/
+func (p *Pledge_base) Get_depends( ) ( string ) {
+	if p == nil {
+		return ""
+	}
+	return p.depends
+}
+
+/*
+	Returns the state of the pledge's window as it appears in the json (PENDING, ACTIVE,
+	EXPIRING_SOON or EXPIRED).
+*/
+func (p *Pledge_base) Get_state( ) ( string ) {
+	if p == nil {
+		return "EXPIRED"
+	}
+
+	state, _, _ := p.window.state_str()
+	return state
+}
+
+/*
+	Returns true if the pledge is waiting for an admin to approve it.
+*/
+func (p *Pledge_base) Is_awaiting_approval( ) ( bool ) {
+	if p == nil {
+		return false
+	}
+	return p.awaiting
+}
+
+/*
+	Returns true if the pledge is marked as being in breach of its guarantee.
+*/
+func (p *Pledge_base) Is_sla_breach( ) ( bool ) {
+	if p == nil {
+		return false
+	}
+	return p.sla_breach
+}
+
 /*
 	Check the cookie passed in and return true if it matches the cookie on the
-	pledge.
+	pledge or is a member of its owner group.
 */
 func (p *Pledge_base) Is_valid_cookie( c *string ) ( bool ) {
 	if p == nil || c == nil {
 		return false
 	}
-	return *c == *p.usrkey
+	return *c == *p.usrkey || p.is_owner( *c )
 }
 
 // There is NOT a toggle pause on purpose; don't add one :)
@@ -210,6 +359,69 @@ func (p *Pledge_base) Set_expiry ( v int64 ) {
 	}
 }
 
+/*
+	Marks the pledge as waiting for approval (true) or approved (false).
+*/
+func (p *Pledge_base) Set_awaiting_approval( state bool ) {
+	if p != nil {
+		p.awaiting = state
+	}
+}
+
+/*
+	Marks the pledge as being in breach of its guarantee (true) or not (false).
+*/
+func (p *Pledge_base) Set_sla_breach( state bool ) {
+	if p != nil {
+		p.sla_breach = state
+	}
+}
+
+/*
+	Sets the project whose consent the pledge must wait for; empty string once given.
+*/
+func (p *Pledge_base) Set_consent( project string ) {
+	if p != nil {
+		p.consent = project
+	}
+}
+
+/*
+	Sets the user supplied name and description. An error is returned, and neither is
+	changed, if one is too long or contains control characters.
+*/
+func (p *Pledge_base) Set_name( name string, desc string ) ( error ) {
+	if p == nil {
+		return fmt.Errorf( "no pledge" )
+	}
+
+	if len( name ) > MAX_NAME_LEN {
+		return fmt.Errorf( "reservation name is longer than %d characters", MAX_NAME_LEN )
+	}
+	if len( desc ) > MAX_DESC_LEN {
+		return fmt.Errorf( "reservation description is longer than %d characters", MAX_DESC_LEN )
+	}
+	if has_ctl( name ) || has_ctl( desc ) {
+		return fmt.Errorf( "reservation name and description may not contain control characters" )
+	}
+	if ! utf8.ValidString( name ) || ! utf8.ValidString( desc ) {
+		return fmt.Errorf( "reservation name and description must be valid UTF-8" )
+	}
+
+	p.name = name
+	p.desc = desc
+	return nil
+}
+
+/*
+	Sets the id of the pledge that must be pushed before this one; empty string clears.
+*/
+func (p *Pledge_base) Set_depends( id string ) {
+	if p != nil {
+		p.depends = id
+	}
+}
+
 /*
 	Sets the pushed flag to true.
 */
@@ -234,3 +446,36 @@ func (p *Pledge_base) Reset_pushed( ) {
 func (p *Pledge_base) Same_anchors( a1 *string, a2 *string ) (bool ) {
 	return false;
 }
+
+/*
+	Return a copy of the base which shares nothing that is changed in place (window, owner
+	group, metadata) so that the copy can be read by another goroutine while the original
+	is changed. What isn't checkpointed (touched, origin) is not carried.
+*/
+func (p *Pledge_base) snapshot_base( ) ( b Pledge_base ) {
+	b = *p
+	if p.window != nil {
+		w := *p.window
+		b.window = &w
+	}
+	if p.owners != nil {
+		b.owners = append( []string( nil ), p.owners... )
+	}
+	if p.meta != nil {
+		b.meta = make( map[string]string, len( p.meta ) )
+		for k, v := range p.meta {
+			b.meta[k] = v
+		}
+	}
+	b.touched = nil
+	b.origin = nil
+
+	return b
+}
+
+/*
+	Returns true if the string has a control character.
+*/
+func has_ctl( s string ) ( bool ) {
+	return strings.IndexFunc( s, func( c rune ) bool { return c < ' ' || c == 0x7f } ) >= 0
+}
@@ -44,12 +44,28 @@
 				04 Feb 2016 - Added protocol to chkpt, and string functions.
 				11 Apr 2016 - Correct bad % on String() output.
 				12 Apr 2016 - Duplicate refresh support.
+				16 Oct 2026 - Added handover (make-before-break) support.
+				16 Oct 2026 - Added Set_bandw().
+				16 Oct 2026 - Awaiting approval state added to json and checkpoint.
+				16 Oct 2026 - Consent added to json and checkpoint.
+				16 Oct 2026 - Depends added to json and checkpoint.
+				16 Oct 2026 - Metadata added to json and checkpoint.
+				16 Oct 2026 - Name and description added to json and checkpoint.
+				16 Oct 2026 - Added bulk (deadline) byte counts; added to json and checkpoint.
+				16 Oct 2026 - From_json is strict; unknown fields and bad values are errors.
+				16 Oct 2026 - Switches touched by the last push added to json.
+				16 Oct 2026 - SLA breach mark added to json.
+				16 Oct 2026 - Added Clone_window() to split a pledge around blackouts.
+				16 Oct 2026 - Added the re-optimisation opt-in; added to json and checkpoint.
+				16 Oct 2026 - Owner group added to checkpoint.
+				16 Oct 2026 - The id of the pledge being replaced (handover) is checkpointed.
+				16 Oct 2026 - Label selector id added to json and checkpoint.
+				16 Oct 2026 - Correlation id is checkpointed and restored.
 */
 
 package gizmos
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/att/gopkgs/clike"
@@ -71,6 +87,12 @@ type Pledge_bw struct {
 	qid			*string		// name that we'll assign to the queue which allows us to look up the pledge's queues
 	path_list	[]*Path		// list of paths that represent the bandwith and can be used to send flowmods etc.
 	match_v6	bool		// true if we should force flow-mods to match on IPv6
+	replaces	*string		// id of the pledge that this one replaces (handover); nil once the handover is complete
+	pbump		int			// priority bump applied to flow-mods; alternates between 0 and 1 with each handover
+	bulk_bytes	int64		// bytes to move before the expiry of a bulk (deadline) pledge; 0 if it isn't one
+	bulk_moved	int64		// bytes of a bulk pledge counted as moved so far
+	reopt		bool		// true if the pledge may be moved to a better path while active
+	selector	string		// id of the label selector that created the pledge; empty if none
 }
 
 /*
@@ -92,7 +114,21 @@ type Json_pledge_bw struct {
 	Id			*string
 	Qid			*string
 	Usrkey		*string
+	Owners		[]string
+	Cid			string
 	Match_v6	bool
+	Pbump		int
+	Replaces	string
+	Awaiting	bool
+	Consent		string
+	Depends		string
+	Meta		map[string]string
+	Name		string
+	Desc		string
+	Bulk_bytes	int64
+	Bulk_moved	int64
+	Reopt		bool
+	Selector	string
 	Ptype		int
 }
 
@@ -302,6 +338,34 @@ func (p *Pledge_bw) Get_vlan( ) ( v1 *string, v2 *string ) {
 	return p.vlan1, p.vlan2
 }
 
+/*
+	Create a copy of the pledge with a new id and window. Unlike Clone(), everything that
+	is checkpointed (name, metadata, depends...) is copied, but the path list and push state
+	are not; the copy is a new pledge which must be admitted as any other. Handover isn't
+	copied either. Used to split a pledge around blackout periods.
+*/
+func (p *Pledge_bw) Clone_window( name string, commence int64, expiry int64 ) ( np *Pledge_bw, err error ) {
+	if p == nil {
+		return nil, fmt.Errorf( "no pledge to clone" )
+	}
+
+	cstr := p.To_chkpt()
+	np = new( Pledge_bw )
+	if err = np.From_json( &cstr ); err != nil {
+		return nil, err
+	}
+	if np.window, err = mk_pledge_window( commence, expiry ); err != nil {
+		return nil, err
+	}
+
+	np.id = &name
+	np.qid = &empty_str									// set when the network reserves its queues
+	np.cid = p.cid
+	np.match_v6 = p.match_v6
+	np.origin = p.origin
+	return np, nil
+}
+
 /*
 	Create a clone of the pledge.  The path is NOT a copy, but just a reference to the list
 	from the original.
@@ -323,6 +387,7 @@ func (p *Pledge_bw) Clone( name string ) ( *Pledge_bw ) {
 		dscp:		p.dscp,
 		qid:		p.qid,
 		path_list:	p.path_list,
+		pbump:		p.pbump,
 	}
 
 	newpbw.window = p.window.clone()
@@ -409,7 +474,7 @@ func (p *Pledge_bw) Nuke( ) {
 */
 func (p *Pledge_bw) From_json( jstr *string ) ( err error ){
 	jp := new( Json_pledge_bw )
-	err = json.Unmarshal( []byte( *jstr ), &jp )
+	err = Decode_json( jstr, jp, true )
 	if err != nil {
 		return
 	}
@@ -431,6 +496,23 @@ func (p *Pledge_bw) From_json( jstr *string ) ( err error ){
 	p.qid = jp.Qid
 	p.bandw_out = jp.Bandwout
 	p.bandw_in = jp.Bandwin
+	p.pbump = jp.Pbump
+	if jp.Replaces != "" {				// handover not complete when checkpointed
+		rid := jp.Replaces
+		p.replaces = &rid
+	}
+	p.awaiting = jp.Awaiting
+	p.consent = jp.Consent
+	p.depends = jp.Depends
+	p.load_meta( jp.Meta )
+	p.load_owners( jp.Owners )
+	p.cid = jp.Cid
+	p.name = jp.Name
+	p.desc = jp.Desc
+	p.bulk_bytes = jp.Bulk_bytes
+	p.bulk_moved = jp.Bulk_moved
+	p.reopt = jp.Reopt
+	p.selector = jp.Selector
 
 	p.protocol = jp.Protocol
 	if p.protocol == nil {					// we don't tolerate nil ptrs
@@ -448,6 +530,19 @@ func (p *Pledge_bw) Set_qid( id *string ) {
 	p.qid = id
 }
 
+/*
+	Change the amount of bandwidth. Only sensible before the pledge has been added
+	to the network (e.g. when clamped by the admission policy).
+*/
+func (p *Pledge_bw) Set_bandw( bw_in int64, bw_out int64 ) {
+	if p == nil {
+		return
+	}
+
+	p.bandw_in = bw_in
+	p.bandw_out = bw_out
+}
+
 /*
 	Associates a path list with the pledge.
 */
@@ -466,6 +561,129 @@ func (p *Pledge_bw) Add_proto( proto *string ) {
 	p.protocol = proto
 }
 
+/*
+	Marks this pledge as the replacement for the pledge with the given id. The flow-mod
+	priority bump is set to be the opposite of the bump used by the old pledge so that
+	the new flow-mods are installed alongside, rather than on top of, the old ones and
+	the old pledge can be expired without leaving a gap.
+*/
+func (p *Pledge_bw) Set_handover( oid *string, obump int ) {
+	if p == nil {
+		return
+	}
+
+	p.replaces = oid
+	if obump == 0 {
+		p.pbump = 1
+	} else {
+		p.pbump = 0
+	}
+}
+
+/*
+	Returns the id of the pledge that is being replaced, or nil if there is no
+	handover pending.
+*/
+func (p *Pledge_bw) Get_handover( ) ( *string ) {
+	if p == nil {
+		return nil
+	}
+
+	return p.replaces
+}
+
+/*
+	Marks the handover as complete.
+*/
+func (p *Pledge_bw) Clear_handover( ) {
+	if p != nil {
+		p.replaces = nil
+	}
+}
+
+/*
+	Makes the pledge a bulk (deadline) pledge which is to move the number of bytes given
+	before it expires.
+*/
+func (p *Pledge_bw) Set_bulk( nbytes int64 ) {
+	if p != nil {
+		p.bulk_bytes = nbytes
+	}
+}
+
+/*
+	Allows, or prevents, the pledge from being moved to a better path while it is active.
+*/
+func (p *Pledge_bw) Set_reopt( state bool ) {
+	if p != nil {
+		p.reopt = state
+	}
+}
+
+/*
+	Returns true if the pledge may be moved to a better path.
+*/
+func (p *Pledge_bw) Is_reopt( ) ( bool ) {
+	return p != nil && p.reopt
+}
+
+/*
+	Marks the pledge as a member of the label selector with the given id.
+*/
+func (p *Pledge_bw) Set_selector( id string ) {
+	if p != nil {
+		p.selector = id
+	}
+}
+
+/*
+	Returns the id of the label selector that created the pledge, or an empty string.
+*/
+func (p *Pledge_bw) Get_selector( ) ( string ) {
+	if p == nil {
+		return ""
+	}
+
+	return p.selector
+}
+
+/*
+	Returns the bytes a bulk pledge is to move and the bytes counted as moved so far;
+	zeros if the pledge isn't a bulk pledge.
+*/
+func (p *Pledge_bw) Get_bulk( ) ( nbytes int64, moved int64 ) {
+	if p == nil {
+		return 0, 0
+	}
+
+	return p.bulk_bytes, p.bulk_moved
+}
+
+/*
+	Adds to the bytes counted as moved by a bulk pledge and returns the new total.
+*/
+func (p *Pledge_bw) Add_bulk_moved( n int64 ) ( int64 ) {
+	if p == nil {
+		return 0
+	}
+
+	if n > 0 {
+		p.bulk_moved += n
+	}
+	return p.bulk_moved
+}
+
+/*
+	Returns the flow-mod priority bump for the pledge.
+*/
+func (p *Pledge_bw) Get_pbump( ) ( int ) {
+	if p == nil {
+		return 0
+	}
+
+	return p.pbump
+}
+
 /*
 	Return the protocol associated with the pledge.
 */
@@ -604,12 +822,25 @@ func (p *Pledge_bw) To_json( ) ( json string ) {
 	state, _, diff := p.window.state_str()		// get state as a string
 	v1, v2 := p.bw_vlan2string( )
 
-	json = fmt.Sprintf( `{ "state": %q, "time": %d, "bandwin": %d, "bandwout": %d, "host1": "%s:%s%s", "host2": "%s:%s%s", "id": %q, "qid": %q, "dscp": %d, "dscp_koe": %v, "protocol": %q, "ptype": %d }`,
-				state, diff, p.bandw_in,  p.bandw_out, *p.host1, *p.tpport1, v1, *p.host2, *p.tpport2, v2, *p.id, *p.qid, p.dscp, p.dscp_koe, *p.protocol, PT_BANDWIDTH )
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "bandwin": %d, "bandwout": %d, "host1": "%s:%s%s", "host2": "%s:%s%s", "id": %q, "qid": %q, "dscp": %d, "dscp_koe": %v, "protocol": %q, "awaiting_approval": %v, "consent": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "bulk_bytes": %d, "bulk_moved": %d, "reopt": %v, "selector": %q, "touched": %s, "sla_breach": %v, "ptype": %d }`,
+				state, diff, p.bandw_in,  p.bandw_out, *p.host1, *p.tpport1, v1, *p.host2, *p.tpport2, v2, *p.id, *p.qid, p.dscp, p.dscp_koe, *p.protocol, p.awaiting, p.consent, p.depends, p.meta_json(), p.name, p.desc, p.bulk_bytes, p.bulk_moved, p.reopt, p.selector, p.touched_json(), p.sla_breach, PT_BANDWIDTH )
 
 	return
 }
 
+/*
+	Return a copy of the pledge which can be checkpointed (To_chkpt) by another goroutine
+	while the original continues to be changed.
+	The path list (not checkpointed) is not carried.
+*/
+func (p *Pledge_bw) Snapshot( ) ( Pledge ) {
+	np := *p
+	np.Pledge_base = p.snapshot_base( )
+	np.path_list = nil
+
+	return &np
+}
+
 /*
 	Build a checkpoint string -- probably json, but it will contain everything including the user key.
 	We still won't use the json package because that means making all of the fields available to outside
@@ -635,9 +866,13 @@ func (p *Pledge_bw) To_chkpt( ) ( chkpt string ) {
 
 	commence, expiry := p.window.get_values()
 	v1, v2 := p.bw_vlan2string( )
+	replaces := ""
+	if p.replaces != nil {
+		replaces = *p.replaces
+	}
 
-	chkpt = fmt.Sprintf( `{ "host1": "%s:%s%s", "host2": "%s:%s%s", "commence": %d, "expiry": %d, "bandwin": %d, "bandwout": %d, "id": %q, "qid": %q, "usrkey": %q, "dscp": %d, "dscp_koe": %v, "protocol": %q, "ptype": %d }`,
-			*p.host1, *p.tpport1, v1, *p.host2, *p.tpport2, v2, commence, expiry, p.bandw_in, p.bandw_out, *p.id, *p.qid, *p.usrkey, p.dscp, p.dscp_koe, *p.protocol, PT_BANDWIDTH )
+	chkpt = fmt.Sprintf( `{ "host1": "%s:%s%s", "host2": "%s:%s%s", "commence": %d, "expiry": %d, "bandwin": %d, "bandwout": %d, "id": %q, "qid": %q, "usrkey": %q, "owners": %s, "cid": %q, "dscp": %d, "dscp_koe": %v, "protocol": %q, "pbump": %d, "replaces": %q, "awaiting": %v, "consent": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "bulk_bytes": %d, "bulk_moved": %d, "reopt": %v, "selector": %q, "ptype": %d }`,
+			*p.host1, *p.tpport1, v1, *p.host2, *p.tpport2, v2, commence, expiry, p.bandw_in, p.bandw_out, *p.id, *p.qid, *p.usrkey, p.owners_json(), p.cid, p.dscp, p.dscp_koe, *p.protocol, p.pbump, replaces, p.awaiting, p.consent, p.depends, p.meta_json(), p.name, p.desc, p.bulk_bytes, p.bulk_moved, p.reopt, p.selector, PT_BANDWIDTH )
 
 	return
 }
@@ -37,12 +37,22 @@
 				16 Aug 2015 : Move common code into Pledge_base
 				04 Feb 2016 : Add proto to chkpt and string output.
 				12 Apr 2016 : Correct bug in String() output.
+				16 Oct 2026 : Added Set_bandwidth().
+				16 Oct 2026 : Awaiting approval state added to json and checkpoint.
+				16 Oct 2026 : Consent added to json and checkpoint.
+				16 Oct 2026 : Match_v6 added to the checkpoint.
+				16 Oct 2026 : Depends added to json and checkpoint.
+				16 Oct 2026 : Metadata added to json and checkpoint.
+				16 Oct 2026 : Name and description added to json and checkpoint.
+				16 Oct 2026 : Checkpoint json decoded strictly.
+				16 Oct 2026 : Switches touched by the last push added to json.
+				16 Oct 2026 : Owner group added to checkpoint.
+				16 Oct 2026 : Correlation id is checkpointed and restored.
 */
 
 package gizmos
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/att/gopkgs/clike"
@@ -82,7 +92,15 @@ type Json_pledge_bwow struct {
 	Id			*string
 	Qid			*string
 	Usrkey		*string
+	Owners		[]string
+	Cid			string
 	Match_v6	bool
+	Awaiting	bool
+	Consent		string
+	Depends		string
+	Meta		map[string]string
+	Name		string
+	Desc		string
 	Ptype		int
 }
 
@@ -247,6 +265,17 @@ func (p *Pledge_bwow) Set_qid( id *string ) {
 	p.qid = id
 }
 
+/*
+	Change the amount of bandwidth; only sensible before the pledge is accepted.
+*/
+func (p *Pledge_bwow) Set_bandwidth( bw int64 ) {
+	if( p == nil ) {
+		return
+	}
+
+	p.bandw_out = bw
+}
+
 /*
 	Returns the matching vlan IDs.
 */
@@ -341,7 +370,7 @@ func (p *Pledge_bwow) Nuke( ) {
 */
 func (p *Pledge_bwow) From_json( jstr *string ) ( err error ){
 	jp := new( Json_pledge_bwow )
-	err = json.Unmarshal( []byte( *jstr ), &jp )
+	err = Decode_json( jstr, jp, true )
 	if err != nil {
 		return
 	}
@@ -361,6 +390,15 @@ func (p *Pledge_bwow) From_json( jstr *string ) ( err error ){
 	p.usrkey = jp.Usrkey
 	p.qid = jp.Qid
 	p.bandw_out = jp.Bandwout
+	p.awaiting = jp.Awaiting
+	p.consent = jp.Consent
+	p.depends = jp.Depends
+	p.load_meta( jp.Meta )
+	p.load_owners( jp.Owners )
+	p.cid = jp.Cid
+	p.name = jp.Name
+	p.desc = jp.Desc
+	p.match_v6 = jp.Match_v6
 
 	p.protocol = jp.Protocol
 	if p.protocol == nil {					// we don't tolerate nil ptrs
@@ -506,12 +544,25 @@ func (p *Pledge_bwow) To_json( ) ( json string ) {
 	state, _, diff := p.window.state_str()		// get state as a string
 	v1 := p.vlan2string( )
 
-	json = fmt.Sprintf( `{ "state": %q, "time": %d, "bandwout": %d, "src": "%s:%s%s", "dest": "%s:%s", "id": %q, "qid": %q, "dscp": %d, "protocol": %q, "ptype": %d }`,
-				state, diff,  p.bandw_out, *p.src, *p.src_tpport, v1, *p.dest, *p.dest_tpport, *p.id, *p.qid, p.dscp, *p.protocol, PT_OWBANDWIDTH )
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "bandwout": %d, "src": "%s:%s%s", "dest": "%s:%s", "id": %q, "qid": %q, "dscp": %d, "protocol": %q, "awaiting_approval": %v, "consent": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "touched": %s, "ptype": %d }`,
+				state, diff,  p.bandw_out, *p.src, *p.src_tpport, v1, *p.dest, *p.dest_tpport, *p.id, *p.qid, p.dscp, *p.protocol, p.awaiting, p.consent, p.depends, p.meta_json(), p.name, p.desc, p.touched_json(), PT_OWBANDWIDTH )
 
 	return
 }
 
+/*
+	Return a copy of the pledge which can be checkpointed (To_chkpt) by another goroutine
+	while the original continues to be changed.
+	The gate (not checkpointed) is not carried.
+*/
+func (p *Pledge_bwow) Snapshot( ) ( Pledge ) {
+	np := *p
+	np.Pledge_base = p.snapshot_base( )
+	np.epoint = nil
+
+	return &np
+}
+
 /*
 	Build a checkpoint string -- probably json, but it will contain everything including the user key.
 	We still won't use the json package because that means making all of the fields available to outside
@@ -534,8 +585,8 @@ func (p *Pledge_bwow) To_chkpt( ) ( chkpt string ) {
 	commence, expiry := p.window.get_values()
 	v1 := p.vlan2string( )
 
-	chkpt = fmt.Sprintf( `{ "src": "%s:%s%s", "dest": "%s:%s", "commence": %d, "expiry": %d, "bandwout": %d, "id": %q, "qid": %q, "usrkey": %q, "dscp": %d, "protocol": %q, "ptype": %d }`,
-			*p.src, *p.src_tpport, v1, *p.dest, *p.dest_tpport,  commence, expiry, p.bandw_out, *p.id, *p.qid, *p.usrkey, p.dscp, *p.protocol, PT_OWBANDWIDTH )
+	chkpt = fmt.Sprintf( `{ "src": "%s:%s%s", "dest": "%s:%s", "commence": %d, "expiry": %d, "bandwout": %d, "id": %q, "qid": %q, "usrkey": %q, "owners": %s, "cid": %q, "dscp": %d, "protocol": %q, "awaiting": %v, "consent": %q, "match_v6": %v, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`,
+			*p.src, *p.src_tpport, v1, *p.dest, *p.dest_tpport,  commence, expiry, p.bandw_out, *p.id, *p.qid, *p.usrkey, p.owners_json(), p.cid, p.dscp, *p.protocol, p.awaiting, p.consent, p.match_v6, p.depends, p.meta_json(), p.name, p.desc, PT_OWBANDWIDTH )
 
 	return
 }
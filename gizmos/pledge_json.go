@@ -0,0 +1,230 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	pledge_json
+	Abstract:	Strict decoding of pledge (checkpoint) json, and the json schema that describes
+				the records.
+
+				Pledges are decoded into their work structs (Json_pledge_bw etc.) with unknown
+				fields and values of the wrong type treated as errors, and anything after the
+				record's object rejected. The error (Json_err) gives the line, column and byte
+				offset within the record where the problem was found, and the field if known,
+				so that a damaged checkpoint record can be found rather than a pledge being
+				built from whatever could be salvaged.
+
+				The schema is built from the work struct registered with each kind of pledge
+				(Pledge_kind.Json) and so is always in step with what the decoders accept. Field
+				names are given in lower case as the checkpoint writes them; the decoder matches
+				them without regard to case.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package gizmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+	A json decoding error with its position in the record.
+*/
+type Json_err struct {
+	Line	int							// line and column, from 1
+	Col		int
+	Offset	int64						// bytes from the start of the record
+	Field	string						// field being decoded, if known
+	Reason	string
+}
+
+func (je *Json_err) Error( ) ( string ) {
+	if je.Field != "" {
+		return fmt.Sprintf( "line %d column %d (offset %d): field %s: %s", je.Line, je.Col, je.Offset, je.Field, je.Reason )
+	}
+	return fmt.Sprintf( "line %d column %d (offset %d): %s", je.Line, je.Col, je.Offset, je.Reason )
+}
+
+/*
+	Build the error for the offset in jstr; line and column are worked out from it.
+*/
+func mk_json_err( jstr string, offset int64, field string, reason string ) ( *Json_err ) {
+	if offset > int64( len( jstr ) ) {
+		offset = int64( len( jstr ) )
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	before := jstr[:offset]
+	line := strings.Count( before, "\n" ) + 1
+	col := len( before ) - strings.LastIndex( before, "\n" )
+
+	return &Json_err{ Line: line, Col: col, Offset: offset, Field: field, Reason: reason }
+}
+
+/*
+	Decode the json in jstr into v. When strict is true fields which are not in v are an
+	error. Values of the wrong type, bad syntax, and anything other than white space after
+	the object are always errors. Errors are returned as *Json_err.
+*/
+func Decode_json( jstr *string, v interface{}, strict bool ) ( error ) {
+	if jstr == nil {
+		return &Json_err{ Line: 1, Col: 1, Reason: "no json" }
+	}
+
+	dec := json.NewDecoder( strings.NewReader( *jstr ) )
+	if strict {
+		dec.DisallowUnknownFields( )
+	}
+
+	err := dec.Decode( v )
+	if err == nil {
+		var extra json.RawMessage
+		if xerr := dec.Decode( &extra ); xerr != io.EOF {
+			end := int64( len( strings.TrimRight( *jstr, " \t\r\n" ) ) )
+			return mk_json_err( *jstr, end, "", "unexpected data after the record" )
+		}
+		return nil
+	}
+
+	switch e := err.( type ) {
+		case *json.SyntaxError:
+			return mk_json_err( *jstr, e.Offset, "", e.Error() )
+
+		case *json.UnmarshalTypeError:
+			field := e.Field
+			if field == "" {
+				field = e.Struct
+			}
+			return mk_json_err( *jstr, e.Offset, strings.ToLower( field ), fmt.Sprintf( "%s value where %s was expected", e.Value, e.Type ) )
+
+		default:
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return mk_json_err( *jstr, int64( len( *jstr ) ), "", "record ends before the object is complete" )
+			}
+
+			msg := err.Error()
+			if i := strings.Index( msg, "unknown field " ); i >= 0 {			// no offset given; find the key in the record
+				field := strings.Trim( msg[i+14:], `"` )
+				off := int64( strings.Index( *jstr, `"` + field + `"` ) )
+				return mk_json_err( *jstr, off, field, "unknown field" )
+			}
+			return mk_json_err( *jstr, 0, "", msg )
+	}
+}
+
+// ---- schema ----------------------------------------------------------------------
+
+/*
+	Return the schema for a value of the type.
+*/
+func type_schema( t reflect.Type ) ( map[string]interface{} ) {
+	switch t.Kind() {
+		case reflect.Ptr:
+			s := type_schema( t.Elem() )
+			if jt, ok := s["type"].( string ); ok {
+				s["type"] = []string{ jt, "null" }
+			}
+			return s
+
+		case reflect.String:
+			return map[string]interface{}{ "type": "string" }
+
+		case reflect.Bool:
+			return map[string]interface{}{ "type": "boolean" }
+
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return map[string]interface{}{ "type": "integer" }
+
+		case reflect.Float32, reflect.Float64:
+			return map[string]interface{}{ "type": "number" }
+
+		case reflect.Slice, reflect.Array:
+			return map[string]interface{}{ "type": []string{ "array", "null" }, "items": type_schema( t.Elem() ) }
+
+		case reflect.Map:
+			return map[string]interface{}{ "type": []string{ "object", "null" }, "additionalProperties": type_schema( t.Elem() ) }
+
+		case reflect.Struct:
+			props := make( map[string]interface{} )
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field( i )
+				if f.PkgPath != "" {						// unexported; not decoded
+					continue
+				}
+				props[strings.ToLower( f.Name )] = type_schema( f.Type )
+			}
+			return map[string]interface{}{ "type": "object", "properties": props, "additionalProperties": false }
+	}
+
+	return map[string]interface{}{ }
+}
+
+/*
+	Return the json schema (draft 7) describing the checkpoint record of each registered
+	kind of pledge which has a work struct. A record must match exactly one of them; the
+	ptype value selects which.
+*/
+func Pledge_schema( ) ( string ) {
+	ptypes := make( []int, 0, len( kinds_by_ptype ) )
+	for pt, k := range kinds_by_ptype {
+		if k.Json != nil {
+			ptypes = append( ptypes, pt )
+		}
+	}
+	sort.Ints( ptypes )
+
+	one_of := make( []interface{}, 0, len( ptypes ) )
+	for _, pt := range ptypes {
+		k := kinds_by_ptype[pt]
+		s := type_schema( reflect.TypeOf( k.Json ) )
+		s["title"] = k.Name
+		s["required"] = []string{ "ptype", "id" }
+		if props, ok := s["properties"].( map[string]interface{} ); ok {
+			props["ptype"] = map[string]interface{}{ "const": pt }
+			props["id"] = map[string]interface{}{ "type": "string", "minLength": 1 }
+		}
+		one_of = append( one_of, s )
+	}
+
+	schema := map[string]interface{}{
+		"$schema":	"http://json-schema.org/draft-07/schema#",
+		"title":	"tegu pledge checkpoint record",
+		"oneOf":	one_of,
+	}
+
+	jbytes, err := json.Marshal( schema )
+	if err != nil {							// not expected with the types used
+		return "{}"
+	}
+
+	return string( jbytes )
+}
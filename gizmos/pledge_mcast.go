@@ -0,0 +1,483 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	pledge_mcast
+	Abstract:	Multicast bandwidth pledge -- provides pledge interface.
+				Reserves bandwidth for traffic sent by one source to a multicast group
+				address and delivered to a set of receivers. The network finds a path
+				from the source to each receiver (a branch) and the branches together
+				form the tree; obligations are applied per branch with links that are
+				shared by branches obligated only once. Traffic flows only from the
+				source, so there is no inbound direction.
+
+				The group is an IP address and is not a host; Get_hosts() returns the
+				source and the group.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Depends is checkpointed and restored.
+				16 Oct 2026 - Metadata is checkpointed and restored.
+				16 Oct 2026 - Name and description are checkpointed and restored.
+				16 Oct 2026 - Owner group is checkpointed and restored.
+				16 Oct 2026 - Correlation id is checkpointed and restored.
+*/
+
+package gizmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Pledge_mcast struct {
+				Pledge_base	// common fields
+	src			*string		// the sending host
+	group		*string		// multicast group (ip address) the source sends to
+	rcvrs		[]*string	// receiving hosts
+	protocol	*string		// tcp/udp:port
+	bandw		int64		// bandwidth reserved on each branch
+	dscp		int			// dscp value that should be propagated
+	qid			*string		// name that we'll assign to the queue which allows us to look up the pledge's queues
+	match_v6	bool		// true if we should force flow-mods to match on IPv6
+	path_list	[]*Path		// one or more paths from the source to each receiver
+}
+
+/*
+	Work struct used to decode the checkpoint json.
+*/
+type Json_pledge_mcast struct {
+	Src			*string
+	Group		*string
+	Rcvrs		[]*string
+	Protocol	*string
+	Commence	int64
+	Expiry		int64
+	Bandw		int64
+	Dscp		int
+	Id			*string
+	Qid			*string
+	Usrkey		*string
+	Owners		[]string
+	Cid			string
+	Match_v6	bool
+	Awaiting	bool
+	Consent		string
+	Depends		string
+	Meta		map[string]string
+	Name		string
+	Desc		string
+	Ptype		int
+}
+
+// ---- public -------------------------------------------------------------------
+
+/*
+	Constructor; creates a pledge of bandwidth from the source to each of the receivers
+	for traffic sent to the group. If commence is 0, then the current time (now) is used.
+	An error is returned if the window is bad, the group isn't given, or there are no
+	receivers.
+*/
+func Mk_mcast_pledge( src *string, group *string, rcvrs []*string, commence int64, expiry int64, bandw int64, id *string, usrkey *string, dscp int ) ( p *Pledge_mcast, err error ) {
+	p = nil
+
+	window, err := mk_pledge_window( commence, expiry )		// make the window and error if commence after expiry
+	if err != nil {
+		return
+	}
+
+	if src == nil || *src == "" || group == nil || *group == "" {
+		err = fmt.Errorf( "source and group must be supplied" )
+		return
+	}
+
+	if len( rcvrs ) == 0 {
+		err = fmt.Errorf( "no receivers supplied" )
+		return
+	}
+
+	p = &Pledge_mcast {
+		Pledge_base:Pledge_base{
+			id: id,
+			window: window,
+		},
+		src:		src,
+		group:		group,
+		rcvrs:		rcvrs,
+		bandw:		bandw,
+		qid:		&empty_str,
+		dscp:		dscp,
+		protocol:	&empty_str,
+	}
+
+	if usrkey != nil && *usrkey != "" {
+		p.usrkey = usrkey
+	} else {
+		p.usrkey = &empty_str
+	}
+
+	return
+}
+
+/*
+	Return the receivers.
+*/
+func (p *Pledge_mcast) Get_receivers( ) ( []*string ) {
+	if p == nil {
+		return nil
+	}
+
+	return p.rcvrs
+}
+
+/*
+	Return the multicast group.
+*/
+func (p *Pledge_mcast) Get_group( ) ( *string ) {
+	if p == nil {
+		return &empty_str
+	}
+
+	return p.group
+}
+
+/*
+	Returns the source and the group. The group is not a host name.
+*/
+func (p *Pledge_mcast) Get_hosts( ) ( *string, *string ) {
+	if p == nil {
+		return &empty_str, &empty_str
+	}
+
+	return p.src, p.group
+}
+
+/*
+	Returns the bandwidth reserved on each branch.
+*/
+func (p *Pledge_mcast) Get_bandwidth( ) ( int64 ) {
+	if p == nil {
+		return 0
+	}
+
+	return p.bandw
+}
+
+/*
+	Change the amount of bandwidth; only sensible before the pledge is accepted.
+*/
+func (p *Pledge_mcast) Set_bandwidth( bw int64 ) {
+	if p != nil {
+		p.bandw = bw
+	}
+}
+
+func (p *Pledge_mcast) Get_dscp( ) ( int ) {
+	if p == nil {
+		return 0
+	}
+
+	return p.dscp
+}
+
+func (p *Pledge_mcast) Get_qid( ) ( *string ) {
+	if p == nil {
+		return nil
+	}
+
+	return p.qid
+}
+
+func (p *Pledge_mcast) Set_qid( id *string ) {
+	if p != nil {
+		p.qid = id
+	}
+}
+
+func (p *Pledge_mcast) Get_matchv6( ) ( bool ) {
+	return p.match_v6
+}
+
+func (p *Pledge_mcast) Set_matchv6( state bool ) {
+	p.match_v6 = state
+}
+
+/*
+	Add a protocol reference to the pledge (e.g. udp:5000).
+*/
+func (p *Pledge_mcast) Add_proto( proto *string ) {
+	if p != nil {
+		p.protocol = proto
+	}
+}
+
+func (p *Pledge_mcast) Get_proto( ) ( *string ) {
+	if p == nil {
+		return nil
+	}
+
+	return p.protocol
+}
+
+/*
+	Set the paths (the branches of the tree) that were found by the network.
+*/
+func (p *Pledge_mcast) Set_path_list( pl []*Path ) {
+	if p != nil {
+		p.path_list = pl
+	}
+}
+
+func (p *Pledge_mcast) Get_path_list( ) ( []*Path ) {
+	if p == nil {
+		return nil
+	}
+
+	return p.path_list
+}
+
+/*
+	Returns true if the other pledge is a multicast pledge with the same source, group,
+	protocol and set of receivers (in any order) and the windows overlap.
+*/
+func (p *Pledge_mcast) Equals( op *Pledge ) ( state bool ) {
+	if p == nil || op == nil {
+		return false
+	}
+
+	omc, ok := (*op).( *Pledge_mcast )
+	if ! ok {
+		return false
+	}
+
+	if !Strings_equal( p.src, omc.src ) { return false }
+	if !Strings_equal( p.group, omc.group ) { return false }
+	if !Strings_equal( p.protocol, omc.protocol ) { return false }
+	if len( p.rcvrs ) != len( omc.rcvrs ) { return false }
+
+	for _, r := range p.rcvrs {
+		found := false
+		for _, or := range omc.rcvrs {
+			if Strings_equal( r, or ) {
+				found = true
+				break
+			}
+		}
+		if ! found {
+			return false
+		}
+	}
+
+	return p.window.overlaps( omc.window )
+}
+
+/*
+	Accepts a host name and returns true if it is the source or one of the receivers.
+*/
+func (p *Pledge_mcast) Has_host( hname *string ) ( bool ) {
+	if p == nil || hname == nil {
+		return false
+	}
+
+	if *p.src == *hname {
+		return true
+	}
+
+	for _, r := range p.rcvrs {
+		if *r == *hname {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Return true if any branch is anchored by the pair of physical hosts.
+*/
+func (p *Pledge_mcast) Same_anchors( a1 *string, a2 *string ) ( bool ) {
+	if p == nil || a1 == nil {
+		return false
+	}
+
+	for _, pth := range p.path_list {
+		if pth.Has_anchors( a1, a2 ) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Destruction
+*/
+func (p *Pledge_mcast) Nuke( ) {
+	p.src = nil
+	p.group = nil
+	p.rcvrs = nil
+	p.id = nil
+	p.qid = nil
+	p.usrkey = nil
+	p.path_list = nil
+}
+
+/*
+	Given a json string unpack it and put it into a pledge struct.
+*/
+func (p *Pledge_mcast) From_json( jstr *string ) ( err error ){
+	jp := new( Json_pledge_mcast )
+	err = Decode_json( jstr, jp, true )
+	if err != nil {
+		return
+	}
+
+	if jp.Ptype != PT_MULTICAST {
+		err = fmt.Errorf( "json was not a multicast pledge type" )
+		return
+	}
+
+	p.src = jp.Src
+	p.group = jp.Group
+	p.rcvrs = jp.Rcvrs
+	p.window, _ = mk_pledge_window( jp.Commence, jp.Expiry )
+	p.id = jp.Id
+	p.dscp = jp.Dscp
+	p.usrkey = jp.Usrkey
+	p.load_owners( jp.Owners )
+	p.cid = jp.Cid
+	p.qid = jp.Qid
+	p.bandw = jp.Bandw
+	p.match_v6 = jp.Match_v6
+	p.awaiting = jp.Awaiting
+	p.consent = jp.Consent
+	p.depends = jp.Depends
+	p.load_meta( jp.Meta )
+	p.name = jp.Name
+	p.desc = jp.Desc
+
+	p.protocol = jp.Protocol
+	if p.protocol == nil {					// we don't tolerate nil ptrs
+		p.protocol = &empty_str
+	}
+	if p.qid == nil {
+		p.qid = &empty_str
+	}
+	if p.usrkey == nil {
+		p.usrkey = &empty_str
+	}
+
+	return
+}
+
+// --------- humanisation or export functions --------------------------------------------------------
+
+/*
+	Return the receivers as a json array.
+*/
+func (p *Pledge_mcast) rcvrs2json( ) ( string ) {
+	jr, err := json.Marshal( p.rcvrs )
+	if err != nil {
+		return "[ ]"
+	}
+
+	return string( jr )
+}
+
+func (p *Pledge_mcast) To_str( ) ( s string ) {
+	return p.String()
+}
+
+/*
+	Stringer interface so that fmt.Printf( "%s\n", p ) will just work.
+*/
+func (p *Pledge_mcast) String( ) ( s string ) {
+	if p == nil {
+		return ""
+	}
+
+	state, caption, diff := p.window.state_str()
+	commence, expiry := p.window.get_values( )
+	rl := make( []string, len( p.rcvrs ) )
+	for i, r := range p.rcvrs {
+		rl[i] = *r
+	}
+
+	//NEVER put the usrkey into the string!
+	s = fmt.Sprintf( "%s: togo=%ds %s src=%s group=%s rcvrs=%s id=%s qid=%s st=%d ex=%d bw=%d push=%v dscp=%d proto=%s branches=%d ptype=multicast", state, diff, caption,
+		*p.src, *p.group, strings.Join( rl, "," ), *p.id, *p.qid, commence, expiry, p.bandw, p.pushed, p.dscp, *p.protocol, len( p.path_list ) )
+	return
+}
+
+/*
+	Generate a json representation of the pledge which is safe to present to a user (no cookie).
+*/
+func (p *Pledge_mcast) To_json( ) ( json string ) {
+	if p == nil {
+		return "{ }"
+	}
+
+	state, _, diff := p.window.state_str()
+
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "bandw": %d, "src": %q, "group": %q, "rcvrs": %s, "id": %q, "qid": %q, "dscp": %d, "protocol": %q, "awaiting_approval": %v, "consent": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`,
+				state, diff, p.bandw, *p.src, *p.group, p.rcvrs2json(), *p.id, *p.qid, p.dscp, *p.protocol, p.awaiting, p.consent, p.depends, p.meta_json(), p.name, p.desc, PT_MULTICAST )
+
+	return
+}
+
+/*
+	Return a copy of the pledge which can be checkpointed (To_chkpt) by another goroutine
+	while the original continues to be changed.
+	The receiver list is copied; the path list (not checkpointed) is not carried.
+*/
+func (p *Pledge_mcast) Snapshot( ) ( Pledge ) {
+	np := *p
+	np.Pledge_base = p.snapshot_base( )
+	np.path_list = nil
+	np.rcvrs = append( []*string( nil ), p.rcvrs... )
+
+	return &np
+}
+
+/*
+	Build a checkpoint string. As with bandwidth pledges the paths are not saved; they are
+	found again when the checkpoint is loaded.
+*/
+func (p *Pledge_mcast) To_chkpt( ) ( chkpt string ) {
+	if p.Is_expired( ) {			// will show expired if p is nil, so safe without check
+		chkpt = "expired"
+		return
+	}
+
+	commence, expiry := p.window.get_values()
+
+	chkpt = fmt.Sprintf( `{ "src": %q, "group": %q, "rcvrs": %s, "commence": %d, "expiry": %d, "bandw": %d, "id": %q, "qid": %q, "usrkey": %q, "owners": %s, "cid": %q, "dscp": %d, "protocol": %q, "match_v6": %v, "awaiting": %v, "consent": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`,
+			*p.src, *p.group, p.rcvrs2json(), commence, expiry, p.bandw, *p.id, *p.qid, *p.usrkey, p.owners_json(), p.cid, p.dscp, *p.protocol, p.match_v6, p.awaiting, p.consent, p.depends, p.meta_json(), p.name, p.desc, PT_MULTICAST )
+
+	return
+}
+
+func init() {
+	Register_pledge( &Pledge_kind{ Ptype: PT_MULTICAST, Name: "multicast", Restore: true,
+		Decode: func( jstr *string ) ( Pledge, error ) { p := new( Pledge_mcast ); return p, p.From_json( jstr ) }, Json: Json_pledge_mcast{} }, &Pledge_mcast{} )
+}
@@ -0,0 +1,157 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	pledge_meta
+	Abstract:	User metadata on a pledge: free-form key/value pairs (a ticket number, the
+				application, the CI job which made the reservation) which tegu doesn't interpret.
+				The pairs are set when the reservation is made or later, are checkpointed with
+				the pledge, and are indexed so that reservations can be found by them.
+
+				Keys are limited to letters, digits, and _ . - so that they can be used in a
+				search field (tag.key=value). The number of pairs and the length of keys and
+				values are limited to keep checkpoint records reasonable. Bandwidth, oneway and
+				steering pledges include the metadata in their json and checkpoint records.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package gizmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	MAX_META_PAIRS	int = 16				// pairs on one pledge
+	MAX_META_KEY	int = 32				// bytes in a key
+	MAX_META_VALUE	int = 128				// bytes in a value
+)
+
+/*
+	Return a copy of the metadata; nil if there is none.
+*/
+func (p *Pledge_base) Get_meta( ) ( map[string]string ) {
+	if p == nil || len( p.meta ) == 0 {
+		return nil
+	}
+
+	m := make( map[string]string, len( p.meta ) )
+	for k, v := range p.meta {
+		m[k] = v
+	}
+	return m
+}
+
+/*
+	Set a key/value pair; an empty value removes the key. An error is returned, and
+	nothing changed, if the key or value isn't valid or the pledge already has the
+	maximum number of pairs.
+*/
+func (p *Pledge_base) Set_meta( key string, value string ) ( error ) {
+	if p == nil {
+		return fmt.Errorf( "no pledge" )
+	}
+
+	if key == "" || len( key ) > MAX_META_KEY {
+		return fmt.Errorf( "metadata key must be 1 to %d characters: %q", MAX_META_KEY, key )
+	}
+	for _, c := range key {
+		if !( (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '.' || c == '-' ) {
+			return fmt.Errorf( "metadata key may contain only letters, digits, _ . and -: %q", key )
+		}
+	}
+
+	if value == "" {
+		delete( p.meta, key )
+		return nil
+	}
+
+	if len( value ) > MAX_META_VALUE {
+		return fmt.Errorf( "metadata value for %s is longer than %d characters", key, MAX_META_VALUE )
+	}
+	if has_ctl( value ) {
+		return fmt.Errorf( "metadata value for %s contains control characters", key )
+	}
+
+	if p.meta == nil {
+		p.meta = make( map[string]string )
+	}
+	if _, ok := p.meta[key]; ! ok && len( p.meta ) >= MAX_META_PAIRS {
+		return fmt.Errorf( "reservation already has the maximum number of metadata pairs (%d)", MAX_META_PAIRS )
+	}
+
+	p.meta[key] = value
+	return nil
+}
+
+/*
+	Parse a list of key:value pairs (comma separated) and set each. Used for the meta=
+	option on requests.
+*/
+func (p *Pledge_base) Set_meta_list( list string ) ( error ) {
+	for _, kv := range strings.Split( list, "," ) {
+		if kv == "" {
+			continue
+		}
+		toks := strings.SplitN( kv, ":", 2 )
+		if len( toks ) != 2 {
+			return fmt.Errorf( "metadata must be given as key:value: %s", kv )
+		}
+		if err := p.Set_meta( toks[0], toks[1] ); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+	Return the metadata as a json object for To_json() and To_chkpt(). Keys are in
+	sorted order (encoding/json sorts map keys).
+*/
+func (p *Pledge_base) meta_json( ) ( string ) {
+	if p == nil || len( p.meta ) == 0 {
+		return "{}"
+	}
+
+	b, err := json.Marshal( p.meta )
+	if err != nil {
+		return "{}"
+	}
+	return string( b )
+}
+
+/*
+	Replace the metadata with what was read from a checkpoint or json. Pairs which aren't
+	valid are dropped.
+*/
+func (p *Pledge_base) load_meta( m map[string]string ) {
+	p.meta = nil
+	for k, v := range m {
+		p.Set_meta( k, v )
+	}
+}
@@ -34,12 +34,20 @@
 				16 Nov 2015 - Add tenant_id, stdout, stderr to Pledge_mirror
 				24 Nov 2015 - Add options
 				25 Feb 2016 - Correct formatting issue in json output.
+				16 Oct 2026 - Added mirrored bandwidth estimate and port list.
+				16 Oct 2026 - Port and output lists are restored from the checkpoint as saved (they
+							are not host:port); match_v6 is checkpointed.
+				16 Oct 2026 - Strict decode of checkpoint json.
+				16 Oct 2026 - Depends is checkpointed and restored.
+				16 Oct 2026 - Metadata is checkpointed and restored.
+				16 Oct 2026 - Name and description are checkpointed and restored.
+				16 Oct 2026 - Owner group is checkpointed and restored.
+				16 Oct 2026 - Correlation id is checkpointed and restored.
 */
 
 package gizmos
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 )
@@ -64,6 +72,7 @@ type Pledge_mirror struct {
 	match_v6	bool		// true if we should force flow-mods to match on IPv6
 	tenant_id	*string
 	options		*string
+	bandw		int64		// bandwidth that the user expects to be mirrored (0 if not given)
 
 	stdout		[]string	// stdout/err from last remote command -- not saved in checkpoints!
 	stderr		[]string
@@ -72,8 +81,8 @@ type Pledge_mirror struct {
 /*
 	A work struct used to decode a json string using Go's json package which requires things to
 	be exported (boo). We need this to easily parse the json saved in the checkpoint file.
-	We assume that host1/2 are saved _with_ trailing :port and thus we don't explicitly save/restore
-	the tp port fields.  The conversion from checkpoint value to full struct will split them off.
+	Host1 is the list of mirrored ports (macs or uuids) with the vlan list tacked on, and host2 the
+	output; neither has a transport port and they are restored as saved.
 */
 type Json_pledge struct {
 	Host1		*string
@@ -88,11 +97,18 @@ type Json_pledge struct {
 	Id			*string
 	Qid			*string
 	Usrkey		*string
+	Owners		[]string
+	Cid			string
 	Ptype		int
 	//Mbox_list	[]*Mbox
 	Match_v6	bool
 	Tenant_id	*string
 	Options		*string
+	Bandw		int64
+	Depends		string
+	Meta		map[string]string
+	Name		string
+	Desc		string
 }
 
 // ---- private -------------------------------------------------------------------
@@ -163,6 +179,7 @@ func (p *Pledge_mirror) Clone( name string ) ( Pledge ) {
 		//path_list:	p.path_list,
 		tenant_id:	p.tenant_id,
 		options:	p.options,
+		bandw:		p.bandw,
 		stdout:		make([]string, 0),
 		stderr:		make([]string, 0),
 	}
@@ -187,7 +204,7 @@ func (p *Pledge_mirror) Nuke( ) {
 */
 func (p *Pledge_mirror) From_json( jstr *string ) ( err error ){
 	jp := new( Json_pledge )
-	err = json.Unmarshal( []byte( *jstr ), &jp )
+	err = Decode_json( jstr, jp, true )
 	if err != nil {
 		return
 	}
@@ -197,17 +214,31 @@ func (p *Pledge_mirror) From_json( jstr *string ) ( err error ){
 		return
 	}
 
-	p.host1, p.tpport1 = Split_port( jp.Host1 )		// suss apart host and port
-	p.host2, p.tpport2 = Split_port( jp.Host2 )
+	p.host1 = jp.Host1							// port lists contain colons (macs, vlan:), Split_port() would mangle
+	p.host2 = jp.Host2
+	if p.host1 == nil {
+		p.host1 = &empty_str
+	}
+	if p.host2 == nil {
+		p.host2 = &empty_str
+	}
 
 	p.window, _ = mk_pledge_window( jp.Commence, jp.Expiry )
 	//p.protocol = jp.Protocol
 	p.id = jp.Id
 	//p.dscp_koe = jp.Dscp_koe
 	p.usrkey = jp.Usrkey
+	p.load_owners( jp.Owners )
+	p.cid = jp.Cid
 	p.qid = jp.Qid
 	p.tenant_id = jp.Tenant_id
 	p.options = jp.Options
+	p.bandw = jp.Bandw
+	p.match_v6 = jp.Match_v6
+	p.depends = jp.Depends
+	p.load_meta( jp.Meta )
+	p.name = jp.Name
+	p.desc = jp.Desc
 	//p.bandw_out = jp.Bandwout
 	//p.bandw_in = jp.Bandwin
 
@@ -275,6 +306,43 @@ func (p *Pledge_mirror) Get_Output() ( []string, []string ) {
 	return p.stdout, p.stderr
 }
 
+/*
+	Set the amount of bandwidth that the user expects the mirror to carry. This is used
+	only to cap the mirrored traffic on a physical host; nothing is reserved.
+*/
+func (p *Pledge_mirror) Set_bandwidth( bw int64 ) {
+	if p != nil {
+		p.bandw = bw
+	}
+}
+
+func (p *Pledge_mirror) Get_bandwidth( ) ( int64 ) {
+	if p == nil {
+		return 0
+	}
+
+	return p.bandw
+}
+
+/*
+	Return the list of mirrored ports; the vlan list that is tacked onto the end
+	of the ports is not included.
+*/
+func (p *Pledge_mirror) Get_ports( ) ( []string ) {
+	if p == nil || p.host1 == nil {
+		return nil
+	}
+
+	ports := make( []string, 0 )
+	for _, v := range strings.Split( *p.host1, " " ) {
+		if v != "" && ! strings.HasPrefix( v, "vlan:" ) {
+			ports = append( ports, v )
+		}
+	}
+
+	return ports
+}
+
 func (p *Pledge_mirror) Get_Options() ( *string ) {
 	return p.options
 }
@@ -310,12 +378,26 @@ func (p *Pledge_mirror) To_json( ) ( json string ) {
 
 	state, _, diff := p.window.state_str( )
 
-	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host1": "%s", "host2": "%s", "id": %q, "tenant_id": %q, "options": %q, "ptype": %d }`,
-		state, diff, *p.host1, *p.host2, *p.id, *p.tenant_id, *p.options, PT_MIRRORING )
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host1": "%s", "host2": "%s", "id": %q, "tenant_id": %q, "options": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`,
+		state, diff, *p.host1, *p.host2, *p.id, *p.tenant_id, *p.options, p.depends, p.meta_json(), p.name, p.desc, PT_MIRRORING )
 
 	return
 }
 
+/*
+	Return a copy of the pledge which can be checkpointed (To_chkpt) by another goroutine
+	while the original continues to be changed.
+	The command output (not checkpointed) is not carried.
+*/
+func (p *Pledge_mirror) Snapshot( ) ( Pledge ) {
+	np := *p
+	np.Pledge_base = p.snapshot_base( )
+	np.stdout = nil
+	np.stderr = nil
+
+	return &np
+}
+
 /*
 	Build a checkpoint string -- probably json, but it will contain everything including the user key.
 	We still won't use the json package because that means making all of the fields available to outside
@@ -348,8 +430,8 @@ func (p *Pledge_mirror) To_chkpt( ) ( chkpt string ) {
 	} 
 
 	chkpt = fmt.Sprintf(
-		`{ "host1": "%s", "host2": "%s", "commence": %d, "expiry": %d, "id": %q, "qid": %q, "usrkey": %q, "tenant_id": %q, "options": %q, "ptype": %d }`,
-		*p.host1, *p.host2, c, e, *p.id, *p.qid, *p.usrkey, tenant_id, options, PT_MIRRORING )
+		`{ "host1": "%s", "host2": "%s", "commence": %d, "expiry": %d, "id": %q, "qid": %q, "usrkey": %q, "owners": %s, "cid": %q, "tenant_id": %q, "options": %q, "bandw": %d, "match_v6": %v, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`,
+		*p.host1, *p.host2, c, e, *p.id, *p.qid, *p.usrkey, p.owners_json(), p.cid, tenant_id, options, p.bandw, p.match_v6, p.depends, p.meta_json(), p.name, p.desc, PT_MIRRORING )
 
 	return
 }
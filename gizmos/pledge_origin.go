@@ -0,0 +1,121 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+/*
+
+	Mnemonic:	pledge_origin
+	Abstract:	Where the request that created a pledge came from: a fingerprint of the token
+				(or key) that was used, the address of the sender (and any forwarded-for list
+				given by a proxy), and the client's user agent and identifier. The fingerprint
+				is the start of the sha256 of the token; the token itself is never kept, but an
+				admin holding a token can tell whether it was the one used.
+
+				The http side sets the origin as it builds the pledge. It's not part of the
+				pledge's json (the owner sees nothing new); res-mgr adds it to the json given to
+				admins and to the events it publishes. Like the correlation id it is not
+				checkpointed.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package gizmos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+type Origin struct {
+	Key		string	`json:"key"`			// token fingerprint; empty if the request was authorised by address
+	Addr	string	`json:"addr"`			// address of the sender
+	Fwd		string	`json:"fwd"`			// X-Forwarded-For as given; not to be trusted
+	Agent	string	`json:"agent"`			// User-Agent
+	Client	string	`json:"client"`			// client identifier supplied by the caller (X-Tegu-Client)
+}
+
+/*
+	Return the fingerprint of a token, or an empty string if the token is empty.
+*/
+func Key_fingerprint( key string ) ( string ) {
+	if key == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256( []byte( key ) )
+	return "sha256:" + hex.EncodeToString( sum[:] )[0:16]
+}
+
+/*
+	Return the origin as json; null if o is nil.
+*/
+func (o *Origin) To_json( ) ( string ) {
+	if o == nil {
+		return "null"
+	}
+
+	j, err := json.Marshal( o )
+	if err != nil {
+		return "null"
+	}
+	return string( j )
+}
+
+/*
+	Add the origin to the json of a pledge (an object) as the origin field. The json is
+	returned unchanged if it's not an object or there is no origin.
+*/
+func (o *Origin) Add_to_json( pj string ) ( string ) {
+	pj = strings.TrimSpace( pj )
+	if o == nil || ! strings.HasSuffix( pj, "}" ) {
+		return pj
+	}
+
+	return pj[0:len( pj ) - 1] + `, "origin": ` + o.To_json() + " }"
+}
+
+/*
+	Set the origin of the pledge; a copy of the one passed is kept.
+*/
+func (p *Pledge_base) Set_origin( o *Origin ) {
+	if p == nil || o == nil {
+		return
+	}
+
+	oc := *o
+	p.origin = &oc
+}
+
+/*
+	Return the origin of the pledge; nil if it isn't known (created before a restart, or not
+	from an http request).
+*/
+func (p *Pledge_base) Get_origin( ) ( *Origin ) {
+	if p == nil {
+		return nil
+	}
+
+	return p.origin
+}
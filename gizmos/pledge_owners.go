@@ -0,0 +1,146 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+/*
+
+	Mnemonic:	pledge_owners
+	Abstract:	Owner groups. A pledge is owned by the cookie given when it was made; further
+				cookies may be added so that a team can manage a shared reservation without
+				passing one cookie around. Any cookie in the group is as good as the original
+				one (Is_valid_cookie), and any member may add or remove members. The original
+				cookie can't be removed.
+
+				The group is checkpointed with the pledge, for the same kinds that have
+				metadata (bandwidth, oneway and steering), but isn't included in the json given
+				to users; the cookies are secrets in the same way as the original one.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package gizmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	MAX_OWNERS		int = 16				// cookies in an owner group, not counting the original
+	MAX_OWNER_LEN	int = 128				// bytes in one cookie
+)
+
+/*
+	Return a copy of the cookies added to the owner group; nil if there are none.
+*/
+func (p *Pledge_base) Get_owners( ) ( []string ) {
+	if p == nil || len( p.owners ) == 0 {
+		return nil
+	}
+
+	return append( []string{}, p.owners... )
+}
+
+/*
+	Add a cookie to the owner group. Adding a cookie which is already a member is not an
+	error. An error is returned if the cookie isn't valid or the group is full.
+*/
+func (p *Pledge_base) Add_owner( c string ) ( error ) {
+	if p == nil {
+		return fmt.Errorf( "no pledge" )
+	}
+
+	if c == "" || len( c ) > MAX_OWNER_LEN || strings.ContainsAny( c, " \t\r\n\"" ) {
+		return fmt.Errorf( "owner cookie must be 1 to %d characters without spaces or quotes", MAX_OWNER_LEN )
+	}
+	if p.Is_valid_cookie( &c ) {
+		return nil
+	}
+	if len( p.owners ) >= MAX_OWNERS {
+		return fmt.Errorf( "owner group is full; %d cookies may be added", MAX_OWNERS )
+	}
+
+	p.owners = append( p.owners, c )
+	return nil
+}
+
+/*
+	Remove a cookie from the owner group. The original cookie can't be removed; removing
+	a cookie which isn't a member is not an error.
+*/
+func (p *Pledge_base) Del_owner( c string ) ( error ) {
+	if p == nil {
+		return fmt.Errorf( "no pledge" )
+	}
+
+	if p.usrkey != nil && c == *p.usrkey {
+		return fmt.Errorf( "the cookie the reservation was made with can't be removed from its owner group" )
+	}
+
+	for i, o := range p.owners {
+		if o == c {
+			p.owners = append( p.owners[:i], p.owners[i+1:]... )
+			break
+		}
+	}
+	return nil
+}
+
+/*
+	Returns true if the cookie is in the owner group (the original cookie isn't checked).
+*/
+func (p *Pledge_base) is_owner( c string ) ( bool ) {
+	for _, o := range p.owners {
+		if o == c {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Return the owner group as a json array for a checkpoint.
+*/
+func (p *Pledge_base) owners_json( ) ( string ) {
+	if len( p.owners ) == 0 {
+		return "[]"
+	}
+
+	b, err := json.Marshal( p.owners )
+	if err != nil {
+		return "[]"
+	}
+	return string( b )
+}
+
+/*
+	Replace the owner group with what was read from a checkpoint. Cookies which aren't
+	valid are dropped.
+*/
+func (p *Pledge_base) load_owners( list []string ) {
+	p.owners = nil
+	for _, c := range list {
+		p.Add_owner( c )
+	}
+}
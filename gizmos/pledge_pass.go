@@ -28,12 +28,17 @@
 	Author:		E. Scott Daniels
 
 	Mods:		12 Apr 2016 : Changes to support duplicate refresh.
+				16 Oct 2026 : Strict json decoding in From_json.
+				16 Oct 2026 : Depends is checkpointed and restored.
+				16 Oct 2026 : Metadata is checkpointed and restored.
+				16 Oct 2026 : Name and description are checkpointed and restored.
+				16 Oct 2026 : Owner group is checkpointed and restored.
+				16 Oct 2026 : Correlation id is checkpointed and restored.
 */
 
 package gizmos
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/att/gopkgs/clike"
@@ -62,7 +67,13 @@ type Json_pledge_pass struct {
 	Commence	int64
 	Expiry		int64
 	Usrkey		*string
+	Owners		[]string
+	Cid			string
 	Id			*string
+	Depends		string
+	Meta		map[string]string
+	Name		string
+	Desc		string
 	Ptype		int
 }
 
@@ -295,7 +306,7 @@ func (p *Pledge_pass) From_json( jstr *string ) ( err error ){
 	}
 
 	jp := new( Json_pledge_pass )
-	err = json.Unmarshal( []byte( *jstr ), &jp )
+	err = Decode_json( jstr, jp, true )
 	if err != nil {
 		return
 	}
@@ -310,6 +321,12 @@ func (p *Pledge_pass) From_json( jstr *string ) ( err error ){
 	p.window, _ = mk_pledge_window( jp.Commence, jp.Expiry )
 	p.id = jp.Id
 	p.usrkey = jp.Usrkey
+	p.load_owners( jp.Owners )
+	p.cid = jp.Cid
+	p.depends = jp.Depends
+	p.load_meta( jp.Meta )
+	p.name = jp.Name
+	p.desc = jp.Desc
 	p.protocol = jp.Protocol
 	if p.protocol == nil {					// we don't tolerate nil ptrs
 		p.protocol = &empty_str
@@ -427,11 +444,22 @@ func (p *Pledge_pass) To_json( ) ( json string ) {
 	state, _, diff := p.window.state_str()		// get state as a string
 	v := p.vlan2string( )
 
-	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host": "%s:%s%s", "id": %q, "ptype": %d }`, state, diff, *p.host, *p.tpport, v, *p.id,  PT_PASSTHRU )
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host": "%s:%s%s", "id": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`, state, diff, *p.host, *p.tpport, v, *p.id, p.depends, p.meta_json(), p.name, p.desc, PT_PASSTHRU )
 
 	return
 }
 
+/*
+	Return a copy of the pledge which can be checkpointed (To_chkpt) by another goroutine
+	while the original continues to be changed.
+*/
+func (p *Pledge_pass) Snapshot( ) ( Pledge ) {
+	np := *p
+	np.Pledge_base = p.snapshot_base( )
+
+	return &np
+}
+
 /*
 	Build a checkpoint string -- probably json, but it will contain everything including the user key.
 	We still won't use the json package because that means making all of the fields available to outside
@@ -454,7 +482,7 @@ func (p *Pledge_pass) To_chkpt( ) ( chkpt string ) {
 	commence, expiry := p.window.get_values()
 	v := p.vlan2string( )
 
-	chkpt = fmt.Sprintf( `{ "host": "%s:%s%s", "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, "ptype": %d }`, *p.host, *p.tpport, v, commence, expiry, *p.id, *p.usrkey, PT_PASSTHRU )
+	chkpt = fmt.Sprintf( `{ "host": "%s:%s%s", "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, "owners": %s, "cid": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`, *p.host, *p.tpport, v, commence, expiry, *p.id, *p.usrkey, p.owners_json(), p.cid, p.depends, p.meta_json(), p.name, p.desc, PT_PASSTHRU )
 
 	return
 }
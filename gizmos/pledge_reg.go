@@ -0,0 +1,181 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	pledge_reg
+	Abstract:	Registry of pledge types. Each kind of pledge is registered with its ptype
+				value (the json/checkpoint tag), the name used in listings, the decoder
+				which builds a pledge from its checkpoint json, and optionally the functions
+				that the reservation manager invokes to admit (vet) and to push a pledge of
+				the kind. Adding a new kind of reservation is then a matter of writing the
+				pledge type and registering it rather than editing the type switches in the
+				managers.
+
+				The built-in kinds are registered here with their codec; the managers attach
+				their admission and push functions with Set_pledge_ops() because those live
+				with the code that talks to the network and agents. The ctx passed to a push
+				function is whatever the caller of Push_pledge() supplies; the registry
+				does not interpret it.
+
+				Registration is expected to happen during initialisation (init() or before
+				the managers are started) and so the registry is not locked.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Steering pledges are restored from a checkpoint.
+				16 Oct 2026 - Kinds carry their json work struct for the schema (pledge_json.go).
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+	Describes a kind of pledge.
+*/
+type Pledge_kind struct {
+	Ptype	int										// value of ptype in json/checkpoint; must be unique
+	Name	string									// name used in listings (bandwidth, oneway...)
+	Decode	func( jstr *string ) ( Pledge, error )	// build a pledge from checkpoint json
+	Json	interface{}								// work struct the decoder uses (e.g. Json_pledge_bw{}); describes the record in Pledge_schema()
+	Restore	bool									// pledges of this kind are restored from a checkpoint
+	Admit	func( p *Pledge ) ( error )				// vet/reserve network resources; error means not (yet) admitted; may be nil
+	Push	func( p *Pledge, rname *string, ctx interface{} )	// send the flow-mods etc. for the pledge; may be nil
+}
+
+var (
+	kinds_by_ptype	= make( map[int]*Pledge_kind )
+	kinds_by_type	= make( map[reflect.Type]*Pledge_kind )
+)
+
+/*
+	Register a kind of pledge. Sample is a pledge of the kind (it may be empty) which is used
+	to map pledges back to their kind. An error is returned if the ptype or the type of the
+	sample is already registered.
+*/
+func Register_pledge( k *Pledge_kind, sample Pledge ) ( err error ) {
+	if k == nil || sample == nil {
+		return fmt.Errorf( "pledge kind and sample must be supplied" )
+	}
+
+	if kinds_by_ptype[k.Ptype] != nil {
+		return fmt.Errorf( "pledge type %d is already registered as %s", k.Ptype, kinds_by_ptype[k.Ptype].Name )
+	}
+
+	t := reflect.TypeOf( sample )
+	if kinds_by_type[t] != nil {
+		return fmt.Errorf( "%s is already registered as pledge type %d", t, kinds_by_type[t].Ptype )
+	}
+
+	kinds_by_ptype[k.Ptype] = k
+	kinds_by_type[t] = k
+	return nil
+}
+
+/*
+	Attach admission and push functions to a registered kind. Nil leaves the current
+	function unchanged.
+*/
+func Set_pledge_ops( ptype int, admit func( *Pledge ) error, push func( *Pledge, *string, interface{} ) ) ( err error ) {
+	k := kinds_by_ptype[ptype]
+	if k == nil {
+		return fmt.Errorf( "pledge type %d is not registered", ptype )
+	}
+
+	if admit != nil {
+		k.Admit = admit
+	}
+	if push != nil {
+		k.Push = push
+	}
+
+	return nil
+}
+
+/*
+	Return the kind registered for the ptype; nil if there is none.
+*/
+func Pledge_kind_of_ptype( ptype int ) ( *Pledge_kind ) {
+	return kinds_by_ptype[ptype]
+}
+
+/*
+	Return the kind of the pledge; nil if its type isn't registered.
+*/
+func Pledge_kind_of( p Pledge ) ( *Pledge_kind ) {
+	if p == nil {
+		return nil
+	}
+
+	return kinds_by_type[reflect.TypeOf( p )]
+}
+
+/*
+	Return the listing name of the pledge's kind; "unknown" if not registered.
+*/
+func Pledge_kind_name( p Pledge ) ( string ) {
+	if k := Pledge_kind_of( p ); k != nil {
+		return k.Name
+	}
+
+	return "unknown"
+}
+
+/*
+	Invoke the push function registered for the pledge's kind. Returns false if there is none.
+*/
+func Push_pledge( p *Pledge, rname *string, ctx interface{} ) ( bool ) {
+	if p == nil {
+		return false
+	}
+
+	k := Pledge_kind_of( *p )
+	if k == nil || k.Push == nil {
+		return false
+	}
+
+	k.Push( p, rname, ctx )
+	return true
+}
+
+/*
+	Register the built-in kinds.
+*/
+func init() {
+	Register_pledge( &Pledge_kind{ Ptype: PT_BANDWIDTH, Name: "bandwidth", Restore: true,
+		Decode: func( jstr *string ) ( Pledge, error ) { p := new( Pledge_bw ); return p, p.From_json( jstr ) }, Json: Json_pledge_bw{} }, &Pledge_bw{} )
+
+	Register_pledge( &Pledge_kind{ Ptype: PT_OWBANDWIDTH, Name: "oneway", Restore: true,
+		Decode: func( jstr *string ) ( Pledge, error ) { p := new( Pledge_bwow ); return p, p.From_json( jstr ) }, Json: Json_pledge_bwow{} }, &Pledge_bwow{} )
+
+	Register_pledge( &Pledge_kind{ Ptype: PT_MIRRORING, Name: "mirror", Restore: true,
+		Decode: func( jstr *string ) ( Pledge, error ) { p := new( Pledge_mirror ); return p, p.From_json( jstr ) }, Json: Json_pledge{} }, &Pledge_mirror{} )
+
+	Register_pledge( &Pledge_kind{ Ptype: PT_STEERING, Name: "steering", Restore: true,
+		Decode: func( jstr *string ) ( Pledge, error ) { p := new( Pledge_steer ); return p, p.From_json( jstr ) }, Json: Json_stpledge{} }, &Pledge_steer{} )
+
+	Register_pledge( &Pledge_kind{ Ptype: PT_PASSTHRU, Name: "passthru", Restore: true,
+		Decode: func( jstr *string ) ( Pledge, error ) { p := new( Pledge_pass ); return p, p.From_json( jstr ) }, Json: Json_pledge_pass{} }, &Pledge_pass{} )
+}
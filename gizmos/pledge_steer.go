@@ -40,15 +40,26 @@
 				26 May 2015 - Broken out of pledge with conversion to interface
 				01 Jun 2015 - Added equal() support
 				16 Aug 2015 - Move common code into Pledge_base
+				16 Oct 2026 - Middleboxes and match_v6 are restored from the checkpoint.
+				16 Oct 2026 - Depends added to json and checkpoint.
+				16 Oct 2026 - Metadata added to json and checkpoint.
+				16 Oct 2026 - Name and description added to json and checkpoint.
+				16 Oct 2026 - From_json rejects unknown fields and values of the wrong type.
+				16 Oct 2026 - Owner group added to checkpoint.
+				16 Oct 2026 - Chain template and flow-mod priority offset added to json and checkpoint.
+				16 Oct 2026 - Correlation id is checkpointed and restored.
 */
 
 package gizmos
 
 import (
-	"encoding/json"
 	"fmt"
 )
 
+const (
+	MAX_STEER_PRI	int = 80	// largest priority offset; keeps the 300 rules below the bandwidth base (390)
+)
+
 type Pledge_steer struct {
 				Pledge_base	// common fields
 	host1		*string
@@ -60,6 +71,8 @@ type Pledge_steer struct {
 	mbox_list	[]*Mbox		// list of middleboxes if the pledge is a steering pledge
 	mbidx		int			// insertion point into mblist
 	match_v6	bool		// true if we should force flow-mods to match on IPv6
+	template	string		// chain template the middleboxes were bound from; empty if none
+	pri			int			// added to the priority of each flow-mod
 }
 
 /*
@@ -76,9 +89,17 @@ type Json_stpledge struct {
 	Expiry		int64
 	Id			*string
 	Usrkey		*string
+	Owners		[]string
+	Cid			string
 	Ptype		int
-	Mbox_list	[]*Mbox
+	Mbox_list	[]*Json_mbox
 	Match_v6	bool
+	Depends		string
+	Meta		map[string]string
+	Name		string
+	Desc		string
+	Template	string
+	Pri			int
 }
 
 // ---- private -------------------------------------------------------------------
@@ -148,6 +169,8 @@ func (p *Pledge_steer) Clone( name string ) ( *Pledge_steer ) {
 		host2:		p.host2,
 		tpport1: 	p.tpport1,
 		tpport2: 	p.tpport2,
+		template:	p.template,
+		pri:		p.pri,
 	}
 
 	newp.window = p.window.clone()
@@ -171,7 +194,7 @@ func (p *Pledge_steer) Nuke( ) {
 */
 func (p *Pledge_steer) From_json( jstr *string ) ( err error ){
 	jp := new( Json_stpledge )
-	err = json.Unmarshal( []byte( *jstr ), &jp )
+	err = Decode_json( jstr, jp, true )
 	if err != nil {
 		return
 	}
@@ -193,10 +216,47 @@ func (p *Pledge_steer) From_json( jstr *string ) ( err error ){
 	if p.protocol == nil {					// we don't tolerate nil ptrs
 		p.protocol = &empty_str
 	}
+	p.match_v6 = jp.Match_v6
+	p.depends = jp.Depends
+	p.load_meta( jp.Meta )
+	p.load_owners( jp.Owners )
+	p.cid = jp.Cid
+	p.name = jp.Name
+	p.desc = jp.Desc
+	if err == nil {
+		err = p.Set_template( jp.Template, jp.Pri )
+	}
+
+	for _, jm := range jp.Mbox_list {
+		if mb := jm.Mk_mbox( ); mb != nil {
+			p.Add_mbox( mb )
+		}
+	}
 
 	return
 }
 
+/*
+	Record the chain template that the middleboxes were bound from and the offset added to the
+	priority of each flow-mod. An error is returned if the offset is out of range.
+*/
+func (p *Pledge_steer) Set_template( name string, pri int ) ( error ) {
+	if pri < 0 || pri > MAX_STEER_PRI {
+		return fmt.Errorf( "steering priority offset must be between 0 and %d: %d", MAX_STEER_PRI, pri )
+	}
+
+	p.template = name
+	p.pri = pri
+	return nil
+}
+
+/*
+	Return the chain template name (empty if none) and the flow-mod priority offset.
+*/
+func (p *Pledge_steer) Get_template( ) ( string, int ) {
+	return p.template, p.pri
+}
+
 /*
 	Set match v6 flag based on user input.
 */
@@ -273,6 +333,17 @@ func (p *Pledge_steer) Get_mbox( n int ) ( *Mbox ) {
 	return p.mbox_list[n]
 }
 
+/*
+	Replace the nth middlebox (its location was found again after a restart).
+*/
+func (p *Pledge_steer) Set_mbox( n int, mb *Mbox ) {
+	if p == nil || mb == nil || n < 0 || n >= p.mbidx {
+		return
+	}
+
+	p.mbox_list[n] = mb
+}
+
 /*
 	Return mbox count.
 */
@@ -317,8 +388,8 @@ func (p *Pledge_steer) To_json( ) ( json string ) {
 	if p.protocol != nil {
 		proto = *p.protocol
 	}
-	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host1": "%s:%s", "host2": "%s:%s", "protocol": %q, "id": %q, "ptype": %d, "mbox_list": [ `,
-			state, diff, *p.host1, *p.tpport1, *p.host2, *p.tpport2, proto, *p.id, PT_STEERING )
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host1": "%s:%s", "host2": "%s:%s", "protocol": %q, "id": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "template": %q, "pri": %d, "ptype": %d, "mbox_list": [ `,
+			state, diff, *p.host1, *p.tpport1, *p.host2, *p.tpport2, proto, *p.id, p.depends, p.meta_json(), p.name, p.desc, p.template, p.pri, PT_STEERING )
 
 	sep := ""
 	for i := 0; i < p.mbidx; i++ {
@@ -330,6 +401,19 @@ func (p *Pledge_steer) To_json( ) ( json string ) {
 	return
 }
 
+/*
+	Return a copy of the pledge which can be checkpointed (To_chkpt) by another goroutine
+	while the original continues to be changed.
+	The middlebox list is copied; the middleboxes themselves are not changed once made.
+*/
+func (p *Pledge_steer) Snapshot( ) ( Pledge ) {
+	np := *p
+	np.Pledge_base = p.snapshot_base( )
+	np.mbox_list = append( []*Mbox( nil ), p.mbox_list... )
+
+	return &np
+}
+
 /*
 	Build a checkpoint string -- probably json, but it will contain everything including the user key.
 	We still won't use the json package because that means making all of the fields available to outside
@@ -355,8 +439,8 @@ func (p *Pledge_steer) To_chkpt( ) ( chkpt string ) {
 	if p.protocol != nil {
 		proto = *p.protocol
 	}
-	chkpt = fmt.Sprintf( `{ "host1": "%s:%s", "host2": "%s:%s", "protocol": %q, "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, "ptype": %d, "mbox_list": [ `,
-			*p.host1, *p.tpport1, *p.host2, *p.tpport2, proto, c, e, *p.id,  *p.usrkey, PT_STEERING )
+	chkpt = fmt.Sprintf( `{ "host1": "%s:%s", "host2": "%s:%s", "protocol": %q, "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, "owners": %s, "cid": %q, "match_v6": %v, "depends": %q, "meta": %s, "name": %q, "desc": %q, "template": %q, "pri": %d, "ptype": %d, "mbox_list": [ `,
+			*p.host1, *p.tpport1, *p.host2, *p.tpport2, proto, c, e, *p.id,  *p.usrkey, p.owners_json(), p.cid, p.match_v6, p.depends, p.meta_json(), p.name, p.desc, p.template, p.pri, PT_STEERING )
 
 	sep := ""
 	for i := 0; i < p.mbidx; i++ {
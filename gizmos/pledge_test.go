@@ -32,6 +32,7 @@ package gizmos
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -230,3 +231,1422 @@ func Test_bw_equals( t *testing.T ) {
 	}
 	fmt.Fprintf( os.Stderr, "\n" )
 }
+
+func Test_bw_handover( t *testing.T ) {
+	h1 := "host1"
+	h2 := "host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+	id2 := "r2"
+	id3 := "r3"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge handover tests --------------\n" )
+	bp1, err := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if err != nil {
+		t.Fatalf( "unable to make bandwidth pledge: %s", err )
+	}
+	bp2, err := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 20000, 20000, &id2, &key, 42, false )
+	if err != nil {
+		t.Fatalf( "unable to make bandwidth pledge: %s", err )
+	}
+	bp3, err := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 30000, 30000, &id3, &key, 42, false )
+	if err != nil {
+		t.Fatalf( "unable to make bandwidth pledge: %s", err )
+	}
+
+	bp2.Set_handover( bp1.Get_id(), bp1.Get_pbump() )
+	if bp2.Get_handover() == nil || *bp2.Get_handover() != id1 || bp2.Get_pbump() != 1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bp2 handover from bp1 not set correctly: bump=%d\n", bp2.Get_pbump() )
+	}
+
+	bp3.Set_handover( bp2.Get_id(), bp2.Get_pbump() )			// replacing a bumped pledge should drop back to 0
+	if bp3.Get_pbump() != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bp3 bump expected to be 0, was %d\n", bp3.Get_pbump() )
+	}
+
+	cs := bp2.To_chkpt()										// an incomplete handover must survive a checkpoint reload
+	bp5 := new( Pledge_bw )
+	bp5.From_json( &cs )
+	if bp5.Get_handover() == nil || *bp5.Get_handover() != id1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   handover not restored from checkpoint: %s\n", cs )
+	}
+
+	bp2.Clear_handover()
+	if bp2.Get_handover() != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bp2 handover not cleared\n" )
+	}
+
+	cs = bp2.To_chkpt()										// bump must survive a checkpoint reload
+	bp4 := new( Pledge_bw )
+	bp4.From_json( &cs )
+	if bp4.Get_pbump() != 1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bump not restored from checkpoint: %s\n", cs )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all bandwidth pledge handover tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+/*
+	Verify that the awaiting approval state survives a checkpoint and is cleared on approval.
+*/
+func Test_bw_awaiting( t *testing.T ) {
+	h1 := "host1"
+	h2 := "host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge approval tests --------------\n" )
+	bp1, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if bp1.Is_awaiting_approval() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pledge should not be awaiting approval\n" )
+	}
+
+	bp1.Set_awaiting_approval( true )
+	cs := bp1.To_chkpt()
+	bp2 := new( Pledge_bw )
+	bp2.From_json( &cs )
+	if ! bp2.Is_awaiting_approval() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   awaiting state not restored from checkpoint: %s\n", cs )
+	}
+
+	bp2.Set_awaiting_approval( false )
+	if bp2.Is_awaiting_approval() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   awaiting state not cleared\n" )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge approval tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+/*
+	Verify that the consent project survives a checkpoint for both bandwidth pledge types.
+*/
+func Test_consent( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj2/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+	id2 := "r2"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge consent tests --------------\n" )
+	bp1, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if bp1.Get_consent() != "" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pledge should not be waiting for consent\n" )
+	}
+
+	bp1.Set_consent( "proj2" )
+	cs := bp1.To_chkpt()
+	bp2 := new( Pledge_bw )
+	bp2.From_json( &cs )
+	if bp2.Get_consent() != "proj2" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bw consent not restored from checkpoint: %s\n", cs )
+	}
+
+	op1, _ := Mk_bwow_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, &id2, &key, 42 )
+	op1.Set_consent( "proj2" )
+	cs = op1.To_chkpt()
+	op2 := new( Pledge_bwow )
+	op2.From_json( &cs )
+	if op2.Get_consent() != "proj2" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bwow consent not restored from checkpoint: %s\n", cs )
+	}
+
+	op2.Set_consent( "" )
+	if op2.Get_consent() != "" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   consent not cleared\n" )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge consent tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_registry( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj2/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge registry tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if n := Pledge_kind_name( bp ); n != "bandwidth" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected bandwidth kind, got %s\n", n )
+	}
+
+	cs := bp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   checkpoint did not decode: %s\n", err )
+	} else {
+		if _, ok := (*gp).( *Pledge_bw ); !ok {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   checkpoint did not decode to a bandwidth pledge\n" )
+		}
+	}
+
+	if err := Register_pledge( &Pledge_kind{ Ptype: PT_BANDWIDTH, Name: "dup" }, &Pledge_mirror{} ); err == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   duplicate ptype was registered\n" )
+	}
+
+	pushed := false
+	Set_pledge_ops( PT_BANDWIDTH, nil, func( p *Pledge, rname *string, ctx interface{} ) { pushed = true } )
+	var ip Pledge = bp
+	if ! Push_pledge( &ip, &id1, nil ) || ! pushed {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   registered push function was not invoked\n" )
+	}
+	Pledge_kind_of_ptype( PT_BANDWIDTH ).Push = nil
+
+	bad := `{ "ptype": 999 }`
+	if _, err := Json2pledge( &bad ); err == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unregistered ptype was decoded\n" )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge registry tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_mcast( t *testing.T ) {
+	src := "proj1/sender"
+	group := "239.1.1.1"
+	r1 := "proj1/rcvr1"
+	r2 := "proj1/rcvr2"
+	key := "cookie"
+	id1 := "m1"
+	id2 := "m2"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- multicast pledge tests --------------\n" )
+	if _, err := Mk_mcast_pledge( &src, &group, nil, now+300, now+600, 10000, &id1, &key, 42 ); err == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge without receivers was created\n" )
+	}
+
+	mp, err := Mk_mcast_pledge( &src, &group, []*string{ &r1, &r2 }, now+300, now+600, 10000, &id1, &key, 42 )
+	if err != nil {
+		t.Fatalf( "unable to make multicast pledge: %s", err )
+	}
+
+	if ! mp.Has_host( &r2 ) || ! mp.Has_host( &src ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   source or receiver not reported as a host of the pledge\n" )
+	}
+
+	op, _ := Mk_mcast_pledge( &src, &group, []*string{ &r2, &r1 }, now+500, now+900, 10000, &id2, &key, 42 )
+	var gop Pledge = op
+	if ! mp.Equals( &gop ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledges with receivers in a different order were not equal\n" )
+	}
+
+	cs := mp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   checkpoint did not decode: %s\n", err )
+	} else {
+		if rp, ok := (*gp).( *Pledge_mcast ); !ok || len( rp.Get_receivers() ) != 2 || *rp.Get_group() != group {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   checkpoint did not decode to the same multicast pledge: %s\n", cs )
+		}
+	}
+
+	if n := Pledge_kind_name( mp ); n != "multicast" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected multicast kind, got %s\n", n )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all multicast pledge tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_mirror_bw( t *testing.T ) {
+	out := "fa:16:3e:00:00:03"
+	id := "mir-1"
+	key := "cookie"
+	phost := "host1"
+	vlan := "10,20"
+	tenant := "proj1"
+	opts := ""
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- mirror pledge tests --------------\n" )
+	gp, err := Mk_mirror_pledge( []string{ "fa:16:3e:00:00:01", "fa:16:3e:00:00:02" }, &out, now+300, now+600, &id, &key, &phost, &vlan, &tenant, &opts )
+	if err != nil {
+		t.Fatalf( "unable to make mirror pledge: %s", err )
+	}
+	mp := gp.( *Pledge_mirror )
+	mp.Set_bandwidth( 5000000 )
+
+	if ports := mp.Get_ports(); len( ports ) != 2 || ports[1] != "fa:16:3e:00:00:02" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected two ports without the vlan list, got %v\n", ports )
+	}
+
+	cs := mp.To_chkpt()
+	rp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   checkpoint did not decode: %s\n", err )
+	} else {
+		if rm, ok := (*rp).( *Pledge_mirror ); !ok || rm.Get_bandwidth() != 5000000 {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   bandwidth not restored from checkpoint: %s\n", cs )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all mirror pledge tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_expiring( t *testing.T ) {
+	h1 := "proj1/vm1"
+	h2 := "proj1/vm2"
+	p1 := "0"
+	p2 := "0"
+	id := "res-exp"
+	key := "cookie"
+
+	fmt.Fprintf( os.Stderr, "\n----------- expiring soon tests --------------\n" )
+	now := time.Now().Unix()
+	p, err := Mk_bw_pledge( &h1, &h2, &p1, &p2, now, now + 60, 1000, 1000, &id, &key, 0, false )
+	if err != nil {
+		t.Fatalf( "unable to make pledge: %s", err )
+	}
+
+	defer Set_expiry_warn( 0 )
+	failures := 0
+	for _, tc := range []struct {
+		warn	int64
+		state	string
+	} {
+		{ 0, "ACTIVE" },
+		{ 30, "ACTIVE" },
+		{ 120, "EXPIRING_SOON" },
+	} {
+		Set_expiry_warn( tc.warn )
+		if state := p.Get_state(); state != tc.state {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   warn=%d expected state %s, got %s\n", tc.warn, tc.state, state )
+		}
+	}
+
+	c, e := p.Get_window()
+	for _, tc := range []struct {
+		warn	int64
+		n		int
+	} {
+		{ 0, 2 },
+		{ 30, 3 },
+		{ 120, 2 },									// warning longer than the window; no separate transition
+	} {
+		Set_expiry_warn( tc.warn )
+		tl := p.Get_transitions()
+		if len( tl ) != tc.n || tl[0].Ts != c || tl[0].State != "ACTIVE" || tl[len( tl )-1].Ts != e || tl[len( tl )-1].State != "EXPIRED" {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   warn=%d unexpected transitions: %v\n", tc.warn, tl )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all expiring soon tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_trust( t *testing.T ) {
+	proj := "proj1/*"
+	vm := "proj1/vm1"
+	other := "proj2/vm1"
+	noproj := "vm1"
+	key := "cookie"
+	id1 := "t1"
+	id2 := "t2"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- trust pledge tests --------------\n" )
+	if _, err := Mk_trust_pledge( &noproj, now+300, now+600, &id1, &key ); err == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge without a project was created\n" )
+	}
+
+	tp, err := Mk_trust_pledge( &proj, now+300, now+600, &id1, &key )
+	if err != nil {
+		t.Fatalf( "unable to make trust pledge: %s", err )
+	}
+
+	if ! tp.Is_project() || ! tp.Has_host( &vm ) || tp.Has_host( &other ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   project scope did not cover just the project's vms\n" )
+	}
+
+	vp, _ := Mk_trust_pledge( &vm, now+500, now+900, &id2, &key )
+	var gvp Pledge = vp
+	if vp.Is_project() || tp.Equals( &gvp ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   vm and project scoped pledges were not distinct\n" )
+	}
+
+	proto := "udp::5060"
+	tp.Set_proto( &proto )
+	cs := tp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   checkpoint did not decode: %s\n", err )
+	} else {
+		if rp, ok := (*gp).( *Pledge_trust ); !ok || ! rp.Is_project() || *rp.Get_proto() != proto || ! tp.Equals( gp ) {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   checkpoint did not decode to the same trust pledge: %s\n", cs )
+		}
+	}
+
+	ph := "compute1"
+	tp.Set_members( map[string]*string{ "proj1/10.0.0.5": &ph } )
+	if ! tp.Same_anchors( &ph, nil ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   member physical host not recognised as an anchor\n" )
+	}
+
+	if n := Pledge_kind_name( tp ); n != "trust" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected trust kind, got %s\n", n )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all trust pledge tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+/*
+	Mirror, steering and oneway pledges must come back from a checkpoint with everything needed
+	to push them again.
+*/
+func Test_pledge_chkpt_kinds( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id := "r1"
+	out := "fa:16:3e:00:00:03"
+	phost := "host1"
+	vlan := "10,20"
+	tenant := "proj1"
+	opts := ""
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- checkpoint round trip tests --------------\n" )
+	gp, _ := Mk_mirror_pledge( []string{ "fa:16:3e:00:00:01", "fa:16:3e:00:00:02" }, &out, now+300, now+600, &id, &key, &phost, &vlan, &tenant, &opts )
+	mp := gp.( *Pledge_mirror )
+	mp.Set_matchv6( true )
+	cs := mp.To_chkpt()
+	rm := new( Pledge_mirror )
+	if err := rm.From_json( &cs ); err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror checkpoint did not decode: %s\n", err )
+	} else {
+		ports, rout := rm.Get_hosts()
+		oports, _ := mp.Get_hosts()
+		if *ports != *oports || *rout != out || ! rm.Get_matchv6() {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   mirror ports/output/v6 not restored: %s %s %v\n", *ports, *rout, rm.Get_matchv6() )
+		}
+	}
+
+	sp, _ := Mk_steer_pledge( &h1, &h2, &p1, &p1, now+300, now+600, &id, &key, nil )
+	mbid := "mb1"
+	mbmac := "fa:16:3e:00:00:09"
+	mbsw := "host3"
+	sp.Add_mbox( Mk_mbox( &mbid, &mbmac, &mbsw, 7 ) )
+	sp.Set_matchv6( true )
+	cs = sp.To_chkpt()
+	rgp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   steering checkpoint did not decode: %s\n", err )
+	} else {
+		rs := (*rgp).( *Pledge_steer )
+		if rs.Get_mbox_count() != 1 || ! rs.Get_matchv6() {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   steering middleboxes/v6 not restored: %s\n", cs )
+		} else {
+			rid, rmac, rsw, rport := rs.Get_mbox( 0 ).Get_values()
+			if *rid != mbid || *rmac != mbmac || *rsw != mbsw || rport != 7 {
+				failures++
+				fmt.Fprintf( os.Stderr, "FAIL:   steering middlebox restored wrong: %s %s %s %d\n", *rid, *rmac, *rsw, rport )
+			}
+		}
+	}
+	if k := Pledge_kind_of_ptype( PT_STEERING ); k == nil || ! k.Restore {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   steering pledges are not restored from a checkpoint\n" )
+	}
+
+	op, _ := Mk_bwow_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, &id, &key, 42 )
+	op.Set_matchv6( true )
+	cs = op.To_chkpt()
+	rop := new( Pledge_bwow )
+	if err := rop.From_json( &cs ); err != nil || ! rop.Get_matchv6() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   oneway match_v6 not restored: %s\n", cs )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all checkpoint round trip tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_depends( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+	id2 := "r2"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge dependency tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if bp.Get_depends() != "" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pledge should not have a dependency\n" )
+	}
+
+	bp.Set_depends( id2 )
+	cs := bp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil || (*gp).Get_depends() != id2 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bw dependency not restored from checkpoint: %s\n", cs )
+	}
+
+	sp, _ := Mk_steer_pledge( &h1, &h2, &p1, &p1, now+300, now+600, &id2, &key, nil )
+	sp.Set_depends( id1 )
+	cs = sp.To_chkpt()
+	gp, err = Json2pledge( &cs )
+	if err != nil || (*gp).Get_depends() != id1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   steering dependency not restored from checkpoint: %s\n", cs )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge dependency tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_steer_template( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- steering template tests --------------\n" )
+	sp, _ := Mk_steer_pledge( &h1, &h2, &p1, &p1, now+300, now+600, &id, &key, nil )
+	if name, pri := sp.Get_template(); name != "" || pri != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new steering pledge should have no template: %s %d\n", name, pri )
+	}
+
+	if sp.Set_template( "web", MAX_STEER_PRI + 1 ) == nil || sp.Set_template( "web", -1 ) == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   out of range priority offset was accepted\n" )
+	}
+
+	if err := sp.Set_template( "web", 20 ); err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   valid template not set: %s\n", err )
+	}
+	cs := sp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   steering checkpoint with template did not decode: %s\n", err )
+	} else {
+		if name, pri := (*gp).( *Pledge_steer ).Get_template(); name != "web" || pri != 20 {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   template not restored from checkpoint: %s %d\n", name, pri )
+		}
+	}
+	if js := sp.To_json(); ! strings.Contains( js, `"template": "web", "pri": 20` ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   template missing from json: %s\n", js )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all steering template tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_meta( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge metadata tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if bp.Get_meta() != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pledge should not have metadata\n" )
+	}
+
+	if err := bp.Set_meta_list( "ticket:INC1234,app:billing" ); err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   valid metadata list rejected: %s\n", err )
+	}
+
+	for _, kv := range [][]string{ { "bad key", "v" }, { "", "v" }, { "k", strings.Repeat( "x", MAX_META_VALUE + 1 ) }, { "k", "a\nb" } } {
+		if bp.Set_meta( kv[0], kv[1] ) == nil {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   invalid metadata accepted: %q=%q\n", kv[0], kv[1] )
+		}
+	}
+
+	for i := 0; i < MAX_META_PAIRS; i++ {
+		bp.Set_meta( fmt.Sprintf( "k%d", i ), "v" )
+	}
+	if m := bp.Get_meta(); len( m ) != MAX_META_PAIRS {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected metadata to be capped at %d pairs, have %d\n", MAX_META_PAIRS, len( m ) )
+	}
+
+	bp.Set_meta( "k0", "" )
+	cs := bp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unable to restore pledge with metadata: %s\n", err )
+	} else {
+		m := (*gp).Get_meta()
+		if m["ticket"] != "INC1234" || m["app"] != "billing" || m["k0"] != "" || len( m ) != MAX_META_PAIRS - 1 {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   metadata not restored from checkpoint: %v\n", m )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge metadata tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_name( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge name tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if n, d := bp.Get_name(); n != "" || d != "" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pledge should not have a name or description\n" )
+	}
+
+	for _, nd := range [][]string{ { strings.Repeat( "x", MAX_NAME_LEN + 1 ), "" }, { "n", strings.Repeat( "x", MAX_DESC_LEN + 1 ) }, { "a\tb", "" }, { "n", "two\nlines" } } {
+		if bp.Set_name( nd[0], nd[1] ) == nil {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   invalid name/description accepted: %q %q\n", nd[0], nd[1] )
+		}
+	}
+
+	if err := bp.Set_name( "billing db sync", `nightly "replica" copy` ); err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   valid name rejected: %s\n", err )
+	}
+
+	cs := bp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unable to restore pledge with a name: %s\n", err )
+	} else {
+		if n, d := (*gp).Get_name(); n != "billing db sync" || d != `nightly "replica" copy` {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   name not restored from checkpoint: %q %q\n", n, d )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge name tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_bulk( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge bulk tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if nb, moved := bp.Get_bulk(); nb != 0 || moved != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pledge should not be a bulk pledge: %d %d\n", nb, moved )
+	}
+
+	bp.Set_bulk( 5000000 )
+	bp.Add_bulk_moved( 1000 )
+	bp.Add_bulk_moved( -10 )								// negative counts are ignored
+	if moved := bp.Add_bulk_moved( 500 ); moved != 1500 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bytes moved expected 1500, got %d\n", moved )
+	}
+
+	cs := bp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unable to restore bulk pledge: %s\n", err )
+	} else {
+		if nb, moved := (*gp).( *Pledge_bw ).Get_bulk(); nb != 5000000 || moved != 1500 {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   bulk counts not restored from checkpoint: %d %d\n", nb, moved )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge bulk tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_reopt( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge reopt tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if bp.Is_reopt() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pledge should not be marked for re-optimisation\n" )
+	}
+
+	bp.Set_reopt( true )
+	cs := bp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unable to restore reopt pledge: %s\n", err )
+	} else {
+		if ! (*gp).( *Pledge_bw ).Is_reopt() {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   reopt not restored from checkpoint\n" )
+		}
+	}
+
+	if ! strings.Contains( bp.To_json(), `"reopt": true` ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   reopt missing from json: %s\n", bp.To_json() )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge reopt tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_owners( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+	team := "teamcookie"
+	other := "other"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge owner group tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if bp.Is_valid_cookie( &team ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   cookie accepted before it was added to the group\n" )
+	}
+
+	if err := bp.Add_owner( team ); err != nil || ! bp.Is_valid_cookie( &team ) || ! bp.Is_valid_cookie( &key ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   group member, or original cookie, not accepted: %v\n", err )
+	}
+	bp.Add_owner( team )												// duplicate is ignored
+	if n := len( bp.Get_owners() ); n != 1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected 1 owner, got %d\n", n )
+	}
+	if bp.Add_owner( "has space" ) == nil || bp.Add_owner( "" ) == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   invalid owner cookie accepted\n" )
+	}
+	if bp.Del_owner( key ) == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   original cookie was removed from the group\n" )
+	}
+
+	cs := bp.To_chkpt()
+	if strings.Contains( bp.To_json(), team ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   owner cookie exposed in json\n" )
+	}
+	gp, err := Json2pledge( &cs )
+	if err != nil || ! (*gp).Is_valid_cookie( &team ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   owner group not restored from checkpoint: %v\n", err )
+	}
+
+	bp.Del_owner( team )
+	if bp.Is_valid_cookie( &team ) || bp.Is_valid_cookie( &other ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   removed, or unknown, cookie accepted\n" )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge owner group tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_late_start( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge late start tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	if ls := bp.Get_late_start(); ls != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge in the future reports a late start: %d\n", ls )
+	}
+
+	lp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now-900, now+600, 10000, 10000, &id1, &key, 42, false )
+	if c, _ := lp.Get_window(); c < now {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   commence wasn't moved forward: %d < %d\n", c, now )
+	}
+	if ls := lp.Get_late_start(); ls != now-900 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   late start expected %d, got %d\n", now-900, ls )
+	}
+	if ls := lp.Clone( "r2" ).Get_late_start(); ls != now-900 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   late start wasn't cloned: %d\n", ls )
+	}
+
+	lp.Clear_late_start()
+	if ls := lp.Get_late_start(); ls != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   late start not cleared: %d\n", ls )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge late start tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_strict( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p1 := "0"
+	key := "cookie"
+	id1 := "r1"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge strict json tests --------------\n" )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p1, &p1, now+300, now+600, 10000, 10000, &id1, &key, 42, false )
+	cs := bp.To_chkpt()
+	if _, err := Json2pledge( &cs ); err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   good checkpoint record rejected: %s\n", err )
+	}
+
+	bad := strings.Replace( cs, `"bandwin":`, `"bandwidth_in":`, 1 )
+	jp := new( Json_pledge_bw )
+	err := Decode_json( &bad, jp, true )
+	if je, ok := err.( *Json_err ); !ok || je.Field != "bandwidth_in" || je.Offset != int64( strings.Index( bad, `"bandwidth_in"` ) ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unknown field not reported with its position: %v\n", err )
+	}
+	if gp, err := Json2pledge( &bad ); err == nil || gp != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   record with unknown field was decoded\n" )
+	}
+
+	bad = strings.Replace( cs, `"dscp": 42`, `"dscp": "af41"`, 1 )
+	err = Decode_json( &bad, jp, true )
+	if je, ok := err.( *Json_err ); !ok || je.Field != "dscp" || je.Line != 1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   wrong type not reported for the field: %v\n", err )
+	}
+
+	bad = "{ \"ptype\": 1,\n  \"id\": \"r1\",\n  \"expiry\": 12x }"
+	err = Decode_json( &bad, jp, false )
+	if je, ok := err.( *Json_err ); !ok || je.Line != 3 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   syntax error not reported on line 3: %v\n", err )
+	}
+
+	bad = cs[:len( cs ) / 2]
+	if _, err := Json2pledge( &bad ); err == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   truncated record was decoded\n" )
+	}
+
+	bad = cs + " {}"
+	if _, err := Json2pledge( &bad ); err == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   record with trailing data was decoded\n" )
+	}
+
+	bad = strings.Replace( cs, `"id": "r1"`, `"id": ""`, 1 )
+	if _, err := Json2pledge( &bad ); err == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   record without an id was decoded\n" )
+	}
+
+	schema := Pledge_schema()
+	for _, want := range []string{ `"title":"bandwidth"`, `"title":"trust"`, `"bulk_moved"`, `"mbox_list"`, `"additionalProperties":false` } {
+		if ! strings.Contains( schema, want ) {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   schema does not contain %s\n", want )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge strict json tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_cap_sched( t *testing.T ) {
+	failures := 0
+
+	fmt.Fprintf( os.Stderr, "\n----------- capacity schedule tests --------------\n" )
+	for _, bad := range []string{ "08:00-18:00", "08:00-18:00=101", "xyz/08:00-18:00=60", "08:00-08:00=60", "25:00-02:00=60" } {
+		if Set_cap_schedule( bad, "UTC" ) == nil {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   bad schedule accepted: %s\n", bad )
+		}
+	}
+
+	if err := Set_cap_schedule( "mon-fri/08:00-18:00=60 22:00-06:00=90", "UTC" ); err != nil {
+		t.Fatalf( "unable to set schedule: %s", err )
+	}
+	defer Set_cap_schedule( "", "" )
+
+	at := func( day int, h int, m int ) ( int64 ) {			// october 2025 (obligations end with 2025); the 13th is a monday
+		return time.Date( 2025, time.October, day, h, m, 0, 0, time.UTC ).Unix()
+	}
+	for _, tc := range []struct {
+		c, e	int64
+		pct		int64
+	} {
+		{ at( 15, 9, 0 ), at( 15, 10, 0 ), 60 },			// wednesday business hours
+		{ at( 15, 18, 0 ), at( 15, 22, 0 ), 100 },			// between the periods
+		{ at( 15, 23, 0 ), at( 16, 1, 0 ), 90 },			// over midnight
+		{ at( 16, 5, 0 ), at( 16, 7, 0 ), 90 },				// tail of the night period started the day before
+		{ at( 15, 23, 0 ), at( 16, 9, 0 ), 60 },			// runs into business hours
+		{ at( 18, 9, 0 ), at( 18, 17, 0 ), 100 },			// saturday
+		{ at( 18, 9, 0 ), at( 29, 9, 0 ), 60 },				// more than a week
+	} {
+		if pct := Cap_sched_pct( tc.c, tc.e ); pct != tc.pct {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   window %d-%d expected %d%%, got %d%%\n", tc.c, tc.e, tc.pct, pct )
+		}
+	}
+
+	ob := Mk_obligation( 1000, 0 )
+	if ok, _ := ob.Fits_schedule( at( 15, 9, 0 ), at( 15, 10, 0 ), 600 ); ! ok {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   600 of 1000 didn't fit under the 60%% ceiling\n" )
+	}
+	if ok, _ := ob.Fits_schedule( at( 15, 9, 0 ), at( 15, 10, 0 ), 601 ); ok {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   601 of 1000 fit under the 60%% ceiling\n" )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all capacity schedule tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+/*
+	Slices split by reservations which are later removed are merged again.
+*/
+func Test_ob_compact( t *testing.T ) {
+	failures := 0
+	fmt.Fprintf( os.Stderr, "\n------- obligation compaction tests ---------\n" )
+
+	ob := Mk_obligation( 1000, 0 )
+	ob.Inc_utilisation( 1000, 2000, 100, nil )
+	ob.Inc_utilisation( 1500, 3000, 200, nil )
+	if n := ob.Get_nslices(); n != 5 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected 5 slices after two increases, found %d\n", n )
+	}
+
+	if n := ob.merge_slices(); n != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   %d slices merged when none were the same\n", n )
+	}
+
+	ob.Dec_utilisation( 1500, 3000, 200, nil )
+	if n := ob.merge_slices(); n != 2 || ob.Get_nslices() != 3 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected 2 merges leaving 3 slices, got %d leaving %d\n", n, ob.Get_nslices() )
+	}
+	if a := ob.Get_allocation( 1800 ); a != 100 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   allocation at 1800 expected to be 100, was %d\n", a )
+	}
+
+	ob.Dec_utilisation( 1000, 2000, 100, nil )
+	if n := ob.merge_slices(); n != 2 || ob.Get_nslices() != 1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected 2 merges leaving 1 slice, got %d leaving %d\n", n, ob.Get_nslices() )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all obligation compaction tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_touch( t *testing.T ) {
+	failures := 0
+	fmt.Fprintf( os.Stderr, "\n------- pledge touched switch tests ---------\n" )
+
+	h1 := "proj/vm1"
+	h2 := "proj/vm2"
+	port := "0"
+	id := "touch"
+	ukey := ""
+	ip1 := "10.0.0.1"
+	ip2 := "10.0.0.2"
+	p, err := Mk_bw_pledge( &h1, &h2, &port, &port, 0, time.Now().Unix() + 86400, 1000, 1000, &id, &ukey, 0, false )
+	if err != nil {
+		t.Fatalf( "unable to make pledge: %s", err )
+	}
+
+	if list, n := p.Get_touched(); list != nil || n != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unpushed pledge has %d touched entries and %d fmods\n", len( list ), n )
+	}
+
+	p.Reset_touched()
+	p.Add_touched( Mk_spq( "s1", 3, 2 ), TOUCH_ENDPOINT, &ip1, &ip2, 2 )
+	p.Add_touched( Mk_spq( "s1", 3, 2 ), TOUCH_ENDPOINT, &ip1, &ip2, 1 )		// same tuple; count added
+	p.Add_touched( Mk_spq( "s2", 4, 5 ), TOUCH_ENDPOINT, &ip2, &ip1, 2 )		// other direction
+	p.Add_touched( nil, TOUCH_LEG, &ip1, &ip2, 0 )
+	list, n := p.Get_touched()
+	if len( list ) != 2 || n != 5 || list[0].Fmods != 3 || list[1].Src != ip2 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   expected 2 entries and 5 fmods, got %d and %d: %v\n", len( list ), n, list )
+	}
+
+	if !strings.Contains( p.To_json(), `"touched": {"pushed":` ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   touched list not in json: %s\n", p.To_json() )
+	}
+
+	p.Reset_touched()
+	if list, n = p.Get_touched(); len( list ) != 0 || n != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   reset left %d entries and %d fmods\n", len( list ), n )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all touched switch tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+func Test_pledge_origin( t *testing.T ) {
+	failures := 0
+	fmt.Fprintf( os.Stderr, "\n------- pledge origin tests ---------\n" )
+
+	h1 := "proj/vm1"
+	h2 := "proj/vm2"
+	port := "0"
+	id := "orig-test"
+	ukey := ""
+	p, err := Mk_bw_pledge( &h1, &h2, &port, &port, 0, time.Now().Unix() + 86400, 1000, 1000, &id, &ukey, 0, false )
+	if err != nil {
+		t.Fatalf( "unable to make pledge: %s", err )
+	}
+
+	if p.Get_origin() != nil || p.Get_origin().To_json() != "null" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pledge has an origin: %s\n", p.Get_origin().To_json() )
+	}
+
+	fp := Key_fingerprint( "secret-token" )
+	if len( fp ) != 23 || fp != Key_fingerprint( "secret-token" ) || fp == Key_fingerprint( "other-token" ) || Key_fingerprint( "" ) != "" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bad fingerprint: %q\n", fp )
+	}
+
+	o := &Origin{ Key: fp, Addr: "10.1.1.1:4321", Agent: "curl/7.0", Client: "nightly-job" }
+	p.Set_origin( o )
+	o.Client = "changed"									// pledge must have its own copy
+	if po := p.Get_origin(); po == nil || po.Client != "nightly-job" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   origin not copied: %v\n", po )
+	}
+
+	if strings.Contains( p.To_json(), `"origin"` ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   origin is in the owner's json: %s\n", p.To_json() )
+	}
+
+	j := p.Get_origin().Add_to_json( p.To_json() )
+	if !strings.HasSuffix( j, `"client":"nightly-job"} }` ) || strings.Contains( j, "secret-token" ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   origin not added to json: %s\n", j )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all origin tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+/*
+	Window arithmetic and blackout split/check.
+*/
+func Test_blackout( t *testing.T ) {
+	failures := 0
+	fmt.Fprintf( os.Stderr, "\n------- blackout tests ---------\n" );
+
+	w := &pledge_window{ commence: 1000, expiry: 2000 }
+	if left := w.subtract( &pledge_window{ commence: 1200, expiry: 1300 } ); len( left ) != 2 || left[0].expiry != 1200 || left[1].commence != 1300 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   subtract of inner window did not give two pieces\n" )
+	}
+	if left := w.subtract( &pledge_window{ commence: 500, expiry: 2500 } ); len( left ) != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   subtract of covering window left %d pieces\n", len( left ) )
+	}
+	if ip := w.intersect( &pledge_window{ commence: 1800, expiry: 2500 } ); ip == nil || ip.duration() != 200 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   intersect gave wrong window: %v\n", ip )
+	}
+
+	if _, err := Mk_blackout( "bad", "weekly@xyz@02:00+1h" ); err == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   bad blackout day accepted\n" )
+	}
+
+	day := time.Now().Unix() / 86400 * 86400 + 86400				// midnight tomorrow (UTC)
+	b1, err := Mk_blackout( "nightly", "daily@02:00+1h" )
+	if err != nil {
+		t.Fatalf( "unable to make daily blackout: %s", err )
+	}
+	b2, _ := Mk_blackout( "freeze", fmt.Sprintf( "%d-%d", day + 86400 * 10, day + 86400 * 11 ) )
+	Set_blackouts( []*Blackout{ b1, b2 } )
+	defer Set_blackouts( nil )
+
+	if name, bs, _ := Blackout_check( day + 3600, day + 4 * 3600 ); name != "nightly" || bs != day + 7200 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   overlap with daily blackout not found: %q %d\n", name, bs )
+	}
+	if name, _, _ := Blackout_check( day + 4 * 3600, day + 20 * 3600 ); name != "" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   blackout %q reported for a window clear of it\n", name )
+	}
+
+	wins := Blackout_split( day, day + 2 * 86400 )					// two nights; three pieces
+	if len( wins ) != 3 || wins[0][1] != day + 7200 || wins[1][0] != day + 3 * 3600 || wins[2][0] != day + 86400 + 3 * 3600 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unexpected split: %v\n", wins )
+	}
+	if wins := Blackout_split( day + 86400 * 10 + 60, day + 86400 * 10 + 120 ); len( wins ) != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   window inside a blackout was not removed: %v\n", wins )
+	}
+
+	if j := Blackouts_json( day, day + 86400 * 12 ); strings.Count( j, `"nightly"` ) != 12 || strings.Count( j, `"freeze"` ) != 1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   calendar json has the wrong occurrences: %s\n", j )
+	}
+
+	if ! b1.Covers( day + 7200 ) || b1.Covers( day + 3 * 3600 ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   covers gave the wrong answer for the daily period\n" )
+	}
+	if n := b1.Next( day + 3 * 3600 ); n != day + 86400 + 7200 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   next occurrence of the daily period was %d, expected %d\n", n, day + 86400 + 7200 )
+	}
+	if n := b2.Next( day + 86400 * 10 + 1 ); n != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   single period that has started gave a next occurrence: %d\n", n )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all blackout tests passed\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+/*
+	Verify that the fields common to all pledges (owner group, metadata, name, description,
+	depends and correlation id) survive a checkpoint for every pledge type.
+*/
+func Test_pledge_common_chkpt( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p0 := "0"
+	key := "cookie"
+	id := "c1"
+	proto := "tcp"
+	group := "239.1.1.1"
+	out := "fa:16:3e:00:00:03"
+	phost := "host1"
+	vlan := "10"
+	tenant := "proj1"
+	opts := ""
+	trust := "proj1/*"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- common checkpoint field tests --------------\n" )
+	plist := make( []Pledge, 0, 7 )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p0, &p0, now+300, now+600, 10000, 10000, &id, &key, 42, false )
+	plist = append( plist, bp )
+	op, _ := Mk_bwow_pledge( &h1, &h2, &p0, &p0, now+300, now+600, 10000, &id, &key, 42 )
+	plist = append( plist, op )
+	sp, _ := Mk_steer_pledge( &h1, &h2, &p0, &p0, now+300, now+600, &id, &key, &proto )
+	plist = append( plist, sp )
+	mp, _ := Mk_mirror_pledge( []string{ "fa:16:3e:00:00:01" }, &out, now+300, now+600, &id, &key, &phost, &vlan, &tenant, &opts )
+	plist = append( plist, mp )
+	pp, _ := Mk_pass_pledge( &h1, &p0, now+300, now+600, &id, &key )
+	plist = append( plist, pp )
+	tp, _ := Mk_trust_pledge( &trust, now+300, now+600, &id, &key )
+	plist = append( plist, tp )
+	cp, _ := Mk_mcast_pledge( &h1, &group, []*string{ &h2 }, now+300, now+600, 10000, &id, &key, 42 )
+	plist = append( plist, cp )
+
+	for _, p := range plist {
+		kind := Pledge_kind_name( p )
+		p.Add_owner( "cookie2" )
+		p.Set_meta( "ticket", "T-42" )
+		p.Set_name( "backup", "nightly backup" )
+		p.Set_depends( "r0" )
+		p.Set_cid( "c1_00042" )
+
+		cs := p.To_chkpt()
+		gp, err := Json2pledge( &cs )
+		if err != nil {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   %s checkpoint did not decode: %s: %s\n", kind, err, cs )
+			continue
+		}
+
+		owners := (*gp).Get_owners()
+		name, desc := (*gp).Get_name()
+		if len( owners ) != 1 || owners[0] != "cookie2" || (*gp).Get_meta()["ticket"] != "T-42" ||
+			name != "backup" || desc != "nightly backup" || (*gp).Get_depends() != "r0" || (*gp).Get_cid() != "c1_00042" {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   %s common fields not restored from checkpoint: %s\n", kind, cs )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     common fields restored for all pledge types\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
+
+/*
+	A snapshot must checkpoint as the pledge was when it was taken, whatever is changed in
+	the original afterwards.
+*/
+func Test_pledge_snapshot( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	p0 := "0"
+	key := "cookie"
+	id := "s1"
+	proto := "tcp"
+	group := "239.1.1.1"
+	trust := "proj1/*"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge snapshot tests --------------\n" )
+	plist := make( []Pledge, 0, 5 )
+	bp, _ := Mk_bw_pledge( &h1, &h2, &p0, &p0, now+300, now+600, 10000, 10000, &id, &key, 42, false )
+	plist = append( plist, bp )
+	op, _ := Mk_bwow_pledge( &h1, &h2, &p0, &p0, now+300, now+600, 10000, &id, &key, 42 )
+	plist = append( plist, op )
+	sp, _ := Mk_steer_pledge( &h1, &h2, &p0, &p0, now+300, now+600, &id, &key, &proto )
+	plist = append( plist, sp )
+	tp, _ := Mk_trust_pledge( &trust, now+300, now+600, &id, &key )
+	plist = append( plist, tp )
+	cp, _ := Mk_mcast_pledge( &h1, &group, []*string{ &h2 }, now+300, now+600, 10000, &id, &key, 42 )
+	plist = append( plist, cp )
+
+	for _, p := range plist {
+		kind := Pledge_kind_name( p )
+		p.Add_owner( "cookie2" )
+		p.Set_meta( "ticket", "T-42" )
+
+		before := p.To_chkpt()
+		snap := p.Snapshot()
+		p.Add_owner( "cookie3" )
+		p.Set_meta( "ticket", "T-43" )
+		p.Set_expiry( now + 900 )
+
+		if after := snap.To_chkpt(); after != before {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   %s snapshot changed with the original:\n\t%s\n\t%s\n", kind, before, after )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     snapshots are not changed by changes to the original\n" )
+	}
+	fmt.Fprintf( os.Stderr, "\n" )
+}
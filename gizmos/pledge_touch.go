@@ -0,0 +1,144 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	pledge_touch
+	Abstract:	The switches, ports and queues that were programmed for a pledge when it was
+				last pushed, and the number of flow-mod requests sent for each. Res-mgr records
+				these as it builds the requests so that an operator can see from the reservation
+				itself that both directions, and each inter-switch leg, were covered. When both
+				hosts are on the same switch there is no inter-switch leg and the single switch
+				entry is marked as such; when they are behind the same port of the switch nothing
+				is programmed and the entry is marked local.
+
+				The list is rebuilt on every push (refreshes included) and isn't checkpointed;
+				it is empty until the pledge is first pushed after a restart.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Added local entries for hosts sharing a switch port.
+*/
+
+package gizmos
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	TOUCH_ENDPOINT	string = "endpoint"			// ingress switch of a path (host's switch)
+	TOUCH_SAME		string = "same_switch"		// both hosts on one switch; queue 1 on the br-rl bridge
+	TOUCH_LEG		string = "leg"				// inter-switch leg; programmed only when physical switches are managed
+	TOUCH_LOCAL		string = "local"			// both hosts behind one port; nothing programmed
+)
+
+/*
+	One switch/port/queue and the direction of the traffic through it.
+*/
+type Touch struct {
+	Switch	string	`json:"switch"`
+	Port	int		`json:"port"`
+	Queue	int		`json:"queue"`
+	Role	string	`json:"role"`
+	Src		string	`json:"src"`
+	Dst		string	`json:"dst"`
+	Fmods	int		`json:"fmods"`
+}
+
+type touch_list struct {
+	Pushed	int64		`json:"pushed"`		// time of the push which built the list
+	Fmods	int			`json:"fmods"`
+	List	[]*Touch	`json:"switches"`
+}
+
+/*
+	Clear the list; called as a push begins.
+*/
+func (p *Pledge_base) Reset_touched( ) {
+	if p == nil {
+		return
+	}
+
+	p.touched = &touch_list{ Pushed: time.Now().Unix(), List: make( []*Touch, 0, 4 ) }
+}
+
+/*
+	Record that nfmods flow-mod requests were sent for the switch/port/queue for traffic from src to dst.
+	A second request for the same tuple adds to its count. A nil spq is ignored.
+*/
+func (p *Pledge_base) Add_touched( spq *Spq, role string, src *string, dst *string, nfmods int ) {
+	if p == nil || spq == nil {
+		return
+	}
+	if p.touched == nil {
+		p.Reset_touched()
+	}
+
+	t := &Touch{ Switch: spq.Switch, Port: spq.Port, Queue: spq.Queuenum, Role: role, Fmods: nfmods }
+	if src != nil {
+		t.Src = *src
+	}
+	if dst != nil {
+		t.Dst = *dst
+	}
+
+	p.touched.Fmods += nfmods
+	for _, ot := range p.touched.List {
+		if ot.Switch == t.Switch && ot.Port == t.Port && ot.Queue == t.Queue && ot.Role == t.Role && ot.Src == t.Src && ot.Dst == t.Dst {
+			ot.Fmods += nfmods
+			return
+		}
+	}
+	p.touched.List = append( p.touched.List, t )
+}
+
+/*
+	Return a copy of what was touched by the last push and the number of flow-mod requests sent.
+	Nil if the pledge hasn't been pushed.
+*/
+func (p *Pledge_base) Get_touched( ) ( list []Touch, fmods int ) {
+	if p == nil || p.touched == nil {
+		return nil, 0
+	}
+
+	list = make( []Touch, len( p.touched.List ) )
+	for i, t := range p.touched.List {
+		list[i] = *t
+	}
+	return list, p.touched.Fmods
+}
+
+/*
+	Json for the pledge's to_json functions; null if not pushed.
+*/
+func (p *Pledge_base) touched_json( ) ( string ) {
+	if p == nil || p.touched == nil {
+		return "null"
+	}
+
+	b, err := json.Marshal( p.touched )
+	if err != nil {
+		return "null"
+	}
+	return string( b )
+}
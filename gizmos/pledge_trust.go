@@ -0,0 +1,359 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	pledge_trust
+	Abstract:	DSCP trust pledge -- provides pledge interface.
+				Allows the DSCP markings set by a tenant's VMs to be kept as their traffic
+				crosses the cloud; the flow-mods which reset the markings of traffic without
+				a reservation are skipped (the same flow-mods as a passthru reservation).
+				Nothing is reserved or accounted for; the markings are assumed to be policed
+				upstream (voice and video workloads for instance).
+
+				The scope is either a single VM (project/vm) or every VM in the project
+				(project/*). The members, VM address and physical host, are discovered
+				when the pledge is pushed and are not checkpointed.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Depends is checkpointed and restored.
+				16 Oct 2026 - Metadata is checkpointed and restored.
+				16 Oct 2026 - Name and description are checkpointed and restored.
+				16 Oct 2026 - Owner group is checkpointed and restored.
+				16 Oct 2026 - Correlation id is checkpointed and restored.
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Pledge_trust struct {
+				Pledge_base	// common fields
+	host		*string		// project/vm or project/*
+	protocol	*string		// proto[:address]:port to limit the trust, or ""
+
+							// not checkpointed
+	members		map[string]*string	// project/ip -> physical host
+}
+
+/*
+	Work struct used to decode the checkpoint json.
+*/
+type Json_pledge_trust struct {
+	Host		*string
+	Protocol	*string
+	Commence	int64
+	Expiry		int64
+	Usrkey		*string
+	Owners		[]string
+	Cid			string
+	Id			*string
+	Depends		string
+	Meta		map[string]string
+	Name		string
+	Desc		string
+	Ptype		int
+}
+
+// ---- public -------------------------------------------------------------------
+
+/*
+	Constructor. Host is project/vm or project/*. A nil pointer and error are returned if
+	the host has no project or the window is bad.
+*/
+func Mk_trust_pledge( host *string, commence int64, expiry int64, id *string, usrkey *string ) ( p *Pledge_trust, err error ) {
+	if host == nil || strings.Index( *host, "/" ) < 1 {
+		return nil, fmt.Errorf( "trust scope must be project/vm or project/*" )
+	}
+
+	window, err := mk_pledge_window( commence, expiry )
+	if err != nil {
+		return nil, err
+	}
+
+	if id == nil {
+		dummy := "unnamed-trust-pledge"
+		id = &dummy
+	}
+
+	p = &Pledge_trust {
+		Pledge_base:Pledge_base{
+			id: id,
+			window: window,
+		},
+		host:		host,
+		protocol:	&empty_str,
+	}
+
+	if usrkey != nil && *usrkey != "" {
+		p.usrkey = usrkey
+	} else {
+		p.usrkey = &empty_str
+	}
+
+	return p, nil
+}
+
+/*
+	Returns the scope; the interface demands two values so the second is empty.
+*/
+func (p *Pledge_trust) Get_hosts( ) ( host *string, dummy *string ) {
+	if p == nil {
+		return &empty_str, &empty_str
+	}
+
+	return p.host, &empty_str
+}
+
+/*
+	Returns the values needed to push the pledge: scope, commence, expiry and protocol.
+*/
+func (p *Pledge_trust) Get_values( ) ( host *string, commence int64, expiry int64, proto *string ) {
+	if p == nil {
+		return &empty_str, 0, 0, &empty_str
+	}
+
+	c, e := p.window.get_values()
+	return p.host, c, e, p.protocol
+}
+
+/*
+	Returns the project of the scope.
+*/
+func (p *Pledge_trust) Get_project( ) ( string ) {
+	if p == nil || p.host == nil {
+		return ""
+	}
+
+	return strings.SplitN( *p.host, "/", 2 )[0]
+}
+
+/*
+	Returns true if the pledge applies to every VM in the project.
+*/
+func (p *Pledge_trust) Is_project( ) ( bool ) {
+	return p != nil && p.host != nil && strings.HasSuffix( *p.host, "/*" )
+}
+
+func (p *Pledge_trust) Set_proto( proto *string ) {
+	if p != nil && proto != nil {
+		p.protocol = proto
+	}
+}
+
+func (p *Pledge_trust) Get_proto( ) ( *string ) {
+	if p != nil {
+		return p.protocol
+	}
+
+	return nil
+}
+
+/*
+	Replace the members (project/ip -> physical host).
+*/
+func (p *Pledge_trust) Set_members( m map[string]*string ) {
+	if p != nil {
+		p.members = m
+	}
+}
+
+func (p *Pledge_trust) Get_members( ) ( map[string]*string ) {
+	if p != nil {
+		return p.members
+	}
+
+	return nil
+}
+
+/*
+	Returns true if the other pledge is a trust pledge with the same scope and protocol whose
+	window overlaps.
+*/
+func (p *Pledge_trust) Equals( op *Pledge ) ( bool ) {
+	if p == nil || op == nil {
+		return false
+	}
+
+	opt, ok := (*op).( *Pledge_trust )
+	if ! ok {
+		return false
+	}
+
+	if ! Strings_equal( p.host, opt.host ) { return false }
+	if ! Strings_equal( p.protocol, opt.protocol ) { return false }
+
+	return p.window.overlaps( opt.window )
+}
+
+/*
+	Returns true if a1 is the physical host of a member.
+*/
+func (p *Pledge_trust) Same_anchors( a1 *string, a2 *string ) ( bool ) {
+	if p == nil || a1 == nil {
+		return false
+	}
+
+	for _, ph := range p.members {
+		if ph != nil && *ph == *a1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Returns true if the name is the scope, or is a VM in the project when the scope is
+	the whole project.
+*/
+func (p *Pledge_trust) Has_host( hname *string ) ( bool ) {
+	if p == nil || hname == nil {
+		return false
+	}
+
+	if *p.host == *hname {
+		return true
+	}
+
+	return p.Is_project() && strings.HasPrefix( *hname, p.Get_project() + "/" )
+}
+
+func (p *Pledge_trust) Nuke( ) {
+	p.host = nil
+	p.id = nil
+	p.usrkey = nil
+	p.members = nil
+}
+
+/*
+	Given a json string unpack it and put it into a pledge struct.
+*/
+func (p *Pledge_trust) From_json( jstr *string ) ( err error ) {
+	if p == nil {
+		return fmt.Errorf( "no trust pledge to convert json into" )
+	}
+
+	jp := new( Json_pledge_trust )
+	if err = Decode_json( jstr, jp, true ); err != nil {
+		return
+	}
+
+	if jp.Ptype != PT_TRUST {
+		return fmt.Errorf( "json was not a trust pledge type type=%d", jp.Ptype )
+	}
+
+	p.host = jp.Host
+	p.window, _ = mk_pledge_window( jp.Commence, jp.Expiry )
+	p.id = jp.Id
+	p.usrkey = jp.Usrkey
+	p.load_owners( jp.Owners )
+	p.cid = jp.Cid
+	p.depends = jp.Depends
+	p.load_meta( jp.Meta )
+	p.name = jp.Name
+	p.desc = jp.Desc
+	p.protocol = jp.Protocol
+	if p.protocol == nil {					// we don't tolerate nil ptrs
+		p.protocol = &empty_str
+	}
+	if p.usrkey == nil {
+		p.usrkey = &empty_str
+	}
+	if p.host == nil {
+		p.host = &empty_str
+	}
+
+	return
+}
+
+// --------- humanisation or export functions --------------------------------------------------------
+
+func (p *Pledge_trust) To_str( ) ( s string ) {
+	return p.String()
+}
+
+/*
+	Stringer interface so that fmt.Printf( "%s\n", p ) will just work.
+*/
+func (p *Pledge_trust) String( ) ( s string ) {
+	if p == nil {
+		return "--nil-trust-pledge--"
+	}
+
+	state, caption, diff := p.window.state_str()
+	commence, expiry := p.window.get_values( )
+
+	//NEVER put the usrkey into the string!
+	s = fmt.Sprintf( "%s: togo=%ds %s scope=%s proto=%s members=%d id=%s st=%d ex=%d push=%v ptype=trust", state, diff, caption, *p.host, *p.protocol, len( p.members ), *p.id, commence, expiry, p.pushed )
+	return
+}
+
+/*
+	Generate a json representation of the pledge which is safe to present to a user (no cookie).
+*/
+func (p *Pledge_trust) To_json( ) ( json string ) {
+	if p == nil {
+		return "{ }"
+	}
+
+	state, _, diff := p.window.state_str()
+
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host": %q, "protocol": %q, "members": %d, "id": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`, state, diff, *p.host, *p.protocol, len( p.members ), *p.id, p.depends, p.meta_json(), p.name, p.desc, PT_TRUST )
+	return
+}
+
+/*
+	Return a copy of the pledge which can be checkpointed (To_chkpt) by another goroutine
+	while the original continues to be changed.
+	The member map (not checkpointed) is not carried.
+*/
+func (p *Pledge_trust) Snapshot( ) ( Pledge ) {
+	np := *p
+	np.Pledge_base = p.snapshot_base( )
+	np.members = nil
+
+	return &np
+}
+
+/*
+	Build a checkpoint string; "expired" if the pledge has expired.
+*/
+func (p *Pledge_trust) To_chkpt( ) ( chkpt string ) {
+	if p.Is_expired( ) {			// will show expired if p is nil, so safe without check
+		chkpt = "expired"
+		return
+	}
+
+	commence, expiry := p.window.get_values()
+
+	chkpt = fmt.Sprintf( `{ "host": %q, "protocol": %q, "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, "owners": %s, "cid": %q, "depends": %q, "meta": %s, "name": %q, "desc": %q, "ptype": %d }`, *p.host, *p.protocol, commence, expiry, *p.id, *p.usrkey, p.owners_json(), p.cid, p.depends, p.meta_json(), p.name, p.desc, PT_TRUST )
+	return
+}
+
+func init() {
+	Register_pledge( &Pledge_kind{ Ptype: PT_TRUST, Name: "trust", Restore: true,
+		Decode: func( jstr *string ) ( Pledge, error ) { p := new( Pledge_trust ); return p, p.From_json( jstr ) }, Json: Json_pledge_trust{} }, &Pledge_trust{} )
+}
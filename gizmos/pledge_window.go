@@ -31,6 +31,10 @@
 	Author:		E. Scott Daniels
 
 	Mods:		28 Jul 2015 : Added upper bounds check for expiry time.
+				16 Oct 2026 : Added expiring soon state.
+				16 Oct 2026 : Added calendar arithmetic (duration, intersect, subtract) for blackouts.
+				16 Oct 2026 : The commence time asked for is kept when it is moved forward.
+				16 Oct 2026 : Added transitions() for timelines.
 */
 
 package gizmos
@@ -43,19 +47,44 @@ import (
 type pledge_window struct {
 	commence	int64
 	expiry		int64
+	asked		int64		// commence given when it was earlier than now and moved forward; 0 if not moved
+}
+
+var expiry_warn int64 = 0				// active pledges this close (seconds) to expiry are EXPIRING_SOON; 0 disables
+
+/*
+	A change of state at a point in time (see transitions()).
+*/
+type Transition struct {
+	Ts		int64	`json:"ts"`
+	State	string	`json:"state"`
+}
+
+/*
+	Set the number of seconds before expiry that an active pledge is reported as expiring
+	soon rather than active. Zero (the default) turns the state off.
+*/
+func Set_expiry_warn( secs int64 ) {
+	if secs < 0 {
+		secs = 0
+	}
+
+	expiry_warn = secs
 }
 
 /*
 	Make a new pledge_window. If the commence time is earlier than now, it is adjusted
-	to be now.  If the expry time is before the adjusted commence time, then a nil
-	pointer and error are returned.
+	to be now and the time given is kept (see late_start()).  If the expry time is before
+	the adjusted commence time, then a nil pointer and error are returned.
 */
 func mk_pledge_window( commence int64, expiry int64 ) ( pw *pledge_window, err error ) {
 	now := time.Now().Unix()
 	err = nil
 	pw = nil
 
+	var asked int64 = 0
 	if commence < now {
+		asked = commence
 		commence = now
 	}
 
@@ -74,6 +103,7 @@ func mk_pledge_window( commence int64, expiry int64 ) ( pw *pledge_window, err e
 	pw = &pledge_window {
 		commence: commence,
 		expiry: expiry,
+		asked: asked,
 	}
 
 	return
@@ -111,11 +141,34 @@ func (p *pledge_window) clone( ) ( npw *pledge_window ) {
 	npw = &pledge_window {
 		expiry: p.expiry,
 		commence: p.commence,
+		asked: p.asked,
 	}
 
 	return
 }
 
+/*
+	Return the commence time that was asked for when it was earlier than the time the
+	window was made (e.g. reloaded from a checkpoint after the pledge became active); 0
+	if commence wasn't moved.
+*/
+func (p *pledge_window) late_start( ) ( int64 ) {
+	if p == nil {
+		return 0
+	}
+
+	return p.asked
+}
+
+/*
+	Forget the commence time that was asked for; the late start has been dealt with.
+*/
+func (p *pledge_window) clear_late_start( ) {
+	if p != nil {
+		p.asked = 0
+	}
+}
+
 /*
 	Return the state as a string and the amount of time in the
 	past (seconds) that the pledge expired, or the amount of
@@ -142,12 +195,32 @@ func (p *pledge_window) state_str( ) ( state string, caption string, diff int64
 			state = "ACTIVE"
 			diff = p.expiry -  now
 			caption = "remaining"
+			if expiry_warn > 0 && diff <= expiry_warn {
+				state = "EXPIRING_SOON"
+			}
 		}
 	}
 
 	return state, caption, diff
 }
 
+/*
+	Return the times that the window moves from one state to the next, in order: active at
+	commence, expiring soon (when the warning is set and is shorter than the window) and
+	expired at expiry. Pending is the state before the first transition.
+*/
+func (p *pledge_window) transitions( ) ( []Transition ) {
+	if p == nil {
+		return nil
+	}
+
+	tl := []Transition{ { p.commence, "ACTIVE" } }
+	if expiry_warn > 0 && p.expiry - expiry_warn > p.commence {
+		tl = append( tl, Transition{ p.expiry - expiry_warn, "EXPIRING_SOON" } )
+	}
+	return append( tl, Transition{ p.expiry, "EXPIRED" } )
+}
+
 /*
 	Extend the expiry time by n seconds. N may be negative and will not set the
 	expiry time earlier than now.
@@ -307,3 +380,70 @@ func (p *pledge_window) overlaps( p2 *pledge_window ) ( bool ) {
 
 	return false
 }
+
+/*
+	Returns true if the timestamp is within the window (commence <= ts < expiry).
+*/
+func (p *pledge_window) contains( ts int64 ) ( bool ) {
+	if p == nil {
+		return false
+	}
+
+	return ts >= p.commence && ts < p.expiry
+}
+
+/*
+	Returns the number of seconds covered by the window.
+*/
+func (p *pledge_window) duration( ) ( int64 ) {
+	if p == nil || p.expiry < p.commence {
+		return 0
+	}
+
+	return p.expiry - p.commence
+}
+
+/*
+	Return the window that is common to p and p2, or nil if they don't overlap.
+*/
+func (p *pledge_window) intersect( p2 *pledge_window ) ( *pledge_window ) {
+	if ! p.overlaps( p2 ) {
+		return nil
+	}
+
+	ip := &pledge_window{ commence: p.commence, expiry: p.expiry }
+	if p2.commence > ip.commence {
+		ip.commence = p2.commence
+	}
+	if p2.expiry < ip.expiry {
+		ip.expiry = p2.expiry
+	}
+
+	return ip
+}
+
+/*
+	Remove p2 from p returning the part(s) of p that remain: none if p2 covers p, one if
+	they don't overlap or p2 covers one end, and two if p2 is wholly inside of p. Windows
+	are created directly rather than with mk_pledge_window() so commence isn't moved to now.
+*/
+func (p *pledge_window) subtract( p2 *pledge_window ) ( []*pledge_window ) {
+	if p == nil {
+		return nil
+	}
+
+	ip := p.intersect( p2 )
+	if ip == nil {
+		return []*pledge_window{ p.clone() }
+	}
+
+	left := make( []*pledge_window, 0, 2 )
+	if ip.commence > p.commence {
+		left = append( left, &pledge_window{ commence: p.commence, expiry: ip.commence } )
+	}
+	if ip.expiry < p.expiry {
+		left = append( left, &pledge_window{ commence: ip.expiry, expiry: p.expiry } )
+	}
+
+	return left
+}
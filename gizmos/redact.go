@@ -0,0 +1,120 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	redact
+	Abstract:	Functions which mask user cookies and openstack auth tokens before they are
+				written to a log or a json dump. All but the last four characters are replaced
+				with asterisks which is enough to match a log message to a request without
+				exposing the secret.
+
+				Checkpoint strings must keep the cookie so that ownership survives a restart;
+				anything that logs a checkpoint string should pass it through Redact_chkpt().
+
+				Redaction can be turned off (lab environments) with Set_redaction( false ).
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Owner group cookies are masked in checkpoint strings.
+*/
+
+package gizmos
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	redact_on	bool = true
+	chkpt_key_re	= regexp.MustCompile( `("usrkey": *")([^"]*)(")` )
+	chkpt_owners_re	= regexp.MustCompile( `"owners": *\[[^\]]*\]` )
+	quoted_re		= regexp.MustCompile( `"[^"]*"` )
+	long_tok_re		= regexp.MustCompile( `[A-Za-z0-9_\-=]{32,}` )		// openstack tokens are long; nothing else we log is
+)
+
+/*
+	Turn redaction on or off.
+*/
+func Set_redaction( state bool ) {
+	redact_on = state
+}
+
+/*
+	Mask all but the last four characters of the string. Strings of four or fewer
+	characters are completely masked.
+*/
+func Mask( s string ) ( string ) {
+	if !redact_on || s == "" {
+		return s
+	}
+
+	if len( s ) <= 4 {
+		return strings.Repeat( "*", len( s ) )
+	}
+
+	return strings.Repeat( "*", len( s ) - 4 ) + s[len( s ) - 4:]
+}
+
+/*
+	Mask the string pointed to; nil pointers result in an empty string.
+*/
+func Mask_ptr( s *string ) ( string ) {
+	if s == nil {
+		return ""
+	}
+
+	return Mask( *s )
+}
+
+/*
+	Mask the cookie (usrkey), and the cookies of the owner group, in a checkpoint string.
+*/
+func Redact_chkpt( s string ) ( string ) {
+	if !redact_on {
+		return s
+	}
+
+	s = chkpt_key_re.ReplaceAllStringFunc( s, func( m string ) ( string ) {
+		parts := chkpt_key_re.FindStringSubmatch( m )
+		return parts[1] + Mask( parts[2] ) + parts[3]
+	} )
+
+	return chkpt_owners_re.ReplaceAllStringFunc( s, func( m string ) ( string ) {
+		i := strings.Index( m, "[" )								// mask each quoted cookie in the list
+		return m[:i] + quoted_re.ReplaceAllStringFunc( m[i:], func( q string ) ( string ) {
+			return `"` + Mask( q[1:len( q )-1] ) + `"`
+		} )
+	} )
+}
+
+/*
+	Mask anything that looks like an auth token in a string (e.g. a raw request record
+	or a token/project/host name).
+*/
+func Redact_tokens( s string ) ( string ) {
+	if !redact_on {
+		return s
+	}
+
+	return long_tok_re.ReplaceAllStringFunc( s, Mask )
+}
@@ -47,6 +47,8 @@
 					greater than zero.
 				18 Jun 2015 - Allow a queue to be added only if the amount is positive.
 				22 Jun 2015 - Added check for nil qid pointer on add.
+				16 Oct 2026 - Added Get_window().
+				16 Oct 2026 - Added same() and absorb() for compaction.
 */
 
 package gizmos
@@ -178,6 +180,61 @@ func (ts *Time_slice) Includes( timestamp int64 ) ( bool ) {
 	return ts.commence <= timestamp  &&  ts.conclude >= timestamp
 }
 
+/*
+	Return the commence and conclude times of the slice.
+*/
+func (ts *Time_slice) Get_window( ) ( commence int64, conclude int64 ) {
+	return ts.commence, ts.conclude
+}
+
+/*
+	Return true if the other slice has the same amount, queues and user fences as this one;
+	such slices can be merged when adjacent.
+*/
+func (ts *Time_slice) same( o *Time_slice ) ( bool ) {
+	if o == nil || ts.Amt != o.Amt || len( ts.queues ) != len( o.queues ) || len( ts.limits ) != len( o.limits ) {
+		return false
+	}
+
+	for id, q := range ts.queues {
+		oq := o.queues[id]
+		if oq == nil || q.bandwidth != oq.bandwidth || q.qnum != oq.qnum || q.pri != oq.pri {
+			return false
+		}
+		if (q.exref == nil) != (oq.exref == nil) || (q.exref != nil && *q.exref != *oq.exref) {
+			return false
+		}
+	}
+
+	for name, f := range ts.limits {
+		of := o.limits[name]
+		if of == nil || f.value != of.value || f.max_cap != of.max_cap || f.min_cap != of.min_cap {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+	Merge the next slice into this one: the window is extended to the next slice's conclude
+	time and the next slice is removed from the list. The caller must have checked that the
+	two are the same.
+*/
+func (ts *Time_slice) absorb( ) {
+	nxt := ts.Next
+	if nxt == nil {
+		return
+	}
+
+	ts.conclude = nxt.conclude
+	ts.Next = nxt.Next
+	if ts.Next != nil {
+		ts.Next.Prev = ts
+	}
+	nxt.Nuke()
+}
+
 /*
 	Return true if the slice is completely before the given timestamp.
 */
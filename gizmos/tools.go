@@ -41,6 +41,8 @@
 					passed in.
 				27 May 2015 - Added Split_hpv().
 				26 Aug 2015 - Added IsMAC(), IsUUID(), IsIPv4()
+				16 Oct 2026 - Added Valid_hostname() and Shell_safe() to vet strings headed for agent commands.
+				16 Oct 2026 - Added Vet_action() so that tegu and the agent vet actions the same way.
 */
 
 package gizmos
@@ -49,7 +51,7 @@ import (
 	//"bufio"
 	//"encoding/json"
 	//"flag"
-	//"fmt"
+	"fmt"
 	//"io/ioutil"
 	//"html"
 	//"net/http"
@@ -483,6 +485,9 @@ func Map_has_any(  ui interface{}, ki interface{} ) (bool) {
 var mac_re  = regexp.MustCompile(`^([0-9a-fA-F]{1,2}:){5}[0-9a-fA-F]{1,2}$`)				// RE to match a MAC address
 var uuid_re = regexp.MustCompile(`^[0-9a-fA-F]{8}-([0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12}$`)	// RE to match a UUID
 var ipv4_re = regexp.MustCompile(`^([0-9]{1,3}\.){3}[0-9]{1,3}$`)							// RE to match an IPv4 addr
+var hname_re = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.\-]{0,254}$`)				// RE to match a host name (we allow _ as some VM names have them)
+
+const shell_meta = "`$;&|<>()'\"\\!*?{}#~\n\r"												// characters that have meaning to the shell
 
 /*
 	Checks if a string is a valid MAC address.
@@ -505,3 +510,60 @@ func IsUUID(s string) bool {
 func IsIPv4(s string) bool {
 	return ipv4_re.MatchString(s)
 }
+
+/*
+	Checks if a string is a plausible host name. Names are passed to the agent and end up
+	on command lines, so only letters, digits, dot, dash and underbar are allowed and the
+	name may not start with a dash (it would look like an option).
+*/
+func Valid_hostname( s string ) bool {
+	return hname_re.MatchString( s )
+}
+
+/*
+	Checks a string to see if it can safely be placed on a shell command line. If tokens
+	is true the string must also not contain whitespace (it is used as a single option value
+	and embedded spaces would allow additional options to be injected).
+*/
+func Shell_safe( s string, token bool ) bool {
+	if strings.ContainsAny( s, shell_meta ) {
+		return false
+	}
+
+	if token && strings.ContainsAny( s, " \t" ) {
+		return false
+	}
+
+	return true
+}
+
+/*
+	Vet the strings of an agent action. The agent builds shell command lines from host names,
+	data values and flow-mod/queue strings, so none may contain shell meta characters. Data
+	values are used as single option values and so may not contain whitespace either. Empty
+	host names (from splitting a list with extra spaces) are ignored by the agent and allowed.
+	The error names the first string refused.
+*/
+func Vet_action( atype string, hosts []string, data map[string]string, fdata []string, qdata []string, dscps string ) ( error ) {
+	for _, h := range hosts {
+		if h != "" && ! Valid_hostname( h ) {
+			return fmt.Errorf( "%s: bad host name: %q", atype, h )
+		}
+	}
+
+	for k, v := range data {
+		if ! Shell_safe( v, true ) {
+			return fmt.Errorf( "%s: bad data value: %s=%q", atype, k, v )
+		}
+	}
+
+	for _, list := range [][]string{ fdata, qdata, []string{ dscps } } {
+		for _, v := range list {
+			if ! Shell_safe( v, false ) {
+				return fmt.Errorf( "%s: bad command data: %q", atype, v )
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	zframe
+	Abstract:	Compression framing for the tegu/agent session. A compressed message is
+				itself a json blob so that both sides continue to use the json cache to
+				find message boundaries in the stream:
+					{ "Ctype": "zframe", "Zenc": "gzip", "Zdata": "<base64>" }
+
+				Zdata is the compressed form of the original json message. Either side can
+				always unwrap a frame; which encoding (if any) is used for sending is agreed
+				during the hello exchange. Messages smaller than the caller's minimum are
+				not worth the trouble and are sent as is.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package gizmos
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+type zframe struct {
+	Ctype	string
+	Zenc	string
+	Zdata	[]byte				// marshals as base64
+}
+
+/*
+	Encodings that we support, in our order of preference.
+*/
+var Zencodings = []string { "gzip" }
+
+/*
+	Given a list of encodings offered by the other side (in their order of preference)
+	return the first that we support; empty string if none.
+*/
+func Zselect( offered []string ) ( string ) {
+	for _, o := range offered {
+		for _, z := range Zencodings {
+			if o == z {
+				return o
+			}
+		}
+	}
+
+	return ""
+}
+
+/*
+	Compress the message and wrap it in a frame if an encoding is given and the message
+	is at least min bytes. The original message is returned if it is not compressed, or
+	if the compressed frame would not be smaller.
+*/
+func Zwrap( zenc string, msg []byte, min int ) ( []byte ) {
+	if zenc == "" || len( msg ) < min {
+		return msg
+	}
+
+	var zdata []byte
+	switch zenc {
+		case "gzip":
+			var buf bytes.Buffer
+			zw := gzip.NewWriter( &buf )
+			if _, err := zw.Write( msg ); err != nil {
+				return msg
+			}
+			if err := zw.Close(); err != nil {
+				return msg
+			}
+			zdata = buf.Bytes()
+
+		default:
+			return msg
+	}
+
+	frame, err := json.Marshal( &zframe{ Ctype: "zframe", Zenc: zenc, Zdata: zdata } )
+	if err != nil || len( frame ) >= len( msg ) {
+		return msg
+	}
+
+	return frame
+}
+
+/*
+	If the json blob is a compression frame, return the uncompressed message; otherwise the
+	blob is returned unchanged. A quick check for the frame type is made before unmarshalling
+	so that ordinary messages pay very little.
+*/
+func Zunwrap( blob []byte ) ( []byte, error ) {
+	if ! bytes.Contains( blob, []byte( `"zframe"` ) ) {
+		return blob, nil
+	}
+
+	zf := &zframe{}
+	if err := json.Unmarshal( blob, zf ); err != nil || zf.Ctype != "zframe" {
+		return blob, nil
+	}
+
+	switch zf.Zenc {
+		case "gzip":
+			zr, err := gzip.NewReader( bytes.NewReader( zf.Zdata ) )
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return ioutil.ReadAll( zr )
+	}
+
+	return nil, fmt.Errorf( "unknown compression encoding: %s", zf.Zenc )
+}
@@ -28,6 +28,7 @@
 				Command line flags:
 					-C config	-- config file that provides openstack credentials and maybe more
 					-c chkpt	-- checkpoint file, last set of reservations
+					-r snapshot	-- replay mode: start from the snapshot file (no real network; not checkpointed)
 					-f host:port -- floodlight (SDNC) host:port
 					-p port		-- tegu listen port (4444)
 					-s cookie	-- super cookie
@@ -154,6 +155,7 @@
 				12 May 2016 : Correct core dump in gizmos.
 				18 May 2016 : Prevent possible core dump in net_path if one VM is on a host unknown to tegu.
 				20 Apr 2017 : Prevent possible nil pointer use in network.go. Correct inability to handle blank line in ckpt file.
+				16 Oct 2026 : Added -r to replay a snapshot.
 
 	Version number "logic":
 				3.0		- QoS-Lite version of Tegu
@@ -183,7 +185,7 @@ var (
 
 func usage( version string ) {
 	fmt.Fprintf( os.Stdout, "tegu %s\n", version )
-	fmt.Fprintf( os.Stdout, "usage: tegu [-C config-file] [-c ckpt-file] [-f floodlight-host] [-p api-port] [-s super-cookie] [-v]\n" )
+	fmt.Fprintf( os.Stdout, "usage: tegu [-C config-file] [-c ckpt-file] [-f floodlight-host] [-p api-port] [-r snapshot-file] [-s super-cookie] [-v]\n" )
 }
 
 func main() {
@@ -196,6 +198,7 @@ func main() {
 		fl_host		*string
 		super_cookie *string
 		chkpt_file	*string
+		replay_file	*string
 
 		// various comm channels for threads -- we declare them here so they can be passed to managers that need them
 		nw_ch	chan *ipc.Chmsg		// network graph manager
@@ -214,6 +217,7 @@ func main() {
 	needs_help = flag.Bool( "?", false, "show usage" )
 
 	chkpt_file = flag.String( "c", "", "check-point-file" )
+	replay_file = flag.String( "r", "", "snapshot-file" )
 	cfg_file = flag.String( "C", "", "configuration-file" )
 	fl_host = flag.String( "f", "", "floodlight_host:port" )
 	api_port = flag.String( "p", "29444", "api_port" )
@@ -250,6 +254,13 @@ func main() {
 		sheep.Baa( 0, "ERR: unable to initialise: %s\n", err );
 		os.Exit( 1 )
 	}
+	if *replay_file != "" {
+		if err = managers.Load_replay( *replay_file ); err != nil {
+			sheep.Baa( 0, "ERR: unable to load snapshot: %s: %s\n", *replay_file, err );
+			os.Exit( 1 )
+		}
+		chkpt_file = replay_file						// inventory is loaded from the snapshot
+	}
 	managers.Log_Restart( version )
 
 	go managers.Http_api( api_port, nw_ch, rmgr_ch )				// start early so we bind to port quickly, but don't allow requests until late
@@ -30,6 +30,8 @@
 					-l directory -- logfile directory
 					-p n		 -- number of parallel ssh to run (default 10)
 					-no-rsync    -- turn off rsync feature
+					-no-compress -- refuse session compression offered by tegu
+					-host name   -- host name given to tegu (default is the system host name)
 					-rdir dir    -- rsync remote directory
 					-rlist list  -- list of files to sync to remote hosts
 					-u user      -- ssh username to use
@@ -62,6 +64,29 @@
 				12 Nov 2015 : Updated to return stdout/stderr for do_mirrorwiz()
 				26 Jan 2016 : Added support for passthrough reservations (bandwidth)
 				10 Mar 2017	: Prevent map_mac2phost from running if a setup intermed is in progress.
+				16 Oct 2026 : Pass priority bump to bandwidth flow-mod script.
+				16 Oct 2026 : Log correlation id with bandwidth and passthru commands.
+				16 Oct 2026 : Actions with host names or parameters containing shell meta characters are
+					refused rather than being placed on a command line.
+				16 Oct 2026 : Responds to tegu's hello with protocol version and supported actions; unsupported
+					actions are failed back to tegu rather than being silently dropped.
+				16 Oct 2026 : Session compression (gzip) if offered by tegu in the hello (-no-compress disables).
+				16 Oct 2026 : Actions are executed on lanes (fast, slow, diag), each with its own queue, so that
+					long running queue setup does not delay reservation flow-mods (protocol version 2).
+				16 Oct 2026 : Host name is given to tegu in hello so reservations can be pushed again on reconnect.
+				16 Oct 2026 : Added flow_count action which reports the number of flows on each host's br-int.
+				16 Oct 2026 : Added mcast_fmod action for multicast reservations.
+				16 Oct 2026 : Pass the priority adjustment (-A) to the bandwidth, oneway and multicast scripts.
+				16 Oct 2026 : Added fmod_probe action which counts the traffic matched, and missed, by the
+								flow-mods of a reservation with a floating ip (ql_fmod_probe).
+				16 Oct 2026 : Added remark action which sets the default remark flow-mods (ql_remark_fmods).
+				16 Oct 2026 : Added ovs_inventory action which reports bridges, bonds and nic speeds (ql_ovs_inventory).
+				16 Oct 2026 : Added fmod_bytes action which reports bytes sent by reservation flow-mods (ql_fmod_bytes).
+				16 Oct 2026 : Added res_verify action which reports the rate and marking of a reservation's traffic (ql_res_verify).
+				16 Oct 2026 : Added sla_stats action which reports reservation bytes and queue drops (ql_sla_stats).
+				16 Oct 2026 : Setqueues verifies the applied queues (ql_check_queues) and reports per host results.
+				16 Oct 2026 : Actions are vetted with gizmos.Vet_action (as tegu does) and refused actions are answered
+								with a failure response.
 
 	NOTE:		There are three types of generic error/warning messages which have
 				the same message IDs (007, 008, 009) and thus are generated through
@@ -77,6 +102,8 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/att/gopkgs/bleater"
@@ -84,6 +111,7 @@ import (
 	"github.com/att/gopkgs/jsontools"
 	"github.com/att/gopkgs/ssh_broker"
 	"github.com/att/gopkgs/token"
+	"github.com/att/tegu/gizmos"
 )
 
 // globals
@@ -96,6 +124,45 @@ var (
 	running_map bool = false	// map phost
 )
 
+const pver int = 2				// agent protocol version (2 == lanes)
+const zmin int = 1024			// responses smaller than this aren't worth compressing
+
+var zenc string = ""			// session compression agreed in hello; empty if none
+var no_compress bool = false	// command line override: never agree to compression
+var my_host string = ""			// host name given to tegu in hello (-host, or the system host name)
+
+/*
+	Action types we support (sent to tegu in the hello response) and the lane each is executed
+	on. Each lane has its own queue and goroutine so that a long running action (intermediate
+	queue setup) never delays time sensitive ones (reservation flow-mods). Actions within a
+	lane are executed in the order received.
+*/
+var action_lanes = map[string]string {
+	"flowmod":			"fast",
+	"bw_fmod":			"fast",
+	"bwow_fmod":		"fast",
+	"mcast_fmod":		"fast",
+	"passthru":			"fast",
+	"setqueues":		"fast",
+	"intermed_queues":	"slow",
+	"remark":			"slow",
+	"map_mac2phost":	"diag",
+	"mirrorwiz":		"diag",
+	"flow_count":		"diag",
+	"fmod_probe":		"diag",
+	"fmod_bytes":		"diag",
+	"res_verify":		"diag",
+	"sla_stats":		"diag",
+	"ovs_inventory":	"diag",
+}
+
+var lane_names = []string { "fast", "slow", "diag" }
+
+type lane_req struct {
+	act		json_action
+	sid		string				// session id the request arrived on; response is written there
+}
+
 
 /*
 	Structures used to unpack json. These provide a generic
@@ -109,10 +176,13 @@ type json_action struct {
 	Fdata	[]string			// flow-mod parms
 	Hosts	[]string			// hosts to execute on if a multihost command
 	Dscps	string				// space separated list of dscp values
+	Lane	string				// lane tegu would like the action executed on
 }
 
 type json_request struct {
 	Ctype	string
+	Pver	int					// protocol version of the sender
+	Zenc	[]string			// compression encodings offered (hello)
 	Actions	[]json_action
 }
 
@@ -127,6 +197,9 @@ type agent_msg struct {
 	State	int				// if an ack/nack some state information
 	Vinfo	string			// agent version info for debugging
 	Rid		uint32			// original request id
+	Pver	int				// our protocol version (hello response)
+	Zenc	string			// compression encoding selected (hello response)
+	Host	string			// host we serve (hello response)
 }
 //--- generic message functions ---------------------------------------------------------------------
 
@@ -146,6 +219,10 @@ func msg_009( cname string, host string ) {
 	sheep.Baa( 1, "WRN: error running %s command on %s  [TGUAGN009]", cname, host )
 }
 
+func msg_010( err error ) {
+	sheep.Baa( 0, "ERR: action refused: illegal characters: %s  [TGUAGN010]", err )
+}
+
 //----------------------------------------------------------------------------------------------------
 
 /*
@@ -289,10 +366,12 @@ func (act *json_action ) do_bw_fmod( cmd_type string, broker *ssh_broker.Broker,
 			build_opt( parms["timeout"],  "-t" ) +
 			build_opt( parms["dscp"],  "-T" ) +
 			build_opt( parms["oneswitch"], "-o" )  +
-			build_opt( parms["ipv6"], "-6" )
+			build_opt( parms["ipv6"], "-6" ) +
+			build_opt( parms["pbump"], "-B" ) +
+			build_opt( parms["padj"], "-A" )
 
 
-	sheep.Baa( 1, "via broker on %s: %s", act.Hosts[0], cmd_str )
+	sheep.Baa( 1, "via broker on %s: cid=%s %s", act.Hosts[0], act.Data["cid"], cmd_str )
 
 	msg := agent_msg{}				// build response to send back
 	msg.Ctype = "response"
@@ -379,10 +458,11 @@ func (act *json_action ) do_bwow_fmod( cmd_type string, broker *ssh_broker.Broke
 			build_opt( parms["timeout"],  "-t" ) +
 			build_opt( parms["dscp"],  "-T" ) +
 			build_opt( parms["vlan_match"],  "-V" ) +
-			build_opt( parms["ipv6"], "-6" )
+			build_opt( parms["ipv6"], "-6" ) +
+			build_opt( parms["padj"], "-A" )
 
 
-	sheep.Baa( 1, "via broker on %s: %s", act.Hosts[0], cmd_str )
+	sheep.Baa( 1, "via broker on %s: cid=%s %s", act.Hosts[0], act.Data["cid"], cmd_str )
 
 	msg := agent_msg{}				// build response to send back
 	msg.Ctype = "response"
@@ -443,6 +523,401 @@ func (act *json_action ) do_bwow_fmod( cmd_type string, broker *ssh_broker.Broke
 	return
 }
 
+/*
+	Multicast flow-mods for one switch of a multicast reservation's tree: marking traffic
+	from the source to the group (when the source is attached to the switch) and
+	replicating the group's traffic to the receivers attached to the switch.
+ */
+func (act *json_action ) do_mcast_fmod( cmd_type string, broker *ssh_broker.Broker, path *string, timeout time.Duration ) ( jout []byte, err error ) {
+	pstr := ""
+	if path != nil {
+		pstr = fmt.Sprintf( "PATH=%s:$PATH ", *path )		// path to add if needed
+	}
+
+	parms := act.Data
+	cmd_str := fmt.Sprintf( `%sql_mcast_fmods `, pstr ) +
+			build_opt( parms["smac"], "-s" ) +
+			build_opt( parms["group"], "-g" ) +
+			build_opt( parms["rmacs"], "-r" ) +
+			build_opt( parms["dproto"],  "-P" ) +
+			build_opt( parms["queue"],  "-q" ) +
+			build_opt( parms["timeout"],  "-t" ) +
+			build_opt( parms["dscp"],  "-T" ) +
+			build_opt( parms["ipv6"], "-6" ) +
+			build_opt( parms["padj"], "-A" )
+
+	sheep.Baa( 1, "via broker on %s: cid=%s %s", act.Hosts[0], act.Data["cid"], cmd_str )
+
+	msg := agent_msg{}				// build response to send back
+	msg.Ctype = "response"
+	msg.Rtype = cmd_type
+	msg.Rid = act.Aid				// response id so tegu can map back to requestor
+	msg.Vinfo = version
+	msg.State = 0					// assume success
+
+	ssh_rch := make( chan *ssh_broker.Broker_msg, 256 )					// do NOT close the channel here; only senders should close
+	err = broker.NBRun_cmd( act.Hosts[0], cmd_str, 0, ssh_rch )			// multicast fmods are applied to one host per action
+	if err != nil {
+		sheep.Baa( 1, "WRN: error submitting mcast command  to %s: %s", act.Hosts[0], err )
+		msg.State = 1
+		jout, _ = json.Marshal( msg )
+		return
+	}
+
+	rdata := make( []string, 8192 )
+	edata := make( []string, 8192 )
+	ridx := 0
+	select {
+		case <- time.After( timeout * time.Second ):
+			sheep.Baa( 1, "WRN: timeout waiting for response from %s; cmd: %s", act.Hosts[0], cmd_str )
+			msg.State = 1
+
+		case resp := <- ssh_rch:
+			stdout, stderr, _, err := resp.Get_results()
+			host, _, _ := resp.Get_info()
+			eidx := buf_into_array( stderr, edata, 0 )
+			msg.Edata = edata[0:eidx]
+			if err != nil {
+				msg.State = 1
+				sheep.Baa( 1, "WRN: error running command: host=%s: %s", host, err )
+			} else {
+				ridx = buf_into_array( stdout, rdata, ridx )
+			}
+			if err != nil || sheep.Would_baa( 2 ) {
+				dump_stderr( stderr, "mcast_fmod " + host )
+			}
+	}
+
+	msg.Rdata = rdata[0:ridx]
+
+	if msg.State > 0 {
+		sheep.Baa( 0, "ERR: %s unable to execute: %s	[TGUAGN000]", cmd_type, cmd_str )
+	} else {
+		sheep.Baa( 1, "mcast_fmod cmd (%s) successful: stdout: %d lines;  stderr: %d lines", cmd_type, len( msg.Rdata ), len( msg.Edata )  )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Probe the flow-mods of a bandwidth reservation which match on an external address. The
+	script adds temporary flow-mods, counts packets for the window and removes them, so this
+	blocks for the window; it runs on the diag lane. Each record in the response is prefixed
+	with the host so tegu can tell the two endpoints of a reservation apart.
+ */
+func (act *json_action ) do_fmod_probe( cmd_type string, broker *ssh_broker.Broker, path *string, timeout time.Duration ) ( jout []byte, err error ) {
+	pstr := ""
+	if path != nil {
+		pstr = fmt.Sprintf( "PATH=%s:$PATH ", *path )		// path to add if needed
+	}
+
+	parms := act.Data
+	window, _ := strconv.Atoi( parms["window"] )
+	cmd_str := fmt.Sprintf( `%sql_fmod_probe `, pstr ) +
+			build_opt( parms["resid"], "-i" ) +
+			build_opt( parms["smac"], "-s" ) +
+			build_opt( parms["dmac"], "-d" ) +
+			build_opt( parms["extip"], "-E" ) +
+			build_opt( parms["extdir"], "" ) +
+			build_opt( parms["sproto"],  "-p" ) +
+			build_opt( parms["dproto"],  "-P" ) +
+			build_opt( parms["ipv6"], "-6" ) +
+			build_opt( parms["padj"], "-A" ) +
+			build_opt( parms["window"], "-w" )
+
+	sheep.Baa( 1, "via broker on %s: %s", act.Hosts[0], cmd_str )
+
+	msg := agent_msg{}				// build response to send back
+	msg.Ctype = "response"
+	msg.Rtype = cmd_type
+	msg.Rid = act.Aid
+	msg.Vinfo = version
+	msg.State = 0
+
+	ssh_rch := make( chan *ssh_broker.Broker_msg, 256 )					// do NOT close the channel here; only senders should close
+	err = broker.NBRun_cmd( act.Hosts[0], cmd_str, 0, ssh_rch )
+	if err != nil {
+		sheep.Baa( 1, "WRN: error submitting probe command  to %s: %s", act.Hosts[0], err )
+		msg.State = 1
+		jout, _ = json.Marshal( msg )
+		return
+	}
+
+	rdata := make( []string, 8192 )
+	edata := make( []string, 8192 )
+	ridx := 0
+	select {
+		case <- time.After( (timeout + time.Duration( window )) * time.Second ):
+			sheep.Baa( 1, "WRN: timeout waiting for response from %s; cmd: %s", act.Hosts[0], cmd_str )
+			msg.State = 1
+
+		case resp := <- ssh_rch:
+			stdout, stderr, _, err := resp.Get_results()
+			host, _, _ := resp.Get_info()
+			eidx := buf_into_array( stderr, edata, 0 )
+			msg.Edata = edata[0:eidx]
+			if err != nil {
+				msg.State = 1
+				sheep.Baa( 1, "WRN: error running command: host=%s: %s", host, err )
+			} else {
+				ridx = buf_into_array( stdout, rdata, ridx )
+			}
+			if err != nil || sheep.Would_baa( 2 ) {
+				dump_stderr( stderr, "fmod_probe " + host )
+			}
+	}
+
+	msg.Rdata = make( []string, 0, ridx )
+	for _, r := range rdata[0:ridx] {
+		if r != "" {
+			msg.Rdata = append( msg.Rdata, act.Hosts[0] + " " + r )
+		}
+	}
+
+	if msg.State > 0 {
+		sheep.Baa( 0, "ERR: %s unable to execute: %s	[TGUAGN000]", cmd_type, cmd_str )
+	} else {
+		sheep.Baa( 1, "fmod_probe cmd (%s) successful: %v", cmd_type, msg.Rdata )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Verify a bandwidth reservation: count the traffic the VM sends, that matched by the
+	reservation's outbound flow-mod and that leaving it marked. Like the probe this blocks for
+	the window and runs on the diag lane; records are prefixed with the host.
+ */
+func (act *json_action ) do_res_verify( cmd_type string, broker *ssh_broker.Broker, path *string, timeout time.Duration ) ( jout []byte, err error ) {
+	pstr := ""
+	if path != nil {
+		pstr = fmt.Sprintf( "PATH=%s:$PATH ", *path )		// path to add if needed
+	}
+
+	parms := act.Data
+	window, _ := strconv.Atoi( parms["window"] )
+	cmd_str := fmt.Sprintf( `%sql_res_verify `, pstr ) +
+			build_opt( parms["resid"], "-i" ) +
+			build_opt( parms["smac"], "-s" ) +
+			build_opt( parms["dmac"], "-d" ) +
+			build_opt( parms["dscp"], "-q" ) +
+			build_opt( parms["sproto"],  "-p" ) +
+			build_opt( parms["dproto"],  "-P" ) +
+			build_opt( parms["ipv6"], "-6" ) +
+			build_opt( parms["padj"], "-A" ) +
+			build_opt( parms["window"], "-w" )
+
+	sheep.Baa( 1, "via broker on %s: %s", act.Hosts[0], cmd_str )
+
+	msg := agent_msg{}				// build response to send back
+	msg.Ctype = "response"
+	msg.Rtype = cmd_type
+	msg.Rid = act.Aid
+	msg.Vinfo = version
+	msg.State = 0
+
+	ssh_rch := make( chan *ssh_broker.Broker_msg, 256 )					// do NOT close the channel here; only senders should close
+	err = broker.NBRun_cmd( act.Hosts[0], cmd_str, 0, ssh_rch )
+	if err != nil {
+		sheep.Baa( 1, "WRN: error submitting verify command to %s: %s", act.Hosts[0], err )
+		msg.State = 1
+		jout, _ = json.Marshal( msg )
+		return
+	}
+
+	rdata := make( []string, 8192 )
+	edata := make( []string, 8192 )
+	ridx := 0
+	select {
+		case <- time.After( (timeout + time.Duration( window )) * time.Second ):
+			sheep.Baa( 1, "WRN: timeout waiting for response from %s; cmd: %s", act.Hosts[0], cmd_str )
+			msg.State = 1
+
+		case resp := <- ssh_rch:
+			stdout, stderr, _, err := resp.Get_results()
+			host, _, _ := resp.Get_info()
+			eidx := buf_into_array( stderr, edata, 0 )
+			msg.Edata = edata[0:eidx]
+			if err != nil {
+				msg.State = 1
+				sheep.Baa( 1, "WRN: error running command: host=%s: %s", host, err )
+			} else {
+				ridx = buf_into_array( stdout, rdata, ridx )
+			}
+			if err != nil || sheep.Would_baa( 2 ) {
+				dump_stderr( stderr, "res_verify " + host )
+			}
+	}
+
+	msg.Rdata = make( []string, 0, ridx )
+	for _, r := range rdata[0:ridx] {
+		if r != "" {
+			msg.Rdata = append( msg.Rdata, act.Hosts[0] + " " + r )
+		}
+	}
+
+	if msg.State > 0 {
+		sheep.Baa( 0, "ERR: %s unable to execute: %s	[TGUAGN000]", cmd_type, cmd_str )
+	} else {
+		sheep.Baa( 1, "res_verify cmd (%s) successful: %v", cmd_type, msg.Rdata )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Report the bytes counted by the outbound bandwidth flow-mods of the reservations given
+	in Fdata (id,smac,dmac each). Each record in the response is prefixed with the host as
+	is done for fmod_probe.
+ */
+func (act *json_action ) do_fmod_bytes( cmd_type string, broker *ssh_broker.Broker, path *string, timeout time.Duration ) ( jout []byte, err error ) {
+	pstr := ""
+	if path != nil {
+		pstr = fmt.Sprintf( "PATH=%s:$PATH ", *path )		// path to add if needed
+	}
+
+	cmd_str := fmt.Sprintf( `%sql_fmod_bytes `, pstr )
+	for _, r := range act.Fdata {
+		cmd_str += build_opt( r, "" )
+	}
+
+	sheep.Baa( 2, "via broker on %s: %s", act.Hosts[0], cmd_str )
+
+	msg := agent_msg{}				// build response to send back
+	msg.Ctype = "response"
+	msg.Rtype = cmd_type
+	msg.Rid = act.Aid
+	msg.Vinfo = version
+	msg.State = 0
+
+	ssh_rch := make( chan *ssh_broker.Broker_msg, 256 )					// do NOT close the channel here; only senders should close
+	err = broker.NBRun_cmd( act.Hosts[0], cmd_str, 0, ssh_rch )
+	if err != nil {
+		sheep.Baa( 1, "WRN: error submitting byte count command to %s: %s", act.Hosts[0], err )
+		msg.State = 1
+		jout, _ = json.Marshal( msg )
+		return
+	}
+
+	rdata := make( []string, 8192 )
+	edata := make( []string, 8192 )
+	ridx := 0
+	select {
+		case <- time.After( timeout * time.Second ):
+			sheep.Baa( 1, "WRN: timeout waiting for response from %s; cmd: %s", act.Hosts[0], cmd_str )
+			msg.State = 1
+
+		case resp := <- ssh_rch:
+			stdout, stderr, _, err := resp.Get_results()
+			host, _, _ := resp.Get_info()
+			eidx := buf_into_array( stderr, edata, 0 )
+			msg.Edata = edata[0:eidx]
+			if err != nil {
+				msg.State = 1
+				sheep.Baa( 1, "WRN: error running command: host=%s: %s", host, err )
+			} else {
+				ridx = buf_into_array( stdout, rdata, ridx )
+			}
+			if err != nil || sheep.Would_baa( 2 ) {
+				dump_stderr( stderr, "fmod_bytes " + host )
+			}
+	}
+
+	msg.Rdata = make( []string, 0, ridx )
+	for _, r := range rdata[0:ridx] {
+		if r != "" {
+			msg.Rdata = append( msg.Rdata, act.Hosts[0] + " " + r )
+		}
+	}
+
+	if msg.State > 0 {
+		sheep.Baa( 0, "ERR: %s unable to execute: %s	[TGUAGN000]", cmd_type, cmd_str )
+	} else {
+		sheep.Baa( 2, "fmod_bytes cmd (%s) successful: %v", cmd_type, msg.Rdata )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Report the bytes counted by the outbound bandwidth flow-mods, and the drops of the queue,
+	of the reservations given in Fdata (id,smac,dmac,queue each). Each record in the response
+	is prefixed with the host as is done for fmod_bytes.
+ */
+func (act *json_action ) do_sla_stats( cmd_type string, broker *ssh_broker.Broker, path *string, timeout time.Duration ) ( jout []byte, err error ) {
+	pstr := ""
+	if path != nil {
+		pstr = fmt.Sprintf( "PATH=%s:$PATH ", *path )		// path to add if needed
+	}
+
+	cmd_str := fmt.Sprintf( `%sql_sla_stats `, pstr )
+	for _, r := range act.Fdata {
+		cmd_str += build_opt( r, "" )
+	}
+
+	sheep.Baa( 2, "via broker on %s: %s", act.Hosts[0], cmd_str )
+
+	msg := agent_msg{}				// build response to send back
+	msg.Ctype = "response"
+	msg.Rtype = cmd_type
+	msg.Rid = act.Aid
+	msg.Vinfo = version
+	msg.State = 0
+
+	ssh_rch := make( chan *ssh_broker.Broker_msg, 256 )					// do NOT close the channel here; only senders should close
+	err = broker.NBRun_cmd( act.Hosts[0], cmd_str, 0, ssh_rch )
+	if err != nil {
+		sheep.Baa( 1, "WRN: error submitting sla stats command to %s: %s", act.Hosts[0], err )
+		msg.State = 1
+		jout, _ = json.Marshal( msg )
+		return
+	}
+
+	rdata := make( []string, 8192 )
+	edata := make( []string, 8192 )
+	ridx := 0
+	select {
+		case <- time.After( timeout * time.Second ):
+			sheep.Baa( 1, "WRN: timeout waiting for response from %s; cmd: %s", act.Hosts[0], cmd_str )
+			msg.State = 1
+
+		case resp := <- ssh_rch:
+			stdout, stderr, _, err := resp.Get_results()
+			host, _, _ := resp.Get_info()
+			eidx := buf_into_array( stderr, edata, 0 )
+			msg.Edata = edata[0:eidx]
+			if err != nil {
+				msg.State = 1
+				sheep.Baa( 1, "WRN: error running command: host=%s: %s", host, err )
+			} else {
+				ridx = buf_into_array( stdout, rdata, ridx )
+			}
+			if err != nil || sheep.Would_baa( 2 ) {
+				dump_stderr( stderr, "sla_stats " + host )
+			}
+	}
+
+	msg.Rdata = make( []string, 0, ridx )
+	for _, r := range rdata[0:ridx] {
+		if r != "" {
+			msg.Rdata = append( msg.Rdata, act.Hosts[0] + " " + r )
+		}
+	}
+
+	if msg.State > 0 {
+		sheep.Baa( 0, "ERR: %s unable to execute: %s	[TGUAGN000]", cmd_type, cmd_str )
+	} else {
+		sheep.Baa( 2, "sla_stats cmd (%s) successful: %v", cmd_type, msg.Rdata )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
 /*
 	Passthrough flow-mods allow DSCP markings set by the VM to pass through the priority 10
 	catch all flow-mod which marks down traffic without a reservation. 
@@ -464,7 +939,7 @@ func (act *json_action ) do_pass_fmod( cmd_type string, broker *ssh_broker.Broke
 			build_opt( parms["timeout"],  "-t" )
 
 
-	sheep.Baa( 1, "via broker on %s: %s", act.Hosts[0], cmd_str )
+	sheep.Baa( 1, "via broker on %s: cid=%s %s", act.Hosts[0], act.Data["cid"], cmd_str )
 
 	msg := agent_msg{}				// build response to send back
 	msg.Ctype = "response"
@@ -597,6 +1072,124 @@ func do_map_mac2phost( req json_action, broker *ssh_broker.Broker, path *string,
 	return
 }
 
+/*
+	Count the flow table entries on br-int on each host listed. Like map_mac2phost the command
+	is submitted to the broker for all hosts at once and we wait up to timeout seconds for the
+	results. Each record in the response is "host count"; hosts which fail or don't respond
+	in time are omitted.
+*/
+func do_flow_count( req json_action, broker *ssh_broker.Broker, timeout time.Duration ) ( jout []byte, err error ) {
+	cmd_str := "sudo ovs-ofctl dump-aggregate br-int"
+	ssh_rch := make( chan *ssh_broker.Broker_msg, len( req.Hosts ) )
+
+	wait4 := 0
+	for k := range req.Hosts {
+		err := broker.NBRun_cmd( req.Hosts[k], cmd_str, wait4, ssh_rch )
+		if err != nil {
+			msg_007( req.Hosts[k], cmd_str, err )
+		} else {
+			wait4++
+		}
+	}
+
+	msg := agent_msg{}
+	msg.Ctype = "response"
+	msg.Rtype = "flow_count"
+	msg.Vinfo = version
+	msg.State = 0
+	msg.Rdata = make( []string, 0, wait4 )
+
+	timer_pop := false
+	for wait4 > 0 && !timer_pop {
+		select {
+			case <- time.After( timeout * time.Second ):
+				msg_008( wait4 )
+				timer_pop = true
+
+			case resp := <- ssh_rch:
+				wait4--
+				stdout, stderr, _, err := resp.Get_results()
+				host, _, _ := resp.Get_info()
+				if err != nil {
+					msg_009( "flow_count", host )
+					dump_stderr( stderr, "flow_count" + host )
+					continue
+				}
+
+				out := stdout.Bytes()
+				if i := bytes.Index( out, []byte( "flow_count=" ) ); i >= 0 {
+					n := 0
+					if _, serr := fmt.Sscanf( string( out[i+11:] ), "%d", &n ); serr == nil {
+						msg.Rdata = append( msg.Rdata, fmt.Sprintf( "%s %d", host, n ) )
+					}
+				}
+		}
+	}
+
+	sheep.Baa( 1, "flow_count: timeout=%v %d hosts %d counts", timer_pop, len( req.Hosts ), len( msg.Rdata ) )
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Run ql_ovs_inventory on each host listed and return the records generated (host kind name ...)
+	so that tegu can learn link capacities. Submitted to the broker for all hosts at once; hosts
+	which fail or don't respond within timeout seconds are omitted.
+*/
+func do_ovs_inventory( req json_action, broker *ssh_broker.Broker, path *string, timeout time.Duration ) ( jout []byte, err error ) {
+	ssh_rch := make( chan *ssh_broker.Broker_msg, len( req.Hosts ) )		// do NOT close this channel, only senders should close
+
+	wait4 := 0
+	for k, v := range req.Hosts {
+		cmd_str := fmt.Sprintf( "PATH=%s:$PATH ql_ovs_inventory -p %s", *path, v )
+		err := broker.NBRun_cmd( req.Hosts[k], cmd_str, wait4, ssh_rch )
+		if err != nil {
+			msg_007( req.Hosts[k], cmd_str, err )
+		} else {
+			wait4++
+		}
+	}
+
+	msg := agent_msg{}
+	msg.Ctype = "response"
+	msg.Rtype = "ovs_inventory"
+	msg.Vinfo = version
+	msg.State = 0
+
+	rdata := make( []string, 8192 )
+	ridx := 0
+
+	timer_pop := false
+	errcount := 0
+	for wait4 > 0 && !timer_pop {
+		select {
+			case <- time.After( timeout * time.Second ):
+				msg_008( wait4 )
+				timer_pop = true
+
+			case resp := <- ssh_rch:
+				wait4--
+				stdout, stderr, _, err := resp.Get_results()
+				host, _, _ := resp.Get_info()
+				if err != nil {
+					msg_009( "ovs_inventory", host )
+					errcount++
+				} else {
+					ridx = buf_into_array( stdout, rdata, ridx )
+				}
+				if err != nil || sheep.Would_baa( 2 ) {
+					dump_stderr( stderr, "ovs_inventory" + host )
+				}
+		}
+	}
+
+	msg.Rdata = rdata[0:ridx]
+	sheep.Baa( 1, "ovs_inventory: timeout=%v %d hosts %d errors %d records", timer_pop, len( req.Hosts ), errcount, len( msg.Rdata ) )
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
 /*
 	Executes the setup_ovs_intermed script on each host listed. This command can take
 	a significant amount of time on each host (10s of seconds) and so we submit the
@@ -655,6 +1248,59 @@ func do_intermedq( req json_action, broker *ssh_broker.Broker, path *string, tim
 	running_sim = false
 }
 
+/*
+	Executes ql_remark_fmods on each host listed to set the default remark flow-mods on the
+	bridges given (Dscps holds bridge:tos pairs), and to remove them from any bridge listed
+	in the del data. Like intermedq, the command is submitted for every host and then the
+	results are collected; nothing is returned to tegu.
+*/
+func do_remark( req json_action, broker *ssh_broker.Broker, path *string, timeout time.Duration ) {
+	startt := time.Now().Unix()
+
+	ssh_rch := make( chan *ssh_broker.Broker_msg, len( req.Hosts ) )		// do NOT close the channel here; only senders should close
+
+	cmd_str := fmt.Sprintf( `PATH=%s:$PATH ql_remark_fmods `, *path ) +
+			build_opt( req.Data["timeout"], "-t" ) +
+			build_opt( req.Data["del"], "-X" ) +
+			req.Dscps
+
+	wait4 := 0
+	for i := range req.Hosts {
+		sheep.Baa( 1, "via broker on %s: %s", req.Hosts[i], cmd_str )
+
+		err := broker.NBRun_cmd( req.Hosts[i], cmd_str, wait4, ssh_rch )
+		if err != nil {
+			msg_007( req.Hosts[i], cmd_str, err )
+		} else {
+			wait4++
+		}
+	}
+
+	timer_pop := false
+	errcount := 0
+	for wait4 > 0 && !timer_pop {
+		select {
+			case <- time.After( timeout * time.Second ):
+				msg_008( wait4 )
+				timer_pop = true
+
+			case resp := <- ssh_rch:
+				wait4--
+				_, stderr, _, err := resp.Get_results()
+				host, _, _ := resp.Get_info()
+				if err != nil {
+					msg_009( "remark", host )
+					errcount++
+				}
+				if err != nil || sheep.Would_baa( 2 ) {
+					dump_stderr( stderr, "remark " + host )
+				}
+		}
+	}
+
+	sheep.Baa( 1, "remark: timeout=%v %ds elapsed for %d hosts %d errors", timer_pop, time.Now().Unix() - startt, len( req.Hosts ), errcount )
+}
+
 /*
 	Execute a create_ovs_queues for each host in the list. The create queues script is unique inasmuch
 	as it expects an input file that is supplied either as a filename as $1, or on stdin if $1 is omitted.
@@ -665,13 +1311,16 @@ func do_intermedq( req json_action, broker *ssh_broker.Broker, path *string, tim
 		endKat
 
 	We'll use the brokers 'send script for execution' feature rather to execute our script.
+
+	When tegu gives the generation of the queue map (qgen) it wants to know how each host fared.  The
+	data is then saved on the host so that, once applied, ql_check_queues can compare the OVS QoS state
+	with it. A response is returned with one record per host: host qgen ok|fail [reason]. Without qgen
+	nothing is returned (older tegu).
 */
-func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, timeout time.Duration ) {
-    var (
-        err error
-    )
+func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, timeout time.Duration ) ( jout []byte, err error ) {
 
 	startt := time.Now().Unix()
+	qgen := req.Data["qgen"]
 
     fname := fmt.Sprintf( "/tmp/tegu_setq_%d_%x_%02d.data", os.Getpid(), time.Now().Unix(), rand.Intn( 10 ) )
     sheep.Baa( 3, "adjusting queues: creating %s will contain %d items", fname, len( req.Qdata ) );
@@ -682,12 +1331,19 @@ func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, tim
         return
     }
 
-	fmt.Fprintf( f, "#!/usr/bin/env ksh\ncat <<endKat | PATH=%s:$PATH create_ovs_queues\n", *path )
+	if qgen == "" {
+		fmt.Fprintf( f, "#!/usr/bin/env ksh\ncat <<endKat | PATH=%s:$PATH create_ovs_queues\n", *path )
+	} else {
+		fmt.Fprintf( f, "#!/usr/bin/env ksh\nPATH=%s:$PATH\ncat <<endKat >/tmp/tegu_setq.$$\n", *path )
+	}
     for i := range req.Qdata {
         sheep.Baa( 3, "writing queue info: %s", req.Qdata[i] )
         fmt.Fprintf( f, "%s\n", req.Qdata[i] )
     }
 	fmt.Fprintf( f, "endKat\n" )
+	if qgen != "" {												// apply then verify; the exit code of the pair is the host's result
+		fmt.Fprintf( f, "create_ovs_queues </tmp/tegu_setq.$$ && ql_check_queues </tmp/tegu_setq.$$\nrc=$?\nrm -f /tmp/tegu_setq.$$\nexit $rc\n" )
+	}
 
     err = f.Close( )
     if err != nil {
@@ -698,6 +1354,7 @@ func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, tim
 	ssh_rch := make( chan *ssh_broker.Broker_msg, 256 )		// channel for ssh results
 															// do NOT close the channel here; only senders should close
 
+	results := make( map[string]string, len( req.Hosts ) )	// result for each host when tegu wants them
 	wait4 := 0												// number of responses to wait for
 	for i := range req.Hosts {
     	sheep.Baa( 1, "via broker on %s: create_ovs_queues embedded in %s", req.Hosts[i], fname )
@@ -705,6 +1362,7 @@ func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, tim
 		err := broker.NBRun_on_host( req.Hosts[i], fname, "", wait4, ssh_rch )		// sends the file as input to be executed on the host
 		if err != nil {
 			msg_007( req.Hosts[i], "create_ovs_queues", err )
+			results[req.Hosts[i]] = "fail unable to run script: " + err.Error()
 		} else {
 			wait4++
 		}
@@ -726,8 +1384,17 @@ func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, tim
 				if err != nil {
         			sheep.Baa( 0, "ERR: unable to execute set queue command on %s: data=%s: %s  [TGUAGN004]", host, fname, err )
 					errcount++
+					reason := strings.TrimSpace( stderr.String() )
+					if n := strings.LastIndex( reason, "\n" ); n >= 0 {
+						reason = reason[n+1:]						// last message is most likely the one that matters
+					}
+					if reason == "" {
+						reason = err.Error()
+					}
+					results[host] = "fail " + reason
 				}  else {
         			sheep.Baa( 1, "queues adjusted succesfully on: %s", host )
+					results[host] = "ok"
 				}
 				if err != nil || sheep.Would_baa( 2 ) {
 					dump_stderr( stderr, "create-q" + host )			// always dump on error, or if chatty
@@ -741,9 +1408,27 @@ func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, tim
 	if errcount == 0 {							// ditch the script we built earlier if all successful
 		os.Remove( fname )
 	} else {
-		sheep.Baa( 1, "create-q: %d errors, generated script file kept: %s", fname )
+		sheep.Baa( 1, "create-q: %d errors, generated script file kept: %s", errcount, fname )
 	}
 
+	if qgen == "" {
+		return
+	}
+
+	msg := agent_msg{ Ctype: "response", Rtype: req.Atype, Rid: req.Aid, Vinfo: version }
+	for _, h := range req.Hosts {
+		r := results[h]
+		if r == "" {
+			r = "fail no response from host before timeout"
+		}
+		if r != "ok" {
+			msg.State = 1
+		}
+		msg.Rdata = append( msg.Rdata, h + " " + qgen + " " + r )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
 }
 
 /*
@@ -859,15 +1544,150 @@ func do_mirrorwiz( req json_action, broker *ssh_broker.Broker, path *string ) (
 }
 
 /*
-	Unpacks the json blob into the generic json request structure and validates that the ctype
-	is one of the expected types.  The only supported ctype at the moment is action_list; this
-	function will then split out the actions and invoke the proper do_* function to
-	execute the action.
+	Execute one action and return the response to send to tegu (nil if none).
+	Called from the lane goroutines.
+*/
+func run_action( act json_action, broker *ssh_broker.Broker, path *string ) ( resp []byte ) {
+	switch( act.Atype ) {
+		case "setqueues":								// set queues; results returned when tegu gives the map generation
+				p, err := do_setqueues( act, broker, path, 30 )
+				if err == nil {
+					resp = p
+				}
+
+		case "flowmod":									// set a flow mod
+				do_fmod( act, broker, path, 30 )
+
+		case "map_mac2phost":							// run script to generate mac to physical host mappings
+				if ! running_sim {												// it's not good to start overlapping setup scripts
+					p, err := do_map_mac2phost( act, broker, path, 30 )
+					if err == nil {
+						resp = p
+					}
+				} else {
+					sheep.Baa( 1, "run action: mac2phost periodic run blocked: setqueues still running" )
+				}
+
+		case "intermed_queues":													// setup intermediate queues
+				if ! running_sim {												// it's not good to start overlapping setup scripts
+					do_intermedq(  act, broker, path, 3600 )					// runs on the slow lane so it can block
+				} else {
+					sheep.Baa( 1, "run action: setqueues still running, not restarted" )
+				}
+
+		case "remark":									// default remark flow-mods
+				do_remark( act, broker, path, 300 )						// slow lane; blocks until all hosts respond
+
+		case "flow_count":								// count flows on each host's integration bridge
+				p, err := do_flow_count( act, broker, 30 )
+				if err == nil {
+					resp = p
+				}
+
+		case "ovs_inventory":							// bridges, bonds and nic speeds on each host
+				p, err := do_ovs_inventory( act, broker, path, 30 )
+				if err == nil {
+					resp = p
+				}
+
+		case "fmod_probe":								// count packets matched, and missed, by a reservation's flow-mods
+				p, err := act.do_fmod_probe( act.Atype, broker, path, 15 )
+				if err == nil {
+					resp = p
+				}
+
+		case "res_verify":								// rate and marking of a reservation's traffic
+				p, err := act.do_res_verify( act.Atype, broker, path, 15 )
+				if err == nil {
+					resp = p
+				}
+
+		case "fmod_bytes":								// bytes sent by reservations' flow-mods (bulk transfers)
+				p, err := act.do_fmod_bytes( act.Atype, broker, path, 15 )
+				if err == nil {
+					resp = p
+				}
+
+		case "sla_stats":								// bytes and queue drops of reservations (sla breach detection)
+				p, err := act.do_sla_stats( act.Atype, broker, path, 15 )
+				if err == nil {
+					resp = p
+				}
+
+		case "mirrorwiz":
+				p, err := do_mirrorwiz( act, broker, path )
+				if err == nil {
+					resp = p
+				}
+
+		case "bw_fmod":									// new bandwidth flow-mod
+				p, err := act.do_bw_fmod( act.Atype, broker, path, 15 )
+				if err == nil {
+					resp = p
+				}
+
+		case "bwow_fmod":									// generate oneway bandwidth flow-mods
+				p, err := act.do_bwow_fmod( act.Atype, broker, path, 15 )
+				if err == nil {
+					resp = p
+				}
+
+		case "mcast_fmod":									// generate multicast flow-mods for one switch of the tree
+				p, err := act.do_mcast_fmod( act.Atype, broker, path, 15 )
+				if err == nil {
+					resp = p
+				}
+
+		case "passthru":									// generate flow-mods for a passthrough reservation
+				p, err := act.do_pass_fmod( act.Atype, broker, path, 15 )
+				if err == nil {
+					resp = p
+				}
+	}
+
+	return
+}
+
+/*
+	Return the lane for the action. Tegu may name the lane; if it doesn't, or names one
+	we don't have, our table is used. Empty string is returned for an unsupported action.
+*/
+func lane_of( act *json_action ) ( string ) {
+	lane := action_lanes[act.Atype]
+	if lane == "" {
+		return ""
+	}
+
+	if act.Lane != "" {
+		for _, l := range lane_names {
+			if l == act.Lane {
+				return l
+			}
+		}
+	}
+
+	return lane
+}
+
+/*
+	Lane goroutine: execute actions from the lane's queue in order and write any response
+	back on the session the request arrived on.
+*/
+func run_lane( name string, lch chan *lane_req, smgr *connman.Cmgr, broker *ssh_broker.Broker, path *string ) {
+	sheep.Baa( 1, "%s lane started", name )
+	for r := range lch {
+		if p := run_action( r.act, broker, path ); p != nil {
+			smgr.Write( r.sid, gizmos.Zwrap( zenc, p, zmin ) )
+		}
+	}
+}
 
-	Returns a list of responses that should be written back to tegu, or nil if none of the
-	requests produced responses.
+/*
+	Parse the json and dispatch each action to its lane. Responses which can be generated
+	immediately (hello, unsupported actions) are returned and should be written back to tegu;
+	responses from the actions themselves are written by the lane goroutines.
 */
-func handle_blob( jblob []byte, broker *ssh_broker.Broker, path *string ) ( resp [][]byte ) {
+func handle_blob( jblob []byte, lanes map[string]chan *lane_req, sid string ) ( resp [][]byte ) {
 	var (
 		req	json_request		// unpacked request struct
 		ridx int = 0
@@ -875,76 +1695,70 @@ func handle_blob( jblob []byte, broker *ssh_broker.Broker, path *string ) ( resp
 
 	resp = make( [][]byte, 128 )
 
-    err := json.Unmarshal( jblob, &req )           // unpack the json
+	ublob, err := gizmos.Zunwrap( jblob )			// uncompress if it's a compression frame
+	if err == nil {
+    	err = json.Unmarshal( ublob, &req )           // unpack the json
+	}
 	if err != nil {
 		sheep.Baa( 0, "ERR: unable to unpack request: %s	[TGUAGN006]", err )
 		sheep.Baa( 0, "got: %s", jblob )
 		return
 	}
 
+	if req.Ctype == "hello" {
+		sheep.Baa( 1, "hello from tegu: protocol version %d; we speak %d", req.Pver, pver )
+		zenc = ""
+		if ! no_compress {
+			zenc = gizmos.Zselect( req.Zenc )
+		}
+		if zenc != "" {
+			sheep.Baa( 1, "session with tegu will be compressed with %s", zenc )
+		}
+		supported := make( []string, 0, len( action_lanes ) )
+		for atype := range action_lanes {
+			supported = append( supported, atype )
+		}
+		msg := agent_msg{ Ctype: "hello", Pver: pver, Rdata: supported, Vinfo: version, Zenc: zenc, Host: my_host }
+		if jout, err := json.Marshal( msg ); err == nil {
+			resp[ridx] = jout
+			resp = resp[0:1]
+		} else {
+			resp = nil
+		}
+		return
+	}
+
 	if req.Ctype != "action_list" {
 		sheep.Baa( 0, "unknown request type received from tegu: %s", req.Ctype )
 		return
 	}
 
 	for i := range req.Actions {
-		switch( req.Actions[i].Atype ) {
-			case "setqueues":								// set queues
-					do_setqueues( req.Actions[i], broker, path, 30 )
-
-			case "flowmod":									// set a flow mod
-					do_fmod( req.Actions[i], broker, path, 30 )
-
-			case "map_mac2phost":							// run script to generate mac to physical host mappings
-					if ! running_sim {												// it's not good to start overlapping setup scripts
-						p, err := do_map_mac2phost( req.Actions[i], broker, path, 30 )
-						if err == nil {
-							resp[ridx] = p
-							ridx++
-						}
-					} else {
-						sheep.Baa( 1, "handle blob: mac2phost periodic run blocked: setqueues still running" )
-					}
-
-			case "intermed_queues":													// setup intermediate queues
-					if ! running_sim {												// it's not good to start overlapping setup scripts
-						go do_intermedq(  req.Actions[i], broker, path, 3600 )		// this can run asynch since there isn't any output
-					} else {
-						sheep.Baa( 1, "handle blob: setqueues still running, not restarted" )
-					}
-
-			case "mirrorwiz":
-					p, err := do_mirrorwiz(req.Actions[i], broker, path)
-					if err == nil {
-						resp[ridx] = p
-						ridx++
-					}
-
-			case "bw_fmod":									// new bandwidth flow-mod
-					p, err := req.Actions[i].do_bw_fmod( req.Actions[i].Atype, broker, path, 15 )
-					if err == nil {
-						resp[ridx] = p
-						ridx++
-					}
-
-			case "bwow_fmod":									// generate oneway bandwidth flow-mods
-					p, err := req.Actions[i].do_bwow_fmod( req.Actions[i].Atype, broker, path, 15 )
-					if err == nil {
-						resp[ridx] = p
-						ridx++
-					}
-
-			case "passthru":									// generate flow-mods for a passthrough reservation
-					p, err := req.Actions[i].do_pass_fmod( req.Actions[i].Atype, broker, path, 15 )
-					if err == nil {
-						resp[ridx] = p
-						ridx++
-					}
-
+		act := &req.Actions[i]
+		edata := ""
+		lane := ""
+		if err := gizmos.Vet_action( act.Atype, act.Hosts, act.Data, act.Fdata, act.Qdata, act.Dscps ); err != nil {
+			msg_010( err )										// tegu vets before sending, but we don't trust what arrives on the wire
+			edata = fmt.Sprintf( "action refused: %s", err )
+		} else {
+			if lane = lane_of( act ); lane == "" {
+				sheep.Baa( 0, "unknown action type received from tegu: %s", act.Atype )
+				edata = "unsupported action: " + act.Atype
+			}
+		}
 
-			default:
-				sheep.Baa( 0, "unknown action type received from tegu: %s", req.Actions[i].Atype )
+		if edata != "" {
+			msg := agent_msg{ Ctype: "response", Rtype: act.Atype, Rid: act.Aid, Vinfo: version, State: 2 }
+			msg.Edata = []string{ edata }
+			if p, err := json.Marshal( msg ); err == nil && ridx < len( resp ) {
+				resp[ridx] = p
+				ridx++
+			}
+			continue
 		}
+
+		sheep.Baa( 2, "%s action queued on %s lane (%d waiting)", req.Actions[i].Atype, lane, len( lanes[lane] ) )
+		lanes[lane] <- &lane_req{ act: req.Actions[i], sid: sid }
 	}
 
 	if ridx > 0 {
@@ -959,7 +1773,7 @@ func handle_blob( jblob []byte, broker *ssh_broker.Broker, path *string ) ( resp
 
 func usage( version string ) {
 	fmt.Fprintf( os.Stdout, "tegu_agent %s\n", version )
-	fmt.Fprintf( os.Stdout, "usage: tegu_agent -i id [-h host:port] [-l log-dir] [-p n] [-v | -V level] [-k key] [-no-rsync] [-rdir dir] [-rlist list] [-u user]\n" )
+	fmt.Fprintf( os.Stdout, "usage: tegu_agent -i id [-h host:port] [-l log-dir] [-p n] [-v | -V level] [-k key] [-no-rsync] [-no-compress] [-host name] [-rdir dir] [-rlist list] [-u user]\n" )
 }
 
 func main() {
@@ -979,7 +1793,14 @@ func main() {
 			"/usr/bin/tegu_del_mirror " +
 			"/usr/bin/ql_bw_fmods " +
 			"/usr/bin/ql_bwow_fmods " +
+			"/usr/bin/ql_mcast_fmods " +
+			"/usr/bin/ql_fmod_probe " +
+			"/usr/bin/ql_fmod_bytes " +
+			"/usr/bin/ql_res_verify " +
+			"/usr/bin/ql_sla_stats " +
 			"/usr/bin/ql_pass_fmods " +
+			"/usr/bin/ql_remark_fmods " +
+			"/usr/bin/ql_ovs_inventory " +
 			"/usr/bin/ql_set_trunks " +
 			"/usr/bin/ql_filter_rtr " +
 			"/usr/bin/setup_ovs_intermed "
@@ -995,6 +1816,8 @@ func main() {
 	log_dir := flag.String( "l", "stderr", "log_dir" )
 	parallel := flag.Int( "p", 10, "parallel ssh commands" )
 	no_rsync := flag.Bool( "no-rsync", false, "turn off rsync" )
+	no_zip := flag.Bool( "no-compress", false, "refuse session compression" )
+	host_name := flag.String( "host", "", "host name given to tegu" )
 	rdir := flag.String( "rdir", def_rdir, "rsync remote directory" )
 	rlist := flag.String( "rlist", def_rlist, "rsync file list" )
 	tegu_host := flag.String( "h", "localhost:29055", "tegu_host:port" )
@@ -1007,6 +1830,11 @@ func main() {
 		usage( version )
 		os.Exit( 0 )
 	}
+	no_compress = *no_zip
+	my_host = *host_name
+	if my_host == "" {
+		my_host, _ = os.Hostname()
+	}
 
 	if *id <= 0 {
 		fmt.Fprintf( os.Stderr, "ERR: must enter -i id (number) on command line\n" )
@@ -1066,6 +1894,12 @@ func main() {
 	sheep.Baa( 1, "successfully created ssh_broker for user: %s, command path: %s", *user, *rdir )
 	broker.Start_initiators( *parallel )
 
+	lanes := make( map[string]chan *lane_req, len( lane_names ) )
+	for _, l := range lane_names {
+		lanes[l] = make( chan *lane_req, 1024 )
+		go run_lane( l, lanes[l], smgr, broker, rdir )
+	}
+
 
 	for {
 		select {									// wait on input from any channel -- just one now, but who knows
@@ -1086,10 +1920,10 @@ func main() {
 						jc.Add_bytes( sreq.Buf )
 						jblob := jc.Get_blob()		// get next blob if ready
 						for ; jblob != nil ; {
-							resp := handle_blob( jblob, broker, rdir )
+							resp := handle_blob( jblob, lanes, sreq.Id )
 							if resp != nil {
 								for i := range resp {
-									smgr.Write( sreq.Id, resp[i] )
+									smgr.Write( sreq.Id, gizmos.Zwrap( zenc, resp[i], zmin ) )
 								}
 							}
 
@@ -37,6 +37,35 @@
 					100 bytes.
 				17 Jun 2105 : Added oneway reservation support.
 				16 Nov 2105 : Handle response from remote mirror agents
+				16 Oct 2026 : Added the agent command log (see agent_log.go) and the agentlog request.
+				16 Oct 2026 : Commands are vetted for shell meta characters before they are sent.
+				16 Oct 2026 : Added protocol version negotiation (see agent_proto.go).
+				16 Oct 2026 : Added optional compression of the agent session (agent:compress).
+				16 Oct 2026 : Agents with lanes are not reserved as the long running agent.
+				16 Oct 2026 : Work that can't be delivered is held and replayed when an agent connects
+					(see agent_pending.go); mac2phost/intermedq are sent if the host list arrives after agents.
+				16 Oct 2026 : A reconnecting agent causes reservations on its host to be pushed again.
+				16 Oct 2026 : Added the mock agent used in simulation mode (see agent_sim.go).
+				16 Oct 2026 : Flow table counts from agents are passed to fq-manager.
+				16 Oct 2026 : A change to the priority dscp list is sent to all hosts immediately.
+				16 Oct 2026 : Intermediate queues can be set up on demand for named hosts.
+				16 Oct 2026 : Nat match probe results are passed to fq-manager.
+				16 Oct 2026 : Default remark flow-mods for traffic without a reservation (agent_remark.go).
+				16 Oct 2026 : Periodic ovs inventory request; results passed to network manager.
+				16 Oct 2026 : Work no agent supports is held too; degraded state while no agent is connected
+					and the agentstatus request (see agent_pending.go).
+				16 Oct 2026 : Send functions return an error when nothing was written; actions that
+					are neither sent nor held are reported as dropped to res-mgr.
+				16 Oct 2026 : Flow-mod byte counts (bulk transfers) are passed to fq-manager.
+				16 Oct 2026 : Reservation verification counts are passed to fq-manager.
+				16 Oct 2026 : Reservation bytes and queue drops (sla) are passed to fq-manager.
+				16 Oct 2026 : Writes go through the ConnManager interface; the session manager is made by new_connman (seams.go).
+				16 Oct 2026 : Setqueues results are passed to fq-mgr.
+				16 Oct 2026 : Disruptive actions are held for their host group's window (agent_window.go).
+				16 Oct 2026 : Actions are vetted one at a time (gizmos.Vet_action); those refused are reported failed
+								and the rest are sent.
+				16 Oct 2026 : Requests are logged with their correlation id.
+				16 Oct 2026 : Periodic work reports when it can not be scheduled.
 */
 
 package managers
@@ -46,12 +75,15 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/att/gopkgs/bleater"
 	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/config"
 	"github.com/att/gopkgs/connman"
 	"github.com/att/gopkgs/ipc"
 	"github.com/att/gopkgs/jsontools"
+	"github.com/att/tegu/gizmos"
 )
 
 // ----- structs used to bundle into json commands
@@ -64,10 +96,12 @@ type action struct {			// specific action
 	Dscps	string				// space separated list of dscp values
 	Fdata	[]string			// flowmod command data
 	Qdata	[]string			// queue parms
+	Lane	string				// agent lane to execute on (version 2 agents)
 }
 
 type agent_cmd struct {			// overall command
 	Ctype	string
+	Pver	int					// protocol version the command is formatted for
 	Actions []action
 }
 
@@ -77,14 +111,24 @@ type agent_cmd struct {			// overall command
 type agent struct {
 	id		string
 	jcache	*jsontools.Jsoncache				// buffered input resulting in 'records' that are complete json blobs
+	pver	int									// protocol version the agent speaks (0 until it responds to hello)
+	actions	map[string]bool						// action types the agent supports; nil for legacy agents
+	zenc	string								// compression encoding agreed in hello; empty if none
+	host	string								// host the agent serves (hello response)
+	sim		*sim_agent							// mock agent (simulation mode); nil for real agents
 }
 
 type agent_data struct {
 	agents	map[string]*agent					// hash for direct index (based on ID string given to the session)
 	agent_list []*agent							// sequential index into map that allows easier round robin access for sendone
 	aidx	int									// next spot in index for round robin sends
+	zoffer	[]string							// compression encodings offered to agents in hello (none if empty)
+	zmin	int									// messages smaller than this are not compressed
+	windows	*action_windows						// windows for disruptive actions; nil if not limited (agent_window.go)
 }
 
+var agent_cmdlog *cmd_log						// log of commands sent to agents; only the agent manager goroutine references
+
 /*
 	Generic struct to unpack json received from an agent
 */
@@ -96,6 +140,49 @@ type agent_msg struct {
 	State	int				// if an ack/nack some state information
 	Vinfo	string			// agent version (debugging mostly)
 	Rid		uint32			// original request id
+	Pver	int				// protocol version (hello response)
+	Zenc	string			// compression encoding selected by the agent (hello response)
+	Host	string			// host the agent serves (hello response)
+}
+
+/*
+	Vet the actions of an agent command (gizmos.Vet_action; the agent applies the same check).
+	The command is returned without the actions which were refused, or empty if none are left.
+	Refused actions are logged and reported to res-mgr as failed so that their reservations
+	don't look as though they were pushed; the error is that of the last action refused.
+*/
+func vet_agent_cmd( jstr string ) ( string, error ) {
+	msg := &agent_cmd{}
+	if err := json.Unmarshal( []byte( jstr ), msg ); err != nil {
+		return "", err
+	}
+
+	var verr error
+	keep := make( []action, 0, len( msg.Actions ) )
+	for i := range msg.Actions {
+		a := &msg.Actions[i]
+		if err := gizmos.Vet_action( a.Atype, a.Hosts, a.Data, a.Fdata, a.Qdata, a.Dscps ); err != nil {
+			am_sheep.Baa( 0, "ERR: agent action not sent: %s  [TGUAGT008]", err )
+			agent_cmdlog.refused( a, err )
+			verr = err
+			continue
+		}
+		keep = append( keep, *a )
+	}
+
+	if verr == nil {
+		return jstr, nil
+	}
+	if len( keep ) == 0 {
+		return "", verr
+	}
+
+	msg.Actions = keep
+	jout, err := json.Marshal( msg )
+	if err != nil {
+		return "", err
+	}
+	return string( jout ), verr
 }
 
 /*
@@ -131,19 +218,26 @@ func (ad *agent_data) Mk_agent( aid string ) ( na *agent ) {
 }
 
 /*
-	Send the message to one agent. The agent is selected using the current
-	index in the agent_data so that it effectively does a round robin.
+	Write a message to the agent, compressing it if an encoding was agreed.
 */
-func (ad *agent_data) send2one( smgr *connman.Cmgr,  msg string ) {
-	l := len( ad.agents )
-	if l <= 0 {
+func (ad *agent_data) write( smgr ConnManager, a *agent, msg []byte ) {
+	if a.sim != nil {
+		a.sim.exec( msg )
 		return
 	}
 
-	smgr.Write( ad.agent_list[ad.aidx].id, []byte( msg ) )
+	smgr.Write( a.id, gizmos.Zwrap( a.zenc, msg, ad.zmin ) )
+}
+
+/*
+	Advance the round robin index. The long running agent (head of the list) is skipped
+	unless it has lanes.
+*/
+func (ad *agent_data) bump_idx( ) {
+	l := len( ad.agent_list )
 	ad.aidx++
 	if ad.aidx >= l {
-		if l > 1 {
+		if l > 1 && ! ad.agent_list[0].has_lanes() {
 			ad.aidx = 1		// skip the long running agent if more than one agent connected
 		} else {
 			ad.aidx = 0
@@ -153,36 +247,79 @@ func (ad *agent_data) send2one( smgr *connman.Cmgr,  msg string ) {
 
 /*
 	Send the message to one agent. The agent is selected using the current
-	index in the agent_data so that it effectively does a round robin.
+	index in the agent_data so that it effectively does a round robin. Agents
+	which do not support all of the actions in the message are skipped and the
+	message is translated to the selected agent's protocol version.
+	The id of the agent written to is returned; if no agent is connected, or
+	none could accept the message, the id is empty and an error is returned.
 */
-func (ad *agent_data) sendbytes2one( smgr *connman.Cmgr,  msg []byte ) {
+func (ad *agent_data) send2one( smgr ConnManager,  msg string ) ( id string, err error ) {
 	l := len( ad.agents )
 	if l <= 0 {
-		return
+		return "", mk_err( ERR_AGENT_DOWN, "no agents are connected" )
 	}
 
-	smgr.Write( ad.agent_list[ad.aidx].id,  msg )
-	ad.aidx++
-	if ad.aidx >= l {
-		if l > 1 {
-			ad.aidx = 1		// skip the long running agent if more than one agent connected
-		} else {
-			ad.aidx = 0
+	cmd := &agent_cmd{}
+	if err := json.Unmarshal( []byte( msg ), cmd ); err != nil {		// not something we can vet; send as is
+		id = ad.agent_list[ad.aidx].id
+		ad.write( smgr, ad.agent_list[ad.aidx], []byte( msg ) )
+		ad.bump_idx()
+		return id, nil
+	}
+
+	atype := ""
+	for i := 0; i < l; i++ {
+		a := ad.agent_list[ad.aidx]
+		ad.bump_idx()
+		if atype = a.unsupported( cmd ); atype == "" {
+			jmsg, err := a.xlate( cmd )
+			if err != nil {
+				am_sheep.Baa( 0, "ERR: unable to translate command for agent %s: %s  [TGUAGT009]", a.id, err )
+				return "", mk_err( ERR_INTERNAL, "unable to translate command for agent %s: %s", a.id, err )
+			}
+			ad.write( smgr, a, jmsg )
+			return a.id, nil
 		}
 	}
+
+	if a := ad.agent_list[0]; l > 1 && a.unsupported( cmd ) == "" {		// round robin skips the long running agent; use it as a last resort
+		if jmsg, err := a.xlate( cmd ); err == nil {
+			ad.write( smgr, a, jmsg )
+			return a.id, nil
+		}
+	}
+
+	am_sheep.Baa( 0, "ERR: command not sent: no connected agent supports the %s action  [TGUAGT009]", atype )
+	return "", mk_err( ERR_AGENT_DOWN, "no connected agent supports the %s action", atype )
+}
+
+/*
+	Send the message to one agent. The agent is selected using the current
+	index in the agent_data so that it effectively does a round robin.
+*/
+func (ad *agent_data) sendbytes2one( smgr ConnManager,  msg []byte ) {
+	l := len( ad.agents )
+	if l <= 0 {
+		return
+	}
+
+	ad.write( smgr, ad.agent_list[ad.aidx],  msg )
+	ad.bump_idx()
 }
 /*
 	Send the message to the designated 'long running' agent (lra); the
 	agent that has been designated to handle all long running tasks
 	that are not time sensitive (such as intermediate queue setup/checking).
 */
-func (ad *agent_data) sendbytes2lra( smgr *connman.Cmgr,  msg []byte ) {
+func (ad *agent_data) sendbytes2lra( smgr ConnManager,  msg []byte ) ( id string ) {
 	l := len( ad.agents )
 	if l <= 0 {
 		return
 	}
 
-	smgr.Write( ad.agent_list[0].id,  msg )
+	id = ad.agent_list[0].id
+	ad.write( smgr, ad.agent_list[0],  msg )
+	return
 }
 
 /*
@@ -190,23 +327,52 @@ func (ad *agent_data) sendbytes2lra( smgr *connman.Cmgr,  msg []byte ) {
 	agent that has been designated to handle all long running tasks
 	that are not time sensitive (such as intermediate queue setup/checking).
 */
-func (ad *agent_data) send2lra( smgr *connman.Cmgr,  msg string ) {
+func (ad *agent_data) send2lra( smgr ConnManager,  msg string ) {
 	l := len( ad.agents )
 	if l <= 0 {
 		return
 	}
 
-	smgr.Write( ad.agent_list[0].id,  []byte( msg ) )
+	ad.write( smgr, ad.agent_list[0],  []byte( msg ) )
 }
 
 /*
-	Send the message to all agents.
+	Send the message to all agents. The number of agents written to is returned along
+	with an error if there were none.
 */
-func (ad *agent_data) send2all( smgr *connman.Cmgr,  msg string ) {
+func (ad *agent_data) send2all( smgr ConnManager,  msg string ) ( n int, err error ) {
 	am_sheep.Baa( 2, "sending %d bytes", len( msg ) )
-	for id := range ad.agents {
-		smgr.Write( id, []byte( msg ) )
+
+	cmd := &agent_cmd{}
+	if err := json.Unmarshal( []byte( msg ), cmd ); err != nil {
+		cmd = nil
 	}
+
+	for id, a := range ad.agents {
+		if cmd == nil {
+			ad.write( smgr, a, []byte( msg ) )
+			n++
+			continue
+		}
+
+		if atype := a.unsupported( cmd ); atype != "" {
+			am_sheep.Baa( 1, "WRN: command not sent to agent %s: %s action is not supported  [TGUAGT010]", id, atype )
+			continue
+		}
+		if jmsg, err := a.xlate( cmd ); err == nil {
+			ad.write( smgr, a, jmsg )
+			n++
+		}
+	}
+
+	switch {
+		case len( ad.agents ) == 0:
+			err = mk_err( ERR_AGENT_DOWN, "no agents are connected" )
+
+		case n == 0:
+			err = mk_err( ERR_AGENT_DOWN, "no connected agent supports the command" )
+	}
+	return n, err
 }
 
 /*
@@ -224,15 +390,24 @@ func ( a *agent ) process_input( buf []byte ) {
 	a.jcache.Add_bytes( buf )
 	jblob := a.jcache.Get_blob()						// get next blob if ready
 	for ; jblob != nil ; {
-    	err := json.Unmarshal( jblob, &req )           // unpack the json
+		ublob, err := gizmos.Zunwrap( jblob )			// uncompress if it's a compression frame
+		if err == nil {
+    		err = json.Unmarshal( ublob, &req )           // unpack the json
+		}
 
 		if err != nil {
 			am_sheep.Baa( 0, "ERR: unable to unpack agent_message: %s  [TGUAGT000]", err )
 			am_sheep.Baa( 2, "offending json: %s", string( buf ) )
 		} else {
 			am_sheep.Baa( 1, "%s/%s received from agent", req.Ctype, req.Rtype )
+			if req.Ctype == "response" {
+				agent_cmdlog.outcome( req.Rid, req.State )
+			}
 
 			switch( req.Ctype ) {					// "command type"
+				case "hello":						// response to our hello; version and supported actions
+					a.hello( &req )
+
 				case "response":					// response to a request
 					if req.State == 0 {
 						switch( req.Rtype ) {
@@ -240,6 +415,34 @@ func ( a *agent ) process_input( buf []byte ) {
 								msg := ipc.Mk_chmsg( )
 								msg.Send_req( nw_ch, nil, REQ_MAC2PHOST, req.Rdata, nil )		// send into network manager -- we don't expect response
 
+							case "flow_count":
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_FLOWTAB_COUNTS, req.Rdata, nil )	// fq-manager reconciles its flow table estimates
+
+							case "fmod_probe":
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_NAT_PROBE_RESULT, req.Rdata, nil )	// fq-manager evaluates nat match probes
+
+							case "res_verify":
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_VERIFY_RESULT, req.Rdata, nil )		// fq-manager evaluates reservation verifications
+
+							case "fmod_bytes":
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_BULK_BYTES, req.Rdata, nil )			// fq-manager turns counts into bulk transfer progress
+
+							case "sla_stats":
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_SLA_STATS, req.Rdata, nil )			// fq-manager turns counts into rates for sla checks
+
+							case "ovs_inventory":
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( nw_ch, nil, REQ_OVS_INVENTORY, req.Rdata, nil )		// network learns link capacities
+
+							case "setqueues":
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_QUEUE_RESULT, req.Rdata, nil )		// fq-manager tracks queue application by host
+
 							case "mirrorwiz":
 								// Stuff the response back in the mirror object - quick and dirty and probably not "right"
 								save_mirror_response( req.Rdata, req.Edata )
@@ -261,6 +464,10 @@ func ( a *agent ) process_input( buf []byte ) {
 									am_sheep.Baa( 1, "  [%d] %s", i, req.Rdata[i] )
 								}
 
+							case "setqueues":										// per host failures are in the data; fq-mgr retries them
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_QUEUE_RESULT, req.Rdata, nil )
+
 							default:
 								am_sheep.Baa( 1, "WRN: response messages for failed command were not interpreted: %s  [TGUAGT002]", req.Rtype )
 								for i := 0; i < len( req.Rdata ) && i < 20; i++ {
@@ -285,7 +492,7 @@ func ( a *agent ) process_input( buf []byte ) {
 /*
 	Build a request to have the agent generate a mac to phost list and send it to one agent.
 */
-func (ad *agent_data) send_mac2phost( smgr *connman.Cmgr, hlist *string ) {
+func (ad *agent_data) send_mac2phost( smgr ConnManager, hlist *string ) {
 	if hlist == nil || *hlist == "" {
 		am_sheep.Baa( 2, "no host list, cannot request mac2phost" )
 		return
@@ -307,21 +514,50 @@ func (ad *agent_data) send_mac2phost( smgr *connman.Cmgr, hlist *string ) {
 	msg.Actions = make( []action, 1 )
 	msg.Actions[0].Atype = "map_mac2phost"
 	msg.Actions[0].Hosts = strings.Split( *hlist, " " )
+	recs := agent_cmdlog.stamp( msg )
 	jmsg, err := json.Marshal( msg )			// bundle into a json string
 
 	if err == nil {
 		am_sheep.Baa( 3, "sending mac2phost request: %s", jmsg )
-		ad.sendbytes2lra( smgr, jmsg )						// send as a long running request
+		agent_cmdlog.sent( recs, ad.sendbytes2lra( smgr, jmsg ) )		// send as a long running request
 	} else {
 		am_sheep.Baa( 1, "WRN: unable to bundle mac2phost request into json: %s  [TGUAGT004]", err )
 		am_sheep.Baa( 2, "offending json: %s", jmsg )
 	}
 }
 
+/*
+	Build a request for the ovs inventory (bridges, bonds, nic speeds) of each host in the list.
+	The results are given to network manager which learns link capacities from them.
+*/
+func (ad *agent_data) send_inventory( smgr ConnManager, hlist *string ) {
+	if hlist == nil || *hlist == "" {
+		return
+	}
+
+	msg := &agent_cmd{ Ctype: "action_list" }
+	msg.Actions = make( []action, 1 )
+	msg.Actions[0].Atype = "ovs_inventory"
+	msg.Actions[0].Hosts = strings.Split( *hlist, " " )
+	if ad.windows.gate( msg, time.Now().Unix() ); len( msg.Actions ) == 0 {
+		return
+	}
+
+	recs := agent_cmdlog.stamp( msg )
+	jmsg, err := json.Marshal( msg )
+	if err == nil {
+		am_sheep.Baa( 2, "sending ovs inventory request: %s", *hlist )
+		agent_cmdlog.sent( recs, ad.sendbytes2lra( smgr, jmsg ) )
+	} else {
+		am_sheep.Baa( 1, "WRN: unable to bundle ovs inventory request into json: %s  [TGUAGT018]", err )
+	}
+}
+
 /*
 	Build a request to cause the agent to drive the setting of queues and fmods on intermediate bridges.
+	The number of hosts held for their action window is returned.
 */
-func (ad *agent_data) send_intermedq( smgr *connman.Cmgr, hlist *string, dscp *string ) {
+func (ad *agent_data) send_intermedq( smgr ConnManager, hlist *string, dscp *string ) ( nheld int ) {
 	if hlist == nil || *hlist == "" {
 		return
 	}
@@ -331,15 +567,21 @@ func (ad *agent_data) send_intermedq( smgr *connman.Cmgr, hlist *string, dscp *s
 	msg.Actions[0].Atype = "intermed_queues"
 	msg.Actions[0].Hosts = strings.Split( *hlist, " " )
 	msg.Actions[0].Dscps = *dscp
+	if nheld = ad.windows.gate( msg, time.Now().Unix() ); len( msg.Actions ) == 0 {
+		return
+	}
 
+	recs := agent_cmdlog.stamp( msg )
 	jmsg, err := json.Marshal( msg )			// bundle into a json string
 
 	if err == nil {
 		am_sheep.Baa( 1, "sending intermediate queue setup request: hosts=%s dscp=%s", *hlist, *dscp )
-		ad.sendbytes2lra( smgr, jmsg )						// send as a long running request
+		agent_cmdlog.sent( recs, ad.sendbytes2lra( smgr, jmsg ) )		// send as a long running request
 	} else {
 		am_sheep.Baa( 0, "WRN: creating json intermedq command failed: %s  [TGUAGT005]", err )
 	}
+
+	return
 }
 
 // ---------------- utility ------------------------------------------------------------------------
@@ -363,6 +605,70 @@ func shift_values( list string ) ( new_list string ) {
 	return
 }
 
+/*
+	Vet a list of dscp values (space or comma separated) and return it space separated.
+	Each value must be between 0 and 63.
+*/
+func vet_dscp_list( list string ) ( string, error ) {
+	toks := strings.Fields( strings.Replace( list, ",", " ", -1 ) )
+	if len( toks ) == 0 {
+		return "", fmt.Errorf( "empty dscp list" )
+	}
+
+	for i := range toks {
+		n := clike.Atoi( toks[i] )
+		if n < 0 || n > 63 || fmt.Sprintf( "%d", n ) != toks[i] {
+			return "", fmt.Errorf( "invalid dscp value: %s (must be 0-63)", toks[i] )
+		}
+	}
+
+	return strings.Join( toks, " " ), nil
+}
+
+/*
+	Map the names given to hosts in the list of known hosts (space separated). A name matches
+	a known host if it is the same or is the known host without its domain. Returns the
+	matching hosts and the names that didn't match.
+*/
+func match_hosts( names []string, known string ) ( found []string, unknown []string ) {
+	klist := strings.Fields( known )
+	for _, n := range names {
+		matched := false
+		for _, k := range klist {
+			if k == n || strings.HasPrefix( k, n + "." ) {
+				found = append( found, k )
+				matched = true
+				break
+			}
+		}
+		if ! matched {
+			unknown = append( unknown, n )
+		}
+	}
+
+	return
+}
+
+/*
+	Read the priority dscp list from the configuration file again.
+*/
+func reread_pri_dscp( ) ( string, error ) {
+	if cfg_file == "" {
+		return "", fmt.Errorf( "no configuration file to read" )
+	}
+
+	cdata, err := config.Parse2strs( nil, cfg_file )
+	if err != nil {
+		return "", fmt.Errorf( "unable to parse config file %s: %s", cfg_file, err )
+	}
+
+	if cdata["default"] == nil || cdata["default"]["pri_dscp"] == nil {
+		return "", fmt.Errorf( "pri_dscp is not set in %s", cfg_file )
+	}
+
+	return *cdata["default"]["pri_dscp"], nil
+}
+
 // ---------------- main agent goroutine -----------------------------------------------------------
 
 func Agent_mgr( ach chan *ipc.Chmsg ) {
@@ -373,9 +679,16 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 		dscp_list string = "46 26 18"				// list of dscp values that are used to promote a packet to the pri queue in intermed switches
 		refresh int64 = 60
 		iqrefresh int64 = 1800							// intermediate queue refresh (this can take a long time, keep from clogging the works)
+		inv_refresh int64 = 900							// ovs inventory (link capacity learning); 0 disables
+		cmd_log_fname string = "/var/lib/tegu/agent_cmds.log"
+		cmd_log_size int64 = 10 * 1024 * 1024
+		cmd_log_recent int = 2048
+		pending_max_age int64 = 300
+		pending_max int = 4096
+		pending_host_max int = 512
 	)
 
-	adata = &agent_data{}
+	adata = &agent_data{ zmin: 1024 }
 	adata.agents = make( map[string]*agent )
 
 	am_sheep = bleater.Mk_bleater( 0, os.Stderr )		// allocate our bleater and attach it to the master
@@ -393,6 +706,33 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 		if p := cfg_data["agent"]["refresh"]; p != nil {
 			refresh = int64( clike.Atoi( *p ) )
 		}
+		if p := cfg_data["agent"]["cmd_log"]; p != nil {
+			cmd_log_fname = *p
+		}
+		if p := cfg_data["agent"]["cmd_log_size"]; p != nil {
+			cmd_log_size = clike.Atoi64( *p )
+		}
+		if p := cfg_data["agent"]["cmd_log_recent"]; p != nil {
+			cmd_log_recent = clike.Atoi( *p )
+		}
+		if p := cfg_data["agent"]["compress"]; p != nil {				// space separated encodings in order of preference
+			adata.zoffer = strings.Fields( *p )
+		}
+		if p := cfg_data["agent"]["compress_min"]; p != nil {
+			adata.zmin = clike.Atoi( *p )
+		}
+		if p := cfg_data["agent"]["pending_max_age"]; p != nil {
+			pending_max_age = clike.Atoi64( *p )
+		}
+		if p := cfg_data["agent"]["pending_max"]; p != nil {
+			pending_max = clike.Atoi( *p )
+		}
+		if p := cfg_data["agent"]["pending_host_max"]; p != nil {
+			pending_host_max = clike.Atoi( *p )
+		}
+		if p := cfg_data["agent"]["inventory"]; p != nil {
+			inv_refresh = clike.Atoi64( *p )
+		}
 		if p := cfg_data["agent"]["iqrefresh"]; p != nil {
 			iqrefresh = int64( clike.Atoi( *p ) )
 			if iqrefresh < 1800 {
@@ -411,6 +751,10 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 	}
 
 	dscp_list = shift_values( dscp_list )				// must shift values before giving to agent
+	agent_cmdlog = mk_cmd_log( cmd_log_fname, cmd_log_size, cmd_log_recent )
+	remark := mk_remark_policy( )
+	pending := mk_pending( pending_max_age, pending_max, pending_host_max )
+	adata.windows = mk_action_windows( )
 
 														// enforce some sanity on config file settings
 	am_sheep.Baa( 1,  "agent_mgr thread started: listening on port %s", port )
@@ -419,9 +763,26 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 	tklr.Add_spot( 10, ach, REQ_INTERMEDQ, nil, 1 );		  			// tickle once, very soon, to start an intermediate refresh asap
 	tklr.Add_spot( refresh, ach, REQ_MAC2PHOST, nil, ipc.FOREVER );  	// reocurring tickle to get host mapping
 	tklr.Add_spot( iqrefresh, ach, REQ_INTERMEDQ, nil, ipc.FOREVER );  	// reocurring tickle to ensure intermediate switches are properly set
+	add_spot( tklr, am_sheep, "TGUAGT021", "remark refresh", remark.refresh, ach, REQ_REMARK, ipc.FOREVER )	// refresh remark flow-mods before their hard timeout pops
+	if adata.windows != nil {
+		add_spot( tklr, am_sheep, "TGUAGT021", "action windows", 60, ach, REQ_AGENT_WINDOW, ipc.FOREVER )			// send held actions when their window opens
+	}
+	if inv_refresh > 0 {
+		add_spot( tklr, am_sheep, "TGUAGT021", "ovs inventory", 30, ach, REQ_OVS_INVENTORY, 1 )					// learn link capacities soon after start
+		add_spot( tklr, am_sheep, "TGUAGT021", "ovs inventory", inv_refresh, ach, REQ_OVS_INVENTORY, ipc.FOREVER )
+	}
 
 	sess_chan := make( chan *connman.Sess_data, 1024 )					// channel for comm from agents (buffers, disconns, etc)
-	smgr := connman.NewManager( port, sess_chan );
+	smgr := new_connman( port, sess_chan )								// session manager (seams.go)
+
+	if sim_net != nil {													// simulation: a mock agent stands in for the real ones
+		a := adata.Mk_agent( SIM_AGENT_ID )
+		a.pver = agent_pver
+		a.host = "sim"
+		a.sim = mk_sim_agent( a.id, sim_net.cmd_log, sess_chan )
+		am_sheep.Baa( 1, "simulation: mock agent added; commands are recorded in %s", sim_net.cmd_log )
+	}
+	pending.agents_changed( len( adata.agents ) )							// degraded until the first agent connects
 
 
 	for {
@@ -429,24 +790,83 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 			case req := <- ach:
 				req.State = nil				// nil state is OK, no error
 
-				am_sheep.Baa( 3, "processing request %d", req.Msg_type )
+				baa_req( am_sheep, req )
 
 				switch req.Msg_type {
 					case REQ_NOOP:						// just ignore -- acts like a ping if there is a return channel
 
 					case REQ_SENDALL:					// send request to all agents
 						if req.Req_data != nil {
-							adata.send2all( smgr,  req.Req_data.( string ) )
+							cstr, verr := vet_agent_cmd( req.Req_data.( string ) )		// refused actions are reported failed and removed
+							if cstr != "" {
+								cstr = adata.windows.gate_json( cstr, time.Now().Unix() )		// hosts outside their action window are held
+							}
+							if cstr != "" {
+								jstr, recs := agent_cmdlog.stamp_json( cstr )
+								if _, req.State = adata.send2all( smgr,  jstr ); req.State == nil {
+									agent_cmdlog.sent( recs, "all" )
+								} else {
+									agent_cmdlog.unsent( recs, pending.add_json( cstr ) )
+								}
+							}
+							if req.State == nil {
+								req.State = verr
+							}
 						}
 
-					case REQ_SENDLONG:					// send a long request to one agent
+					case REQ_SENDLONG, REQ_SENDSHORT:	// send a request to one agent (round robin)
 						if req.Req_data != nil {
-							adata.send2one( smgr,  req.Req_data.( string ) )
+							cstr, verr := vet_agent_cmd( req.Req_data.( string ) )
+							if cstr != "" {
+								cstr = adata.windows.gate_json( cstr, time.Now().Unix() )
+							}
+							if cstr != "" {
+								jstr, recs := agent_cmdlog.stamp_json( cstr )
+								var aid string
+								if aid, req.State = adata.send2one( smgr,  jstr ); req.State == nil {
+									agent_cmdlog.sent( recs, aid )
+								} else {											// no agent, or none that supports it; hold until one connects
+									agent_cmdlog.unsent( recs, pending.add_json( cstr ) )
+								}
+							}
+							if req.State == nil {
+								req.State = verr
+							}
 						}
 
-					case REQ_SENDSHORT:					// send a short request to one agent (round robin)
+					case REQ_AGENT_WINDOW:				// tickle: send held actions whose window has opened
+						req.Response_ch = nil
+						for _, msg := range adata.windows.due( time.Now().Unix() ) {
+							recs := agent_cmdlog.stamp( msg )
+							if jmsg, err := json.Marshal( msg ); err == nil {
+								agent_cmdlog.sent( recs, adata.sendbytes2lra( smgr, jmsg ) )		// these are the long running actions
+							}
+						}
+
+					case REQ_AGENT_REPLAY:				// send pending work now that an agent is connected
+						if len( adata.agents ) > 0 {
+							for _, cstr := range pending.replay() {
+								jstr, recs := agent_cmdlog.stamp_json( cstr )
+								if aid, err := adata.send2one( smgr,  jstr ); err == nil {
+									agent_cmdlog.sent( recs, aid )
+								} else {
+									agent_cmdlog.unsent( recs, []error{ err } )			// replayed actions aren't held again
+								}
+							}
+						}
+
+					case REQ_AGENT_STATUS:				// connected agents, degraded state and pending work
+						req.Response_data = pending.to_json( len( adata.agents ), adata.windows.to_json() )
+
+					case REQ_AGENT_PVER:				// lowest protocol version of the connected agents
+						req.Response_data = adata.min_pver( )
+
+					case REQ_AGENT_LOG:					// generate a list of recent commands; data is resid, cid, host, count
 						if req.Req_data != nil {
-							adata.send2one( smgr,  req.Req_data.( string ) )
+							parms := req.Req_data.( []string )
+							req.Response_data = agent_cmdlog.to_json( parms[0], parms[1], parms[2], clike.Atoi( parms[3] ) )
+						} else {
+							req.Response_data = agent_cmdlog.to_json( "", "", "", 0 )
 						}
 
 					case REQ_MAC2PHOST:					// send a request for agent to generate  mac to phost map
@@ -456,15 +876,114 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 
 					case REQ_CHOSTLIST:					// a host list from fq-manager
 						if req.Req_data != nil {
+							first := host_list == ""
 							host_list = *(req.Req_data.( *string ))
+							if first && host_list != "" && len( adata.agents ) > 0 {		// agents connected before we had a list didn't get these
+								adata.send_mac2phost( smgr, &host_list )
+								adata.send_intermedq( smgr, &host_list, &dscp_list )
+								adata.send_remark( smgr, &host_list, remark )
+							}
 						}
 
-					case REQ_INTERMEDQ:
-						req.Response_ch = nil
-						if host_list != "" {
+					case REQ_INTERMEDQ:					// nil data (tickle) is all hosts; else a space separated list of hosts and a response is expected
+						if req.Req_data == nil {
+							req.Response_ch = nil
+							if host_list != "" {
+								adata.send_intermedq( smgr, &host_list, &dscp_list )
+							}
+							break
+						}
+
+						names := strings.Fields( strings.Replace( *(req.Req_data.( *string )), ",", " ", -1 ) )
+						if len( names ) == 0 {
+							if host_list == "" {
+								req.State = mk_err( ERR_AGENT_DOWN, "host list is not yet known" )
+								break
+							}
+							names = strings.Fields( host_list )
+						}
+						found, unknown := match_hosts( names, host_list )
+						if len( unknown ) > 0 {
+							req.State = mk_err( ERR_NOT_FOUND, "unknown host(s): %s", strings.Join( unknown, " " ) )
+							break
+						}
+
+						hosts := strings.Join( found, " " )
+						am_sheep.Baa( 1, "intermediate queue setup requested for: %s", hosts )
+						if n := adata.send_intermedq( smgr, &hosts, &dscp_list ); n > 0 {
+							req.Response_data = fmt.Sprintf( "%s (%d held until their action window opens)", hosts, n )
+						} else {
+							req.Response_data = hosts
+						}
+
+					case REQ_SET_PRIDSCP:				// new priority dscp list; nil or empty data causes it to be read from the config file
+						var err error
+						list := ""
+						if req.Req_data != nil {
+							list = *(req.Req_data.( *string ))
+						}
+						if list == "" {
+							list, err = reread_pri_dscp( )
+						}
+						if err == nil {
+							list, err = vet_dscp_list( list )
+						}
+						if err != nil {
+							am_sheep.Baa( 1, "WRN: priority dscp list not changed: %s  [TGUAGT014]", err )
+							req.State = err
+							break
+						}
+
+						req.Response_data = list
+						shifted := shift_values( list )
+						if shifted == dscp_list {
+							am_sheep.Baa( 1, "dscp priority list unchanged: %s", list )
+							break
+						}
+
+						dscp_list = shifted
+						am_sheep.Baa( 1, "dscp priority list changed to: %s", list )
+						if host_list != "" {						// don't wait for the refresh tickle
 							adata.send_intermedq( smgr, &host_list, &dscp_list )
 						}
 
+					case REQ_OVS_INVENTORY:				// tickle
+						req.Response_ch = nil
+						adata.send_inventory( smgr, &host_list )
+
+					case REQ_REMARK:					// refresh tickle
+						req.Response_ch = nil
+						adata.send_remark( smgr, &host_list, remark )
+
+					case REQ_SET_REMARK:				// new remark policy; "off" clears it, nil or empty rereads the config file
+						var err error
+						list := ""
+						if req.Req_data != nil {
+							list = *(req.Req_data.( *string ))
+						}
+						if list == "" {
+							list, err = reread_remark( )
+						}
+						if list == "off" {
+							list = ""
+						}
+
+						var bridges map[string]int
+						if err == nil {
+							bridges, err = parse_remark( list )
+						}
+						if err != nil {
+							am_sheep.Baa( 1, "WRN: remark policy not changed: %s  [TGUAGT017]", err )
+							req.State = mk_err( ERR_BAD_REQUEST, "%s", err )
+							break
+						}
+
+						if remark.set( bridges ) {
+							am_sheep.Baa( 1, "remark policy changed to: %s", remark )
+							adata.send_remark( smgr, &host_list, remark )		// don't wait for the refresh tickle
+						}
+						req.Response_data = remark.String()
+
 				}
 
 				am_sheep.Baa( 3, "processing request finished %d", req.Msg_type )			// we seem to wedge in network, this will be chatty, but may help
@@ -480,19 +999,33 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 					case connman.ST_NEW:			// new connection
 						a := adata.Mk_agent( sreq.Id )
 						am_sheep.Baa( 1, "new agent: %s [%s]", a.id, sreq.Data )
+						pending.agents_changed( len( adata.agents ) )
+						smgr.Write( a.id, mk_hello( adata.zoffer ) )					// legacy agents ignore this and remain at version 0
+						add_spot( tklr, am_sheep, "TGUAGT021", "pending work replay", 3, ach, REQ_AGENT_REPLAY, 1 )				// replay pending work once the hello has had a chance to complete
 						if host_list != "" {											// immediate request for this
 							adata.send_mac2phost( smgr, &host_list )
 							adata.send_intermedq( smgr, &host_list, &dscp_list )
+							adata.send_remark( smgr, &host_list, remark )
 						}
 
 					case connman.ST_DISC:
 						am_sheep.Baa( 1, "agent dropped: %s", sreq.Id )
+						acts, sent := agent_cmdlog.unacked( sreq.Id, pending_max_age )		// work it didn't finish is given to the next agent
+						for i := range acts {
+							if pending.add( acts[i], sent[i] ) != nil {
+								agent_cmdlog.dropped( acts[i] )
+							}
+						}
+						if len( acts ) > 0 {
+							add_spot( tklr, am_sheep, "TGUAGT021", "pending work replay", 1, ach, REQ_AGENT_REPLAY, 1 )
+						}
 						if _, not_nil := adata.agents[sreq.Id]; not_nil {
 							delete( adata.agents, sreq.Id )
 						} else {
 							am_sheep.Baa( 1, "did not find an agent with the id: %s", sreq.Id )
 						}
 						adata.build_list()			// rebuild the list to drop the agent
+						pending.agents_changed( len( adata.agents ) )
 
 					case connman.ST_DATA:
 						if _, not_nil := adata.agents[sreq.Id]; not_nil {
@@ -0,0 +1,486 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	agent_log
+	Abstract:	Command log for agent requests. Every action sent to an agent is given an
+				action id (Aid) and is recorded with the agent it was written to, the time,
+				and the outcome once the agent responds. Records are appended to a file
+				(one json blob per line) which is rolled to <name>.old when it grows beyond
+				the configured size, and the most recent records are kept in memory so that
+				they can be listed (agentlog API request) by reservation or host.
+
+				The log is referenced only from the agent manager goroutine and so is not
+				locked.
+
+	CFG:		agent:cmd_log - file name for the log (/var/lib/tegu/agent_cmds.log); "off" disables
+				agent:cmd_log_size - max size of the file in bytes before it is rolled (10485760)
+				agent:cmd_log_recent - number of records kept in memory (2048)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Added unacked() so work sent to an agent that drops can be replayed.
+				16 Oct 2026 - Bandwidth flow-mod sends and outcomes are reported to res-mgr (res_mgr_fmstat.go).
+				16 Oct 2026 - Multicast flow-mods are reported too.
+				16 Oct 2026 - Actions that could be neither sent nor held are logged and reported as dropped.
+				16 Oct 2026 - Steering flow-mods and mirrors are reported too.
+				16 Oct 2026 - The steering flow-mod key is built from the flow-mod string as pushed.
+				16 Oct 2026 - Actions refused by vetting are logged and reported as refused.
+*/
+
+package managers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	A single logged action.
+*/
+type cmd_rec struct {
+	Aid		uint32
+	Agent	string				// agent id the command was written to; "all" for broadcasts, "none" if no agents
+	Ts		int64
+	Atype	string
+	Hosts	[]string
+	Resid	string				// reservation id from the action data if there
+	Cid		string				// correlation id from the action data if there
+	Outcome	string				// sent, ok, failed (state), unsent (held for replay) or dropped
+	Cmd		string				// the action as sent
+	fmkey	string				// identifies the flow-mods of a bandwidth action; empty for others (not logged)
+}
+
+type cmd_log struct {
+	fname	string
+	maxsize	int64
+	size	int64
+	f		*os.File
+	recent	[]*cmd_rec			// ring of recent records
+	ridx	int					// next insert point in recent
+	byaid	map[uint32]*cmd_rec	// recent records awaiting an outcome
+	next_aid uint32
+}
+
+/*
+	Create the log and load the recent list from the existing file if there is one.
+*/
+func mk_cmd_log( fname string, maxsize int64, nrecent int ) ( cl *cmd_log ) {
+	if nrecent < 16 {
+		nrecent = 16
+	}
+
+	cl = &cmd_log {
+		fname:		fname,
+		maxsize:	maxsize,
+		recent:		make( []*cmd_rec, nrecent ),
+		byaid:		make( map[uint32]*cmd_rec ),
+		next_aid:	uint32( time.Now().Unix() & 0xffff ) << 16,		// reduce chance of reusing ids from before a restart
+	}
+
+	if fname == "" || fname == "off" {
+		return
+	}
+
+	if f, err := os.Open( fname ); err == nil {
+		scanner := bufio.NewScanner( f )
+		scanner.Buffer( make( []byte, 64 * 1024 ), 1024 * 1024 )
+		for scanner.Scan() {
+			r := &cmd_rec{}
+			if json.Unmarshal( scanner.Bytes(), r ) == nil {
+				if orig := cl.byaid[r.Aid]; orig != nil && r.Cmd == "" {		// outcome record; update the original
+					orig.Outcome = r.Outcome
+				} else {
+					cl.remember( r )
+				}
+			}
+		}
+		f.Close()
+		cl.byaid = make( map[uint32]*cmd_rec )				// outcomes from before a restart will never arrive
+	}
+
+	cl.open()
+	return
+}
+
+/*
+	Open (append) the log file.
+*/
+func (cl *cmd_log) open( ) {
+	var err error
+
+	cl.f, err = os.OpenFile( cl.fname, os.O_CREATE | os.O_APPEND | os.O_WRONLY, 0644 )
+	if err != nil {
+		am_sheep.Baa( 0, "WRN: unable to open agent command log: %s: %s  [TGUAGT007]", cl.fname, err )
+		cl.f = nil
+		return
+	}
+
+	if st, err := cl.f.Stat(); err == nil {
+		cl.size = st.Size()
+	}
+}
+
+/*
+	Add the record to the recent ring.
+*/
+func (cl *cmd_log) remember( r *cmd_rec ) {
+	if old := cl.recent[cl.ridx]; old != nil {
+		delete( cl.byaid, old.Aid )
+	}
+	cl.recent[cl.ridx] = r
+	cl.ridx = (cl.ridx + 1) % len( cl.recent )
+	cl.byaid[r.Aid] = r
+}
+
+/*
+	Write the record to the file rolling the file if it's too big.
+*/
+func (cl *cmd_log) write( r *cmd_rec ) {
+	if cl == nil || cl.f == nil {
+		return
+	}
+
+	b, err := json.Marshal( r )
+	if err != nil {
+		return
+	}
+
+	if cl.maxsize > 0 && cl.size + int64( len( b ) ) > cl.maxsize {
+		cl.f.Close()
+		os.Rename( cl.fname, cl.fname + ".old" )
+		cl.open()
+		if cl.f == nil {
+			return
+		}
+		cl.size = 0
+	}
+
+	n, _ := cl.f.Write( append( b, '\n' ) )
+	cl.size += int64( n )
+}
+
+/*
+	Assign an action id to each action in the command and create a record for each.
+	The records are not logged until sent() is called.
+*/
+func (cl *cmd_log) stamp( msg *agent_cmd ) ( recs []*cmd_rec ) {
+	if cl == nil || msg == nil {
+		return nil
+	}
+
+	recs = make( []*cmd_rec, len( msg.Actions ) )
+	for i := range msg.Actions {
+		cl.next_aid++
+		if cl.next_aid == 0 {						// 0 is what the agent sends back when it didn't get an id
+			cl.next_aid++
+		}
+		msg.Actions[i].Aid = cl.next_aid
+
+		jact, _ := json.Marshal( msg.Actions[i] )
+		recs[i] = &cmd_rec {
+			Aid:	cl.next_aid,
+			Atype:	msg.Actions[i].Atype,
+			Hosts:	msg.Actions[i].Hosts,
+			Resid:	msg.Actions[i].Data["resid"],
+			Cid:	msg.Actions[i].Data["cid"],
+			Cmd:	string( jact ),
+			fmkey:	fmod_key( &msg.Actions[i] ),
+		}
+	}
+
+	return
+}
+
+/*
+	Return the key which identifies the flow-mods set by an action for a reservation: the host
+	and the match fields for bandwidth actions, the hosts and match for a steering flow-mod,
+	and the host for a mirror. A later action with the same key (refresh, pause, re-push)
+	replaces the flow-mods. Empty string is returned for other action types, and for actions
+	that don't carry the reservation id.
+*/
+func fmod_key( a *action ) ( string ) {
+	if a.Data["resid"] == "" || len( a.Hosts ) == 0 {
+		return ""
+	}
+
+	switch a.Atype {
+		case "bw_fmod", "bwow_fmod", "mcast_fmod":
+			return fmt.Sprintf( "%s %s %s %s %s %s %s", a.Hosts[0], a.Data["smac"], a.Data["dmac"], a.Data["extip"], a.Data["group"], a.Data["sproto"], a.Data["dproto"] )
+
+		case "flowmod":
+			if len( a.Fdata ) > 0 {
+				return fmt.Sprintf( "%s %s", strings.Join( a.Hosts, "," ), fmod_match( a.Fdata[0] ) )
+			}
+
+		case "mirrorwiz":
+			return a.Hosts[0]
+	}
+
+	return ""
+}
+
+/*
+	Return the match portion of a flow-mod command string: the table, priority and match
+	options without the timeout (which changes with each refresh) or the actions.
+*/
+func fmod_match( fdata string ) ( string ) {
+	if i := strings.Index( fdata, "--action" ); i >= 0 {
+		fdata = fdata[0:i]
+	}
+
+	toks := strings.Fields( fdata )
+	match := make( []string, 0, len( toks ) )
+	for i := 0; i < len( toks ); i++ {
+		if toks[i] == "-t" {
+			i++
+			continue
+		}
+		match = append( match, toks[i] )
+	}
+
+	return strings.Join( match, " " )
+}
+
+/*
+	Send the current outcome of a bandwidth action to res-mgr so that it can track which
+	flow-mods are believed to be installed for the reservation.
+*/
+func report_fmod( r *cmd_rec ) {
+	if r.fmkey == "" {
+		return
+	}
+
+	host := ""
+	if len( r.Hosts ) > 0 {
+		host = r.Hosts[0]
+	}
+
+	msg := ipc.Mk_chmsg( )
+	msg.Send_req( rmgr_ch, nil, REQ_FMOD_STATUS, &fmod_report{ resid: r.Resid, aid: r.Aid, atype: r.Atype, host: host, key: r.fmkey, outcome: r.Outcome, ts: time.Now().Unix() }, nil )
+}
+
+/*
+	Accept a json command string, stamp it and return the string to send along with the records.
+	If the string doesn't parse it's returned unchanged and a single record is created to
+	capture it.
+*/
+func (cl *cmd_log) stamp_json( jstr string ) ( string, []*cmd_rec ) {
+	if cl == nil {
+		return jstr, nil
+	}
+
+	msg := &agent_cmd{}
+	if err := json.Unmarshal( []byte( jstr ), msg ); err != nil || len( msg.Actions ) == 0 {
+		return jstr, []*cmd_rec{ &cmd_rec{ Atype: "unknown", Cmd: jstr } }
+	}
+
+	recs := cl.stamp( msg )
+	b, err := json.Marshal( msg )
+	if err != nil {
+		return jstr, recs
+	}
+
+	return string( b ), recs
+}
+
+/*
+	Record that the stamped records were written to the agent (empty agent means there were none).
+*/
+func (cl *cmd_log) sent( recs []*cmd_rec, agent string ) {
+	if cl == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, r := range recs {
+		r.Ts = now
+		if agent == "" {
+			r.Agent = "none"
+			r.Outcome = "unsent"
+		} else {
+			r.Agent = agent
+			r.Outcome = "sent"
+		}
+		cl.remember( r )
+		cl.write( r )
+		report_fmod( r )
+	}
+}
+
+/*
+	Record that the stamped records could not be written to an agent. Errs has the result of
+	holding each for replay (pending.add_json()); those that were held are unsent and the others
+	are dropped. Res-mgr is told either way so that a reservation whose flow-mods were dropped
+	is pushed again rather than being left looking pushed.
+*/
+func (cl *cmd_log) unsent( recs []*cmd_rec, errs []error ) {
+	if cl == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	for i, r := range recs {
+		r.Ts = now
+		r.Agent = "none"
+		r.Outcome = "unsent"
+		if i >= len( errs ) || errs[i] != nil {
+			r.Outcome = "dropped"
+		}
+		cl.remember( r )
+		cl.write( r )
+		report_fmod( r )
+	}
+}
+
+/*
+	Record that an action was refused by vetting (never sent). It is reported to res-mgr even
+	when the log is off so that the reservation isn't thought to be pushed.
+*/
+func (cl *cmd_log) refused( a *action, err error ) {
+	r := &cmd_rec{ Agent: "none", Ts: time.Now().Unix(), Atype: a.Atype, Hosts: a.Hosts, Resid: a.Data["resid"], Cid: a.Data["cid"], Outcome: "refused", fmkey: fmod_key( a ) }
+	if cl != nil {
+		cl.write( r )
+	}
+	report_fmod( r )
+}
+
+/*
+	Record that an action taken back from an agent that dropped could not be held for replay.
+*/
+func (cl *cmd_log) dropped( a *action ) {
+	if cl == nil {
+		return
+	}
+
+	r := &cmd_rec{ Aid: a.Aid, Agent: "none", Ts: time.Now().Unix(), Atype: a.Atype, Hosts: a.Hosts, Resid: a.Data["resid"], Cid: a.Data["cid"], Outcome: "dropped", fmkey: fmod_key( a ) }
+	cl.write( r )
+	report_fmod( r )
+}
+
+/*
+	Return the actions which were written to the agent, have not been answered, and are
+	no more than max_age seconds old. Their outcome is changed to requeued so that they
+	are returned only once. The time each was sent is also returned.
+*/
+func (cl *cmd_log) unacked( agent string, max_age int64 ) ( acts []*action, sent []int64 ) {
+	if cl == nil {
+		return nil, nil
+	}
+
+	now := time.Now().Unix()
+	for aid, r := range cl.byaid {
+		if r.Agent != agent || r.Outcome != "sent" || now - r.Ts > max_age {
+			continue
+		}
+
+		a := &action{}
+		if json.Unmarshal( []byte( r.Cmd ), a ) != nil {
+			continue
+		}
+
+		delete( cl.byaid, aid )
+		r.Outcome = "requeued"
+		cl.write( &cmd_rec{ Aid: aid, Agent: r.Agent, Ts: now, Atype: r.Atype, Resid: r.Resid, Cid: r.Cid, Outcome: r.Outcome } )
+		report_fmod( r )
+		acts = append( acts, a )
+		sent = append( sent, r.Ts )
+	}
+
+	return acts, sent
+}
+
+/*
+	Record the outcome from an agent response.
+*/
+func (cl *cmd_log) outcome( aid uint32, state int ) {
+	if cl == nil || aid == 0 {
+		return
+	}
+
+	r := cl.byaid[aid]
+	if r == nil {
+		return
+	}
+	delete( cl.byaid, aid )
+
+	if state == 0 {
+		r.Outcome = "ok"
+	} else {
+		r.Outcome = fmt.Sprintf( "failed (%d)", state )
+	}
+
+	cl.write( &cmd_rec{ Aid: aid, Agent: r.Agent, Ts: time.Now().Unix(), Atype: r.Atype, Resid: r.Resid, Cid: r.Cid, Outcome: r.Outcome } )
+	report_fmod( r )
+	am_sheep.Baa( 2, "agent response: aid=%d res=%s cid=%s %s", aid, r.Resid, r.Cid, r.Outcome )
+}
+
+/*
+	Generate a json list of recent records, newest first, limited to those that reference the
+	reservation, correlation id, or host when given. At most max records are returned (all if max <= 0).
+*/
+func (cl *cmd_log) to_json( resid string, cid string, host string, max int ) ( string ) {
+	jstr := `{ "commands": [ `
+	sep := ""
+	n := 0
+	l := len( cl.recent )
+	for i := 1; i <= l && (max <= 0 || n < max); i++ {
+		r := cl.recent[(cl.ridx - i + l) % l]
+		if r == nil {
+			break
+		}
+
+		if resid != "" && r.Resid != resid {
+			continue
+		}
+		if cid != "" && r.Cid != cid {
+			continue
+		}
+		if host != "" {
+			found := false
+			for _, h := range r.Hosts {
+				if h == host {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		b, err := json.Marshal( r )
+		if err == nil {
+			jstr += sep + string( b )
+			sep = ", "
+			n++
+		}
+	}
+
+	return jstr + " ] }"
+}
@@ -0,0 +1,261 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	agent_pending
+	Abstract:	Pending work for agents. Actions which could not be delivered (no agent was
+				connected) and actions which were written to an agent that dropped before it
+				responded are kept here and replayed when an agent (re)connects. A newer action
+				for the same host, reservation and type replaces an older one so that only the
+				most recent queue setup or flow-mod set is replayed.
+
+				Flow-mod timeouts are relative, so they are reduced by the time the action spent
+				waiting; actions older than the max age (or whose timeout has passed) are dropped
+				rather than replayed. Expired actions are purged before a new one is refused
+				because the list is full, and no one host may have more than host_max actions
+				held so that a single busy host can't crowd out the others.
+
+				While no agent is connected the agent manager is degraded: the time it started,
+				and the held actions by host, are reported by the agentstatus request and the
+				agent.degraded and agent.restored events are published.
+
+				Referenced only from the agent manager goroutine and so is not locked.
+
+	CFG:		agent:pending_max_age - seconds an action may wait to be replayed (300)
+				agent:pending_max - max number of actions held (4096)
+				agent:pending_host_max - max number of actions held for one host (512)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Per host limit, purge of expired actions, degraded state and status.
+				16 Oct 2026 - Add returns an error when the action is refused.
+				16 Oct 2026 - Status includes the actions held for their action window.
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+type pending_act struct {
+	act		action
+	queued	int64					// time the action was first queued
+}
+
+type pending_work struct {
+	acts	map[string]*pending_act
+	nhost	map[string]int					// actions held by host
+	max_age	int64
+	max		int
+	host_max int
+	dropped	int64
+	expired	int64							// actions discarded because they waited too long
+	degraded int64							// time that the last agent dropped; 0 if agents are connected
+}
+
+func mk_pending( max_age int64, max int, host_max int ) ( *pending_work ) {
+	return &pending_work{ acts: make( map[string]*pending_act ), nhost: make( map[string]int ), max_age: max_age, max: max, host_max: host_max }
+}
+
+/*
+	Adjust the count of actions held for each of the hosts in the action.
+*/
+func (pw *pending_work) count_hosts( a *action, n int ) {
+	for _, h := range a.Hosts {
+		if h == "" {
+			continue
+		}
+		if pw.nhost[h] += n; pw.nhost[h] <= 0 {
+			delete( pw.nhost, h )
+		}
+	}
+}
+
+/*
+	Returns true if any host in the action has reached the per host limit.
+*/
+func (pw *pending_work) host_full( a *action ) ( bool ) {
+	for _, h := range a.Hosts {
+		if h != "" && pw.nhost[h] >= pw.host_max {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Drop the actions that have waited longer than the max age.
+*/
+func (pw *pending_work) purge( ) {
+	now := time.Now().Unix()
+	for key, pa := range pw.acts {
+		if now - pa.queued > pw.max_age {
+			delete( pw.acts, key )
+			pw.count_hosts( &pa.act, -1 )
+			pw.expired++
+		}
+	}
+}
+
+/*
+	Refuse an action because a limit was reached.
+*/
+func (pw *pending_work) refuse( why string ) ( error ) {
+	pw.dropped++
+	if pw.dropped == 1 || pw.dropped % 100 == 0 {
+		am_sheep.Baa( 0, "WRN: agent pending work %s; %d actions dropped  [TGUAGT011]", why, pw.dropped )
+	}
+	return mk_err( ERR_CAPACITY, "agent pending work %s", why )
+}
+
+/*
+	Build the key which identifies the work an action does; a newer action with the
+	same key replaces the older.
+*/
+func pending_key( a *action ) ( string ) {
+	return fmt.Sprintf( "%s|%s|%s|%s|%s|%s", a.Atype, strings.Join( a.Hosts, "," ), a.Data["resid"], a.Data["smac"], a.Data["dmac"], strings.Join( a.Fdata, "," ) )
+}
+
+/*
+	Remember an action. Queued is the time the action was originally sent (0 == now).
+	An error is returned if the action could not be held.
+*/
+func (pw *pending_work) add( a *action, queued int64 ) ( error ) {
+	if queued <= 0 {
+		queued = time.Now().Unix()
+	}
+
+	key := pending_key( a )
+	old, there := pw.acts[key]
+	if !there {
+		if len( pw.acts ) >= pw.max || pw.host_full( a ) {
+			pw.purge( )
+		}
+		if len( pw.acts ) >= pw.max {
+			return pw.refuse( "list is full" )
+		}
+		if pw.host_full( a ) {
+			return pw.refuse( fmt.Sprintf( "for host(s) %v is full", a.Hosts ) )
+		}
+	} else {
+		pw.count_hosts( &old.act, -1 )
+	}
+
+	na := *a
+	na.Aid = 0											// given a new id when replayed
+	pw.acts[key] = &pending_act{ act: na, queued: queued }
+	pw.count_hosts( &na, 1 )
+	am_sheep.Baa( 2, "pending: %s queued for replay: hosts=%v res=%s", a.Atype, a.Hosts, a.Data["resid"] )
+	return nil
+}
+
+/*
+	Remember each action in a json command string. The list returned has the result of
+	adding each action, in order; nil if the string could not be parsed.
+*/
+func (pw *pending_work) add_json( jstr string ) ( errs []error ) {
+	cmd := &agent_cmd{}
+	if err := json.Unmarshal( []byte( jstr ), cmd ); err != nil {
+		return nil
+	}
+
+	errs = make( []error, len( cmd.Actions ) )
+	for i := range cmd.Actions {
+		errs[i] = pw.add( &cmd.Actions[i], 0 )
+	}
+	return errs
+}
+
+/*
+	Return a command (json) for each action still worth replaying and clear the list.
+*/
+func (pw *pending_work) replay( ) ( cmds []string ) {
+	now := time.Now().Unix()
+	cmds = make( []string, 0, len( pw.acts ) )
+	for key, pa := range pw.acts {
+		delete( pw.acts, key )
+		pw.count_hosts( &pa.act, -1 )
+
+		waited := now - pa.queued
+		if waited > pw.max_age {
+			am_sheep.Baa( 1, "pending: %s for res=%s waited %ds and was not replayed", pa.act.Atype, pa.act.Data["resid"], waited )
+			pw.expired++
+			continue
+		}
+
+		if t, there := pa.act.Data["timeout"]; there && t != "" {
+			remain := clike.Atoi64( t ) - waited
+			if remain <= 0 {
+				continue										// would have expired by now; nothing to replay
+			}
+			pa.act.Data["timeout"] = fmt.Sprintf( "%d", remain )
+		}
+
+		if jstr, err := json.Marshal( &agent_cmd{ Ctype: "action_list", Actions: []action{ pa.act } } ); err == nil {
+			cmds = append( cmds, string( jstr ) )
+		}
+	}
+
+	if len( cmds ) > 0 {
+		am_sheep.Baa( 1, "pending: replaying %d actions", len( cmds ) )
+	}
+	return cmds
+}
+
+/*
+	Note a change in the number of connected agents, publishing an event when the manager
+	becomes, or stops being, degraded.
+*/
+func (pw *pending_work) agents_changed( nagents int ) {
+	switch {
+		case nagents == 0 && pw.degraded == 0:
+			pw.degraded = time.Now().Unix()
+			am_sheep.Baa( 0, "WRN: no agents are connected; agent work will be held for up to %ds  [TGUAGT019]", pw.max_age )
+			publish_event( "agent.degraded", fmt.Sprintf( `{ "since": %d }`, pw.degraded ) )
+
+		case nagents > 0 && pw.degraded > 0:
+			am_sheep.Baa( 1, "agents connected after %ds; %d pending actions", time.Now().Unix() - pw.degraded, len( pw.acts ) )
+			publish_event( "agent.restored", fmt.Sprintf( `{ "degraded_secs": %d, "pending": %d }`, time.Now().Unix() - pw.degraded, len( pw.acts ) ) )
+			pw.degraded = 0
+	}
+}
+
+/*
+	Generate the status of the agent manager: connected agents, whether it is degraded, and
+	the work held.
+*/
+func (pw *pending_work) to_json( nagents int, held string ) ( string ) {
+	pw.purge( )
+
+	jh, err := json.Marshal( pw.nhost )
+	if err != nil {
+		jh = []byte( "{ }" )
+	}
+	return fmt.Sprintf( `{ "agents": %d, "degraded": %v, "degraded_since": %d, "pending": %d, "pending_by_host": %s, "dropped": %d, "expired": %d, "max_age": %d, "window_held": %s }`,
+		nagents, pw.degraded > 0, pw.degraded, len( pw.acts ), jh, pw.dropped, pw.expired, pw.max_age, held )
+}
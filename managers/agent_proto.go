@@ -0,0 +1,251 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	agent_proto
+	Abstract:	Agent protocol versioning. When an agent connects we send it a hello
+				command carrying our protocol version; an agent which understands the
+				hello responds with its version and the list of action types that it
+				supports. Agents which do not respond (they predate versioning) are
+				treated as version 0 agents which support the legacy action set.
+
+				Before a command is written to an agent it is translated to the agent's
+				version (see agent_xlate) and any action that the agent does not support
+				causes the agent to be skipped. If no connected agent can handle the
+				command it is not sent and an error is logged rather than having it
+				fail in some opaque way on the host.
+
+				The hello also offers compression encodings (agent:compress); the agent
+				selects one (or none) and both sides then compress larger messages (see
+				gizmos/zframe.go).
+
+				Version 2 agents execute actions on lanes (fast, slow, diag) with independent
+				queues, so a long running intermediate queue setup cannot hold up reservation
+				flow-mods. We name the lane in each action. Because lanes make the separate
+				'long running agent' unnecessary, version 2 agents at the head of the agent
+				list are included in the round robin.
+
+				Agents also name the host they serve in the hello response. When an agent
+				for a host that we have seen before connects (a reconnect, likely because
+				the host or OVS was restarted) resmgr is asked to push the reservations that
+				touch the host again.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Added flow_count action lane.
+				16 Oct 2026 - Added mcast_fmod action lane.
+				16 Oct 2026 - Priority adjustment is dropped for version 0 agents.
+				16 Oct 2026 - Added fmod_probe action lane.
+				16 Oct 2026 - Added remark action lane.
+				16 Oct 2026 - Added ovs_inventory action lane.
+				16 Oct 2026 - Added fmod_bytes action lane.
+				16 Oct 2026 - Added res_verify action lane.
+				16 Oct 2026 - Added sla_stats action lane.
+				16 Oct 2026 - Handover flow-mods are not sent to version 0 agents; min_pver for reserve.
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+const agent_pver int = 2						// protocol version that we speak (2 == lanes)
+
+var agent_hosts = make( map[string]bool )		// hosts which have had an agent connect; agent manager goroutine only
+
+/*
+	Actions that an agent which predates versioning (version 0) is known to support.
+*/
+var legacy_actions = map[string]bool {
+	"setqueues":		true,
+	"flowmod":			true,
+	"map_mac2phost":	true,
+	"intermed_queues":	true,
+	"mirrorwiz":		true,
+	"bw_fmod":			true,
+	"bwow_fmod":		true,
+	"passthru":			true,
+}
+
+/*
+	The lane each action type is executed on by version 2 agents.
+*/
+var action_lanes = map[string]string {
+	"flowmod":			"fast",
+	"bw_fmod":			"fast",
+	"bwow_fmod":		"fast",
+	"mcast_fmod":		"fast",
+	"passthru":			"fast",
+	"setqueues":		"fast",
+	"intermed_queues":	"slow",
+	"remark":			"slow",
+	"map_mac2phost":	"diag",
+	"mirrorwiz":		"diag",
+	"flow_count":		"diag",
+	"fmod_probe":		"diag",
+	"res_verify":		"diag",
+	"fmod_bytes":		"diag",
+	"sla_stats":		"diag",
+	"ovs_inventory":	"diag",
+}
+
+/*
+	Translation functions, by action type, which convert an action into the form understood
+	by an agent speaking an older version of the protocol.
+*/
+var agent_xlate = map[string]func( act *action, pver int ) {
+	"bw_fmod":		xlate_bw_fmod,
+	"passthru":		xlate_v0_data,
+}
+
+/*
+	Version 0 agents do not pass the priority bump, priority adjustment or the correlation
+	id; drop them so that the command log reflects what the agent will actually do. (A
+	non-zero bump never gets here; such actions are unsupported by version 0 agents.)
+*/
+func xlate_bw_fmod( act *action, pver int ) {
+	if pver < 1 {
+		delete( act.Data, "pbump" )
+		delete( act.Data, "padj" )
+	}
+	xlate_v0_data( act, pver )
+}
+
+func xlate_v0_data( act *action, pver int ) {
+	if pver < 1 {
+		delete( act.Data, "cid" )
+	}
+}
+
+/*
+	Build the hello command sent to an agent when it connects. Zoffer is the list of
+	compression encodings we are willing to use on the session.
+*/
+func mk_hello( zoffer []string ) ( []byte ) {
+	zlist, _ := json.Marshal( zoffer )
+	return []byte( fmt.Sprintf( `{ "ctype": "hello", "pver": %d, "zenc": %s }`, agent_pver, zlist ) )
+}
+
+/*
+	Capture the version and supported action list from an agent's hello response.
+*/
+func (a *agent) hello( req *agent_msg ) {
+	a.pver = req.Pver
+	a.actions = make( map[string]bool, len( req.Rdata ) )
+	for _, atype := range req.Rdata {
+		a.actions[atype] = true
+	}
+
+	a.zenc = req.Zenc
+	a.host = req.Host
+	am_sheep.Baa( 1, "agent %s on %s speaks protocol version %d and supports %d actions: %s", a.id, a.host, a.pver, len( a.actions ), req.Vinfo )
+	if a.zenc != "" {
+		am_sheep.Baa( 1, "agent %s session will be compressed with %s", a.id, a.zenc )
+	}
+
+	if a.host != "" {
+		if agent_hosts[a.host] {									// reconnect; flow-mods on the host may be gone
+			h := a.host
+			msg := ipc.Mk_chmsg( )
+			msg.Send_req( rmgr_ch, nil, REQ_HOST_RECONCILE, &h, nil )
+		}
+		agent_hosts[a.host] = true
+	}
+}
+
+/*
+	Returns true if the agent multiplexes actions over lanes.
+*/
+func (a *agent) has_lanes( ) ( bool ) {
+	return a.pver >= 2
+}
+
+/*
+	Returns true if the agent supports the action type.
+*/
+func (a *agent) supports( atype string ) ( bool ) {
+	if a.actions == nil {
+		return legacy_actions[atype]
+	}
+
+	return a.actions[atype]
+}
+
+/*
+	Returns the first action type in the command which the agent does not support; empty
+	string if all are supported. A version 0 agent can't take a handover replacement's
+	bandwidth flow-mods as it doesn't know the priority bump.
+*/
+func (a *agent) unsupported( cmd *agent_cmd ) ( string ) {
+	for i := range cmd.Actions {
+		if ! a.supports( cmd.Actions[i].Atype ) {
+			return cmd.Actions[i].Atype
+		}
+		if a.pver < 1 && cmd.Actions[i].Atype == "bw_fmod" && cmd.Actions[i].Data["pbump"] != "" {
+			return "bw_fmod (handover)"				// would lose the bump and collide with the flow-mods it replaces
+		}
+	}
+
+	return ""
+}
+
+/*
+	Return the lowest protocol version spoken by the connected agents; agent_pver if none
+	are connected.
+*/
+func (ad *agent_data) min_pver( ) ( int ) {
+	min := agent_pver
+	for _, a := range ad.agents {
+		if a.pver < min {
+			min = a.pver
+		}
+	}
+
+	return min
+}
+
+/*
+	Return the json for the command translated to the agent's version. The command passed
+	in is not altered.
+*/
+func (a *agent) xlate( cmd *agent_cmd ) ( []byte, error ) {
+	acmd := &agent_cmd{ Ctype: cmd.Ctype, Pver: a.pver, Actions: make( []action, len( cmd.Actions ) ) }
+	for i := range cmd.Actions {
+		acmd.Actions[i] = cmd.Actions[i]
+		if a.pver >= 2 {
+			acmd.Actions[i].Lane = action_lanes[acmd.Actions[i].Atype]
+		}
+		if xf := agent_xlate[acmd.Actions[i].Atype]; xf != nil && a.pver < agent_pver {
+			acmd.Actions[i].Data = make( map[string]string, len( cmd.Actions[i].Data ) )		// translation must not alter the original
+			for k, v := range cmd.Actions[i].Data {
+				acmd.Actions[i].Data[k] = v
+			}
+			xf( &acmd.Actions[i], a.pver )
+		}
+	}
+
+	return json.Marshal( acmd )
+}
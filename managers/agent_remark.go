@@ -0,0 +1,232 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	agent_remark
+	Abstract:	Default remark policy for traffic which has no reservation. Each bridge named in the
+				policy is given a low priority flow-mod (ql_remark_fmods) which sets the DSCP value of
+				traffic not marked by a reservation flow-mod, so that the priority markings of reserved
+				traffic mean something once the traffic leaves the host.
+
+				The flow-mods are owned by tegu: they carry a hard timeout of three refresh periods
+				and are sent to every host each refresh, when an agent connects, and when the policy
+				is changed (remark request). A bridge dropped from the policy has its flow-mods deleted
+				with the next send rather than being left to expire.
+
+	CFG:		agent:remark - space separated bridge:dscp pairs (e.g. "br-int:0 br-ex:0"); none if unset
+				agent:remark_refresh - seconds between refreshes (600)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Writes go through the ConnManager interface (seams.go).
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/config"
+	"github.com/att/tegu/gizmos"
+)
+
+type remark_policy struct {
+	bridges	map[string]int			// bridge -> dscp value
+	dropped	map[string]bool			// bridges removed from the policy; flow-mods deleted on the next send
+	refresh	int64
+}
+
+/*
+	Build the policy from the config file. An empty policy is returned if none is configured
+	so that one can be set later with a request.
+*/
+func mk_remark_policy( ) ( rp *remark_policy ) {
+	rp = &remark_policy{
+		bridges:	make( map[string]int ),
+		dropped:	make( map[string]bool ),
+		refresh:	600,
+	}
+
+	if cfg_data["agent"] == nil {
+		return rp
+	}
+
+	if p := cfg_data["agent"]["remark_refresh"]; p != nil {
+		rp.refresh = clike.Atoi64( *p )
+		if rp.refresh < 60 {
+			am_sheep.Baa( 1, "remark_refresh in configuration file is too small, set to 60 seconds" )
+			rp.refresh = 60
+		}
+	}
+
+	if p := cfg_data["agent"]["remark"]; p != nil {
+		b, err := parse_remark( *p )
+		if err != nil {
+			am_sheep.Baa( 0, "ERR: remark policy in config file ignored: %s  [TGUAGT015]", err )
+			return rp
+		}
+		rp.bridges = b
+		am_sheep.Baa( 1, "remark policy from config file: %s", rp )
+	}
+
+	return rp
+}
+
+/*
+	Parse a list of bridge:dscp pairs (space or comma separated).
+*/
+func parse_remark( list string ) ( map[string]int, error ) {
+	bridges := make( map[string]int )
+
+	for _, tok := range strings.Fields( strings.Replace( list, ",", " ", -1 ) ) {
+		kv := strings.SplitN( tok, ":", 2 )
+		if len( kv ) != 2 || kv[0] == "" || ! gizmos.Valid_hostname( kv[0] ) {
+			return nil, fmt.Errorf( "invalid bridge:dscp pair: %s", tok )
+		}
+
+		n := clike.Atoi( kv[1] )
+		if n < 0 || n > 63 || fmt.Sprintf( "%d", n ) != kv[1] {
+			return nil, fmt.Errorf( "invalid dscp value for %s: %s (must be 0-63)", kv[0], kv[1] )
+		}
+
+		bridges[kv[0]] = n
+	}
+
+	return bridges, nil
+}
+
+/*
+	Read the policy from the config file again. A file without a policy results in an empty one.
+*/
+func reread_remark( ) ( string, error ) {
+	if cfg_file == "" {
+		return "", fmt.Errorf( "no configuration file to read" )
+	}
+
+	cdata, err := config.Parse2strs( nil, cfg_file )
+	if err != nil {
+		return "", fmt.Errorf( "unable to parse config file %s: %s", cfg_file, err )
+	}
+
+	if cdata["agent"] == nil || cdata["agent"]["remark"] == nil {
+		return "", nil
+	}
+
+	return *cdata["agent"]["remark"], nil
+}
+
+/*
+	Replace the bridges in the policy. Bridges no longer listed are remembered so that their
+	flow-mods are deleted. Returns true if the policy changed.
+*/
+func (rp *remark_policy) set( bridges map[string]int ) ( changed bool ) {
+	for b, v := range rp.bridges {
+		nv, ok := bridges[b]
+		if ! ok {
+			rp.dropped[b] = true
+			changed = true
+		} else {
+			if nv != v {
+				changed = true
+			}
+		}
+	}
+
+	for b := range bridges {
+		delete( rp.dropped, b )
+		if _, ok := rp.bridges[b]; ! ok {
+			changed = true
+		}
+	}
+
+	rp.bridges = bridges
+	return changed
+}
+
+/*
+	Stringer: bridge:dscp pairs sorted by bridge, or "off".
+*/
+func (rp *remark_policy) String( ) ( string ) {
+	if rp == nil || len( rp.bridges ) == 0 {
+		return "off"
+	}
+
+	list := make( []string, 0, len( rp.bridges ) )
+	for b, v := range rp.bridges {
+		list = append( list, fmt.Sprintf( "%s:%d", b, v ) )
+	}
+	sort.Strings( list )
+
+	return strings.Join( list, " " )
+}
+
+/*
+	Build the remark request for the hosts in the list and send it as a long running request.
+	Nothing is sent if there is neither a policy nor a bridge to clean up. The dropped list is
+	cleared once sent; an agent connecting later than that won't see the delete, but the flow-mods
+	expire on their own.
+*/
+func (ad *agent_data) send_remark( smgr ConnManager, hlist *string, rp *remark_policy ) {
+	if hlist == nil || *hlist == "" || rp == nil {
+		return
+	}
+	if len( rp.bridges ) == 0 && len( rp.dropped ) == 0 {
+		return
+	}
+
+	pairs := make( []string, 0, len( rp.bridges ) )
+	for b, v := range rp.bridges {
+		pairs = append( pairs, fmt.Sprintf( "%s:%d", b, v<<2 ) )		// agent wants tos values
+	}
+	sort.Strings( pairs )
+
+	del := make( []string, 0, len( rp.dropped ) )
+	for b := range rp.dropped {
+		del = append( del, b )
+	}
+	sort.Strings( del )
+
+	msg := &agent_cmd{ Ctype: "action_list" }
+	msg.Actions = make( []action, 1 )
+	msg.Actions[0].Atype = "remark"
+	msg.Actions[0].Hosts = strings.Split( *hlist, " " )
+	msg.Actions[0].Dscps = strings.Join( pairs, " " )
+	msg.Actions[0].Data = map[string]string{ "timeout": fmt.Sprintf( "%d", rp.refresh * 3 ) }
+	if len( del ) > 0 {
+		msg.Actions[0].Data["del"] = strings.Join( del, "," )
+	}
+
+	recs := agent_cmdlog.stamp( msg )
+	jmsg, err := json.Marshal( msg )
+	if err != nil {
+		am_sheep.Baa( 0, "WRN: creating json remark command failed: %s  [TGUAGT016]", err )
+		return
+	}
+
+	am_sheep.Baa( 1, "sending remark request: hosts=%s bridges=%s del=%v", *hlist, rp, del )
+	agent_cmdlog.sent( recs, ad.sendbytes2lra( smgr, jmsg ) )
+	rp.dropped = make( map[string]bool )
+}
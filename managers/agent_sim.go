@@ -0,0 +1,120 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	agent_sim
+	Abstract:	The mock agent used in simulation mode (see sim.go). It is added to the agent
+				list when agent manager starts and never disconnects. Rather than writing to a
+				session, each action given to it is appended to the simulation command log as
+				a json record:
+					{ "ts": unix-time, "agent": "sim-agent", "action": { ... } }
+
+				and, for the action types that a real agent responds to, a successful response
+				is queued on the session channel as though it had arrived from the network.
+				The map_mac2phost response is built from the simulated VMs so that the network
+				graph is complete.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/att/gopkgs/connman"
+)
+
+const SIM_AGENT_ID string = "sim-agent"
+
+type sim_agent struct {
+	id		string
+	f		*os.File							// command log; nil if it could not be opened
+	sess_ch	chan *connman.Sess_data				// responses are queued here as if from the session manager
+}
+
+/*
+	Create the mock agent; commands are recorded in fname.
+*/
+func mk_sim_agent( id string, fname string, sess_ch chan *connman.Sess_data ) ( sa *sim_agent ) {
+	sa = &sim_agent{ id: id, sess_ch: sess_ch }
+
+	f, err := os.OpenFile( fname, os.O_CREATE | os.O_APPEND | os.O_WRONLY, 0644 )
+	if err != nil {
+		am_sheep.Baa( 0, "WRN: unable to open simulation command log: %s: %s  [TGUAGT012]", fname, err )
+	} else {
+		sa.f = f
+	}
+
+	return
+}
+
+/*
+	Accept a message that would have been written to the agent's session. Messages are
+	never compressed for the mock agent.
+*/
+func (sa *sim_agent) exec( msg []byte ) {
+	cmd := &agent_cmd{}
+	if err := json.Unmarshal( msg, cmd ); err != nil {
+		am_sheep.Baa( 1, "WRN: mock agent could not parse command: %s  [TGUAGT013]", err )
+		return
+	}
+
+	now := time.Now().Unix()
+	for i := range cmd.Actions {
+		act := &cmd.Actions[i]
+		if sa.f != nil {
+			if jact, err := json.Marshal( act ); err == nil {
+				fmt.Fprintf( sa.f, `{ "ts": %d, "agent": %q, "action": %s }` + "\n", now, sa.id, jact )
+			}
+		}
+
+		resp := &agent_msg{ Ctype: "response", Rtype: act.Atype, Rid: act.Aid, Vinfo: "sim" }
+		switch act.Atype {
+			case "map_mac2phost":
+				resp.Rdata = sim_net.mac2phost()
+
+			case "setqueues":
+				if act.Data["qgen"] == "" {
+					continue
+				}
+				for _, h := range act.Hosts {
+					resp.Rdata = append( resp.Rdata, h + " " + act.Data["qgen"] + " ok" )
+				}
+
+			case "bw_fmod", "bwow_fmod", "mcast_fmod", "passthru", "mirrorwiz":
+
+			default:
+				continue							// real agents don't respond to the rest
+		}
+
+		if jresp, err := json.Marshal( resp ); err == nil {
+			sd := &connman.Sess_data{ Id: sa.id, State: connman.ST_DATA, Buf: jresp }
+			go func() { sa.sess_ch <- sd }()		// we are called from the goroutine that reads the channel
+		}
+	}
+}
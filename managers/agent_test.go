@@ -0,0 +1,238 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Collect the agent commands sent to agent manager.
+*/
+func agent_cmds( ch chan *ipc.Chmsg ) ( cmds []string ) {
+	for {
+		select {
+			case msg := <- ch:
+				cmds = append( cmds, msg.Req_data.( string ) )
+
+			default:
+				return
+		}
+	}
+}
+
+/*
+	Agent actions built as fq-mgr builds them for a steering reservation (the flow-mod string
+	and the reservation id/cid data) and for a bandwidth reservation must pass vetting
+	unchanged; one with a bad value must be removed and reported.
+*/
+func TestAgent_vet( t *testing.T ) {
+	fq_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	am_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	am_ch = make( chan *ipc.Chmsg, 16 )
+	rmgr_ch = make( chan *ipc.Chmsg, 16 )
+	errs := 0
+
+	rname := "res-1"
+	mstr := "0x00/0x01"
+	resub := "90 0"
+	sw := "host3"
+	nmac := "fa:16:3e:00:00:09"
+	proto := "tcp"
+	ep2 := "10.0.0.2"
+	ip2mac := map[string]*string{ ep2: &nmac }
+	hlist := "host1 host2 host3"
+
+	fq := Mk_fqreq( &rname )							// intermediate rule as steer_fmods builds it
+	fq.Pri = 210
+	fq.Expiry = 3600
+	fq.Cid = "c0001"
+	fq.Swid = &sw
+	fq.Match.Swport = 7
+	fq.Match.Meta = &mstr
+	fq.Match.Ip2 = &ep2
+	fq.Protocol = &proto
+	dport := "80"
+	fq.Match.Tpdport = &dport
+	fq.Nxt_mac = &nmac
+	fq.Action.Resub = &resub
+	send_stfmod_agent( fq, ip2mac, &hlist )
+
+	dmac := "fa:16:3e:00:00:02"
+	bq := Mk_fqreq( &rname )
+	bq.Cid = "c0002"
+	bq.Expiry = 3600
+	bq.Dscp = 46
+	bq.Espq = gizmos.Mk_spq( "host1", 3, 2 )
+	ip1 := "10.0.0.1"
+	bq.Match.Ip1 = &ip1
+	bq.Match.Ip2 = &ep2
+	ip2mac[ip1] = &dmac
+	send_bw_fmods( bq, ip2mac, nil )
+
+	cmds := agent_cmds( am_ch )
+	if len( cmds ) < 2 {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected steering and bandwidth commands, got %d\n", len( cmds ) )
+		errs++
+	}
+	for _, c := range cmds {
+		out, err := vet_agent_cmd( c )
+		if err != nil || out != c {
+			fmt.Fprintf( os.Stderr, "[FAIL] agent command refused: %s: %s\n", err, c )
+			errs++
+		}
+	}
+
+	bad := strings.Replace( cmds[len( cmds )-1], `"c0002"`, `"c0002 -x"`, 1 )
+	bad = strings.Replace( bad, `"Actions":[`, `"Actions":[{"Atype":"flowmod","Hosts":["host1"],"Fdata":["--match -i 1"]},`, 1 )
+	out, err := vet_agent_cmd( bad )
+	if err == nil || strings.Contains( out, "bw_fmod" ) || ! strings.Contains( out, "flowmod" ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] bad action not removed: %v %s\n", err, out )
+		errs++
+	}
+	select {													// refused action is reported to res-mgr as failed
+		case msg := <- rmgr_ch:
+			if r, ok := msg.Req_data.( *fmod_report ); !ok || r.outcome != "refused" || r.resid != rname {
+				fmt.Fprintf( os.Stderr, "[FAIL] refused action reported wrong: %v\n", msg.Req_data )
+				errs++
+			}
+
+		default:
+			fmt.Fprintf( os.Stderr, "[FAIL] refused action was not reported to res-mgr\n" )
+			errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   agent action vetting\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	Round robin must skip the long running agent (head of the list) once it has had its turn,
+	and send to all must write to every agent; what is written is collected by the in-memory
+	session manager rather than sent on a socket.
+*/
+func TestAgent_routing( t *testing.T ) {
+	am_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	smgr := mk_mem_connman( )
+	ad := &agent_data{ zmin: 1024 }
+	ad.agents = make( map[string]*agent )
+	for _, id := range []string{ "a1", "a2", "a3" } {
+		ad.Mk_agent( id )
+	}
+	lra := ad.agent_list[0].id
+
+	sent := make( map[string]int )
+	for i := 0; i < 4; i++ {
+		id, err := ad.send2one( smgr, "ping" )
+		if err != nil {
+			fmt.Fprintf( os.Stderr, "[FAIL] send to one agent: %s\n", err )
+			errs++
+		}
+		sent[id]++
+	}
+	if sent[lra] != 1 || len( sent ) != 3 {
+		fmt.Fprintf( os.Stderr, "[FAIL] round robin did not skip the long running agent %s: %v\n", lra, sent )
+		errs++
+	}
+	for id, n := range sent {
+		if w := smgr.take( id ); len( w ) != n || string( w[0] ) != "ping" {
+			fmt.Fprintf( os.Stderr, "[FAIL] agent %s: expected %d writes, session has %d\n", id, n, len( w ) )
+			errs++
+		}
+	}
+
+	if n, err := ad.send2all( smgr, "pong" ); n != 3 || err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] send to all: %d agents written: %v\n", n, err )
+		errs++
+	}
+	for _, id := range []string{ "a1", "a2", "a3" } {
+		if w := smgr.take( id ); len( w ) != 1 || string( w[0] ) != "pong" {
+			fmt.Fprintf( os.Stderr, "[FAIL] agent %s not sent the message for all: %q\n", id, w )
+			errs++
+		}
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   agent routing through the session manager\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	A handover replacement's bandwidth flow-mods (non-zero pbump) must go only to an agent that
+	speaks protocol version 1 or later; a version 0 agent would drop the bump and install them
+	over the ones they replace.
+*/
+func TestAgent_handover_pver( t *testing.T ) {
+	am_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	smgr := mk_mem_connman( )
+	ad := &agent_data{ zmin: 1024 }
+	ad.agents = make( map[string]*agent )
+	old := ad.Mk_agent( "v0" )
+	cur := ad.Mk_agent( "v2" )
+	cur.pver = agent_pver
+	cur.actions = map[string]bool{ "bw_fmod": true }
+
+	if pv := ad.min_pver( ); pv != 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected lowest protocol version 0, got %d\n", pv )
+		errs++
+	}
+
+	cmd := `{ "ctype": "action_list", "actions": [ { "atype": "bw_fmod", "hosts": [ "h1" ], "data": { "resid": "r1", "pbump": "2" } } ] }`
+	for i := 0; i < 3; i++ {
+		if id, err := ad.send2one( smgr, cmd ); err != nil || id != "v2" {
+			fmt.Fprintf( os.Stderr, "[FAIL] handover flow-mods sent to %q (%v); expected v2\n", id, err )
+			errs++
+		}
+	}
+	if w := smgr.take( old.id ); len( w ) != 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] version 0 agent was sent handover flow-mods: %q\n", w )
+		errs++
+	}
+
+	delete( ad.agents, cur.id )
+	ad.build_list( )
+	if _, err := ad.send2one( smgr, cmd ); err == nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] handover flow-mods sent with only a version 0 agent connected\n" )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   handover flow-mods are kept from version 0 agents\n" )
+	} else {
+		t.Fail()
+	}
+}
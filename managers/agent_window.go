@@ -0,0 +1,302 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+/*
+
+	Mnemonic:	agent_window
+	Abstract:	Windows in which disruptive agent actions may run. Long running actions which
+				disturb the switches (intermediate queue setup, flow table and ovs inventory
+				audits) can be limited to low traffic periods. Hosts are put into groups, and
+				each group may be given a window; the window spec is the same as for a
+				blackout (daily@hh:mm+duration, weekly@day@hh:mm+duration or start-end, UTC).
+				Hosts that aren't in a named group belong to the group *.
+
+				The hosts of a windowed action whose window is closed are taken out of the
+				action and held, by action type and group, until the window opens; the rest
+				of the action is sent as usual. A newer action of the same type for the group
+				replaces the held one (the hosts are merged) as these actions always set the
+				whole state. Held actions are listed by the agentstatus request.
+
+				Referenced only from the agent manager goroutine and so is not locked.
+
+	CFG:		agent:action_groups - space separated group=host[,host...] list
+				agent:action_windows - space separated group=spec list; groups without one aren't limited
+				agent:window_actions - action types that are limited (intermed_queues flow_count ovs_inventory)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	The hosts of one action type held for a group's window.
+*/
+type held_action struct {
+	act		action							// the action with the hosts removed
+	group	string
+	hosts	map[string]bool
+	since	int64
+}
+
+type action_windows struct {
+	groups	map[string]string				// host to group
+	wins	map[string]*gizmos.Blackout		// group to window
+	types	map[string]bool					// action types limited to the windows
+	held	map[string]*held_action			// keyed by type and group
+}
+
+/*
+	Build from the config. Nil is returned if no windows are defined.
+*/
+func mk_action_windows( ) ( aw *action_windows ) {
+	p := cfg_data["agent"]["action_windows"]
+	if p == nil || strings.TrimSpace( *p ) == "" {
+		return nil
+	}
+
+	aw = &action_windows{
+		groups:	make( map[string]string ),
+		wins:	make( map[string]*gizmos.Blackout ),
+		types:	make( map[string]bool ),
+		held:	make( map[string]*held_action ),
+	}
+
+	for _, tok := range strings.Fields( *p ) {
+		kv := strings.SplitN( tok, "=", 2 )
+		if len( kv ) != 2 {
+			am_sheep.Baa( 0, "WRN: action window ignored, expected group=spec: %s  [TGUAGT020]", tok )
+			continue
+		}
+		b, err := gizmos.Mk_blackout( kv[0], kv[1] )
+		if err != nil {
+			am_sheep.Baa( 0, "WRN: action window ignored: %s  [TGUAGT020]", err )
+			continue
+		}
+		aw.wins[kv[0]] = b
+	}
+	if len( aw.wins ) == 0 {
+		return nil
+	}
+
+	if p := cfg_data["agent"]["action_groups"]; p != nil {
+		for _, tok := range strings.Fields( *p ) {
+			kv := strings.SplitN( tok, "=", 2 )
+			if len( kv ) != 2 {
+				am_sheep.Baa( 0, "WRN: action group ignored, expected group=host[,host...]: %s  [TGUAGT020]", tok )
+				continue
+			}
+			for _, h := range strings.Split( kv[1], "," ) {
+				if h != "" {
+					aw.groups[h] = kv[0]
+				}
+			}
+		}
+	}
+
+	tlist := "intermed_queues flow_count ovs_inventory"
+	if p := cfg_data["agent"]["window_actions"]; p != nil {
+		tlist = *p
+	}
+	for _, t := range strings.Fields( strings.Replace( tlist, ",", " ", -1 ) ) {
+		aw.types[t] = true
+	}
+
+	for g, b := range aw.wins {
+		am_sheep.Baa( 1, "actions (%s) for hosts in group %s are limited to the window %s", tlist, g, b.Spec )
+	}
+	return aw
+}
+
+/*
+	Return the group of the host. The host may be given with a domain which the group list
+	doesn't have.
+*/
+func (aw *action_windows) group( host string ) ( string ) {
+	if g, ok := aw.groups[host]; ok {
+		return g
+	}
+	if g, ok := aw.groups[strings.SplitN( host, ".", 2 )[0]]; ok {
+		return g
+	}
+	return "*"
+}
+
+/*
+	Return true if the group's window is open, or it has none. A window which won't open
+	again doesn't hold anything.
+*/
+func (aw *action_windows) is_open( group string, now int64 ) ( bool ) {
+	b := aw.wins[group]
+	return b == nil || b.Covers( now ) || b.Next( now ) == 0
+}
+
+/*
+	Take the hosts whose window is closed out of the limited actions in the command and
+	hold them. Actions left without hosts are removed. The number of hosts held is returned.
+*/
+func (aw *action_windows) gate( msg *agent_cmd, now int64 ) ( nheld int ) {
+	if aw == nil || msg == nil {
+		return 0
+	}
+
+	acts := msg.Actions[:0]
+	for _, a := range msg.Actions {
+		if ! aw.types[a.Atype] || len( a.Hosts ) == 0 {
+			acts = append( acts, a )
+			continue
+		}
+
+		keep := make( []string, 0, len( a.Hosts ) )
+		for _, h := range a.Hosts {
+			g := aw.group( h )
+			if aw.is_open( g, now ) {
+				keep = append( keep, h )
+				continue
+			}
+
+			key := a.Atype + " " + g
+			ha := aw.held[key]
+			if ha == nil {
+				ha = &held_action{ group: g, hosts: make( map[string]bool ), since: now }
+				aw.held[key] = ha
+			}
+			ha.act = a								// newest settings win
+			ha.act.Hosts = nil
+			ha.act.Aid = 0
+			ha.hosts[h] = true
+			nheld++
+		}
+
+		if len( keep ) > 0 {
+			a.Hosts = keep
+			acts = append( acts, a )
+		}
+	}
+	msg.Actions = acts
+
+	if nheld > 0 {
+		am_sheep.Baa( 1, "%d host(s) held until their action window opens", nheld )
+	}
+	return nheld
+}
+
+/*
+	Gate a command given as json. The command is returned as given if nothing is held, and
+	as the empty string if nothing is left to send.
+*/
+func (aw *action_windows) gate_json( jstr string, now int64 ) ( string ) {
+	if aw == nil {
+		return jstr
+	}
+
+	msg := &agent_cmd{}
+	if err := json.Unmarshal( []byte( jstr ), msg ); err != nil {
+		return jstr
+	}
+	if aw.gate( msg, now ) == 0 {
+		return jstr
+	}
+	if len( msg.Actions ) == 0 {
+		return ""
+	}
+
+	jmsg, err := json.Marshal( msg )
+	if err != nil {
+		return jstr
+	}
+	return string( jmsg )
+}
+
+/*
+	Return a command for each held action whose window has opened; they are no longer held.
+*/
+func (aw *action_windows) due( now int64 ) ( list []*agent_cmd ) {
+	if aw == nil {
+		return nil
+	}
+
+	for key, ha := range aw.held {
+		if ! aw.is_open( ha.group, now ) {
+			continue
+		}
+
+		a := ha.act
+		a.Hosts = make( []string, 0, len( ha.hosts ) )
+		for h := range ha.hosts {
+			a.Hosts = append( a.Hosts, h )
+		}
+		sort.Strings( a.Hosts )
+
+		am_sheep.Baa( 1, "action window for group %s is open: sending %s held for %ds to %d host(s)", ha.group, a.Atype, now - ha.since, len( a.Hosts ) )
+		list = append( list, &agent_cmd{ Ctype: "action_list", Actions: []action{ a } } )
+		delete( aw.held, key )
+	}
+
+	return list
+}
+
+/*
+	Return a json array of the held actions: type, group, hosts, when held and when the
+	window next opens.
+*/
+func (aw *action_windows) to_json( ) ( string ) {
+	if aw == nil || len( aw.held ) == 0 {
+		return "[ ]"
+	}
+
+	now := time.Now().Unix()
+	keys := make( []string, 0, len( aw.held ) )
+	for k := range aw.held {
+		keys = append( keys, k )
+	}
+	sort.Strings( keys )
+
+	jstr := "[ "
+	sep := ""
+	for _, k := range keys {
+		ha := aw.held[k]
+		hosts := make( []string, 0, len( ha.hosts ) )
+		for h := range ha.hosts {
+			hosts = append( hosts, h )
+		}
+		sort.Strings( hosts )
+		jh, _ := json.Marshal( hosts )
+
+		jstr += fmt.Sprintf( `%s{ "atype": %q, "group": %q, "window": %q, "hosts": %s, "since": %d, "opens": %d }`,
+			sep, ha.act.Atype, ha.group, aw.wins[ha.group].Spec, jh, ha.since, aw.wins[ha.group].Next( now ) )
+		sep = ", "
+	}
+
+	return jstr + " ]"
+}
@@ -0,0 +1,327 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	compact
+	Abstract:	Compaction of the internal structures of a long running tegu, and a report of how
+				big they are. The compact admin request has each manager tidy up in its own
+				goroutine:
+
+					res-mgr	- extinct reservations (expired, pushed and dead for more than two
+							  minutes) are dropped as they are when a checkpoint is written;
+							  entries for reservations no longer in the inventory are dropped from
+							  the side tables (accounting, flow-mod status, approval and consent
+							  waits, expiry warnings, grace deletes); and the maps, including the
+							  secondary indexes, are copied so that the space held by deleted
+							  entries is given back (go maps never shrink).
+
+					network	- the obligation of each link has the time slices in the past removed
+							  and adjacent slices which are the same merged; slices are split as
+							  reservations are added and never joined when they go.
+
+				The count of each structure, before and after, is reported by subsystem; go can't
+				say how many bytes each holds, so the runtime heap figures before and after
+				(following a forced collection) are given for the process as a whole.
+
+				With report, nothing is changed and only the counts and heap figures are given.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Counts of named structures in a fixed order for the report.
+*/
+type struct_counts struct {
+	names	[]string
+	counts	map[string]int
+}
+
+func mk_struct_counts( ) ( *struct_counts ) {
+	return &struct_counts{ names: make( []string, 0, 16 ), counts: make( map[string]int ) }
+}
+
+func (sc *struct_counts) set( name string, n int ) {
+	if _, ok := sc.counts[name]; ! ok {
+		sc.names = append( sc.names, name )
+	}
+	sc.counts[name] = n
+}
+
+func (sc *struct_counts) To_json( ) ( string ) {
+	jstr := "{ "
+	sep := ""
+	for _, nm := range sc.names {
+		jstr += fmt.Sprintf( "%s%q: %d", sep, nm, sc.counts[nm] )
+		sep = ", "
+	}
+
+	return jstr + " }"
+}
+
+/*
+	Build a json object with the before and after counts and anything else the
+	subsystem wants to add (extra, already json fields, or empty).
+*/
+func compact_json( before *struct_counts, after *struct_counts, extra string ) ( string ) {
+	if extra != "" {
+		extra = ", " + extra
+	}
+	return fmt.Sprintf( `{ "before": %s, "after": %s%s }`, before.To_json(), after.To_json(), extra )
+}
+
+/*
+	Copy a map of pledges so that the space of deleted entries is released.
+*/
+func copy_pmap( m map[string]*gizmos.Pledge ) ( map[string]*gizmos.Pledge ) {
+	nm := make( map[string]*gizmos.Pledge, len( m ) )
+	for k, v := range m {
+		nm[k] = v
+	}
+	return nm
+}
+
+func copy_tmap( m map[string]int64 ) ( map[string]int64 ) {
+	nm := make( map[string]int64, len( m ) )
+	for k, v := range m {
+		nm[k] = v
+	}
+	return nm
+}
+
+// ---- res-mgr ------------------------------------------------------------------------------
+
+func (inv *Inventory) struct_counts( ) ( *struct_counts ) {
+	sc := mk_struct_counts( )
+	sc.set( "cache", len( inv.cache ) )
+	sc.set( "retry", len( inv.retry ) )
+	sc.set( "recovering", len( inv.recovering ) )
+	sc.set( "accounted", len( inv.accounted ) )
+	sc.set( "awaiting", len( inv.awaiting ) )
+	sc.set( "consent_wait", len( inv.consent_wait ) )
+	sc.set( "fmstat", len( inv.fmstat ) )
+	sc.set( "doomed", len( inv.doomed ) )
+	sc.set( "warned", len( inv.warned ) )
+	sc.set( "qmap_ids", len( inv.qmap_ids ) )
+	sc.set( "ulcap", len( inv.ulcap_cache ) )
+	sc.set( "watches", len( inv.watches ) )
+	ids, values, addrs := inv.idx.size( )
+	sc.set( "index_ids", ids )
+	sc.set( "index_values", values )
+	sc.set( "index_addrs", addrs )
+
+	return sc
+}
+
+/*
+	Return true if the reservation is still known to the inventory in some form.
+*/
+func (inv *Inventory) is_known( name string ) ( bool ) {
+	return inv.cache[name] != nil || inv.retry[name] != nil || inv.recovering[name] != nil
+}
+
+/*
+	Drop extinct reservations and stale side table entries, and copy the maps. If report is
+	true nothing is changed. Returns the json for the res-mgr part of the report.
+*/
+func (inv *Inventory) compact( report bool ) ( string ) {
+	before := inv.struct_counts( )
+	if report {
+		return compact_json( before, before, "" )
+	}
+
+	extinct := 0
+	for _, pmap := range []map[string]*gizmos.Pledge{ inv.cache, inv.retry } {
+		for key, p := range pmap {
+			if (*p).Is_expired() && (*p).Is_extinct( 120 ) && (*p).Is_pushed( ) {
+				rm_sheep.Baa( 2, "compact: extinct reservation purged: %s", key )
+				delete( pmap, key )
+				inv.idx.drop( key )
+				delete( inv.accounted, key )
+				extinct++
+			}
+		}
+	}
+
+	stale := 0
+	for name := range inv.accounted {
+		if ! inv.is_known( name ) {
+			delete( inv.accounted, name )
+			stale++
+		}
+	}
+	for name := range inv.fmstat {
+		if ! inv.is_known( name ) {
+			delete( inv.fmstat, name )
+			stale++
+		}
+	}
+	for _, tmap := range []map[string]int64{ inv.awaiting, inv.consent_wait, inv.doomed, inv.warned } {
+		for name := range tmap {
+			if ! inv.is_known( name ) {
+				delete( tmap, name )
+				stale++
+			}
+		}
+	}
+
+	inv.cache = copy_pmap( inv.cache )
+	inv.retry = copy_pmap( inv.retry )
+	inv.awaiting = copy_tmap( inv.awaiting )
+	inv.consent_wait = copy_tmap( inv.consent_wait )
+	inv.doomed = copy_tmap( inv.doomed )
+	inv.warned = copy_tmap( inv.warned )
+
+	acc := make( map[string]bool, len( inv.accounted ) )
+	for k, v := range inv.accounted {
+		acc[k] = v
+	}
+	inv.accounted = acc
+
+	fms := make( map[string]*res_fmstat, len( inv.fmstat ) )
+	for k, v := range inv.fmstat {
+		fms[k] = v
+	}
+	inv.fmstat = fms
+
+	inv.idx.shrink( time.Now().Unix() )
+
+	rm_sheep.Baa( 1, "compact: %d extinct reservations and %d stale entries dropped", extinct, stale )
+	return compact_json( before, inv.struct_counts( ), fmt.Sprintf( `"extinct": %d, "stale": %d`, extinct, stale ) )
+}
+
+// ---- network ------------------------------------------------------------------------------
+
+/*
+	Return the distinct obligations of the links and virtual links. Links in an mlag share
+	an obligation.
+*/
+func (n *Network) obligations( ) ( []*gizmos.Obligation ) {
+	seen := make( map[*gizmos.Obligation]bool )
+	obs := make( []*gizmos.Obligation, 0, len( n.links ) + len( n.vlinks ) )
+	for _, lmap := range []map[string]*gizmos.Link{ n.links, n.vlinks } {
+		for _, l := range lmap {
+			if ob := l.Get_allotment(); ob != nil && ! seen[ob] {
+				seen[ob] = true
+				obs = append( obs, ob )
+			}
+		}
+	}
+
+	return obs
+}
+
+func (n *Network) struct_counts( ) ( *struct_counts ) {
+	sc := mk_struct_counts( )
+	sc.set( "switches", len( n.switches ) )
+	sc.set( "hosts", len( n.hosts ) )
+	sc.set( "links", len( n.links ) )
+	sc.set( "vlinks", len( n.vlinks ) )
+	sc.set( "mlags", len( n.mlags ) )
+	sc.set( "vm2ip", len( n.vm2ip ) )
+	sc.set( "ip2mac", len( n.ip2mac ) )
+	sc.set( "ip2fip", len( n.ip2fip ) )
+	sc.set( "limits", len( n.limits ) )
+
+	obs := n.obligations( )
+	slices := 0
+	for _, ob := range obs {
+		slices += ob.Get_nslices()
+	}
+	sc.set( "obligations", len( obs ) )
+	sc.set( "time_slices", slices )
+
+	return sc
+}
+
+/*
+	Compact the link obligations. If report is true nothing is changed. Returns the json for
+	the network part of the report.
+*/
+func (n *Network) compact( report bool ) ( string ) {
+	before := n.struct_counts( )
+	if report {
+		return compact_json( before, before, "" )
+	}
+
+	removed := 0
+	for _, ob := range n.obligations( ) {
+		removed += ob.Compact( )
+	}
+
+	net_sheep.Baa( 1, "compact: %d time slices removed from link obligations", removed )
+	return compact_json( before, n.struct_counts( ), "" )
+}
+
+// ---- http ---------------------------------------------------------------------------------
+
+func mem_json( ms *runtime.MemStats ) ( string ) {
+	return fmt.Sprintf( `{ "heap_alloc": %d, "heap_inuse": %d, "heap_idle": %d, "heap_released": %d, "heap_sys": %d, "heap_objects": %d, "sys": %d, "num_gc": %d, "goroutines": %d }`,
+		ms.HeapAlloc, ms.HeapInuse, ms.HeapIdle, ms.HeapReleased, ms.HeapSys, ms.HeapObjects, ms.Sys, ms.NumGC, runtime.NumGoroutine() )
+}
+
+/*
+	Have res-mgr and network compact their structures (or only count them if report is
+	true) and build the report. Must not be called from network or reservation manager
+	goroutines.
+*/
+func compact( report bool ) ( string ) {
+	var (
+		before	runtime.MemStats
+		after	runtime.MemStats
+	)
+
+	runtime.ReadMemStats( &before )
+
+	my_ch := make( chan *ipc.Chmsg )
+	parts := make( []string, 0, 2 )
+	for _, mgr := range []struct{ name string; ch chan *ipc.Chmsg }{ { "resmgr", rmgr_ch }, { "network", nw_ch } } {
+		req := ipc.Mk_chmsg( )
+		req.Send_req( mgr.ch, my_ch, REQ_COMPACT, report, nil )
+		req = <- my_ch
+		if s, ok := req.Response_data.( string ); ok {
+			parts = append( parts, fmt.Sprintf( "%q: %s", mgr.name, s ) )
+		}
+	}
+
+	if ! report {
+		debug.FreeOSMemory( )				// forces a collection and returns what it can to the system
+	}
+	runtime.ReadMemStats( &after )
+
+	http_sheep.Baa( 1, "compact: heap in use %d -> %d bytes", before.HeapInuse, after.HeapInuse )
+	return fmt.Sprintf( `{ "compacted": %v, %s, "memory": { "before": %s, "after": %s } }`, ! report, strings.Join( parts, ", " ), mem_json( &before ), mem_json( &after ) )
+}
@@ -0,0 +1,118 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	events
+	Abstract:	State change events published to a sink (normally a kafka topic or amqp
+				exchange) so that downstream systems can follow tegu without polling.
+				Each event is a json object:
+					{ "type": "event", "event": "name", "ts": unix-time, "data": {...} }
+
+				Events generated:
+					reservation.added		data is the pledge json with the origin of the request (http_origin.go)
+					reservation.deleted		data is the pledge json with the origin
+					reservation.expired		data is the pledge json
+					reservation.installed	data is the pledge json
+					reservation.fmod_failed	data has the reservation id, host and agent outcome
+					reservation.install_failed	data is the pledge json
+					reservation.fip_changed	data has the reservation id, floating ip, old and new addresses
+					reservation.nat_nomatch	data has the reservation id, host and probe result (fq_natprobe.go)
+					reservation.verify_failed	data has the reservation id, host, direction and result (fq_verify.go)
+					reservation.sla_breach	data has the breach and the pledge json (res_mgr_sla.go)
+					reservation.sla_cleared	data is the breach as it ended
+					reservation.bulk_complete	data has the reservation id and bytes moved (res_mgr_bulk.go)
+					reservation.bulk_raised	data has the reservation id, bytes remaining and old and new rates
+					reservation.bulk_behind	data has the reservation id, bytes remaining, rate and rate needed
+					fip.moved				data has the floating ip, old and new addresses
+					agent.degraded			no agents are connected; data has the time
+					agent.restored			an agent connected; data has the seconds degraded and actions pending
+					quarantine.added		data is the quarantine (name, kind, target, reason, counts)
+					quarantine.lifted		data is the quarantine as it was lifted
+					topology.changed		data has switch, link and host counts
+
+	CFG:		events:sink - sink spec (see sink.go); events are not generated when not set
+				events:queue - number of events that may be queued before they are dropped (4096)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Listed flow-mod status events (res_mgr_fmstat.go).
+				16 Oct 2026 - Listed floating ip and nat match probe events.
+				16 Oct 2026 - Listed agent degraded and restored events.
+				16 Oct 2026 - Listed quarantine events.
+				16 Oct 2026 - Listed bulk transfer events.
+				16 Oct 2026 - Listed the verification failure event.
+				16 Oct 2026 - Listed the sla breach events.
+				16 Oct 2026 - Added and deleted events carry the request origin.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+var event_sink	*rec_sink					// nil if events are not configured
+
+/*
+	Create the event sink from the config. Called from Initialise.
+*/
+func events_init( ) {
+	if cfg_data["events"] == nil {
+		return
+	}
+
+	p := cfg_data["events"]["sink"]
+	if p == nil || *p == "" {
+		return
+	}
+
+	qsize := 4096
+	if q := cfg_data["events"]["queue"]; q != nil {
+		qsize = clike.Atoi( *q )
+	}
+
+	var err error
+	if event_sink, err = mk_sink( *p, qsize ); err != nil {
+		tegu_sheep.Baa( 0, "ERR: unable to create event sink: %s: %s  [TGUEVT000]", *p, err )
+		event_sink = nil
+		return
+	}
+
+	tegu_sheep.Baa( 1, "events will be published to %s", *p )
+}
+
+/*
+	Publish an event. Data must be a json object (or "{ }").
+*/
+func publish_event( event string, data string ) {
+	if event_sink == nil {
+		return
+	}
+
+	if data == "" {
+		data = "{ }"
+	}
+	event_sink.send( fmt.Sprintf( `{ "type": "event", "event": %q, "ts": %d, "data": %s }`, event, time.Now().Unix(), data ) )
+}
@@ -0,0 +1,200 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	fq_bulkmeter
+	Abstract:	Byte metering for bulk transfer reservations (res_mgr_bulk.go). Each bandwidth
+				flow-mod request sent to an agent for a bulk transfer is remembered (reservation,
+				host and the two macs). Every fqmgr:bulk_meter seconds the agent of each host is
+				asked for the bytes counted by the outbound flow-mods (fmod_bytes action,
+				ql_fmod_bytes) and the bytes moved since the last count are passed to res-mgr
+				summed by reservation.
+
+				Counters start over when flow-mods are replaced (a re-push after a rate change
+				for instance); a count lower than the last is taken to be all new bytes. A few
+				bytes moved between the last count and the replacement are lost, which only
+				errs on the side of more bandwidth.
+
+	CFG:		fqmgr:bulk_meter - seconds between byte counts; 0 disables (60)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	One set of flow-mods (reservation, host and direction) being metered.
+*/
+type bulk_flow struct {
+	id		string
+	host	string						// host as given to the agent (with suffix)
+	expiry	int64
+	last	int64						// bytes at the last count; -1 until counted
+}
+
+type bulkmeter struct {
+	freq	int64
+	flows	map[string]*bulk_flow		// keyed by host and id,smac,dmac as given to the agent
+}
+
+/*
+	Build the meter from the config. Nil is returned if metering is disabled.
+*/
+func mk_bulkmeter( ) ( bm *bulkmeter ) {
+	bm = &bulkmeter{
+		freq:	60,
+		flows:	make( map[string]*bulk_flow ),
+	}
+
+	if cfg_data["fqmgr"] != nil {
+		if p := cfg_data["fqmgr"]["bulk_meter"]; p != nil {
+			bm.freq = clike.Atoi64( *p )
+		}
+	}
+
+	if bm.freq <= 0 {
+		fq_sheep.Baa( 1, "bulk transfer metering is disabled; bulk reservations will not be completed early or have rates raised" )
+		return nil
+	}
+
+	fq_sheep.Baa( 1, "bulk transfer bytes are counted every %ds", bm.freq )
+	return bm
+}
+
+/*
+	Remember a bandwidth flow-mod request that was just sent to an agent if it is for a
+	bulk transfer.
+*/
+func (bm *bulkmeter) pushed( fdata *Fq_req, phost_suffix *string ) {
+	if bm == nil || fdata == nil || ! fdata.Bulk || fdata.Id == nil || fdata.Espq == nil || fdata.Espq.Switch == "" {
+		return
+	}
+	if fdata.Match.Smac == nil || fdata.Match.Dmac == nil {
+		return
+	}
+
+	host := &fdata.Espq.Switch
+	if phost_suffix != nil {
+		host = add_phost_suffix( host, phost_suffix )
+	}
+
+	key := *host + " " + *fdata.Id + "," + *fdata.Match.Smac + "," + *fdata.Match.Dmac
+	if bf := bm.flows[key]; bf != nil {
+		bf.expiry = fdata.Expiry					// a re-push; counts pick up where they were
+		return
+	}
+
+	bm.flows[key] = &bulk_flow{ id: *fdata.Id, host: *host, expiry: fdata.Expiry, last: -1 }
+}
+
+/*
+	Send a byte count request to each host with bulk transfer flow-mods. Expired entries
+	are dropped.
+*/
+func (bm *bulkmeter) meter( ) {
+	if bm == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	hosts := make( map[string][]string )
+	for k, bf := range bm.flows {
+		if bf.expiry <= now {
+			delete( bm.flows, k )
+			continue
+		}
+
+		hosts[bf.host] = append( hosts[bf.host], k[len( bf.host ) + 1:] )
+	}
+
+	for host, list := range hosts {
+		msg := &agent_cmd{ Ctype: "action_list" }
+		msg.Actions = make( []action, 1 )
+		msg.Actions[0].Atype = "fmod_bytes"
+		msg.Actions[0].Hosts = []string{ host }
+		msg.Actions[0].Fdata = list
+
+		jmsg, err := json.Marshal( msg )
+		if err != nil {
+			fq_sheep.Baa( 1, "unable to build bulk byte count request: %s", err )
+			continue
+		}
+
+		tmsg := ipc.Mk_chmsg( )
+		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( jmsg ), nil )
+	}
+
+	if len( hosts ) > 0 {
+		fq_sheep.Baa( 2, "bulk byte counts requested from %d hosts", len( hosts ) )
+	}
+}
+
+/*
+	Evaluate the records returned by an agent: host id,smac,dmac bytes. The bytes moved
+	since the last count are passed to res-mgr by reservation.
+*/
+func (bm *bulkmeter) metered( recs []string ) {
+	if bm == nil {
+		return
+	}
+
+	moved := make( map[string]int64 )
+	for _, r := range recs {
+		toks := strings.Fields( r )
+		if len( toks ) != 3 {
+			continue
+		}
+
+		bf := bm.flows[toks[0] + " " + toks[1]]
+		if bf == nil {
+			continue								// expired while the count was running
+		}
+
+		n := clike.Atoi64( toks[2] )
+		delta := n
+		if bf.last >= 0 && n >= bf.last {
+			delta = n - bf.last
+		}
+		bf.last = n
+
+		if delta > 0 {
+			moved[bf.id] += delta
+		}
+	}
+
+	if len( moved ) > 0 {
+		fq_sheep.Baa( 2, "bulk transfer bytes moved: %v", moved )
+		tmsg := ipc.Mk_chmsg( )
+		tmsg.Send_req( rmgr_ch, nil, REQ_BULK_USAGE, moved, nil )
+	}
+}
@@ -0,0 +1,348 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	fq_flowtab
+	Abstract:	Flow table occupancy. Fq-mgr keeps an estimate of the number of flow table entries
+				on each switch (virtual switch on each physical host): every bandwidth flow-mod
+				request sent to an agent is assumed to install fqmgr:fmods_per_action entries
+				which remain until the request's expiry. A re-push (refresh, pause, delete) of the
+				same flow replaces the earlier estimate rather than adding to it.
+
+				Now and again an audit is requested: agents which support the flow_count action
+				report the number of entries actually on each switch. Entries which we did not
+				install (other applications, openstack) are taken to be the difference between
+				that count and our estimate at the time, and are added to the estimate until the
+				next audit.
+
+				When a reservation is added, res-mgr gives us the number of flow-mod requests it
+				will cause on each switch. If that would put a switch over its budget, which
+				comes from the switch's model, a warning is logged or, if fqmgr:flow_budget_action
+				is refuse, the reservation is rejected.
+
+				Switches are tracked by the name that res-mgr uses (without the phost suffix).
+
+	CFG:		fqmgr:flow_budget - space separated model:entries list; the model default applies
+					to switches without a model (no budget if not given)
+				fqmgr:switch_models - space separated switch:model list
+				fqmgr:fmods_per_action - entries estimated for each bw flow-mod request (4)
+				fqmgr:flow_budget_action - warn or refuse (warn)
+				fqmgr:flow_audit - seconds between audits; 0 disables (900)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Multicast demand.
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type ft_entry struct {
+	n		int							// estimated entries
+	expiry	int64
+}
+
+type flowtab struct {
+	per_action	int								// entries estimated for each flow-mod request
+	budgets		map[string]int					// model -> budget
+	models		map[string]string				// switch -> model
+	refuse		bool							// refuse rather than warn when over budget
+	audit_freq	int64
+	entries		map[string]map[string]*ft_entry	// switch -> flow key -> estimate
+	other		map[string]int					// switch -> entries not installed by us at last audit
+}
+
+/*
+	Build the tracker from the config.
+*/
+func mk_flowtab( ) ( ft *flowtab ) {
+	ft = &flowtab {
+		per_action:	4,
+		budgets:	make( map[string]int ),
+		models:		make( map[string]string ),
+		audit_freq:	900,
+		entries:	make( map[string]map[string]*ft_entry ),
+		other:		make( map[string]int ),
+	}
+
+	if cfg_data["fqmgr"] == nil {
+		return
+	}
+
+	if p := cfg_data["fqmgr"]["flow_budget"]; p != nil {
+		for _, tok := range strings.Fields( *p ) {
+			if mb := strings.SplitN( tok, ":", 2 ); len( mb ) == 2 {
+				ft.budgets[mb[0]] = clike.Atoi( mb[1] )
+			}
+		}
+	}
+	if p := cfg_data["fqmgr"]["switch_models"]; p != nil {
+		for _, tok := range strings.Fields( *p ) {
+			if sm := strings.SplitN( tok, ":", 2 ); len( sm ) == 2 {
+				ft.models[sm[0]] = sm[1]
+			}
+		}
+	}
+	if p := cfg_data["fqmgr"]["fmods_per_action"]; p != nil {
+		ft.per_action = clike.Atoi( *p )
+	}
+	if p := cfg_data["fqmgr"]["flow_budget_action"]; p != nil {
+		ft.refuse = *p == "refuse"
+	}
+	if p := cfg_data["fqmgr"]["flow_audit"]; p != nil {
+		ft.audit_freq = clike.Atoi64( *p )
+	}
+
+	return
+}
+
+/*
+	Return the flow table budget for the switch; 0 if there is none.
+*/
+func (ft *flowtab) budget( sw string ) ( int ) {
+	if b, ok := ft.budgets[ft.models[sw]]; ok {
+		return b
+	}
+
+	return ft.budgets["default"]
+}
+
+/*
+	Record a bandwidth flow-mod request that is being sent to an agent.
+*/
+func (ft *flowtab) pushed( fdata *Fq_req ) {
+	if ft == nil || fdata == nil || fdata.Espq == nil || fdata.Espq.Switch == "" {
+		return
+	}
+
+	sw := fdata.Espq.Switch
+	if ft.entries[sw] == nil {
+		ft.entries[sw] = make( map[string]*ft_entry )
+	}
+
+	key := fmt.Sprintf( "%s %s %s %s %s", str_or_empty( fdata.Id ), str_or_empty( fdata.Match.Ip1 ), str_or_empty( fdata.Match.Ip2 ), str_or_empty( fdata.Tptype ), str_or_empty( fdata.Exttyp ) )
+	ft.entries[sw][key] = &ft_entry{ n: ft.per_action, expiry: fdata.Expiry }
+}
+
+/*
+	Return the estimated number of entries on the switch, dropping expired estimates.
+*/
+func (ft *flowtab) occupancy( sw string ) ( int ) {
+	now := time.Now().Unix()
+	n := ft.other[sw]
+	for k, e := range ft.entries[sw] {
+		if e.expiry <= now {
+			delete( ft.entries[sw], k )
+			continue
+		}
+		n += e.n
+	}
+
+	return n
+}
+
+/*
+	Check the flow-mod requests (by switch) that a new reservation will cause against the
+	budgets. An error is returned only when over budget and refusing.
+*/
+func (ft *flowtab) check( demand map[string]int ) ( err error ) {
+	if ft == nil {
+		return nil
+	}
+
+	for sw, nreq := range demand {
+		b := ft.budget( sw )
+		if b <= 0 {
+			continue
+		}
+
+		occ := ft.occupancy( sw )
+		if need := nreq * ft.per_action; occ + need > b {
+			fq_sheep.Baa( 0, "WRN: flow table budget on %s would be exceeded: estimated %d + %d entries; budget %d  [TGUFQM013]", sw, occ, need, b )
+			if ft.refuse {
+				return mk_err( ERR_CAPACITY, "flow table budget on switch %s would be exceeded (estimated %d + %d entries, budget %d)", sw, occ, need, b )
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+	Ask the agents to count the entries on each switch that we have pushed to.
+*/
+func (ft *flowtab) audit( phost_suffix *string ) {
+	if ft == nil {
+		return
+	}
+
+	hosts := make( []string, 0, len( ft.entries ) )
+	for sw := range ft.entries {
+		if phost_suffix != nil {
+			sw = *add_phost_suffix( &sw, phost_suffix )
+		}
+		hosts = append( hosts, sw )
+	}
+	if len( hosts ) == 0 {
+		return
+	}
+
+	msg := &agent_cmd{ Ctype: "action_list" }
+	msg.Actions = make( []action, 1 )
+	msg.Actions[0].Atype = "flow_count"
+	msg.Actions[0].Hosts = hosts
+
+	jmsg, err := json.Marshal( msg )
+	if err != nil {
+		fq_sheep.Baa( 1, "unable to build flow count request: %s", err )
+		return
+	}
+
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( jmsg ), nil )
+	fq_sheep.Baa( 2, "flow table audit requested for %d switches", len( hosts ) )
+}
+
+/*
+	Reconcile with the counts returned by an agent. Records are "host count".
+*/
+func (ft *flowtab) audited( recs []string, phost_suffix *string ) {
+	if ft == nil {
+		return
+	}
+
+	for _, r := range recs {
+		toks := strings.Fields( r )
+		if len( toks ) != 2 {
+			continue
+		}
+
+		sw := toks[0]
+		if phost_suffix != nil {
+			sw = strings.TrimSuffix( sw, *phost_suffix )
+		}
+
+		count := clike.Atoi( toks[1] )
+		ft.other[sw] = 0
+		ours := ft.occupancy( sw )
+		if count > ours {
+			ft.other[sw] = count - ours
+		}
+
+		fq_sheep.Baa( 2, "flow table audit: %s has %d entries; %d estimated from reservations", sw, count, ours )
+		if b := ft.budget( sw ); b > 0 && count > b {
+			fq_sheep.Baa( 0, "WRN: flow table on %s has %d entries which exceeds the budget of %d  [TGUFQM014]", sw, count, b )
+		}
+	}
+}
+
+/*
+	Return the string or an empty string if the pointer is nil.
+*/
+func str_or_empty( s *string ) ( string ) {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+/*
+	Return the number of transport types that flow-mods are generated for; see bw_push_res().
+*/
+func tptype_count( proto *string, p1 *string, p2 *string ) ( int ) {
+	if proto != nil && *proto != "" {
+		return len( strings.Fields( *proto ) )
+	}
+	if (p1 != nil && *p1 != "0") || (p2 != nil && *p2 != "0") {
+		return 2											// udp and tcp
+	}
+
+	return 1
+}
+
+/*
+	Return the number of bandwidth flow-mod requests, by switch, that pushing the pledge
+	will generate. Called by res-mgr.
+*/
+func flow_demand( gp *gizmos.Pledge ) ( demand map[string]int ) {
+	demand = make( map[string]int )
+	ts := queue_ts( *gp )
+
+	switch p := (*gp).(type) {
+		case *gizmos.Pledge_bw:
+			_, _, p1, p2, _, _, _, _ := p.Get_values( )
+			ntp := tptype_count( p.Get_proto(), p1, p2 )
+			for _, path := range p.Get_path_list() {
+				if spq := path.Get_ilink_spq( p.Get_id(), ts ); spq != nil && spq.Switch != "" {
+					demand[spq.Switch] += ntp
+				}
+			}
+
+		case *gizmos.Pledge_mcast:
+			for _, path := range p.Get_path_list() {				// one request on the source switch and on each switch with receivers
+				if sw := path.Get_h2().Get_switch_id( 0 ); sw != nil && *sw != "" {
+					demand[*sw] = 1
+				}
+			}
+			if pl := p.Get_path_list(); len( pl ) > 0 {
+				if spq := pl[0].Get_ilink_spq( p.Get_id(), ts ); spq != nil && spq.Switch != "" {
+					demand[spq.Switch] = 1
+				}
+			}
+
+		case *gizmos.Pledge_bwow:
+			_, _, p1, p2, _, _ := p.Get_values( )
+			if gate := p.Get_gate(); gate != nil {
+				if spq := gate.Get_spq( p.Get_id(), ts ); spq != nil && spq.Switch != "" {
+					demand[spq.Switch] += tptype_count( p.Get_proto(), p1, p2 )
+				}
+			}
+	}
+
+	return demand
+}
+
+/*
+	Ask fq-mgr whether the pledge fits within the flow table budgets. Called by res-mgr.
+*/
+func check_flowtab( gp *gizmos.Pledge ) ( error ) {
+	demand := flow_demand( gp )
+	if len( demand ) == 0 {
+		return nil
+	}
+
+	ch := make( chan *ipc.Chmsg )
+	req := ipc.Mk_chmsg( )
+	req.Send_req( fq_ch, ch, REQ_FLOWTAB_CHECK, demand, nil )
+	req = <- ch
+	return req.State
+}
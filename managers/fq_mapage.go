@@ -0,0 +1,252 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	fq_mapage
+	Abstract:	Staleness tracking for the translation maps that flow-mods are built from: the
+				ip2mac map fq-mgr gets from osif, and the mac2phost map network gets from the
+				agents. Each map records when it was last received and a version which is bumped
+				whenever its content changes.
+
+				Fq-mgr refuses to build flow-mods from an ip2mac map older than fqmgr:map_max_age.
+				The request is held, a new map is asked for straight away, and the held requests
+				are replayed, in order, when it arrives. Requests held longer than fqmgr:map_hold
+				seconds are dropped (an error goes back to any waiting sender). To keep the map warm
+				a new one is asked for once it is half way to the limit. Network asks the agents for
+				a new mac2phost map when it finds its copy is stale.
+
+	CFG:		fqmgr:map_max_age - seconds before a map is stale; 0 disables (3600)
+				fqmgr:map_hold - seconds a request waits for a fresh ip2mac map (30)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+)
+
+const map_ask_gap int64 = 5							// min seconds between refresh requests
+
+type map_age struct {
+	updated		int64								// when the map was last received; 0 if never
+	version		int64								// bumped when the content changes
+	max_age		int64								// older than this is stale; 0 disables
+	asked		int64								// when a refresh was last requested
+}
+
+/*
+	Requests held while the ip2mac map is stale.
+*/
+type map_holdq struct {
+	msgs		[]*ipc.Chmsg
+	since		[]int64
+	hold		int64								// max seconds a request is held
+}
+
+/*
+	Return the max age from the config; shared by fq-mgr and network.
+*/
+func map_max_age( ) ( int64 ) {
+	if p := cfg_data["fqmgr"]["map_max_age"]; p != nil {
+		if v := clike.Atoi64( *p ); v >= 0 {
+			return v
+		}
+	}
+	return 3600
+}
+
+func mk_map_age( max_age int64 ) ( *map_age ) {
+	return &map_age{ max_age: max_age }
+}
+
+func mk_map_holdq( ) ( *map_holdq ) {
+	hq := &map_holdq{ hold: 30 }
+	if p := cfg_data["fqmgr"]["map_hold"]; p != nil {
+		hq.hold = clike.Atoi64( *p )
+	}
+	if hq.hold < 1 {
+		hq.hold = 1
+	}
+	return hq
+}
+
+/*
+	Return true if the content of the two maps differs.
+*/
+func map_changed( old map[string]*string, nm map[string]*string ) ( bool ) {
+	if len( old ) != len( nm ) {
+		return true
+	}
+	for k, v := range nm {
+		ov := old[k]
+		if ov == nil || v == nil {
+			if ov != v {
+				return true
+			}
+			continue
+		}
+		if *ov != *v {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Note that a new copy of the map was received.
+*/
+func (ma *map_age) touch( changed bool ) {
+	if ma == nil {
+		return
+	}
+
+	ma.updated = time.Now().Unix()
+	if changed {
+		ma.version++
+	}
+}
+
+func (ma *map_age) age( now int64 ) ( int64 ) {
+	if ma == nil || ma.updated == 0 {
+		return -1
+	}
+	return now - ma.updated
+}
+
+/*
+	Return true if the map is older than the limit (or has never been received).
+*/
+func (ma *map_age) is_stale( now int64 ) ( bool ) {
+	if ma == nil || ma.max_age <= 0 {
+		return false
+	}
+	return ma.updated == 0 || now - ma.updated > ma.max_age
+}
+
+/*
+	Return true if the map is more than half way to stale and should be refreshed.
+*/
+func (ma *map_age) is_cooling( now int64 ) ( bool ) {
+	if ma == nil || ma.max_age <= 0 || ma.updated == 0 {		// never received is left to the requests which need it
+		return false
+	}
+	return now - ma.updated > ma.max_age / 2
+}
+
+/*
+	Return true if a refresh should be requested now; requests are limited to one every
+	gap seconds (never less than a few).
+*/
+func (ma *map_age) ask( now int64, gap int64 ) ( bool ) {
+	if gap < map_ask_gap {
+		gap = map_ask_gap
+	}
+	if ma == nil || now - ma.asked < gap {
+		return false
+	}
+	ma.asked = now
+	return true
+}
+
+/*
+	Returns true if the request type builds flow-mods from the ip2mac map.
+*/
+func needs_ip2mac( mtype int ) ( bool ) {
+	switch mtype {
+		case REQ_GEN_FMOD, REQ_BW_RESERVE, REQ_BWOW_RESERVE, REQ_MCAST_RESERVE, REQ_PT_RESERVE, REQ_IE_RESERVE, REQ_ST_RESERVE:
+			return true
+	}
+	return false
+}
+
+/*
+	Ask osif to send fq-mgr a new ip2mac map. The map arrives as a REQ_IP2MACMAP request.
+*/
+func ask_ip2mac( ) {
+	req := ipc.Mk_chmsg( )
+	req.Send_req( osif_ch, nil, REQ_IP2MACMAP, nil, nil )
+}
+
+/*
+	Ask the agent manager to have the agents send a new mac2phost map.
+*/
+func ask_mac2phost( ) {
+	req := ipc.Mk_chmsg( )
+	req.Send_req( am_ch, nil, REQ_MAC2PHOST, nil, nil )
+}
+
+func (hq *map_holdq) add( msg *ipc.Chmsg, now int64 ) {
+	hq.msgs = append( hq.msgs, msg )
+	hq.since = append( hq.since, now )
+}
+
+func (hq *map_holdq) len( ) ( int ) {
+	return len( hq.msgs )
+}
+
+/*
+	Send the held requests back to ch, in the order received, and empty the queue. They are
+	written from a goroutine as the caller is the reader of ch.
+*/
+func (hq *map_holdq) release( ch chan *ipc.Chmsg ) ( n int ) {
+	n = len( hq.msgs )
+	if n == 0 {
+		return
+	}
+
+	go func( list []*ipc.Chmsg ) {
+		for _, m := range list {
+			ch <- m
+		}
+	}( hq.msgs )
+
+	hq.msgs = nil
+	hq.since = nil
+	return
+}
+
+/*
+	Drop requests held longer than the limit, sending an error to any sender that waits.
+	Returns the number dropped.
+*/
+func (hq *map_holdq) expire( now int64 ) ( n int ) {
+	i := 0
+	for ; i < len( hq.msgs ) && now - hq.since[i] > hq.hold; i++ {
+		m := hq.msgs[i]
+		if m.Response_ch != nil {
+			m.State = fmt.Errorf( "ip2mac map is stale and no fresh map arrived within %ds", hq.hold )
+			m.Response_ch <- m
+		}
+	}
+
+	hq.msgs = hq.msgs[i:]
+	hq.since = hq.since[i:]
+	return i
+}
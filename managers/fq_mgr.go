@@ -30,6 +30,19 @@
 					fqmgr:queue_check - the frequency (seconds) between checks to see if queues need to be reset (5)
 					fqmgr:host_check  - the frequency (seconds) between checks to see  what _real_ hosts open stack reports (180)
 					fqmgr:switch_hosts- A space sep list of hosts to set switch queues on; if given then openstack is _not_ queried (no list)
+					fqmgr:backend     - ovs (agents, default) or ovn (see fq_ovn.go)
+					fqmgr:ovn_nbctl   - ovn-nbctl command and options when backend is ovn (ovn-nbctl)
+					fqmgr:flow_budget, switch_models, fmods_per_action, flow_budget_action, flow_audit - flow table
+						occupancy tracking (see fq_flowtab.go)
+					fqmgr:tor_driver, tor_cmd, tor_url, tor_switches - rate limits pushed to physical switches
+						(see fq_tor.go)
+					fqmgr:nat_probe, nat_probe_window, nat_probe_tries, nat_probe_timeout - verification that flow-mods matching
+						on a floating ip see traffic (see fq_natprobe.go)
+					fqmgr:bulk_meter  - seconds between byte counts of bulk transfer flow-mods (see fq_bulkmeter.go)
+					fqmgr:verify_probe, verify_window, verify_tries, verify_timeout, verify_tolerance - verification of the
+						rate and marking of a reservation's traffic (see fq_verify.go)
+					fqmgr:queue_retry, queue_tries - resending of queue maps that a host failed to apply
+						(see fq_qapply.go)
 					default:sdn_host  - the host name where skoogi (sdn controller) is running
 					
 	Date:		29 December 2013
@@ -60,6 +73,22 @@
 				01 Feb 2015 - Corrected bug itroduced when host name removed from fmod parmss (agent w/ ssh-broker changes).
 				19 Feb 2015 - Change in adjust_queues_agent to allow create queues to be driven from agent without -h on command line.
 				21 Mar 2015 - Changes to support new bandwith endpoint flow-mod agent script.
+				16 Oct 2026 - Added ovn northbound backend selectable with fqmgr:backend.
+				16 Oct 2026 - Correlation id added to flow-mod request log messages.
+				16 Oct 2026 - Track flow table occupancy per switch and check new reservations against budgets.
+				16 Oct 2026 - Multicast flow-mod requests.
+				16 Oct 2026 - Bandwidth priority tier adjustment is passed to the agent (fq_pri.go).
+				16 Oct 2026 - Bandwidth limits pushed to physical switches when configured (fq_tor.go).
+				16 Oct 2026 - Flow-mods matching on a floating ip are probed for traffic (fq_natprobe.go).
+				16 Oct 2026 - Bytes sent by bulk transfer flow-mods are metered (fq_bulkmeter.go).
+				16 Oct 2026 - Reservations are verified after a push when configured (fq_verify.go).
+				16 Oct 2026 - Reservation rates and queue drops are polled for sla checks when configured (fq_sla.go).
+				16 Oct 2026 - Flow-mod requests are held, not built, while the ip2mac map is stale (fq_mapage.go).
+				16 Oct 2026 - Queue maps are verified and retried by host rather than sent blind (fq_qapply.go).
+				16 Oct 2026 - Steering is not sent when the backend is ovn.
+				16 Oct 2026 - Periodic work is scheduled through the Ticker interface given to fq_mgr (seams.go).
+				16 Oct 2026 - Requests are logged with their correlation id.
+				16 Oct 2026 - Periodic work reports when it can not be scheduled.
 */
 
 package managers
@@ -175,81 +204,6 @@ func adjust_queues( qlist []string, cmd_base *string, hlist *string ) {
 }
 
 
-/*
-	Builds one setqueue json request per host and sends it to the agent. If there are
-	multiple agents attached, the individual messages will be fanned out across the
-	available agents, otherwise the agent will just process them sequentially which
-	would be the case if we put all hosts into the same message.
-
-	This now augments the switch name with the suffix; needs to be fixed for q-full
-	so that it handles intermediate names properly.
-
-	In the world with the ssh-broker, there is no -h host on the command line and
-	the script's view of host name might not have the suffix that we are supplied
-	with.  To prevent the script from not recognising an entry, we must now
-	put an entry for both the host name and hostname+suffix into the list.
-*/
-func adjust_queues_agent( qlist []string, hlist *string, phsuffix *string ) {
-	var (
-		qjson	string						// final full json blob
-		qjson_pfx	string					// static prefix
-		sep = ""
-	)
-
-	target_hosts := make( map[string]bool )					// hosts that are actually affected by the queue list
-	if phsuffix != nil {									// need to convert the host names in the list to have suffix
-		nql := make( []string, len( qlist ) * 2 )			// need one for each possible host name
-
-		offset := len( qlist )								// put the originals into the second half of the array
-		for i := range qlist {
-			nql[offset+i] = qlist[i]								// just copy the original
-
-			toks := strings.SplitN( qlist[i], "/", 2 )				// split host from front
-			if len( toks ) == 2 {
-				nh := add_phost_suffix( &toks[0],  phsuffix )		// add the suffix
-				nql[i] = *nh + "/" +  toks[1]
-				target_hosts[*nh] = true
-			} else {
-				nql[i] = qlist[i]
-				fq_sheep.Baa( 1, "target host not snarfed: %s", qlist[i] )
-			}
-		}
-
-		qlist = nql
-	} else {												// just snarf the list of hosts affected
-		for i := range qlist {
-			toks := strings.SplitN( qlist[i], "/", 2 )				// split host from front
-			if len( toks ) == 2 {
-				target_hosts[toks[0]] = true
-			}
-		}
-	}
-
-	fq_sheep.Baa( 1, "adjusting queues:  sending %d queue setting items to agents",  len( qlist ) );
-
-	qjson_pfx = `{ "ctype": "action_list", "actions": [ { "atype": "setqueues", "qdata": [ `
-
-	for i := range qlist {
-		fq_sheep.Baa( 2, "queue info: %s", qlist[i] )
-		qjson_pfx+= fmt.Sprintf( "%s%q", sep, qlist[i] )
-		sep = ", "
-	}
-
-	qjson_pfx+= ` ], "hosts": [ `
-
-	sep = ""
-	for h := range target_hosts {			// build one request per host and send to agents -- multiple ageents then these will fan out
-		qjson = qjson_pfx					// seed the next request with the constant prefix
-		qjson += fmt.Sprintf( "%s%q", sep, h )
-
-		qjson += ` ] } ] }`
-	
-		fq_sheep.Baa( 2, "queue update: host=%s %s", h, qjson )
-		tmsg := ipc.Mk_chmsg( )
-		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, qjson, nil )		// send this as a short request to one agent
-	}
-}
-
 /*
 	Send a bandwidth endpoint flow-mod request to the agent manager.
 	This is little more than a wrapper that converts the fq_req into
@@ -286,6 +240,7 @@ func send_bw_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *strin
 	msg.Actions[0].Hosts = make( []string, 1 )					// bw endpoint flow-mods created on just one host
 	msg.Actions[0].Hosts[0] = *host
 	msg.Actions[0].Data = data.To_bw_map()						// convert useful data from caller into parms for agent
+	add_pri_adj( msg.Actions[0].Data, gizmos.PT_BANDWIDTH )
 
 	json, err := json.Marshal( msg )						// bundle into a json string
 	if err != nil {
@@ -295,7 +250,7 @@ func send_bw_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *strin
 		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
 	}
 
-	fq_sheep.Baa( 2, "bandwidth endpoint flow-mod request sent to agent manager: %s", json )
+	fq_sheep.Baa( 2, "bandwidth endpoint flow-mod request sent to agent manager: cid=%s %s", data.Cid, json )
 	
 }
 
@@ -338,6 +293,7 @@ func send_bwow_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *str
 	msg.Actions[0].Hosts = make( []string, 1 )					// oneway flow-mods created on just one host
 	msg.Actions[0].Hosts[0] = *host
 	msg.Actions[0].Data = data.To_bwow_map()					// convert useful data from caller into parms for agent
+	add_pri_adj( msg.Actions[0].Data, gizmos.PT_BANDWIDTH )
 
 	json, err := json.Marshal( msg )						// bundle into a json string
 	if err != nil {
@@ -347,7 +303,49 @@ func send_bwow_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *str
 		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
 	}
 
-	fq_sheep.Baa( 2, "oneway bandwidth flow-mod request sent to agent manager: %s", json )
+	fq_sheep.Baa( 2, "oneway bandwidth flow-mod request sent to agent manager: cid=%s %s", data.Cid, json )
+}
+
+/*
+	Send a multicast flow-mod request for one switch of a multicast tree. On the switch where
+	the source is attached the flow-mods mark (and queue) traffic sent to the group; on a
+	switch with receivers they replicate the group's traffic to each receiver's port. Both
+	may be needed when the source and receivers share a switch.
+*/
+func send_mcast_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *string ) {
+	if data == nil || data.Espq == nil || data.Espq.Switch == "" {
+		fq_sheep.Baa( 1, "unable to send mcast-fmods request to agent: no switch defined in input data" )
+		return
+	}
+
+	host := &data.Espq.Switch
+	if phost_suffix != nil {
+		host = add_phost_suffix( host, phost_suffix )
+	}
+
+	if data.Match.Ip1 != nil {
+		data.Match.Smac = ip2mac[*data.Match.Ip1]				// source is attached to this switch
+	} else {
+		data.Match.Smac = nil
+	}
+
+	msg := &agent_cmd{ Ctype: "action_list" }
+	msg.Actions = make( []action, 1 )
+	msg.Actions[0].Atype = "mcast_fmod"
+	msg.Actions[0].Hosts = make( []string, 1 )
+	msg.Actions[0].Hosts[0] = *host
+	msg.Actions[0].Data = data.To_mcast_map( ip2mac )
+	add_pri_adj( msg.Actions[0].Data, gizmos.PT_BANDWIDTH )
+
+	json, err := json.Marshal( msg )
+	if err != nil {
+		fq_sheep.Baa( 0, "unable to build json to set multicast flow mod" )
+		return
+	}
+
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )
+	fq_sheep.Baa( 2, "multicast flow-mod request sent to agent manager: cid=%s %s", data.Cid, json )
 }
 
 /*
@@ -619,6 +617,14 @@ func req_ip2mac(  rch chan *ipc.Chmsg ) {
 
 */
 func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
+	fq_mgr( my_chan, sdn_host, tklr )
+}
+
+/*
+	The manager proper. Periodic work is scheduled with the ticker given rather than the
+	global tickler so that it can be driven by a test (seams.go).
+*/
+func fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string, tk Ticker ) {
 
 	var (
 		uri_prefix	string = ""
@@ -635,6 +641,16 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 		alt_table	int = DEF_ALT_TABLE		// meta data marking table
 		phost_suffix *string = nil			// physical host suffix added to each host name in the list from openstack (config)
 		set_queues	bool = false			// queues need to be set only when using HTB
+		ovn			*ovn_backend = nil		// set when bandwidth rules are programmed via ovn northbound rather than agents
+		ft			*flowtab = nil			// flow table occupancy estimates (agent backend only)
+		tor			*tor_backend = nil		// set when limits are also pushed to physical switches
+		np			*natprober = nil		// set when nat matching flow-mods are probed (agent backend only)
+		vp			*verifier = nil			// set when reservations are verified after a push (agent backend only)
+		bm			*bulkmeter = nil		// set when bulk transfer bytes are metered (agent backend only)
+		sp			*slapoller = nil		// set when rates and drops are polled for sla checks (agent backend only)
+		i2m_age		*map_age				// staleness of the ip2mac map (fq_mapage.go)
+		hq			*map_holdq				// requests waiting for a fresh ip2mac map
+		qa			*qapply					// queue map application status by host (agent only)
 
 		//max_link_used	int64 = 0			// the current maximum link utilisation
 	)
@@ -701,6 +717,15 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 			fq_sheep.Set_level(  uint( clike.Atoi( *p ) ) )
 		}
 
+		if p := cfg_data["fqmgr"]["backend"]; p != nil && *p == "ovn" {
+			nbctl := ""
+			if p := cfg_data["fqmgr"]["ovn_nbctl"]; p != nil {
+				nbctl = *p
+			}
+			ovn = mk_ovn_backend( nbctl )
+			fq_sheep.Baa( 1, "bandwidth rules will be programmed via ovn northbound: %s", nbctl )
+		}
+
 		if p := cfg_data["fqmgr"]["phost_suffix"]; p != nil {		// suffix added to physical host strings for agent commands
 			if *p != "" {
 				phost_suffix = p
@@ -710,27 +735,81 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 	}
 	// ----- end config file munging ---------------------------------------------------
 
-	//tklr.Add_spot( qcheck_freq, my_chan, REQ_SETQUEUES, nil, ipc.FOREVER );  	// tickle us every few seconds to adjust the ovs queues if needed
+	//tk.Add_spot( qcheck_freq, my_chan, REQ_SETQUEUES, nil, ipc.FOREVER );  	// tickle us every few seconds to adjust the ovs queues if needed
 
 	if switch_hosts == nil {
-		tklr.Add_spot( 2, my_chan, REQ_CHOSTLIST, nil, 1 )  						// tickle once, very soon after starting, to get a host list
-		tklr.Add_spot( hcheck_freq, my_chan, REQ_CHOSTLIST, nil, ipc.FOREVER )  	// tickles us every once in a while to update host list
+		tk.Add_spot( 2, my_chan, REQ_CHOSTLIST, nil, 1 )  						// tickle once, very soon after starting, to get a host list
+		tk.Add_spot( hcheck_freq, my_chan, REQ_CHOSTLIST, nil, ipc.FOREVER )  	// tickles us every once in a while to update host list
 		fq_sheep.Baa( 2, "host list will be requested from openstack every %ds", hcheck_freq )
 	} else {
 		host_list = switch_hosts
 		fq_sheep.Baa( 0, "static host list from config used for setting OVS queues: %s", *host_list )
 	}
 
+	if ovn != nil {
+		add_spot( tk, fq_sheep, "TGUFQM026", "ovn rule sweep", 15, my_chan, REQ_OVN_SWEEP, ipc.FOREVER )			// remove expired ovn rules; they have no timeout of their own
+	} else {
+		ft = mk_flowtab( )
+		if ft.audit_freq > 0 {
+			add_spot( tk, fq_sheep, "TGUFQM026", "flow table audit", ft.audit_freq, my_chan, REQ_FLOWTAB_AUDIT, ipc.FOREVER )	// reconcile estimates with what is really on the switches
+		}
+
+		if np = mk_natprober( ); np != nil {
+			add_spot( tk, fq_sheep, "TGUFQM026", "nat probes", 30, my_chan, REQ_NAT_PROBE, ipc.FOREVER )			// send probes that have come due
+		}
+
+		if vp = mk_verifier( ); vp != nil {
+			add_spot( tk, fq_sheep, "TGUFQM026", "reservation verification", 30, my_chan, REQ_VERIFY_PROBE, ipc.FOREVER )		// send verifications that have come due
+		}
+
+		if bm = mk_bulkmeter( ); bm != nil {
+			add_spot( tk, fq_sheep, "TGUFQM026", "bulk transfer metering", bm.freq, my_chan, REQ_BULK_METER, ipc.FOREVER )
+		}
+
+		if sp = mk_slapoller( ); sp != nil {
+			add_spot( tk, fq_sheep, "TGUFQM026", "sla polling", sp.freq, my_chan, REQ_SLA_POLL, ipc.FOREVER )
+		}
+
+		if ssq_cmd == nil {
+			qa = mk_qapply( )
+			add_spot( tk, fq_sheep, "TGUFQM026", "queue map resend", 5, my_chan, REQ_QUEUE_CHECK, ipc.FOREVER )		// resend queue maps to hosts that failed or didn't answer
+		}
+	}
+
+	i2m_age = mk_map_age( map_max_age( ) )
+	hq = mk_map_holdq( )
+	if i2m_age.max_age > 0 {
+		add_spot( tk, fq_sheep, "TGUFQM026", "ip2mac map age check", 5, my_chan, REQ_MAP_CHECK, ipc.FOREVER )			// expire held requests; refresh the map before it goes stale
+		fq_sheep.Baa( 1, "flow-mods will not be built from an ip2mac map older than %ds", i2m_age.max_age )
+	}
+
+	if tor = mk_tor_backend( ); tor != nil {
+		add_spot( tk, fq_sheep, "TGUFQM026", "tor limit sweep", 15, my_chan, REQ_TOR_SWEEP, ipc.FOREVER )			// physical switches don't expire our limits
+	}
+
 	if sdn_host != nil  &&  *sdn_host != "" {
 		uri_prefix = fmt.Sprintf( "http://%s", *sdn_host )
 	}
 
 	fq_sheep.Baa( 1, "flowmod-queue manager is running, sdn host: %s", *sdn_host )
 	for {
-		msg = <- my_chan					// wait for next message
+		ok := false
+		if msg, ok = <- my_chan; ! ok {		// wait for next message; closed only when a test is done with us
+			return
+		}
 		msg.State = nil						// default to all OK
 		
-		fq_sheep.Baa( 3, "processing message: %d", msg.Msg_type )
+		baa_req( fq_sheep, msg )
+		if needs_ip2mac( msg.Msg_type ) && i2m_age.is_stale( time.Now().Unix() ) {		// hold rather than build flow-mods with stale macs
+			now := time.Now().Unix()
+			hq.add( msg, now )
+			if i2m_age.ask( now, map_ask_gap ) {
+				fq_sheep.Baa( 1, "WRN: ip2mac map is stale (age %ds, v%d); %d request(s) held and a new map requested  [TGUFQM022]", i2m_age.age( now ), i2m_age.version, hq.len() )
+				ask_ip2mac( )
+			}
+			continue
+		}
+
 		switch msg.Msg_type {
 			case REQ_GEN_FMOD:							// generic fmod; just pass it along w/o any special handling
 				if msg.Req_data != nil {
@@ -741,17 +820,109 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 			case REQ_BWOW_RESERVE:						// oneway bandwidth flow-mod generation
 				msg.Response_ch = nil					// nothing goes back from this
 				fdata = msg.Req_data.( *Fq_req ); 		// pointer at struct with all of the expected goodies
-				send_bwow_fmods( fdata, ip2mac, phost_suffix )
+				if ovn != nil {
+					ovn.send_bwow( fdata, ip2mac )
+				} else {
+					send_bwow_fmods( fdata, ip2mac, phost_suffix )
+					ft.pushed( fdata )
+				}
 
 			case REQ_BW_RESERVE:						// bandwidth endpoint flow-mod creation; single agent script creates all needed fmods
 				fdata = msg.Req_data.( *Fq_req ); 		// pointer at struct with all of the expected goodies
-				send_bw_fmods( fdata, ip2mac, phost_suffix )
+				if ovn != nil {
+					ovn.send_bw( fdata, ip2mac )
+				} else {
+					send_bw_fmods( fdata, ip2mac, phost_suffix )
+					ft.pushed( fdata )
+					np.pushed( fdata, phost_suffix )		// nil safe; after send so that the macs are filled in
+					vp.pushed( fdata, phost_suffix )
+					bm.pushed( fdata, phost_suffix )
+					sp.pushed( fdata, phost_suffix )
+				}
+				tor.send_bw( fdata )					// nil safe; does nothing when not configured
 				msg.Response_ch = nil					// nothing goes back from this
 
+			case REQ_MCAST_RESERVE:						// multicast flow-mods for one switch of the tree
+				msg.Response_ch = nil
+				fdata = msg.Req_data.( *Fq_req );
+				if ovn != nil {
+					fq_sheep.Baa( 1, "WRN: multicast reservations are not supported by the ovn backend; no flow-mods sent for %s  [TGUFQM015]", str_or_empty( fdata.Id ) )
+				} else {
+					send_mcast_fmods( fdata, ip2mac, phost_suffix )
+					ft.pushed( fdata )
+				}
+
 			case REQ_PT_RESERVE:						// DSCP passthru flow-mods need to be generated
 				fdata = msg.Req_data.( *Fq_req );
-				send_pt_fmods( fdata, ip2mac, phost_suffix )
+				if ovn == nil {							// ovn doesn't reset dscp so there is nothing to do
+					send_pt_fmods( fdata, ip2mac, phost_suffix )
+				}
+				msg.Response_ch = nil
+
+			case REQ_OVN_SWEEP:							// tickler: remove expired ovn qos rules
+				msg.Response_ch = nil
+				if ovn != nil {
+					ovn.sweep( )
+				}
+
+			case REQ_TOR_SWEEP:							// tickler: remove expired physical switch limits
+				msg.Response_ch = nil
+				tor.sweep( )
+
+			case REQ_FLOWTAB_CHECK:						// resmgr: will a new reservation fit in the flow tables
+				if msg.Req_data != nil {
+					msg.State = ft.check( msg.Req_data.( map[string]int ) )
+				}
+
+			case REQ_FLOWTAB_AUDIT:						// tickler: ask agents for real flow table counts
+				msg.Response_ch = nil
+				ft.audit( phost_suffix )
+
+			case REQ_FLOWTAB_COUNTS:					// agent manager: counts from an agent
+				msg.Response_ch = nil
+				if msg.Req_data != nil {
+					ft.audited( msg.Req_data.( []string ), phost_suffix )
+				}
+
+			case REQ_NAT_PROBE:							// tickler: probe nat matching flow-mods that are due
+				msg.Response_ch = nil
+				np.probe( )
+
+			case REQ_NAT_PROBE_RESULT:					// agent manager: probe counts from an agent
+				msg.Response_ch = nil
+				if msg.Req_data != nil {
+					np.probed( msg.Req_data.( []string ) )
+				}
+
+			case REQ_VERIFY_PROBE:						// tickler: verify reservations that are due
+				msg.Response_ch = nil
+				vp.probe( )
+
+			case REQ_VERIFY_RESULT:						// agent manager: verification counts from an agent
+				msg.Response_ch = nil
+				if msg.Req_data != nil {
+					vp.verified( msg.Req_data.( []string ) )
+				}
+
+			case REQ_BULK_METER:						// tickler: count bytes sent by bulk transfer flow-mods
+				msg.Response_ch = nil
+				bm.meter( )
+
+			case REQ_BULK_BYTES:						// agent manager: byte counts from an agent
+				msg.Response_ch = nil
+				if msg.Req_data != nil {
+					bm.metered( msg.Req_data.( []string ) )
+				}
+
+			case REQ_SLA_POLL:							// tickler: ask for reservation bytes and queue drops
 				msg.Response_ch = nil
+				sp.poll( )
+
+			case REQ_SLA_STATS:							// agent manager: bytes and drops from an agent
+				msg.Response_ch = nil
+				if msg.Req_data != nil {
+					sp.polled( msg.Req_data.( []string ) )
+				}
 
 			case REQ_IE_RESERVE:						// proactive ingress/egress reservation flowmod  (this is likely deprecated as of 3/21/2015 -- resmgr invokes the bw_fmods script via agent)
 				fdata = msg.Req_data.( *Fq_req ); 		// user view of what the flow-mod should be
@@ -822,6 +993,8 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 					fq_data := msg.Req_data.( *Fq_req ); 			// request data
 					if uri_prefix != "" {							// an sdn controller -- skoogi -- is enabled (not supported)
 						fq_sheep.Baa( 0, "ERR: steering reservations are not supported with skoogi (SDNC); no flow-mods pushed" )
+					} else if ovn != nil {							// http refuses these; one loaded from an old checkpoint gets here
+						fq_sheep.Baa( 0, "ERR: steering reservations are not supported by the ovn backend; no flow-mods sent for %s  [TGUFQM015]", str_or_empty( fq_data.Id ) )
 					} else {
 						send_stfmod_agent( fq_data, ip2mac, host_list )	
 					}
@@ -839,15 +1012,34 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 				}
 
 			case REQ_SETQUEUES:								// request from reservation manager which indicates something changed and queues need to be reset
-				if set_queues {
+				if set_queues && ovn == nil {				// no queues with ovn; rate is on the qos rule
 					qlist := msg.Req_data.( []interface{} )[0].( []string )
 					if ssq_cmd != nil {
 						adjust_queues( qlist, ssq_cmd, host_list ) 					// if writing to a file and driving a local script
 					} else {
-						adjust_queues_agent( qlist, host_list, phost_suffix )		// if sending json to an agent
+						qa.apply( qlist, phost_suffix )							// if sending json to an agent; results tracked by host
 					}
 				}
 
+			case REQ_QUEUE_RESULT:						// agent manager: hosts' results of applying and verifying a queue map
+				msg.Response_ch = nil
+				if qa != nil {
+					qa.result( msg.Req_data.( []string ) )
+				}
+
+			case REQ_QUEUE_CHECK:						// tickler: retry hosts that failed or didn't answer
+				msg.Response_ch = nil
+				if qa != nil {
+					qa.check( )
+				}
+
+			case REQ_QUEUE_STATUS:						// http: queue map application status by host
+				if qa == nil {
+					msg.State = mk_err( ERR_BAD_REQUEST, "queue application is not tracked: queues are set by ssq_cmd or not used with ovn" )
+				} else {
+					msg.Response_data, msg.State = qa.status( *(msg.Req_data.( *string )), phost_suffix )
+				}
+
 			case REQ_CHOSTLIST:								// this is tricky as it comes from tickler as a request, and from osifmgr as a response, be careful!
 				msg.Response_ch = nil;						// regardless of source, we should not reply to this request
 
@@ -877,8 +1069,12 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 				if  msg.Req_data != nil {
 					newmap := msg.Req_data.( map[string]*string )
 					if len( newmap ) > 0  {
+						i2m_age.touch( map_changed( ip2mac, newmap ) )
 						ip2mac = newmap										// safe to replace
-						fq_sheep.Baa( 2, "ip2mac translation received from osif: %d elements", len( ip2mac ) )
+						fq_sheep.Baa( 2, "ip2mac translation received from osif: %d elements (v%d)", len( ip2mac ), i2m_age.version )
+						if n := hq.release( my_chan ); n > 0 {
+							fq_sheep.Baa( 1, "%d flow-mod request(s) held for a fresh ip2mac map released", n )
+						}
 					}else {
 						if ip2mac != nil {
 							fq_sheep.Baa( 2, "ip2mac translation received from osif: 0 elements -- kept old table with %d elements", len( ip2mac ) )
@@ -891,6 +1087,23 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 				}
 				msg.State = nil								// state is always good
 
+			case REQ_MAP_CHECK:							// tickler: drop requests held too long; keep the ip2mac map warm
+				msg.Response_ch = nil
+				now := time.Now().Unix()
+				if n := hq.expire( now ); n > 0 {
+					fq_sheep.Baa( 0, "ERR: %d flow-mod request(s) dropped: no fresh ip2mac map arrived within %ds  [TGUFQM023]", n, hq.hold )
+				}
+				if hq.len() > 0 {
+					if i2m_age.ask( now, map_ask_gap ) {				// still waiting; the last ask may have been lost or answered with an empty map
+						ask_ip2mac( )
+					}
+				} else {
+					if i2m_age.is_cooling( now ) && i2m_age.ask( now, i2m_age.max_age / 4 ) {		// warming isn't urgent; don't hound osif
+						fq_sheep.Baa( 2, "ip2mac map (v%d) is %ds old; requesting a new one", i2m_age.version, i2m_age.age( now ) )
+						ask_ip2mac( )
+					}
+				}
+
 			default:
 				fq_sheep.Baa( 1, "unknown request: %d", msg.Msg_type )
 				msg.Response_data = nil
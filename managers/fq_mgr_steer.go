@@ -29,6 +29,10 @@
 
 	Mods:		27 Feb 2015 - changes to deal with lazy update and to correct l* bug.
 				15 Jun 2015 - Cleaned up commented out lines a bit.
+				16 Oct 2026 - Steering priority tier adjustment is added (fq_pri.go).
+				16 Oct 2026 - Steering flow-mods carry the reservation id so agent responses are tracked.
+				16 Oct 2026 - The match isn't sent in the action data (it has spaces which the agent vetting
+							refuses); the command log takes it from the flow-mod string.
 */
 
 package managers
@@ -39,6 +43,7 @@ import (
 	"strings"
 
 	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
 )
 
 
@@ -229,7 +234,10 @@ func send_stfmod_agent( data *Fq_req, ip2mac map[string]*string, hlist *string )
 	msg.Actions[0].Hosts = make( []string, 1 )
 	msg.Actions[0].Hosts = hosts
 	msg.Actions[0].Fdata = make( []string, 1 )
-	msg.Actions[0].Fdata[0] = fmt.Sprintf( `%s -t %d -p %d %s %s add 0xedde br-int`, table, data.Expiry, data.Pri, match_opts, action_opts )
+	msg.Actions[0].Fdata[0] = fmt.Sprintf( `%s -t %d -p %d %s %s add 0xedde br-int`, table, data.Expiry, data.Pri + pri_adjust( gizmos.PT_STEERING ), match_opts, action_opts )
+	if data.Id != nil {											// not used by the agent; ties the response back to the reservation (agent_log.go)
+		msg.Actions[0].Data = map[string]string{ "resid": *data.Id, "cid": data.Cid }
+	}
 
 	json, err := json.Marshal( msg )			// bundle into a json string
 	if err != nil {
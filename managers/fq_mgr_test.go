@@ -0,0 +1,156 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	Wait for a message on the channel; nil if none arrives within a couple of seconds.
+*/
+func wait_msg( ch chan *ipc.Chmsg ) ( *ipc.Chmsg ) {
+	select {
+		case msg := <- ch:
+			return msg
+
+		case <- time.After( 2 * time.Second ):
+			return nil
+	}
+}
+
+/*
+	With no switch hosts in the config fq-mgr must schedule the host list request once soon
+	after starting and then periodically. When the ticker fires it must ask osif for the list
+	and pass the list it gets back on to agent manager. The manager is stopped (its channel
+	closed) before the test returns.
+*/
+func TestFq_hostlist( t *testing.T ) {
+	tegu_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	osif_ch = make( chan *ipc.Chmsg, 16 )
+	am_ch = make( chan *ipc.Chmsg, 16 )
+	errs := 0
+
+	mt := mk_mem_ticker( )
+	fq := make( chan *ipc.Chmsg, 16 )
+	done := make( chan bool )
+	go func() {
+		fq_mgr( fq, &empty_str, mt )
+		close( done )
+	}()
+	defer func() {									// stop the manager so it isn't still reading globals when the next test runs
+		close( fq )
+		<- done
+	}()
+
+	var d []int64
+	for i := 0; i < 200; i++ {									// spots are added once fq-mgr has read its config
+		if d = mt.delays( REQ_CHOSTLIST ); len( d ) == 2 {
+			break
+		}
+		time.Sleep( 10 * time.Millisecond )
+	}
+	if ! reflect.DeepEqual( d, []int64{ 2, 180 } ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] host list spots: expected [2 180] got %v\n", d )
+		t.Fail()
+		return
+	}
+
+	if n := mt.fire( REQ_CHOSTLIST ); n != 2 {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected both host list spots to fire, %d did\n", n )
+		errs++
+	}
+	if n := mt.fire( REQ_CHOSTLIST ); n != 1 {					// the first was a one shot
+		fmt.Fprintf( os.Stderr, "[FAIL] expected only the periodic host list spot to fire again, %d did\n", n )
+		errs++
+	}
+
+	hl := "h1 h2"
+	for i := 0; i < 3; i++ {									// one request to osif for each tickle
+		req := wait_msg( osif_ch )
+		if req == nil || req.Msg_type != REQ_CHOSTLIST || req.Response_ch == nil {
+			fmt.Fprintf( os.Stderr, "[FAIL] host list request %d not sent to osif: %v\n", i, req )
+			t.Fail()
+			return
+		}
+		req.Response_data = &hl
+		req.Response_ch <- req
+	}
+
+	for i := 0; i < 3; i++ {
+		msg := wait_msg( am_ch )
+		if msg == nil || msg.Msg_type != REQ_CHOSTLIST || msg.Req_data == nil || *(msg.Req_data.( *string )) != hl {
+			fmt.Fprintf( os.Stderr, "[FAIL] host list %d not sent to agent manager: %v\n", i, msg )
+			errs++
+			break
+		}
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   host list requested on the ticker and pushed to agent manager\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	A probe whose answer doesn't come back within the window plus timeout must be made pending
+	again, and given up on once tries answers have been lost.
+*/
+func TestProbe_lost( t *testing.T ) {
+	fq_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	pc := &probe_cfg{ delay: 10, window: 30, timeout: 60, tries: 2 }
+	now := time.Now().Unix()
+	pr := &agent_probe{ id: "res-1", host: "h1", pushed: now - 20, expiry: now + 3600, state: "probing", sent: now - 50 }
+
+	if send, gave_up := pc.due( pr, now ); send || gave_up || pr.state != "probing" {
+		fmt.Fprintf( os.Stderr, "[FAIL] probe still within its window was disturbed: send=%v gave_up=%v state=%s\n", send, gave_up, pr.state )
+		errs++
+	}
+
+	pr.sent = now - 91
+	if send, gave_up := pc.due( pr, now ); ! send || gave_up || pr.state != "pending" || pr.lost != 1 {
+		fmt.Fprintf( os.Stderr, "[FAIL] overdue probe was not retried: send=%v gave_up=%v state=%s lost=%d\n", send, gave_up, pr.state, pr.lost )
+		errs++
+	}
+
+	pr.state = "probing"
+	if send, gave_up := pc.due( pr, now ); send || ! gave_up || pr.state != "noresponse" {
+		fmt.Fprintf( os.Stderr, "[FAIL] probe was not given up on after %d lost answers: send=%v gave_up=%v state=%s\n", pr.lost, send, gave_up, pr.state )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   lost probe answers are retried and then given up on\n" )
+	} else {
+		t.Fail()
+	}
+}
@@ -0,0 +1,230 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	fq_natprobe
+	Abstract:	NAT match audit. The bandwidth flow-mods of a reservation with a floating IP
+				endpoint match on the external address in one direction (-S or -D). If the
+				direction, or the address, is wrong the flow-mods never match a packet; the
+				traffic still flows, just without the reservation's marking, so nobody notices.
+
+				Each bandwidth flow-mod request sent to an agent with an external IP is
+				remembered. Once it has been installed for fqmgr:nat_probe seconds an agent
+				is asked to probe it (fmod_probe action, ql_fmod_probe): temporary flow-mods
+				below the reservation's count the traffic between the two macs that the
+				reservation's flow-mods miss, and the packets of each are counted over a short
+				window. The result is one of:
+					matched	- the reservation's flow-mods matched packets
+					nomatch	- traffic between the VMs was seen, but none matched the reservation
+					reversed - as nomatch, and the traffic matched the opposite direction
+					idle	- no traffic was seen in any probe (the probe is tried again later,
+							  up to fqmgr:nat_probe_tries times)
+					noresponse - the agent never answered; a probe that isn't answered within
+							  fqmgr:nat_probe_timeout seconds of its window ending is sent again
+							  up to fqmgr:nat_probe_tries times (see fq_probe.go)
+
+				Nomatch and reversed are logged and published (reservation.nat_nomatch).
+				Every result is given to res-mgr which shows it with the reservation's
+				flow-mod status (resstatus). A re-push with a different match (a floating IP
+				move for instance) starts over.
+
+	CFG:		fqmgr:nat_probe - seconds after a push before the probe is run; 0 disables (0)
+				fqmgr:nat_probe_window - seconds that the agent counts packets (30)
+				fqmgr:nat_probe_tries - probes run while no traffic is seen, or not answered (3)
+				fqmgr:nat_probe_timeout - seconds beyond the window to wait for the agent's answer (60)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type natprober struct {
+	probe_cfg
+	probes	map[string]*agent_probe		// keyed by id and host
+}
+
+/*
+	Build the prober from the config. Nil is returned if probing is disabled.
+*/
+func mk_natprober( ) ( np *natprober ) {
+	if cfg_data["fqmgr"] == nil {
+		return nil
+	}
+
+	np = &natprober{
+		probe_cfg: probe_cfg{ window: 30, timeout: 60, tries: 3 },
+		probes:	make( map[string]*agent_probe ),
+	}
+
+	if p := cfg_data["fqmgr"]["nat_probe"]; p != nil {
+		np.delay = clike.Atoi64( *p )
+	}
+	if p := cfg_data["fqmgr"]["nat_probe_window"]; p != nil {
+		np.window = clike.Atoi64( *p )
+	}
+	if p := cfg_data["fqmgr"]["nat_probe_tries"]; p != nil {
+		np.tries = clike.Atoi( *p )
+	}
+	if p := cfg_data["fqmgr"]["nat_probe_timeout"]; p != nil {
+		np.timeout = clike.Atoi64( *p )
+	}
+
+	if np.delay <= 0 || np.window <= 0 {
+		return nil
+	}
+
+	fq_sheep.Baa( 1, "nat match probes run %ds after a push; window=%ds timeout=%ds tries=%d", np.delay, np.window, np.timeout, np.tries )
+	return np
+}
+
+/*
+	Remember a bandwidth flow-mod request that was just sent to an agent. Only those matching
+	on an external address are probed.
+*/
+func (np *natprober) pushed( fdata *Fq_req, phost_suffix *string ) {
+	if np == nil || fdata == nil || fdata.Id == nil || fdata.Espq == nil || fdata.Espq.Switch == "" {
+		return
+	}
+	if fdata.Extip == nil || *fdata.Extip == "" {
+		return
+	}
+
+	host := &fdata.Espq.Switch
+	if phost_suffix != nil {
+		host = add_phost_suffix( host, phost_suffix )
+	}
+
+	bw := fdata.To_bw_map( )
+	add_pri_adj( bw, gizmos.PT_BANDWIDTH )
+	data := map[string]string{ "resid": *fdata.Id, "window": fmt.Sprintf( "%d", np.window ) }
+	for _, k := range []string{ "smac", "dmac", "extip", "extdir", "sproto", "dproto", "ipv6", "padj" } {
+		data[k] = bw[k]
+	}
+
+	key := *fdata.Id + " " + *host
+	if pr := np.probes[key]; pr != nil && pr.same( data ) {
+		pr.expiry = fdata.Expiry					// refresh of the same match; keep the result
+		return
+	}
+
+	np.probes[key] = &agent_probe{ id: *fdata.Id, host: *host, data: data, pushed: time.Now().Unix(), expiry: fdata.Expiry, state: "pending" }
+}
+
+/*
+	Send a probe request for each pending set of flow-mods that has been installed long enough.
+	Expired entries are dropped; those whose response never came back are retried (fq_probe.go)
+	and res-mgr is told when we give up on one.
+*/
+func (np *natprober) probe( ) {
+	if np == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	n := 0
+	for k, pr := range np.probes {
+		if pr.expiry <= now {
+			delete( np.probes, k )
+			continue
+		}
+
+		send, gave_up := np.due( pr, now )
+		if gave_up {
+			tmsg := ipc.Mk_chmsg( )
+			tmsg.Send_req( rmgr_ch, nil, REQ_NAT_PROBE_STATE, []string{ pr.id, pr.host, pr.state }, nil )
+			continue
+		}
+		if send && pr.send( "fmod_probe", now ) {
+			n++
+		}
+	}
+
+	if n > 0 {
+		fq_sheep.Baa( 2, "nat match probes requested: %d", n )
+	}
+}
+
+/*
+	Evaluate the records returned by an agent: host id reservation-pkts alt-pkts plain-pkts.
+	Results are passed to res-mgr.
+*/
+func (np *natprober) probed( recs []string ) {
+	if np == nil {
+		return
+	}
+
+	for _, r := range recs {
+		toks := strings.Fields( r )
+		if len( toks ) != 5 {
+			continue
+		}
+
+		pr := np.probes[toks[1] + " " + toks[0]]
+		if pr == nil || pr.state != "probing" {
+			continue								// deleted, or re-pushed with a new match while the probe ran
+		}
+
+		rpkts := clike.Atoi64( toks[2] )
+		apkts := clike.Atoi64( toks[3] )
+		ppkts := clike.Atoi64( toks[4] )
+		switch {
+			case rpkts > 0:
+				pr.state = "matched"
+
+			case apkts > 0:
+				pr.state = "reversed"
+
+			case ppkts > 0:
+				pr.state = "nomatch"
+
+			case pr.tries < np.tries:
+				pr.state = "pending"				// nothing to see; look again later
+				pr.pushed = time.Now().Unix()
+				continue
+
+			default:
+				pr.state = "idle"
+		}
+
+		fq_sheep.Baa( 2, "nat match probe: %s on %s: %s reservation=%d alt=%d plain=%d", pr.id, pr.host, pr.state, rpkts, apkts, ppkts )
+		if pr.state == "nomatch" || pr.state == "reversed" {
+			fq_sheep.Baa( 0, "WRN: flow-mods for reservation %s on %s do not match its traffic: %s (extip=%s %s)  [TGUFQM020]", pr.id, pr.host, pr.state, pr.data["extip"], pr.data["extdir"] )
+			publish_event( "reservation.nat_nomatch", fmt.Sprintf( `{ "id": %q, "host": %q, "state": %q, "extip": %q, "extdir": %q, "alt_packets": %d, "packets": %d }`,
+				pr.id, pr.host, pr.state, pr.data["extip"], pr.data["extdir"], apkts, ppkts ) )
+		}
+
+		tmsg := ipc.Mk_chmsg( )
+		tmsg.Send_req( rmgr_ch, nil, REQ_NAT_PROBE_STATE, []string{ pr.id, pr.host, pr.state }, nil )
+	}
+}
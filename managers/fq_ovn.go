@@ -0,0 +1,432 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+	Mnemonic:	fq_ovn
+	Abstract:	OVN northbound backend for fq-mgr. When fqmgr:backend is set to ovn, bandwidth
+				and oneway reservations are programmed as QoS rules in the OVN northbound
+				database (via ovn-nbctl) rather than being sent to the agents as flow-mod
+				requests. OVN rules have no hard timeout, so the rules that we add are tracked
+				here and removed by a periodic sweep once they expire.
+
+				Each rule is tagged in its external_ids with the reservation id, the logical
+				switch it was added to and its expiry (tegu_res, tegu_ls, tegu_expiry). The
+				rules are read back from the database when the backend starts so that those
+				added before a restart are still extended, and removed when they expire,
+				rather than being orphaned.
+
+				As the agent manager does for flow-mod actions, each rule push is reported to
+				res-mgr (flow-mod status) when it is queued and again when nbctl has run. A rule
+				that could not be added is reported failed so that the reservation is pushed
+				again; one never reported is caught by res-mgr's audit.
+
+				The nbctl commands are run by a single worker goroutine, in the order that
+				the work is queued, so that fq-mgr never waits on ovn-nbctl. The rule list
+				and the mac/port caches belong to the worker.
+
+				Steering (and so service chains) is refused when the backend is ovn: the
+				agent flow-mods which resubmit traffic through the middleboxes would be mixed
+				in with OVN's own pipeline on the integration bridge, and there is no
+				northbound equivalent. Multicast is not supported either. Passthrough
+				reservations need nothing as OVN does not reset the dscp value unless a qos
+				rule says to. Tegu reservations admit no traffic that wouldn't otherwise flow
+				so no ACL rules are added.
+
+	Config:		fqmgr:backend    - ovs (default) or ovn
+				fqmgr:ovn_nbctl  - the ovn-nbctl command including any options such as --db (ovn-nbctl)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+const (
+	OVN_BASE_PRI	int = 1000					// base priority of our qos rules; handover adds the pledge's bump
+)
+
+/*
+	A qos rule that we've added and when it should be removed.
+*/
+type ovn_rule struct {
+	uuid		string							// row in the QoS table
+	lswitch		string
+	pri			int
+	match		string
+	expiry		int64
+}
+
+type ovn_backend struct {
+	nbctl		[]string						// command and leading options
+	work		chan func()						// nbctl work run in order by the worker
+	mac2lport	map[string]string				// cache of mac -> logical port name (worker only)
+	lport2ls	map[string]string				// cache of logical port -> logical switch (worker only)
+	rules		map[string]*ovn_rule			// rules we've added keyed by switch/pri/match (worker only)
+	aid			uint32							// id of the last rule push reported to res-mgr (fq-mgr only)
+}
+
+/*
+	Returns true if the config selects the ovn backend. The config isn't changed once it is
+	loaded so this is safe from any goroutine (http uses it to refuse steering).
+*/
+func ovn_configured( ) ( bool ) {
+	if cfg_data == nil || cfg_data["fqmgr"] == nil {
+		return false
+	}
+
+	p := cfg_data["fqmgr"]["backend"]
+	return p != nil && *p == "ovn"
+}
+
+/*
+	Create the backend struct and start its worker. Cmd is the ovn-nbctl command and any
+	options (e.g. --db). The worker's first job is to read back the rules that we added
+	before a restart.
+*/
+func mk_ovn_backend( cmd string ) ( *ovn_backend ) {
+	if cmd == "" {
+		cmd = "ovn-nbctl"
+	}
+
+	ob := &ovn_backend {
+		nbctl:		strings.Fields( cmd ),
+		work:		make( chan func(), 4096 ),
+		mac2lport:	make( map[string]string ),
+		lport2ls:	make( map[string]string ),
+		rules:		make( map[string]*ovn_rule ),
+	}
+
+	ob.work <- ob.load
+	go ob.worker( )
+
+	return ob
+}
+
+/*
+	Run the queued work. Sending to a full queue blocks fq-mgr; at that point nbctl is well
+	behind and holding the work is the only choice.
+*/
+func (ob *ovn_backend) worker( ) {
+	for f := range ob.work {
+		f()
+	}
+}
+
+/*
+	Run an nbctl command returning the trimmed output. Only the worker may call this.
+*/
+func (ob *ovn_backend) run( args ...string ) ( string, error ) {
+	cargs := append( append( []string{}, ob.nbctl[1:]... ), args... )
+	out, err := exec.Command( ob.nbctl[0], cargs... ).Output()
+	if err != nil {
+		return "", fmt.Errorf( "%s %s: %s", ob.nbctl[0], strings.Join( args, " " ), err )
+	}
+
+	return strings.TrimSpace( string( out ) ), nil
+}
+
+/*
+	Read the qos rules tagged with a reservation id (ours) from the database into the rule
+	list. Expired rules are removed by the next sweep.
+*/
+func (ob *ovn_backend) load( ) {
+	out, err := ob.run( "--format=csv", "--data=bare", "--no-headings", "--columns=_uuid,priority,match,external_ids", "list", "QoS" )
+	if err != nil {
+		fq_sheep.Baa( 0, "ERR: ovn: unable to read existing qos rules; rules added before restart may be left: %s  [TGUFQM025]", err )
+		return
+	}
+
+	recs, err := csv.NewReader( strings.NewReader( out ) ).ReadAll()
+	if err != nil {
+		fq_sheep.Baa( 0, "ERR: ovn: unable to parse existing qos rules: %s  [TGUFQM025]", err )
+		return
+	}
+
+	n := 0
+	for _, rec := range recs {
+		if len( rec ) < 4 {
+			continue
+		}
+
+		xids := make( map[string]string )
+		for _, kv := range strings.Fields( rec[3] ) {					// bare data is key=value key=value
+			if toks := strings.SplitN( kv, "=", 2 ); len( toks ) == 2 {
+				xids[toks[0]] = toks[1]
+			}
+		}
+		if xids["tegu_res"] == "" || xids["tegu_ls"] == "" {			// not ours
+			continue
+		}
+
+		pri, _ := strconv.Atoi( rec[1] )
+		expiry, _ := strconv.ParseInt( xids["tegu_expiry"], 10, 64 )
+		key := fmt.Sprintf( "%s/%d/%s", xids["tegu_ls"], pri, rec[2] )
+		ob.rules[key] = &ovn_rule{ uuid: rec[0], lswitch: xids["tegu_ls"], pri: pri, match: rec[2], expiry: expiry }
+		n++
+	}
+
+	fq_sheep.Baa( 1, "ovn: %d existing qos rules read back from the database", n )
+}
+
+/*
+	Find the logical port and logical switch for a mac address. The port list is fetched
+	only when the mac isn't in the cache.
+*/
+func (ob *ovn_backend) mac2ls( mac string ) ( lport string, lswitch string, err error ) {
+	if mac == "" {
+		return "", "", fmt.Errorf( "no mac address" )
+	}
+
+	lport = ob.mac2lport[mac]
+	if lport == "" {
+		out, err := ob.run( "--bare", "--columns=name,addresses", "list", "Logical_Switch_Port" )
+		if err != nil {
+			return "", "", err
+		}
+
+		name := ""
+		for _, line := range strings.Split( out, "\n" ) {			// records are name, addresses, blank line
+			line = strings.TrimSpace( line )
+			if line == "" {
+				name = ""
+				continue
+			}
+			if name == "" {
+				name = line
+			} else {
+				if f := strings.Fields( line ); len( f ) > 0 {
+					ob.mac2lport[strings.ToLower( f[0] )] = name
+				}
+			}
+		}
+
+		lport = ob.mac2lport[mac]
+		if lport == "" {
+			return "", "", fmt.Errorf( "no logical port has mac: %s", mac )
+		}
+	}
+
+	lswitch = ob.lport2ls[lport]
+	if lswitch == "" {
+		lswitch, err = ob.run( "lsp-get-ls", lport )
+		if err != nil {
+			return
+		}
+		if f := strings.Fields( lswitch ); len( f ) > 0 {			// output is uuid (name); uuid is fine to use
+			lswitch = f[0]
+		}
+		ob.lport2ls[lport] = lswitch
+	}
+
+	return lport, lswitch, nil
+}
+
+/*
+	Add (or extend) a from-lport qos rule for the reservation. The rule is created with
+	the reservation id, switch and expiry in its external_ids (which qos-add can't set)
+	and added to the switch in the same transaction. An existing rule with the same key
+	only has its expiry updated.
+*/
+func (ob *ovn_backend) add_rule( id string, lswitch string, pri int, match string, rate int64, dscp int, expiry int64 ) ( err error ) {
+	key := fmt.Sprintf( "%s/%d/%s", lswitch, pri, match )
+	if r := ob.rules[key]; r != nil {
+		if _, err = ob.run( "set", "QoS", r.uuid, fmt.Sprintf( "external_ids:tegu_expiry=\"%d\"", expiry ) ); err != nil {
+			return err
+		}
+		r.expiry = expiry
+		fq_sheep.Baa( 2, "ovn: qos rule expiry extended: %s %s", lswitch, match )
+		return nil
+	}
+
+	args := []string{ "--", "--id=@q", "create", "QoS", "direction=from-lport", fmt.Sprintf( "priority=%d", pri ), "match=" + strconv.Quote( match ) }
+	if rate > 0 {
+		args = append( args, fmt.Sprintf( "bandwidth:rate=%d", rate / 1000 ) )		// ovn wants kbps
+	}
+	if dscp > 0 {
+		args = append( args, fmt.Sprintf( "action:dscp=%d", dscp ) )
+	}
+	args = append( args, "external_ids:tegu_res=" + strconv.Quote( id ), "external_ids:tegu_ls=" + strconv.Quote( lswitch ),
+		fmt.Sprintf( "external_ids:tegu_expiry=\"%d\"", expiry ), "--", "add", "Logical_Switch", lswitch, "qos_rules", "@q" )
+
+	uuid, err := ob.run( args... )
+	if err != nil {
+		return err
+	}
+
+	ob.rules[key] = &ovn_rule{ uuid: uuid, lswitch: lswitch, pri: pri, match: match, expiry: expiry }
+	fq_sheep.Baa( 1, "ovn: qos rule added for %s: %s %d %s", id, lswitch, pri, match )
+	return nil
+}
+
+/*
+	Queue a sweep of the expired rules (called by fq-mgr on the tickle).
+*/
+func (ob *ovn_backend) sweep( ) {
+	ob.work <- ob.do_sweep
+}
+
+/*
+	Remove any rules that have expired. Removing the rule from the switch deletes the
+	QoS row as it is not a root table.
+*/
+func (ob *ovn_backend) do_sweep( ) {
+	now := time.Now().Unix()
+	for k, r := range ob.rules {
+		if r.expiry <= now {
+			if _, err := ob.run( "remove", "Logical_Switch", r.lswitch, "qos_rules", r.uuid ); err != nil {
+				fq_sheep.Baa( 1, "WRN: ovn: unable to remove expired qos rule: %s  [TGUFQM011]", err )
+			} else {
+				fq_sheep.Baa( 1, "ovn: expired qos rule removed: %s %s", r.lswitch, r.match )
+			}
+			delete( ob.rules, k )
+		}
+	}
+}
+
+/*
+	Strip the project (if there) from a [project/]address string.
+*/
+func ovn_addr( a *string ) ( string ) {
+	if a == nil {
+		return ""
+	}
+	if i := strings.LastIndex( *a, "/" ); i >= 0 {
+		return (*a)[i+1:]
+	}
+
+	return *a
+}
+
+/*
+	Build the match string for traffic leaving lport for the destination. The transport
+	ports may carry a mask which ovn does not support; it is dropped.
+*/
+func ovn_match( data *Fq_req, lport string, dest *string ) ( string ) {
+	ipv := "ip4"
+	if data.Ipv6 {
+		ipv = "ip6"
+	}
+
+	match := fmt.Sprintf( "inport == %q", lport )
+	if d := ovn_addr( dest ); d != "" {
+		if strings.Index( d, ":" ) >= 0 {
+			ipv = "ip6"
+		}
+		match += fmt.Sprintf( " && %s.dst == %s", ipv, d )
+	}
+
+	if data.Tptype != nil && *data.Tptype != "none" && *data.Tptype != "" {
+		tp := strings.TrimRight( *data.Tptype, "46" )
+		if data.Match.Tpsport != nil && *data.Match.Tpsport != "0" {
+			match += fmt.Sprintf( " && %s.src == %s", tp, strings.SplitN( *data.Match.Tpsport, "/", 2 )[0] )
+		}
+		if data.Match.Tpdport != nil && *data.Match.Tpdport != "0" {
+			match += fmt.Sprintf( " && %s.dst == %s", tp, strings.SplitN( *data.Match.Tpdport, "/", 2 )[0] )
+		}
+	}
+
+	return match
+}
+
+/*
+	Program the bandwidth rule for traffic from Ip1 to Ip2. The rule is put on the logical switch
+	that the source VM is attached to; rate limiting and dscp marking happen as the
+	packet enters the logical network. External destinations (Extip) are matched when the
+	other end isn't known. The request is copied and the work queued for the worker.
+*/
+func (ob *ovn_backend) send_bw( data *Fq_req, ip2mac map[string]*string ) {
+	if data == nil || data.Match.Ip1 == nil {
+		return
+	}
+
+	mac := ""
+	if m := ip2mac[*data.Match.Ip1]; m != nil {
+		mac = *m
+	}
+	d := *data
+
+	resid := str_or_empty( d.Id )
+	key := fmt.Sprintf( "ovn %s %s %s %s %s", *d.Match.Ip1, str_or_empty( d.Match.Ip2 ), str_or_empty( d.Extip ), str_or_empty( d.Match.Tpsport ), str_or_empty( d.Match.Tpdport ) )
+	ob.aid++
+	aid := ob.aid
+	ovn_report( resid, aid, key, "sent" )
+
+	ob.work <- func() {
+		lport, lswitch, err := ob.mac2ls( mac )
+		if err != nil {
+			fq_sheep.Baa( 0, "ERR: ovn: unable to find logical switch for %s: %s  [TGUFQM012]", *d.Match.Ip1, err )
+			ovn_report( resid, aid, key, "failed (no logical switch)" )
+			return
+		}
+
+		dest := d.Match.Ip2
+		if d.Extip != nil && *d.Extip != "" && d.Exttyp != nil && *d.Exttyp == "-D" {
+			dest = d.Extip
+		}
+
+		dscp := d.Dscp
+		if d.Single_switch {
+			dscp = 0							// as with the agent, no marking when both ends are on the same switch
+		}
+
+		err = ob.add_rule( str_or_empty( d.Id ), lswitch, OVN_BASE_PRI + d.Pbump, ovn_match( &d, lport, dest ), d.Rate, dscp, d.Expiry )
+		if err != nil {
+			fq_sheep.Baa( 0, "ERR: ovn: unable to add qos rule for %s: %s  [TGUFQM012]", resid, err )
+			ovn_report( resid, aid, key, "failed (qos rule)" )
+			return
+		}
+
+		ovn_report( resid, aid, key, "ok" )
+	}
+}
+
+/*
+	Report the state of a rule push to res-mgr (res_mgr_fmstat.go) as agent manager does for
+	flow-mod actions. Safe from both fq-mgr and the worker. Pushes without a reservation id
+	aren't tracked.
+*/
+func ovn_report( resid string, aid uint32, key string, outcome string ) {
+	if resid == "" {
+		return
+	}
+
+	msg := ipc.Mk_chmsg( )
+	msg.Send_req( rmgr_ch, nil, REQ_FMOD_STATUS, &fmod_report{ resid: resid, aid: aid, atype: "ovn_qos", host: "ovn", key: key, outcome: outcome, ts: time.Now().Unix() }, nil )
+}
+
+/*
+	Program a oneway rule. The same as a bandwidth rule, but the destination may be unknown.
+*/
+func (ob *ovn_backend) send_bwow( data *Fq_req, ip2mac map[string]*string ) {
+	ob.send_bw( data, ip2mac )
+}
@@ -0,0 +1,120 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+package managers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	Rules tagged with a reservation id must be read back from the database; others left alone.
+	A script stands in for ovn-nbctl and writes the list output.
+*/
+func TestOvn_load( t *testing.T ) {
+	fq_sheep = bleater.Mk_bleater( 0, os.Stderr )
+
+	dir, err := ioutil.TempDir( "", "tegu_ovn" )
+	if err != nil {
+		t.Fatalf( "unable to make temp dir: %s", err )
+	}
+	defer os.RemoveAll( dir )
+
+	script := filepath.Join( dir, "nbctl" )
+	list := `cat <<'endKat'
+6a1c,1000,"inport == ""lp1"" && ip4.dst == 10.0.0.2",tegu_expiry=1767243600 tegu_ls=ls-uuid tegu_res=res-1
+7b2d,500,"inport == ""lp9""",owner=neutron
+endKat
+`
+	if err = ioutil.WriteFile( script, []byte( list ), 0755 ); err != nil {
+		t.Fatalf( "unable to write script: %s", err )
+	}
+
+	ob := &ovn_backend{ nbctl: []string{ "sh", script }, rules: make( map[string]*ovn_rule ) }
+	ob.load( )
+
+	r := ob.rules[`ls-uuid/1000/inport == "lp1" && ip4.dst == 10.0.0.2`]
+	if len( ob.rules ) != 1 || r == nil || r.uuid != "6a1c" || r.expiry != 1767243600 {
+		fmt.Fprintf( os.Stderr, "[FAIL] ovn rules not read back as expected: %d rules\n", len( ob.rules ) )
+		for k, v := range ob.rules {
+			fmt.Fprintf( os.Stderr, "\t%s: %+v\n", k, *v )
+		}
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "[OK]   ovn rules read back\n" )
+	}
+}
+
+/*
+	A rule that can't be added must be reported to res-mgr as failed, after the sent report,
+	so that the reservation is pushed again.
+*/
+func TestOvn_report( t *testing.T ) {
+	fq_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	rmgr_ch = make( chan *ipc.Chmsg, 16 )
+	errs := 0
+
+	ob := &ovn_backend{ nbctl: []string{ "false" }, work: make( chan func(), 16 ), mac2lport: make( map[string]string ),
+		lport2ls: make( map[string]string ), rules: make( map[string]*ovn_rule ) }
+
+	id := "res-1"
+	ip1 := "10.0.0.1"
+	ip2 := "10.0.0.2"
+	mac := "fa:16:3e:00:00:01"
+	fdata := &Fq_req{ Id: &id, Rate: 1000000, Expiry: 1767243600, Match: &Fq_parms{ Ip1: &ip1, Ip2: &ip2 } }
+	ob.send_bw( fdata, map[string]*string{ ip1: &mac } )
+
+	f := <- ob.work							// run the queued work here rather than on a worker
+	f()
+
+	outcomes := ""
+	for i := 0; i < 2; i++ {
+		msg := wait_msg( rmgr_ch )
+		if msg == nil || msg.Msg_type != REQ_FMOD_STATUS {
+			break
+		}
+		r := msg.Req_data.( *fmod_report )
+		if r.resid != id || r.aid != 1 {
+			fmt.Fprintf( os.Stderr, "[FAIL] report for the wrong push: %+v\n", *r )
+			errs++
+		}
+		outcomes += r.outcome + ";"
+	}
+
+	if ! strings.HasPrefix( outcomes, "sent;failed" ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected sent then failed reports, got: %s\n", outcomes )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   failed ovn rule reported to res-mgr\n" )
+	} else {
+		t.Fail()
+	}
+}
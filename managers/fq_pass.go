@@ -89,5 +89,5 @@ func send_pt_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *strin
 		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
 	}
 
-	fq_sheep.Baa( 2, "passthru flow-mod request sent to agent manager: %s", json )
+	fq_sheep.Baa( 2, "passthru flow-mod request sent to agent manager: cid=%s %s", data.Cid, json )
 }
@@ -0,0 +1,129 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	fq_pri
+	Abstract:	Flow-mod priority tiers by kind of pledge. Each kind has a built-in base
+				priority (steering 100, bandwidth 400, mirror 100) and the flow-mods it
+				generates are set at or a few points above the base (steering uses 100
+				through 300, bandwidth 390 through 455 with handover bumps). The base for
+				each kind can be changed in the config; the difference from the built-in
+				value is added to every flow-mod priority of the kind so that the ordering
+				within a kind is kept. For example, setting the steering base to 500 puts
+				all steering flow-mods above all bandwidth flow-mods.
+
+				The adjustment is applied by fq-manager to steering flow-mods, and passed
+				to the agent's bandwidth, oneway and multicast scripts (-A). Mirrors are
+				pushed by res-mgr which passes the priority in the mirror options (pri=n).
+
+	CFG:		fqmgr:pri_steering - base priority for steering flow-mods (100)
+				fqmgr:pri_bandwidth - base priority for bandwidth (including oneway and multicast) flow-mods (400)
+				fqmgr:pri_mirror - base priority for flow-mod based mirrors (100)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	MAX_PRI_BASE	int = 60000				// leaves room for the offsets within a kind below the ovs max
+)
+
+/*
+	Built-in base priorities and the config key that can change each.
+*/
+var pri_tiers = []struct {
+	ptype	int
+	key		string
+	base	int
+} {
+	{ gizmos.PT_STEERING,	"pri_steering",		100 },
+	{ gizmos.PT_BANDWIDTH,	"pri_bandwidth",	400 },
+	{ gizmos.PT_MIRRORING,	"pri_mirror",		100 },
+}
+
+var pri_adj = make( map[int]int )			// adjustment by ptype; set once during initialisation, read only after
+
+/*
+	Read the configured base priorities. Called from Initialise before the managers are started.
+*/
+func pri_tiers_init( ) {
+	if cfg_data["fqmgr"] == nil {
+		return
+	}
+
+	for _, t := range pri_tiers {
+		p := cfg_data["fqmgr"][t.key]
+		if p == nil {
+			continue
+		}
+
+		base := clike.Atoi( *p )
+		if base < 1 || base > MAX_PRI_BASE {
+			tegu_sheep.Baa( 0, "WRN: fqmgr:%s in config is out of range (1-%d), default %d used: %s  [TGUFQM016]", t.key, MAX_PRI_BASE, t.base, *p )
+			continue
+		}
+
+		pri_adj[t.ptype] = base - t.base
+		tegu_sheep.Baa( 1, "flow-mod priority base for %s set to %d", t.key, base )
+	}
+}
+
+/*
+	Return the amount to add to the built-in flow-mod priorities of the pledge type.
+*/
+func pri_adjust( ptype int ) ( int ) {
+	return pri_adj[ptype]
+}
+
+/*
+	Add the priority adjustment for the pledge type to the parms of an agent bandwidth
+	action; nothing is added when there is no adjustment so that older agents are not
+	given an option they don't know.
+*/
+func add_pri_adj( parms map[string]string, ptype int ) {
+	if adj := pri_adj[ptype]; adj != 0 {
+		parms["padj"] = fmt.Sprintf( "%d", adj )
+	}
+}
+
+/*
+	Return the base priority for the pledge type (built-in plus the adjustment).
+*/
+func pri_base( ptype int ) ( int ) {
+	for _, t := range pri_tiers {
+		if t.ptype == ptype {
+			return t.base + pri_adj[ptype]
+		}
+	}
+
+	return 100
+}
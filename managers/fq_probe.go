@@ -0,0 +1,136 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+
+	Mnemonic:	fq_probe
+	Abstract:	Bookkeeping shared by the fq-mgr functions which ask an agent to watch a set of
+				flow-mods some time after they were pushed (nat match probes and reservation
+				verification). An entry is pending until it comes due, probing while the agent
+				has the request, and then holds the result. The agent's response can be lost
+				(agent restarted, command failed or timed out) so an entry that has been probing
+				for longer than the window plus the timeout is put back to pending and sent
+				again; once tries responses have been lost it is given up on (noresponse).
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	The timing of a prober, from the config.
+*/
+type probe_cfg struct {
+	delay	int64					// seconds after a push before the probe is run
+	window	int64					// seconds that the agent watches
+	timeout	int64					// seconds beyond the window that we wait for the response
+	tries	int
+}
+
+/*
+	One set of flow-mods (reservation and host) being probed.
+*/
+type agent_probe struct {
+	id		string
+	host	string						// host as given to the agent (with suffix)
+	data	map[string]string			// parms for the agent
+	pushed	int64						// time of the last push or idle probe
+	sent	int64						// time the last probe request was sent
+	expiry	int64
+	tries	int							// probe requests sent
+	lost	int							// probe requests that were never answered
+	state	string						// pending, probing, noresponse or a result
+}
+
+/*
+	Return true if the probe's match is the same as that in the data given.
+*/
+func (pr *agent_probe) same( data map[string]string ) ( bool ) {
+	for k, v := range data {
+		if pr.data[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+	Check the probe against the clock. Send is true if it is pending and has been installed long
+	enough (and won't end before a window could finish). A probe whose response is overdue is
+	counted as lost and made pending again; gave_up is true when it has been lost too many times
+	and the state is now noresponse.
+*/
+func (pc *probe_cfg) due( pr *agent_probe, now int64 ) ( send bool, gave_up bool ) {
+	if pr.state == "probing" {
+		if now - pr.sent < pc.window + pc.timeout {
+			return false, false
+		}
+
+		pr.lost++
+		if pr.lost >= pc.tries {
+			fq_sheep.Baa( 1, "WRN: no probe response for %s on %s after %d tries; giving up", pr.id, pr.host, pr.lost )
+			pr.state = "noresponse"
+			return false, true
+		}
+
+		fq_sheep.Baa( 1, "probe response for %s on %s is overdue (%d lost); will be retried", pr.id, pr.host, pr.lost )
+		pr.state = "pending"
+	}
+
+	if pr.state != "pending" || now - pr.pushed < pc.delay || pr.expiry - now < pc.window * 2 {
+		return false, false						// too soon, or ends (cancel, pause) before a window could finish
+	}
+
+	return true, false
+}
+
+/*
+	Send the probe to the agent as an action of the type given and mark it probing. Returns
+	false if the request couldn't be built.
+*/
+func (pr *agent_probe) send( atype string, now int64 ) ( bool ) {
+	msg := &agent_cmd{ Ctype: "action_list" }
+	msg.Actions = make( []action, 1 )
+	msg.Actions[0].Atype = atype
+	msg.Actions[0].Hosts = []string{ pr.host }
+	msg.Actions[0].Data = pr.data
+
+	jmsg, err := json.Marshal( msg )
+	if err != nil {
+		fq_sheep.Baa( 1, "unable to build %s request: %s", atype, err )
+		return false
+	}
+
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( jmsg ), nil )
+	pr.state = "probing"
+	pr.sent = now
+	pr.tries++
+	return true
+}
@@ -0,0 +1,295 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+/*
+
+	Mnemonic:	fq_qapply
+	Abstract:	Two phase application of queue maps. Each queue map sent by res-mgr is given a
+				generation number and is sent to the agent for each host that has queues in the
+				map (setqueues action). The agent applies the map (create_ovs_queues), then
+				checks the OVS QoS state of the host against it (ql_check_queues) and returns
+				the result for the host and generation: ok, or fail with the reason.
+
+				A host whose apply fails, or whose result doesn't arrive within fqmgr:queue_retry
+				seconds, is sent the current map again; after fqmgr:queue_tries attempts it is
+				marked failed (noresponse if the agent never answered) and an error is logged.
+				A newer map replaces an older one: results for an old generation are ignored and
+				the attempts are reset. The per-host status is returned by the qstatus request.
+
+	CFG:		fqmgr:queue_retry - seconds before a failed or unanswered host is sent the map again (30)
+				fqmgr:queue_tries - attempts per host before it is marked failed (5)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	Application status of the current queue map on one host; returned by qstatus.
+*/
+type qhost_status struct {
+	Host		string	`json:"host"`
+	State		string	`json:"state"`				// pending, retry, applied, failed or noresponse
+	Gen			int64	`json:"gen"`				// generation last sent to the host
+	Tries		int		`json:"tries"`
+	Sent		int64	`json:"sent"`
+	Updated		int64	`json:"updated"`			// when the state last changed
+	Reason		string	`json:"reason,omitempty"`
+}
+
+type qapply struct {
+	gen		int64							// generation of the current map
+	gen_ts	int64							// when the current map arrived
+	qlist	[]string						// current map as sent to the agents
+	hosts	map[string]*qhost_status		// hosts with queues in the current map
+	retry	int64
+	tries	int
+}
+
+func mk_qapply( ) ( qa *qapply ) {
+	qa = &qapply{
+		hosts:	make( map[string]*qhost_status ),
+		retry:	30,
+		tries:	5,
+	}
+
+	if p := cfg_data["fqmgr"]["queue_retry"]; p != nil {
+		qa.retry = clike.Atoi64( *p )
+	}
+	if p := cfg_data["fqmgr"]["queue_tries"]; p != nil {
+		qa.tries = clike.Atoi( *p )
+	}
+	if qa.retry < 5 {
+		qa.retry = 5
+	}
+	if qa.tries < 1 {
+		qa.tries = 1
+	}
+
+	return
+}
+
+/*
+	Accept a new queue map and send it to the agent of each host that has queues in it.
+	The host names in the map are given the suffix, and the list carries both forms of
+	each entry as the script's view of the host name might not have the suffix.
+*/
+func (qa *qapply) apply( qlist []string, phsuffix *string ) {
+	target_hosts := make( map[string]bool )					// hosts that are actually affected by the queue list
+	if phsuffix != nil {									// need to convert the host names in the list to have suffix
+		nql := make( []string, len( qlist ) * 2 )			// need one for each possible host name
+
+		offset := len( qlist )								// put the originals into the second half of the array
+		for i := range qlist {
+			nql[offset+i] = qlist[i]								// just copy the original
+
+			toks := strings.SplitN( qlist[i], "/", 2 )				// split host from front
+			if len( toks ) == 2 {
+				nh := add_phost_suffix( &toks[0],  phsuffix )		// add the suffix
+				nql[i] = *nh + "/" +  toks[1]
+				target_hosts[*nh] = true
+			} else {
+				nql[i] = qlist[i]
+				fq_sheep.Baa( 1, "target host not snarfed: %s", qlist[i] )
+			}
+		}
+
+		qlist = nql
+	} else {												// just snarf the list of hosts affected
+		for i := range qlist {
+			toks := strings.SplitN( qlist[i], "/", 2 )				// split host from front
+			if len( toks ) == 2 {
+				target_hosts[toks[0]] = true
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	qa.gen++
+	qa.gen_ts = now
+	qa.qlist = qlist
+	for h := range qa.hosts {
+		if ! target_hosts[h] {
+			delete( qa.hosts, h )							// no queues for it in this map
+		}
+	}
+
+	fq_sheep.Baa( 1, "adjusting queues:  sending %d queue setting items to agents for %d hosts (gen %d)",  len( qlist ), len( target_hosts ), qa.gen );
+	for h := range target_hosts {
+		hs := qa.hosts[h]
+		if hs == nil {
+			hs = &qhost_status{ Host: h }
+			qa.hosts[h] = hs
+		}
+		hs.Tries = 0
+		hs.Reason = ""
+		qa.send( hs, now )
+	}
+}
+
+/*
+	Send the current map to the agent for one host.
+*/
+func (qa *qapply) send( hs *qhost_status, now int64 ) {
+	msg := &agent_cmd{ Ctype: "action_list" }
+	msg.Actions = make( []action, 1 )
+	msg.Actions[0].Atype = "setqueues"
+	msg.Actions[0].Hosts = []string{ hs.Host }
+	msg.Actions[0].Qdata = qa.qlist
+	msg.Actions[0].Data = map[string]string{ "qgen": fmt.Sprintf( "%d", qa.gen ) }
+
+	jmsg, err := json.Marshal( msg )
+	if err != nil {
+		fq_sheep.Baa( 1, "unable to build setqueues request for %s: %s", hs.Host, err )
+		return
+	}
+
+	fq_sheep.Baa( 2, "queue update: host=%s gen=%d try=%d", hs.Host, qa.gen, hs.Tries + 1 )
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( jmsg ), nil )		// send this as a short request to one agent
+
+	hs.State = "pending"
+	hs.Gen = qa.gen
+	hs.Tries++
+	hs.Sent = now
+	hs.Updated = now
+}
+
+/*
+	Record the results returned by an agent: host gen ok|fail [reason]. Results for an older
+	generation than the current map are ignored.
+*/
+func (qa *qapply) result( recs []string ) {
+	now := time.Now().Unix()
+	for _, r := range recs {
+		toks := strings.SplitN( r, " ", 4 )
+		if len( toks ) < 3 {
+			continue
+		}
+
+		hs := qa.hosts[toks[0]]
+		if hs == nil || clike.Atoi64( toks[1] ) != qa.gen {
+			fq_sheep.Baa( 2, "setqueues result ignored (unknown host or old generation): %s", r )
+			continue
+		}
+
+		hs.Updated = now
+		if toks[2] == "ok" {
+			hs.State = "applied"
+			hs.Reason = ""
+			fq_sheep.Baa( 2, "queue map gen %d applied and verified on %s", qa.gen, hs.Host )
+			continue
+		}
+
+		hs.Reason = "apply or verification failed"
+		if len( toks ) > 3 {
+			hs.Reason = toks[3]
+		}
+		qa.retire( hs, "failed" )
+	}
+}
+
+/*
+	Mark a host that failed (or didn't answer) for another attempt, or as failed when its
+	attempts are used.
+*/
+func (qa *qapply) retire( hs *qhost_status, state string ) {
+	if hs.Tries < qa.tries {
+		hs.State = "retry"
+		fq_sheep.Baa( 1, "queue map gen %d not applied on %s (try %d of %d): %s", qa.gen, hs.Host, hs.Tries, qa.tries, hs.Reason )
+		return
+	}
+
+	hs.State = state
+	fq_sheep.Baa( 0, "ERR: queue map gen %d could not be applied on %s after %d tries: %s  [TGUFQM024]", qa.gen, hs.Host, hs.Tries, hs.Reason )
+}
+
+/*
+	Driven by the tickler: hosts whose result is overdue are counted as failed, and hosts
+	waiting for a retry are sent the map again once the retry time has passed.
+*/
+func (qa *qapply) check( ) {
+	now := time.Now().Unix()
+	for _, hs := range qa.hosts {
+		if now - hs.Sent < qa.retry {
+			continue
+		}
+
+		switch hs.State {
+			case "pending":
+				hs.Reason = "no response from agent"
+				hs.Updated = now
+				qa.retire( hs, "noresponse" )
+				if hs.State == "retry" {
+					qa.send( hs, now )
+				}
+
+			case "retry":
+				qa.send( hs, now )
+		}
+	}
+}
+
+/*
+	Return the status of the current map on each host, or on just the named host, as json.
+	The host may be given with or without the physical host suffix.
+*/
+func (qa *qapply) status( host string, phsuffix *string ) ( string, error ) {
+	shost := host
+	if host != "" && phsuffix != nil {
+		shost = *add_phost_suffix( &host, phsuffix )
+	}
+
+	list := make( []*qhost_status, 0, len( qa.hosts ) )
+	for h, hs := range qa.hosts {
+		if host == "" || h == host || h == shost {
+			list = append( list, hs )
+		}
+	}
+	if host != "" && len( list ) == 0 {
+		return "", mk_err( ERR_NOT_FOUND, "no queues are applied to host: %s", host )
+	}
+	sort.Slice( list, func( i, j int ) bool { return list[i].Host < list[j].Host } )
+
+	jout, err := json.Marshal( struct {
+		Gen		int64				`json:"gen"`
+		Ts		int64				`json:"ts"`
+		Hosts	[]*qhost_status		`json:"hosts"`
+	}{ qa.gen, qa.gen_ts, list } )
+	if err != nil {
+		return "", mk_err( ERR_INTERNAL, "unable to build queue status: %s", err )
+	}
+	return string( jout ), nil
+}
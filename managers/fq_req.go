@@ -29,6 +29,9 @@
 				20 Apr 2015 : Correct bug - not passing direction of external IP address to agent.
 				01 Sep 2015 : Changed bleat level for bwow debugging message.
 				04 Feg 2015 : Tweak to allow udp:0 and tcp:0 to be passed to agent.
+				16 Oct 2026 : Pass priority bump to agent for handover.
+				16 Oct 2026 : Include reservation id and correlation id in agent parm maps.
+				16 Oct 2026 : Added To_mcast_map().
 */
 
 package managers
@@ -36,6 +39,7 @@ package managers
 import (
 	"fmt"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/att/tegu/gizmos"
@@ -129,6 +133,13 @@ func ( fq *Fq_req ) To_bw_map( ) ( fmap map[string]string ) {
 		return
 	}
 
+	if fq.Id != nil {
+		fmap["resid"] = *fq.Id													// not used by the agent; allows the command log to be searched by reservation
+	}
+	if fq.Cid != "" {
+		fmap["cid"] = fq.Cid													// correlation id; agent includes it in its log
+	}
+
 	if fq.Match.Smac != nil {
 		fmap["smac"] = *fq.Match.Smac
 	} else {
@@ -167,6 +178,9 @@ func ( fq *Fq_req ) To_bw_map( ) ( fmap map[string]string ) {
 	//fmap["mtbase"] =  fmt.Sprintf( "%d", fq.Mtbase )
 	fmap["oneswitch"] = fmt.Sprintf( "%v", fq.Single_switch )
 	fmap["koe"] = fmt.Sprintf( "%v", fq.Dscp_koe )
+	if fq.Pbump > 0 {
+		fmap["pbump"] = fmt.Sprintf( "%d", fq.Pbump )						// only when set so older agents don't see an unknown option
+	}
 
 	if fq.Tptype != nil && *fq.Tptype != "none"  && *fq.Tptype != "" {					// if a transport proto type supplied, turn it on
 		if fq.Match.Tpsport != nil {													// set src/dest ports if they are defined
@@ -202,6 +216,13 @@ func ( fq *Fq_req ) To_bwow_map( ) ( fmap map[string]string ) {
 		return
 	}
 
+	if fq.Id != nil {
+		fmap["resid"] = *fq.Id													// not used by the agent; allows the command log to be searched by reservation
+	}
+	if fq.Cid != "" {
+		fmap["cid"] = fq.Cid													// correlation id; agent includes it in its log
+	}
+
 	if fq.Match.Smac != nil {
 		fmap["smac"] = *fq.Match.Smac
 	} else {
@@ -263,6 +284,13 @@ func ( fq *Fq_req ) To_pt_map( ) ( fmap map[string]string ) {
 		return
 	}
 
+	if fq.Id != nil {
+		fmap["resid"] = *fq.Id													// not used by the agent; allows the command log to be searched by reservation
+	}
+	if fq.Cid != "" {
+		fmap["cid"] = fq.Cid													// correlation id; agent includes it in its log
+	}
+
 	if fq.Match.Smac != nil {					// could be endpoint, but likely mac in the original Tegu.
 		fmap["smac"] = *fq.Match.Smac
 	} else {
@@ -280,3 +308,58 @@ func ( fq *Fq_req ) To_pt_map( ) ( fmap map[string]string ) {
 
 	return
 }
+
+/*
+	Build a map suitable for use as parms for a multicast flow-mod request to the agent manager.
+	Smac is set only on the switch where the source is attached; the receiver addresses are
+	converted to mac addresses using the map passed in. Receivers which can't be mapped are
+	dropped (logged).
+*/
+func ( fq *Fq_req ) To_mcast_map( ip2mac map[string]*string ) ( fmap map[string]string ) {
+	fmap = make( map[string]string )
+
+	if fq == nil {
+		return
+	}
+
+	if fq.Id != nil {
+		fmap["resid"] = *fq.Id
+	}
+	if fq.Cid != "" {
+		fmap["cid"] = fq.Cid
+	}
+
+	if fq.Match.Smac != nil {
+		fmap["smac"] = *fq.Match.Smac
+	} else {
+		fmap["smac"] = ""
+	}
+	if fq.Match.Ip2 != nil {
+		fmap["group"] = *fq.Match.Ip2
+	}
+
+	rmacs := make( []string, 0, len( fq.Rcvrs ) )
+	for _, ip := range fq.Rcvrs {
+		if ip == nil {
+			continue
+		}
+		if m := ip2mac[*ip]; m != nil {
+			rmacs = append( rmacs, *m )
+		} else {
+			fq_sheep.Baa( 1, "multicast receiver %s has no known mac; not added to flow-mods for %s", *ip, str_or_empty( fq.Id ) )
+		}
+	}
+	fmap["rmacs"] = strings.Join( rmacs, "," )						// agent passes this on the command line; no spaces
+
+	if fq.Espq != nil && fq.Espq.Queuenum > 0 {
+		fmap["queue"] =  fmt.Sprintf( "%d", fq.Espq.Queuenum )
+	}
+	fmap["dscp"] =  fmt.Sprintf( "%d", fq.Dscp << 2 )						// shift left 2 bits to match what OVS wants
+	fmap["ipv6"] =  fmt.Sprintf( "%v", fq.Ipv6 )
+	fmap["timeout"] =  fmt.Sprintf( "%d", fq.Expiry - time.Now().Unix() )
+	if fq.Tptype != nil && *fq.Tptype != "none" && *fq.Tptype != "" && fq.Match.Tpdport != nil {
+		fmap["dproto"] = fmt.Sprintf( "%s:%s", *fq.Tptype, *fq.Match.Tpdport )
+	}
+
+	return
+}
@@ -0,0 +1,223 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+/*
+
+	Mnemonic:	fq_sla
+	Abstract:	Usage and queue drop polling for SLA breach detection (res_mgr_sla.go). Each
+				bandwidth flow-mod request sent to an agent is remembered (reservation, host,
+				the two macs, the queue and the rate). Every fqmgr:sla_poll seconds the agent
+				of each host is asked for the bytes counted by the outbound flow-mods and the
+				drops of the queue (sla_stats action, ql_sla_stats). The rate over the interval
+				and the drops added since the last poll are passed to res-mgr which decides
+				whether the reservation is getting its guarantee.
+
+				Either count going backwards (flow-mods or queues replaced) restarts that flow;
+				nothing is reported for it until the next poll.
+
+	CFG:		fqmgr:sla_poll - seconds between polls; 0 disables (0)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	The rate and drops of one direction of a reservation over the last poll interval;
+	given to res-mgr. Drops is -1 when the agent could not count them.
+*/
+type sla_sample struct {
+	Id			string
+	Flow		string					// host and direction (smac>dmac)
+	Guarantee	int64					// reserved rate, bits/sec
+	Rate		int64					// observed rate, bits/sec
+	Drops		int64
+	Ts			int64
+}
+
+/*
+	One set of flow-mods (reservation, host and direction) being polled.
+*/
+type sla_flow struct {
+	id		string
+	host	string						// host as given to the agent (with suffix)
+	dir		string						// smac>dmac
+	rate	int64
+	expiry	int64
+	bytes	int64						// counts at the last poll; -1 until polled
+	drops	int64
+	ts		int64						// time of the last poll
+}
+
+type slapoller struct {
+	freq	int64
+	flows	map[string]*sla_flow		// keyed by host and id,smac,dmac,queue as given to the agent
+}
+
+/*
+	Build the poller from the config. Nil is returned if polling is disabled.
+*/
+func mk_slapoller( ) ( sp *slapoller ) {
+	if cfg_data["fqmgr"] == nil {
+		return nil
+	}
+
+	sp = &slapoller{
+		flows:	make( map[string]*sla_flow ),
+	}
+
+	if p := cfg_data["fqmgr"]["sla_poll"]; p != nil {
+		sp.freq = clike.Atoi64( *p )
+	}
+
+	if sp.freq <= 0 {
+		return nil
+	}
+
+	fq_sheep.Baa( 1, "reservation rates and queue drops are polled every %ds for sla checks", sp.freq )
+	return sp
+}
+
+/*
+	Remember a bandwidth flow-mod request that was just sent to an agent.
+*/
+func (sp *slapoller) pushed( fdata *Fq_req, phost_suffix *string ) {
+	if sp == nil || fdata == nil || fdata.Id == nil || fdata.Espq == nil || fdata.Espq.Switch == "" || fdata.Rate <= 0 {
+		return
+	}
+	if fdata.Match.Smac == nil || fdata.Match.Dmac == nil {
+		return
+	}
+
+	host := &fdata.Espq.Switch
+	if phost_suffix != nil {
+		host = add_phost_suffix( host, phost_suffix )
+	}
+
+	key := fmt.Sprintf( "%s %s,%s,%s,%d", *host, *fdata.Id, *fdata.Match.Smac, *fdata.Match.Dmac, fdata.Espq.Queuenum )
+	if sf := sp.flows[key]; sf != nil {
+		sf.expiry = fdata.Expiry					// a re-push; keep the counts
+		sf.rate = fdata.Rate
+		return
+	}
+
+	sp.flows[key] = &sla_flow{ id: *fdata.Id, host: *host, dir: *fdata.Match.Smac + ">" + *fdata.Match.Dmac,
+		rate: fdata.Rate, expiry: fdata.Expiry, bytes: -1, drops: -1 }
+}
+
+/*
+	Send a stats request to each host with reservation flow-mods. Expired entries are
+	dropped.
+*/
+func (sp *slapoller) poll( ) {
+	if sp == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	hosts := make( map[string][]string )
+	for k, sf := range sp.flows {
+		if sf.expiry <= now {
+			delete( sp.flows, k )
+			continue
+		}
+
+		hosts[sf.host] = append( hosts[sf.host], k[len( sf.host ) + 1:] )
+	}
+
+	for host, list := range hosts {
+		msg := &agent_cmd{ Ctype: "action_list" }
+		msg.Actions = make( []action, 1 )
+		msg.Actions[0].Atype = "sla_stats"
+		msg.Actions[0].Hosts = []string{ host }
+		msg.Actions[0].Fdata = list
+
+		jmsg, err := json.Marshal( msg )
+		if err != nil {
+			fq_sheep.Baa( 1, "unable to build sla stats request: %s", err )
+			continue
+		}
+
+		tmsg := ipc.Mk_chmsg( )
+		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( jmsg ), nil )
+	}
+
+	if len( hosts ) > 0 {
+		fq_sheep.Baa( 2, "sla stats requested from %d hosts", len( hosts ) )
+	}
+}
+
+/*
+	Evaluate the records returned by an agent: host id,smac,dmac,queue bytes drops. A sample
+	for each flow that was counted before is passed to res-mgr.
+*/
+func (sp *slapoller) polled( recs []string ) {
+	if sp == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	samples := make( []*sla_sample, 0, len( recs ) )
+	for _, r := range recs {
+		toks := strings.Fields( r )
+		if len( toks ) != 4 {
+			continue
+		}
+
+		sf := sp.flows[toks[0] + " " + toks[1]]
+		if sf == nil {
+			continue								// expired while the poll was running
+		}
+
+		n := clike.Atoi64( toks[2] )
+		d := clike.Atoi64( toks[3] )
+		if sf.bytes >= 0 && n >= sf.bytes && now > sf.ts {
+			s := &sla_sample{ Id: sf.id, Flow: sf.host + " " + sf.dir, Guarantee: sf.rate, Rate: ((n - sf.bytes) * 8) / (now - sf.ts), Drops: -1, Ts: now }
+			if d >= 0 && sf.drops >= 0 && d >= sf.drops {
+				s.Drops = d - sf.drops
+			}
+			samples = append( samples, s )
+		}
+
+		sf.bytes = n
+		sf.drops = d
+		sf.ts = now
+	}
+
+	if len( samples ) > 0 {
+		fq_sheep.Baa( 2, "sla samples sent to res-mgr: %d", len( samples ) )
+		tmsg := ipc.Mk_chmsg( )
+		tmsg.Send_req( rmgr_ch, nil, REQ_SLA_USAGE, samples, nil )
+	}
+}
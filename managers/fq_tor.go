@@ -0,0 +1,291 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+	Mnemonic:	fq_tor
+	Abstract:	Physical (top of rack) switch enforcement. The hypervisor OVS shapes traffic as it
+				leaves the host, but nothing limits it once it is on the wire. When configured,
+				a rate limit is also pushed to each physical switch on the inter-switch legs of a
+				bandwidth reservation's path: the switch and its egress port, the flow (addresses,
+				protocol, ports, dscp) and the rate.
+
+				Pushing is done by a driver:
+					cmd		- runs a command for each add/delete. The command is given the action
+							  followed by key=value pairs (switch, port, id, src, dst, proto, sport,
+							  dport, dscp, rate). This is how gNMI (e.g. gnmic) and NETCONF clients
+							  are wired in; the command maps the limit to the vendor's model.
+					rest	- POSTs the limit as json to the url to add, and sends a DELETE to
+							  url/key to remove it.
+
+				Only the switches listed are sent limits; all means every switch on an inter-switch
+				leg. Switches don't expire the limits, so they are tracked here and removed by a
+				periodic sweep once the reservation (or the short expiry of a pause or cancel)
+				passes. Used in addition to the agent or ovn backend, not instead of it.
+
+				Oneway and multicast reservations aren't pushed to physical switches.
+
+	Config:		fqmgr:tor_driver   - cmd or rest; unset disables physical switch enforcement
+				fqmgr:tor_cmd      - command run by the cmd driver
+				fqmgr:tor_url      - base url used by the rest driver
+				fqmgr:tor_switches - space separated switch ids, or all
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+/*
+	A rate limit on one physical switch port.
+*/
+type tor_limit struct {
+	Switch	string		`json:"switch"`
+	Port	int			`json:"port"`
+	Id		string		`json:"id"`
+	Src		string		`json:"src"`
+	Dst		string		`json:"dst"`
+	Proto	string		`json:"proto"`
+	Sport	string		`json:"sport"`
+	Dport	string		`json:"dport"`
+	Dscp	int			`json:"dscp"`
+	Rate	int64		`json:"rate"`
+	expiry	int64
+}
+
+/*
+	Something that can add and remove limits on a physical switch.
+*/
+type tor_driver interface {
+	apply( tl *tor_limit ) error
+	remove( tl *tor_limit ) error
+}
+
+type tor_cmd_driver struct {
+	cmd		[]string
+}
+
+type tor_rest_driver struct {
+	url		string
+	client	*http.Client
+}
+
+type tor_backend struct {
+	drv			tor_driver
+	all			bool						// all switches on inter-switch legs
+	switches	map[string]bool				// switches that are sent limits when not all
+	limits		map[string]*tor_limit		// limits we've pushed keyed by switch/port/flow
+}
+
+/*
+	Key used to track a limit, and as the last element of the rest driver's delete url.
+*/
+func (tl *tor_limit) key( ) ( string ) {
+	return fmt.Sprintf( "%s_%d_%s_%s_%s_%s_%s_%s", tl.Switch, tl.Port, tl.Id, tl.Src, tl.Dst, tl.Proto, tl.Sport, tl.Dport )
+}
+
+func (tl *tor_limit) to_args( action string ) ( []string ) {
+	return []string{ action,
+		"switch=" + tl.Switch, fmt.Sprintf( "port=%d", tl.Port ), "id=" + tl.Id,
+		"src=" + tl.Src, "dst=" + tl.Dst, "proto=" + tl.Proto, "sport=" + tl.Sport, "dport=" + tl.Dport,
+		fmt.Sprintf( "dscp=%d", tl.Dscp ), fmt.Sprintf( "rate=%d", tl.Rate ) }
+}
+
+func (cd *tor_cmd_driver) run( action string, tl *tor_limit ) ( error ) {
+	args := append( append( []string{}, cd.cmd[1:]... ), tl.to_args( action )... )
+	out, err := exec.Command( cd.cmd[0], args... ).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf( "%s %s: %s: %s", cd.cmd[0], action, err, strings.TrimSpace( string( out ) ) )
+	}
+
+	return nil
+}
+
+func (cd *tor_cmd_driver) apply( tl *tor_limit ) ( error ) {
+	return cd.run( "add", tl )
+}
+
+func (cd *tor_cmd_driver) remove( tl *tor_limit ) ( error ) {
+	return cd.run( "del", tl )
+}
+
+func (rd *tor_rest_driver) send( method string, url string, body []byte ) ( error ) {
+	req, err := http.NewRequest( method, url, bytes.NewReader( body ) )
+	if err != nil {
+		return err
+	}
+	req.Header.Set( "Content-Type", "application/json" )
+
+	resp, err := rd.client.Do( req )
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf( "%s %s: %s", method, url, resp.Status )
+	}
+	return nil
+}
+
+func (rd *tor_rest_driver) apply( tl *tor_limit ) ( error ) {
+	body, err := json.Marshal( tl )
+	if err != nil {
+		return err
+	}
+
+	return rd.send( "POST", rd.url, body )
+}
+
+func (rd *tor_rest_driver) remove( tl *tor_limit ) ( error ) {
+	return rd.send( "DELETE", rd.url + "/" + tl.key(), nil )
+}
+
+/*
+	Create the backend from the fqmgr config. Returns nil if physical switch enforcement
+	isn't configured (or is configured badly).
+*/
+func mk_tor_backend( ) ( *tor_backend ) {
+	cfg := cfg_data["fqmgr"]
+	if cfg == nil || cfg["tor_driver"] == nil {
+		return nil
+	}
+
+	tb := &tor_backend{
+		switches:	make( map[string]bool ),
+		limits:		make( map[string]*tor_limit ),
+	}
+
+	switch *cfg["tor_driver"] {
+		case "cmd":
+			if cfg["tor_cmd"] == nil || strings.TrimSpace( *cfg["tor_cmd"] ) == "" {
+				fq_sheep.Baa( 0, "ERR: fqmgr:tor_driver is cmd but no tor_cmd was given; physical switches will not be sent limits  [TGUFQM017]" )
+				return nil
+			}
+			tb.drv = &tor_cmd_driver{ cmd: strings.Fields( *cfg["tor_cmd"] ) }
+
+		case "rest":
+			if cfg["tor_url"] == nil || *cfg["tor_url"] == "" {
+				fq_sheep.Baa( 0, "ERR: fqmgr:tor_driver is rest but no tor_url was given; physical switches will not be sent limits  [TGUFQM017]" )
+				return nil
+			}
+			tb.drv = &tor_rest_driver{ url: strings.TrimRight( *cfg["tor_url"], "/" ), client: &http.Client{ Timeout: 10 * time.Second } }
+
+		default:
+			fq_sheep.Baa( 0, "ERR: unknown fqmgr:tor_driver (expected cmd or rest): %s  [TGUFQM017]", *cfg["tor_driver"] )
+			return nil
+	}
+
+	if p := cfg["tor_switches"]; p != nil {
+		for _, sw := range strings.Fields( *p ) {
+			if sw == "all" {
+				tb.all = true
+			} else {
+				tb.switches[sw] = true
+			}
+		}
+	}
+
+	fq_sheep.Baa( 1, "physical switch limits will be pushed with the %s driver; all=%v switches=%d", *cfg["tor_driver"], tb.all, len( tb.switches ) )
+	return tb
+}
+
+/*
+	Push a limit for each inter-switch leg of the request's path that is on a physical switch
+	we manage. A limit already pushed only has its expiry updated.
+*/
+func (tb *tor_backend) send_bw( data *Fq_req ) {
+	if tb == nil || data == nil || data.Single_switch || len( data.Legs ) == 0 {
+		return
+	}
+
+	for _, leg := range data.Legs {
+		if leg == nil || leg.Switch == "" || (! tb.all && ! tb.switches[leg.Switch]) {
+			continue
+		}
+
+		tl := &tor_limit{
+			Switch:	leg.Switch,
+			Port:	leg.Port,
+			Id:		str_or_empty( data.Id ),
+			Src:	str_or_empty( data.Match.Ip1 ),
+			Dst:	str_or_empty( data.Match.Ip2 ),
+			Proto:	str_or_empty( data.Tptype ),
+			Sport:	str_or_empty( data.Match.Tpsport ),
+			Dport:	str_or_empty( data.Match.Tpdport ),
+			Dscp:	data.Dscp,
+			Rate:	data.Rate,
+			expiry:	data.Expiry,
+		}
+		if data.Extip != nil && *data.Extip != "" && data.Exttyp != nil {		// one end is outside; the switch sees the external address
+			if *data.Exttyp == "-D" {
+				tl.Dst = *data.Extip
+			} else {
+				tl.Src = *data.Extip
+			}
+		}
+
+		k := tl.key()
+		if old := tb.limits[k]; old != nil {
+			old.expiry = tl.expiry
+			fq_sheep.Baa( 2, "tor: limit expiry updated: %s", k )
+			continue
+		}
+
+		if err := tb.drv.apply( tl ); err != nil {
+			fq_sheep.Baa( 0, "ERR: tor: unable to push limit to %s port %d for %s: %s  [TGUFQM018]", tl.Switch, tl.Port, tl.Id, err )
+			continue
+		}
+		tb.limits[k] = tl
+		fq_sheep.Baa( 1, "tor: limit pushed: %s rate=%d dscp=%d cid=%s", k, tl.Rate, tl.Dscp, data.Cid )
+	}
+}
+
+/*
+	Remove limits that have expired. A limit that can't be removed is retried on the next sweep.
+*/
+func (tb *tor_backend) sweep( ) {
+	if tb == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	for k, tl := range tb.limits {
+		if tl.expiry <= now {
+			if err := tb.drv.remove( tl ); err != nil {
+				fq_sheep.Baa( 1, "WRN: tor: unable to remove expired limit: %s: %s  [TGUFQM019]", k, err )
+				continue
+			}
+			delete( tb.limits, k )
+			fq_sheep.Baa( 1, "tor: expired limit removed: %s", k )
+		}
+	}
+}
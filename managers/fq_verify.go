@@ -0,0 +1,283 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	fq_verify
+	Abstract:	Reservation verification. Once the bandwidth flow-mods of a reservation have
+				been in place for fqmgr:verify_probe seconds an agent is asked to watch the
+				reservation's traffic (res_verify action, ql_res_verify) on the switch of the
+				sending VM for fqmgr:verify_window seconds. The agent doesn't generate traffic;
+				it counts the bytes the VM sent (tap), those matched by the reservation's
+				outbound flow-mod, and the packets that left that flow-mod with the DSCP value
+				of the reservation. From those:
+					rate_ok	- the reservation's traffic didn't exceed the reserved rate by more
+							  than fqmgr:verify_tolerance percent
+					dscp_ok	- at least 100 - verify_tolerance percent of the reservation's packets
+							  were marked (always true when the reservation doesn't mark)
+				and the state is verified (both ok), failed, or idle when no traffic was matched
+				(tried again later, up to fqmgr:verify_tries times). A verification not answered
+				within fqmgr:verify_timeout seconds of its window ending is sent again, and is
+				noresponse after verify_tries lost answers (see fq_probe.go).
+
+				Each direction of a reservation is verified on its own; every result is given
+				to res-mgr which shows it with the reservation's flow-mod status (resstatus).
+				Failures are logged and published (reservation.verify_failed). A refresh of the
+				same flow-mods keeps the result; a push with a different match starts over.
+
+	CFG:		fqmgr:verify_probe - seconds after a push before the reservation is verified; 0 disables (0)
+				fqmgr:verify_window - seconds that the agent counts traffic (10)
+				fqmgr:verify_tries - verifications run while no traffic is seen (3)
+				fqmgr:verify_timeout - seconds beyond the window to wait for the agent's answer (60)
+				fqmgr:verify_tolerance - percentage allowed over the rate and unmarked (10)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	The outcome of one verification; given to res-mgr and shown by resstatus.
+*/
+type verify_result struct {
+	State		string	`json:"state"`				// pending, verified, failed, idle or noresponse
+	Rate		int64	`json:"reserved_bps"`
+	Observed	int64	`json:"observed_bps"`		// traffic matched by the reservation
+	Tap			int64	`json:"tap_bps"`			// all traffic sent by the vm
+	Rate_ok		bool	`json:"rate_ok"`
+	Dscp		int		`json:"dscp"`
+	Marked		int		`json:"marked_pct"`
+	Dscp_ok		bool	`json:"dscp_ok"`
+	Ts			int64	`json:"ts"`
+}
+
+/*
+	One direction of a reservation being verified.
+*/
+type res_verify struct {
+	agent_probe
+	dir		string						// smac>dmac; tells the directions apart when both are on one host
+	result	verify_result
+}
+
+type verifier struct {
+	probe_cfg
+	tol		int64
+	probes	map[string]*res_verify		// keyed by id, host and direction
+}
+
+/*
+	Build the verifier from the config. Nil is returned if verification is disabled.
+*/
+func mk_verifier( ) ( v *verifier ) {
+	if cfg_data["fqmgr"] == nil {
+		return nil
+	}
+
+	v = &verifier{
+		probe_cfg: probe_cfg{ window: 10, timeout: 60, tries: 3 },
+		tol:	10,
+		probes:	make( map[string]*res_verify ),
+	}
+
+	if p := cfg_data["fqmgr"]["verify_probe"]; p != nil {
+		v.delay = clike.Atoi64( *p )
+	}
+	if p := cfg_data["fqmgr"]["verify_window"]; p != nil {
+		v.window = clike.Atoi64( *p )
+	}
+	if p := cfg_data["fqmgr"]["verify_tries"]; p != nil {
+		v.tries = clike.Atoi( *p )
+	}
+	if p := cfg_data["fqmgr"]["verify_timeout"]; p != nil {
+		v.timeout = clike.Atoi64( *p )
+	}
+	if p := cfg_data["fqmgr"]["verify_tolerance"]; p != nil {
+		v.tol = clike.Atoi64( *p )
+	}
+
+	if v.delay <= 0 || v.window <= 0 {
+		return nil
+	}
+
+	fq_sheep.Baa( 1, "reservations are verified %ds after a push; window=%ds timeout=%ds tries=%d tolerance=%d%%", v.delay, v.window, v.timeout, v.tries, v.tol )
+	return v
+}
+
+/*
+	Remember a bandwidth flow-mod request that was just sent to an agent.
+*/
+func (v *verifier) pushed( fdata *Fq_req, phost_suffix *string ) {
+	if v == nil || fdata == nil || fdata.Id == nil || fdata.Espq == nil || fdata.Espq.Switch == "" {
+		return
+	}
+
+	host := &fdata.Espq.Switch
+	if phost_suffix != nil {
+		host = add_phost_suffix( host, phost_suffix )
+	}
+
+	bw := fdata.To_bw_map( )
+	add_pri_adj( bw, gizmos.PT_BANDWIDTH )
+	data := map[string]string{ "resid": *fdata.Id, "window": fmt.Sprintf( "%d", v.window ) }
+	for _, k := range []string{ "smac", "dmac", "dscp", "sproto", "dproto", "ipv6", "padj" } {
+		data[k] = bw[k]
+	}
+
+	dir := data["smac"] + ">" + data["dmac"]
+	key := *fdata.Id + " " + *host + " " + dir
+	if pr := v.probes[key]; pr != nil && pr.same( data ) {
+		pr.expiry = fdata.Expiry					// refresh of the same match; keep the result
+		return
+	}
+
+	v.probes[key] = &res_verify{
+		agent_probe: agent_probe{ id: *fdata.Id, host: *host, data: data, pushed: time.Now().Unix(), expiry: fdata.Expiry, state: "pending" },
+		dir: dir,
+		result: verify_result{ State: "pending", Rate: fdata.Rate, Dscp: fdata.Dscp },
+	}
+}
+
+/*
+	Send a verify request for each pending reservation direction that has been installed long
+	enough. Expired entries are dropped; those whose response never came back are retried
+	(fq_probe.go) and res-mgr is told when we give up on one.
+*/
+func (v *verifier) probe( ) {
+	if v == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	n := 0
+	for k, pr := range v.probes {
+		if pr.expiry <= now {
+			delete( v.probes, k )
+			continue
+		}
+
+		send, gave_up := v.due( &pr.agent_probe, now )
+		if gave_up {
+			v.report( pr )
+			continue
+		}
+		if send && pr.send( "res_verify", now ) {
+			n++
+		}
+	}
+
+	if n > 0 {
+		fq_sheep.Baa( 2, "reservation verifications requested: %d", n )
+	}
+}
+
+/*
+	Evaluate the records returned by an agent: host id src-mac tap-bytes res-bytes res-pkts marked-pkts.
+	Results are passed to res-mgr.
+*/
+func (v *verifier) verified( recs []string ) {
+	if v == nil {
+		return
+	}
+
+	for _, r := range recs {
+		toks := strings.Fields( r )
+		if len( toks ) != 7 {
+			continue
+		}
+
+		for _, pr := range v.probes {
+			if pr.id != toks[1] || pr.host != toks[0] || pr.data["smac"] != toks[2] || pr.state != "probing" {
+				continue						// not this one, or re-pushed with a new match while the probe ran
+			}
+
+			v.evaluate( pr, clike.Atoi64( toks[3] ), clike.Atoi64( toks[4] ), clike.Atoi64( toks[5] ), clike.Atoi64( toks[6] ) )
+			break
+		}
+	}
+}
+
+/*
+	Set the result of the probe from the counts and, unless it is to be run again, send it along.
+*/
+func (v *verifier) evaluate( pr *res_verify, tbytes int64, rbytes int64, rpkts int64, mpkts int64 ) {
+	rs := &pr.result
+	if rpkts <= 0 && pr.tries < v.tries {
+		pr.state = "pending"					// nothing to see; look again later
+		pr.pushed = time.Now().Unix()
+		return
+	}
+
+	rs.Ts = time.Now().Unix()
+	rs.Tap = (tbytes * 8) / v.window
+	rs.Observed = (rbytes * 8) / v.window
+	rs.Rate_ok = rs.Rate <= 0 || rs.Observed * 100 <= rs.Rate * (100 + v.tol)
+	rs.Marked = 100
+	if mpkts >= 0 && rpkts > 0 {
+		rs.Marked = int( (mpkts * 100) / rpkts )
+	}
+	rs.Dscp_ok = rs.Dscp == 0 || int64( rs.Marked ) >= 100 - v.tol
+
+	switch {
+		case rpkts <= 0:
+			pr.state = "idle"
+
+		case rs.Rate_ok && rs.Dscp_ok:
+			pr.state = "verified"
+
+		default:
+			pr.state = "failed"
+	}
+	rs.State = pr.state
+
+	fq_sheep.Baa( 2, "verify: %s on %s (%s): %s observed=%d reserved=%d tap=%d marked=%d%%", pr.id, pr.host, pr.dir, rs.State, rs.Observed, rs.Rate, rs.Tap, rs.Marked )
+	if rs.State == "failed" {
+		fq_sheep.Baa( 0, "WRN: reservation %s failed verification on %s (%s): rate_ok=%v (%d of %d bps) dscp_ok=%v (%d%% marked)  [TGUFQM021]",
+			pr.id, pr.host, pr.dir, rs.Rate_ok, rs.Observed, rs.Rate, rs.Dscp_ok, rs.Marked )
+		jr, _ := json.Marshal( rs )
+		publish_event( "reservation.verify_failed", fmt.Sprintf( `{ "id": %q, "host": %q, "dir": %q, "result": %s }`, pr.id, pr.host, pr.dir, jr ) )
+	}
+
+	v.report( pr )
+}
+
+/*
+	Give a copy of the probe's result to res-mgr.
+*/
+func (v *verifier) report( pr *res_verify ) {
+	pr.result.State = pr.state
+	res := pr.result
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( rmgr_ch, nil, REQ_VERIFY_STATE, []interface{}{ pr.id, pr.host + " " + pr.dir, &res }, nil )
+}
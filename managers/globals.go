@@ -45,6 +45,64 @@
 				21 Sep 2015 - Added REQ_GET_PHOST_FROM_PORTUUID
 				12 Nov 2015 - Pulled in httplogger from steering branch.
 				06 Mar 2016 - Added consts for new res mgr lookup channel
+				16 Oct 2026 - Added priority bump to fq_req for reservation handover.
+				16 Oct 2026 - Added rate to fq_req for the ovn backend.
+				16 Oct 2026 - Added correlation id to fq_req.
+				16 Oct 2026 - Added accounting sink.
+				16 Oct 2026 - Initialise the event publisher.
+				16 Oct 2026 - Added approval requests.
+				16 Oct 2026 - Added redact config option.
+				16 Oct 2026 - Added agent replay and host reconcile requests.
+				16 Oct 2026 - Added impact request.
+				16 Oct 2026 - Load the simulation topology (simulation mode).
+				16 Oct 2026 - Added snapshot request.
+				16 Oct 2026 - Apply secrets file and environment references to the config.
+				16 Oct 2026 - Added steer_shared list.
+				16 Oct 2026 - Added cross-tenant consent settings and request.
+				16 Oct 2026 - Added flow table budget requests.
+				16 Oct 2026 - Added flow-mod status, audit, usage and reservation status requests.
+				16 Oct 2026 - Added multicast reservation request and receivers to Fq_req.
+				16 Oct 2026 - Added priority dscp list change request; config file name is kept.
+				16 Oct 2026 - Flow-mod priority tiers are read from the config (fq_pri.go).
+				16 Oct 2026 - Read the network request timeout (ipc_ctx.go).
+				16 Oct 2026 - Added scoped delete all request.
+				16 Oct 2026 - Added undelete and grace check requests.
+				16 Oct 2026 - Added expiry check request.
+				16 Oct 2026 - Added recovery report request.
+				16 Oct 2026 - Added recovered request.
+				16 Oct 2026 - Added inventory stats request.
+				16 Oct 2026 - Added link history requests.
+				16 Oct 2026 - Added capacity check request.
+				16 Oct 2026 - Added consistency check and links exist requests.
+				16 Oct 2026 - Added queue map detail request.
+				16 Oct 2026 - Added search request.
+				16 Oct 2026 - Added maintenance window request.
+				16 Oct 2026 - Added availability zone requests.
+				16 Oct 2026 - Added inter-switch legs to fq requests and the physical switch sweep request.
+				16 Oct 2026 - Added list gateway request.
+				16 Oct 2026 - Added floating ip moved request.
+				16 Oct 2026 - Added nat match probe requests.
+				16 Oct 2026 - Added project members request.
+				16 Oct 2026 - Added remark requests.
+				16 Oct 2026 - Added ovs inventory and link recheck requests.
+				16 Oct 2026 - Added service chain request.
+				16 Oct 2026 - Added set metadata request.
+				16 Oct 2026 - Added batch add request.
+				16 Oct 2026 - Added reservation status watch request.
+				16 Oct 2026 - Added tag export request.
+				16 Oct 2026 - Added agent status request.
+				16 Oct 2026 - Added quarantine request.
+				16 Oct 2026 - Added project tier request.
+				16 Oct 2026 - Added bulk transfer requests and Bulk to Fq_req.
+				16 Oct 2026 - Added placement request.
+				16 Oct 2026 - Set the network provider.
+				16 Oct 2026 - Added path cache request.
+				16 Oct 2026 - Added reach request.
+				16 Oct 2026 - Added batch name translation request.
+				16 Oct 2026 - Added reservation verification requests.
+				16 Oct 2026 - Added SLA stats and report requests.
+				16 Oct 2026 - Tickler is held as a Ticker (seams.go).
+				16 Oct 2026 - Tickler has room for 64 spots.
 */
 
 /*
@@ -165,6 +223,96 @@ const (
 	REQ_GENPLAN					// (re)generate a steering plan for a new/modified chain request
 	REQ_PT_RESERVE				// passthru reservation
 	REQ_VET_RETRY				// run the reservation retry queue if it has size
+	REQ_K8S_POD					// add/delete a kubernetes pod endpoint (osif)
+	REQ_OVN_SWEEP				// remove expired ovn qos rules (fq-mgr)
+	REQ_AGENT_LOG				// list recent agent commands (agent manager)
+	REQ_APPROVE					// approve or reject a reservation awaiting approval
+	REQ_APPROVAL_CHECK			// reject reservations that have waited too long for approval
+	REQ_AGENT_REPLAY			// replay pending agent work (agent manager)
+	REQ_HOST_RECONCILE			// agent for a host reconnected; push reservations on the host again (resmgr)
+	REQ_IMPACT					// list reservations that traverse a host or switch (resmgr)
+	REQ_SNAPSHOT				// state for a snapshot (network and resmgr)
+	REQ_CONSENT					// give or refuse consent for a cross-tenant reservation (resmgr)
+	REQ_FLOWTAB_CHECK			// check flow-mod demand of a new reservation against switch flow table budgets (fqmgr)
+	REQ_FLOWTAB_AUDIT			// request flow table counts from the agents (fqmgr tickler)
+	REQ_FLOWTAB_COUNTS			// flow table counts returned by an agent (fqmgr)
+	REQ_FMOD_STATUS				// bandwidth flow-mod action sent or answered (resmgr)
+	REQ_FMOD_AUDIT				// verify flow-mods of pushed reservations are installed (resmgr tickler)
+	REQ_USAGE_POLL				// write interim accounting records (resmgr tickler)
+	REQ_RES_STATUS				// flow-mod status of a reservation (resmgr)
+	REQ_MCAST_RESERVE			// create a multicast bandwidth reservation (network), send multicast flow-mods (fqmgr)
+	REQ_SET_PRIDSCP				// change the priority dscp list and push it to the intermediate switches (agent)
+	REQ_DELALL					// delete all reservations within a scope (host, project, window), or list them (resmgr)
+	REQ_UNDELETE				// cancel a pending (grace period) delete (resmgr)
+	REQ_GRACE_CHECK				// delete reservations whose grace period has passed (resmgr tickler)
+	REQ_EXPIRY_CHECK			// expiration warnings and summary (resmgr tickler)
+	REQ_RECOVERY				// report from the last checkpoint load (resmgr)
+	REQ_RECOVERED				// result from a background recovery worker (resmgr)
+	REQ_INV_STATS				// aggregate inventory statistics (resmgr)
+	REQ_LINK_SAMPLE				// sample link obligations for the history (network tickler)
+	REQ_LINK_HIST				// history of link obligations (network)
+	REQ_CAP_CHECK				// over-capacity check (resmgr tickler, then network)
+	REQ_CONS_CHECK				// inventory/graph/agent consistency check (resmgr)
+	REQ_LINKS_EXIST				// which of a list of links are not in the graph (network)
+	REQ_QMAP_DETAIL				// queue map by switch and port for a point in time (network)
+	REQ_SEARCH					// find reservations by host, address, project, dscp or path element (resmgr)
+	REQ_MAINT					// add, delete or list maintenance windows (resmgr)
+	REQ_SET_AZ					// replace availability zone membership (network)
+	REQ_LIST_AZ					// list availability zone membership and policies (network)
+	REQ_TOR_SWEEP				// remove expired physical switch limits (fq-mgr)
+	REQ_LIST_GW					// list router external legs (network)
+	REQ_FIP_MOVED				// floating ips re-associated or released (network, then resmgr)
+	REQ_NAT_PROBE				// probe nat matching flow-mods that are due (fq-mgr tickler)
+	REQ_NAT_PROBE_RESULT		// nat probe counts returned by an agent (fq-mgr)
+	REQ_NAT_PROBE_STATE			// result of a nat probe for a reservation (resmgr)
+	REQ_PROJ_MEMBERS			// vms of a project and their physical hosts (network)
+	REQ_REMARK					// refresh the default remark flow-mods (agent tickler)
+	REQ_SET_REMARK				// change the default remark policy (agent)
+	REQ_OVS_INVENTORY			// request (agent tickler), or results of, the ovs inventory of each host (network)
+	REQ_LINK_RECHECK			// links whose capacity dropped below their obligation (resmgr)
+	REQ_CHAIN					// status, extend or delete of a service chain (resmgr)
+	REQ_SET_META				// change the user metadata on a reservation (resmgr)
+	REQ_ADD_BATCH				// add a list of reservations from a batch request (resmgr)
+	REQ_RES_WATCH				// reservation status when it next changes (resmgr)
+	REQ_TAG_EXPORT				// reservation state to openstack resource tags (resmgr tickle, then osif)
+	REQ_AGENT_STATUS			// connected agents, degraded state and pending work (agent)
+	REQ_QUARANTINE				// add, lift or list host quarantines (resmgr, then network)
+	REQ_PROJ_TIER				// get, set, delete or list project tiers (resmgr)
+	REQ_BULK_METER				// request flow-mod byte counts for bulk transfers (fq-mgr tickler)
+	REQ_BULK_BYTES				// flow-mod byte counts returned by an agent (fq-mgr)
+	REQ_BULK_USAGE				// bytes moved by bulk transfers since the last report (resmgr)
+	REQ_PLACEMENT				// rank physical hosts by reservable room to a peer vm (network)
+	REQ_COMPACT					// compact internal structures and count them (resmgr and network)
+	REQ_QUOTA_SYNC				// reserved bandwidth by project to openstack quotas (resmgr tickle, then osif)
+	REQ_PATH_CACHE				// path cache counts, optionally flushing it (network)
+	REQ_REACH					// path each way between two hosts and the most that could be reserved (network)
+	REQ_GETIPS					// translate a list of VM names or IDs in one request; map of those that translated (network)
+	REQ_VERIFY_PROBE			// verify reservations that are due (fq-mgr tickler)
+	REQ_VERIFY_RESULT			// verification counts returned by an agent (fq-mgr)
+	REQ_VERIFY_STATE			// result of a verification for a reservation (resmgr)
+	REQ_SLA_POLL				// request reservation bytes and queue drops from agents (fq-mgr tickler)
+	REQ_SLA_STATS				// reservation bytes and queue drops returned by an agent (fq-mgr)
+	REQ_SLA_USAGE				// rate and drops of reservations over the last interval (resmgr)
+	REQ_SLA_REPORT				// sla breach history (resmgr)
+	REQ_MAP_CHECK				// tickle fq-mgr to drop requests held for a fresh ip2mac map and keep the map warm
+	REQ_QUEUE_RESULT			// per host results of applying a queue map returned by an agent (fq-mgr)
+	REQ_QUEUE_CHECK				// tickle fq-mgr to resend queue maps to hosts that failed or didn't answer
+	REQ_QUEUE_STATUS			// queue map application status by host (fq-mgr)
+	REQ_AGENT_WINDOW			// tickle agent manager to send actions held for their window
+	REQ_REOPT					// tickle resmgr to look for better paths for reservations which opted in
+	REQ_LINK_LOAD				// obligation and capacity of a list of links (network)
+	REQ_TIMELINE				// timeline (gantt) data for reservations over a period (resmgr)
+	REQ_OWNERS					// add to, remove from, or list a reservation's owner group (resmgr)
+	REQ_CHAIN_TMPL				// get, set, delete or list service chain templates (resmgr)
+	REQ_LABEL_READ				// tickle osif to read vm labels from instance metadata
+	REQ_LABEL_MAP				// vm labels from the reader goroutine (osif)
+	REQ_LABEL_VMS				// vms in a project having a label (osif)
+	REQ_LIST_LABELS				// labels of the vms in a project as json (osif)
+	REQ_ADD_SELECTOR			// add a label selector and create its reservations (resmgr)
+	REQ_SEL_EVAL				// bring the members of label selectors in line with vm labels (osif, then resmgr)
+	REQ_SEL_MEMBERS				// current members of a label selector (resmgr)
+	REQ_AGENT_PVER				// lowest protocol version of the connected agents (agent)
+	REQ_HOST_ADDRS				// addresses looked up for the search index (resmgr)
 )
 
 const (
@@ -221,6 +369,7 @@ var (
 	local_host	string = "localhost"
 
 	cfg_data	map[string]map[string]*string			// things read from the configuration file
+	cfg_file	string = ""								// name of the configuration file so that it can be read again
 
 	/*
 		Channels that various goroutines listen to. Global so that all goroutines have access to them.
@@ -232,13 +381,20 @@ var (
 	fq_ch		chan	*ipc.Chmsg		// flow and queue manager
 	am_ch		chan	*ipc.Chmsg		// agent manager channel
 
-	tklr	*ipc.Tickler				// tickler that will drive periodic things like checkpointing
+	tklr	Ticker					// tickler that will drive periodic things like checkpointing
 
 	pid int = 0							// process id for use in generating reservation names unique across invocations
 	res_nmseed	int = 0					// reservation name sequential value
+	cid_seed	int64 = 0				// request correlation id sequential value; atomic (mk_cid)
 	res_paused	bool = false			// set to true if reservations are paused
 
 	super_cookie	*string; 			// the 'admin cookie' that the super user can use to manipulate a reservation
+	acct_sink	*rec_sink				// where accounting records go; nil if not configured
+
+	xtenant_consent	bool = false		// cross-tenant reservations wait for the other tenant's consent (res_mgr_consent)
+	peering		[]string				// project pairs (p1:p2) which don't need consent
+	consent_timeout	int64 = 86400		// seconds a reservation may wait for consent
+	consent_tokens	bool = false		// osif requires tokens, so an un-banged host was validated against the requester's token
 
 	tegu_sheep	*bleater.Bleater		// parent sheep that controls the 'master' bleating volume and is used by 'library' functions (allocated in init below)
 	net_sheep	*bleater.Bleater		// individual sheep for each goroutine (each is responsible for allocating their own sheep)
@@ -258,6 +414,7 @@ var (
 	admin_roles *string					// roles which are allowed to submit privileged requests (pause, resume etc.)
 	sysproc_roles *string				// list of roles that are valid for requests allowed for either system procs or admins (e.g. listhost)
 	mirror_roles *string				// list of openstack roles that are valid for mirroring commands
+	steer_shared []string				// projects whose VMs any tenant may use in a steering reservation
 	priv_auth *string					// type of authorisation needed for privileged commands
 	accept_requests bool = false		// until main says we can, we don't accept requests
 	tclass2dscp map[string]int			// traffic class string (voice, video, af...) to a value
@@ -290,6 +447,8 @@ type Fq_parms struct {
 */
 type Fq_req struct {
 	Pri		int					// fmod priority
+	Pbump	int					// priority bump added to the agent's bandwidth fmod priorities (handover)
+	Rate	int64				// bandwidth (bits/sec) for backends that rate limit directly rather than by queue (ovn)
 	Cookie	int					// cookie that is added to the flow-mod (not a reservation cookie)
 	Expiry	int64				// either a hard time or a timeout depending on the situation
 	Id		*string				// id that fq-mgr will pass back if it indicates an error
@@ -302,6 +461,7 @@ type Fq_req struct {
 	Exttyp	*string				// external IP type (either -D or -S)
 	Protocol	*string			// protocol (steering) udp[4|6]:port or tcp[4|6]:port, port may be 0
 
+	Cid		string				// correlation id of the request that created the reservation
 	Tptype	*string				// transport type (i.e. protocol: tcp, udp, etc)
 	Resub	*string				// list of tables (space sep numbers) to resubmit to
 	Dscp	int					// dscp value that should be used for the traffic
@@ -313,6 +473,9 @@ type Fq_req struct {
 	Swid	*string				// switch ID (either a dpid or host name for ovs)
 	Espq	*gizmos.Spq			// a collection of switch, port, queue information (might replace spq and swid)
 	Single_switch bool			// indicates that only one switch is involved (dscp handling is different)
+	Rcvrs	[]*string			// multicast receiver addresses on the switch (multicast fmods)
+	Legs	[]*gizmos.Spq		// switch/port of the inter-switch legs of the path (physical switch limits)
+	Bulk	bool				// reservation is a bulk transfer; bytes sent by its flow-mods are metered
 
 	Match	*Fq_parms			// things to match on
 	Action	*Fq_parms			// things to set in action
@@ -349,15 +512,20 @@ func Initialise( cfg_fname *string, ver *string, nwch chan *ipc.Chmsg, rmch chan
 
 	pid = os.Getpid()							// used to keep reservation names unique across invocations
 
-	tklr = ipc.Mk_tickler( 30 )				// shouldn't need more than 30 different tickle spots
+	tklr = ipc.Mk_tickler( 64 )				// about 40 spots with every feature on; add_spot() reports if this is ever too few
 	tklr.Add_spot( 2, rmgr_ch, REQ_NOOP, nil, 1 )	// a quick burst tickle to prevent a long block if the first goroutine to schedule a tickle schedules a long wait
 
 	if cfg_fname != nil {
+		cfg_file = *cfg_fname
 		cfg_data, err = config.Parse2strs( nil, *cfg_fname )		// capture config data as strings -- referenced as cfg_data["sect"]["key"]
 		if err != nil {
 			err = fmt.Errorf( "unable to parse config file %s: %s", *cfg_fname, err )
 			return
 		}
+		if err = apply_secrets( cfg_data ); err != nil {			// secrets file and env:NAME values; before anything reads the config
+			err = fmt.Errorf( "unable to apply secrets to config %s: %s", *cfg_fname, err )
+			return
+		}
 
 		if p := cfg_data["default"]["shell"]; p != nil {
 			shell_cmd = *p
@@ -365,6 +533,9 @@ func Initialise( cfg_fname *string, ver *string, nwch chan *ipc.Chmsg, rmch chan
 		if p := cfg_data["default"]["verbose"]; p != nil {
 			 tegu_sheep.Set_level( uint( clike.Atoi( *p ) ) )
 		}
+		if p := cfg_data["default"]["redact"]; p != nil {
+			gizmos.Set_redaction( *p != "false" )				// full cookies and tokens in the log only if explicitly turned off
+		}
 		if log_dir = cfg_data["default"]["log_dir"]; log_dir == nil {
 			log_dir = &def_log_dir
 		}
@@ -380,6 +551,15 @@ func Initialise( cfg_fname *string, ver *string, nwch chan *ipc.Chmsg, rmch chan
 		go tegu_sheep.Sheep_herder( log_dir, 86400 )				// start the function that will roll the log now and again
 	}
 
+	if cfg_data != nil {
+		events_init( )
+		sim_init( )
+		consent_init( )
+		pri_tiers_init( )
+		ipc_ctx_init( )
+	}
+	net_provider_init( )											// works without a config too; nw_ch is used directly then
+
 	return
 }
 
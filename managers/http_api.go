@@ -32,17 +32,57 @@
 
 				These requests are supported:
 					POST:
+						agentlog (limited)
+						agentstatus (limited)
+						approve (limited)
+						bulk
+						cancelchain
+						chain
+						chainextend
+						chainstatus
+						chaintemplate (limited)
 						chkpt	(limited)
+						cni_add (limited)
+						cni_del (limited)
+						compact (limited)
+						consent
 						graph	(limited)
+						impact (limited)
+						intermedq (limited)
+						listaz (limited)
 						listconns
+						listgw (limited)
 						listhosts	(limited)
+						listlabels
 						listres
+						loadgen (limited)
+						maint (limited)
+						mc_reserve
+						netprov (limited)
+						pathcache (limited)
 						pause (limited)
+						placement (limited)
+						pridscp (limited)
+						quarantine (limited)
+						reach
+						refuse
+						reject (limited)
+						remark (limited)
 						reserve
+						resstatus
 						resume (limited)
+						schema
+						search
+						setaz (limited)
+						setmeta
+						snapshot (limited)
+						tier (limited)
+						trust (limited)
+						undelete
 						verbose (limited)
 
 					DELETE:
+						chain
 						reservation
 
 
@@ -101,20 +141,96 @@
 				04 Feb 2016 : Add support for direct protocol type rather than assuming both udp and tcp.
 								Corrected typo in passthru sussing out protocol setting. Added additional
 								error checking to host name in validate hosts function.
+				16 Oct 2026 : Added replace= option to reserve for make-before-break handover.
+				16 Oct 2026 : Added label selectors (project/@key.value) as reserve hosts, and the
+					setlabel/listlabels requests.
+				16 Oct 2026 : Added cni_add/cni_del so kubernetes pods can be reservation endpoints.
+				16 Oct 2026 : Added agentlog request to list recent agent commands.
+				16 Oct 2026 : Added request correlation ids (cid) to the response and pledges.
+				16 Oct 2026 : Added admission policy hook (httpmgr:policy_url).
+				16 Oct 2026 : Added approve and reject requests for reservations awaiting approval.
+				16 Oct 2026 : Listres accepts a cookie and lists other tenants' reservations without details.
+				16 Oct 2026 : Mask tokens in log messages.
+				16 Oct 2026 : Host names containing shell meta characters are rejected.
+				16 Oct 2026 : Added impact request.
+				16 Oct 2026 : Added snapshot request.
+				16 Oct 2026 : Added loadgen request (see http_loadgen.go).
+				16 Oct 2026 : Steering endpoints and middleboxes must belong to the tenant or a shared project.
+				16 Oct 2026 : Added consent and refuse requests for cross-tenant reservations.
+				16 Oct 2026 : Added resstatus request (flow-mod status of a reservation).
+				16 Oct 2026 : Added mc_reserve request (multicast bandwidth reservation).
+				16 Oct 2026 : Added pridscp request (change the priority dscp list).
+				16 Oct 2026 : Added intermedq request (set up intermediate queues on named hosts).
+				16 Oct 2026 : Request results carry an error code (tegu_err.go) and the http status
+					is set from it when all requests fail.
+				16 Oct 2026 : Network reservation requests are abandoned if the client goes away or the
+					network doesn't respond (ipc_ctx.go).
+				16 Oct 2026 : Delete (and cancelres) of all reservations can be scoped by host, project
+					and window, and can be a dry run.
+				16 Oct 2026 : Added undelete request (delete grace period).
+				16 Oct 2026 : Added recovery request (checkpoint load report).
+				16 Oct 2026 : Added invstats request.
+				16 Oct 2026 : Added linkhist request.
+				16 Oct 2026 : Added conscheck request.
+				16 Oct 2026 : Added queuemap request.
+				16 Oct 2026 : Added search request.
+				16 Oct 2026 : Added maint request.
+				16 Oct 2026 : Added setaz and listaz requests.
+				16 Oct 2026 : Added listgw request.
+				16 Oct 2026 : Added trust request.
+				16 Oct 2026 : Added remark request.
+				16 Oct 2026 : Added depends= option to reserve, ow_reserve and steer.
+				16 Oct 2026 : Added chain, chainstatus, chainextend and cancelchain requests and delete chain (http_chain.go).
+					Steering middlebox validation moved to steer_mboxes().
+				16 Oct 2026 : Added meta= option and setmeta request (user metadata); listres filters on tag.key=value.
+				16 Oct 2026 : Added name= and desc= options.
+				16 Oct 2026 : Added /tegu/batch (http_batch.go).
+				16 Oct 2026 : Added watch= to resstatus.
+				16 Oct 2026 : Added agentstatus request.
+				16 Oct 2026 : Added quarantine request.
+				16 Oct 2026 : Added tier request; project tier defaults and ceiling are applied to reserve and ow_reserve.
+				16 Oct 2026 : Added bulk (deadline) transfer request (see http_bulk.go).
+				16 Oct 2026 : Added placement request (hints for the cloud scheduler, network_place.go).
+				16 Oct 2026 : Added schema request (pledge record json schema).
+				16 Oct 2026 : Added compact request (compact.go) and the admin pprof endpoints (http_pprof.go).
+				16 Oct 2026 : Reservations and queue maps go through the network provider; added netprov request.
+				16 Oct 2026 : Added pathcache request.
+				16 Oct 2026 : Added reach request (host pair reachability pre-check).
+				16 Oct 2026 : Added slareport request (sla breach history).
+				16 Oct 2026 : The origin of each request is recorded on the pledges it creates (http_origin.go).
+				16 Oct 2026 : Added delegated tokens (dtoken request) usable on reserve (http_dtoken.go).
+				16 Oct 2026 : Reserve splits around blackout periods under the split policy; added calendar request.
+				16 Oct 2026 : Added qstatus request (queue map application by host).
+				16 Oct 2026 : Reserve accepts reopt=true (re-optimisation opt-in).
+				16 Oct 2026 : Added timeline request (gantt data).
+				16 Oct 2026 : Added owners request (reservation owner groups).
+				16 Oct 2026 : Added chaintemplate request and template= on chain (service chain templates).
+				16 Oct 2026 : Steering requests are refused when the fq-mgr backend is ovn.
+				16 Oct 2026 : Labels come from VM metadata (osif); setlabel removed and listlabels takes a project.
+				16 Oct 2026 : Correlation id is passed to the managers with each request; delete requests have one too.
+				16 Oct 2026 : Cni_add requires the project which owns the pod.
+				16 Oct 2026 : Searching by ip or mac requires a sysproc role.
+				16 Oct 2026 : Network requests carry the correlation id in their context.
+				16 Oct 2026 : Dtoken errors are given their code.
+				16 Oct 2026 : Steering tenancy translates the host's project once.
 */
 
 package managers
 
 import (
 	//"bufio"
+	"bytes"
+	"context"
 	//"encoding/json"
 	//"flag"
 	"fmt"
 	"io/ioutil"
 	//"html"
+	"net"
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -141,6 +257,15 @@ func mk_resname( ) ( string ) {
 	return fmt.Sprintf( "res%x_%05d", pid, r );
 }
 
+/*
+	Make a correlation id for a request. It is attached to the pledge(s) created by the request
+	and is carried with them through to the agent so that a request can be followed in the logs.
+*/
+func mk_cid( ) ( string ) {
+	c := atomic.AddInt64( &cid_seed, 1 ) - 1			// requests are parsed on many http goroutines
+	return fmt.Sprintf( "c%x_%05d", pid, c )
+}
+
 /*
 	Validate the h1 and optionally h2 strings translating the project name to a tenant ID if present.
 	The translated names are returned if _both_ are valid; error is set otherwise.
@@ -157,8 +282,24 @@ func mk_resname( ) ( string ) {
 	as this isn't allowed.
 */
 func validate_hosts( h1 string, h2 string ) ( h1x string, h2x string, p1 *string, p2 *string, v1 *string, v2 *string, err error ) {
+	return check_hosts( h1, h2, REQ_VALIDATE_HOST )
+}
+
+/*
+	Does the work for validate_hosts(). Rtype is the osif request used for each host:
+	REQ_VALIDATE_HOST requires and validates a token, REQ_XLATE_HOST only translates
+	the project name (used when the caller has already authorised the names).
+*/
+func check_hosts( h1 string, h2 string, rtype int ) ( h1x string, h2x string, p1 *string, p2 *string, v1 *string, v2 *string, err error ) {
 	var ht *string
 
+	if err = vet_host_name( h1 ); err != nil {
+		return
+	}
+	if err = vet_host_name( h2 ); err != nil {
+		return
+	}
+
 	my_ch := make( chan *ipc.Chmsg )							// allocate channel for responses to our requests
 	defer close( my_ch )									// close it on return
 	p1 = &zero_string
@@ -171,7 +312,7 @@ func validate_hosts( h1 string, h2 string ) ( h1x string, h2x string, p1 *string
 	}
 
 	req := ipc.Mk_chmsg( )
-	req.Send_req( osif_ch, my_ch, REQ_VALIDATE_HOST, &h1, nil )		// request to openstack interface to validate this token/project pair for host
+	req.Send_req( osif_ch, my_ch, rtype, &h1, nil )					// request to openstack interface to validate this token/project pair for host
 	req = <- my_ch													// hard wait for response
 
 	if req.State != nil {
@@ -183,7 +324,7 @@ func validate_hosts( h1 string, h2 string ) ( h1x string, h2x string, p1 *string
 	h1x = *ht
 
 	req = ipc.Mk_chmsg( )											// probably don't need a new one, but it should be safe
-	req.Send_req( osif_ch, my_ch, REQ_VALIDATE_HOST, &h2, nil )		// request to openstack interface to validate this host
+	req.Send_req( osif_ch, my_ch, rtype, &h2, nil )					// request to openstack interface to validate this host
 	req = <- my_ch													// hard wait for response
 
 	if req.State != nil {
@@ -201,6 +342,73 @@ func validate_hosts( h1 string, h2 string ) ( h1x string, h2x string, p1 *string
 	return
 }
 
+/*
+	Set the user supplied name and description (name= and desc= on the request) on the pledge.
+	Quotes around a description with spaces are dropped.
+*/
+func set_name_opts( p gizmos.Pledge, tmap map[string]*string ) ( error ) {
+	name := ""
+	desc := ""
+	if tmap["name"] != nil {
+		name = strings.Trim( *tmap["name"], `"` )
+	}
+	if tmap["desc"] != nil {
+		desc = strings.Trim( *tmap["desc"], `"` )
+	}
+	if name == "" && desc == "" {
+		return nil
+	}
+
+	if err := p.Set_name( name, desc ); err != nil {
+		return mk_err( ERR_BAD_REQUEST, "%s", err )
+	}
+	return nil
+}
+
+/*
+	Verify that the reservation named by depends= exists and that the cookie is valid for it;
+	a reservation may only depend on one the user could manage.
+*/
+func depends_access( dep *string, cookie *string ) ( error ) {
+	if dep == nil || *dep == "" {
+		return fmt.Errorf( "missing reservation id on depends=" )
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_GET, []*string{ dep, cookie }, nil )
+	req = <- my_ch
+	if req.State != nil {
+		return req.State
+	}
+	if req.Response_data == nil {
+		return mk_err( ERR_NOT_FOUND, "reservation depended on does not exist: %s", *dep )
+	}
+
+	return nil
+}
+
+/*
+	Reject a user supplied host name which contains characters that could alter the command
+	line that the agent eventually builds. The leading ! (external address) and the {vlan}
+	suffix are allowed.
+*/
+func vet_host_name( h string ) ( error ) {
+	if h == "" {
+		return fmt.Errorf( "missing host name" )
+	}
+
+	hv := strings.Replace( strings.Replace( strings.TrimPrefix( h, "!" ), "{", "", 1 ), "}", "", 1 )
+	if ! gizmos.Shell_safe( hv, true ) {
+		http_sheep.Baa( 1, "WRN: host name contains illegal characters and was rejected: %q  [TGUHTP004]", gizmos.Redact_tokens( h ) )
+		return fmt.Errorf( "host name contains illegal characters: %q", h )
+	}
+
+	return nil
+}
+
 /*	This is almost identical to validate_hosts() for a single host.  It does not support
 	'external' host names. The host name is expected to be project/host[:port][{vlan}].
 	If a project name is given, it is translated to project ID and reflected in the 
@@ -210,6 +418,10 @@ func validate_hosts( h1 string, h2 string ) ( h1x string, h2x string, p1 *string
 func validate_one_host( hname string ) ( hostx string, port *string, vlan *string, err error ) {
 	var ht *string
 
+	if err = vet_host_name( hname ); err != nil {
+		return
+	}
+
 	my_ch := make( chan *ipc.Chmsg )							// allocate channel for responses to our requests
 	port = &zero_string
 
@@ -229,6 +441,103 @@ func validate_one_host( hname string ) ( hostx string, port *string, vlan *strin
 }
 
 
+/*
+	Steering isolation. Hname is a translated (project-id/name[:port]) host name which is to be
+	an endpoint or middlebox of a steering reservation made by tenant (an ID). An error is
+	returned unless the host belongs to the tenant, or to a project listed in httpmgr:steer_shared,
+	so that a tenant cannot steer another tenant's traffic through its middlebox (or its own
+	traffic through another tenant's VM). External (!address) endpoints are not checked.
+*/
+func vet_steer_tenancy( tenant string, hname string ) ( err error ) {
+	if hname == "" || hname[0:1] == "!" {
+		return nil
+	}
+
+	toks := strings.SplitN( hname, "/", 2 )
+	if len( toks ) < 2 {
+		return fmt.Errorf( "%s has no project; unable to verify that it belongs to the tenant", hname )
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+	tid := strings.TrimSuffix( tenant, "/" )
+	if i := strings.LastIndex( tid, "/" ); i >= 0 {			// token/project if the token validation didn't translate it
+		tid = tid[i+1:]
+	}
+	tid = proj2id( tid, my_ch )
+	hid := proj2id( toks[0], my_ch )
+	if hid == tid {
+		return nil
+	}
+
+	for _, sp := range steer_shared {
+		if proj2id( sp, my_ch ) == hid {
+			return nil
+		}
+	}
+
+	http_sheep.Baa( 1, "WRN: steering isolation: %s does not belong to tenant %s and is not in a shared project  [TGUHTP005]", hname, tid )
+	return fmt.Errorf( "%s does not belong to the requesting tenant", hname )
+}
+
+/*
+	Build the middlebox list for a steering reservation from a comma separated list of names.
+	Names without a project are given the tenant's (usrsp is the validated [token/]tenant/).
+	Each middlebox must belong to the tenant and be known to the network.
+*/
+func steer_mboxes( usrsp string, mblist string, my_ch chan *ipc.Chmsg ) ( mbs []*gizmos.Mbox, err error ) {
+	mbnames := strings.Split( mblist, "," )
+	mbs = make( []*gizmos.Mbox, 0, len( mbnames ) )
+
+	req := ipc.Mk_chmsg( )
+	for i := range mbnames {									// generate a mbox object for each
+		mbn := mbnames[i]
+		if strings.Index( mbnames[i], "/" ) < 0 {				// add user space info out front
+			mbn = usrsp + mbnames[i] 							// validation/translation adds a trailing /, so not needed here
+		}
+
+		req.Send_req( osif_ch, my_ch, REQ_XLATE_HOST, &mbn, nil )		// translate to ID/name so that ownership can be checked
+		req = <- my_ch
+		if req.State != nil {
+			return nil, req.State
+		}
+		mbx, ok := req.Response_data.( *string )
+		if ! ok || mbx == nil {
+			return nil, fmt.Errorf( "unable to translate middlebox name: %s", mbnames[i] )
+		}
+		if err = vet_steer_tenancy( usrsp, *mbx ); err != nil {
+			return nil, err
+		}
+
+		update_graph( &mbn, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
+		req.Send_req( nw_ch, my_ch, REQ_HOSTINFO, &mbn, nil )		// get host info string (mac, ip, switch)
+		req = <- my_ch
+		if req.State != nil {
+			return nil, req.State
+		}
+
+		htoks := strings.Split( req.Response_data.( string ), "," )					// results are: ip, mac, switch-id, switch-port; all strings
+		mbs = append( mbs, gizmos.Mk_mbox( &mbnames[i], &htoks[1], &htoks[2], clike.Atoi( htoks[3] ) ) )
+	}
+
+	return mbs, nil
+}
+
+/*
+	Translate a project name to ID using osif. If it can't be translated it's assumed to
+	already be an ID and is returned unchanged.
+*/
+func proj2id( pname string, my_ch chan *ipc.Chmsg ) ( string ) {
+	req := ipc.Mk_chmsg( )
+	req.Send_req( osif_ch, my_ch, REQ_PNAME2ID, &pname, nil )
+	req = <- my_ch
+	if id, ok := req.Response_data.( *string ); ok && id != nil {
+		return *id
+	}
+
+	return pname
+}
+
 /*
 	Return true if the sender string is the localhost (127.0.0.1).
 */
@@ -283,9 +592,9 @@ func token_has_osroles( token *string, roles string ) ( bool ) {
 		return true
 	} else {
 		if req.State != nil {
-			http_sheep.Baa( 2, "token didn't have any acceptable role: %s %s: %s", *token, roles, req.State )
+			http_sheep.Baa( 2, "token didn't have any acceptable role: %s %s: %s", gizmos.Mask( *token ), roles, req.State )
 		} else {
-			http_sheep.Baa( 2, "token didn't have any acceptable role: %s %s", *token, roles )
+			http_sheep.Baa( 2, "token didn't have any acceptable role: %s %s", gizmos.Mask( *token ), roles )
 		}
 	}
 
@@ -308,9 +617,9 @@ func token_has_osroles_with_UserProject( token *string, roles string ) ( string
 		return state
 	} else {
 		if req.State != nil {
-			http_sheep.Baa( 2, "token didn't have any acceptable role: %s %s: %s", *token, roles, req.State )
+			http_sheep.Baa( 2, "token didn't have any acceptable role: %s %s: %s", gizmos.Mask( *token ), roles, req.State )
 		} else {
-			http_sheep.Baa( 2, "token didn't have any acceptable role: %s %s", *token, roles )
+			http_sheep.Baa( 2, "token didn't have any acceptable role: %s %s", gizmos.Mask( *token ), roles )
 		}
 	}
 
@@ -417,18 +726,56 @@ func dig_data( resp *http.Request ) ( data []byte ) {
 }
 
 
+/*
+	Split the bandwidth pledge into one reservation for each of the windows (blackout split
+	policy, res_mgr_blackout.go) and finalise each. The reservations are independent; if some
+	are refused those accepted remain. The json details are an array of the accepted ones.
+*/
+func finalise_bw_split( ctx context.Context, res *gizmos.Pledge_bw, wins [][2]int64, res_paused bool ) ( reason string, jreason string, nerrors int, code string ) {
+	jreason = "[ "
+	sep := ""
+	naccepted := 0
+	details := make( []string, 0, len( wins ) )
+	for _, w := range wins {
+		p, err := res.Clone_window( mk_resname( ), w[0], w[1] )
+		if err != nil {
+			nerrors++
+			code = ERR_BAD_REQUEST
+			details = append( details, fmt.Sprintf( "%d-%d: %s", w[0], w[1], err ) )
+			continue
+		}
+
+		r, jr, ne, c := finalise_bw_res( ctx, p, res_paused )
+		if ne == 0 {
+			naccepted++
+			jreason += sep + jr
+			sep = ", "
+		} else {
+			nerrors += ne
+			code = c
+		}
+		details = append( details, fmt.Sprintf( "%s %d-%d: %s", *p.Get_id(), w[0], w[1], r ) )
+	}
+
+	reason = fmt.Sprintf( "reservation split around blackouts; %d of %d accepted: %s", naccepted, len( wins ), strings.Join( details, "; " ) )
+	jreason += " ]"
+	return
+}
+
 /*
 	Given a reservation (pledge) ask network manager to reserve the bandwidth and set queues. If net mgr
 	is successful, then we'll send the reservation off to reservation manager to do the rest (push flow-mods
 	etc.)  The return values may seem odd, but are a result of breaking this out of the main parser which
 	wants two reason strings and a count of errors in order to report an overall status and a status of
-	each request that was received from the outside world.
+	each request that was received from the outside world. Code is the error code (tegu_err.go) when
+	the reservation isn't accepted.
 
 	This function will also check for a duplicate pledge already in the inventory and reject it
 	if a dup is found.
 */
-func finalise_bw_res( res *gizmos.Pledge_bw, res_paused bool ) ( reason string, jreason string, nerrors int ) {
+func finalise_bw_res( ctx context.Context, res *gizmos.Pledge_bw, res_paused bool ) ( reason string, jreason string, nerrors int, code string ) {
 
+	set_origin( ctx, res )									// where the request came from (http_origin.go)
 	nerrors = 0
 	jreason = ""
 	reason = ""
@@ -438,36 +785,58 @@ func finalise_bw_res( res *gizmos.Pledge_bw, res_paused bool ) ( reason string,
 
 	req := ipc.Mk_chmsg( )
 	gp := gizmos.Pledge( res )								// convert to generic pledge to pass
-	req.Send_req( rmgr_ch, my_ch, REQ_DUPCHECK, &gp, nil )	// see if we have a duplicate in the cache
+	req.Send_req( rmgr_ch, my_ch, REQ_DUPCHECK, &gp, res.Get_cid() )	// see if we have a duplicate in the cache
 	req = <- my_ch											// get response from the network thread
 	if req.Response_data != nil {							// response is a pointer to string, if the pointer isn't nil it's a dup
 		rp := req.Response_data.( *string )					// id of the duplicated ID comes back
-		if rp != nil {
+		if rp != nil && (res.Get_handover() == nil || *rp != *res.Get_handover()) {		// the pledge being replaced is an expected dup
 			nerrors = 1
+			code = ERR_DUPLICATE
 			reason = fmt.Sprintf( "reservation duplicates existing reservation: %s",  *rp )
 			return
 		}
 	}
 
-	req = ipc.Mk_chmsg( )
-	req.Send_req( nw_ch, my_ch, REQ_BW_RESERVE, res, nil )	// send to network to verify a path and reserve bw on the link(s)
-	req = <- my_ch											// get response from the network thread
+	if err := policy_check_bw( res ); err != nil {			// site admission policy may reject or clamp
+		nerrors = 1
+		code = ERR_NOT_AUTHORISED
+		reason = fmt.Sprintf( "reservation %s", err )
+		return
+	}
+
+	if pid := consent_needed( res.Get_hosts() ); pid != "" {		// cross-tenant; accepted but held until the other project consents
+		res.Set_consent( pid )
+		res.Set_awaiting_approval( true )
+	}
+
+	nctx, cancel := nw_ctx( ctx, res.Get_cid() )							// give up if the client goes away or network doesn't answer
+	defer cancel( )
+	req = net_prov.Send( nctx, REQ_BW_RESERVE, res, release_late( res ) )	// send to network to verify a path and reserve bw on the link(s)
 
 	if req.Response_data != nil {
 		path_list := req.Response_data.( []*gizmos.Path )			// path(s) that were found to be suitable for the reservation
 		res.Set_path_list( path_list )
 
 		//ip := gizmos.Pledge( res )							// must pass an interface to resmgr
-		req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, nil )	// network OK'd it, so add it to the inventory
+		req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, res.Get_cid() )	// network OK'd it, so add it to the inventory
 		req = <- my_ch										// wait for completion
 
 		if req.State == nil {
 			ckptreq := ipc.Mk_chmsg( )
-			ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )	// request a chkpt now, but don't wait on it
+			ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, res.Get_cid() )	// request a chkpt now, but don't wait on it
+			http_sheep.Baa( 1, "reservation %s accepted cid=%s origin=%s", *res.Get_id(), res.Get_cid(), res.Get_origin().To_json() )
 			reason = fmt.Sprintf( "reservation accepted; reservation path has %d entries", len( path_list ) )
+			if res.Get_consent() != "" {
+				reason = fmt.Sprintf( "reservation accepted and is awaiting consent from project %s; reservation path has %d entries", res.Get_consent(), len( path_list ) )
+			} else {
+				if res.Is_awaiting_approval() {
+					reason = fmt.Sprintf( "reservation accepted and is awaiting approval; reservation path has %d entries", len( path_list ) )
+				}
+			}
 			jreason =  res.To_json()
 		} else {
 			nerrors++
+			code = err_code( req.State )
 			reason = fmt.Sprintf( "%s", req.State )
 		}
 
@@ -478,6 +847,7 @@ func finalise_bw_res( res *gizmos.Pledge_bw, res_paused bool ) ( reason string,
 		}
 	} else {
 		reason = fmt.Sprintf( "reservation rejected: %s", req.State )
+		code = err_code( req.State )
 		nerrors++
 	}
 
@@ -487,8 +857,9 @@ func finalise_bw_res( res *gizmos.Pledge_bw, res_paused bool ) ( reason string,
 /*
 	Complete a one-way bandwidth reservation.
 */
-func finalise_bwow_res( res *gizmos.Pledge_bwow, res_paused bool ) ( reason string, jreason string, nerrors int ) {
+func finalise_bwow_res( ctx context.Context, res *gizmos.Pledge_bwow, res_paused bool ) ( reason string, jreason string, nerrors int, code string ) {
 
+	set_origin( ctx, res )
 	nerrors = 0
 	jreason = ""
 	reason = ""
@@ -498,35 +869,56 @@ func finalise_bwow_res( res *gizmos.Pledge_bwow, res_paused bool ) ( reason stri
 
 	req := ipc.Mk_chmsg( )
 	gp := gizmos.Pledge( res )								// convert to generic pledge to pass
-	req.Send_req( rmgr_ch, my_ch, REQ_DUPCHECK, &gp, nil )	// see if we have a duplicate in the cache
+	req.Send_req( rmgr_ch, my_ch, REQ_DUPCHECK, &gp, res.Get_cid() )	// see if we have a duplicate in the cache
 	req = <- my_ch											// get response from the network thread
 	if req.Response_data != nil {							// response is a pointer to string, if the pointer isn't nil it's a dup
 		rp := req.Response_data.( *string )
 		if rp != nil {
 			nerrors = 1
+			code = ERR_DUPLICATE
 			reason = fmt.Sprintf( "oneway reservation duplicates existing reservation: %s",  *rp )
 			return
 		}
 	}
 
-	req = ipc.Mk_chmsg( )
-	req.Send_req( nw_ch, my_ch, REQ_BWOW_RESERVE, res, nil )	// validate and approve from a network perspective
-	req = <- my_ch											// get response from the network thread
+	if err := policy_check_bwow( res ); err != nil {
+		nerrors = 1
+		code = ERR_NOT_AUTHORISED
+		reason = fmt.Sprintf( "oneway reservation %s", err )
+		return
+	}
+
+	if pid := consent_needed( res.Get_hosts() ); pid != "" {
+		res.Set_consent( pid )
+		res.Set_awaiting_approval( true )
+	}
+
+	nctx, cancel := nw_ctx( ctx, res.Get_cid() )
+	defer cancel( )
+	req = net_prov.Send( nctx, REQ_BWOW_RESERVE, res, release_late( res ) )	// validate and approve from a network perspective
 
 	if req.Response_data != nil {
 		gate := req.Response_data.( *gizmos.Gate  )			// expect that network sent us a gate
 		res.Set_gate( gate )
 
-		req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, nil )	// network OK'd it, so add it to the inventory
+		req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, res.Get_cid() )	// network OK'd it, so add it to the inventory
 		req = <- my_ch										// wait for completion
 
 		if req.State == nil {
 			ckptreq := ipc.Mk_chmsg( )
-			ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )	// request a chkpt now, but don't wait on it
+			ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, res.Get_cid() )	// request a chkpt now, but don't wait on it
 			reason = fmt.Sprintf( "one way reservation accepted" )
+			if res.Get_consent() != "" {
+				reason = fmt.Sprintf( "one way reservation accepted and is awaiting consent from project %s", res.Get_consent() )
+			} else {
+				if res.Is_awaiting_approval() {
+					reason = fmt.Sprintf( "one way reservation accepted and is awaiting approval" )
+				}
+			}
 			jreason =  res.To_json()
 		} else {
 			nerrors++
+			code = err_code( req.State )
 			reason = fmt.Sprintf( "%s", req.State )
 		}
 
@@ -537,6 +929,7 @@ func finalise_bwow_res( res *gizmos.Pledge_bwow, res_paused bool ) ( reason stri
 		}
 	} else {
 		reason = fmt.Sprintf( "one way reservation rejected: %s", req.State )
+		code = err_code( req.State )
 		nerrors++
 	}
 
@@ -545,6 +938,75 @@ func finalise_bwow_res( res *gizmos.Pledge_bwow, res_paused bool ) ( reason stri
 
 
 
+/*
+	Given a multicast pledge, check for a duplicate and policy, have the network find the tree,
+	and add it to the inventory. Return values are as for finalise_bwow_res().
+*/
+func finalise_mcast_res( ctx context.Context, res *gizmos.Pledge_mcast, res_paused bool ) ( reason string, jreason string, nerrors int, code string ) {
+	set_origin( ctx, res )
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	gp := gizmos.Pledge( res )
+	req.Send_req( rmgr_ch, my_ch, REQ_DUPCHECK, &gp, res.Get_cid() )
+	req = <- my_ch
+	if req.Response_data != nil {
+		if rp := req.Response_data.( *string ); rp != nil {
+			return fmt.Sprintf( "multicast reservation duplicates existing reservation: %s",  *rp ), "", 1, ERR_DUPLICATE
+		}
+	}
+
+	if err := policy_check_mcast( res ); err != nil {
+		return fmt.Sprintf( "multicast reservation %s", err ), "", 1, ERR_NOT_AUTHORISED
+	}
+
+	src, _ := res.Get_hosts()
+	for _, r := range res.Get_receivers() {				// held if any receiver belongs to another project
+		if pid := consent_needed( src, r ); pid != "" {
+			res.Set_consent( pid )
+			res.Set_awaiting_approval( true )
+			break
+		}
+	}
+
+	nctx, cancel := nw_ctx( ctx, res.Get_cid() )
+	defer cancel( )
+	req = net_prov.Send( nctx, REQ_MCAST_RESERVE, res, release_late( res ) )		// find a path to each receiver and obligate the tree
+	if req.Response_data == nil {
+		return fmt.Sprintf( "multicast reservation rejected: %s", req.State ), "", 1, err_code( req.State )
+	}
+
+	path_list := req.Response_data.( []*gizmos.Path )
+	res.Set_path_list( path_list )
+
+	req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, res.Get_cid() )
+	req = <- my_ch
+	if req.State != nil {
+		return fmt.Sprintf( "%s", req.State ), "", 1, err_code( req.State )
+	}
+
+	ckptreq := ipc.Mk_chmsg( )
+	ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, res.Get_cid() )
+	reason = fmt.Sprintf( "multicast reservation accepted; tree has %d branches", len( path_list ) )
+	if res.Get_consent() != "" {
+		reason = fmt.Sprintf( "multicast reservation accepted and is awaiting consent from project %s", res.Get_consent() )
+	} else {
+		if res.Is_awaiting_approval() {
+			reason = fmt.Sprintf( "multicast reservation accepted and is awaiting approval" )
+		}
+	}
+	jreason = res.To_json()
+
+	if res_paused {
+		rm_sheep.Baa( 1, "reservations are paused, accepted multicast reservation will not be pushed until resumed" )
+		res.Pause( false )
+		res.Set_pushed( )
+	}
+
+	return
+}
+
 /*	Given a passthrough reservation (pledge) get the physical host for the reseration and then send the reservation off to 
 	reservation manager to do the rest (push flow-mods etc.)  The return values may seem odd, but are a result of 
 	breaking this out of the main parser which wants two reason strings and a count of errors in order to report 
@@ -554,8 +1016,9 @@ func finalise_bwow_res( res *gizmos.Pledge_bwow, res_paused bool ) ( reason stri
 	if a dup is found. As a final check the user link capacity is checked (network) and if it is not greater than
 	0, the reservation is rejected; user must be allowed bandwidth capacity to mark their own traffic.
 */
-func finalise_pt_res( res *gizmos.Pledge_pass, res_paused bool ) ( reason string, jreason string, nerrors int ) {
+func finalise_pt_res( ctx context.Context, res *gizmos.Pledge_pass, res_paused bool ) ( reason string, jreason string, nerrors int, code string ) {
 
+	set_origin( ctx, res )
 	nerrors = 0
 	jreason = ""
 	reason = ""
@@ -565,12 +1028,13 @@ func finalise_pt_res( res *gizmos.Pledge_pass, res_paused bool ) ( reason string
 
 	req := ipc.Mk_chmsg( )
 	gp := gizmos.Pledge( res )								// convert to generic pledge
-	req.Send_req( rmgr_ch, my_ch, REQ_DUPCHECK, &gp, nil )	// see if we have a duplicate in the cache
+	req.Send_req( rmgr_ch, my_ch, REQ_DUPCHECK, &gp, res.Get_cid() )	// see if we have a duplicate in the cache
 	req = <- my_ch											// get response from the res mgr thread
 	if req.Response_data != nil {							// response is a pointer to string, if the pointer isn't nil it's a dup
 		rp := req.Response_data.( *string )
 		if rp != nil {
 			nerrors = 1
+			code = ERR_DUPLICATE
 			reason = fmt.Sprintf( "reservation duplicates existing reservation: %s",  *rp )
 			return
 		}
@@ -581,39 +1045,47 @@ func finalise_pt_res( res *gizmos.Pledge_pass, res_paused bool ) ( reason string
 	if len( tokens ) < 2 {
 		nerrors = 1
 		http_sheep.Baa( 1, "reject passthru: endpoint was not project/endpointL %s", host )
+		code = ERR_BAD_REQUEST
 		reason = fmt.Sprintf( "host name was not project/endpoint; unable to validate passthru reservation project" )
 		return
 	}
 
-	req = ipc.Mk_chmsg( )
-	req.Send_req( nw_ch, my_ch, REQ_PT_RESERVE, &tokens[0], nil )	// must have network approval too
-	req = <- my_ch													// wait for response
-	ok := req.Response_data.( bool )
+	if err := policy_check_pt( res ); err != nil {
+		nerrors = 1
+		code = ERR_NOT_AUTHORISED
+		reason = fmt.Sprintf( "passthru reservation %s", err )
+		return
+	}
+
+	nctx, cancel := nw_ctx( ctx, res.Get_cid() )
+	defer cancel( )
+	req = net_prov.Send( nctx, REQ_PT_RESERVE, &tokens[0], nil )	// must have network approval too
+	ok, _ := req.Response_data.( bool )								// nil if abandoned
 	if !ok  {
 		nerrors = 1
 		http_sheep.Baa( 1, "reject passthru: %s: %s", tokens[0], req.State )
+		code = err_code( req.State )
 		reason = fmt.Sprintf( "%s", req.State )
 		return
 	}
 
-	req = ipc.Mk_chmsg( )
-	req.Send_req( nw_ch, my_ch, REQ_GETPHOST, host, nil )	// send to network to translate the VM ID into a physical host name
-	req = <- my_ch											// get response from the network thread
+	req = ctx_req( nctx, nw_ch, REQ_GETPHOST, host, nil )	// send to network to translate the VM ID into a physical host name
 
 	if req.Response_data != nil {
 		phost := req.Response_data.( *string )
 		res.Set_phost( phost )
 
-		req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, nil )	// network OK'd it, so add it to the inventory
+		req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, res.Get_cid() )	// network OK'd it, so add it to the inventory
 		req = <- my_ch										// wait for completion
 
 		if req.State == nil {
 			ckptreq := ipc.Mk_chmsg( )
-			ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )	// request a chkpt now, but don't wait on it
+			ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, res.Get_cid() )	// request a chkpt now, but don't wait on it
 			reason = fmt.Sprintf( "passthru reservation accepted" )
 			jreason =  res.To_json()
 		} else {
 			nerrors++
+			code = err_code( req.State )
 			reason = fmt.Sprintf( "%s", req.State )
 		}
 
@@ -624,12 +1096,65 @@ func finalise_pt_res( res *gizmos.Pledge_pass, res_paused bool ) ( reason string
 		}
 	} else {
 		reason = fmt.Sprintf( "passthru reservation rejected: %s", req.State )
+		code = err_code( req.State )
 		nerrors++
 	}
 
 	return
 }
 
+/*
+	Finish a dscp trust reservation: reject a duplicate, ensure that a single VM scope has a known
+	physical host, and add it to the inventory. Unlike passthru, the project's user link cap is not
+	checked; trust is granted by an admin and nothing is reserved. A project scope is accepted even
+	if the project has no VMs yet; they are found when the reservation is pushed.
+*/
+func finalise_trust_res( res *gizmos.Pledge_trust, res_paused bool ) ( reason string, jreason string, nerrors int, code string ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	gp := gizmos.Pledge( res )
+	req.Send_req( rmgr_ch, my_ch, REQ_DUPCHECK, &gp, res.Get_cid() )
+	req = <- my_ch
+	if rp, ok := req.Response_data.( *string ); ok && rp != nil {
+		code = ERR_DUPLICATE
+		reason = fmt.Sprintf( "reservation duplicates existing reservation: %s",  *rp )
+		return reason, "", 1, code
+	}
+
+	if ! res.Is_project() {
+		host, _ := res.Get_hosts()
+		req = nw_cid_req( res.Get_cid(), REQ_GETPHOST, host, nil )
+		if req.Response_data == nil {
+			code = err_code( req.State )
+			reason = fmt.Sprintf( "trust reservation rejected: unable to find physical host of %s: %v", *host, req.State )
+			return reason, "", 1, code
+		}
+	}
+
+	req = ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, res.Get_cid() )
+	req = <- my_ch
+	if req.State != nil {
+		code = err_code( req.State )
+		reason = fmt.Sprintf( "%s", req.State )
+		return reason, "", 1, code
+	}
+
+	ckptreq := ipc.Mk_chmsg( )
+	ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, res.Get_cid() )	// request a chkpt now, but don't wait on it
+
+	if res_paused {
+		rm_sheep.Baa( 1, "reservations are paused, trust reservation accepted reservation will not be pushed until resumed" )
+		res.Pause( false )
+		res.Set_pushed( )
+	}
+
+	http_sheep.Baa( 1, "trust reservation accepted: %s", res )
+	return "trust reservation accepted", res.To_json(), 0, ""
+}
+
 
 // ---- main parsers ------------------------------------------------------------------------------------
 /*
@@ -639,9 +1164,9 @@ func finalise_pt_res( res *gizmos.Pledge_pass, res_paused bool ) ( reason string
 		ckpt
 		listhosts
 		listulcaps
-		listres
+		listres [cookie] [tag.key=value...]
 		listconns
-		reserve <bandwidth[K|M|G][,outbandwidth[K|M|G]> [<start>-]<end> <host1>[-<host2] [cookie]
+		reserve [replace=res-id] [depends=res-id] [meta=key:value,...] [name=n] [desc=d] <bandwidth[K|M|G][,outbandwidth[K|M|G]> [<start>-]<end> <host1>[-<host2] [cookie]
 		graph
 		ping
 		listconns <hostname|hostip>
@@ -652,7 +1177,7 @@ func finalise_pt_res( res *gizmos.Pledge_pass, res_paused bool ) ( reason string
 		accept_requests	bool	set to true if we can accept and process requests. if false any
 								request is failed.
 */
-func parse_post( out http.ResponseWriter, recs []string, sender string, xauth string ) (state string, msg string) {
+func parse_post( ctx context.Context, out http.ResponseWriter, recs []string, sender string, xauth string ) (state string, msg string, code string) {
 	var (
 		//res_name	string = "undefined"
 		tokens		[]string
@@ -660,6 +1185,10 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 		nerrors 	int = 0
 		reason		string					// reason for the current status
 		jreason		string					// json details from the pledge
+		ecode		string					// error code (tegu_err.go) for the current request
+		unauth		string					// default reason; if unchanged on error the request wasn't authorised
+		fcode		string					// code of the first failed request
+		nok			int						// number of requests that were successful
 		startt		int64
 		endt		int64
 		bandw_in	int64
@@ -700,30 +1229,117 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 			is_token = true
 			auth_data = xauth
 		}
+		origin_key( ctx, auth_data, is_token )		// origin of reservations made by this record (http_origin.go)
 
 		req_count++
+		cid := mk_cid( )
 		state = "ERROR"				// default for each loop; final set based on error count following loop
 		jreason = ""
+		ecode = ""
 		if accept_requests  ||  tokens[0] == "ping"  || tokens[0] == "verbose" {			// always allow ping/verbose if we are up
 			reason = fmt.Sprintf( "you are not authorised to submit a %s command", tokens[0] )
+			unauth = reason
 
-			http_sheep.Baa( 3, "processing request: %s %d tokens", tokens[0], ntokens )
+			http_sheep.Baa( 3, "processing request: %s %d tokens cid=%s", tokens[0], ntokens, cid )
 			switch tokens[0] {
 
+				case "approve", "reject":								// approve or reject a reservation awaiting approval: approve res-id
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						if ntokens < 2 {
+							reason = fmt.Sprintf( "missing reservation id: usage: %s res-id", tokens[0] )
+						} else {
+							req = ipc.Mk_chmsg( )
+							req.Send_req( rmgr_ch, my_ch, REQ_APPROVE, []string{ tokens[1], tokens[0] }, cid )
+							req = <- my_ch
+							if req.State == nil {
+								state = "OK"
+								reason = fmt.Sprintf( "reservation approved: %s", tokens[1] )
+								if tokens[0] == "reject" {
+									reason = fmt.Sprintf( "reservation rejected: %s", tokens[1] )
+								}
+							} else {
+								ecode = err_code( req.State )
+								reason = fmt.Sprintf( "%s", req.State )
+							}
+						}
+					}
+
+				case "consent", "refuse":								// the other tenant of a cross-tenant reservation: consent res-id project
+					if ntokens < 3 {
+						reason = fmt.Sprintf( "missing parameters: usage: %s res-id project", tokens[0] )
+						break
+					}
+
+					if ! is_token {
+						reason = fmt.Sprintf( "%s requires an auth token for the project", tokens[0] )
+						break
+					}
+
+					tp := auth_data										// token must be valid for the project (x-auth may be token/project)
+					if i := strings.Index( tp, "/" ); i >= 0 {
+						tp = tp[0:i]
+					}
+					tp += "/" + tokens[2]
+					req = ipc.Mk_chmsg( )
+					req.Send_req( osif_ch, my_ch, REQ_VALIDATE_TOKEN, &tp, cid )
+					req = <- my_ch
+					pid, ok := req.Response_data.( *string )
+					if req.State != nil || !ok || pid == nil {
+						reason = fmt.Sprintf( "unable to validate token for project %s: %v", tokens[2], req.State )
+						break
+					}
+
+					req.Send_req( rmgr_ch, my_ch, REQ_CONSENT, []string{ tokens[1], tokens[0], strings.TrimSuffix( *pid, "/" ) }, cid )
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						reason = fmt.Sprintf( "consent given for reservation: %s", tokens[1] )
+						if tokens[0] == "refuse" {
+							reason = fmt.Sprintf( "reservation refused and cancelled: %s", tokens[1] )
+						}
+					} else {
+						ecode = err_code( req.State )
+						reason = fmt.Sprintf( "%s", req.State )
+					}
+
 				case "cancelres":												// cancel reservation
-					err := delete_reservation( tokens )
+					if ntokens > 1 && tokens[1] == "all" {
+						var err error
+						if reason, jreason, err = delete_all( tokens, cid ); err == nil {
+							state = "OK"
+						} else {
+							ecode = err_code( err )
+							reason = fmt.Sprintf( "%s", err )
+						}
+						break
+					}
+
+					when, err := delete_reservation( tokens, cid )
 					if err != nil {
+						ecode = err_code( err )
 						reason = fmt.Sprintf( "%s", err )
 					} else {
 						jreason = fmt.Sprintf( "reservation was cancelled (deleted): %s", tokens[1] )
 						state = "OK"
 						reason = ""
+						if when > 0 {
+							reason = fmt.Sprintf( "reservation will be cancelled at %d unless undeleted", when )
+						}
+					}
+
+				case "undelete":												// undo a pending cancel: undelete res-id [cookie]
+					if err := undelete_reservation( tokens, cid ); err != nil {
+						ecode = err_code( err )
+						reason = fmt.Sprintf( "%s", err )
+					} else {
+						state = "OK"
+						reason = fmt.Sprintf( "pending cancel of reservation %s was undone", tokens[1] )
 					}
 
 				case "chkpt":
 					if validate_auth( &auth_data, is_token, admin_roles ) {
 						req = ipc.Mk_chmsg( )
-						req.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )
+						req.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, cid )
 						state = "OK"
 						reason = "checkpoint was requested"
 					}
@@ -734,20 +1350,20 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						if tmap["project"] != nil {
 							http_sheep.Baa( 1, "graph is forcing update of all VMs for the project: %s", *tmap["project"] )
 							req = ipc.Mk_chmsg( )
-							req.Send_req( osif_ch, my_ch, REQ_GET_PROJ_HOSTS, tmap["project"], nil )	// get a list of network vm insertion structs and push into the network
+							req.Send_req( osif_ch, my_ch, REQ_GET_PROJ_HOSTS, tmap["project"], cid )	// get a list of network vm insertion structs and push into the network
 							req = <- my_ch
 							if req.Response_data == nil {
 								http_sheep.Baa( 1, "failed to load all vm data: %s: %s", *tmap["project"], req.State )
 								jreason = fmt.Sprintf( "unable to load project data: %s", req.State )
 							} else {
-								req.Send_req( nw_ch, my_ch, REQ_ADD, req.Response_data, nil )	// send list to network to insert; must block until done so graph request gets update
+								req.Send_req( nw_ch, my_ch, REQ_ADD, req.Response_data, cid )	// send list to network to insert; must block until done so graph request gets update
 								req = <- my_ch
 							}
 						}
 
 						req = ipc.Mk_chmsg( )
 
-						req.Send_req( nw_ch, my_ch, REQ_NETGRAPH, nil, nil )	// request to net thread; it will create a json blob and attach to the request which it sends back
+						req.Send_req( nw_ch, my_ch, REQ_NETGRAPH, nil, cid )	// request to net thread; it will create a json blob and attach to the request which it sends back
 						req = <- my_ch											// hard wait for network thread response
 						if req.Response_data != nil {
 							state = "OK"
@@ -758,75 +1374,717 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						}
 					}
 
+				case "linkhist":											// linkhist [link-id...]; history of link obligations (all links if none named)
+					if validate_auth( &auth_data, is_token, sysproc_roles ) {
+						req = ipc.Mk_chmsg( )
+						req.Send_req( nw_ch, my_ch, REQ_LINK_HIST, tokens[1:], cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
 				case "listulcaps":											// list user link capacities known to network manager
 					if validate_auth( &auth_data, is_token, admin_roles ) {
 						req = ipc.Mk_chmsg( )
-						req.Send_req( nw_ch, my_ch, REQ_LISTULCAP, nil, nil )
+						req.Send_req( nw_ch, my_ch, REQ_LISTULCAP, nil, cid )
 						req = <- my_ch
 						if req.State == nil {
 							state = "OK"
 							jreason = string( req.Response_data.(string) )
 							reason = ""
 						} else {
+							ecode = err_code( req.State )
 							reason = fmt.Sprintf( "%s", req.State )
 						}
 					}
 
-				case "listhosts":											// list known host information
+				case "agentlog":											// agentlog [res=id] [cid=id] [host=name] [n=count]; recent commands sent to agents
 					if validate_auth( &auth_data, is_token, sysproc_roles ) {
-						tmap := gizmos.Mixtoks2map( tokens[1:], "" )			// look for project=pname[,pname] on the request
-						if tmap["project"] != nil {
-							http_sheep.Baa( 1, "listhosts is forcing update of all VMs for the project: %s", *tmap["project"] )
-							req = ipc.Mk_chmsg( )
-							req.Send_req( osif_ch, my_ch, REQ_GET_PROJ_HOSTS, tmap["project"], nil )	// get a list of network vm insertion structs and push into the network
-							req = <- my_ch
-							if req.Response_data == nil {
-								http_sheep.Baa( 1, "failed to load all vm data: %s: %s", *tmap["project"], req.State )
-								jreason = fmt.Sprintf( "unable to load project data: %s", req.State )
-							} else {
-								req.Send_req( nw_ch, my_ch, REQ_ADD, req.Response_data, nil )	// send list to network to insert; must block until done so listhosts request gets update
-								req = <- my_ch
-							}
+						tmap := gizmos.Mixtoks2map( tokens[1:], "" )
+						parms := []string{ "", "", "", "100" }
+						if tmap["res"] != nil {
+							parms[0] = *tmap["res"]
+						}
+						if tmap["cid"] != nil {
+							parms[1] = *tmap["cid"]
+						}
+						if tmap["host"] != nil {
+							parms[2] = *tmap["host"]
+						}
+						if tmap["n"] != nil {
+							parms[3] = *tmap["n"]
 						}
 
 						req = ipc.Mk_chmsg( )
-						req.Send_req( nw_ch, my_ch, REQ_LISTHOSTS, nil, nil )
+						req.Send_req( am_ch, my_ch, REQ_AGENT_LOG, parms, cid )
 						req = <- my_ch
 						if req.State == nil {
 							state = "OK"
-							jreason = string( req.Response_data.(string) )
+							jreason = req.Response_data.( string )
 							reason = ""
 						} else {
+							ecode = err_code( req.State )
 							reason = fmt.Sprintf( "%s", req.State )
 						}
 					}
 
-				case "listres":											// list reservations
-					req = ipc.Mk_chmsg( )
-					req.Send_req( rmgr_ch, my_ch, REQ_LIST, nil, nil )
-					req = <- my_ch
-					if req.State == nil {
-						state = "OK"
-						jreason = string( req.Response_data.(string) )
+				case "agentstatus":											// connected agents, degraded state and work held for them (agent_pending.go)
+					if validate_auth( &auth_data, is_token, sysproc_roles ) {
+						req = ipc.Mk_chmsg( )
+						req.Send_req( am_ch, my_ch, REQ_AGENT_STATUS, nil, cid )
+						req = <- my_ch
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+					}
+
+				case "impact":												// impact host-or-switch; reservations that would be affected by taking it down
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						if ntokens < 2 {
+							reason = "missing host or switch name; usage: impact name"
+							break
+						}
+
+						name := tokens[1]
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_IMPACT, &name, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "timeline":											// timeline [from=ts] [to=ts|+sec] [field=value...]; gantt data for reservations over a period
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						now := time.Now().Unix()
+						q := make( map[string]string )
+						for _, tok := range tokens[1:] {
+							kv := strings.SplitN( tok, "=", 2 )
+							if len( kv ) != 2 {
+								continue
+							}
+							q[kv[0]] = kv[1]
+						}
+
+						from := now
+						if q["from"] != "" {
+							from = clike.Atoi64( q["from"] )
+						}
+						to := from + 86400
+						if t := q["to"]; t != "" {
+							if t[0] == '+' {
+								to = from + clike.Atoi64( t[1:] )
+							} else {
+								to = clike.Atoi64( t )
+							}
+						}
+						q["from"] = fmt.Sprintf( "%d", from )
+						q["to"] = fmt.Sprintf( "%d", to )
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_TIMELINE, q, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "conscheck":											// conscheck [repair=path,queue,fmod|all]; inventory/graph/agent consistency
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						tmap := gizmos.Mixtoks2map( tokens[1:], "" )
+						rl := "none"
+						if tmap["repair"] != nil {
+							rl = *tmap["repair"]
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_CONS_CHECK, &rl, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "invstats":											// aggregate inventory statistics (counts, bandwidth by tenant/link, push failures)
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_INV_STATS, nil, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "recovery":											// report of what was (and wasn't) recovered from the checkpoint at start
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_RECOVERY, nil, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "slareport":											// slareport [id]; sla breach history, of one reservation if id is given
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						id := ""
+						if ntokens > 1 {
+							id = tokens[1]
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_SLA_REPORT, &id, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "qstatus":											// qstatus [host]; application of the current queue map by host
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						host := ""
+						if ntokens > 1 {
+							host = tokens[1]
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( fq_ch, my_ch, REQ_QUEUE_STATUS, &host, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "loadgen":												// synthetic reservations for capacity testing; see http_loadgen.go
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						var err error
+						if jreason, err = loadgen_request( tokens[1:] ); err == nil {
+							state = "OK"
+							reason = ""
+						} else {
+							jreason = ""
+							reason = fmt.Sprintf( "%s", err )
+						}
+					}
+
+				case "snapshot":											// write network and inventory state to a file for replay
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						fname, err := take_snapshot( )
+						if err == nil {
+							state = "OK"
+							jreason = fmt.Sprintf( `{ "file": %q }`, fname )
+							reason = ""
+							http_sheep.Baa( 1, "snapshot written: %s", fname )
+						} else {
+							reason = fmt.Sprintf( "unable to write snapshot: %s", err )
+						}
+					}
+
+				case "compact":												// compact internal structures and report their size: compact [report]
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						if ntokens > 1 && tokens[1] != "report" {
+							reason = fmt.Sprintf( "bad parameters; usage: compact [report]; received: %s", recs[i] )
+							ecode = ERR_BAD_REQUEST
+							break
+						}
+
+						state = "OK"
+						jreason = compact( ntokens > 1 )
+						reason = ""
+					}
+
+				case "pathcache":											// path cache hit counts: pathcache [flush]
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						if ntokens > 1 && tokens[1] != "flush" {
+							reason = fmt.Sprintf( "bad parameters; usage: pathcache [flush]; received: %s", recs[i] )
+							ecode = ERR_BAD_REQUEST
+							break
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( nw_ch, my_ch, REQ_PATH_CACHE, ntokens > 1, cid )
+						req = <- my_ch
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+					}
+
+				case "netprov":												// network provider and, when there is one, how the shadow compares
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						state = "OK"
+						jreason = net_prov.Stats( )
+						reason = ""
+					}
+
+				case "cni_add", "cni_del":								// cni plugin callback: cni_add namespace pod ip mac node project | cni_del namespace pod
+					if validate_auth( &auth_data, is_token, sysproc_roles ) {
+						var kreq *k8s_req
+
+						if tokens[0] == "cni_add" && ntokens == 7 {				// project owns the namespace; tokens must be valid for it to reserve the pod
+							kreq = mk_k8s_add( tokens[1], tokens[2], tokens[3], tokens[4], tokens[5], tokens[6] )
+						} else {
+							if tokens[0] == "cni_del" && ntokens == 3 {
+								kreq = mk_k8s_del( tokens[1], tokens[2] )
+							}
+						}
+
+						if kreq == nil {
+							nerrors++
+							reason = fmt.Sprintf( "bad parameters; usage: cni_add namespace pod ip mac node project | cni_del namespace pod; received: %s", recs[i] )
+							break
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( osif_ch, my_ch, REQ_K8S_POD, kreq, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							reason = fmt.Sprintf( "pod %s", kreq.pod.Name )
+							if ! kreq.del {
+								update_graph( &kreq.pod.Name, true, true )			// push to the network graph and ip2mac to fq-mgr now rather than at reservation time
+							}
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "listhosts":											// list known host information
+					if validate_auth( &auth_data, is_token, sysproc_roles ) {
+						tmap := gizmos.Mixtoks2map( tokens[1:], "" )			// look for project=pname[,pname] on the request
+						if tmap["project"] != nil {
+							http_sheep.Baa( 1, "listhosts is forcing update of all VMs for the project: %s", *tmap["project"] )
+							req = ipc.Mk_chmsg( )
+							req.Send_req( osif_ch, my_ch, REQ_GET_PROJ_HOSTS, tmap["project"], cid )	// get a list of network vm insertion structs and push into the network
+							req = <- my_ch
+							if req.Response_data == nil {
+								http_sheep.Baa( 1, "failed to load all vm data: %s: %s", *tmap["project"], req.State )
+								jreason = fmt.Sprintf( "unable to load project data: %s", req.State )
+							} else {
+								req.Send_req( nw_ch, my_ch, REQ_ADD, req.Response_data, cid )	// send list to network to insert; must block until done so listhosts request gets update
+								req = <- my_ch
+							}
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( nw_ch, my_ch, REQ_LISTHOSTS, nil, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = string( req.Response_data.(string) )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "listaz":												// availability zone membership and policies
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						req = ipc.Mk_chmsg( )
+						req.Send_req( nw_ch, my_ch, REQ_LIST_AZ, nil, cid )
+						req = <- my_ch
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+					}
+
+				case "listgw":												// router external legs with capacity and current allocation
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						req = ipc.Mk_chmsg( )
+						req.Send_req( nw_ch, my_ch, REQ_LIST_GW, nil, cid )
+						req = <- my_ch
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+					}
+
+				case "calendar":											// calendar [window=[start-]end]; blackout periods in the window (next 7 days)
+					tmap := gizmos.Mixtoks2map( tokens[1:], "" )
+					w := "+604800"
+					if tmap["window"] != nil {
+						w = *tmap["window"]
+					}
+					cs, ce := gizmos.Str2start_end( w )
+					state = "OK"
+					reason = ""
+					jreason = fmt.Sprintf( `{ "start": %d, "end": %d, "policy": %q, "blackouts": %s }`, cs, ce, blackout_policy(), gizmos.Blackouts_json( cs, ce ) )
+
+				case "reach":												// reach [window=[start-]end] host1,host2; path each way and the most that could be reserved
+					tmap := gizmos.Mixtoks2map( tokens[1:], "hosts" )
+					if ok, _ := gizmos.Map_has_all( tmap, "hosts" ); ! ok {
+						reason = "missing parameters; usage: reach [window=[start-]end] <host1>,<host2>"
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					rr := &reach_req{ }
+					w := "+3600"
+					if tmap["window"] != nil {
+						w = *tmap["window"]
+					}
+					rr.commence, rr.conclude = gizmos.Str2start_end( w )
+					if rr.conclude <= rr.commence {
+						reason = fmt.Sprintf( "reach rejected: the window must not be empty: %s", w )
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					h1, h2 := gizmos.Str2host1_host2( *tmap["hosts"] )
+					if is_selector( h1 ) || is_selector( h2 ) {
+						reason = "reach rejected: label selectors are not supported; name the two hosts"
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+					h1, h2, _, _, _, _, err := validate_hosts( h1, h2 )
+					if err != nil {
+						reason = fmt.Sprintf( "reach rejected: %s", err )
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+					rr.h1 = h1														// the graph isn't updated; this is meant to be cheap
+					rr.h2 = h2
+
+					req = ipc.Mk_chmsg( )
+					req.Send_req( nw_ch, my_ch, REQ_REACH, rr, cid )
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+					} else {
+						ecode = err_code( req.State )
+						reason = fmt.Sprintf( "%s", req.State )
+					}
+
+				case "placement":											// placement [window=[start-]end] [phosts=h1,h2...] tenant bandwidth [token/]project/vm; hints for the scheduler
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						tmap := gizmos.Mixtoks2map( tokens[1:], "tenant bandw peer" )
+						if ok, _ := gizmos.Map_has_all( tmap, "tenant bandw peer" ); ! ok {
+							reason = "missing parameters; usage: placement [window=[start-]end] [phosts=h1,h2,...] tenant bandwidth [token/]project/vm"
+							ecode = ERR_BAD_REQUEST
+							break
+						}
+
+						pr := &place_req{ tenant: proj2id( *tmap["tenant"], my_ch ), bandw: int64( clike.Atof( *tmap["bandw"] ) ) }
+						w := "+3600"
+						if tmap["window"] != nil {
+							w = *tmap["window"]
+						}
+						pr.commence, pr.conclude = gizmos.Str2start_end( w )
+						if pr.bandw <= 0 || pr.conclude <= pr.commence {
+							reason = fmt.Sprintf( "placement rejected: bandwidth must be more than 0 and the window must not be empty: %s %s", *tmap["bandw"], w )
+							ecode = ERR_BAD_REQUEST
+							break
+						}
+						if tmap["phosts"] != nil {
+							pr.phosts = strings.Split( *tmap["phosts"], "," )
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( osif_ch, my_ch, REQ_VALIDATE_HOST, tmap["peer"], cid )		// same form as the reservations hold
+						req = <- my_ch
+						if req.State != nil {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "peer validation failed: %s", req.State )
+							break
+						}
+						ht, _, _ := gizmos.Split_hpv( req.Response_data.( *string ) )
+						pr.peer = *ht
+						update_graph( &pr.peer, false, true )
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( nw_ch, my_ch, REQ_PLACEMENT, pr, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "schema":												// json schema of pledge (checkpoint) records
+					state = "OK"
+					jreason = gizmos.Pledge_schema( )
+					reason = ""
+
+				case "setaz":												// setaz phost=zone[:aggregate,...]...; replaces all membership (see tegu_az_sync)
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						if ntokens < 2 {
+							reason = "missing parameters; usage: setaz phost=zone[:aggregate,aggregate...]..."
+							break
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( nw_ch, my_ch, REQ_SET_AZ, tokens[1:], cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "listlabels":											// listlabels [token/]project: VM labels (instance metadata) used by reservation selectors
+					if ntokens < 2 {
+						nerrors++
+						reason = fmt.Sprintf( "missing parameters; usage: listlabels [token/]project; received: %s", recs[i] )
+						break
+					}
+					var err error
+					if jreason, err = list_labels( tokens[1] ); err != nil {
+						nerrors++
+						ecode = err_code( err )
+						reason = fmt.Sprintf( "%s", err )
+						jreason = ""
+						break
+					}
+					state = "OK"
+					reason = ""
+
+				case "dtoken":												// dtoken add ... | list [project] | del id; delegated tokens for automation (http_dtoken.go)
+					state, reason, jreason, ecode = dtoken_req( tokens, auth_data, is_token )
+
+				case "listres":											// list reservations: listres [cookie] [tag.key=value...]; full details only for those owned by the cookie
+					cookie := &empty_str								// reservations made without a cookie are visible to all
+					tags := make( map[string]string )
+					for j := 1; j < ntokens; j++ {
+						if kv := strings.SplitN( tokens[j], "=", 2 ); len( kv ) == 2 && strings.HasPrefix( kv[0], "tag." ) {
+							tags[kv[0]] = kv[1]
+						} else {
+							cookie = &tokens[j]
+						}
+					}
+					req = ipc.Mk_chmsg( )
+					if len( tags ) > 0 {								// filtering is a search on the metadata index
+						req.Send_req( rmgr_ch, my_ch, REQ_SEARCH, []interface{}{ tags, cookie }, cid )
+					} else {
+						req.Send_req( rmgr_ch, my_ch, REQ_LIST, cookie, cid )
+					}
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						jreason = string( req.Response_data.(string) )
+						reason = ""
+					} else {
+						ecode = err_code( req.State )
+						reason = fmt.Sprintf( "%s", req.State )
+					}
+
+
+				case "search":											// search field=value... [cookie=c]; reservations by host, vm, ip, mac, project, dscp, switch or link
+					cookie := &empty_str
+					q := make( map[string]string )
+					for _, tok := range tokens[1:] {
+						kv := strings.SplitN( tok, "=", 2 )
+						if len( kv ) != 2 {
+							continue
+						}
+						if kv[0] == "cookie" {
+							cookie = &kv[1]
+						} else {
+							q[kv[0]] = kv[1]
+						}
+					}
+					if q["ip"] != "" || q["mac"] != "" {						// addresses are not for everyone
+						if ! validate_auth( &auth_data, is_token, sysproc_roles ) {
+							break
+						}
+					}
+
+					req = ipc.Mk_chmsg( )
+					req.Send_req( rmgr_ch, my_ch, REQ_SEARCH, []interface{}{ q, cookie }, cid )
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+					} else {
+						ecode = err_code( req.State )
+						reason = fmt.Sprintf( "%s", req.State )
+					}
+
+				case "setmeta":											// setmeta res-id key=value [key=value...] [cookie=c]; empty value removes the key
+					if ntokens < 3 {
+						reason = "missing parameters; usage: setmeta res-id key=value [key=value...] [cookie=cookie]"
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					cookie := &empty_str
+					pairs := make( map[string]string )
+					reason = "no metadata given; usage: setmeta res-id key=value [key=value...] [cookie=cookie]"
+					for _, tok := range tokens[2:] {
+						kv := strings.SplitN( tok, "=", 2 )
+						if len( kv ) != 2 {
+							pairs = nil
+							reason = fmt.Sprintf( "metadata must be given as key=value: %s", tok )
+							break
+						}
+						if kv[0] == "cookie" {
+							cookie = &kv[1]
+						} else {
+							pairs[kv[0]] = kv[1]
+						}
+					}
+					if len( pairs ) == 0 {
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					req = ipc.Mk_chmsg( )
+					req.Send_req( rmgr_ch, my_ch, REQ_SET_META, []interface{}{ &tokens[1], cookie, pairs }, cid )
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						reason = fmt.Sprintf( "metadata updated for reservation %s", tokens[1] )
+						ckptreq := ipc.Mk_chmsg( )
+						ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, cid )
+					} else {
+						ecode = err_code( req.State )
+						reason = fmt.Sprintf( "%s", req.State )
+					}
+
+				case "owners":											// owners res-id add|del|list [cookie...] [cookie=c]; manage the owner group of a reservation
+					usage := "usage: owners res-id add|del|list [member-cookie...] [cookie=cookie]"
+					if ntokens < 3 {
+						reason = "missing parameters; " + usage
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					op := tokens[2]
+					if op != "add" && op != "del" && op != "list" {
+						reason = fmt.Sprintf( "unknown owners action: %s; %s", op, usage )
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					cookie := &empty_str
+					list := make( []string, 0, 4 )
+					for j := 3; j < ntokens; j++ {
+						if strings.HasPrefix( tokens[j], "cookie=" ) {
+							c := tokens[j][7:]
+							cookie = &c
+						} else {
+							list = append( list, tokens[j] )
+						}
+					}
+					if op != "list" && len( list ) == 0 {
+						reason = "no member cookies given; " + usage
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					req = ipc.Mk_chmsg( )
+					req.Send_req( rmgr_ch, my_ch, REQ_OWNERS, []interface{}{ &tokens[1], cookie, op, list }, cid )
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+						if op != "list" {
+							ckptreq := ipc.Mk_chmsg( )
+							ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, cid )
+						}
+					} else {
+						ecode = err_code( req.State )
+						reason = fmt.Sprintf( "%s", req.State )
+					}
+
+				case "resstatus":										// resstatus [watch=sec] res-id [cookie]; flow-mods believed installed for the reservation
+					watch := int64( -1 )
+					if ntokens > 1 && strings.HasPrefix( tokens[1], "watch=" ) {		// hold the response until the status changes (res_mgr_watch)
+						watch = clike.Atoi64( tokens[1][6:] )
+						tokens = tokens[1:]
+						ntokens--
+					}
+					if ntokens < 2 {
+						reason = "missing reservation id; usage: resstatus [watch=sec] res-id [cookie]"
+						break
+					}
+
+					cookie := &empty_str
+					if ntokens > 2 {
+						cookie = &tokens[2]
+					}
+					req = ipc.Mk_chmsg( )
+					if watch >= 0 {
+						req.Send_req( rmgr_ch, my_ch, REQ_RES_WATCH, &res_watch{ name: tokens[1], cookie: cookie, secs: watch }, cid )
+					} else {
+						req.Send_req( rmgr_ch, my_ch, REQ_RES_STATUS, []*string{ &tokens[1], cookie }, cid )
+					}
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						jreason = req.Response_data.( string )
 						reason = ""
 					} else {
+						ecode = err_code( req.State )
 						reason = fmt.Sprintf( "%s", req.State )
 					}
 
-
 				case "listconns":								// generate json describing where the named host is attached (switch/port)
 					if ntokens < 2 {
 						nerrors++
 						reason = fmt.Sprintf( "incorrect number of parameters supplied (%d) 1 expected: usage: attached2 hostname", ntokens-1 );
 					} else {
 						req = ipc.Mk_chmsg( )
-						req.Send_req( nw_ch, my_ch, REQ_LISTCONNS, &tokens[1], nil )
+						req.Send_req( nw_ch, my_ch, REQ_LISTCONNS, &tokens[1], cid )
 						req = <- my_ch
 						if req.State == nil {
 							state = "OK"
 							jreason = string( req.Response_data.(string) )
 							reason = ""
 						} else {
+							ecode = err_code( req.State )
 							reason = fmt.Sprintf( "%s", req.State )
 						}
 					}
@@ -838,7 +2096,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 							state = "WARN"
 						} else {
 							req = ipc.Mk_chmsg( )
-							req.Send_req( rmgr_ch, my_ch, REQ_PAUSE, nil, nil )
+							req.Send_req( rmgr_ch, my_ch, REQ_PAUSE, nil, cid )
 							req = <- my_ch
 							if req.State == nil {
 								http_sheep.Baa( 1, "reservations are now paused" )
@@ -847,6 +2105,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 								reason = ""
 								res_paused = true
 							} else {
+								ecode = err_code( req.State )
 								reason = fmt.Sprintf( "%s", req.State )
 							}
 						}
@@ -859,8 +2118,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 
 				case "qdump":					// dumps a list of currently active queues from network and writes them out to requester (debugging mostly)
 					if validate_auth( &auth_data, is_token, admin_roles ) {
-						req = ipc.Mk_chmsg( )
-						req.Send_req( nw_ch, my_ch, REQ_GEN_QMAP, time.Now().Unix(), nil )		// send to network to verify a path
+						net_prov.Post( REQ_GEN_QMAP, time.Now().Unix(), my_ch )				// send to network to verify a path
 						req = <- my_ch															// get response from the network thread
 						state = "OK"
 						m :=  req.Response_data.( []string )
@@ -874,6 +2132,268 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						reason = "active queues"
 					}
 
+				case "maint":												// maint add name [start-]end [host=h|switch=s], maint del name, maint [list]
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						mr := &maint_req{ action: "list" }
+						usage := ""
+						if ntokens > 1 {
+							mr.action = tokens[1]
+						}
+
+						switch mr.action {
+							case "add":
+								if ntokens < 4 {
+									usage = "missing parameters; usage: maint add name [start-]end [host=name|switch=id]"
+								} else {
+									mr.w = &maint_window{ name: tokens[2], scope: "global" }
+									mr.w.start, mr.w.end = gizmos.Str2start_end( tokens[3] )
+									tmap := gizmos.Mixtoks2map( tokens[4:], "" )
+									if tmap["host"] != nil {
+										mr.w.scope = "host"
+										mr.w.target = *tmap["host"]
+									} else {
+										if tmap["switch"] != nil {
+											mr.w.scope = "switch"
+											mr.w.target = *tmap["switch"]
+										}
+									}
+								}
+
+							case "del":
+								if ntokens < 3 {
+									usage = "missing window name; usage: maint del name"
+								} else {
+									mr.w = &maint_window{ name: tokens[2] }
+								}
+
+							case "list":
+
+							default:
+								usage = fmt.Sprintf( "unknown maint action: %s; expected add, del or list", mr.action )
+						}
+
+						if usage != "" {
+							reason = usage
+						} else {
+							req = ipc.Mk_chmsg( )
+							req.Send_req( rmgr_ch, my_ch, REQ_MAINT, mr, cid )
+							req = <- my_ch
+							if req.State == nil {
+								state = "OK"
+								jreason = req.Response_data.( string )
+								reason = ""
+							} else {
+								ecode = err_code( req.State )
+								reason = fmt.Sprintf( "%s", req.State )
+							}
+						}
+					}
+
+				case "quarantine":											// quarantine add name vm=[token/]project/vm|phost=name [reason=text], quarantine del name, quarantine [list]
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						qr := &quar_req{ action: "list" }
+						usage := ""
+						if ntokens > 1 {
+							qr.action = tokens[1]
+						}
+
+						switch qr.action {
+							case "add":
+								tmap := map[string]*string{}
+								if ntokens > 3 {
+									tmap = gizmos.Mixtoks2map( tokens[3:], "" )
+								}
+								switch {
+									case ntokens < 4 || (tmap["vm"] == nil) == (tmap["phost"] == nil):
+										usage = "missing parameters; usage: quarantine add name vm=[token/]project/vm|phost=name [reason=text]"
+
+									case tmap["vm"] != nil:
+										req = ipc.Mk_chmsg( )
+										req.Send_req( osif_ch, my_ch, REQ_VALIDATE_HOST, tmap["vm"], cid )		// same form as the reservations hold
+										req = <- my_ch
+										if req.State != nil {
+											usage = fmt.Sprintf( "vm validation failed: %s", req.State )
+										} else {
+											ht, _, _ := gizmos.Split_hpv( req.Response_data.( *string ) )
+											qr.kind = "vm"
+											qr.target = *ht
+										}
+
+									default:
+										qr.kind = "phost"
+										qr.target = *tmap["phost"]
+								}
+								qr.name = tokens[2]
+								if tmap["reason"] != nil {
+									qr.reason = *tmap["reason"]
+								}
+
+							case "del":
+								if ntokens < 3 {
+									usage = "missing quarantine name; usage: quarantine del name"
+								} else {
+									qr.name = tokens[2]
+								}
+
+							case "list":
+
+							default:
+								usage = fmt.Sprintf( "unknown quarantine action: %s; expected add, del or list", qr.action )
+						}
+
+						if usage != "" {
+							reason = usage
+						} else {
+							req = ipc.Mk_chmsg( )
+							req.Send_req( rmgr_ch, my_ch, REQ_QUARANTINE, qr, cid )
+							req = <- my_ch
+							if req.State == nil {
+								state = "OK"
+								jreason = req.Response_data.( string )
+								reason = ""
+							} else {
+								ecode = err_code( req.State )
+								reason = fmt.Sprintf( "%s", req.State )
+							}
+						}
+					}
+
+				case "tier":												// tier set project [dscp=class] [max=bw] [total=bw], tier del project, tier [list]
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						tr := &tier_req{ action: "list" }
+						usage := ""
+						if ntokens > 1 {
+							tr.action = tokens[1]
+						}
+
+						switch tr.action {
+							case "set":
+								if ntokens < 3 {
+									usage = "missing project; usage: tier set project [dscp=class] [max=bandwidth] [total=bandwidth]"
+									break
+								}
+								t, err := mk_proj_tier( tokens[2] + ":" + strings.Join( tokens[3:ntokens], "," ) )
+								if err != nil {
+									usage = fmt.Sprintf( "%s", err )
+									break
+								}
+								if t.dscp != "" && tclass2dscp[strings.TrimPrefix( t.dscp, "global_" )] <= 0 {
+									usage = fmt.Sprintf( "traffic classifcation string is not valid: %s", t.dscp )
+									break
+								}
+								if t.project != "*" {
+									if id := proj2id( t.project, my_ch ); id != t.project {
+										t.id = id
+									}
+								}
+								tr.tier = t
+
+							case "del":
+								if ntokens < 3 {
+									usage = "missing project; usage: tier del project"
+								} else {
+									tr.project = tokens[2]
+								}
+
+							case "list":
+
+							default:
+								usage = fmt.Sprintf( "unknown tier action: %s; expected set, del or list", tr.action )
+						}
+
+						if usage != "" {
+							reason = usage
+						} else {
+							req = ipc.Mk_chmsg( )
+							req.Send_req( rmgr_ch, my_ch, REQ_PROJ_TIER, tr, cid )
+							req = <- my_ch
+							if req.State == nil {
+								state = "OK"
+								jreason = req.Response_data.( string )
+								reason = ""
+							} else {
+								ecode = err_code( req.State )
+								reason = fmt.Sprintf( "%s", req.State )
+							}
+						}
+					}
+
+				case "chaintemplate":										// chaintemplate set name roles=r1+r2... [proto=p] [pri=n], chaintemplate del name, chaintemplate [list]
+					ctr := &ctmpl_req{ action: "list" }
+					if ntokens > 1 {
+						ctr.action = tokens[1]
+					}
+					if ctr.action != "list" && ! validate_auth( &auth_data, is_token, admin_roles ) {		// tenants may list templates to instantiate them
+						break
+					}
+
+					usage := ""
+					switch ctr.action {
+						case "set":
+							if ntokens < 4 {
+								usage = "missing parameters; usage: chaintemplate set name roles=role1+role2... [proto=p] [pri=n]"
+								break
+							}
+							t, err := mk_chain_tmpl( tokens[2] + ":" + strings.Join( tokens[3:ntokens], "," ) )
+							if err != nil {
+								usage = fmt.Sprintf( "%s", err )
+							}
+							ctr.tmpl = t
+
+						case "del":
+							if ntokens < 3 {
+								usage = "missing template name; usage: chaintemplate del name"
+							} else {
+								ctr.name = tokens[2]
+							}
+
+						case "list":
+
+						default:
+							usage = fmt.Sprintf( "unknown chaintemplate action: %s; expected set, del or list", ctr.action )
+					}
+
+					if usage != "" {
+						reason = usage
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+					req = ipc.Mk_chmsg( )
+					req.Send_req( rmgr_ch, my_ch, REQ_CHAIN_TMPL, ctr, cid )
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+					} else {
+						ecode = err_code( req.State )
+						reason = fmt.Sprintf( "%s", req.State )
+					}
+
+				case "queuemap":											// queuemap [switch=id] [at=time]; queues by switch/port with owning reservation
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						tmap := gizmos.Mixtoks2map( tokens[1:], "" )
+						qq := &qmap_query{ ts: time.Now().Unix() }
+						if tmap["switch"] != nil {
+							qq.swid = *tmap["switch"]
+						}
+						if tmap["at"] != nil {
+							_, qq.ts = gizmos.Str2start_end( *tmap["at"] )		// +secs or timestamp; not before now
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( nw_ch, my_ch, REQ_QMAP_DETAIL, qq, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
 				case "refresh":								// refresh reservations for named VM(s)
 					if validate_auth( &auth_data, is_token, admin_roles ) {
 						state = "OK"
@@ -881,11 +2401,11 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						rcount := 0
 						for i := 1; i < ntokens; i++ {
 							req = ipc.Mk_chmsg( )
-							req.Send_req( osif_ch, my_ch, REQ_XLATE_HOST, &tokens[i], nil )		// translate [token/][project/]host-name into ID/hostname
+							req.Send_req( osif_ch, my_ch, REQ_XLATE_HOST, &tokens[i], cid )		// translate [token/][project/]host-name into ID/hostname
 							req = <- my_ch														// wait for response
 							if req.Response_data != nil {
 								hname := req.Response_data.( *string )
-								req.Send_req( rmgr_ch, my_ch, REQ_PLEDGE_LIST, hname, nil )		// get a list of pledges that are associated with the hostname
+								req.Send_req( rmgr_ch, my_ch, REQ_PLEDGE_LIST, hname, cid )		// get a list of pledges that are associated with the hostname
 								req = <- my_ch
 								if req.Response_data != nil {
 									plist := req.Response_data.( []*gizmos.Pledge )				// list of all pledges that touch the VM
@@ -893,7 +2413,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 
 									for i := range plist {
 										p := *plist[i]
-										req.Send_req( rmgr_ch, my_ch, REQ_YANK_RES, p.Get_id(), nil )		// yank the reservation for this pledge
+										req.Send_req( rmgr_ch, my_ch, REQ_YANK_RES, p.Get_id(), cid )		// yank the reservation for this pledge
 										req = <- my_ch
 
 										if req.State == nil {
@@ -905,7 +2425,8 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 													update_graph( h2, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
 
 													sp.Reset_pushed()													// it's not pushed at this point
-													reason, jreason, ecount = finalise_bw_res( sp, res_paused )	// allocate in network and add to res manager inventory
+													sp.Set_cid( cid )
+													reason, jreason, ecount, ecode = finalise_bw_res( ctx, sp, res_paused )	// allocate in network and add to res manager inventory
 													if ecount == 0 {
 														http_sheep.Baa( 1, "reservation refreshed: %s", *sp.Get_id() )
 													} else {
@@ -948,7 +2469,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						ok, mlist := gizmos.Map_has_all( tmap, key_list )		// check to ensure all expected parms were supplied
 						if !ok {
 							nerrors++
-							reason = fmt.Sprintf( "missing parameters: (%s); usage: reserve <bandwidth[K|M|G][,<outbandw[K|M|G]> {[<start>-]<end-time>|+sec} <host1>[,<host2>] cookie dscp; received: %s", mlist, recs[i] );
+							reason = fmt.Sprintf( "missing parameters: (%s); usage: reserve [replace=res-id] <bandwidth[K|M|G][,<outbandw[K|M|G]> {[<start>-]<end-time>|+sec} <host1>[,<host2>] cookie dscp; received: %s", mlist, recs[i] );
 							break
 						}
 
@@ -963,6 +2484,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 
 						startt, endt = gizmos.Str2start_end( *tmap["window"] )		// split time token into start/end timestamps
 						h1, h2 = gizmos.Str2host1_host2( *tmap["hosts"] )			// split h1-h2 or h1,h2 into separate strings
+						selector := is_selector( h1 ) || is_selector( h2 )			// project/@key.value expands to a reservation for each labeled VM
 
 						htoks := strings.Split( h1, "/" )							// trap bad host names early
 						if len( htoks ) > 4 {										// must allow 0xaaaa/0xbbbb  port masks at end (2016.02.28)
@@ -972,15 +2494,27 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 							if len( htoks ) > 4 {
 								err = fmt.Errorf( "invalid host name: %s", h2 )
 							} else {
-								h1, h2, p1, p2, v1, v2, err = validate_hosts( h1, h2 )		// translate project/host[:port][{vlan}] into pieces parts and validates token/project
+								if is_dtoken( h1 ) || is_dtoken( h2 ) {					// delegated token; scope is checked rather than keystone
+									if selector {
+										err = fmt.Errorf( "selectors may not be used with a delegated token" )
+									} else {
+										h1, h2, p1, p2, v1, v2, err = dtoken_hosts( h1, h2, bandw_in, bandw_out, endt )
+									}
+								} else {
+									if ! selector {											// selector hosts are validated as they are expanded
+										h1, h2, p1, p2, v1, v2, err = validate_hosts( h1, h2 )		// translate project/host[:port][{vlan}] into pieces parts and validates token/project
+									}
+								}
 							}
 						}
 						
 						res = nil
 
 						if err == nil {
-							update_graph( &h1, false, false )						// pull all of the VM information from osif then send to netmgr
-							update_graph( &h2, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
+							if ! selector {
+								update_graph( &h1, false, false )						// pull all of the VM information from osif then send to netmgr
+								update_graph( &h2, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
+							}
 
 							dscp := tclass2dscp["voice"]							// default to using voice traffic class
 							dscp_koe := false										// we do not keep it as the packet exits the environment
@@ -997,6 +2531,21 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 								}
 							}
 
+							if err == nil {											// project default class and bandwidth ceiling (res_mgr_tiers)
+								tier := project_tier( hosts_project( h1, h2 ) )
+								tier.apply( tmap["dscp"] != nil && *tmap["dscp"] != "0", &dscp, &dscp_koe, &bandw_in, &bandw_out )
+							}
+
+							if err == nil && selector {
+								reason, ecount = reserve_selector( h1, h2, startt, endt, bandw_in, bandw_out, *tmap["cookie"], dscp, dscp_koe, tmap["proto"], cid )
+								if ecount == 0 {
+									state = "OK"
+								} else {
+									nerrors += ecount - 1
+								}
+								break
+							}
+
 							if err == nil {
 								res_name := mk_resname( )					// name used to track the reservation in the cache and given to queue setting commands for visual debugging
 								res, err = gizmos.Mk_bw_pledge( &h1, &h2, p1, p2, startt, endt, bandw_in, bandw_out, &res_name, tmap["cookie"], dscp, dscp_koe )
@@ -1013,12 +2562,72 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 							if tmap["ipv6"] != nil {
 								res.Set_matchv6( *tmap["ipv6"] == "true" )
 							}
+							if tmap["reopt"] != nil {						// may be moved to a better path while active (res_mgr_reopt)
+								res.Set_reopt( *tmap["reopt"] == "true" )
+							}
 
-							reason, jreason, ecount = finalise_bw_res( res, res_paused )	// check for dup, allocate in network, and add to res manager inventory
-							if ecount == 0 {
-								state = "OK"
+							if tmap["replace"] != nil && ! ovn_configured() {	// version 0 agents can't install the replacement's flow-mods at a different priority
+								req = ipc.Mk_chmsg( )
+								req.Send_req( am_ch, my_ch, REQ_AGENT_PVER, nil, cid )
+								req = <- my_ch
+								if pv, ok := req.Response_data.( int ); ok && pv < 1 {
+									err = mk_err( ERR_BAD_REQUEST, "replace is not possible while an agent which predates protocol version 1 is connected; delete and reserve instead" )
+								}
+							}
+
+							if err == nil && tmap["replace"] != nil {			// make-before-break: old reservation is expired only after this one is pushed
+								req = ipc.Mk_chmsg( )
+								req.Send_req( rmgr_ch, my_ch, REQ_GET, []*string{ tmap["replace"], tmap["cookie"] }, cid )		// cookie must be valid for the old one too
+								req = <- my_ch
+								if req.State == nil {
+									obw, ok := (*req.Response_data.( *gizmos.Pledge )).( *gizmos.Pledge_bw )
+									if ok {
+										res.Set_handover( obw.Get_id(), obw.Get_pbump() )
+									} else {
+										err = fmt.Errorf( "reservation to replace is not a bandwidth reservation: %s", *tmap["replace"] )
+									}
+								} else {
+									err = req.State
+								}
+							}
+
+							if err == nil && tmap["depends"] != nil {			// not pushed until the reservation it depends on is (res_mgr_deps)
+								if err = depends_access( tmap["depends"], tmap["cookie"] ); err == nil {
+									res.Set_depends( *tmap["depends"] )
+								}
+							}
+
+							if err == nil && tmap["meta"] != nil {				// user metadata: key:value[,key:value...]
+								if merr := res.Set_meta_list( *tmap["meta"] ); merr != nil {
+									err = mk_err( ERR_BAD_REQUEST, "%s", merr )
+								}
+							}
+							if err == nil {
+								err = set_name_opts( res, tmap )
+							}
+
+							var wins [][2]int64									// set when the window is to be split around blackouts
+							if err == nil {
+								c, e := res.Get_window()
+								if wins, err = blackout_pieces( c, e ); err == nil && wins != nil && res.Get_handover() != nil {
+									err = mk_err( ERR_BAD_REQUEST, "a replacement reservation can't be split around blackouts" )
+								}
+							}
+
+							if err == nil {
+								res.Set_cid( cid )
+								if wins != nil {
+									reason, jreason, ecount, ecode = finalise_bw_split( ctx, res, wins, res_paused )
+								} else {
+									reason, jreason, ecount, ecode = finalise_bw_res( ctx, res, res_paused )	// check for dup, allocate in network, and add to res manager inventory
+								}
+								if ecount == 0 {
+									state = "OK"
+								} else {
+									nerrors += ecount - 1 												// record 1 less here as nerrors increased at end when state is error
+								}
 							} else {
-								nerrors += ecount - 1 												// record 1 less here as nerrors increased at end when state is error
+								reason = fmt.Sprintf( "reservation rejected: %s", err )
 							}
 						} else {
 							if err == nil {
@@ -1035,65 +2644,176 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 					ok, mlist := gizmos.Map_has_all( tmap, key_list )		// check to ensure all expected parms were supplied
 					if !ok {
 						nerrors++
-						reason = fmt.Sprintf( "missing parameters: (%s); usage: ow_reserve <bandwidth[K|M|G][,<outbandw[K|M|G]> {[<start>-]<end-time>|+sec} <host1>[,<host2>] cookie dscp; received: %s", mlist, recs[i] );
+						reason = fmt.Sprintf( "missing parameters: (%s); usage: ow_reserve <bandwidth[K|M|G][,<outbandw[K|M|G]> {[<start>-]<end-time>|+sec} <host1>[,<host2>] cookie dscp; received: %s", mlist, recs[i] );
+						break
+					}
+
+					if strings.Index( *tmap["bandw"], "," ) >= 0 {				// look for inputbandwidth,outputbandwidth	(we'll silently ignore inbound)
+						subtokens := strings.Split( *tmap["bandw"], "," )
+						bandw_out = int64( clike.Atof( subtokens[1] ) )
+					} else {
+						bandw_out = int64( clike.Atof( *tmap["bandw"] ) )		// no comma, so single value applied to each
+					}
+
+					startt, endt = gizmos.Str2start_end( *tmap["window"] )		// split time token into start/end timestamps
+					h1, h2 := gizmos.Str2host1_host2( *tmap["hosts"] )			// split h1-h2 or h1,h2 into separate strings
+
+					res = nil
+					h1, h2, p1, p2, v1, _, err := validate_hosts( h1, h2 )		// translate project/host[:port][{vlan}] into pieces parts and validates token/project
+
+					if err == nil {
+						update_graph( &h1, false, false )						// pull all of the VM information from osif then send to netmgr
+						update_graph( &h2, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
+
+						dscp := tclass2dscp["voice"]							// default to using voice traffic class
+
+						if tmap["dscp"] != nil && *tmap["dscp"] != "0" {				// 0 is the old default from tegu_req (back compat)
+							if strings.HasPrefix( *tmap["dscp"], "global_" ) {			// for a one way, we don't set a keep on exit flag, but allow global_* markings
+								dscp = tclass2dscp[(*tmap["dscp"])[7:] ]				// pull the value based on the trailing string
+							} else {
+								dscp = tclass2dscp[*tmap["dscp"]]
+							}
+							if dscp <= 0 {
+								err = fmt.Errorf( "traffic classifcation string is not valid: %s", *tmap["dscp"] )
+							}
+						}
+
+						if err == nil {
+							koe := false										// not kept for a one way; the tier's global_ class still gives the value
+							tier := project_tier( hosts_project( h1, h2 ) )
+							tier.apply( tmap["dscp"] != nil && *tmap["dscp"] != "0", &dscp, &koe, &bandw_out )
+
+							res_name := mk_resname( )					// name used to track the reservation in the cache and given to queue setting commands for visual debugging
+							res, err = gizmos.Mk_bwow_pledge( &h1, &h2, p1, p2, startt, endt, bandw_out, &res_name, tmap["cookie"], dscp )
+						}
+					}
+
+					if res != nil {															// able to make the reservation, continue and try to find a path with bandwidth
+						if tmap["proto"] != nil {
+							res.Add_proto( tmap["proto"] )
+						}
+
+						res.Set_vlan( v1 )													// augment the rest of the reservation
+						if tmap["ipv6"] != nil {
+							res.Set_matchv6( *tmap["ipv6"] == "true" )
+						}
+
+						if tmap["depends"] != nil {
+							if err = depends_access( tmap["depends"], tmap["cookie"] ); err == nil {
+								res.Set_depends( *tmap["depends"] )
+							}
+						}
+
+						if err == nil && tmap["meta"] != nil {
+							if merr := res.Set_meta_list( *tmap["meta"] ); merr != nil {
+								err = mk_err( ERR_BAD_REQUEST, "%s", merr )
+							}
+						}
+						if err == nil {
+							err = set_name_opts( res, tmap )
+						}
+
+						if err == nil {
+							res.Set_cid( cid )
+							reason, jreason, ecount, ecode = finalise_bwow_res( ctx, res, res_paused )		// check for dup, allocate in network, and add to res manager inventory
+							if ecount == 0 {
+								state = "OK"
+							} else {
+								nerrors += ecount - 1 										// record 1 less here as when state is ERROR below nerrors is updated
+							}
+						} else {
+							ecode = err_code( err )
+							reason = fmt.Sprintf( "reservation rejected: %s", err )
+						}
+					} else {
+						if err == nil {
+							err = fmt.Errorf( "specific reason unknown" )						// ensure we have something for message
+						}
+						reason = fmt.Sprintf( "reservation rejected: %s", err )
+					}
+
+				case "mc_reserve":											// multicast: one source, many receivers
+					var res *gizmos.Pledge_mcast
+
+					key_list := "bandw window src group rcvrs cookie dscp"
+					tmap := gizmos.Mixtoks2map( tokens[1:], key_list )
+					ok, mlist := gizmos.Map_has_all( tmap, key_list )
+					if !ok {
+						nerrors++
+						reason = fmt.Sprintf( "missing parameters: (%s); usage: mc_reserve <bandwidth[K|M|G]> {[<start>-]<end-time>|+sec} <source> <group> <rcvr1>[,<rcvr2>...] cookie dscp; received: %s", mlist, recs[i] );
 						break
 					}
 
-					if strings.Index( *tmap["bandw"], "," ) >= 0 {				// look for inputbandwidth,outputbandwidth	(we'll silently ignore inbound)
-						subtokens := strings.Split( *tmap["bandw"], "," )
-						bandw_out = int64( clike.Atof( subtokens[1] ) )
-					} else {
-						bandw_out = int64( clike.Atof( *tmap["bandw"] ) )		// no comma, so single value applied to each
-					}
-
-					startt, endt = gizmos.Str2start_end( *tmap["window"] )		// split time token into start/end timestamps
-					h1, h2 := gizmos.Str2host1_host2( *tmap["hosts"] )			// split h1-h2 or h1,h2 into separate strings
+					bandw := int64( clike.Atof( *tmap["bandw"] ) )
+					startt, endt = gizmos.Str2start_end( *tmap["window"] )
 
-					res = nil
-					h1, h2, p1, p2, v1, _, err := validate_hosts( h1, h2 )		// translate project/host[:port][{vlan}] into pieces parts and validates token/project
+					var err error
+					if gip := net.ParseIP( *tmap["group"] ); gip == nil || ! gip.IsMulticast() {
+						err = fmt.Errorf( "group is not a multicast address: %s", *tmap["group"] )
+					}
 
+					src := ""
 					if err == nil {
-						update_graph( &h1, false, false )						// pull all of the VM information from osif then send to netmgr
-						update_graph( &h2, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
+						src, _, _, err = validate_one_host( *tmap["src"] )
+					}
 
-						dscp := tclass2dscp["voice"]							// default to using voice traffic class
+					rcvrs := make( []*string, 0 )
+					if err == nil {
+						for _, r := range strings.Split( *tmap["rcvrs"], "," ) {
+							if r == "" {
+								continue
+							}
 
-						if tmap["dscp"] != nil && *tmap["dscp"] != "0" {				// 0 is the old default from tegu_req (back compat)
-							if strings.HasPrefix( *tmap["dscp"], "global_" ) {			// for a one way, we don't set a keep on exit flag, but allow global_* markings
-								dscp = tclass2dscp[(*tmap["dscp"])[7:] ]				// pull the value based on the trailing string
-							} else {
-								dscp = tclass2dscp[*tmap["dscp"]]
+							rx, _, _, rerr := validate_one_host( r )
+							if rerr != nil {
+								err = rerr
+								break
 							}
-							if dscp <= 0 {
-								err = fmt.Errorf( "traffic classifcation string is not valid: %s", *tmap["dscp"] )
+							if rx == src {
+								err = fmt.Errorf( "source cannot also be a receiver: %s", r )
+								break
 							}
+							rcvrs = append( rcvrs, &rx )
 						}
+					}
 
-						if err == nil {
-							res_name := mk_resname( )					// name used to track the reservation in the cache and given to queue setting commands for visual debugging
-							res, err = gizmos.Mk_bwow_pledge( &h1, &h2, p1, p2, startt, endt, bandw_out, &res_name, tmap["cookie"], dscp )
+					dscp := tclass2dscp["voice"]
+					if err == nil && *tmap["dscp"] != "0" {
+						dscp = tclass2dscp[strings.TrimPrefix( *tmap["dscp"], "global_" )]
+						if dscp <= 0 {
+							err = fmt.Errorf( "traffic classifcation string is not valid: %s", *tmap["dscp"] )
 						}
 					}
 
-					if res != nil {															// able to make the reservation, continue and try to find a path with bandwidth
+					if err == nil {
+						update_graph( &src, false, false )
+						for j := range rcvrs {
+							last := j == len( rcvrs ) - 1
+							update_graph( rcvrs[j], last, last )					// block on the last so that the graph has all of them
+						}
+
+						res_name := mk_resname( )
+						res, err = gizmos.Mk_mcast_pledge( &src, tmap["group"], rcvrs, startt, endt, bandw, &res_name, tmap["cookie"], dscp )
+					}
+
+					if res != nil {
 						if tmap["proto"] != nil {
 							res.Add_proto( tmap["proto"] )
 						}
-
-						res.Set_vlan( v1 )													// augment the rest of the reservation
 						if tmap["ipv6"] != nil {
 							res.Set_matchv6( *tmap["ipv6"] == "true" )
 						}
 
-						reason, jreason, ecount = finalise_bwow_res( res, res_paused )		// check for dup, allocate in network, and add to res manager inventory
+						res.Set_cid( cid )
+						reason, jreason, ecount, ecode = finalise_mcast_res( ctx, res, res_paused )
 						if ecount == 0 {
 							state = "OK"
 						} else {
-							nerrors += ecount - 1 											// record 1 less here as when state is ERROR below nerrors is updated
+							nerrors += ecount - 1
 						}
 					} else {
 						if err == nil {
-							err = fmt.Errorf( "specific reason unknown" )						// ensure we have something for message
+							err = fmt.Errorf( "specific reason unknown" )
 						}
 						reason = fmt.Sprintf( "reservation rejected: %s", err )
 					}
@@ -1105,7 +2825,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 							state = "WARN"
 						} else {
 							req = ipc.Mk_chmsg( )
-							req.Send_req( rmgr_ch, my_ch, REQ_RESUME, nil, nil )
+							req.Send_req( rmgr_ch, my_ch, REQ_RESUME, nil, cid )
 							req = <- my_ch
 							if req.State == nil {
 								http_sheep.Baa( 1, "reservations are now resumed" )
@@ -1114,6 +2834,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 								reason = ""
 								res_paused = false
 							} else {
+								ecode = err_code( req.State )
 								reason = fmt.Sprintf( "%s", req.State )
 							}
 						}
@@ -1150,7 +2871,8 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 								res.Set_proto( tmap["proto"] )
 							}
 
-							reason, jreason, ecount = finalise_pt_res( res, res_paused )			// check for dup, ensure good ulcap, and add to res manager inventory if all ok
+							res.Set_cid( cid )
+							reason, jreason, ecount, ecode = finalise_pt_res( ctx, res, res_paused )			// check for dup, ensure good ulcap, and add to res manager inventory if all ok
 							if ecount == 0 {
 								state = "OK"
 							} else {
@@ -1163,6 +2885,59 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 							reason = fmt.Sprintf( "reservation rejected: %s", err )
 						}
 
+				case "trust":											// keep the dscp markings set by a project's vms, or a single vm
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						key_list := "window scope cookie"
+						tmap := gizmos.Mixtoks2map( tokens[1:], key_list )
+						ok, mlist := gizmos.Map_has_all( tmap, key_list )
+						if !ok {
+							reason = fmt.Sprintf( "missing parameters: (%s); usage: trust {[<start>-]<end-time>|+sec} {[token/]project/*|[token/]project/vm} cookie [proto=[{udp|tcp}:]address[:port]]; received: %s", mlist, recs[i] );
+							break
+						}
+
+						startt, endt = gizmos.Str2start_end( *tmap["window"] )
+						scope := *tmap["scope"]
+						var err error
+
+						if strings.HasSuffix( scope, "/*" ) {						// whole project; validate token/project and convert to ID
+							tp := strings.TrimSuffix( scope, "/*" )
+							req = ipc.Mk_chmsg( )
+							req.Send_req( osif_ch, my_ch, REQ_VALIDATE_TOKEN, &tp, cid )
+							req = <- my_ch
+							pid, ok := req.Response_data.( *string )
+							if req.State != nil || !ok || pid == nil {
+								reason = fmt.Sprintf( "trust reservation rejected: unable to validate project %s: %v", tp, req.State )
+								break
+							}
+							scope = strings.TrimSuffix( *pid, "/" ) + "/*"
+						} else {
+							if scope, _, _, err = validate_one_host( scope ); err != nil {
+								reason = fmt.Sprintf( "trust reservation rejected: %s", err )
+								break
+							}
+							update_graph( &scope, true, true )
+						}
+
+						res_name := mk_resname( )
+						res, err := gizmos.Mk_trust_pledge( &scope, startt, endt, &res_name, tmap["cookie"] )
+						if err != nil {
+							reason = fmt.Sprintf( "trust reservation rejected: %s", err )
+							break
+						}
+						if tmap["proto"] != nil {
+							res.Set_proto( tmap["proto"] )
+						}
+						res.Set_cid( cid )
+						set_origin( ctx, res )
+
+						reason, jreason, ecount, ecode = finalise_trust_res( res, res_paused )
+						if ecount == 0 {
+							state = "OK"
+						} else {
+							nerrors += ecount - 1
+						}
+					}
+
 			case "steer":								// parse a steering request and make it happen
 					var res *gizmos.Pledge_steer
 
@@ -1174,6 +2949,12 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 
 					tmap := gizmos.Mixtoks2map( tokens[1:], "window usrsp ep1 ep2 mblist cookie" )		// map tokens in order to these names	(not as efficient, but makes code easier to read below)
 
+					if ovn_configured( ) {
+						nerrors++
+						reason = "steering reservations are not supported by the ovn backend"
+						break
+					}
+
 					h1, h2, p1, p2, _, _, err := validate_hosts( *tmap["usrsp"] + "/" + *tmap["ep1"], *tmap["usrsp"] + "/" + *tmap["ep2"] )		// translate project/host[port] into tenantID/host and if token/project/name required validates token.
 					if err != nil {
 						reason = fmt.Sprintf( "invalid endpoints:  %s", err )
@@ -1193,7 +2974,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 					}
 
 					req := ipc.Mk_chmsg( )
-					req.Send_req( osif_ch, my_ch, REQ_VALIDATE_TOKEN, tmap["usrsp"], nil )		// validate token and convert user space to ID if name given
+					req.Send_req( osif_ch, my_ch, REQ_VALIDATE_TOKEN, tmap["usrsp"], cid )		// validate token and convert user space to ID if name given
 					req = <- my_ch
 					if req.Response_data != nil {
 						if  req.Response_data.( *string ) != nil {
@@ -1205,6 +2986,15 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						}
 					}
 
+					if err = vet_steer_tenancy( *tmap["usrsp"], h1 ); err == nil {		// endpoints must belong to the tenant (or a shared project)
+						err = vet_steer_tenancy( *tmap["usrsp"], h2 )
+					}
+					if err != nil {
+						reason = fmt.Sprintf( "steering reservation rejected: %s", err )
+						nerrors++
+						break
+					}
+
 					if tmap["proto"] != nil { // DEBUG
 						http_sheep.Baa( 1, "steering using  proto: %s", *tmap["proto"] )
 					}
@@ -1219,53 +3009,158 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						break
 					}
 
-					mbnames := strings.Split( *tmap["mblist"], "," )
-					for i := range mbnames {									// generate a mbox object for each
-						mbn := ""
-						if strings.Index( mbnames[i], "/" ) < 0 {				// add user space info out front
-							if tmap["usrsp"] != nil {
-								mbn = *tmap["usrsp"] + mbnames[i] 					// validation/translation adds a trailing /, so not needed here
-							}
-						} else {
-							mbn = mbnames[i]
+					if tmap["depends"] != nil {
+						if err = depends_access( tmap["depends"], tmap["cookie"] ); err != nil {
+							reason = fmt.Sprintf( "unable to create a steering reservation: %s", err )
+							ecode = err_code( err )
+							nerrors++
+							break
 						}
+						res.Set_depends( *tmap["depends"] )
+					}
 
-						update_graph( &mbn, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
-						req.Send_req( nw_ch, my_ch, REQ_HOSTINFO, &mbn, nil )		// get host info string (mac, ip, switch)
-						req = <- my_ch
-						if req.State != nil {
+					if tmap["meta"] != nil {
+						if err = res.Set_meta_list( *tmap["meta"] ); err != nil {
+							reason = fmt.Sprintf( "unable to create a steering reservation: %s", err )
+							ecode = ERR_BAD_REQUEST
+							nerrors++
 							break
-						} else {
-							htoks := strings.Split( req.Response_data.( string ), "," )					// results are: ip, mac, switch-id, switch-port; all strings
-							res.Add_mbox( gizmos.Mk_mbox( &mbnames[i], &htoks[1], &htoks[2], clike.Atoi( htoks[3] ) ) )
 						}
 					}
+					if err = set_name_opts( res, tmap ); err != nil {
+						reason = fmt.Sprintf( "unable to create a steering reservation: %s", err )
+						ecode = err_code( err )
+						nerrors++
+						break
+					}
 
-					if req.State == nil {											// all middle boxes were validated
-						//ip := gizmos.Pledge( res )									// must pass an interface to resmgr
-						req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, nil )			// push it into the reservation manager which will drive flow-mods etc
+					var mbs []*gizmos.Mbox
+					mbs, err = steer_mboxes( *tmap["usrsp"], *tmap["mblist"], my_ch )
+					if err == nil {												// all middle boxes were validated
+						for _, mb := range mbs {
+							res.Add_mbox( mb )
+						}
+						res.Set_cid( cid )
+						set_origin( ctx, res )
+						req.Send_req( rmgr_ch, my_ch, REQ_ADD, res, cid )			// push it into the reservation manager which will drive flow-mods etc
 						req = <- my_ch
+						err = req.State
 					} else {
-						http_sheep.Baa( 1, "unable to validate all middle boxes" )
+						http_sheep.Baa( 1, "unable to validate all middle boxes: %s", err )
 					}
 
-					if req.State == nil {
+					if err == nil {
 						ckptreq := ipc.Mk_chmsg( )								// must have new message since we don't wait on a response
-						ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )
+						ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, cid )
 						state = "OK"
-						reason = fmt.Sprintf( "steering reservation accepted; reservation has %d middleboxes", len( mbnames ) )
+						reason = fmt.Sprintf( "steering reservation accepted; reservation has %d middleboxes", len( mbs ) )
 						jreason =  res.To_json()
 					} else {
 						nerrors++
-						reason = fmt.Sprintf( "%s", req.State )
+						ecode = err_code( err )
+						reason = fmt.Sprintf( "%s", err )
 					}
 					http_sheep.Baa( 1, "steering reservation %s; errors: %s", state, reason )
 
+				case "chain":									// service chain: steering through middleboxes plus bandwidth for each leg (http_chain.go)
+					key_list := "bandw window usrsp ep1 ep2 mblist cookie dscp"
+					tmap := gizmos.Mixtoks2map( tokens[1:], key_list )
+					ok, mlist := gizmos.Map_has_all( tmap, key_list )
+					if !ok {
+						reason = fmt.Sprintf( "missing parameters: (%s); usage: chain [proto=p] [template=name] <bandwidth[K|M|G]>[,<outbandw>] {[<start>-]<end-time>|+sec} [token/]tenant ep1 ep2 mb1[,mb2...] cookie dscp; received: %s", mlist, recs[i] )
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					reason, jreason, ecount, ecode = mk_chain( ctx, tmap, cid, res_paused )
+					if ecount == 0 {
+						state = "OK"
+					}
+
+				case "bulk":									// bulk transfer: bytes to move by a deadline (http_bulk.go)
+					key_list := "size window hosts cookie dscp"
+					tmap := gizmos.Mixtoks2map( tokens[1:], key_list )
+					ok, mlist := gizmos.Map_has_all( tmap, key_list )
+					if !ok {
+						reason = fmt.Sprintf( "missing parameters: (%s); usage: bulk [proto=p] <size[K|M|G]> {[<start>-]<deadline>|+sec} <host1>,<host2> cookie dscp; received: %s", mlist, recs[i] )
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					reason, jreason, ecount, ecode = mk_bulk( ctx, tmap, cid, res_paused )
+					if ecount == 0 {
+						state = "OK"
+					}
+
+				case "cancelchain":								// cancelchain chain-id [cookie]; as DELETE chain for proxies which drop a DELETE body
+					if ntokens < 2 {
+						reason = "missing chain id; usage: cancelchain chain-id [cookie]"
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					cr := &chain_req{ op: "delete", id: tokens[1] }
+					if ntokens > 2 {
+						cr.cookie = &tokens[2]
+					}
+					rdata, err := chain_send( cr, cid )
+					if err == nil {
+						state = "OK"
+						reason = fmt.Sprintf( "service chain was cancelled (deleted): %s", tokens[1] )
+						if when, _ := rdata.( int64 ); when > 0 {
+							reason = fmt.Sprintf( "service chain will be cancelled at %d unless its steering reservation is undeleted", when )
+						}
+					} else {
+						ecode = err_code( err )
+						reason = fmt.Sprintf( "%s", err )
+					}
+
+				case "chainstatus":								// chainstatus chain-id [cookie]
+					if ntokens < 2 {
+						reason = "missing chain id; usage: chainstatus chain-id [cookie]"
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					cr := &chain_req{ op: "status", id: tokens[1] }
+					if ntokens > 2 {
+						cr.cookie = &tokens[2]
+					}
+					rdata, err := chain_send( cr, cid )
+					if err == nil {
+						state = "OK"
+						jreason = rdata.( string )
+						reason = ""
+					} else {
+						ecode = err_code( err )
+						reason = fmt.Sprintf( "%s", err )
+					}
+
+				case "chainextend":								// chainextend chain-id {end-time|+sec} [cookie]
+					if ntokens < 3 {
+						reason = "missing parameters; usage: chainextend chain-id {end-time|+sec} [cookie]"
+						ecode = ERR_BAD_REQUEST
+						break
+					}
+
+					_, expiry := gizmos.Str2start_end( tokens[2] )
+					cr := &chain_req{ op: "extend", id: tokens[1], expiry: expiry }
+					if ntokens > 3 {
+						cr.cookie = &tokens[3]
+					}
+					if _, err := chain_send( cr, cid ); err == nil {
+						state = "OK"
+						reason = fmt.Sprintf( "service chain %s extended to %d", tokens[1], expiry )
+					} else {
+						ecode = err_code( err )
+						reason = fmt.Sprintf( "%s", err )
+					}
+
 				case "setulcap":									// set a user link cap; expect user-name limit
 					if validate_auth( &auth_data, is_token, admin_roles ) {
 						if ntokens == 3 {
 							req = ipc.Mk_chmsg( )
-							req.Send_req( osif_ch, my_ch, REQ_PNAME2ID, &tokens[1], nil )		// translate the name to virtulisation assigned ID
+							req.Send_req( osif_ch, my_ch, REQ_PNAME2ID, &tokens[1], cid )		// translate the name to virtulisation assigned ID
 							req = <- my_ch
 
 							pdata := make( []*string, 2 )
@@ -1274,7 +3169,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 								pdata[1] = &tokens[2]
 
 								reason = fmt.Sprintf( "user link cap set for %s (%s): %s", tokens[1], *pdata[0], tokens[2] )
-								req.Send_req( rmgr_ch, nil, REQ_SETULCAP, pdata, nil ) 				// dont wait for a reply
+								req.Send_req( rmgr_ch, nil, REQ_SETULCAP, pdata, cid ) 				// dont wait for a reply
 								state = "OK"
 							} else {
 								reason = fmt.Sprintf( "unable to translate name: %s", tokens[1] )
@@ -1286,11 +3181,68 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						}
 					}
 
+				case "intermedq":											// intermedq [host...]; set intermediate queues now on the hosts (all if none given)
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						hosts := ""
+						if ntokens > 1 {
+							hosts = strings.Join( tokens[1:], " " )
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( am_ch, my_ch, REQ_INTERMEDQ, &hosts, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							reason = fmt.Sprintf( "intermediate queue setup sent for: %s", req.Response_data.( string ) )
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "pridscp":												// pridscp [value...]; new priority dscp list, or reread it from the config when none given
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						list := ""
+						if ntokens > 1 {
+							list = strings.Join( tokens[1:], " " )
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( am_ch, my_ch, REQ_SET_PRIDSCP, &list, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							reason = fmt.Sprintf( "priority dscp list is: %s", req.Response_data.( string ) )
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
+				case "remark":												// remark [bridge:dscp...|off]; default remark policy, or reread it from the config when none given
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						list := ""
+						if ntokens > 1 {
+							list = strings.Join( tokens[1:], " " )
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( am_ch, my_ch, REQ_SET_REMARK, &list, cid )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							reason = fmt.Sprintf( "remark policy is: %s", req.Response_data.( string ) )
+						} else {
+							ecode = err_code( req.State )
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
 				case "setdiscount":
 					if validate_auth( &auth_data, is_token, admin_roles ) {
 						if ntokens == 2 {						// expect discount amount or percentage
 							req = ipc.Mk_chmsg( )
-							req.Send_req( nw_ch, nil, REQ_SETDISC, &tokens[1], nil )		// set the discount value
+							req.Send_req( nw_ch, nil, REQ_SETDISC, &tokens[1], cid )		// set the discount value
 							reason = fmt.Sprintf( "discount amount set to %s", tokens[1] )
 							state = "OK"
 						} else {
@@ -1364,7 +3316,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 
 				default:
 					reason = fmt.Sprintf( "unrecognised put and/or post action: request %d, %s: whole req=(%s)", i, tokens[0], recs[i] )
-					http_sheep.Baa( 1, "unrecognised action: %s in %s", tokens[0], recs[i] )
+					http_sheep.Baa( 1, "unrecognised action: %s in %s", tokens[0], gizmos.Redact_tokens( recs[i] ) )
 			}
 		} else {
 			reason = fmt.Sprintf( "tegu is running, but is not accepting requests; try again later" )
@@ -1372,12 +3324,25 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 
 		if state == "ERROR" {
 			nerrors++
+			if ecode == "" {
+				ecode = ERR_UNTYPED
+				if reason == unauth {
+					ecode = ERR_NOT_AUTHORISED
+				}
+			}
+			if fcode == "" {
+				fcode = ecode
+			}
+		} else {
+			ecode = ""
+			nok++
 		}
 
+		http_sheep.Baa( 2, "request %d finished: %s cid=%s", req_count, state, cid )
 		if jreason != "" {
-			fmt.Fprintf( out, `%s{ "status": %q, "request": %d, "comment": %q, "details": %s }`, sep, state, req_count, reason, jreason )
+			fmt.Fprintf( out, `%s{ "status": %q, "request": %d, "cid": %q, "code": %q, "comment": %q, "details": %s }`, sep, state, req_count, cid, ecode, reason, jreason )
 		} else {
-			fmt.Fprintf( out, `%s{ "status": %q, "request": %d, "comment": %q }`, sep, state, req_count, reason )
+			fmt.Fprintf( out, `%s{ "status": %q, "request": %d, "cid": %q, "code": %q, "comment": %q }`, sep, state, req_count, cid, ecode, reason )
 		}
 
 		sep = ","		// after the first the separator is now a comma
@@ -1392,16 +3357,20 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 	if req_count <= 0 {
 		msg = fmt.Sprintf( "no requests found in input" )
 		state = "ERROR"
+		code = ERR_BAD_REQUEST
 	} else {
 		msg = fmt.Sprintf( "%d errors processing requests", nerrors )
+		if nok == 0 {
+			code = fcode			// all failed; the first failure sets the http status
+		}
 	}
 
 	return
 }
 
-func parse_put( out http.ResponseWriter, recs []string, sender string, xauth string ) (state string, msg string) {
+func parse_put( ctx context.Context, out http.ResponseWriter, recs []string, sender string, xauth string ) (state string, msg string, code string) {
 
-	state, msg = parse_post( out, recs, sender, xauth )
+	state, msg, code = parse_post( ctx, out, recs, sender, xauth )
 	return
 }
 
@@ -1412,9 +3381,11 @@ func parse_put( out http.ResponseWriter, recs []string, sender string, xauth str
 	Tokens are the tokens from the request. token[0] is assumed to be the request name and is ignored
 	as it could be different depending on the source of the call (POST vs DELETE).
 
-	err will be nil on success.
+	err will be nil on success. When res-mgr has a delete grace period, when is the time that
+	the reservation will actually be deleted; it is 0 if deleted now. Cid is the correlation
+	id of the request which is passed on to res-mgr.
 */
-func delete_reservation( tokens []string ) ( err error ) {
+func delete_reservation( tokens []string, cid string ) ( when int64, err error ) {
 
 	var (
 		my_ch		chan *ipc.Chmsg
@@ -1437,13 +3408,14 @@ func delete_reservation( tokens []string ) ( err error ) {
 		}
 
 		req := ipc.Mk_chmsg( )
-		req.Send_req( rmgr_ch, my_ch, REQ_DEL, del_data, nil )	// delete from the resmgr point of view		// res mgr sends delete on to network mgr (2014.07.07)
+		req.Send_req( rmgr_ch, my_ch, REQ_DEL, del_data, cid )	// delete from the resmgr point of view		// res mgr sends delete on to network mgr (2014.07.07)
 		req = <- my_ch										// wait for delete response
 
 		if req.State == nil {
 			err = nil
+			when, _ = req.Response_data.( int64 )
 			ckptreq := ipc.Mk_chmsg( )								// request checkpoint but no need to wait on it
-			ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )
+			ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, cid )
 		} else {
 			err = req.State
 		}
@@ -1452,18 +3424,111 @@ func delete_reservation( tokens []string ) ( err error ) {
 	return
 }
 
+/*
+	Undo a delete that is pending (delete grace period). Tokens are: undelete res-id [cookie].
+	Cid is the correlation id of the request.
+*/
+func undelete_reservation( tokens []string, cid string ) ( err error ) {
+	if len( tokens ) < 2 || len( tokens ) > 3 {
+		return mk_err( ERR_BAD_REQUEST, "bad undelete command: wanted 'undelete res-ID [cookie]' received %d tokens", len( tokens ) - 1 )
+	}
+
+	cookie := &empty_str
+	if len( tokens ) > 2 {
+		cookie = &tokens[2]
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_UNDELETE, []*string{ &tokens[1], cookie }, cid )
+	req = <- my_ch
+	return req.State
+}
+
+/*
+	Delete all reservations, that the cookie allows, within a scope. Tokens are as for
+	delete_reservation() with token[1] "all"; following it are the optional cookie and
+	any of:
+		host=name			reservations with the host (name or address; project is not needed)
+		project=name		reservations with a host in the project
+		window=[start-]end	reservations active at any time in the window (same form as reserve)
+		dryrun				list, but don't delete
+
+	The comment and json details (list of reservation ids) are returned along with an error
+	if the request was bad. Cid is the correlation id of the request.
+*/
+func delete_all( tokens []string, cid string ) ( comment string, jdetails string, err error ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	scope := &del_scope{ cookie: &empty_str }
+	have_cookie := false
+	for _, tok := range tokens[2:] {
+		kv := strings.SplitN( tok, "=", 2 )
+		switch {
+			case tok == "dryrun":
+				scope.dryrun = true
+
+			case len( kv ) == 1 && ! have_cookie:
+				scope.cookie = &kv[0]
+				have_cookie = true
+
+			case len( kv ) < 2 || kv[1] == "":
+				return "", "", mk_err( ERR_BAD_REQUEST, "bad delete all option: %s", tok )
+
+			case kv[0] == "host":
+				scope.host = kv[1]
+
+			case kv[0] == "project":
+				scope.project = proj2id( kv[1], my_ch )
+
+			case kv[0] == "window":
+				scope.start, scope.end = gizmos.Str2start_end( kv[1] )
+
+			default:
+				return "", "", mk_err( ERR_BAD_REQUEST, "unknown delete all option: %s: expected host=, project=, window= or dryrun", kv[0] )
+		}
+	}
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_DELALL, scope, cid )
+	req = <- my_ch
+
+	ids, _ := req.Response_data.( []string )
+	sep := ""
+	jdetails = "[ "
+	for _, id := range ids {
+		jdetails += fmt.Sprintf( "%s%q", sep, id )
+		sep = ", "
+	}
+	jdetails += " ]"
+
+	if scope.dryrun {
+		comment = fmt.Sprintf( "%d reservations would be deleted", len( ids ) )
+	} else {
+		comment = fmt.Sprintf( "%d reservations deleted", len( ids ) )
+		ckptreq := ipc.Mk_chmsg( )
+		ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, cid )
+	}
+
+	return
+}
+
 /*
 	Delete something. Currently only reservation is supported, but there might be other
 	things in future to delete, so we require a token 0 that indicates what.
 
 	Supported delete actions:
 		reservation <name> [<cookie>]
+		reservation all [<cookie>] [host=name] [project=name] [window=[start-]end] [dryrun]
 
 	Seems that some HTTP clients cannot send, or refuse to send, a body on a DELETE making deletes
 	impossible from those environments.  So this is just a wrapper that invokes yet another layer
 	to actually process the request. Gotta love REST.
 */
-func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth string ) ( state string, msg string ) {
+func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth string ) ( state string, msg string, code string ) {
 	var (
 		sep			string = ""							// json output list separator
 		req_count	int = 0								// requests processed this batch
@@ -1472,12 +3537,14 @@ func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth
 		nerrors		int = 0								// overall error count -- final status is error if non-zero
 		jdetails	string = ""							// result details in json
 		comment		string = ""							// comment about the state
+		ecode		string								// error code of the current request (tegu_err.go)
+		fcode		string								// code of the first failed request
 	)
 
 	fmt.Fprintf( out,  "\"reqstate\":[ " )				// wrap request output into an array
 	state = "OK"
 	for i := 0; i < len( recs ); i++ {
-		http_sheep.Baa( 3, "delete received buffer (%s)", recs[i] )
+		http_sheep.Baa( 3, "delete received buffer (%s)", gizmos.Redact_tokens( recs[i] ) )
 
 		ntokens, tokens = token.Tokenise_qpopulated( recs[i], " " )		// split and keep populated tokens (treats successive sep chrs as one), preserves spaces in "s
 
@@ -1486,31 +3553,79 @@ func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth
 		}
 
 		req_count++
+		cid := mk_cid( )
 		state = "ERROR"
 		jdetails = ""
+		ecode = ""
 
-		http_sheep.Baa( 2, "parse_delete for %s", tokens[0] )
+		http_sheep.Baa( 2, "parse_delete for %s cid=%s", tokens[0], cid )
 		switch tokens[0] {
 			case "reservation":									// expect:  reservation name(id) [cookie]
-				err := delete_reservation( tokens )
+				if ntokens > 1 && tokens[1] == "all" {				// reservation all [cookie] [scope...] [dryrun]
+					var err error
+					comment, jdetails, err = delete_all( tokens, cid )
+					if err == nil {
+						state = "OK"
+					} else {
+						nerrors++
+						ecode = err_code( err )
+						comment = fmt.Sprintf( "reservation delete failed: %s", err )
+					}
+					break
+				}
+
+				when, err := delete_reservation( tokens, cid )
 				if err == nil {
 					comment = "reservation successfully deleted"
+					if when > 0 {
+						comment = fmt.Sprintf( "reservation will be deleted at %d unless undeleted", when )
+					}
 					state = "OK"
 				} else {
 					nerrors++
+					ecode = err_code( err )
 					comment = fmt.Sprintf( "reservation delete failed: %s", err )
 				}
 
+			case "chain":										// expect: chain chain-id [cookie]; the steering reservation and its legs
+				if ntokens < 2 || ntokens > 3 {
+					nerrors++
+					ecode = ERR_BAD_REQUEST
+					comment = fmt.Sprintf( "bad delete chain command: wanted 'chain chain-id [cookie]' received %d tokens", ntokens - 1 )
+					break
+				}
+
+				cr := &chain_req{ op: "delete", id: tokens[1] }
+				if ntokens > 2 {
+					cr.cookie = &tokens[2]
+				}
+				rdata, err := chain_send( cr, cid )
+				if err == nil {
+					comment = "service chain successfully deleted"
+					if when, _ := rdata.( int64 ); when > 0 {
+						comment = fmt.Sprintf( "service chain will be deleted at %d unless its steering reservation is undeleted", when )
+					}
+					state = "OK"
+				} else {
+					nerrors++
+					ecode = err_code( err )
+					comment = fmt.Sprintf( "service chain delete failed: %s", err )
+				}
+
 			default:
 				nerrors++
+				ecode = ERR_BAD_REQUEST
 				comment = fmt.Sprintf( "unknown delete command: %s", tokens[0] )
 
 		}
 
+		if fcode == "" {
+			fcode = ecode
+		}
 		if jdetails != "" {
-			fmt.Fprintf( out, "%s{ \"status\": \"%s\", \"request\": \"%d\", \"comment\": \"%s\", \"details\": %s }", sep, state, req_count, comment, jdetails )
+			fmt.Fprintf( out, "%s{ \"status\": \"%s\", \"request\": \"%d\", \"cid\": \"%s\", \"code\": \"%s\", \"comment\": \"%s\", \"details\": %s }", sep, state, req_count, cid, ecode, comment, jdetails )
 		} else {
-			fmt.Fprintf( out, "%s{ \"status\": \"%s\", \"request\": \"%d\", \"comment\": \"%s\" }", sep, state, req_count, comment )
+			fmt.Fprintf( out, "%s{ \"status\": \"%s\", \"request\": \"%d\", \"cid\": \"%s\", \"code\": \"%s\", \"comment\": \"%s\" }", sep, state, req_count, cid, ecode, comment )
 		}
 
 		sep = ","
@@ -1525,13 +3640,30 @@ func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth
 	if req_count <= 0 {
 		msg = fmt.Sprintf( "no requests found in input" )
 		state = "ERROR"
+		code = ERR_BAD_REQUEST
 	} else {
 		msg = fmt.Sprintf( "%d errors processing requests in %d requests", nerrors, req_count )
+		if nerrors == req_count {
+			code = fcode
+		}
 	}
 
 	return
 }
 
+/*
+	Response writer which holds the output so that the status can be set once all of
+	the requests have been processed.
+*/
+type buf_writer struct {
+	http.ResponseWriter
+	buf	bytes.Buffer
+}
+
+func (bw *buf_writer) Write( b []byte ) ( int, error ) {
+	return bw.buf.Write( b )
+}
+
 /*
 	Deal with input from the other side sent to tegu/api. See http_mirror_api.go for
 	the mirror api handler and related functions.
@@ -1548,20 +3680,28 @@ func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth
 	Output to the client process is a bunch of {...} "objects", one per record,
 	plus a final overall status; all are collected in square brackets and thus
 	should be parsable as json.
+
+	The output is held until the parser finishes so that the http status can be set. When
+	every request failed the status is based on the error code of the first; otherwise
+	it's 200 and the client must look at each request's status and code.
 */
-func api_deal_with( out http.ResponseWriter, in *http.Request ) {
+func api_deal_with( rout http.ResponseWriter, in *http.Request ) {
 	var (
 		data 	[]byte
 		recs	[]string
 		state	string
 		msg		string
+		code	string
 	)
 
+	out := &buf_writer{ ResponseWriter: rout }
+
 	if in.Method != "GET" {
 		data = dig_data( in )
 		if( data == nil ) {						// missing data -- punt early
 			http_sheep.Baa( 1, "http: api_deal_with called without data: %s", in.Method )
-			fmt.Fprintf( out, `{ "status": "ERROR", "comment": "missing command" }` )	// error stuff back to user
+			rout.WriteHeader( err_status( ERR_BAD_REQUEST ) )
+			fmt.Fprintf( rout, `{ "status": "ERROR", "code": %q, "comment": "missing command" }`, ERR_BAD_REQUEST )	// error stuff back to user
 			return
 		} else {
 			_, recs = token.Tokenise_drop( string( data ), ";\n" )		// split based on ; or newline
@@ -1573,19 +3713,20 @@ func api_deal_with( out http.ResponseWriter, in *http.Request ) {
 	if in.Header != nil && in.Header["X-Auth-Tegu"] != nil {
 		auth = in.Header["X-Auth-Tegu"][0]
 	}
+	ctx := with_origin( in )								// request context carrying where the request came from
 
 	switch in.Method {
 		case "PUT":
-			state, msg = parse_put( out, recs, in.RemoteAddr, auth )
+			state, msg, code = parse_put( ctx, out, recs, in.RemoteAddr, auth )
 
 		case "POST":
-			state, msg = parse_post( out, recs, in.RemoteAddr, auth )
+			state, msg, code = parse_post( ctx, out, recs, in.RemoteAddr, auth )
 
 		case "DELETE":
-			state, msg = parse_delete( out, recs, in.RemoteAddr, auth )
+			state, msg, code = parse_delete( out, recs, in.RemoteAddr, auth )
 
 		case "GET":				// used for file transfer, so we must handle the return here and not let it go out the bottom
-			state, msg = parse_get( out, in.RequestURI, in.RemoteAddr, auth )
+			state, msg = parse_get( rout, in.RequestURI, in.RemoteAddr, auth )
 			http_sheep.Baa( 1, "get processing finished: %s, %s", state, msg )
 			return
 
@@ -1593,9 +3734,12 @@ func api_deal_with( out http.ResponseWriter, in *http.Request ) {
 			http_sheep.Baa( 1, "api_deal_with called for unrecognised method: %s", in.Method )
 			state = "ERROR"
 			msg = fmt.Sprintf( "unrecognised method: %s", in.Method )
+			code = ERR_BAD_REQUEST
 	}
 
-	fmt.Fprintf( out, fmt.Sprintf( ` "endstate": { "status": %q, "comment": %q } }`, state, msg ) )		// final, overall status and close bracket
+	fmt.Fprintf( out, ` "endstate": { "status": %q, "code": %q, "comment": %q } }`, state, code, msg )		// final, overall status and close bracket
+	rout.WriteHeader( err_status( code ) )
+	rout.Write( out.buf.Bytes() )
 
 }
 
@@ -1681,6 +3825,10 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 		if p != nil {
 			sysproc_roles = p
 		}
+
+		if p = cfg_data["httpmgr"]["steer_shared"]; p != nil {			// projects (e.g. a service provider's) whose VMs any tenant may steer through
+			steer_shared = strings.Fields( *p )
+		}
 	}
 
 	enable_mirroring := false										// off if section is missing all together
@@ -1696,6 +3844,12 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 		}
 	}
 
+	dtoken_init( cfg_data["httpmgr"]["dtoken_file"], cfg_data["httpmgr"]["dtoken_max_life"] )		// nil section yields nil values
+
+	if cfg_data["httpmgr"] != nil {
+		policy_init( cfg_data["httpmgr"]["policy_url"], cfg_data["httpmgr"]["policy_timeout"], cfg_data["httpmgr"]["policy_fail"] )
+	}
+
 	sp_str = *sysproc_roles + "," + *admin_roles					// add admin roles to sysproc and mirror role lists
 	sysproc_roles = &sp_str
 	mr_str = *mirror_roles + "," + *admin_roles
@@ -1709,6 +3863,14 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 	http.HandleFunc( "/tegu/bandwidth", api_deal_with )				// define bandwidth callback TODO: add a callback specifically for bandwidth things
 
 	http.HandleFunc( "/tegu/fetch/", api_deal_with )		
+	http.HandleFunc( "/tegu/batch", batch_handler )					// json list of reservations (http_batch.go)
+
+	if cfg_data["httpmgr"] != nil {
+		if p := cfg_data["httpmgr"]["pprof"]; p != nil && (*p == "true" || *p == "yes") {
+			http.HandleFunc( "/tegu/debug/pprof/", pprof_handler )		// admin only (http_pprof.go)
+			http_sheep.Baa( 1, "pprof URLs are ENABLED for admin roles" )
+		}
+	}
 
 	if enable_mirroring {
 		http.HandleFunc( "/tegu/mirrors/", mirror_handler )
@@ -0,0 +1,99 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	A steering endpoint or middlebox must belong to the tenant or to a shared project; external
+	endpoints aren't checked. Osif is played by a goroutine which translates project names
+	and counts the translations; the host's project must be translated only once however many
+	shared projects there are.
+*/
+func TestHttp_steer_tenancy( t *testing.T ) {
+	http_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	ids := map[string]string{ "proj1": "pid1", "proj2": "pid2", "svc": "pid_svc", "other": "pid_other" }
+	var nxlate int32
+	old_osif := osif_ch
+	och := make( chan *ipc.Chmsg, 4 )
+	osif_ch = och
+	defer func() { osif_ch = old_osif }()
+	go func() {
+		for req := range och {
+			atomic.AddInt32( &nxlate, 1 )
+			req.Response_data = nil
+			if id, ok := ids[*(req.Req_data.( *string ))]; ok {
+				req.Response_data = &id
+			}
+			req.State = nil
+			req.Response_ch <- req
+		}
+	}()
+	defer close( och )
+
+	old_shared := steer_shared
+	steer_shared = []string{ "other", "svc", "pid_nosuch" }
+	defer func() { steer_shared = old_shared }()
+
+	cases := []struct {
+		what	string
+		tenant	string
+		hname	string
+		ok		bool
+		nxlate	int32						// project translations expected
+	} {
+		{ "own project", "proj1", "pid1/vm1", true, 2 },
+		{ "own project by name", "token/proj1/", "proj1/vm1:80", true, 2 },
+		{ "shared project", "proj1", "pid_svc/fw1", true, 4 },
+		{ "another tenant", "proj1", "pid2/vm2", false, 5 },
+		{ "external endpoint", "proj1", "!10.1.1.1", true, 0 },
+		{ "no project", "proj1", "vm1", false, 0 },
+	}
+	for _, c := range cases {
+		atomic.StoreInt32( &nxlate, 0 )
+		err := vet_steer_tenancy( c.tenant, c.hname )
+		if (err == nil) != c.ok {
+			fmt.Fprintf( os.Stderr, "[FAIL] %s: %s for tenant %s: expected ok=%v, got %v\n", c.what, c.hname, c.tenant, c.ok, err )
+			errs++
+		}
+		if n := atomic.LoadInt32( &nxlate ); n != c.nxlate {
+			fmt.Fprintf( os.Stderr, "[FAIL] %s: expected %d project translations, got %d\n", c.what, c.nxlate, n )
+			errs++
+		}
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   steering tenancy allows only the tenant's and shared projects\n" )
+	} else {
+		t.Fail()
+	}
+}
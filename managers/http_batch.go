@@ -0,0 +1,365 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	http_batch
+	Abstract:	Batch submission of bandwidth reservations. A POST to /tegu/batch has a json
+				body with a list of reservations, each with the parameters of a reserve request:
+
+					{ "cookie": "default-cookie", "reservations": [
+						{ "bandwidth": "10M[,5M]", "window": "[start-]end|+sec", "hosts": "[token/]proj/vm1-proj/vm2",
+						  "cookie": "c", "dscp": "voice", "proto": "tcp::80", "ipv6": false,
+						  "depends": "res-id", "meta": "k:v,...", "name": "n", "desc": "d" },
+						...
+					] }
+
+				The reservations are handled in one pass rather than as separate requests: the
+				information for each distinct host is fetched once, and those that the network
+				finds a path for are added to the inventory with one request to res-mgr (which
+				rejects duplicates, including one earlier in the same batch) followed by a single
+				checkpoint. Each reservation is accepted or rejected on its own. The response
+				has the reqstate list, one entry per reservation in the order given, and the
+				endstate object as a /tegu/api response does.
+
+				Label selectors and replace= are not supported in a batch.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Project tier defaults and ceiling are applied.
+				16 Oct 2026 - Reservations go through the network provider.
+				16 Oct 2026 - Reservations carry the origin of the request.
+				16 Oct 2026 - Each network request carries the entry's correlation id.
+*/
+
+package managers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	MAX_BATCH	int = 500						// reservations allowed in one batch
+)
+
+/*
+	One reservation in the request body.
+*/
+type batch_res struct {
+	Bandwidth	string	`json:"bandwidth"`
+	Window		string	`json:"window"`
+	Hosts		string	`json:"hosts"`
+	Cookie		string	`json:"cookie"`
+	Dscp		string	`json:"dscp"`
+	Proto		string	`json:"proto"`
+	Ipv6		bool	`json:"ipv6"`
+	Depends		string	`json:"depends"`
+	Meta		string	`json:"meta"`
+	Name		string	`json:"name"`
+	Desc		string	`json:"desc"`
+}
+
+type batch_body struct {
+	Cookie			string		`json:"cookie"`				// used when a reservation has none
+	Reservations	[]batch_res	`json:"reservations"`
+}
+
+/*
+	Tracks a reservation through the batch. Reason is set as soon as it is rejected.
+*/
+type batch_ent struct {
+	res		*gizmos.Pledge_bw
+	cid		string
+	h1		string
+	h2		string
+	reason	string
+	code	string
+}
+
+/*
+	Build the pledge for one reservation in the batch. The hosts are validated, but their
+	information is not yet fetched.
+*/
+func mk_batch_pledge( br *batch_res, def_cookie string ) ( res *gizmos.Pledge_bw, h1 string, h2 string, err error ) {
+	var (
+		p1, p2, v1, v2 *string
+	)
+
+	if br.Cookie == "" {
+		br.Cookie = def_cookie
+	}
+	if br.Bandwidth == "" || br.Window == "" || br.Hosts == "" || br.Cookie == "" {
+		return nil, "", "", mk_err( ERR_BAD_REQUEST, "bandwidth, window, hosts and cookie must be given" )
+	}
+
+	var bandw_in, bandw_out int64
+	if strings.Index( br.Bandwidth, "," ) >= 0 {
+		subtokens := strings.Split( br.Bandwidth, "," )
+		bandw_in = int64( clike.Atof( subtokens[0] ) )
+		bandw_out = int64( clike.Atof( subtokens[1] ) )
+	} else {
+		bandw_in = int64( clike.Atof( br.Bandwidth ) )
+		bandw_out = bandw_in
+	}
+
+	dscp := tclass2dscp["voice"]
+	dscp_koe := false
+	if br.Dscp != "" && br.Dscp != "0" {
+		if strings.HasPrefix( br.Dscp, "global_" ) {
+			dscp_koe = true
+			dscp = tclass2dscp[br.Dscp[7:]]
+		} else {
+			dscp = tclass2dscp[br.Dscp]
+		}
+		if dscp <= 0 {
+			return nil, "", "", mk_err( ERR_BAD_REQUEST, "traffic classifcation string is not valid: %s", br.Dscp )
+		}
+	}
+
+	h1, h2 = gizmos.Str2host1_host2( br.Hosts )
+	if is_selector( h1 ) || is_selector( h2 ) {
+		return nil, "", "", mk_err( ERR_BAD_REQUEST, "label selectors are not supported in a batch: %s", br.Hosts )
+	}
+	if h1, h2, p1, p2, v1, v2, err = validate_hosts( h1, h2 ); err != nil {
+		return nil, "", "", err
+	}
+	tier := project_tier( hosts_project( h1, h2 ) )				// project default class and bandwidth ceiling (res_mgr_tiers)
+	tier.apply( br.Dscp != "" && br.Dscp != "0", &dscp, &dscp_koe, &bandw_in, &bandw_out )
+
+	startt, endt := gizmos.Str2start_end( br.Window )
+	res_name := mk_resname( )
+	if res, err = gizmos.Mk_bw_pledge( &h1, &h2, p1, p2, startt, endt, bandw_in, bandw_out, &res_name, &br.Cookie, dscp, dscp_koe ); err != nil {
+		return nil, "", "", err
+	}
+
+	if br.Proto != "" {
+		res.Add_proto( &br.Proto )
+	}
+	res.Set_vlan( v1, v2 )
+	res.Set_matchv6( br.Ipv6 )
+
+	if br.Depends != "" {
+		if err = depends_access( &br.Depends, &br.Cookie ); err != nil {
+			return nil, "", "", err
+		}
+		res.Set_depends( br.Depends )
+	}
+	if br.Meta != "" {
+		if err = res.Set_meta_list( br.Meta ); err != nil {
+			return nil, "", "", mk_err( ERR_BAD_REQUEST, "%s", err )
+		}
+	}
+	if br.Name != "" || br.Desc != "" {
+		if err = res.Set_name( br.Name, br.Desc ); err != nil {
+			return nil, "", "", mk_err( ERR_BAD_REQUEST, "%s", err )
+		}
+	}
+
+	return res, h1, h2, nil
+}
+
+/*
+	Process the reservations in the batch; the returned list has an entry for each.
+*/
+func run_batch( ctx context.Context, body *batch_body ) ( ents []*batch_ent ) {
+	ents = make( []*batch_ent, len( body.Reservations ) )
+	hosts := make( []string, 0, len( body.Reservations ) * 2 )
+	seen := make( map[string]bool )
+
+	for i := range body.Reservations {
+		e := &batch_ent{ cid: mk_cid( ) }
+		ents[i] = e
+
+		res, h1, h2, err := mk_batch_pledge( &body.Reservations[i], body.Cookie )
+		if err != nil {
+			e.code = err_code( err )
+			e.reason = fmt.Sprintf( "reservation rejected: %s", err )
+			continue
+		}
+
+		res.Set_cid( e.cid )
+		set_origin( ctx, res )
+		e.res = res
+		for _, h := range []string{ h1, h2 } {
+			if ! seen[h] {
+				seen[h] = true
+				hosts = append( hosts, h )
+			}
+		}
+	}
+
+	for i := range hosts {											// once per host; the last blocks until all are in the graph
+		last := i == len( hosts ) - 1
+		update_graph( &hosts[i], last, last )
+	}
+
+	nctx, cancel := nw_ctx( ctx, "" )								// each entry adds its own correlation id
+	defer cancel( )
+
+	plist := make( []gizmos.Pledge, 0, len( ents ) )
+	pents := make( []*batch_ent, 0, len( ents ) )
+	for _, e := range ents {
+		if e.res == nil {
+			continue
+		}
+
+		if err := policy_check_bw( e.res ); err != nil {
+			e.code = ERR_NOT_AUTHORISED
+			e.reason = fmt.Sprintf( "reservation %s", err )
+			continue
+		}
+		if pid := consent_needed( e.res.Get_hosts() ); pid != "" {
+			e.res.Set_consent( pid )
+			e.res.Set_awaiting_approval( true )
+		}
+
+		req := net_prov.Send( context.WithValue( nctx, cid_key{ }, e.cid ), REQ_BW_RESERVE, e.res, release_late( e.res ) )
+		if req.Response_data == nil {
+			e.code = err_code( req.State )
+			e.reason = fmt.Sprintf( "reservation rejected: %s", req.State )
+			continue
+		}
+		e.res.Set_path_list( req.Response_data.( []*gizmos.Path ) )
+
+		plist = append( plist, e.res )
+		pents = append( pents, e )
+	}
+
+	if len( plist ) == 0 {
+		return
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_ADD_BATCH, plist, nil )
+	req = <- my_ch
+	errs, _ := req.Response_data.( []error )
+
+	nadded := 0
+	for i, e := range pents {
+		var err error = req.State
+		if err == nil && i < len( errs ) {
+			err = errs[i]
+		}
+		if err != nil {
+			e.code = err_code( err )
+			e.reason = fmt.Sprintf( "reservation rejected: %s", err )
+			continue
+		}
+
+		nadded++
+		http_sheep.Baa( 1, "reservation %s accepted (batch) cid=%s", *e.res.Get_id(), e.cid )
+		if res_paused {
+			e.res.Pause( false )
+			e.res.Set_pushed( )
+		}
+	}
+
+	if nadded > 0 {
+		ckptreq := ipc.Mk_chmsg( )
+		ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )		// one checkpoint for the lot
+	}
+
+	return
+}
+
+/*
+	Handler for /tegu/batch. Output is the same form as api_deal_with() generates.
+*/
+func batch_handler( out http.ResponseWriter, in *http.Request ) {
+	var (
+		body	batch_body
+		code	string
+		msg		string
+	)
+
+	state := "ERROR"
+	bout := bytes.NewBufferString( `{ "reqstate": [ ` )
+	switch {
+		case in.Method != "POST":
+			code = ERR_BAD_REQUEST
+			msg = fmt.Sprintf( "batch requests must be sent with POST" )
+
+		case ! accept_requests:
+			code = ERR_UNTYPED
+			msg = fmt.Sprintf( "tegu is running, but is not accepting requests; try again later" )
+
+		default:
+			data := dig_data( in )
+			if data == nil {
+				code = ERR_BAD_REQUEST
+				msg = "missing batch"
+				break
+			}
+			if err := json.Unmarshal( data, &body ); err != nil {
+				code = ERR_BAD_REQUEST
+				msg = fmt.Sprintf( "batch could not be parsed: %s", err )
+				break
+			}
+			if len( body.Reservations ) == 0 || len( body.Reservations ) > MAX_BATCH {
+				code = ERR_BAD_REQUEST
+				msg = fmt.Sprintf( "a batch must have between 1 and %d reservations; %d given", MAX_BATCH, len( body.Reservations ) )
+				break
+			}
+
+			http_sheep.Baa( 1, "batch of %d reservations received from %s", len( body.Reservations ), in.RemoteAddr )
+			nerrors := 0
+			fcode := ""
+			sep := ""
+			for i, e := range run_batch( with_origin( in ), &body ) {
+				if e.reason != "" {
+					nerrors++
+					if fcode == "" {
+						fcode = e.code
+					}
+					fmt.Fprintf( bout, `%s{ "status": "ERROR", "request": %d, "cid": %q, "code": %q, "comment": %q }`, sep, i+1, e.cid, e.code, e.reason )
+				} else {
+					fmt.Fprintf( bout, `%s{ "status": "OK", "request": %d, "cid": %q, "code": "", "comment": "reservation accepted", "details": %s }`, sep, i+1, e.cid, e.res.To_json() )
+				}
+				sep = ","
+			}
+
+			msg = fmt.Sprintf( "%d errors processing requests in %d requests", nerrors, len( body.Reservations ) )
+			if nerrors == 0 {
+				state = "OK"
+			} else {
+				if nerrors == len( body.Reservations ) {
+					code = fcode
+				}
+			}
+	}
+
+	fmt.Fprintf( bout, ` ], "endstate": { "status": %q, "code": %q, "comment": %q } }`, state, code, msg )
+	http_sheep.Baa( 2, "batch finished: %s %s", state, msg )
+	out.WriteHeader( err_status( code ) )
+	out.Write( bout.Bytes() )
+}
@@ -0,0 +1,167 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	http_bulk
+	Abstract:	Bulk (deadline) transfer requests. Rather than a bandwidth, the request gives the
+				number of bytes to move between two hosts and the time by which they must be
+				moved:
+
+					bulk size {[<start>-]<deadline>|+sec} host1,host2 cookie dscp
+
+				The rate needed to move the bytes between the start (now if not given) and
+				the deadline, plus resmgr:bulk_margin percent, is reserved in both directions.
+				If the links don't have that much room for the whole window, later starts are
+				tried (each needing a higher rate) until one fits or there are no more to try;
+				the window and rate of the reservation returned say when the transfer can go.
+
+				The reservation is an ordinary bandwidth reservation that is also given the byte
+				count; res-mgr raises its rate if it falls behind and deletes it once the bytes
+				have been moved (res_mgr_bulk.go).
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	BULK_STARTS		int64 = 4					// number of starts tried: now and each quarter of the window after
+	BULK_MIN_WIN	int64 = 60					// shortest window that a later start may leave
+)
+
+/*
+	Create the reservation for a bulk request. Tmap holds the parsed request tokens.
+	Return values are as for the finalise functions.
+*/
+func mk_bulk( ctx context.Context, tmap map[string]*string, cid string, res_paused bool ) ( reason string, jreason string, nerrors int, code string ) {
+	nerrors = 1
+	code = ERR_BAD_REQUEST
+
+	size := int64( clike.Atof( *tmap["size"] ) )
+	if size <= 0 {
+		reason = fmt.Sprintf( "bulk transfer rejected: size must be given: %s", *tmap["size"] )
+		return
+	}
+
+	startt, endt := gizmos.Str2start_end( *tmap["window"] )
+	if endt <= startt {
+		reason = fmt.Sprintf( "bulk transfer rejected: deadline must be after the start: %s", *tmap["window"] )
+		return
+	}
+
+	h1, h2 := gizmos.Str2host1_host2( *tmap["hosts"] )
+	if is_selector( h1 ) || is_selector( h2 ) {
+		reason = "bulk transfer rejected: label selectors are not supported; name the two hosts"
+		return
+	}
+	h1, h2, p1, p2, v1, v2, err := validate_hosts( h1, h2 )
+	if err != nil {
+		reason = fmt.Sprintf( "bulk transfer rejected: %s", err )
+		return
+	}
+	update_graph( &h1, false, false )
+	update_graph( &h2, true, true )
+
+	dscp := tclass2dscp["voice"]
+	dscp_koe := false
+	given := *tmap["dscp"] != "0"
+	if given {
+		if strings.HasPrefix( *tmap["dscp"], "global_" ) {
+			dscp_koe = true
+			dscp = tclass2dscp[(*tmap["dscp"])[7:]]
+		} else {
+			dscp = tclass2dscp[*tmap["dscp"]]
+		}
+		if dscp <= 0 {
+			reason = fmt.Sprintf( "bulk transfer rejected: traffic classifcation string is not valid: %s", *tmap["dscp"] )
+			return
+		}
+	}
+
+	tier := project_tier( hosts_project( h1, h2 ) )
+	tier.apply( given, &dscp, &dscp_koe )
+
+	step := (endt - startt) / BULK_STARTS
+	for i := int64( 0 ); i < BULK_STARTS; i++ {
+		commence := startt + i * step
+		if i > 0 && (endt - commence < BULK_MIN_WIN || ctx.Err() != nil) {
+			break
+		}
+
+		rate := bulk_rate( size, endt - commence )
+		if tier.clamp( rate ) < rate {
+			code = ERR_CAPACITY
+			reason = fmt.Sprintf( "bulk transfer rejected: %d bytes by %d needs %d bits/sec which is over the ceiling of the project's tier", size, endt, rate )
+			return
+		}
+
+		res_name := mk_resname( )
+		res, err := gizmos.Mk_bw_pledge( &h1, &h2, p1, p2, commence, endt, rate, rate, &res_name, tmap["cookie"], dscp, dscp_koe )
+		if err != nil {
+			reason = fmt.Sprintf( "bulk transfer rejected: %s", err )
+			return
+		}
+
+		if tmap["proto"] != nil {
+			res.Add_proto( tmap["proto"] )
+		}
+		res.Set_vlan( v1, v2 )
+		if tmap["ipv6"] != nil {
+			res.Set_matchv6( *tmap["ipv6"] == "true" )
+		}
+		if tmap["meta"] != nil {
+			if merr := res.Set_meta_list( *tmap["meta"] ); merr != nil {
+				reason = fmt.Sprintf( "bulk transfer rejected: %s", merr )
+				return
+			}
+		}
+		if err = set_name_opts( res, tmap ); err != nil {
+			reason = fmt.Sprintf( "bulk transfer rejected: %s", err )
+			return
+		}
+		res.Set_bulk( size )
+		res.Set_cid( cid )
+
+		reason, jreason, nerrors, code = finalise_bw_res( ctx, res, res_paused )
+		if nerrors == 0 || code != ERR_CAPACITY {
+			if nerrors == 0 {
+				http_sheep.Baa( 1, "bulk transfer %s: %d bytes at %d bits/sec from %d to %d", res_name, size, rate, commence, endt )
+			}
+			return
+		}
+
+		http_sheep.Baa( 2, "bulk transfer: no room to start at %d with rate %d: %s", commence, rate, reason )
+	}
+
+	return
+}
@@ -0,0 +1,282 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	http_chain
+	Abstract:	Service chain requests. A chain request creates a steering reservation between two
+				endpoints through a list of middleboxes, and a bandwidth reservation for each leg
+				of the path the traffic takes (ep1 to the first middlebox, middlebox to middlebox,
+				and the last middlebox to ep2):
+
+					chain bandwidth window [token/]tenant ep1 ep2 mb1[,mb2...] cookie dscp
+
+				The request succeeds or fails as a whole; if a leg cannot be reserved the members
+				already created are removed. The chain id returned is used with the chainstatus,
+				chainextend and (DELETE) chain requests. See res_mgr_chain.go for how the members
+				are tracked.
+
+				With template=name the middleboxes are given as role:mbox pairs which are bound to
+				the roles of the service chain template (res_mgr_ctmpl.go).
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Meta= applies to every member of the chain.
+				16 Oct 2026 - As do name= and desc=.
+				16 Oct 2026 - The steering reservation carries the origin of the request.
+				16 Oct 2026 - Added template= (service chain templates).
+				16 Oct 2026 - Chains are refused when the fq-mgr backend is ovn.
+				16 Oct 2026 - Correlation id is passed to res-mgr.
+*/
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Send a chain request to res-mgr and wait for the response. Cid is the correlation id
+	of the api request.
+*/
+func chain_send( cr *chain_req, cid string ) ( interface{}, error ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	if cr.cookie == nil {
+		cr.cookie = &empty_str
+	}
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_CHAIN, cr, cid )
+	req = <- my_ch
+
+	if req.State == nil && cr.op != "status" {
+		ckptreq := ipc.Mk_chmsg( )
+		ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, cid )
+	}
+
+	return req.Response_data, req.State
+}
+
+/*
+	Create the steering and leg reservations for a chain request. Tmap holds the parsed
+	request tokens. Return values are as for the finalise functions.
+*/
+func mk_chain( ctx context.Context, tmap map[string]*string, cid string, res_paused bool ) ( reason string, jreason string, nerrors int, code string ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	nerrors = 1
+	code = ERR_BAD_REQUEST
+
+	if ovn_configured( ) {											// legs are steered through the middleboxes
+		reason = "service chain rejected: steering is not supported by the ovn backend"
+		return
+	}
+
+	var bandw_in, bandw_out int64
+	if strings.Index( *tmap["bandw"], "," ) >= 0 {				// inputbandwidth,outputbandwidth
+		subtokens := strings.Split( *tmap["bandw"], "," )
+		bandw_in = int64( clike.Atof( subtokens[0] ) )
+		bandw_out = int64( clike.Atof( subtokens[1] ) )
+	} else {
+		bandw_in = int64( clike.Atof( *tmap["bandw"] ) )
+		bandw_out = bandw_in
+	}
+	if bandw_in <= 0 && bandw_out <= 0 {
+		reason = fmt.Sprintf( "service chain rejected: bandwidth must be given: %s", *tmap["bandw"] )
+		return
+	}
+
+	dscp := tclass2dscp["voice"]
+	dscp_koe := false
+	if *tmap["dscp"] != "0" {
+		if strings.HasPrefix( *tmap["dscp"], "global_" ) {
+			dscp_koe = true
+			dscp = tclass2dscp[(*tmap["dscp"])[7:]]
+		} else {
+			dscp = tclass2dscp[*tmap["dscp"]]
+		}
+		if dscp <= 0 {
+			reason = fmt.Sprintf( "service chain rejected: traffic classifcation string is not valid: %s", *tmap["dscp"] )
+			return
+		}
+	}
+
+	var tmpl *chain_tmpl
+	if tmap["template"] != nil {										// middleboxes are role bindings; put them in the template's order
+		var err error
+		tmpl, err = chain_template( *tmap["template"] )
+		if err != nil {
+			code = err_code( err )
+			reason = fmt.Sprintf( "service chain rejected: %s", err )
+			return
+		}
+		mblist, err := tmpl.bind( *tmap["mblist"] )
+		if err != nil {
+			reason = fmt.Sprintf( "service chain rejected: %s", err )
+			return
+		}
+		tmap["mblist"] = &mblist
+		if tmap["proto"] == nil && tmpl.proto != "" {
+			tmap["proto"] = &tmpl.proto
+		}
+	}
+
+	usrsp := *tmap["usrsp"]
+	h1, h2, p1, p2, _, _, err := validate_hosts( usrsp + "/" + *tmap["ep1"], usrsp + "/" + *tmap["ep2"] )
+	if err != nil {
+		reason = fmt.Sprintf( "service chain rejected: invalid endpoints: %s", err )
+		return
+	}
+	update_graph( &h1, false, false )
+	update_graph( &h2, true, true )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( osif_ch, my_ch, REQ_VALIDATE_TOKEN, tmap["usrsp"], cid )		// validate token and convert user space to ID if name given
+	req = <- my_ch
+	tenant := tmap["usrsp"]
+	if req.Response_data != nil {
+		if tenant = req.Response_data.( *string ); tenant == nil {
+			code = err_code( req.State )
+			reason = fmt.Sprintf( "service chain rejected: %s", req.State )
+			return
+		}
+	}
+
+	if err = vet_steer_tenancy( *tenant, h1 ); err == nil {
+		err = vet_steer_tenancy( *tenant, h2 )
+	}
+	var mbs []*gizmos.Mbox
+	if err == nil {
+		mbs, err = steer_mboxes( *tenant, *tmap["mblist"], my_ch )
+	}
+	if err != nil {
+		code = err_code( err )
+		reason = fmt.Sprintf( "service chain rejected: %s", err )
+		return
+	}
+
+	startt, endt := gizmos.Str2start_end( *tmap["window"] )
+	chain := mk_resname( )
+	sname := chain_steer_id( chain )
+	st, err := gizmos.Mk_steer_pledge( &h1, &h2, p1, p2, startt, endt, &sname, tmap["cookie"], tmap["proto"] )
+	if err != nil {
+		reason = fmt.Sprintf( "service chain rejected: unable to create steering reservation: %s", err )
+		return
+	}
+	for _, mb := range mbs {
+		st.Add_mbox( mb )
+	}
+	st.Set_cid( cid )
+	set_origin( ctx, st )
+	if tmpl != nil {
+		st.Set_template( tmpl.name, tmpl.pri )							// offset was vetted when the template was set
+	}
+	if tmap["meta"] != nil {											// each member carries the metadata, name and description
+		if err = st.Set_meta_list( *tmap["meta"] ); err != nil {
+			reason = fmt.Sprintf( "service chain rejected: %s", err )
+			return
+		}
+	}
+	if err = set_name_opts( st, tmap ); err != nil {
+		reason = fmt.Sprintf( "service chain rejected: %s", err )
+		return
+	}
+
+	req.Send_req( rmgr_ch, my_ch, REQ_ADD, st, cid )
+	req = <- my_ch
+	if req.State != nil {
+		code = err_code( req.State )
+		reason = fmt.Sprintf( "service chain rejected: %s", req.State )
+		return
+	}
+
+	hops := []string{ usrsp + "/" + *tmap["ep1"] }					// legs: ep1 -> mb1 ... mbn -> ep2
+	for _, mbn := range strings.Split( *tmap["mblist"], "," ) {
+		if strings.Index( mbn, "/" ) < 0 {
+			mbn = usrsp + "/" + mbn
+		}
+		hops = append( hops, mbn )
+	}
+	hops = append( hops, usrsp + "/" + *tmap["ep2"] )
+
+	jlegs := make( []string, 0, len( hops ) - 1 )
+	for i := 0; i < len( hops ) - 1; i++ {
+		var leg *gizmos.Pledge_bw
+
+		lh1, lh2, lp1, lp2, lv1, lv2, err := validate_hosts( hops[i], hops[i+1] )
+		if err == nil {
+			update_graph( &lh1, false, false )
+			update_graph( &lh2, true, true )
+
+			lname := chain_leg_id( chain, i )
+			leg, err = gizmos.Mk_bw_pledge( &lh1, &lh2, lp1, lp2, startt, endt, bandw_in, bandw_out, &lname, tmap["cookie"], dscp, dscp_koe )
+		}
+
+		lerrors := 1
+		lreason := ""
+		ljreason := ""
+		lcode := ERR_BAD_REQUEST
+		if err == nil {
+			if tmap["proto"] != nil {
+				leg.Add_proto( tmap["proto"] )
+			}
+			leg.Set_vlan( lv1, lv2 )
+			leg.Set_cid( cid )
+			leg.Set_depends( sname )								// pushed after, and deleted with, the steering reservation
+			if tmap["meta"] != nil {
+				leg.Set_meta_list( *tmap["meta"] )					// already vetted on the steering reservation
+			}
+			set_name_opts( leg, tmap )
+			lreason, ljreason, lerrors, lcode = finalise_bw_res( ctx, leg, res_paused )
+		} else {
+			lreason = fmt.Sprintf( "%s", err )
+		}
+
+		if lerrors > 0 {
+			lfrom := gizmos.Redact_tokens( hops[i] )
+			lto := gizmos.Redact_tokens( hops[i+1] )
+			http_sheep.Baa( 1, "service chain %s rejected: leg %d (%s to %s): %s", chain, i, lfrom, lto, lreason )
+			if _, err = chain_send( &chain_req{ op: "delete", id: chain, cookie: tmap["cookie"], now: true }, cid ); err != nil {
+				http_sheep.Baa( 1, "service chain %s: unable to remove members after failure: %s", chain, err )
+			}
+			code = lcode
+			reason = fmt.Sprintf( "service chain rejected: leg %d (%s to %s): %s", i, lfrom, lto, lreason )
+			return
+		}
+		jlegs = append( jlegs, ljreason )
+	}
+
+	http_sheep.Baa( 1, "service chain %s accepted: %d middleboxes cid=%s", chain, len( mbs ), cid )
+	nerrors = 0
+	code = ""
+	reason = fmt.Sprintf( "service chain %s accepted; %d middleboxes and %d legs", chain, len( mbs ), len( jlegs ) )
+	jreason = fmt.Sprintf( `{ "chain": %q, "steering": %s, "legs": [ %s ] }`, chain, st.To_json(), strings.Join( jlegs, ", " ) )
+	return
+}
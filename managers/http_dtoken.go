@@ -0,0 +1,522 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	http_dtoken
+	Abstract:	Delegated tokens. A tenant may mint a limited scope token which CI or other
+				automation can use in place of a keystone token on reserve requests
+				(dt-xxxx/project/vm). The scope limits the project, the bandwidth (each
+				direction), an optional list of VMs, and the time; a reservation made with
+				the token may not outlive it. Both hosts must be named with the same token,
+				so external (!address) endpoints are not allowed.
+
+				Minting, listing and revoking require a keystone token valid for the project
+				(or an admin token). The secret is returned only when the token is minted;
+				only its hash is kept. Tokens are saved so that they survive a restart.
+				Revoking a token does not affect reservations already made with it.
+
+	CFG:		httpmgr:dtoken_file - file where delegated tokens are saved (/var/lib/tegu/dtokens)
+				httpmgr:dtoken_max_life - maximum life, in seconds, of a delegated token (7776000; 90 days)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Dtoken requests return an error code.
+*/
+
+package managers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+const dtoken_prefix string = "dt-"
+
+/*
+	A delegated token. Exported fields are saved.
+*/
+type dtoken struct {
+	Id			string				// public id used to list and revoke
+	Hash		string				// sha256 of the secret; the secret itself is never kept
+	Project		string				// project ID
+	Pname		string				// project as given when minted (name or ID)
+	Max_bw		int64				// limit for each direction; 0 is no limit
+	Expiry		int64
+	Hosts		[]string			// VMs which may be reserved between; empty allows any in the project
+	Name		string				// user description
+	Creator		string				// fingerprint of the token used to mint it
+	Created		int64
+}
+
+var (
+	dtoken_lock		sync.Mutex						// http requests run concurrently
+	dtokens			map[string]*dtoken				// keyed by hash
+	dtoken_file		string = "/var/lib/tegu/dtokens"
+	dtoken_max_life	int64 = 86400 * 90
+)
+
+/*
+	Returns true if the host name (token/project/vm) is given with a delegated token.
+*/
+func is_dtoken( h string ) ( bool ) {
+	return strings.HasPrefix( h, dtoken_prefix )
+}
+
+func dtoken_hash( secret string ) ( string ) {
+	sum := sha256.Sum256( []byte( secret ) )
+	return hex.EncodeToString( sum[:] )
+}
+
+/*
+	Returns true if the translated host (project-id/vm) is within the token's scope.
+*/
+func (dt *dtoken) allows( hx string ) ( bool ) {
+	if ! strings.HasPrefix( hx, dt.Project + "/" ) {
+		return false
+	}
+	if len( dt.Hosts ) == 0 {
+		return true
+	}
+
+	vm := hx[len( dt.Project )+1:]
+	for _, h := range dt.Hosts {
+		if h == vm {
+			return true
+		}
+	}
+	return false
+}
+
+func (dt *dtoken) to_json( ) ( string ) {
+	hosts, _ := json.Marshal( dt.Hosts )
+	if dt.Hosts == nil {
+		hosts = []byte( "[]" )
+	}
+	return fmt.Sprintf( `{ "id": %q, "project": %q, "pname": %q, "max_bw": %d, "expiry": %d, "hosts": %s, "name": %q, "creator": %q, "created": %d }`,
+		dt.Id, dt.Project, dt.Pname, dt.Max_bw, dt.Expiry, hosts, dt.Name, dt.Creator, dt.Created )
+}
+
+/*
+	Set up from config values and load saved tokens. Called once by Http_api.
+*/
+func dtoken_init( fname *string, max_life *string ) {
+	if fname != nil && *fname != "" {
+		dtoken_file = *fname
+	}
+	if max_life != nil {
+		if v := clike.Atoi64( *max_life ); v > 0 {
+			dtoken_max_life = v
+		}
+	}
+
+	load_dtokens( )
+}
+
+/*
+	Load the token file; silently does nothing if it is missing. Tokens which have expired are dropped.
+*/
+func load_dtokens( ) {
+	dtoken_lock.Lock()
+	defer dtoken_lock.Unlock()
+
+	dtokens = make( map[string]*dtoken )
+	buf, err := ioutil.ReadFile( dtoken_file )
+	if err != nil {
+		return
+	}
+
+	list := make( []*dtoken, 0 )
+	if err = json.Unmarshal( buf, &list ); err != nil {
+		http_sheep.Baa( 0, "WRN: unable to parse delegated token file %s: %s  [TGUHTP006]", dtoken_file, err )
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, dt := range list {
+		if dt != nil && dt.Expiry > now {
+			dtokens[dt.Hash] = dt
+		}
+	}
+
+	http_sheep.Baa( 1, "loaded %d delegated tokens from %s", len( dtokens ), dtoken_file )
+}
+
+/*
+	Write the tokens to the file. Caller must hold the lock.
+*/
+func save_dtokens( ) {
+	list := make( []*dtoken, 0, len( dtokens ) )
+	for _, dt := range dtokens {
+		list = append( list, dt )
+	}
+
+	buf, err := json.Marshal( list )
+	if err == nil {
+		err = ioutil.WriteFile( dtoken_file + ".new", buf, 0600 )		// hashes only, but still no business being readable
+	}
+	if err == nil {
+		err = os.Rename( dtoken_file + ".new", dtoken_file )
+	}
+	if err != nil {
+		http_sheep.Baa( 1, "unable to save delegated tokens: %s", err )
+	}
+}
+
+/*
+	Create a new token. The secret is returned and is not available again.
+*/
+func mint_dtoken( pid string, pname string, max_bw int64, expiry int64, hosts []string, name string, creator string ) ( secret string, dt *dtoken, err error ) {
+	now := time.Now().Unix()
+	if expiry <= now {
+		return "", nil, mk_err( ERR_BAD_REQUEST, "delegated token expiry must be in the future" )
+	}
+	if expiry > now + dtoken_max_life {
+		expiry = now + dtoken_max_life
+	}
+
+	rb := make( []byte, 16 )
+	if _, err = rand.Read( rb ); err != nil {
+		return "", nil, mk_err( ERR_INTERNAL, "unable to generate delegated token: %s", err )
+	}
+
+	secret = dtoken_prefix + hex.EncodeToString( rb )
+	dt = &dtoken {
+		Hash:		dtoken_hash( secret ),
+		Project:	pid,
+		Pname:		pname,
+		Max_bw:		max_bw,
+		Expiry:		expiry,
+		Hosts:		hosts,
+		Name:		name,
+		Creator:	creator,
+		Created:	now,
+	}
+	dt.Id = dt.Hash[0:12]
+
+	dtoken_lock.Lock()
+	defer dtoken_lock.Unlock()
+	if dtokens == nil {
+		dtokens = make( map[string]*dtoken )
+	}
+	dtokens[dt.Hash] = dt
+	save_dtokens( )
+
+	http_sheep.Baa( 1, "delegated token minted: id=%s project=%s max_bw=%d expiry=%d hosts=%d by %s", dt.Id, pid, max_bw, expiry, len( hosts ), creator )
+	return
+}
+
+/*
+	Find the token for the secret; nil if unknown, revoked or expired.
+*/
+func find_dtoken( secret string ) ( *dtoken ) {
+	dtoken_lock.Lock()
+	defer dtoken_lock.Unlock()
+
+	dt := dtokens[dtoken_hash( secret )]
+	if dt == nil || dt.Expiry <= time.Now().Unix() {
+		return nil
+	}
+	return dt
+}
+
+/*
+	Return a json array of the tokens for the project; all projects if pid is empty.
+	Expired tokens are pruned as a side effect.
+*/
+func dtoken_list( pid string ) ( string ) {
+	dtoken_lock.Lock()
+	defer dtoken_lock.Unlock()
+
+	now := time.Now().Unix()
+	list := make( []*dtoken, 0 )
+	npruned := 0
+	for h, dt := range dtokens {
+		if dt.Expiry <= now {
+			delete( dtokens, h )
+			npruned++
+			continue
+		}
+		if pid == "" || dt.Project == pid {
+			list = append( list, dt )
+		}
+	}
+	if npruned > 0 {
+		save_dtokens( )
+	}
+
+	sort.Slice( list, func( i, j int ) bool { return list[i].Created < list[j].Created } )
+	jstr := "[ "
+	sep := ""
+	for _, dt := range list {
+		jstr += sep + dt.to_json()
+		sep = ", "
+	}
+	return jstr + " ]"
+}
+
+/*
+	Revoke the token with the id. If pid is not empty the token must belong to that project.
+*/
+func revoke_dtoken( id string, pid string ) ( err error ) {
+	dtoken_lock.Lock()
+	defer dtoken_lock.Unlock()
+
+	for h, dt := range dtokens {
+		if dt.Id == id {
+			if pid != "" && dt.Project != pid {
+				return mk_err( ERR_NOT_AUTHORISED, "delegated token %s does not belong to the project", id )
+			}
+			delete( dtokens, h )
+			save_dtokens( )
+			http_sheep.Baa( 1, "delegated token revoked: id=%s project=%s", id, dt.Project )
+			return nil
+		}
+	}
+
+	return mk_err( ERR_NOT_FOUND, "delegated token not found: %s", id )
+}
+
+/*
+	Return the project id of the token id; empty if not found.
+*/
+func dtoken_project( id string ) ( string ) {
+	dtoken_lock.Lock()
+	defer dtoken_lock.Unlock()
+
+	for _, dt := range dtokens {
+		if dt.Id == id {
+			return dt.Project
+		}
+	}
+	return ""
+}
+
+/*
+	Validate the auth data as a keystone token for the project and return the project ID.
+	Auth data may be token/project in which case only the token portion is used.
+*/
+func auth_project( auth_data string, is_token bool, project string ) ( pid string, err error ) {
+	if ! is_token {
+		return "", mk_err( ERR_NOT_AUTHORISED, "an auth token for the project is required" )
+	}
+
+	tp := auth_data
+	if i := strings.Index( tp, "/" ); i >= 0 {
+		tp = tp[0:i]
+	}
+	tp += "/" + project
+
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+	req := ipc.Mk_chmsg( )
+	req.Send_req( osif_ch, my_ch, REQ_VALIDATE_TOKEN, &tp, nil )
+	req = <- my_ch
+	p, ok := req.Response_data.( *string )
+	if req.State != nil || !ok || p == nil {
+		return "", mk_err( ERR_NOT_AUTHORISED, "unable to validate token for project %s: %v", project, req.State )
+	}
+
+	return strings.TrimSuffix( *p, "/" ), nil
+}
+
+/*
+	Used in place of validate_hosts() when the hosts on a reserve request are given with a
+	delegated token. The token is checked and its scope applied to the hosts, the bandwidth
+	and the expiry of the reservation; the hosts are then translated without a keystone token.
+*/
+func dtoken_hosts( h1 string, h2 string, bw_in int64, bw_out int64, endt int64 ) ( h1x string, h2x string, p1 *string, p2 *string, v1 *string, v2 *string, err error ) {
+	t1 := strings.SplitN( h1, "/", 3 )
+	t2 := strings.SplitN( h2, "/", 3 )
+	if len( t1 ) != 3 || len( t2 ) != 3 || t1[0] != t2[0] {
+		err = mk_err( ERR_NOT_AUTHORISED, "both hosts must be given with the same delegated token" )
+		return
+	}
+
+	dt := find_dtoken( t1[0] )
+	if dt == nil {
+		err = mk_err( ERR_NOT_AUTHORISED, "delegated token is not valid, has expired or was revoked" )
+		return
+	}
+
+	for _, p := range []string{ t1[1], t2[1] } {
+		if p != "" && p != dt.Pname && p != dt.Project {
+			err = mk_err( ERR_NOT_AUTHORISED, "delegated token %s is not valid for project %s", dt.Id, p )
+			return
+		}
+	}
+
+	if dt.Max_bw > 0 && (bw_in > dt.Max_bw || bw_out > dt.Max_bw) {
+		err = mk_err( ERR_NOT_AUTHORISED, "bandwidth exceeds the delegated token %s limit of %d", dt.Id, dt.Max_bw )
+		return
+	}
+	if endt > dt.Expiry {
+		err = mk_err( ERR_NOT_AUTHORISED, "reservation may not outlive delegated token %s (expires %d)", dt.Id, dt.Expiry )
+		return
+	}
+
+	h1x, h2x, p1, p2, v1, v2, err = check_hosts( dt.Project + "/" + t1[2], dt.Project + "/" + t2[2], REQ_XLATE_HOST )
+	if err != nil {
+		return
+	}
+
+	if ! dt.allows( h1x ) || ! dt.allows( h2x ) {
+		err = mk_err( ERR_NOT_AUTHORISED, "host is not within the scope of delegated token %s", dt.Id )
+		return
+	}
+
+	http_sheep.Baa( 2, "delegated token %s: %s,%s", dt.Id, h1x, h2x )
+	return
+}
+
+/*
+	Process a dtoken request:
+		dtoken add [max=bw[K|M|G]] [hosts=vm[,vm...]] [name=text] project {expiry|+sec}
+		dtoken list [project]
+		dtoken del id
+
+	Returns the state, reason, json details and, on error, the error code.
+*/
+func dtoken_req( tokens []string, auth_data string, is_token bool ) ( state string, reason string, jreason string, code string ) {
+	state = "ERROR"
+	if len( tokens ) < 2 {
+		reason = "missing parameters; usage: dtoken {add|list|del} ..."
+		code = ERR_BAD_REQUEST
+		return
+	}
+
+	switch tokens[1] {
+		case "add":
+			tmap := gizmos.Mixtoks2map( tokens[2:], "project expiry" )
+			if ok, mlist := gizmos.Map_has_all( tmap, "project expiry" ); !ok {
+				reason = fmt.Sprintf( "missing parameters: (%s); usage: dtoken add [max=bw[K|M|G]] [hosts=vm[,vm...]] [name=text] project {expiry|+sec}", mlist )
+				code = ERR_BAD_REQUEST
+				return
+			}
+
+			pid, err := auth_project( auth_data, is_token, *tmap["project"] )
+			if err != nil {
+				reason = fmt.Sprintf( "%s", err )
+				code = err_code( err )
+				return
+			}
+
+			var max_bw int64
+			if tmap["max"] != nil {
+				max_bw = int64( clike.Atof( *tmap["max"] ) )
+			}
+			var hosts []string
+			if tmap["hosts"] != nil {
+				hosts = strings.Split( *tmap["hosts"], "," )
+			}
+			name := ""
+			if tmap["name"] != nil {
+				name = strings.Trim( *tmap["name"], `"` )
+			}
+
+			_, expiry := gizmos.Str2start_end( *tmap["expiry"] )
+			secret, dt, err := mint_dtoken( pid, *tmap["project"], max_bw, expiry, hosts, name, gizmos.Key_fingerprint( auth_data ) )
+			if err != nil {
+				reason = fmt.Sprintf( "%s", err )
+				code = err_code( err )
+				return
+			}
+
+			state = "OK"
+			reason = fmt.Sprintf( "delegated token minted: %s", dt.Id )
+			jreason = fmt.Sprintf( `{ "token": %q, "dtoken": %s }`, secret, dt.to_json() )
+
+		case "list":
+			pid := ""
+			if len( tokens ) > 2 {
+				var err error
+				if ! validate_auth( &auth_data, is_token, admin_roles ) {
+					if pid, err = auth_project( auth_data, is_token, tokens[2] ); err != nil {
+						reason = fmt.Sprintf( "%s", err )
+						code = err_code( err )
+						return
+					}
+				} else {
+					my_ch := make( chan *ipc.Chmsg )
+					pid = proj2id( tokens[2], my_ch )
+					close( my_ch )
+				}
+			} else {
+				if ! validate_auth( &auth_data, is_token, admin_roles ) {
+					reason = "listing all delegated tokens requires an admin token; usage: dtoken list [project]"
+					code = ERR_NOT_AUTHORISED
+					return
+				}
+			}
+
+			state = "OK"
+			jreason = dtoken_list( pid )
+
+		case "del":
+			if len( tokens ) < 3 {
+				reason = "missing parameters; usage: dtoken del id"
+				code = ERR_BAD_REQUEST
+				return
+			}
+
+			pid := ""
+			if ! validate_auth( &auth_data, is_token, admin_roles ) {
+				var err error
+				if pid = dtoken_project( tokens[2] ); pid == "" {
+					reason = fmt.Sprintf( "delegated token not found: %s", tokens[2] )
+					code = ERR_NOT_FOUND
+					return
+				}
+				if _, err = auth_project( auth_data, is_token, pid ); err != nil {
+					reason = fmt.Sprintf( "%s", err )
+					code = err_code( err )
+					return
+				}
+			}
+
+			if err := revoke_dtoken( tokens[2], pid ); err != nil {
+				reason = fmt.Sprintf( "%s", err )
+				code = err_code( err )
+				return
+			}
+			state = "OK"
+			reason = fmt.Sprintf( "delegated token revoked: %s", tokens[2] )
+
+		default:
+			reason = fmt.Sprintf( "unknown dtoken action: %s; usage: dtoken {add|list|del} ...", tokens[1] )
+			code = ERR_BAD_REQUEST
+	}
+
+	return
+}
@@ -0,0 +1,201 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+package managers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	Set up an empty token file in a temp directory. The returned function puts things back.
+*/
+func dtoken_setup( t *testing.T ) ( func() ) {
+	http_sheep = bleater.Mk_bleater( 0, os.Stderr )
+
+	dir, err := ioutil.TempDir( "", "tegu_dtoken" )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	old_file := dtoken_file
+	dtoken_file = filepath.Join( dir, "dtokens" )
+	load_dtokens( )
+
+	return func() {
+		dtoken_file = old_file
+		dtokens = nil
+		os.RemoveAll( dir )
+	}
+}
+
+/*
+	A token's scope must be applied to the hosts, the project, the bandwidth and the end of
+	the reservation. Osif is played by a goroutine which passes the host names back as given.
+*/
+func TestDtoken_hosts( t *testing.T ) {
+	defer dtoken_setup( t )( )
+	errs := 0
+
+	old_osif := osif_ch
+	och := make( chan *ipc.Chmsg, 4 )
+	osif_ch = och
+	defer func() { osif_ch = old_osif }()
+	go func() {
+		for req := range och {
+			name := *(req.Req_data.( *string ))
+			req.Response_data = &name
+			req.State = nil
+			req.Response_ch <- req
+		}
+	}()
+	defer close( och )
+
+	now := time.Now().Unix()
+	secret, _, err := mint_dtoken( "pid1", "proj1", 1000, now + 3600, []string{ "vm1", "vm2" }, "ci", "fp" )
+	if err != nil {
+		t.Fatal( err )
+	}
+	other, _, err := mint_dtoken( "pid1", "proj1", 1000, now + 3600, nil, "other", "fp" )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	cases := []struct {
+		what	string
+		h1		string
+		h2		string
+		bw		int64
+		endt	int64
+		ok		bool
+	} {
+		{ "within scope", secret + "/proj1/vm1", secret + "/proj1/vm2", 500, now + 600, true },
+		{ "project id", secret + "/pid1/vm1", secret + "/pid1/vm2", 500, now + 600, true },
+		{ "mismatched tokens", secret + "/proj1/vm1", other + "/proj1/vm2", 500, now + 600, false },
+		{ "wrong project", secret + "/proj1/vm1", secret + "/proj2/vm2", 500, now + 600, false },
+		{ "over max bandwidth", secret + "/proj1/vm1", secret + "/proj1/vm2", 2000, now + 600, false },
+		{ "ends after token", secret + "/proj1/vm1", secret + "/proj1/vm2", 500, now + 7200, false },
+		{ "vm not in hosts", secret + "/proj1/vm1", secret + "/proj1/vm3", 500, now + 600, false },
+		{ "unknown token", "dt-nosuch/proj1/vm1", "dt-nosuch/proj1/vm2", 500, now + 600, false },
+	}
+	for _, c := range cases {
+		h1x, h2x, _, _, _, _, err := dtoken_hosts( c.h1, c.h2, c.bw, c.bw, c.endt )
+		switch {
+			case c.ok && (err != nil || h1x != "pid1/vm1" || h2x != "pid1/vm2"):
+				fmt.Fprintf( os.Stderr, "[FAIL] %s: expected pid1/vm1,pid1/vm2 got %q,%q err=%v\n", c.what, h1x, h2x, err )
+				errs++
+
+			case ! c.ok && err_code( err ) != ERR_NOT_AUTHORISED:
+				fmt.Fprintf( os.Stderr, "[FAIL] %s: expected not authorised, got: %v\n", c.what, err )
+				errs++
+		}
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   delegated token scope applied to hosts\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	A token must not be found once revoked or expired; listing prunes expired tokens and the
+	pruning is saved.
+*/
+func TestDtoken_lifecycle( t *testing.T ) {
+	defer dtoken_setup( t )( )
+	errs := 0
+
+	now := time.Now().Unix()
+	s1, dt1, err := mint_dtoken( "pid1", "proj1", 0, now + 3600, nil, "one", "fp" )
+	if err != nil {
+		t.Fatal( err )
+	}
+	s2, dt2, err := mint_dtoken( "pid1", "proj1", 0, now + 3600, nil, "two", "fp" )
+	if err != nil {
+		t.Fatal( err )
+	}
+	s3, dt3, err := mint_dtoken( "pid2", "proj2", 0, now + 3600, nil, "three", "fp" )
+	if err != nil {
+		t.Fatal( err )
+	}
+
+	if find_dtoken( s1 ) == nil || find_dtoken( s2 ) == nil || find_dtoken( s3 ) == nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] minted token not found\n" )
+		errs++
+	}
+
+	if err := revoke_dtoken( dt1.Id, "pid2" ); err_code( err ) != ERR_NOT_AUTHORISED {
+		fmt.Fprintf( os.Stderr, "[FAIL] token revoked by another project: %v\n", err )
+		errs++
+	}
+	if err := revoke_dtoken( dt1.Id, "pid1" ); err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] revoke refused: %s\n", err )
+		errs++
+	}
+	if find_dtoken( s1 ) != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] token found after it was revoked\n" )
+		errs++
+	}
+
+	dtoken_lock.Lock()
+	dt2.Expiry = now - 1
+	dtoken_lock.Unlock()
+	if find_dtoken( s2 ) != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] token found after it expired\n" )
+		errs++
+	}
+
+	if l := dtoken_list( "pid1" ); strings.Contains( l, dt2.Id ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] expired token listed: %s\n", l )
+		errs++
+	}
+	if l := dtoken_list( "" ); ! strings.Contains( l, dt3.Id ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] live token of another project not listed: %s\n", l )
+		errs++
+	}
+
+	load_dtokens( )												// as after a restart
+	if len( dtokens ) != 1 || find_dtoken( s3 ) == nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected only the live token to be saved, found %d\n", len( dtokens ) )
+		errs++
+	}
+
+	if _, _, _, code := dtoken_req( []string{ "dtoken", "del" }, "", false ); code != ERR_BAD_REQUEST {
+		fmt.Fprintf( os.Stderr, "[FAIL] usage error given code %q\n", code )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   delegated tokens revoked, expired and pruned\n" )
+	} else {
+		t.Fail()
+	}
+}
@@ -0,0 +1,175 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	http_label
+	Abstract:	Label based reservation targeting. A host on a reserve request may be given as
+				a selector of the form [token/]project/@key.value which is expanded into one
+				bandwidth reservation for each VM in the project that carries the label in its
+				instance metadata. The selector is validated here and passed to res-mgr which
+				keeps it, creates the reservations, and evaluates it again each time osif reads
+				the labels (res_mgr_label.go, osif_label.go).
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Labels come from the VM metadata via osif; the selector is kept and
+					expanded by res-mgr.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	Returns true if the host name is a selector (project/@key.value).
+*/
+func is_selector( h string ) ( bool ) {
+	return strings.Index( h, "/@" ) >= 0
+}
+
+/*
+	Validate a [token/]project and translate the project to an ID as osif would for a host name.
+*/
+func label_project( tp string ) ( project string, err error ) {
+	pname := tp + "/x"										// osif wants a host; we only care about the project
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( osif_ch, my_ch, REQ_VALIDATE_HOST, &pname, nil )
+	req = <- my_ch
+	if req.Response_data == nil {
+		return "", fmt.Errorf( "project validation failed: %s: %s", tp, req.State )
+	}
+
+	return strings.Split( *(req.Response_data.( *string )), "/" )[0], nil
+}
+
+/*
+	Split a selector into project, key and value. The [token/]project portion is
+	validated and translated to an ID.
+*/
+func split_selector( h string ) ( project string, key string, value string, err error ) {
+	toks := strings.SplitN( h, "/@", 2 )
+	kv := strings.SplitN( toks[1], ".", 2 )
+	if len( kv ) != 2 || kv[0] == "" {
+		err = fmt.Errorf( "bad selector, expected project/@key.value: %s", h )
+		return
+	}
+
+	if project, err = label_project( toks[0] ); err != nil {
+		err = fmt.Errorf( "selector %s: %s", h, err )
+		return
+	}
+
+	return project, kv[0], kv[1], nil
+}
+
+/*
+	Generate the labels of the VMs in the [token/]project as json.
+*/
+func list_labels( tp string ) ( jstr string, err error ) {
+	project, err := label_project( tp )
+	if err != nil {
+		return "", err
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( osif_ch, my_ch, REQ_LIST_LABELS, &project, nil )
+	req = <- my_ch
+	if req.State != nil {
+		return "", req.State
+	}
+
+	return req.Response_data.( string ), nil
+}
+
+/*
+	Accept the pieces of a reserve request where one host is a selector, validate them and
+	pass the selector to res-mgr. The response comes once the reservations for the VMs that
+	have the label now have been made.
+*/
+func reserve_selector( h1 string, h2 string, commence int64, expiry int64, bw_in int64, bw_out int64, cookie string, dscp int, koe bool, proto *string, cid string ) ( reason string, nerrors int ) {
+	sel := &label_sel {
+		Id:			strings.Replace( mk_resname(), "res", "sel", 1 ),
+		Commence:	commence,
+		Expiry:		expiry,
+		Bandw_in:	bw_in,
+		Bandw_out:	bw_out,
+		Cookie:		cookie,
+		Dscp:		dscp,
+		Dscp_koe:	koe,
+		Cid:		cid,
+		Sel_first:	is_selector( h1 ),
+	}
+	if proto != nil {
+		sel.Proto = *proto
+	}
+
+	shost := h1
+	ohost := h2
+	if ! sel.Sel_first {
+		shost, ohost = h2, h1
+	}
+	if is_selector( ohost ) {
+		return "only one host may be a selector", 1
+	}
+
+	var err error
+	sel.Project, sel.Key, sel.Value, err = split_selector( shost )
+	if err != nil {
+		return fmt.Sprintf( "%s", err ), 1
+	}
+
+	other, oport, ovlan, err := validate_one_host( ohost )
+	if err != nil {
+		return fmt.Sprintf( "%s", err ), 1
+	}
+	sel.Other = other
+	if oport != nil {
+		sel.Oport = *oport
+	}
+	if ovlan != nil {
+		sel.Ovlan = *ovlan
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_ADD_SELECTOR, sel, nil )
+	req = <- my_ch
+	if req.State != nil {
+		return fmt.Sprintf( "selector not accepted: %s", req.State ), 1
+	}
+
+	counts := req.Response_data.( []int )
+	return fmt.Sprintf( "selector %s accepted; %d reservations created, %d failed", sel.Id, counts[0], counts[1] ), counts[1]
+}
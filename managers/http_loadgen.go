@@ -0,0 +1,343 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	http_loadgen
+	Abstract:	Load generator for capacity testing tegu itself. The loadgen admin request
+				creates synthetic bandwidth reservations, between randomly selected pairs of
+				hosts, at a given arrival rate and drives each through the same path as a
+				reserve request (host info, dup check, policy, network admission, inventory).
+					loadgen [count=n] [rate=n] [duration=sec] [bandw=n] [hosts=h1,h2,...]
+					loadgen status
+					loadgen clean
+
+				Hosts default to all of the VMs when in simulation mode and must be given
+				otherwise. Each reservation uses a different port on the first host so that
+				they are not rejected as duplicates. Every reservation made by the generator
+				has the same cookie which allows clean to cancel them all.
+
+				One run is allowed at a time and runs in the background; status reports the
+				admission latency (time to accept or reject each request), counts, and push
+				throughput (reservations seen pushed per second after the first was accepted)
+				for the current or last run.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	LOADGEN_COOKIE	string = "tegu_loadgen"			// cookie on all generated reservations
+	LOADGEN_MAX		int = 100000					// max reservations in one run
+)
+
+type loadgen struct {
+	lock		sync.Mutex
+	running		bool
+	requested	int
+	submitted	int
+	accepted	int
+	rejected	int
+	lat			[]time.Duration						// admission latency of each request
+	unpushed	map[string]bool						// accepted reservations not yet seen pushed
+	npushed		int
+	started		time.Time
+	ended		time.Time							// all requests submitted and answered
+	first_acc	time.Time
+	last_push	time.Time
+	last_err	string
+}
+
+var (
+	lgen		*loadgen							// current or last run; nil if none
+	lgen_lock	sync.Mutex							// http requests are concurrent; protects lgen
+)
+
+/*
+	Process the loadgen request. Toks are the tokens following the command; the json
+	response is returned.
+*/
+func loadgen_request( toks []string ) ( jstr string, err error ) {
+	if len( toks ) > 0 {
+		switch toks[0] {
+			case "status":
+				lgen_lock.Lock()
+				lg := lgen
+				lgen_lock.Unlock()
+				if lg == nil {
+					return "", fmt.Errorf( "no load generation has been run" )
+				}
+				return lg.to_json(), nil
+
+			case "clean":
+				my_ch := make( chan *ipc.Chmsg )
+				all := "all"
+				cookie := LOADGEN_COOKIE
+				req := ipc.Mk_chmsg( )
+				req.Send_req( rmgr_ch, my_ch, REQ_DEL, []*string{ &all, &cookie }, nil )
+				req = <- my_ch
+				return `{ "cleaned": true }`, req.State
+		}
+	}
+
+	count := 100
+	rate := 10.0
+	dur := int64( 300 )
+	bandw := int64( 10000000 )
+	var hosts []string
+
+	for _, t := range toks {
+		kv := strings.SplitN( t, "=", 2 )
+		if len( kv ) != 2 {
+			return "", fmt.Errorf( "unrecognised parameter: %s; usage: loadgen [count=n] [rate=n] [duration=sec] [bandw=n] [hosts=h1,h2,...] | status | clean", t )
+		}
+
+		switch kv[0] {
+			case "count":
+				count = clike.Atoi( kv[1] )
+			case "rate":
+				rate = clike.Atof( kv[1] )
+			case "duration":
+				dur = clike.Atoi64( kv[1] )
+			case "bandw":
+				bandw = int64( clike.Atof( kv[1] ) )
+			case "hosts":
+				hosts = strings.Split( kv[1], "," )
+			default:
+				return "", fmt.Errorf( "unrecognised parameter: %s", kv[0] )
+		}
+	}
+
+	if count <= 0 || count > LOADGEN_MAX || rate <= 0 || dur <= 0 || bandw <= 0 {
+		return "", fmt.Errorf( "count (1-%d), rate, duration and bandw must be positive", LOADGEN_MAX )
+	}
+
+	if hosts == nil && sim_net != nil {
+		for _, vm := range sim_net.Vms {
+			hosts = append( hosts, vm.Project + "/" + vm.Name )
+		}
+	}
+
+	vhosts := make( []string, 0, len( hosts ) )
+	for _, h := range hosts {
+		hx, _, _, verr := validate_one_host( h )
+		if verr != nil {
+			return "", fmt.Errorf( "host %s: %s", h, verr )
+		}
+		vhosts = append( vhosts, hx )
+	}
+	if len( vhosts ) < 2 {
+		return "", fmt.Errorf( "at least two hosts are needed (hosts=h1,h2,...)" )
+	}
+
+	lgen_lock.Lock()
+	defer lgen_lock.Unlock()
+	if lgen != nil {
+		lgen.lock.Lock()
+		busy := lgen.running
+		lgen.lock.Unlock()
+		if busy {
+			return "", fmt.Errorf( "load generation is already running" )
+		}
+	}
+
+	lg := &loadgen {
+		running:	true,
+		requested:	count,
+		unpushed:	make( map[string]bool ),
+		started:	time.Now(),
+	}
+	lgen = lg
+
+	http_sheep.Baa( 1, "loadgen: %d reservations at %.2f/s; %d hosts; duration=%ds bandw=%d", count, rate, len( vhosts ), dur, bandw )
+	go lg.run( vhosts, count, rate, dur, bandw )
+
+	return fmt.Sprintf( `{ "started": true, "count": %d, "rate": %.2f, "hosts": %d }`, count, rate, len( vhosts ) ), nil
+}
+
+/*
+	Submit the requests at the desired rate, then watch for them to be pushed. Runs as
+	a goroutine.
+*/
+func (lg *loadgen) run( hosts []string, count int, rate float64, dur int64, bandw int64 ) {
+	var wg sync.WaitGroup
+
+	gap := time.Duration( float64( time.Second ) / rate )
+	for i := 0; i < count; i++ {
+		h1 := hosts[rand.Intn( len( hosts ) )]
+		h2 := h1
+		for h2 == h1 {
+			h2 = hosts[rand.Intn( len( hosts ) )]
+		}
+
+		wg.Add( 1 )
+		go lg.submit( h1, h2, fmt.Sprintf( "%d", 1024 + i % 64000 ), dur, bandw, &wg )
+		time.Sleep( gap )
+	}
+	wg.Wait()
+
+	lg.lock.Lock()
+	lg.ended = time.Now()
+	lg.lock.Unlock()
+	http_sheep.Baa( 1, "loadgen: all requests submitted: %s", lg.to_json() )
+
+	lg.watch_pushes( dur )
+}
+
+/*
+	Make one reservation and record the outcome. Runs as a goroutine so that requests
+	overlap as they do when they arrive on the API.
+*/
+func (lg *loadgen) submit( h1 string, h2 string, port string, dur int64, bandw int64, wg *sync.WaitGroup ) {
+	defer wg.Done()
+
+	start := time.Now()
+	update_graph( &h1, false, false )
+	update_graph( &h2, true, true )
+
+	rid := mk_resname( )
+	cookie := LOADGEN_COOKIE
+	now := time.Now().Unix()
+	res, err := gizmos.Mk_bw_pledge( &h1, &h2, &port, &zero_string, now, now + dur, bandw, bandw, &rid, &cookie, tclass2dscp["voice"], false )
+	if err == nil {
+		res.Set_cid( mk_cid() )
+		reason, _, nerr, _ := finalise_bw_res( context.Background(), res, res_paused )
+		if nerr > 0 {
+			err = fmt.Errorf( "%s", reason )
+		}
+	}
+	lat := time.Since( start )
+
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+
+	lg.submitted++
+	lg.lat = append( lg.lat, lat )
+	if err != nil {
+		lg.rejected++
+		lg.last_err = fmt.Sprintf( "%s", err )
+		return
+	}
+
+	lg.accepted++
+	lg.unpushed[rid] = true
+	if lg.first_acc.IsZero() {
+		lg.first_acc = time.Now()
+	}
+}
+
+/*
+	Poll the inventory until all accepted reservations have been pushed, or limit seconds
+	have passed.
+*/
+func (lg *loadgen) watch_pushes( limit int64 ) {
+	my_ch := make( chan *ipc.Chmsg )
+	cookie := LOADGEN_COOKIE
+	deadline := time.Now().Add( time.Duration( limit ) * time.Second )
+
+	for time.Now().Before( deadline ) {
+		lg.lock.Lock()
+		pending := make( []string, 0, len( lg.unpushed ) )
+		for rid := range lg.unpushed {
+			pending = append( pending, rid )
+		}
+		lg.lock.Unlock()
+
+		if len( pending ) == 0 {
+			break
+		}
+
+		for i := range pending {
+			req := ipc.Mk_chmsg( )
+			req.Send_req( rmgr_ch, my_ch, REQ_GET, []*string{ &pending[i], &cookie }, nil )
+			req = <- my_ch
+			if p, ok := req.Response_data.( *gizmos.Pledge ); ok && req.State == nil && p != nil && (*p).Is_pushed() {
+				lg.lock.Lock()
+				delete( lg.unpushed, pending[i] )
+				lg.npushed++
+				lg.last_push = time.Now()
+				lg.lock.Unlock()
+			}
+		}
+
+		time.Sleep( time.Second )
+	}
+
+	lg.lock.Lock()
+	lg.running = false
+	lg.lock.Unlock()
+	http_sheep.Baa( 1, "loadgen: finished: %s", lg.to_json() )
+}
+
+/*
+	Generate the status report.
+*/
+func (lg *loadgen) to_json( ) ( string ) {
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+
+	var min, avg, p95, max float64
+	if n := len( lg.lat ); n > 0 {
+		lat := make( []float64, n )
+		sum := 0.0
+		for i, d := range lg.lat {
+			lat[i] = float64( d ) / float64( time.Millisecond )
+			sum += lat[i]
+		}
+		sort.Float64s( lat )
+		min = lat[0]
+		max = lat[n-1]
+		avg = sum / float64( n )
+		p95 = lat[(n * 95) / 100]
+	}
+
+	end := lg.ended
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	push_rate := 0.0
+	if lg.npushed > 0 {
+		if secs := lg.last_push.Sub( lg.first_acc ).Seconds(); secs > 0 {
+			push_rate = float64( lg.npushed ) / secs
+		}
+	}
+
+	return fmt.Sprintf( `{ "running": %v, "requested": %d, "submitted": %d, "accepted": %d, "rejected": %d, "submit_secs": %.3f, "latency_ms": { "min": %.2f, "avg": %.2f, "p95": %.2f, "max": %.2f }, "pushed": %d, "pushed_per_sec": %.2f, "last_error": %q }`,
+		lg.running, lg.requested, lg.submitted, lg.accepted, lg.rejected, end.Sub( lg.started ).Seconds(), min, avg, p95, max, lg.npushed, push_rate, lg.last_err )
+}
@@ -45,6 +45,7 @@
 				24 Nov 2015 - Add options
 				09 Jan 2016 - Add more options
 				06 Mar 2016 - Switched some res mgr requests to special lookup channel to prevent deadlock
+				16 Oct 2026 - Add bandwidth; refuse a mirror whose output is one of its ports
 */
 
 package managers
@@ -60,6 +61,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"github.com/att/gopkgs/clike"
 	"github.com/att/gopkgs/ipc"
 	"github.com/att/tegu/gizmos"
 )
@@ -258,6 +260,9 @@ func convertToJSON(mirror *gizmos.Pledge_mirror, scheme string, host string) (st
 	if options != nil && *options != "" {
 		bs.WriteString(fmt.Sprintf("  \"options\": \"%s\",\n", *options))
 	}
+	if bw := mirror.Get_bandwidth(); bw > 0 {
+		bs.WriteString(fmt.Sprintf("  \"bandwidth\": %d,\n", bw))
+	}
 
 	stdout, stderr := mirror.Get_Output()
 	appendList(bs, stdout, "standard_output")
@@ -527,6 +532,7 @@ func mirror_put( out http.ResponseWriter ) (code int, msg string) {
  *			"vlan": "vlan",                      // optional
  *			"cookie": "value",                   // optional
  *			"name": "mirrorname",                // optional
+ *			"bandwidth": "nnn[KMG]",             // optional; traffic expected, checked against mirror:max_host_bw
  *		}
  *
  *	Because multiple mirrors may be created as a result, we return an array of JSON results, one for each mirror:
@@ -553,6 +559,7 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 		Cookie 		string	 `json:"cookie"`
 		Name 		string	 `json:"name"`
 		Options		string	 `json:"options"`
+		Bandwidth	string	 `json:"bandwidth"`
 	}
 	var req req_type
 	if err := json.Unmarshal(data, &req); err != nil {
@@ -606,6 +613,25 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 		return
 	}
 	req.Output = *newport
+	for _, mirror := range *plist {
+		for _, p := range mirror.ports {
+			if p == req.Output {
+				code = http.StatusBadRequest
+				msg = "Output port is also a mirrored port: "+req.Output
+				return
+			}
+		}
+	}
+
+	bandw := int64( 0 )
+	if req.Bandwidth != "" {
+		bandw = int64( clike.Atof( req.Bandwidth ) )
+		if bandw <= 0 {
+			code = http.StatusBadRequest
+			msg = "Invalid bandwidth: "+req.Bandwidth
+			return
+		}
+	}
 
 	// 6. Validate options, if present
 	if req.Options != "" {
@@ -633,6 +659,7 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 			nam   := mirror.name
 			res, err := gizmos.Mk_mirror_pledge( mirror.ports, &req.Output, stime, etime, &nam, &req.Cookie, &phost, &req.Vlan, &projid, &req.Options )
 			if res != nil {
+				res.( *gizmos.Pledge_mirror ).Set_bandwidth( bandw )
 				req := ipc.Mk_chmsg( )
 				my_ch := make( chan *ipc.Chmsg )					// allocate channel for responses to our requests
 				defer close( my_ch )								// close it on return
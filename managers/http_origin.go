@@ -0,0 +1,100 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+
+	Mnemonic:	http_origin
+	Abstract:	Tracks where reservation requests come from (gizmos/pledge_origin.go). The
+				origin is built from the http request as it arrives (sender address, any
+				X-Forwarded-For, User-Agent and X-Tegu-Client headers, and the token in the
+				X-Auth-Tegu header) and is carried on the request's context. When a request
+				record gives its own token (auth=) that token's fingerprint replaces the
+				header's for the record. The origin is copied to each pledge as it is
+				finalised.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/att/tegu/gizmos"
+)
+
+type origin_ctx_key struct { }
+
+/*
+	Return a context, derived from the request's, that carries the request's origin.
+*/
+func with_origin( in *http.Request ) ( context.Context ) {
+	o := &gizmos.Origin{
+		Addr:	in.RemoteAddr,
+		Fwd:	in.Header.Get( "X-Forwarded-For" ),
+		Agent:	in.Header.Get( "User-Agent" ),
+		Client:	in.Header.Get( "X-Tegu-Client" ),
+		Key:	gizmos.Key_fingerprint( in.Header.Get( "X-Auth-Tegu" ) ),
+	}
+
+	return context.WithValue( in.Context(), origin_ctx_key{ }, o )
+}
+
+/*
+	Return the origin carried by the context; nil if there isn't one.
+*/
+func ctx_origin( ctx context.Context ) ( *gizmos.Origin ) {
+	if ctx == nil {
+		return nil
+	}
+
+	o, _ := ctx.Value( origin_ctx_key{ } ).( *gizmos.Origin )
+	return o
+}
+
+/*
+	Set the key of the context's origin from the authorisation data of a request record.
+	When the data is an address rather than a token the key is cleared (the address is
+	already recorded). Records are processed one at a time so the origin is changed in place.
+*/
+func origin_key( ctx context.Context, auth_data string, is_token bool ) {
+	o := ctx_origin( ctx )
+	if o == nil {
+		return
+	}
+
+	if is_token {
+		o.Key = gizmos.Key_fingerprint( auth_data )
+	} else {
+		o.Key = ""
+	}
+}
+
+/*
+	Copy the context's origin to the pledge, if there is one.
+*/
+func set_origin( ctx context.Context, p gizmos.Pledge ) {
+	if o := ctx_origin( ctx ); o != nil && p != nil {
+		p.Set_origin( o )
+	}
+}
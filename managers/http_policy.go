@@ -0,0 +1,307 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	http_policy
+	Abstract:	Admission policy hook. When a policy URL is configured, every reservation
+				that is about to be created (or modified via handover) is POSTed to the URL
+				as json along with the current utilisation of the links on the candidate
+				path(s). The policy service responds with a json object:
+					{ "action": "approve" | "reject" | "mutate", "reason": "text",
+					  "bandw_in": n, "bandw_out": n, "expiry": n }
+				Bandwidth and expiry are used only when the action is mutate, and only
+				the values that are given (non-zero) are applied. This allows site specific
+				business rules (quotas, clamping, time of day limits) to be applied
+				without changes to tegu.
+
+				The request sent has the form:
+					{ "op": "create" | "modify", "type": "bandwidth" | "oneway" | "passthru" | "multicast",
+					  "cid": "id", "replaces": "id", "pledge": {...}, "paths": [...] }
+
+	CFG:		httpmgr:policy_url - URL of the policy service; hook is disabled if not set
+				httpmgr:policy_timeout - seconds to wait for the service to respond (5)
+				httpmgr:policy_fail - open or closed; whether reservations are accepted (open) or
+					rejected (closed) when the service cannot be reached (closed)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Response from the policy service.
+*/
+type policy_resp struct {
+	Action		string
+	Reason		string
+	Bandw_in	int64
+	Bandw_out	int64
+	Expiry		int64
+}
+
+var (
+	policy_url		string = ""							// empty disables the hook
+	policy_client	*http.Client
+	policy_failopen	bool = false
+)
+
+/*
+	Set up the policy hook from config values. Called once by Http_api before requests
+	are accepted.
+*/
+func policy_init( url *string, timeout *string, fail *string ) {
+	if url == nil || *url == "" {
+		return
+	}
+
+	tsecs := 5
+	if timeout != nil {
+		tsecs = clike.Atoi( *timeout )
+		if tsecs < 1 {
+			tsecs = 1
+		}
+	}
+
+	policy_url = *url
+	policy_client = &http.Client{ Timeout: time.Duration( tsecs ) * time.Second }
+	policy_failopen = fail != nil && *fail == "open"
+
+	http_sheep.Baa( 1, "admission policy hook enabled: %s timeout=%ds fail-open=%v", policy_url, tsecs, policy_failopen )
+}
+
+/*
+	Ask network manager for the path(s) that would be used for the bandwidth pledge without
+	allocating them. The paths (with link allotments) are returned as a json array.
+*/
+func policy_utilisation( res *gizmos.Pledge_bw ) ( string ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( nw_ch, my_ch, REQ_HASCAP, res, nil )
+	req = <- my_ch
+
+	jstr := "[ "
+	if req.Response_data != nil {
+		sep := ""
+		for _, p := range req.Response_data.( []*gizmos.Path ) {
+			if p != nil {
+				jstr += sep + p.To_json()
+				sep = ", "
+			}
+		}
+	}
+
+	return jstr + " ]"
+}
+
+/*
+	Send the pledge to the policy service and return its response. If the service cannot be
+	reached, or its response is garbled, the fail setting determines the action returned.
+*/
+func policy_call( op string, ptype string, res gizmos.Pledge, replaces *string, util string ) ( pr *policy_resp ) {
+	rstr := ""
+	if replaces != nil {
+		rstr = *replaces
+	}
+
+	body := fmt.Sprintf( `{ "op": %q, "type": %q, "cid": %q, "replaces": %q, "pledge": %s, "paths": %s }`, op, ptype, res.Get_cid(), rstr, res.To_json(), util )
+
+	failed := func( err error ) ( *policy_resp ) {
+		http_sheep.Baa( 0, "WRN: admission policy service failed: %s  [TGUHTP003]", err )
+		if policy_failopen {
+			return &policy_resp{ Action: "approve" }
+		}
+		return &policy_resp{ Action: "reject", Reason: "admission policy service unavailable" }
+	}
+
+	resp, err := policy_client.Post( policy_url, "application/json", strings.NewReader( body ) )
+	if err != nil {
+		return failed( err )
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return failed( fmt.Errorf( "status %d", resp.StatusCode ) )
+	}
+
+	rbody, err := ioutil.ReadAll( resp.Body )
+	if err != nil {
+		return failed( err )
+	}
+
+	pr = &policy_resp{}
+	if err = json.Unmarshal( rbody, pr ); err != nil {
+		return failed( err )
+	}
+
+	pr.Action = strings.ToLower( pr.Action )
+	http_sheep.Baa( 2, "admission policy: %s %s cid=%s: %s %s", op, *res.Get_id(), res.Get_cid(), pr.Action, pr.Reason )
+	return
+}
+
+/*
+	Apply the policy to a bandwidth pledge, clamping it if the policy says to. Returns a
+	non-nil error (the reason) if the pledge is rejected.
+*/
+func policy_check_bw( res *gizmos.Pledge_bw ) ( err error ) {
+	if policy_url == "" {
+		return nil
+	}
+
+	op := "create"
+	if res.Get_handover() != nil {
+		op = "modify"
+	}
+
+	pr := policy_call( op, "bandwidth", res, res.Get_handover(), policy_utilisation( res ) )
+	switch pr.Action {
+		case "approve":
+
+		case "mutate":
+			bw_in := res.Get_bandw_in()
+			bw_out := res.Get_bandw_out()
+			if pr.Bandw_in > 0 {
+				bw_in = pr.Bandw_in
+			}
+			if pr.Bandw_out > 0 {
+				bw_out = pr.Bandw_out
+			}
+			res.Set_bandw( bw_in, bw_out )
+			err = policy_expiry( res, pr.Expiry )
+			http_sheep.Baa( 1, "admission policy changed reservation %s: bandwidth in=%d out=%d: %s", *res.Get_id(), bw_in, bw_out, pr.Reason )
+
+		default:
+			err = fmt.Errorf( "rejected by admission policy: %s", pr.Reason )
+	}
+
+	return
+}
+
+/*
+	Apply the policy to a oneway pledge.
+*/
+func policy_check_bwow( res *gizmos.Pledge_bwow ) ( err error ) {
+	if policy_url == "" {
+		return nil
+	}
+
+	pr := policy_call( "create", "oneway", res, nil, "[ ]" )
+	switch pr.Action {
+		case "approve":
+
+		case "mutate":
+			if pr.Bandw_out > 0 {
+				res.Set_bandwidth( pr.Bandw_out )
+			}
+			err = policy_expiry( res, pr.Expiry )
+			http_sheep.Baa( 1, "admission policy changed oneway reservation %s: bandwidth=%d: %s", *res.Get_id(), res.Get_bandwidth(), pr.Reason )
+
+		default:
+			err = fmt.Errorf( "rejected by admission policy: %s", pr.Reason )
+	}
+
+	return
+}
+
+/*
+	Apply the policy to a multicast pledge; mutate may change the per branch bandwidth.
+*/
+func policy_check_mcast( res *gizmos.Pledge_mcast ) ( err error ) {
+	if policy_url == "" {
+		return nil
+	}
+
+	pr := policy_call( "create", "multicast", res, nil, "[ ]" )
+	switch pr.Action {
+		case "approve":
+
+		case "mutate":
+			if pr.Bandw_out > 0 {
+				res.Set_bandwidth( pr.Bandw_out )
+			}
+			err = policy_expiry( res, pr.Expiry )
+			http_sheep.Baa( 1, "admission policy changed multicast reservation %s: bandwidth=%d: %s", *res.Get_id(), res.Get_bandwidth(), pr.Reason )
+
+		default:
+			err = fmt.Errorf( "rejected by admission policy: %s", pr.Reason )
+	}
+
+	return
+}
+
+/*
+	Apply the policy to a passthru pledge. There is nothing to mutate other than the expiry.
+*/
+func policy_check_pt( res *gizmos.Pledge_pass ) ( err error ) {
+	if policy_url == "" {
+		return nil
+	}
+
+	pr := policy_call( "create", "passthru", res, nil, "[ ]" )
+	switch pr.Action {
+		case "approve":
+
+		case "mutate":
+			err = policy_expiry( res, pr.Expiry )
+
+		default:
+			err = fmt.Errorf( "rejected by admission policy: %s", pr.Reason )
+	}
+
+	return
+}
+
+/*
+	Shorten the expiry of the pledge if the policy gave one; the policy may not extend
+	a reservation, nor set an expiry that is before the commence time.
+*/
+func policy_expiry( res gizmos.Pledge, expiry int64 ) ( error ) {
+	if expiry <= 0 {
+		return nil
+	}
+
+	commence, conclude := res.Get_window()
+	if expiry <= commence {
+		return fmt.Errorf( "admission policy expiry (%d) is before the reservation start", expiry )
+	}
+	if expiry < conclude {
+		res.Set_expiry( expiry )
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	http_pprof
+	Abstract:	Go profiles of the running tegu for tuning long lived deployments. When enabled,
+				GET requests under /tegu/debug/pprof/ return:
+
+					/tegu/debug/pprof/				- list of the profiles
+					/tegu/debug/pprof/profile		- cpu profile (seconds=n, default 30, max 300)
+					/tegu/debug/pprof/<name>		- named profile (heap, goroutine, allocs, block,
+													  mutex, threadcreate); debug=n for text
+
+				The output is what go tool pprof expects. The requester must pass the same
+				authorisation as other admin requests (a token with an admin role in the
+				X-Auth-Tegu header, or the local address depending on httpmgr:priv_auth).
+
+				Net/http/pprof is not used as importing it registers unauthenticated handlers
+				on the default mux which tegu listens with.
+
+	CFG:		httpmgr:pprof - true to enable the endpoints (false)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+const (
+	PPROF_MAX_SECS	int = 300				// longest cpu profile allowed
+)
+
+/*
+	Handle a request for a profile.
+*/
+func pprof_handler( out http.ResponseWriter, in *http.Request ) {
+	if in.Method != "GET" {
+		http.Error( out, "only GET is supported", http.StatusMethodNotAllowed )
+		return
+	}
+
+	auth := in.RemoteAddr
+	is_token := false
+	if in.Header != nil && in.Header["X-Auth-Tegu"] != nil {
+		auth = in.Header["X-Auth-Tegu"][0]
+		is_token = true
+	}
+	if ! validate_auth( &auth, is_token, admin_roles ) {
+		http_sheep.Baa( 1, "pprof request refused: not authorised: %s", in.RemoteAddr )
+		http.Error( out, "a valid token with an admin role is required", http.StatusUnauthorized )
+		return
+	}
+
+	name := strings.TrimPrefix( in.URL.Path, "/tegu/debug/pprof/" )
+	debug := clike.Atoi( in.FormValue( "debug" ) )
+	http_sheep.Baa( 1, "pprof request: %q from %s", name, in.RemoteAddr )
+
+	switch name {
+		case "":
+			out.Header().Set( "Content-Type", "text/plain; charset=utf-8" )
+			fmt.Fprintf( out, "profile\t\tcpu profile; seconds=n (default 30)\n" )
+			for _, p := range pprof.Profiles() {
+				fmt.Fprintf( out, "%s\t%d\n", p.Name(), p.Count() )
+			}
+
+		case "profile":
+			secs := clike.Atoi( in.FormValue( "seconds" ) )
+			if secs <= 0 {
+				secs = 30
+			}
+			if secs > PPROF_MAX_SECS {
+				secs = PPROF_MAX_SECS
+			}
+
+			out.Header().Set( "Content-Type", "application/octet-stream" )
+			if err := pprof.StartCPUProfile( out ); err != nil {			// fails if one is already running
+				http.Error( out, fmt.Sprintf( "unable to start cpu profile: %s", err ), http.StatusConflict )
+				return
+			}
+			select {
+				case <- time.After( time.Duration( secs ) * time.Second ):
+				case <- in.Context().Done():
+			}
+			pprof.StopCPUProfile( )
+
+		default:
+			p := pprof.Lookup( name )
+			if p == nil {
+				http.Error( out, fmt.Sprintf( "unknown profile: %s", name ), http.StatusNotFound )
+				return
+			}
+
+			if debug > 0 {
+				out.Header().Set( "Content-Type", "text/plain; charset=utf-8" )
+			} else {
+				out.Header().Set( "Content-Type", "application/octet-stream" )
+			}
+			if err := p.WriteTo( out, debug ); err != nil {
+				http_sheep.Baa( 1, "pprof: unable to write %s profile: %s", name, err )
+			}
+	}
+}
@@ -0,0 +1,228 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	ipc_ctx
+	Abstract:	Requests to network manager which can be cancelled. The context is passed as
+				the requestor data on the message so that network manager can drop a request
+				whose requester has gone away (http client disconnected, or the deadline passed)
+				rather than computing (and obligating) a path that nobody will use. The requester
+				waits only until the context is done so that a wedged network manager doesn't
+				block the http or reservation manager goroutines forever.
+
+				A response that arrives after the requester gave up is passed to the late
+				function, if supplied, so that capacity which the network set aside can be
+				given back.
+
+				Requests made on behalf of an API request which aren't cancellable carry the
+				request's correlation id (mk_cid() in http_api.go) as the requestor data so
+				that the manager can log it (req_cid()). Those which are cancellable carry the
+				id as a value of the context (nw_ctx()).
+
+	CFG:		default:nw_timeout - seconds to wait for network manager to respond (60)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Nw_req goes through the network provider (network_provider.go).
+				16 Oct 2026 - Added req_cid() and baa_req().
+				16 Oct 2026 - The correlation id is carried in the context of cancellable requests.
+*/
+
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+var nw_timeout = 60 * time.Second
+
+type cid_key struct{ }						// context value key for the correlation id
+
+/*
+	Read the timeout from the config. Called from Initialise.
+*/
+func ipc_ctx_init( ) {
+	if p := cfg_data["default"]["nw_timeout"]; p != nil {
+		if t := clike.Atoi( *p ); t > 0 {
+			nw_timeout = time.Duration( t ) * time.Second
+		}
+	}
+}
+
+/*
+	Return a context which is done when the parent is, or when the network timeout passes.
+	Parent may be nil. The correlation id, if not empty, is carried by the context so that
+	the responder can find it (req_cid()).
+*/
+func nw_ctx( parent context.Context, cid string ) ( context.Context, context.CancelFunc ) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	if cid != "" {
+		parent = context.WithValue( parent, cid_key{ }, cid )
+	}
+
+	return context.WithTimeout( parent, nw_timeout )
+}
+
+/*
+	Return the correlation id carried by the context; empty if there isn't one.
+*/
+func ctx_cid( ctx context.Context ) ( string ) {
+	if ctx == nil {
+		return ""
+	}
+
+	cid, _ := ctx.Value( cid_key{ } ).( string )
+	return cid
+}
+
+/*
+	Send the request to dest and wait for the response or for the context to be done. The
+	response channel is buffered so that the responder never blocks on a requester that
+	has given up. When the context is done first the returned message has only the state
+	set, and late (if not nil) is driven with the response if it ever arrives.
+*/
+func ctx_req( ctx context.Context, dest chan *ipc.Chmsg, mtype int, data interface{}, late func( *ipc.Chmsg ) ) ( *ipc.Chmsg ) {
+	ch := make( chan *ipc.Chmsg, 1 )
+	req := ipc.Mk_chmsg( )
+	req.Send_req( dest, ch, mtype, data, ctx )
+
+	select {
+		case req = <- ch:
+			return req
+
+		case <- ctx.Done():
+	}
+
+	if late != nil {
+		go func( ) {
+			late( <- ch )
+		}( )
+	}
+
+	creq := ipc.Mk_chmsg( )
+	creq.State = mk_err( ERR_TIMEOUT, "request abandoned: %s", ctx.Err() )
+	return creq
+}
+
+/*
+	Send a request to network manager (by way of the provider) and wait for the response, giving up after the
+	network timeout. Late may be nil. When the data is a pledge its correlation id goes with the request.
+*/
+func nw_req( mtype int, data interface{}, late func( *ipc.Chmsg ) ) ( *ipc.Chmsg ) {
+	cid := ""
+	switch p := data.(type) {
+		case gizmos.Pledge:
+			cid = p.Get_cid()
+		case *gizmos.Pledge:
+			if p != nil && *p != nil {
+				cid = (*p).Get_cid()
+			}
+	}
+
+	return nw_cid_req( cid, mtype, data, late )
+}
+
+/*
+	Send a request to network manager as nw_req() does, with the correlation id given.
+*/
+func nw_cid_req( cid string, mtype int, data interface{}, late func( *ipc.Chmsg ) ) ( *ipc.Chmsg ) {
+	ctx, cancel := nw_ctx( nil, cid )
+	defer cancel( )
+
+	return net_prov.Send( ctx, mtype, data, late )
+}
+
+/*
+	Used by the responder: returns true if the requester's context is done. The request
+	state is set so that the caller need only stop processing and respond.
+*/
+func req_cancelled( req *ipc.Chmsg ) ( bool ) {
+	ctx, ok := req.Requestor_data.( context.Context )
+	if ! ok || ctx.Err() == nil {
+		return false
+	}
+
+	req.State = mk_err( ERR_TIMEOUT, "request abandoned by requester: %s", ctx.Err() )
+	return true
+}
+
+/*
+	Used by the responder: returns the correlation id carried by the request, either in the
+	context of a cancellable request or as the requestor data; empty if the requester
+	didn't supply one.
+*/
+func req_cid( req *ipc.Chmsg ) ( string ) {
+	if req == nil {
+		return ""
+	}
+
+	if ctx, ok := req.Requestor_data.( context.Context ); ok {
+		return ctx_cid( ctx )
+	}
+
+	cid, _ := req.Requestor_data.( string )
+	return cid
+}
+
+/*
+	Bleat that a manager is processing the request. A request with a correlation id is given
+	at level 2 so that it can be followed from the api without the chatter of level 3.
+*/
+func baa_req( sheep *bleater.Bleater, req *ipc.Chmsg ) {
+	if cid := req_cid( req ); cid != "" {
+		sheep.Baa( 2, "processing request %d cid=%s", req.Msg_type, cid )
+	} else {
+		sheep.Baa( 3, "processing request %d", req.Msg_type )
+	}
+}
+
+/*
+	Return a late function for a reservation request which gives back what the network
+	set aside for the pledge.
+*/
+func release_late( gp gizmos.Pledge ) ( func( *ipc.Chmsg ) ) {
+	return func( req *ipc.Chmsg ) {
+		if req.Response_data == nil {
+			return
+		}
+
+		switch p := gp.(type) {
+			case *gizmos.Pledge_bw:
+				p.Set_path_list( req.Response_data.( []*gizmos.Path ) )
+			case *gizmos.Pledge_mcast:
+				p.Set_path_list( req.Response_data.( []*gizmos.Path ) )
+			case *gizmos.Pledge_bwow:
+				p.Set_gate( req.Response_data.( *gizmos.Gate ) )
+		}
+
+		rm_sheep.Baa( 1, "late network response for abandoned reservation; releasing: %s", *gp.Get_id() )
+		release_refused( &gp )
+	}
+}
@@ -93,6 +93,32 @@
 				12 Apr 2016 - Additional error checking in PHOST processing to prevent stack dump.
 				20 May 2016 - Added discount support to one-way reservations.
 				20 Apr 2017 - Correct possible nil pointer reference.
+				16 Oct 2026 - Publish topology change events.
+				16 Oct 2026 - Build the graph from the simulation topology in simulation mode.
+				16 Oct 2026 - Added snapshot request.
+				16 Oct 2026 - Multicast reservations: a path to each receiver with shared links obligated once.
+				16 Oct 2026 - Path and host lookup failures return typed errors (tegu_err.go).
+				16 Oct 2026 - Reservation requests abandoned by the requester are dropped (ipc_ctx.go).
+				16 Oct 2026 - Keep a history of link obligations (network_hist.go).
+				16 Oct 2026 - Added over-capacity check (res_mgr_capcheck.go).
+				16 Oct 2026 - Added links exist request for the consistency check (res_mgr_consist.go).
+				16 Oct 2026 - Added queue map detail request (network_qmap.go).
+				16 Oct 2026 - Added availability zone policies to bw and multicast admission (network_az.go).
+				16 Oct 2026 - Router external legs obligated for bw reservations (network_gw.go).
+				16 Oct 2026 - Floating ip moves applied to maps and passed to res_mgr (network_fip.go).
+				16 Oct 2026 - Added project member request for dscp trust reservations.
+				16 Oct 2026 - Link capacities learned from the agents' ovs inventory (network_inv.go).
+				16 Oct 2026 - Reservations with a quarantined endpoint are rejected (network_quarantine.go).
+				16 Oct 2026 - Time of day link capacity schedule from the config.
+				16 Oct 2026 - Added placement hints (network_place.go).
+				16 Oct 2026 - Added compaction of link obligations (compact.go).
+				16 Oct 2026 - Added the path cache (network_pcache.go).
+				16 Oct 2026 - Added reachability pre-check (network_reach.go).
+				16 Oct 2026 - Added batch name translation request.
+				16 Oct 2026 - Track the age of the mac2phost map and ask for a new one when stale.
+				16 Oct 2026 - Added link load request (reservation re-optimisation).
+				16 Oct 2026 - Requests are logged with their correlation id.
+				16 Oct 2026 - Link sampling reports when it can not be scheduled.
 */
 
 package managers
@@ -131,6 +157,7 @@ type Network struct {
 	vmip2gw		map[string]*string			// vmid to it's gateway
 	vmid2ip		map[string]*string			// vmid to ip address	Tegu-lite
 	mac2phost	map[string]*string			// mac to phost map generated from OVS agent data (needed to include gateways in graph)
+	m2p_age		*map_age					// when mac2phost was last received from the agents
 	gwmap		map[string]*string			// mac to ip map for the gateways	(needed to include gateways in graph)
 	ip2fip		map[string]*string			// projects/ip to floating ip address translation
 	fip2ip		map[string]*string			// floating ip address to projects/ip translation
@@ -138,6 +165,7 @@ type Network struct {
 	mlags		map[string]*gizmos.Mlag		// reference to each mlag link group by name
 	hupdate		bool						// set to true only if hosts is updated after gwmap has size (chkpt reload timing)
 	relaxed		bool						// if true, we're in relaxed mode which means we don't path find or do admission control.
+	fl_links	[]gizmos.FL_link_json		// links that the graph was built from (snapshots)
 }
 
 
@@ -202,6 +230,10 @@ func (n *Network) build_hlist( ) ( hlist []gizmos.FL_host_json ) {
 		}
 
 		if n.gwmap != nil {										// add in the gateways which are not reported by openstack
+			if now := time.Now().Unix(); n.m2p_age.is_stale( now ) && n.m2p_age.ask( now, 0 ) {
+				net_sheep.Baa( 1, "WRN: build_hlist: mac2phost map is stale (age=%ds); asking agents for a new one  [TGUNET020]", n.m2p_age.age( now ) )
+				ask_mac2phost( )										// gateways are placed using the old map until it arrives
+			}
 			if n.mac2phost != nil && len( n.mac2phost ) > 0 {
 				for mac, ip := range n.gwmap {
 					if n.mac2phost[mac] == nil {
@@ -318,6 +350,26 @@ func (net *Network) insert_vm( vm *Net_vm ) {
 	}
 }
 
+/*
+	Return the VMs that we know about in the project: project/ip mapped to physical host.
+	Router ports are not VMs and are skipped, as are VMs whose physical host isn't known.
+*/
+func (n *Network) proj_members( pid string ) ( members map[string]*string ) {
+	members = make( map[string]*string )
+	pfx := pid + "/"
+
+	for ip, mac := range n.ip2mac {
+		if mac == nil || ! strings.HasPrefix( ip, pfx ) || n.gwmap[*mac] != nil {
+			continue
+		}
+		if ph := n.mac2phost[*mac]; ph != nil {
+			members[ip] = ph
+		}
+	}
+
+	return members
+}
+
 
 /*
 	Given a user name find a fence in the table, or copy the defaults and
@@ -378,6 +430,7 @@ func (n *Network) update_mac2phost( list []string, phost_suffix *string ) {
 		n.mac2phost = make( map[string]*string )
 	}
 
+	changed := false
 	for i := range list {
 		toks := strings.Split( list[i], " " )
 		dup_str := toks[0]
@@ -385,10 +438,14 @@ func (n *Network) update_mac2phost( list []string, phost_suffix *string ) {
 			stoks := strings.Split( toks[0], *phost_suffix )
 			dup_str = stoks[0]
 		}
+		if old := n.mac2phost[toks[1]]; old == nil || *old != dup_str {
+			changed = true
+		}
 		n.mac2phost[toks[1]] = &dup_str
 	}
+	n.m2p_age.touch( changed )
 
-	net_sheep.Baa( 2, "mac2phost map updated; has %d elements (list had %d elements)", len( n.mac2phost ), len( list ) )
+	net_sheep.Baa( 2, "mac2phost map updated; has %d elements (list had %d elements) changed=%v", len( n.mac2phost ), len( list ), changed )
 }
 
 /*
@@ -495,7 +552,7 @@ func (n *Network) name2ip( hname *string ) (ip *string, err error) {
 
 	if *hname == "" {
 		net_sheep.Baa( 1, "bad name passed to name2ip: empty" )
-		err = fmt.Errorf( "host unknown: empty name passed to network manager" )
+		err = mk_err( ERR_NOT_FOUND, "host unknown: empty name passed to network manager" )
 		return
 	}
 
@@ -519,7 +576,7 @@ func (n *Network) name2ip( hname *string ) (ip *string, err error) {
 		}
 		if ip != nil {							// the name translates, see if it's in the known net
 			if n.hosts[*ip] == nil {			// ip isn't in the network scope as a host, return nil
-				err = fmt.Errorf( "host unknown: %s maps to an IP, but IP not known to SDNC: %s", *hname, *ip )
+				err = mk_err( ERR_NOT_FOUND, "host unknown: %s maps to an IP, but IP not known to SDNC: %s", *hname, *ip )
 				ip = nil
 			} else {
 				if (*hname)[0:1] == "!" {					// ensure that we return the ip with the leading bang
@@ -528,7 +585,7 @@ func (n *Network) name2ip( hname *string ) (ip *string, err error) {
 				}
 			}
 		} else {
-			err = fmt.Errorf( "host unknown: %s could not be mapped to an IP address", *hname )
+			err = mk_err( ERR_NOT_FOUND, "host unknown: %s could not be mapped to an IP address", *hname )
 		}
 	}
 
@@ -684,12 +741,16 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 
 
 	// REVAMP:   eliminate the floodlight call openstack interface should be sending us a list of endpoints to use; use them directly
-	if strings.Index( *flhost, ":" ) >= 0  {
+	if sim_net == nil && strings.Index( *flhost, ":" ) >= 0  {
 		links = gizmos.FL_links( flhost )					// request the current set of links from floodlight
 		hlist = gizmos.FL_hosts( flhost )					// get a current host list from floodlight
 	} else {
 		hlist = old_net.build_hlist()						// simulate output from floodlight by building the host list from openstack maps
-		links, err = gizmos.Read_json_links( *flhost )		// build links from the topo file; if empty/missing, we'll generate a dummy next
+		if sim_net != nil {
+			links = sim_net.Links							// simulation mode; links come from the simulation topology
+		} else {
+			links, err = gizmos.Read_json_links( *flhost )	// build links from the topo file; if empty/missing, we'll generate a dummy next
+		}
 		if err != nil || len( links ) <= 0 {
 			if host_list != nil {
 				net_sheep.Baa_some( "star", 500, 1, "generating a dummy star topology: json file empty, or non-existent: %s", *flhost )
@@ -717,8 +778,10 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 	if hlist == nil {
 		return
 	}
+	n.fl_links = links
 
 	if ! skip_lupdate {										// if we must update the links -- expensive
+		pcache.topology( links )							// cached paths are flushed if the links are different
 		for i := range links {								// parse all links returned from the controller (build our graph of switches and links)
 			if links[i].Capacity <= 0 {
 				links[i].Capacity = max_capacity			// default if it didn't come from the source
@@ -1012,6 +1075,7 @@ func (net *Network) xfer_maps( old_net *Network ) {
 	net.vmip2gw = old_net.vmip2gw
 	net.ip2mac = old_net.ip2mac
 	net.mac2phost = old_net.mac2phost
+	net.m2p_age = old_net.m2p_age
 	net.gwmap = old_net.gwmap
 	net.fip2ip = old_net.fip2ip
 	net.ip2fip = old_net.ip2fip
@@ -1045,7 +1109,9 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 		next_netbuild	int64 = 0					// prevent rebuilds too closely spaced
 	)
 
-	if *sdn_host  == "" {
+	if sim_net != nil {
+		sdn_host = &sim_net.fname								// build uses the simulation links; this is for the log
+	} else if *sdn_host  == "" {
 		sdn_host = cfg_data["default"]["sdn_host"]
 		if sdn_host == nil {
 			sdn_host = cfg_data["default"]["static_phys_graph"]
@@ -1124,6 +1190,18 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 			link_headroom = clike.Atoi( *p )							// percentage that we should take all link capacities down by
 		}
 
+		if p := cfg_data["network"]["cap_schedule"]; p != nil {			// time of day reservable ceiling on links (gizmos/cap_sched.go)
+			tz := ""
+			if z := cfg_data["network"]["cap_schedule_tz"]; z != nil {
+				tz = *z
+			}
+			if err := gizmos.Set_cap_schedule( *p, tz ); err != nil {
+				net_sheep.Baa( 0, "WRN: invalid setting in config: network:cap_schedule is not used: %s  [TGUNET018]", err )
+			} else {
+				net_sheep.Baa( 1, "link capacity schedule set: %s", *p )
+			}
+		}
+
 		if p := cfg_data["network"]["link_alarm"]; p != nil {
 			link_alarm_thresh = clike.Atoi( *p )						// percentage of total capacity when an alarm is generated
 		}
@@ -1152,6 +1230,7 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 	if act_net == nil {
 		net_sheep.Baa( 0, "ERR: initial build of network failed -- core dump likely to follow!  [TGUNET011]" )		// this is bad and WILL cause a core dump
 	} else {
+		act_net.m2p_age = mk_map_age( map_max_age() )
 		net_sheep.Baa( 1, "initial network graph has been built" )
 		act_net.limits = limits
 		act_net.Set_relaxed( relaxed )
@@ -1160,13 +1239,19 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 	tklr.Add_spot( 2, nch, REQ_CHOSTLIST, nil, 1 ) 		 							// tickle once, very soon after starting, to get a host list
 	tklr.Add_spot( int64( refresh * 2 ), nch, REQ_CHOSTLIST, nil, ipc.FOREVER )  	// get a host list from openstack now and again
 	tklr.Add_spot( int64( refresh ), nch, REQ_NETUPDATE, nil, ipc.FOREVER )			// add tickle spot to drive rebuild of network
+	if link_hist_init( ) {
+		add_spot( tklr, net_sheep, "TGUNET021", "link history sampling", LINK_HIST_IVL, nch, REQ_LINK_SAMPLE, ipc.FOREVER )		// sample link obligations for the history
+	}
+	az_init( )
+	gw_init( link_alarm_thresh )
+	path_cache_init( )
 
 	for {
 		select {					// assume we might have multiple channels in future
 			case req = <- nch:
 				req.State = nil				// nil state is OK, no error
 
-				net_sheep.Baa( 3, "processing request %d", req.Msg_type )			// we seem to wedge in network, this will be chatty, but may help
+				baa_req( net_sheep, req )			// we seem to wedge in network, this will be chatty, but may help
 				switch req.Msg_type {
 					case REQ_NOOP:			// just ignore -- acts like a ping if there is a return channel
 
@@ -1205,21 +1290,24 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							} else {
 								req.Response_data = nil
 								if i_cap_trip {
-									req.State = fmt.Errorf( "unable to generate a path: no capacity (h1<-h2)" )		// tedious, but we'll break out direction
+									req.State = mk_err( ERR_CAPACITY, "unable to generate a path: no capacity (h1<-h2)" )		// tedious, but we'll break out direction
 								} else {
 									if o_cap_trip {
-										req.State = fmt.Errorf( "unable to generate a path: no capacity (h1->h2)" )
+										req.State = mk_err( ERR_CAPACITY, "unable to generate a path: no capacity (h1->h2)" )
 									} else {
-										req.State = fmt.Errorf( "unable to generate a path:  no path" )
+										req.State = mk_err( ERR_NO_PATH, "unable to generate a path:  no path" )
 									}
 								}
 							}
 						} else {
 							net_sheep.Baa( 1, "internal mishap: pledge passed to has capacity wasn't a bw pledge: %s", p )
-							req.State = fmt.Errorf( "unable to create reservation in network, internal data corruption." )
+							req.State = mk_err( ERR_INTERNAL, "unable to create reservation in network, internal data corruption." )
 						}
 
 					case REQ_BWOW_RESERVE:								// one way bandwidth reservation, nothing really to vet, return a gate block
+						if req_cancelled( req ) {						// requester gave up while this was queued
+							break
+						}
 						// host names are expected to have been vetted (if needed) and translated to project-id/IPaddr if IDs are enabled
 						var ipd *string
 						var dh  *gizmos.Host
@@ -1231,7 +1319,7 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 
 							if src != nil && dest != nil {
 
-								net_sheep.Baa( 1,  "network: bwow reservation request received: %s -> %s", *src, *dest )
+								net_sheep.Baa( 1,  "network: bwow reservation request received: %s -> %s cid=%s", *src, *dest, p.Get_cid() )
 
 								usr := "nobody"											// default dummy user if not project/host
 								toks := strings.SplitN( *src, "/", 2 )					// suss out project name
@@ -1244,6 +1332,11 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 									ipd, _ = act_net.name2ip( dest )				// for an external dest, this can be nil which is not an error
 								} 
 								if ips != nil {
+									if err = act_net.quar_admit( ips, ipd ); err != nil {
+										net_sheep.Baa( 1, "owreserve: rejected: %s", err )
+										req.State = err
+										break
+									}
 									sh := act_net.hosts[*ips]
 									if ipd != nil {
 										dh = act_net.hosts[*ipd]						// this will be nil for an external IP
@@ -1299,7 +1392,7 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 										} else {
 											name = *namep
 										}
-										req.State = fmt.Errorf( "unable to create oneway reservation for %d: no capacity on (v)switch: %s", p.Get_bandwidth(), name ) 
+										req.State = mk_err( ERR_CAPACITY, "unable to create oneway reservation for %d: no capacity on (v)switch: %s", p.Get_bandwidth(), name ) 
 									}
 								} else {
 									net_sheep.Baa( 1, "cant map %s to ip: %s", src )
@@ -1311,17 +1404,21 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							}
 						} else {									// pledge wasn't a bw pledge
 							net_sheep.Baa( 1, "internal mishap: pledge passed to owreserve wasn't a bwow pledge: %s", p )
-							req.State = fmt.Errorf( "unable to create oneway reservation in network, internal data corruption." )
+							req.State = mk_err( ERR_INTERNAL, "unable to create oneway reservation in network, internal data corruption." )
 						}
 
 					case REQ_BW_RESERVE:
 						var ip2		*string = nil					// tmp pointer for this block
 
+						if req_cancelled( req ) {						// requester gave up while this was queued; don't obligate a path nobody wants
+							break
+						}
+
 						// host names are expected to have been vetted (if needed) and translated to project-id/name if IDs are enabled
 						p, ok := req.Req_data.( *gizmos.Pledge_bw )
 						if ok {
 							h1, h2, _, _, commence, expiry, bandw_in, bandw_out := p.Get_values( )		// ports can be ignored
-							net_sheep.Baa( 1,  "network: bw reservation request received: %s -> %s  from %d to %d", *h1, *h2, commence, expiry )
+							net_sheep.Baa( 1,  "network: bw reservation request received: %s -> %s  from %d to %d cid=%s", *h1, *h2, commence, expiry, p.Get_cid() )
 
 							suffix := "bps"
 							if discount > 0 {
@@ -1349,6 +1446,11 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							}
 
 							if err == nil {
+								if err = act_net.quar_admit( ip1, ip2 ); err != nil {
+									net_sheep.Baa( 1, "bw reservation rejected: %s", err )
+									req.State = err
+									break
+								}
 								net_sheep.Baa( 2,  "network: attempt to find path between  %s -> %s", *ip1, *ip2 )
 								pcount_out, path_list_out, o_cap_trip := act_net.build_paths( ip1, ip2, commence, expiry, bandw_out, find_all_paths, false ); 	// outbound path
 								pcount_in, path_list_in, i_cap_trip := act_net.build_paths( ip2, ip1, commence, expiry, bandw_in, find_all_paths, true ); 		// inbound path
@@ -1367,6 +1469,19 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 										pcount++
 									}
 
+									if err = act_net.az_admit( ip1, []*string{ ip2 }, path_list, commence, expiry ); err != nil {		// zone policies apply before anything is obligated
+										net_sheep.Baa( 1, "bw reservation rejected by availability zone policy: %s", err )
+										req.Response_data = nil
+										req.State = err
+										break
+									}
+									if err = act_net.gw_admit( path_list, commence, expiry ); err != nil {		// router external legs aren't in the graph
+										net_sheep.Baa( 1, "bw reservation rejected: %s", err )
+										req.Response_data = nil
+										req.State = err
+										break
+									}
+
 									qid := p.Get_id()											// for now, the queue id is just the reservation id, so fetch
 									p.Set_qid( qid )											// and add the queue id to the pledge
 
@@ -1379,18 +1494,19 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 											path_list[i].Inc_mlag( commence, expiry, path_list[i].Get_bandwidth(), fence, act_net.mlags )
 										}
 									}
+									act_net.gw_obligate( path_list, commence, expiry, 1 )
 
 									req.Response_data = path_list
 									req.State = nil
 								} else {
 									req.Response_data = nil
 									if i_cap_trip {
-										req.State = fmt.Errorf( "unable to generate a path: no capacity (h1<-h2)" )		// tedious, but we'll break out direction
+										req.State = mk_err( ERR_CAPACITY, "unable to generate a path: no capacity (h1<-h2)" )		// tedious, but we'll break out direction
 									} else {
 										if o_cap_trip {
-											req.State = fmt.Errorf( "unable to generate a path: no capacity (h1->h2)" )
+											req.State = mk_err( ERR_CAPACITY, "unable to generate a path: no capacity (h1->h2)" )
 										} else {
-											req.State = fmt.Errorf( "unable to generate a path:  no path" )
+											req.State = mk_err( ERR_NO_PATH, "unable to generate a path:  no path" )
 										}
 									}
 									net_sheep.Baa( 0,  "no paths in list: %s  cap=%v/%v", req.State, i_cap_trip, o_cap_trip )
@@ -1401,9 +1517,91 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							}
 						} else {									// pledge wasn't a bw pledge
 							net_sheep.Baa( 1, "internal mishap: pledge passed to reserve wasn't a bw pledge: %s", p )
-							req.State = fmt.Errorf( "unable to create reservation in network, internal data corruption." )
+							req.State = mk_err( ERR_INTERNAL, "unable to create reservation in network, internal data corruption." )
+						}
+
+					case REQ_MCAST_RESERVE:						// find a branch from the source to each receiver; together they are the tree
+						if req_cancelled( req ) {
+							break
+						}
+						p, ok := req.Req_data.( *gizmos.Pledge_mcast )
+						if ! ok {
+							net_sheep.Baa( 1, "internal mishap: pledge passed to mcreserve wasn't a multicast pledge: %s", req.Req_data )
+							req.State = mk_err( ERR_INTERNAL, "unable to create multicast reservation in network, internal data corruption." )
+							break
+						}
+
+						src, _ := p.Get_hosts( )
+						commence, expiry := p.Get_window( )
+						bandw := p.Get_bandwidth( )
+						if discount > 0 {
+							if discount < 101 {
+								bandw -= (bandw * discount)/100
+							} else {
+								bandw -= discount
+							}
+							if bandw < 10 {
+								bandw = 10
+							}
+						}
+						net_sheep.Baa( 1,  "network: multicast reservation request received: %s -> %d receivers from %d to %d cid=%s", *src, len( p.Get_receivers() ), commence, expiry, p.Get_cid() )
+
+						ip1, err := act_net.name2ip( src )
+						path_list := make( []*gizmos.Path, 0, len( p.Get_receivers() ) )
+						rips := make( []*string, 0, len( p.Get_receivers() ) )
+						for _, r := range p.Get_receivers() {
+							if err != nil {
+								break
+							}
+							if req_cancelled( req ) {				// a large tree takes a while; stop if nobody is waiting
+								err = req.State
+								break
+							}
+
+							var ip2 *string
+							ip2, err = act_net.name2ip( r )
+							if err == nil {
+								err = act_net.quar_admit( ip1, ip2 )
+							}
+							if err != nil {
+								break
+							}
+
+							pcount, plist, cap_trip := act_net.build_paths( ip1, ip2, commence, expiry, bandw, find_all_paths, false )
+							if pcount <= 0 {
+								if cap_trip {
+									err = mk_err( ERR_CAPACITY, "unable to generate a path to receiver %s: no capacity", *r )
+								} else {
+									err = mk_err( ERR_NO_PATH, "unable to generate a path to receiver %s: no path", *r )
+								}
+								break
+							}
+							path_list = append( path_list, plist[0:pcount]... )
+							rips = append( rips, ip2 )
 						}
 
+						if err == nil {
+							err = act_net.az_admit( ip1, rips, path_list, commence, expiry )
+						}
+
+						if err != nil {
+							net_sheep.Baa( 0,  "multicast reservation rejected: %s", err )
+							req.State = err
+							break
+						}
+
+						qid := p.Get_id()
+						p.Set_qid( qid )
+						seen := make( map[*gizmos.Link]bool )						// links shared by branches are obligated once
+						for i, path := range path_list {
+							fence := act_net.get_fence( path.Get_usr() )
+							net_sheep.Baa( 2,  "\tbranch[%d]: %s", i, path.To_str( ) )
+							path.Set_tree_queue( qid, commence, expiry, path.Get_bandwidth(), fence, seen )
+						}
+
+						req.Response_data = path_list
+						req.State = nil
+
 					case REQ_PT_RESERVE:						// passthru reservations are allowed only in relaxed mode and only if user has link capacity set
 						req.Response_data = false				// assume bad
 						if req.Req_data != nil {
@@ -1435,6 +1633,7 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 									net_sheep.Baa( 1,  "network: deleting path %d associated with usr=%s", i, *fence.Name )
 									path_list[i].Set_queue( qid, commence, expiry, -path_list[i].Get_bandwidth(), fence )		// reduce queues on the path as needed
 								}
+								act_net.gw_obligate( path_list, commence, expiry, -1 )
 
 							case *gizmos.Pledge_bwow:
 								net_sheep.Baa( 1,  "network: deleting oneway reservation: %s", *p.Get_id() )
@@ -1443,6 +1642,15 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 								fence := act_net.get_fence( gate.Get_usr() )
 								gate.Set_queue( p.Get_qid(), commence, expiry, -p.Get_bandwidth(), fence )				// reduce queues
 
+							case *gizmos.Pledge_mcast:
+								net_sheep.Baa( 1,  "network: deleting multicast reservation: %s", *p.Get_id() )
+								commence, expiry := p.Get_window( )
+								seen := make( map[*gizmos.Link]bool )				// release shared links once, as they were obligated
+								for _, path := range p.Get_path_list( ) {
+									fence := act_net.get_fence( path.Get_usr() )
+									path.Set_tree_queue( p.Get_qid(), commence, expiry, -path.Get_bandwidth(), fence, seen )
+								}
+
 							default:
 								net_sheep.Baa( 1, "internal mishap: req_del wasn't passed a bandwidth or oneway pledge; nothing done by network" )
 							
@@ -1581,6 +1789,13 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							req.State = fmt.Errorf( "no data passed on request channel" )
 						}
 						
+					case REQ_PROJ_MEMBERS:						// given a project id, return the project's VMs and their physical hosts
+						if req.Req_data != nil {
+							req.Response_data = act_net.proj_members( *(req.Req_data.( *string )) )
+						} else {
+							req.State = fmt.Errorf( "no data passed on request channel" )
+						}
+
 					case REQ_GETIP:								// given a VM name or ID return the IP if we know it.
 						if req.Req_data != nil {
 							s := req.Req_data.( *string )
@@ -1588,6 +1803,19 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 						} else {
 							req.State = fmt.Errorf( "no data passed on request channel" )
 						}
+					case REQ_GETIPS:							// list of names; map back of those that translated
+						if names, ok := req.Req_data.( []string ); ok {
+							ips := make( map[string]*string, len( names ) )
+							for i := range names {
+								if ip, err := act_net.name2ip( &names[i] ); err == nil && ip != nil {
+									ips[names[i]] = ip
+								}
+							}
+							req.Response_data = ips
+						} else {
+							req.State = fmt.Errorf( "no name list passed on request channel" )
+						}
+
 					case REQ_HOSTINFO:							// generate a string with mac, ip, switch-id and switch port for the given host
 						if req.Req_data != nil {
 							ip, mac, swid, port, err := act_net.host_info(  req.Req_data.( *string ) )
@@ -1612,6 +1840,9 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							new_net := build( act_net, sdn_host, max_link_cap, link_headroom, link_alarm_thresh, hlist, false )		// must force a switch graph rebuild here (expensive and will block for some seconds)
 							if new_net != nil {
 								new_net.xfer_maps( act_net )						// copy maps from old net to the new graph
+								if act_net == nil || len( new_net.switches ) != len( act_net.switches ) || len( new_net.links ) != len( act_net.links ) || len( new_net.hosts ) != len( act_net.hosts ) {
+									publish_event( "topology.changed", fmt.Sprintf( `{ "switches": %d, "links": %d, "hosts": %d }`, len( new_net.switches ), len( new_net.links ), len( new_net.hosts ) ) )
+								}
 								act_net = new_net
 	
 								net_sheep.Baa( 2, "network graph rebuild completed" )		// timing during debugging
@@ -1664,9 +1895,74 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							net_sheep.Baa( 1, "user link capacity set: %s now %d%%", *data[0], f.Get_limit_max() )
 						}
 						
+					case REQ_SNAPSHOT:							// links, vms and graph for a snapshot
+						req.Response_data = act_net.snapshot( )
+
 					case REQ_NETGRAPH:							// dump the current network graph
 						req.Response_data = act_net.to_json()
 
+					case REQ_LINKS_EXIST:						// data is a list of link ids; response is those not in the graph
+						if req_cancelled( req ) {
+							break
+						}
+						req.Response_data = act_net.missing_links( req.Req_data.( []string ) )
+
+					case REQ_QMAP_DETAIL:						// queue map grouped by switch/port; data is *qmap_query
+						if req_cancelled( req ) {
+							break
+						}
+						qq := req.Req_data.( *qmap_query )
+						req.Response_data = act_net.queue_map_json( qq.ts, qq.swid )
+
+					case REQ_QUARANTINE:						// from res_mgr; data is *quar_req (add or del)
+						req.State = act_net.set_quarantine( req.Req_data.( *quar_req ) )
+						if req.State == nil {
+							pcache.flush( "quarantine changed" )			// paths may go around, or now through, the host
+						}
+
+					case REQ_SET_AZ:							// data is a list of phost=zone[:aggregate,...]; replaces the membership
+						req.State = set_az( req.Req_data.( []string ) )
+						if req.State == nil {
+							req.Response_data = az_json( )
+						}
+
+					case REQ_LIST_AZ:
+						req.Response_data = az_json( )
+
+					case REQ_FIP_MOVED:							// from osif; data is []*fip_move
+						act_net.fip_moved( req.Req_data.( []*fip_move ) )
+
+					case REQ_LIST_GW:							// router external legs and their allocation now
+						req.Response_data = gw_json( time.Now().Unix() )
+
+					case REQ_PLACEMENT:							// placement hints for the cloud scheduler; data is *place_req
+						req.Response_data, req.State = act_net.placement( req.Req_data.( *place_req ) )
+
+					case REQ_REACH:								// reachability pre-check; data is *reach_req
+						req.Response_data, req.State = act_net.reach( req.Req_data.( *reach_req ), find_all_paths )
+
+					case REQ_COMPACT:							// data is true if only a report is wanted
+						req.Response_data = act_net.compact( req.Req_data.( bool ) )
+
+					case REQ_PATH_CACHE:						// data is true if the cache should be flushed first
+						if req.Req_data.( bool ) {
+							pcache.flush( "requested" )
+						}
+						req.Response_data = pcache.to_json( )
+
+					case REQ_CAP_CHECK:							// data is the reservation totals per link from res_mgr
+						act_net.cap_check( req.Req_data.( map[string]*link_use ) )
+
+					case REQ_LINK_LOAD:							// data is a list of link ids (res_mgr_reopt)
+						req.Response_data = act_net.link_loads( req.Req_data.( []string ) )
+
+					case REQ_LINK_SAMPLE:
+						act_net.sample_links( )
+
+					case REQ_LINK_HIST:							// history of link obligations; data is a list of link ids (all if empty)
+						ids, _ := req.Req_data.( []string )
+						req.Response_data, req.State = link_hist_json( ids )
+
 					case REQ_LISTHOSTS:							// spew out a json list of hosts with name, ip, switch id and port
 						req.Response_data = act_net.host_list( )
 
@@ -1729,6 +2025,13 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 						req.Response_ch = nil			// we don't respond to these
 						act_net.update_mac2phost( req.Req_data.( []string ), phost_suffix )
 
+					case REQ_OVS_INVENTORY:						// bridges, bonds and nic speeds from the agents; learn link capacities
+						req.Response_ch = nil
+						if over := act_net.ovs_inventory( req.Req_data.( []string ), link_headroom, phost_suffix ); len( over ) > 0 {
+							rmsg := ipc.Mk_chmsg( )
+							rmsg.Send_req( rmgr_ch, nil, REQ_LINK_RECHECK, over, nil )		// res_mgr readmits the reservations on these links
+						}
+
 					default:
 						net_sheep.Baa( 1,  "unknown request received on channel: %d", req.Msg_type )
 				}
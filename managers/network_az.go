@@ -0,0 +1,272 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_az
+	Abstract:	Availability zone and host aggregate awareness. Membership maps each physical
+				host (the switch name of VM endpoints in the graph) to its zone and to the
+				aggregates it belongs to. It is read from a file at start, and replaced by the
+				setaz request which tegu_az_sync uses to push what nova reports.
+
+				Two policies are applied when a bandwidth or multicast reservation is admitted:
+					cross	- when false, a reservation may not have endpoints in different zones
+					ceiling	- for a zone, the percentage of a link's capacity that may be reserved
+							  on links which touch a host in the zone
+
+				Hosts without a zone aren't subject to either policy. Oneway reservations have
+				a single endpoint in the graph and aren't checked.
+
+				Used only by the network manager goroutine; no locking.
+
+	CFG:		network:az_file - file with lines of: phost zone [aggregate,aggregate...]
+				network:az_cross - true if reservations may cross zones (true)
+				network:az_ceiling - zone:pct[,zone:pct...]
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+var (
+	az_of		map[string]string			// physical host -> zone
+	aggr_of		map[string][]string			// physical host -> aggregates
+	az_cross	bool = true					// reservations may have endpoints in different zones
+	az_ceil		map[string]int64			// zone -> percentage of link capacity that may be reserved
+)
+
+/*
+	Strip the domain from a physical host name as is done when the graph is built.
+*/
+func az_phost( name string ) ( string ) {
+	return strings.SplitN( name, ".", 2 )[0]
+}
+
+/*
+	Replace the membership with the entries given. Each entry is phost=zone[:aggregate,aggregate...].
+*/
+func set_az( entries []string ) ( error ) {
+	zones := make( map[string]string, len( entries ) )
+	aggrs := make( map[string][]string, len( entries ) )
+
+	for _, e := range entries {
+		kv := strings.SplitN( e, "=", 2 )
+		if len( kv ) != 2 || kv[0] == "" || kv[1] == "" {
+			return mk_err( ERR_BAD_REQUEST, "bad zone entry, expected phost=zone[:aggregate,...]: %s", e )
+		}
+
+		ph := az_phost( kv[0] )
+		zt := strings.SplitN( kv[1], ":", 2 )
+		zones[ph] = zt[0]
+		if len( zt ) > 1 && zt[1] != "" {
+			aggrs[ph] = strings.Split( zt[1], "," )
+		}
+	}
+
+	az_of = zones
+	aggr_of = aggrs
+	net_sheep.Baa( 1, "availability zones set for %d physical hosts", len( zones ) )
+	return nil
+}
+
+/*
+	Read membership from a file: phost zone [aggregate,aggregate...] per line; # starts a comment.
+*/
+func load_az_file( fname string ) ( error ) {
+	f, err := os.Open( fname )
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries := make( []string, 0, 128 )
+	br := bufio.NewScanner( f )
+	for br.Scan() {
+		toks := strings.Fields( strings.SplitN( br.Text(), "#", 2 )[0] )
+		switch len( toks ) {
+			case 0:
+
+			case 1:
+				return fmt.Errorf( "missing zone: %s", toks[0] )
+
+			case 2:
+				entries = append( entries, toks[0] + "=" + toks[1] )
+
+			default:
+				entries = append( entries, toks[0] + "=" + toks[1] + ":" + toks[2] )
+		}
+	}
+	if err = br.Err(); err != nil {
+		return err
+	}
+
+	return set_az( entries )
+}
+
+/*
+	Read the config. Called by the network manager before its loop starts.
+*/
+func az_init( ) {
+	az_ceil = make( map[string]int64 )
+	if cfg_data["network"] == nil {
+		return
+	}
+
+	if p := cfg_data["network"]["az_cross"]; p != nil {
+		az_cross = *p != "false"
+	}
+
+	if p := cfg_data["network"]["az_ceiling"]; p != nil {
+		for _, zp := range strings.Split( *p, "," ) {
+			if zt := strings.SplitN( strings.TrimSpace( zp ), ":", 2 ); len( zt ) == 2 {
+				if pct := clike.Atoi64( zt[1] ); pct > 0 && pct <= 100 {
+					az_ceil[zt[0]] = pct
+					continue
+				}
+			}
+			net_sheep.Baa( 0, "WRN: bad network:az_ceiling entry ignored; expected zone:pct: %s  [TGUNET013]", zp )
+		}
+	}
+
+	if p := cfg_data["network"]["az_file"]; p != nil && *p != "" {
+		if err := load_az_file( *p ); err != nil {
+			net_sheep.Baa( 0, "WRN: unable to load availability zones: %s: %s  [TGUNET014]", *p, err )
+		}
+	}
+}
+
+/*
+	Return the zone of the host (ip as known to the graph); empty if not known.
+*/
+func (n *Network) host_az( ip *string ) ( string ) {
+	if n == nil || ip == nil || az_of == nil {
+		return ""
+	}
+
+	if h := n.hosts[*ip]; h != nil {
+		if sw := h.Get_switch_id( 0 ); sw != nil {
+			return az_of[az_phost( *sw )]
+		}
+	}
+
+	return ""
+}
+
+/*
+	Apply the zone policies to the endpoints and candidate paths of a reservation. The source
+	is ip1 and each of the other ips is an endpoint. An error is returned if the reservation
+	may not be admitted; the paths have not been obligated yet.
+*/
+func (n *Network) az_admit( ip1 *string, others []*string, plist []*gizmos.Path, commence int64, expiry int64 ) ( error ) {
+	if n == nil || az_of == nil || len( az_of ) == 0 {
+		return nil
+	}
+
+	if ! az_cross {
+		z1 := n.host_az( ip1 )
+		for _, ip := range others {
+			if z2 := n.host_az( ip ); z1 != "" && z2 != "" && z1 != z2 {
+				return mk_err( ERR_BAD_REQUEST, "reservation would cross availability zones: %s and %s", z1, z2 )
+			}
+		}
+	}
+
+	if len( az_ceil ) == 0 {
+		return nil
+	}
+
+	seen := make( map[string]bool )
+	for _, path := range plist {
+		amt := path.Get_bandwidth()
+		for _, lid := range path.Get_link_ids() {
+			l := n.links[lid]
+			if l == nil {
+				l = n.vlinks[lid]
+			}
+			if l == nil || seen[lid] {
+				continue
+			}
+			seen[lid] = true
+
+			s1, s2 := l.Get_sw_names()
+			for _, sw := range []*string{ s1, s2 } {
+				if sw == nil {
+					continue
+				}
+				zone := az_of[az_phost( *sw )]
+				pct := az_ceil[zone]
+				if pct == 0 {
+					continue
+				}
+
+				ob := l.Get_allotment()
+				max := ob.Get_max_capacity()
+				if ok, _ := ob.Has_capacity( commence, expiry, amt + max - (max * pct) / 100, nil ); ! ok {		// allocation + amt must stay under pct of max
+					return mk_err( ERR_CAPACITY, "reservation would exceed the %d%% ceiling for availability zone %s on link %s", pct, zone, lid )
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+	Generate json with the membership and policies.
+*/
+func az_json( ) ( string ) {
+	hosts := make( []string, 0, len( az_of ) )
+	for h := range az_of {
+		hosts = append( hosts, h )
+	}
+	sort.Strings( hosts )
+
+	jstr := fmt.Sprintf( `{ "cross": %v, "ceilings": { `, az_cross )
+	sep := ""
+	for z, pct := range az_ceil {
+		jstr += fmt.Sprintf( "%s%q: %d", sep, z, pct )
+		sep = ", "
+	}
+
+	jstr += ` }, "hosts": [ `
+	sep = ""
+	for _, h := range hosts {
+		jstr += fmt.Sprintf( `%s{ "phost": %q, "zone": %q, "aggregates": %s }`, sep, h, az_of[h], ids2json( aggr_of[h] ) )
+		sep = ", "
+	}
+	jstr += " ] }"
+
+	return jstr
+}
@@ -0,0 +1,118 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_fip
+	Abstract:	Floating IP change tracking. The flow-mods of a reservation between VMs in different
+				projects, or between a VM and an external address, match on the floating IP of the
+				far end. When a floating IP is re-associated with another VM, or released, those
+				flow-mods match the wrong traffic (or none).
+
+				Osif compares the floating IP map of a project each time it is refreshed and sends
+				the changes here. The network maps are corrected, the change is logged and published
+				(fip.moved), and the list is passed to res_mgr which finds new paths for the
+				reservations that used the address (see res_mgr_fip.go); their flow-mods are
+				regenerated with the new fixed IP mapping.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	A floating IP that moved. Old and new are the project/ip of the fixed address; new is
+	empty when the floating IP was released.
+*/
+type fip_move struct {
+	fip		string
+	old		string
+	new		string
+}
+
+/*
+	Compare the old and new floating IP to project/ip maps and return the moves.
+	Floating IPs that are newly associated aren't moves; nothing could have used them.
+*/
+func fip_diff( old map[string]*string, new map[string]*string ) ( moves []*fip_move ) {
+	for fip, oip := range old {
+		if oip == nil {
+			continue
+		}
+
+		nip := new[fip]
+		switch {
+			case nip == nil:
+				moves = append( moves, &fip_move{ fip: fip, old: *oip } )
+
+			case *nip != *oip:
+				moves = append( moves, &fip_move{ fip: fip, old: *oip, new: *nip } )
+		}
+	}
+
+	return moves
+}
+
+/*
+	Apply the moves to the network's maps, announce them, and pass them to res_mgr.
+*/
+func (n *Network) fip_moved( moves []*fip_move ) {
+	if n == nil || len( moves ) == 0 {
+		return
+	}
+
+	if n.fip2ip == nil {
+		n.fip2ip = make( map[string]*string )
+	}
+	if n.ip2fip == nil {
+		n.ip2fip = make( map[string]*string )
+	}
+
+	for _, m := range moves {
+		if f := n.ip2fip[m.old]; f != nil && *f == m.fip {
+			delete( n.ip2fip, m.old )
+		}
+
+		if m.new == "" {
+			delete( n.fip2ip, m.fip )
+			net_sheep.Baa( 1, "floating ip %s released from %s", m.fip, m.old )
+		} else {
+			fip := m.fip
+			nip := m.new
+			n.fip2ip[fip] = &nip
+			n.ip2fip[nip] = &fip
+			net_sheep.Baa( 1, "floating ip %s moved: %s -> %s", m.fip, m.old, m.new )
+		}
+
+		publish_event( "fip.moved", fmt.Sprintf( `{ "fip": %q, "old": %q, "new": %q }`, m.fip, m.old, m.new ) )
+	}
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, nil, REQ_FIP_MOVED, moves, nil )
+}
@@ -0,0 +1,213 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_gw
+	Abstract:	Gateway (router) legs. A reservation with an endpoint in another project, or outside
+				of the cloud, is split into paths which end at the tenant's router (see find_endpoints).
+				The path to the router is obligated like any other, but the router's connection to
+				the external network is not in the graph, so nothing kept north-south reservations
+				from over committing it.
+
+				When a gateway capacity is configured, each router is given a link, from the router
+				to "external", with that capacity. A bandwidth reservation whose path ends (or
+				starts) at a router is admitted only if the router's link has room for the path's
+				bandwidth, and the link is obligated along with the path; the obligation is released
+				when the reservation is deleted.
+
+				Multicast reservations don't involve routers and oneway reservations have no path;
+				neither is checked.
+
+				Used only by the network manager goroutine; no locking.
+
+	CFG:		network:gw_capacity - bits/sec of each router's external leg; 0 disables (0)
+				network:gw_caps - router-ip=capacity[,router-ip=capacity...] overrides
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+var (
+	gw_cap_def	int64 = 0						// capacity of a router's external leg; 0 when not modelled
+	gw_caps		map[string]int64				// per router overrides keyed by router ip
+	gw_alarm	int = 0							// alarm threshold given to gateway links
+	gw_links	map[string]*gizmos.Link			// router (project/ip) -> link modelling the external leg
+)
+
+/*
+	Read the config. Alarm is the link alarm threshold used for the graph's links.
+*/
+func gw_init( alarm int ) {
+	gw_caps = make( map[string]int64 )
+	gw_links = make( map[string]*gizmos.Link )
+	gw_alarm = alarm
+
+	if cfg_data["network"] == nil {
+		return
+	}
+
+	if p := cfg_data["network"]["gw_capacity"]; p != nil {
+		gw_cap_def = clike.Atoi64( *p )
+	}
+
+	if p := cfg_data["network"]["gw_caps"]; p != nil {
+		for _, gc := range strings.Split( *p, "," ) {
+			if kv := strings.SplitN( strings.TrimSpace( gc ), "=", 2 ); len( kv ) == 2 && clike.Atoi64( kv[1] ) > 0 {
+				gw_caps[kv[0]] = clike.Atoi64( kv[1] )
+			} else {
+				net_sheep.Baa( 0, "WRN: bad network:gw_caps entry ignored; expected router-ip=capacity: %s  [TGUNET015]", gc )
+			}
+		}
+	}
+
+	if gw_cap_def > 0 || len( gw_caps ) > 0 {
+		net_sheep.Baa( 1, "router external legs are modelled: default capacity=%d overrides=%d", gw_cap_def, len( gw_caps ) )
+	}
+}
+
+/*
+	Return the router (project/ip as known in the gateway map) at either end of the path;
+	empty if neither end is a router.
+*/
+func (n *Network) path_gw( path *gizmos.Path ) ( string ) {
+	if n == nil || path == nil || n.gwmap == nil {
+		return ""
+	}
+
+	h1, h2 := path.Get_hosts()
+	for _, h := range []*gizmos.Host{ h2, h1 } {			// router is usually the far end
+		if h == nil {
+			continue
+		}
+		if mac := h.Get_mac(); mac != nil {
+			if gw := n.gwmap[*mac]; gw != nil {
+				return *gw
+			}
+		}
+	}
+
+	return ""
+}
+
+/*
+	Return the link for the router, creating it on first reference. Nil if the router's leg
+	isn't modelled.
+*/
+func gw_link( gw string ) ( *gizmos.Link ) {
+	if l := gw_links[gw]; l != nil {
+		return l
+	}
+
+	ip := gw
+	if i := strings.LastIndex( gw, "/" ); i >= 0 {
+		ip = gw[i+1:]
+	}
+	capacity := gw_cap_def
+	if c, ok := gw_caps[ip]; ok {
+		capacity = c
+	}
+	if capacity <= 0 {
+		return nil
+	}
+
+	ext := "external"
+	l := gizmos.Mk_link( &ip, &ext, capacity, gw_alarm, nil )
+	gw_links[gw] = l
+	net_sheep.Baa( 1, "created external leg for router %s: capacity=%d", gw, capacity )
+	return l
+}
+
+/*
+	Verify that each router leg used by the paths has room for the path's bandwidth.
+	Paths sharing a router must fit together.
+*/
+func (n *Network) gw_admit( plist []*gizmos.Path, commence int64, expiry int64 ) ( error ) {
+	if gw_cap_def <= 0 && len( gw_caps ) == 0 {
+		return nil
+	}
+
+	need := make( map[string]int64 )
+	for _, path := range plist {
+		if gw := n.path_gw( path ); gw != "" {
+			need[gw] += path.Get_bandwidth()
+		}
+	}
+
+	for gw, amt := range need {
+		l := gw_link( gw )
+		if l == nil {
+			continue
+		}
+		if ok, err := l.Has_capacity( commence, expiry, amt, nil, 100 ); ! ok {
+			return mk_err( ERR_CAPACITY, "router %s external leg cannot support %d: %s", gw, amt, err )
+		}
+	}
+
+	return nil
+}
+
+/*
+	Add (sign 1) or release (sign -1) the bandwidth of each path on its router's leg.
+*/
+func (n *Network) gw_obligate( plist []*gizmos.Path, commence int64, expiry int64, sign int64 ) {
+	if gw_cap_def <= 0 && len( gw_caps ) == 0 {
+		return
+	}
+
+	for _, path := range plist {
+		gw := n.path_gw( path )
+		if gw == "" {
+			continue
+		}
+		if l := gw_link( gw ); l != nil {
+			if msg := l.Get_allotment().Inc_utilisation( commence, expiry, sign * path.Get_bandwidth(), n.get_fence( path.Get_usr() ) ); msg != nil {
+				net_sheep.Baa( 1, "router %s external leg: %s", gw, *msg )
+			}
+		}
+	}
+}
+
+/*
+	Generate json describing each router leg and its allocation at the time given.
+*/
+func gw_json( ts int64 ) ( string ) {
+	jstr := `{ "gateways": [ `
+	sep := ""
+	for gw, l := range gw_links {
+		jstr += fmt.Sprintf( `%s{ "gateway": %q, "capacity": %d, "allocated": %d }`, sep, gw, l.Get_allotment().Get_max_capacity(), l.Get_allocation( ts ) )
+		sep = ", "
+	}
+	jstr += " ] }"
+
+	return jstr
+}
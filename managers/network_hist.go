@@ -0,0 +1,183 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_hist
+	Abstract:	Rolling history of link obligations. Once a minute the amount obligated on each
+				link in the graph (and the link's capacity) is sampled and kept for the configured
+				number of samples (a day by default). The history is returned by the linkhist
+				request so that the reserved level of a link can be plotted over time.
+
+				Tegu doesn't poll the switches for actual throughput, so only the reserved
+				(obligated) amount is recorded.
+
+				Used only by the network manager goroutine; no locking.
+
+	CFG:		network:link_hist - number of one minute samples kept per link; 0 disables (1440)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+const LINK_HIST_IVL int64 = 60					// seconds between samples
+
+type link_sample struct {
+	ts		int64
+	alloc	int64								// amount obligated at ts
+}
+
+/*
+	Ring of samples for one link.
+*/
+type link_hist struct {
+	capacity	int64							// link capacity at the last sample
+	samples		[]link_sample
+	next		int								// next slot to fill
+	full		bool							// ring has wrapped
+}
+
+var (
+	link_hist_max	int = 1440					// samples kept per link
+	link_hists		map[string]*link_hist		// keyed by link id
+)
+
+/*
+	Read the config and set up. Called by the network manager before its loop starts;
+	returns false if history is disabled.
+*/
+func link_hist_init( ) ( bool ) {
+	if cfg_data["network"] != nil {
+		if p := cfg_data["network"]["link_hist"]; p != nil {
+			link_hist_max = clike.Atoi( *p )
+		}
+	}
+
+	if link_hist_max <= 0 {
+		return false
+	}
+
+	link_hists = make( map[string]*link_hist )
+	return true
+}
+
+/*
+	Add a sample to the ring.
+*/
+func (h *link_hist) add( ts int64, alloc int64 ) {
+	h.samples[h.next] = link_sample{ ts: ts, alloc: alloc }
+	h.next++
+	if h.next >= len( h.samples ) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+/*
+	Return the samples oldest first.
+*/
+func (h *link_hist) ordered( ) ( []link_sample ) {
+	if ! h.full {
+		return h.samples[:h.next]
+	}
+
+	return append( append( []link_sample{}, h.samples[h.next:]... ), h.samples[:h.next]... )
+}
+
+/*
+	Sample each link in the network. History for links that have left the graph is dropped.
+*/
+func (n *Network) sample_links( ) {
+	if n == nil || link_hists == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	for id, l := range n.links {
+		h := link_hists[id]
+		if h == nil {
+			h = &link_hist{ samples: make( []link_sample, link_hist_max ) }
+			link_hists[id] = h
+		}
+
+		if ob := l.Get_allotment(); ob != nil {
+			h.capacity = ob.Get_max_capacity()
+		}
+		h.add( now, l.Get_allocation( now ) )
+	}
+
+	for id := range link_hists {
+		if n.links[id] == nil {
+			delete( link_hists, id )
+		}
+	}
+}
+
+/*
+	Generate json with the history of the links named, or all links if ids is empty. Samples
+	are given as [ timestamp, obligation ] pairs, oldest first.
+*/
+func link_hist_json( ids []string ) ( string, error ) {
+	if link_hists == nil {
+		return "", mk_err( ERR_BAD_REQUEST, "link history is not enabled" )
+	}
+
+	if len( ids ) == 0 {
+		for id := range link_hists {
+			ids = append( ids, id )
+		}
+		sort.Strings( ids )
+	}
+
+	jb := &bytes.Buffer{}									// can be large; avoid repeated string copies
+	fmt.Fprintf( jb, `{ "interval": %d, "links": [ `, LINK_HIST_IVL )
+	sep := ""
+	for _, id := range ids {
+		h := link_hists[id]
+		if h == nil {
+			return "", mk_err( ERR_NOT_FOUND, "no history for link: %s", id )
+		}
+
+		fmt.Fprintf( jb, `%s{ "id": %q, "capacity": %d, "samples": [ `, sep, id, h.capacity )
+		ssep := ""
+		for _, s := range h.ordered() {
+			fmt.Fprintf( jb, "%s[ %d, %d ]", ssep, s.ts, s.alloc )
+			ssep = ", "
+		}
+		jb.WriteString( " ] }" )
+		sep = ", "
+	}
+	jb.WriteString( " ] }" )
+
+	return jb.String(), nil
+}
@@ -0,0 +1,262 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_inv
+	Abstract:	OVS inventory reported by the agents (ovs_inventory action, ql_ovs_inventory): the
+				bridges and ports, bonds and the speed and state of the physical interfaces on each
+				host. The inventory is used to learn the capacity of the graph's links rather than
+				relying on the capacity in the topology: a link with a host@interface end is given
+				the speed of the interface, or for a bond the total speed of the members which are
+				up, less the link headroom.
+
+				An interface whose speed or state differs from the previous report (a 10G port which
+				renegotiated at 1G) is logged and a link.speed_changed event is published.
+
+				A link whose capacity drops (a bond member went down) may now be obligated beyond
+				its capacity. The ids of such links are returned so that res-mgr can check the
+				reservations using them again (readmit, which moves those that no longer fit to the
+				retry queue).
+
+				Used only by the network manager goroutine; no locking.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Interface speed and state changes are reported.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+type inv_iface struct {
+	speed	int64					// bits/sec; 0 if not known
+	up		bool
+}
+
+type inv_bond struct {
+	mode	string
+	members	[]string
+}
+
+/*
+	What one host reported.
+*/
+type host_inv struct {
+	bridges	map[string][]string		// bridge -> ports
+	bonds	map[string]*inv_bond
+	ifaces	map[string]*inv_iface
+	updated	int64
+}
+
+var ovs_inv = make( map[string]*host_inv )
+
+/*
+	Parse the records returned by the agent (host kind name ...) into an inventory for each
+	host. Malformed records are skipped. If we add a suffix to host names it is stripped.
+*/
+func parse_ovs_inv( recs []string, phost_suffix *string ) ( map[string]*host_inv ) {
+	now := time.Now().Unix()
+	hinv := make( map[string]*host_inv )
+
+	for _, r := range recs {
+		toks := strings.Fields( r )
+		if len( toks ) < 3 {
+			continue
+		}
+
+		if phost_suffix != nil {
+			toks[0] = strings.TrimSuffix( toks[0], *phost_suffix )
+		}
+
+		hi := hinv[toks[0]]
+		if hi == nil {
+			hi = &host_inv{
+				bridges:	make( map[string][]string ),
+				bonds:		make( map[string]*inv_bond ),
+				ifaces:		make( map[string]*inv_iface ),
+				updated:	now,
+			}
+			hinv[toks[0]] = hi
+		}
+
+		switch toks[1] {
+			case "bridge":
+				hi.bridges[toks[2]] = []string{}
+				if len( toks ) > 3 {
+					hi.bridges[toks[2]] = strings.Split( toks[3], "," )
+				}
+
+			case "bond":
+				if len( toks ) > 4 {
+					hi.bonds[toks[2]] = &inv_bond{ mode: toks[3], members: strings.Split( toks[4], "," ) }
+				}
+
+			case "iface":
+				if len( toks ) > 4 {
+					var speed int64 = 0
+					if mbps := clike.Atoi64( toks[3] ); mbps > 0 {
+						speed = mbps * 1000000
+					}
+					hi.ifaces[toks[2]] = &inv_iface{ speed: speed, up: toks[4] == "up" }
+				}
+		}
+	}
+
+	return hinv
+}
+
+/*
+	Capacity (bits/sec) of the interface, or bond, on the host. False is returned if the
+	host didn't report it or no speed is known for any member.
+*/
+func (hi *host_inv) capacity( name string ) ( int64, bool ) {
+	if hi == nil {
+		return 0, false
+	}
+
+	if b := hi.bonds[name]; b != nil {
+		var total int64 = 0
+		known := false
+		for _, m := range b.members {
+			if i := hi.ifaces[m]; i != nil {
+				known = known || i.speed > 0
+				if i.up {
+					total += i.speed
+				}
+			}
+		}
+		return total, known
+	}
+
+	if i := hi.ifaces[name]; i != nil && i.speed > 0 {
+		if ! i.up {
+			return 0, true
+		}
+		return i.speed, true
+	}
+
+	return 0, false
+}
+
+/*
+	Log and publish each interface whose speed or state differs from the last report from the
+	host. An interface not in the last report is not a change.
+*/
+func (hi *host_inv) speed_changes( host string, old *host_inv ) {
+	if hi == nil || old == nil {
+		return
+	}
+
+	for name, i := range hi.ifaces {
+		oi := old.ifaces[name]
+		if oi == nil || (oi.speed == i.speed && oi.up == i.up) {
+			continue
+		}
+
+		if i.speed < oi.speed || (oi.up && ! i.up) {
+			net_sheep.Baa( 0, "WRN: interface speed dropped: %s@%s %dMbps up=%v -> %dMbps up=%v  [TGUNET017]", host, name, oi.speed/1000000, oi.up, i.speed/1000000, i.up )
+		} else {
+			net_sheep.Baa( 1, "interface speed changed: %s@%s %dMbps up=%v -> %dMbps up=%v", host, name, oi.speed/1000000, oi.up, i.speed/1000000, i.up )
+		}
+		publish_event( "link.speed_changed", fmt.Sprintf( `{ "host": %q, "iface": %q, "old_mbps": %d, "mbps": %d, "was_up": %v, "up": %v }`,
+			host, name, oi.speed/1000000, i.speed/1000000, oi.up, i.up ) )
+	}
+}
+
+/*
+	Look up the host@interface end of a link in the inventory.
+*/
+func inv_capacity( ep string ) ( int64, bool ) {
+	toks := strings.SplitN( ep, "@", 2 )
+	if len( toks ) != 2 {
+		return 0, false
+	}
+
+	hi := ovs_inv[toks[0]]
+	if hi == nil {
+		if i := strings.Index( toks[0], "." ); i > 0 {			// topo may use the short name
+			hi = ovs_inv[toks[0][0:i]]
+		}
+	}
+
+	return hi.capacity( toks[1] )
+}
+
+/*
+	Save the inventory reported and set the capacity of each link with a host@interface end
+	which was reported. Returns the ids of links whose capacity dropped below what is obligated.
+*/
+func (n *Network) ovs_inventory( recs []string, link_headroom int, phost_suffix *string ) ( over []string ) {
+	hinv := parse_ovs_inv( recs, phost_suffix )
+	for h, hi := range hinv {
+		hi.speed_changes( h, ovs_inv[h] )
+		ovs_inv[h] = hi
+	}
+	if n == nil {
+		return nil
+	}
+
+	var hr_factor int64 = 100
+	if link_headroom > 0 && link_headroom < 100 {
+		hr_factor = 100 - int64( link_headroom )
+	}
+
+	for _, fl := range n.fl_links {
+		capacity, ok := inv_capacity( fl.Src_switch )
+		if ! ok {
+			if capacity, ok = inv_capacity( fl.Dst_switch ); ! ok {
+				continue
+			}
+		}
+		capacity = (capacity * hr_factor) / 100
+
+		for _, lid := range []string{ fl.Src_switch + "-" + fl.Dst_switch, fl.Dst_switch + "-" + fl.Src_switch } {
+			l := n.links[lid]
+			if l == nil || l.Get_allotment() == nil {
+				continue
+			}
+
+			old := l.Get_allotment().Get_max_capacity()
+			if old == capacity {
+				continue
+			}
+
+			l.Mod_capacity( capacity )
+			net_sheep.Baa( 1, "link capacity learned from agent inventory: %s %d -> %d", lid, old, capacity )
+			publish_event( "link.capacity_changed", fmt.Sprintf( `{ "link": %q, "old": %d, "capacity": %d }`, lid, old, capacity ) )
+
+			if capacity < old && l.Get_allotment().Get_max_allocation() > capacity {
+				net_sheep.Baa( 0, "WRN: link capacity dropped below its obligation: %s capacity=%d obligated=%d  [TGUNET016]", lid, capacity, l.Get_allotment().Get_max_allocation() )
+				over = append( over, lid )
+			}
+		}
+	}
+
+	return over
+}
@@ -29,6 +29,10 @@
 
 	Mods:		23 May 2016 - Make ingress rate check in relaxed mode consistent between 
 					regular and one-way reservations.
+				16 Oct 2026 - Quarantined physical hosts are skipped by the path search.
+				16 Oct 2026 - Switch initialisation for a walk moved to reset_walk() so placement can use it.
+				16 Oct 2026 - Shortest paths are taken from the path cache when they fit (network_pcache.go).
+				16 Oct 2026 - Same switch paths have endpoints; hosts on the same port get a local (no-op) path.
 */
 
 package managers
@@ -56,6 +60,22 @@ type host_pair struct {
 
 // ------------------------------------------------------------------------------------------------------------------
 
+/*
+	Initialise the switches for a walk starting at ssw: costs are set high, previous pointers
+	and visited flags are cleared. Quarantined switches (other than ssw) are marked visited
+	so that they are never entered and paths go around them (network_quarantine.go).
+*/
+func (n *Network) reset_walk( ssw *gizmos.Switch ) {
+	for sname := range n.switches {
+		n.switches[sname].Cost = 2147483647			// this should be large enough and allows cost to be int32
+		n.switches[sname].Prev = nil
+		n.switches[sname].Flags &= ^tegu.SWFL_VISITED
+		if n.switches[sname] != ssw && sw_quarantined( n.switches[sname] ) {
+			n.switches[sname].Flags |= tegu.SWFL_VISITED
+		}
+	}
+}
+
 /*
 	Look at tid/h1 and tid/h2 and split them into two disjoint path endpoints, tid/gw,h1 and tid/gw,h2, if
 	the project ids for the hosts differ.  This will allow for reservations between project VMs that are both
@@ -204,9 +224,11 @@ func (n *Network) find_endpoints( h1ip *string, h2ip *string ) ( pair_list []hos
 
 	This function assumes that the switches have all been initialised with a reset of the visited flag,
 	setting of inital cost, etc.
+
+	A path found earlier between the hosts is used, without a search, if it's in the path cache and
+	still has room (network_pcache.go).
 */
 func (n *Network) find_shortest_path( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmos.Host, usr *string, commence int64, conclude int64, inc_cap int64, usr_max int64 ) ( path *gizmos.Path, cap_trip bool ) {
-	h1nm := h1.Get_mac()
 	h2nm := h2.Get_mac()
 	path = nil
 
@@ -217,43 +239,72 @@ func (n *Network) find_shortest_path( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *g
 		return
 	}
 
+	if hops := pcache.lookup( n, ssw, h1, h2, commence, conclude, inc_cap, usr, usr_max ); hops != nil {
+		net_sheep.Baa( 2,  "find_spath: cached path to target on %s", hops[0].sw.To_str( ) )
+		return n.mk_spath( h1, h2, inc_cap, hops ), false
+	}
+
 	ssw.Cost = 0														// seed the cost in the source switch
 	tsw, cap_trip := ssw.Path_to( h2nm, commence, conclude, inc_cap, usr, usr_max )		// discover the shortest path to terminating switch that has enough bandwidth
 	if tsw != nil {												// must walk from the term switch backwards collecting the links to set the path
-		path = gizmos.Mk_path( h1, h2 )
-		path.Set_reverse( true )								// indicate that the path is saved in reverse order
-		path.Set_bandwidth( inc_cap )
 		net_sheep.Baa( 2,  "find_spath: found target on %s", tsw.To_str( ) )
-				
-		lnk := n.find_vlink( *(tsw.Get_id()), h2.Get_port( tsw ), -1, nil, nil )		// add endpoint -- a virtual link out from switch to h2
-		lnk.Add_lbp( *h2nm )
-		lnk.Set_forward( tsw )												// endpoints have only a forward link
-		path.Add_endpoint( lnk )
 
-		for ; tsw != nil ; {
+		hops := make( []path_hop, 0, 16 )
+		for ; tsw != nil ; tsw = tsw.Prev {
+			hp := path_hop{ sw: tsw }
 			if tsw.Prev != nil {								// last node won't have a prev pointer so no link
-				lnk = tsw.Prev.Get_link( tsw.Plink )
-				path.Add_link( lnk )
-			}	
-			path.Add_switch( tsw )
-
-			net_sheep.Baa( 3, "\t%s using link %d", tsw.Prev.To_str(), tsw.Plink )
-
-			if tsw.Prev == nil {													// last switch in the path, add endpoint
-				lnk = n.find_vlink( *(tsw.Get_id()), h1.Get_port( tsw ), -1, nil, nil )		// endpoint is a virt link from switch to h1
-				lnk.Add_lbp( *h1nm )
-				lnk.Set_forward( tsw )												// endpoints have only a forward link
-				path.Add_endpoint( lnk )
+				hp.lnk = tsw.Prev.Get_link( tsw.Plink )
+				net_sheep.Baa( 3, "\t%s using link %d", tsw.Prev.To_str(), tsw.Plink )
 			}
-			tsw = tsw.Prev
+			hops = append( hops, hp )
 		}
 
-		path.Flip_endpoints()		// path expects them to be in h1,h2 order; we added them backwards so must flip
+		if ! cap_trip {											// nothing passed over for capacity; it's the shortest however full links get
+			pcache.add( ssw, h1, h2, hops )
+		}
+		path = n.mk_spath( h1, h2, inc_cap, hops )
 	}
 
 	return
 }
 
+/*
+	Build the path structure for a shortest path between h1 and h2. Hops are the switches from
+	the one h2 is attached to back to the starting switch, each with the link into it.
+*/
+func (n *Network) mk_spath( h1 *gizmos.Host, h2 *gizmos.Host, inc_cap int64, hops []path_hop ) ( path *gizmos.Path ) {
+	h1nm := h1.Get_mac()
+	h2nm := h2.Get_mac()
+
+	path = gizmos.Mk_path( h1, h2 )
+	path.Set_reverse( true )								// indicate that the path is saved in reverse order
+	path.Set_bandwidth( inc_cap )
+
+	tsw := hops[0].sw
+	lnk := n.find_vlink( *(tsw.Get_id()), h2.Get_port( tsw ), -1, nil, nil )		// add endpoint -- a virtual link out from switch to h2
+	lnk.Add_lbp( *h2nm )
+	lnk.Set_forward( tsw )												// endpoints have only a forward link
+	path.Add_endpoint( lnk )
+
+	for i, hp := range hops {
+		if hp.lnk != nil {
+			path.Add_link( hp.lnk )
+		}
+		path.Add_switch( hp.sw )
+
+		if i == len( hops ) - 1 {											// last switch in the path, add endpoint
+			lnk = n.find_vlink( *(hp.sw.Get_id()), h1.Get_port( hp.sw ), -1, nil, nil )		// endpoint is a virt link from switch to h1
+			lnk.Add_lbp( *h1nm )
+			lnk.Set_forward( hp.sw )										// endpoints have only a forward link
+			path.Add_endpoint( lnk )
+		}
+	}
+
+	path.Flip_endpoints()		// path expects them to be in h1,h2 order; we added them backwards so must flip
+
+	return
+}
+
 /*
 	This is a helper function for find_paths(). It is used to find all possible paths between h1 and h2 starting at ssw.
 	The resulting path is a "scramble" meaning that the set of links is a unique set of links that are traversed by
@@ -399,7 +450,7 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 		return
 	}
 
-	path_list = make( []*gizmos.Path, len( n.links ) )		// we cannot have more in our path than the number of links (needs to be changed as this isn't good in the long run)
+	path_list = make( []*gizmos.Path, len( n.links ) + 1 )		// we cannot have more in our path than the number of links (needs to be changed as this isn't good in the long run); +1 for a single switch network
 	pcount = 0
 
 	for {													// we'll break after we've looked at all of the connection points for h1
@@ -441,6 +492,12 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 					path.Set_extip( extip, ext_flag )
 					path.Add_switch( ssw )
 					path.Add_link( lnk )
+					for _, h := range []*gizmos.Host{ h1, h2 } {			// endpoints in h1,h2 order as with a multi-switch path so the port to h2 gets its queue
+						elnk := n.find_vlink( *(ssw.Get_id()), h.Get_port( ssw ), -1, nil, nil )
+						elnk.Add_lbp( *(h.Get_mac()) )
+						elnk.Set_forward( ssw )
+						path.Add_endpoint( elnk )
+					}
 	
 					path_list[plidx] = path
 					plidx++
@@ -448,19 +505,24 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 					lcap_trip = true
 					net_sheep.Baa( 1, "path[%d]: hosts on same switch, virtual link cannot support bandwidth increase of %d", plidx, inc_cap )
 				}
-			}  else {					// debugging only
-				net_sheep.Baa( 2,  "find-path: path[%d]: found target (%s) on same switch with same port: %s  %d, %d", plidx, *h2nm, ssw.To_str( ), p1, p2 )
+			}  else {					// both behind the one port; their traffic never reaches the switch so the path is a no-op
+				net_sheep.Baa( 1,  "path[%d]: found target (%s) on same switch with same port: %s  %d, %d; local path, nothing to queue", plidx, *h2nm, ssw.To_str( ), p1, p2 )
 				net_sheep.Baa( 2,  "find-path: host1-json= %s", h1.To_json( ) )
 				net_sheep.Baa( 2,  "find-path: host2-json= %s", h2.To_json( ) )
+
+				path = gizmos.Mk_path( h1, h2 )
+				path.Set_bandwidth( inc_cap )
+				path.Set_extip( extip, ext_flag )
+				path.Add_switch( ssw )
+				path.Set_local( true )
+
+				path_list[plidx] = path
+				plidx++
 			}
 		} else {						// usual case, two named hosts and hosts are on different switches
 			net_sheep.Baa( 1, "path[%d]: searching for path starting from switch: %s", plidx, ssw.To_str( ) )
 
-			for sname := range n.switches {					// initialise the network for the walk
-				n.switches[sname].Cost = 2147483647			// this should be large enough and allows cost to be int32
-				n.switches[sname].Prev = nil
-				n.switches[sname].Flags &= ^tegu.SWFL_VISITED
-			}
+			n.reset_walk( ssw )								// initialise the network for the walk
 
 			
 			if n.relaxed {				
@@ -0,0 +1,292 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_pcache
+	Abstract:	A cache of shortest paths so that repeated reservations between the same hosts
+				(CI farms, replication pairs) skip the graph search. Entries are keyed by the
+				two hosts (macs) and the switch the search starts from, and hold the switch
+				and link ids of the path.
+
+				Only paths found without any link being passed over for capacity are kept.
+				Such a path is the shortest through the graph whatever the obligations, so
+				reservations (which only ever fill links) can't make a shorter one appear; a
+				cached path is used for any window and amount as long as each of its links
+				still has room. When a link on it doesn't (the links were obligated since,
+				or the window or amount is different), the search is run as before and may
+				find a longer path with room; the entry is kept as it is still the shortest.
+
+				The whole cache is flushed when the topology changes (the links the graph is
+				built from are different) and when a quarantine is added or lifted, since
+				either may make a different path the shortest. On use, an entry is dropped if
+				a switch or link it names is gone or no longer joins the others, or the target
+				host has moved.
+
+				Only shortest path searches are cached: find_paths=all (scrambles) and relaxed
+				mode are not. Placement walks are not cached.
+
+				Hits, misses (and of those, the ones where the cached path was short of room),
+				entries dropped because they no longer fit the graph, and flushes are counted and returned by the pathcache request (which can also flush).
+
+				Used only by the network manager goroutine; no locking.
+
+	CFG:		network:path_cache - max number of cached paths; 0 disables (4096)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	One switch of a path, from the target end back to the source, with the link that
+	enters it (nil for the source switch).
+*/
+type path_hop struct {
+	sw		*gizmos.Switch
+	lnk		*gizmos.Link
+}
+
+type pc_entry struct {
+	swids	[]string						// target first, as the search leaves them
+	lids	[]string						// link into swids[i]; "" for the source
+}
+
+type path_cache struct {
+	max		int
+	topo	uint64							// hash of the links the graph was built from
+	paths	map[string]*pc_entry
+
+	hits	int64
+	misses	int64
+	full	int64							// found, but short of room
+	stale	int64							// found, but no longer in the graph
+	stored	int64
+	evicted	int64
+	flushes	int64
+	last_flush	string						// reason for the last flush
+}
+
+var pcache	*path_cache						// nil if disabled
+
+/*
+	Create the cache from the config. Called when network manager starts.
+*/
+func path_cache_init( ) {
+	max := 4096
+	if cfg_data["network"] != nil {
+		if p := cfg_data["network"]["path_cache"]; p != nil {
+			max = clike.Atoi( *p )
+		}
+	}
+
+	if max <= 0 {
+		net_sheep.Baa( 1, "path cache is disabled" )
+		return
+	}
+
+	pcache = &path_cache{
+		max:	max,
+		paths:	make( map[string]*pc_entry, max ),
+	}
+	net_sheep.Baa( 1, "path cache holds up to %d paths", max )
+}
+
+func pc_key( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmos.Host ) ( string ) {
+	return *(h1.Get_mac()) + " " + *(ssw.Get_id()) + " " + *(h2.Get_mac())
+}
+
+/*
+	Drop everything.
+*/
+func (pc *path_cache) flush( why string ) {
+	if pc == nil {
+		return
+	}
+
+	if len( pc.paths ) > 0 {
+		net_sheep.Baa( 2, "path cache: %d paths flushed: %s", len( pc.paths ), why )
+		pc.paths = make( map[string]*pc_entry, pc.max )
+	}
+	pc.flushes++
+	pc.last_flush = why
+}
+
+/*
+	Note the links that a graph is being built from; the cache is flushed if they differ
+	from those of the last build.
+*/
+func (pc *path_cache) topology( links []gizmos.FL_link_json ) {
+	if pc == nil {
+		return
+	}
+
+	lstrs := make( []string, len( links ) )
+	for i := range links {
+		l := &links[i]
+		lstrs[i] = fmt.Sprintf( "%s %d %s %d %s", l.Src_switch, l.Src_port, l.Dst_switch, l.Dst_port, l.Direction )
+	}
+	sort.Strings( lstrs )
+
+	h := fnv.New64a( )
+	for _, s := range lstrs {
+		h.Write( []byte( s ) )
+		h.Write( []byte{ 0 } )
+	}
+
+	if sum := h.Sum64(); sum != pc.topo {
+		if pc.topo != 0 {
+			pc.flush( "topology changed" )
+		}
+		pc.topo = sum
+	}
+}
+
+/*
+	Keep the path found by a search from ssw which wasn't limited by capacity.
+*/
+func (pc *path_cache) add( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmos.Host, hops []path_hop ) {
+	if pc == nil || len( hops ) == 0 {
+		return
+	}
+
+	if len( pc.paths ) >= pc.max {
+		for k := range pc.paths {					// any will do; map order is random
+			delete( pc.paths, k )
+			pc.evicted++
+			break
+		}
+	}
+
+	e := &pc_entry{
+		swids:	make( []string, len( hops ) ),
+		lids:	make( []string, len( hops ) ),
+	}
+	for i, hp := range hops {
+		e.swids[i] = *(hp.sw.Get_id())
+		if hp.lnk != nil {
+			e.lids[i] = *(hp.lnk.Get_id())
+		}
+	}
+
+	pc.paths[pc_key( ssw, h1, h2 )] = e
+	pc.stored++
+}
+
+/*
+	Return the hops of the cached path from ssw to h2 if there is one and each of its links
+	can take inc_cap over the window. Nil is returned (a miss) otherwise; an entry that
+	no longer matches the graph is dropped.
+*/
+func (pc *path_cache) lookup( n *Network, ssw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmos.Host, commence int64, conclude int64, inc_cap int64, usr *string, usr_max int64 ) ( []path_hop ) {
+	if pc == nil {
+		return nil
+	}
+
+	key := pc_key( ssw, h1, h2 )
+	e := pc.paths[key]
+	if e == nil {
+		pc.misses++
+		return nil
+	}
+
+	hops, room, why := e.hops( n, ssw, h2.Get_mac(), commence, conclude, inc_cap, usr, usr_max )
+	if hops == nil {
+		net_sheep.Baa( 2, "path cache: %s not used: %s", key, why )
+		if room {
+			delete( pc.paths, key )
+			pc.stale++
+		} else {
+			pc.full++
+		}
+		pc.misses++
+		return nil
+	}
+
+	pc.hits++
+	return hops
+}
+
+/*
+	Map the entry onto the current graph, checking that it is still a path from ssw to the
+	target and that it has room. Returns nil and the reason if not; room is false if it's
+	only the room that is lacking.
+*/
+func (e *pc_entry) hops( n *Network, ssw *gizmos.Switch, target *string, commence int64, conclude int64, inc_cap int64, usr *string, usr_max int64 ) ( hops []path_hop, room bool, why string ) {
+	last := len( e.swids ) - 1
+	hops = make( []path_hop, len( e.swids ) )
+	for i, id := range e.swids {
+		sw := n.switches[id]
+		if sw == nil {
+			return nil, true, "switch is gone: " + id
+		}
+		if i < last && sw_quarantined( sw ) {
+			return nil, true, "switch is quarantined: " + id
+		}
+		if (i == 0) != sw.Has_host( target ) {				// the search stops at the first switch with the target
+			return nil, true, "target host moved"
+		}
+		hops[i].sw = sw
+	}
+	if hops[last].sw != ssw {
+		return nil, true, "path does not start at the switch"
+	}
+
+	for i := 0; i < last; i++ {
+		l := n.links[e.lids[i]]
+		if l == nil || ! l.Comes_from( hops[i+1].sw ) || ! l.Forwards_to( hops[i].sw ) {
+			return nil, true, "link is gone: " + e.lids[i]
+		}
+		if ok, err := l.Has_capacity( commence, conclude, inc_cap, usr, usr_max ); ! ok {
+			return nil, false, fmt.Sprintf( "%s", err )
+		}
+		hops[i].lnk = l
+	}
+
+	return hops, true, ""
+}
+
+/*
+	Counts for the pathcache request.
+*/
+func (pc *path_cache) to_json( ) ( string ) {
+	if pc == nil {
+		return `{ "enabled": false }`
+	}
+
+	ratio := 0.0
+	if pc.hits + pc.misses > 0 {
+		ratio = float64( pc.hits ) / float64( pc.hits + pc.misses )
+	}
+	return fmt.Sprintf( `{ "enabled": true, "max": %d, "entries": %d, "hits": %d, "misses": %d, "hit_ratio": %.3f, "full": %d, "stale": %d, "stored": %d, "evicted": %d, "flushes": %d, "last_flush": %q }`,
+		pc.max, len( pc.paths ), pc.hits, pc.misses, ratio, pc.full, pc.stale, pc.stored, pc.evicted, pc.flushes, pc.last_flush )
+}
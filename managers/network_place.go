@@ -0,0 +1,242 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_place
+	Abstract:	Placement hints for the cloud scheduler. Given a tenant, a bandwidth and a peer
+				VM, each candidate physical host (a switch in the graph) is ranked by how much
+				could still be reserved between it and the peer's physical host for the window.
+				A nova weigher can use the list to put a new VM where a reservation to the peer
+				will actually be admitted.
+
+				The room in each direction is the largest amount for which the path search finds
+				a path (a binary search using the same link checks as a reservation: the tenant's
+				fence, the allotments over the window and the capacity schedule). The lower of
+				the two directions is reported. A candidate on the peer's own host needs no
+				links and is ranked first. Quarantined hosts are not candidates.
+
+				Candidates are those named on the request, or every switch in the graph if none
+				are given. In relaxed mode there is no admission control, so every candidate has
+				the room of the largest link.
+
+				Nothing is obligated; the answer is only a hint and may be stale by the time the
+				reservation is requested.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	A placement request as passed from http to the network manager.
+*/
+type place_req struct {
+	tenant		string					// project id; selects the fence
+	peer		string					// project/vm as validated by osif
+	phosts		[]string				// candidates; all switches if empty
+	bandw		int64
+	commence	int64
+	conclude	int64
+}
+
+type place_cand struct {
+	phost	string
+	room	int64						// lower of the two directions
+	hops	int							// links between candidate and peer; -1 if no path
+	local	bool						// candidate is the peer's physical host
+}
+
+/*
+	Candidates ordered best first: local, then most room, then fewest hops.
+*/
+type place_list []*place_cand
+
+func (pl place_list) Len( ) int { return len( pl ) }
+func (pl place_list) Swap( i, j int ) { pl[i], pl[j] = pl[j], pl[i] }
+func (pl place_list) Less( i, j int ) bool {
+	if pl[i].local != pl[j].local {
+		return pl[i].local
+	}
+	if pl[i].room != pl[j].room {
+		return pl[i].room > pl[j].room
+	}
+	if pl[i].hops != pl[j].hops {
+		return pl[i].hops >= 0 && (pl[j].hops < 0 || pl[i].hops < pl[j].hops)
+	}
+	return pl[i].phost < pl[j].phost
+}
+
+/*
+	Walk from ssw to the target (a host mac or switch id) requiring inc_cap on each link.
+	Returns the number of links in the path found, -1 if there isn't one.
+*/
+func (n *Network) place_walk( ssw *gizmos.Switch, target *string, commence int64, conclude int64, inc_cap int64, usr *string, usr_max int64 ) ( int ) {
+	n.reset_walk( ssw )
+	ssw.Cost = 0
+	tsw, _ := ssw.Path_to( target, commence, conclude, inc_cap, usr, usr_max )
+	if tsw == nil {
+		return -1
+	}
+
+	hops := 0
+	for ; tsw.Prev != nil; tsw = tsw.Prev {
+		hops++
+	}
+	return hops
+}
+
+/*
+	Find the most that could be reserved on a path from ssw to the target. Top is the largest
+	amount worth trying; the search stops when within 1/1024th of it. Hops is -1 if there
+	is no path at all.
+*/
+func (n *Network) place_room( ssw *gizmos.Switch, target *string, commence int64, conclude int64, usr *string, usr_max int64, top int64 ) ( room int64, hops int ) {
+	hops = n.place_walk( ssw, target, commence, conclude, 0, usr, usr_max )
+	if hops < 0 {
+		return 0, hops
+	}
+
+	lo := int64( 0 )						// known to fit
+	hi := top								// not known to fit
+	near := top / 1024
+	for hi - lo > near {
+		mid := lo + (hi - lo + 1) / 2
+		if n.place_walk( ssw, target, commence, conclude, mid, usr, usr_max ) >= 0 {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return lo, hops
+}
+
+/*
+	Rank the candidate physical hosts by the room between each and the peer. Returns the
+	json list, best first.
+*/
+func (n *Network) placement( pr *place_req ) ( string, error ) {
+	ip, err := n.name2ip( &pr.peer )
+	if err != nil {
+		return "", err
+	}
+	if (*ip)[0:1] == "!" {
+		return "", mk_err( ERR_BAD_REQUEST, "peer must be a VM known to the network: %s", pr.peer )
+	}
+	if err = n.quar_admit( ip ); err != nil {
+		return "", err
+	}
+
+	h := n.hosts[*ip]
+	psw, _ := h.Get_switch_port( 0 )
+	if psw == nil {
+		return "", mk_err( ERR_NOT_FOUND, "peer is not attached to a switch in the network: %s", pr.peer )
+	}
+	pmac := h.Get_mac()
+
+	fence := n.get_fence( &pr.tenant )
+	usr_max := fence.Get_limit_max()
+
+	top := int64( 0 )
+	for _, l := range n.links {
+		if c := l.Get_allotment().Get_max_capacity(); c > top {
+			top = c
+		}
+	}
+	if usr_max > 100 && usr_max < top {
+		top = usr_max
+	}
+
+	want := make( map[string]bool, len( pr.phosts ) )
+	for _, ph := range pr.phosts {
+		want[az_phost( ph )] = true
+	}
+
+	clist := make( []*place_cand, 0, len( n.switches ) )
+	for _, sw := range n.switches {
+		id := az_phost( *sw.Get_id() )
+		if (len( want ) > 0 && ! want[id]) || sw_quarantined( sw ) {
+			continue
+		}
+		delete( want, id )
+
+		c := &place_cand{ phost: id }
+		switch {
+			case sw == psw:
+				c.local = true
+				c.room = top
+
+			case n.relaxed:
+				c.room = top
+				c.hops = n.place_walk( sw, pmac, pr.commence, pr.conclude, 0, fence.Name, usr_max )
+
+			case usr_max > 0:
+				out, hops := n.place_room( sw, pmac, pr.commence, pr.conclude, fence.Name, usr_max, top )
+				in, _ := n.place_room( psw, sw.Get_id(), pr.commence, pr.conclude, fence.Name, usr_max, top )
+				c.room = out
+				if in < out {
+					c.room = in
+				}
+				c.hops = hops
+
+			default:								// tenant may not reserve anything
+				c.hops = n.place_walk( sw, pmac, pr.commence, pr.conclude, 0, fence.Name, usr_max )
+		}
+		clist = append( clist, c )
+	}
+
+	sort.Sort( place_list( clist ) )
+
+	net_sheep.Baa( 2, "placement: %d candidates ranked for %d to %s over %d-%d", len( clist ), pr.bandw, pr.peer, pr.commence, pr.conclude )
+
+	jstr := fmt.Sprintf( `{ "peer": %q, "peer_phost": %q, "bandwidth": %d, "commence": %d, "conclude": %d, "relaxed": %v, "candidates": [ `,
+		pr.peer, az_phost( *psw.Get_id() ), pr.bandw, pr.commence, pr.conclude, n.relaxed )
+	sep := ""
+	for _, c := range clist {
+		fits := c.local || (c.hops >= 0 && c.room >= pr.bandw)
+		jstr += fmt.Sprintf( `%s{ "phost": %q, "room": %d, "hops": %d, "local": %v, "fits": %v }`, sep, c.phost, c.room, c.hops, c.local, fits )
+		sep = ", "
+	}
+	jstr += " ]"
+
+	if len( want ) > 0 {								// named but not in the graph, or quarantined
+		jstr += `, "skipped": [ `
+		sep = ""
+		for ph := range want {
+			jstr += fmt.Sprintf( "%s%q", sep, ph )
+			sep = ", "
+		}
+		jstr += " ]"
+	}
+	jstr += " }"
+
+	return jstr, nil
+}
@@ -0,0 +1,425 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_provider
+	Abstract:	The network provider sits between the managers and network manager for the
+				requests that matter when the graph engine is replaced: address lookup
+				(REQ_GETIP), reservation (REQ_BW_RESERVE, REQ_BWOW_RESERVE, REQ_MCAST_RESERVE,
+				REQ_PT_RESERVE), release (REQ_DEL) and queue map generation (REQ_GEN_QMAP,
+				REQ_GEN_EPQMAP). Send is used where the requester waits for the answer, and
+				Post where the answer comes back on the requester's channel (queue maps).
+
+				The provider tegu runs with is always the existing network manager, reached over
+				nw_ch. A shadow provider may be named in the config (network:shadow); each of
+				the requests above is then also given to the shadow, with a copy of the data so
+				that the two can't interfere, and the outcomes (success or error, and the size
+				of the answer) are compared. The shadow's answers are only counted; they are
+				never used. Shadow requests run in their own goroutines and are dropped, not
+				queued, when too many (network:shadow_max) are outstanding, so a slow or wedged
+				shadow can't hold up production. If production refuses a reservation that the
+				shadow accepted, the shadow is sent a release for it. The counts are returned
+				by the netprov admin request.
+
+				Providers are registered by name: tegu (the network manager) and noop (accepts
+				everything and answers nothing; useful to measure the cost of mirroring). A
+				rewritten engine registers itself (register_net_provider) from its own init()
+				and is expected to track reservations by id.
+
+	CFG:		network:shadow - name of the shadow provider (none)
+				network:shadow_max - shadow requests outstanding before more are dropped (64)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Shadow requests carry the correlation id of the production request.
+*/
+
+package managers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type Network_provider interface {
+	Name( ) ( string )
+	Send( ctx context.Context, mtype int, data interface{}, late func( *ipc.Chmsg ) ) ( *ipc.Chmsg )		// wait for the answer
+	Post( mtype int, data interface{}, resp_ch chan *ipc.Chmsg )										// answer to resp_ch
+	Stats( ) ( string )
+}
+
+var (
+	net_prov		Network_provider								// what the managers use
+	net_providers	= map[string]func( ) Network_provider {}		// registered providers by name
+
+	shadow_types	= map[int]string {								// requests given to the shadow; name for the stats
+						REQ_GETIP:			"getip",
+						REQ_BW_RESERVE:		"bw_reserve",
+						REQ_BWOW_RESERVE:	"bwow_reserve",
+						REQ_MCAST_RESERVE:	"mcast_reserve",
+						REQ_PT_RESERVE:		"pt_reserve",
+						REQ_DEL:			"del",
+						REQ_GEN_QMAP:		"gen_qmap",
+						REQ_GEN_EPQMAP:		"gen_epqmap",
+					}
+)
+
+/*
+	Register a provider which may be named as the shadow.
+*/
+func register_net_provider( name string, mk func( ) Network_provider ) {
+	net_providers[name] = mk
+}
+
+/*
+	Set the provider from the config; called from Initialise after nw_ch is set. Without
+	a config, or a shadow, the network manager is used directly.
+*/
+func net_provider_init( ) {
+	net_prov = mk_chan_provider( "tegu", nw_ch )
+	register_net_provider( "noop", func( ) Network_provider { return &noop_provider{ } } )
+
+	if cfg_data == nil || cfg_data["network"] == nil {
+		return
+	}
+	p := cfg_data["network"]["shadow"]
+	if p == nil || *p == "" || *p == "none" {
+		return
+	}
+
+	mk := net_providers[*p]
+	if mk == nil || *p == "tegu" {							// a second copy of the real one would obligate twice
+		tegu_sheep.Baa( 0, "WRN: shadow network provider %s is not known or not allowed; running without a shadow  [TGUNET019]", *p )
+		return
+	}
+
+	max := 64
+	if p := cfg_data["network"]["shadow_max"]; p != nil {
+		if max = clike.Atoi( *p ); max < 1 {
+			max = 1
+		}
+	}
+
+	net_prov = mk_shadow_provider( net_prov, mk( ), max )
+	tegu_sheep.Baa( 1, "network requests are mirrored to the %s shadow provider (%d outstanding at most)", *p, max )
+}
+
+// ---- network manager over a channel ----------------------------------------------------------
+
+type chan_provider struct {
+	name	string
+	ch		chan *ipc.Chmsg
+}
+
+/*
+	A provider which is a goroutine reading requests from ch. A rewritten engine can use
+	this too.
+*/
+func mk_chan_provider( name string, ch chan *ipc.Chmsg ) ( *chan_provider ) {
+	return &chan_provider{ name: name, ch: ch }
+}
+
+func (cp *chan_provider) Name( ) ( string ) {
+	return cp.name
+}
+
+func (cp *chan_provider) Send( ctx context.Context, mtype int, data interface{}, late func( *ipc.Chmsg ) ) ( *ipc.Chmsg ) {
+	return ctx_req( ctx, cp.ch, mtype, data, late )
+}
+
+func (cp *chan_provider) Post( mtype int, data interface{}, resp_ch chan *ipc.Chmsg ) {
+	msg := ipc.Mk_chmsg( )
+	msg.Send_req( cp.ch, resp_ch, mtype, data, nil )
+}
+
+func (cp *chan_provider) Stats( ) ( string ) {
+	return fmt.Sprintf( `{ "provider": %q }`, cp.name )
+}
+
+// ---- no-op --------------------------------------------------------------------------------
+
+type noop_provider struct { }
+
+func (np *noop_provider) Name( ) ( string ) {
+	return "noop"
+}
+
+func (np *noop_provider) Send( ctx context.Context, mtype int, data interface{}, late func( *ipc.Chmsg ) ) ( *ipc.Chmsg ) {
+	msg := ipc.Mk_chmsg( )
+	msg.Msg_type = mtype
+	msg.Req_data = data
+	return msg
+}
+
+func (np *noop_provider) Post( mtype int, data interface{}, resp_ch chan *ipc.Chmsg ) {
+	if resp_ch != nil {
+		resp_ch <- np.Send( nil, mtype, data, nil )
+	}
+}
+
+func (np *noop_provider) Stats( ) ( string ) {
+	return `{ "provider": "noop" }`
+}
+
+// ---- shadow -------------------------------------------------------------------------------
+
+type shadow_count struct {
+	sent		int64
+	agree		int64
+	disagree	int64							// one succeeded and the other didn't, or the answers differ in size
+	shadow_err	int64							// of the disagreements, those where only the shadow failed
+	dropped		int64							// too many outstanding, or the data couldn't be copied
+}
+
+type shadow_provider struct {
+	primary		Network_provider
+	shadow		Network_provider
+	slots		chan bool						// one per outstanding shadow request
+	mu			sync.Mutex
+	counts		map[int]*shadow_count
+}
+
+func mk_shadow_provider( primary Network_provider, shadow Network_provider, max int ) ( *shadow_provider ) {
+	return &shadow_provider{
+		primary:	primary,
+		shadow:		shadow,
+		slots:		make( chan bool, max ),
+		counts:		make( map[int]*shadow_count ),
+	}
+}
+
+func (sp *shadow_provider) Name( ) ( string ) {
+	return sp.primary.Name()
+}
+
+/*
+	Size of an answer for comparison: entries in a list, or 1 for anything else.
+*/
+func answer_size( data interface{} ) ( int ) {
+	switch d := data.(type) {
+		case nil:
+			return 0
+		case []*gizmos.Path:
+			return len( d )
+		case []string:
+			return len( d )
+		case []interface{}:
+			return len( d )
+		case *string:
+			if d == nil {
+				return 0
+			}
+	}
+
+	return 1
+}
+
+/*
+	Copy the request data so that the shadow can't change what production is using.
+	Pledges are copied through their checkpoint form. Nil is returned if it can't be
+	copied.
+*/
+func shadow_copy( data interface{} ) ( interface{}, bool ) {
+	switch d := data.(type) {
+		case *gizmos.Pledge:
+			if d == nil {
+				return nil, false
+			}
+			cp, err := gizmos.Json2pledge( ptr_str( (*d).To_chkpt() ) )
+			return cp, err == nil
+
+		case gizmos.Pledge:
+			cp, err := gizmos.Json2pledge( ptr_str( d.To_chkpt() ) )
+			if err != nil {
+				return nil, false
+			}
+			return *cp, true
+
+		case *string:
+			if d == nil {
+				return d, true
+			}
+			s := *d
+			return &s, true
+
+		case int64:
+			return d, true
+	}
+
+	return nil, false
+}
+
+func ptr_str( s string ) ( *string ) {
+	return &s
+}
+
+/*
+	Count the outcome of one request given to both.
+*/
+func (sp *shadow_provider) count( mtype int, pok bool, psize int, sr *ipc.Chmsg ) {
+	sok := sr != nil && sr.State == nil
+	ssize := 0
+	if sok {
+		ssize = answer_size( sr.Response_data )
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	c := sp.counts[mtype]
+	if c == nil {
+		c = &shadow_count{ }
+		sp.counts[mtype] = c
+	}
+
+	c.sent++
+	if pok == sok && psize == ssize {
+		c.agree++
+		return
+	}
+
+	c.disagree++
+	if pok && ! sok {
+		c.shadow_err++
+	}
+	net_sheep.Baa( 2, "shadow %s disagrees on %s: production ok=%v size=%d, shadow ok=%v size=%d", sp.shadow.Name(), shadow_types[mtype], pok, psize, sok, ssize )
+}
+
+func (sp *shadow_provider) dropped( mtype int ) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.counts[mtype] == nil {
+		sp.counts[mtype] = &shadow_count{ }
+	}
+	sp.counts[mtype].dropped++
+}
+
+/*
+	Reserve a slot for a shadow request; false if none are free.
+*/
+func (sp *shadow_provider) take_slot( mtype int ) ( bool ) {
+	select {
+		case sp.slots <- true:
+			return true
+
+		default:
+			sp.dropped( mtype )
+			return false
+	}
+}
+
+/*
+	Give the request to production, then to the shadow in the background.
+*/
+func (sp *shadow_provider) Send( ctx context.Context, mtype int, data interface{}, late func( *ipc.Chmsg ) ) ( *ipc.Chmsg ) {
+	sdata, ok := shadow_copy( data )						// before production can change it
+
+	r := sp.primary.Send( ctx, mtype, data, late )
+	if _, mirrored := shadow_types[mtype]; ! mirrored {
+		return r
+	}
+	if ! ok {
+		sp.dropped( mtype )
+		return r
+	}
+	if ! sp.take_slot( mtype ) {
+		return r
+	}
+
+	pok := r.State == nil
+	psize := answer_size( r.Response_data )
+	cid := ctx_cid( ctx )
+	go func( ) {
+		defer func( ) { <- sp.slots }( )
+
+		sctx, cancel := nw_ctx( nil, cid )
+		defer cancel( )
+		sr := sp.shadow.Send( sctx, mtype, sdata, nil )
+		sp.count( mtype, pok, psize, sr )
+
+		if ! pok && sr != nil && sr.State == nil && mtype != REQ_GETIP && mtype != REQ_DEL {			// the shadow holds what production refused
+			rctx, rcancel := nw_ctx( nil, cid )
+			sp.shadow.Send( rctx, REQ_DEL, sdata, nil )
+			rcancel( )
+		}
+	}( )
+
+	return r
+}
+
+/*
+	Give the request to production and the shadow; production's answer is passed on to
+	resp_ch once it has been noted for the comparison.
+*/
+func (sp *shadow_provider) Post( mtype int, data interface{}, resp_ch chan *ipc.Chmsg ) {
+	_, mirrored := shadow_types[mtype]
+	sdata, ok := shadow_copy( data )
+	if ! mirrored || resp_ch == nil || ! ok || ! sp.take_slot( mtype ) {
+		if mirrored && ! ok {
+			sp.dropped( mtype )
+		}
+		sp.primary.Post( mtype, data, resp_ch )
+		return
+	}
+
+	pch := make( chan *ipc.Chmsg, 1 )
+	sp.primary.Post( mtype, data, pch )
+	go func( ) {
+		defer func( ) { <- sp.slots }( )
+
+		r := <- pch
+		resp_ch <- r											// production first; the shadow only costs the goroutine
+		pok := r.State == nil
+		psize := answer_size( r.Response_data )
+
+		sctx, cancel := nw_ctx( nil, "" )
+		defer cancel( )
+		sr := sp.shadow.Send( sctx, mtype, sdata, nil )
+		sp.count( mtype, pok, psize, sr )
+	}( )
+}
+
+func (sp *shadow_provider) Stats( ) ( string ) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	mtypes := make( []int, 0, len( sp.counts ) )
+	for mt := range sp.counts {
+		mtypes = append( mtypes, mt )
+	}
+	sort.Ints( mtypes )
+
+	jstr := fmt.Sprintf( `{ "provider": %q, "shadow": %q, "outstanding": %d, "requests": { `, sp.primary.Name(), sp.shadow.Name(), len( sp.slots ) )
+	sep := ""
+	for _, mt := range mtypes {
+		c := sp.counts[mt]
+		jstr += fmt.Sprintf( `%s%q: { "sent": %d, "agree": %d, "disagree": %d, "shadow_err": %d, "dropped": %d }`, sep, shadow_types[mt], c.sent, c.agree, c.disagree, c.shadow_err, c.dropped )
+		sep = ", "
+	}
+
+	return jstr + " } }"
+}
@@ -0,0 +1,174 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_qmap
+	Abstract:	Queue map for people. The queue map that is sent to fq-mgr is a flat list of
+				swid/port,res-id,queue,min,max,pri tokens; this builds the same information
+				for a point in time, grouped by switch and port, with the timeslice that each
+				queue comes from so that an operator can see which reservation owns a queue
+				and why a port is rate limited without digging through the fq-mgr logs.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+)
+
+/*
+	Request data for REQ_QMAP_DETAIL.
+*/
+type qmap_query struct {
+	ts			int64				// point in time
+	swid		string				// only this switch if not empty
+}
+
+type qm_queue struct {
+	Queue		int			`json:"queue"`
+	Res			string		`json:"res"`				// owning reservation (queue id), or priority
+	Min			int64		`json:"min"`
+	Max			int64		`json:"max"`
+	Pri			int			`json:"pri"`
+	Commence	int64		`json:"commence"`			// timeslice that the queue setting comes from
+	Conclude	int64		`json:"conclude"`
+}
+
+type qm_port struct {
+	Port		string		`json:"port"`
+	Queues		[]*qm_queue	`json:"queues"`
+}
+
+type qm_switch struct {
+	Switch		string		`json:"switch"`
+	Ports		[]*qm_port	`json:"ports"`
+}
+
+type qm_ports []*qm_port
+
+func (qp qm_ports) Len( ) int { return len( qp ) }
+func (qp qm_ports) Swap( i, j int ) { qp[i], qp[j] = qp[j], qp[i] }
+func (qp qm_ports) Less( i, j int ) bool {
+	pi := clike.Atoi( qp[i].Port )
+	pj := clike.Atoi( qp[j].Port )
+	if pi == pj {
+		return qp[i].Port < qp[j].Port
+	}
+	return pi < pj
+}
+
+type qm_queues []*qm_queue
+
+func (qq qm_queues) Len( ) int { return len( qq ) }
+func (qq qm_queues) Swap( i, j int ) { qq[i], qq[j] = qq[j], qq[i] }
+func (qq qm_queues) Less( i, j int ) bool { return qq[i].Queue < qq[j].Queue }
+
+/*
+	Build the queue map for the time given, limited to one switch if swid isn't empty, and
+	return it as json.
+*/
+func (n *Network) queue_map_json( ts int64, swid string ) ( string ) {
+	ports := make( map[string]map[string]*qm_port )		// switch -> port -> queues
+	seen := make( map[string]bool )						// double links generate the same token
+
+	add := func( s string, c int64, e int64 ) {
+		for _, tok := range strings.Split( s, " " ) {
+			if tok == "" || seen[tok] {
+				continue
+			}
+			seen[tok] = true
+
+			f := strings.Split( tok, "," )				// swid/port,res-id,queue,min,max,pri
+			if len( f ) < 6 {
+				continue
+			}
+			idx := strings.LastIndex( f[0], "/" )
+			if idx < 0 {
+				continue
+			}
+			sw := f[0][:idx]
+			if swid != "" && sw != swid {
+				continue
+			}
+
+			if ports[sw] == nil {
+				ports[sw] = make( map[string]*qm_port )
+			}
+			qp := ports[sw][f[0][idx+1:]]
+			if qp == nil {
+				qp = &qm_port{ Port: f[0][idx+1:], Queues: make( []*qm_queue, 0, 4 ) }
+				ports[sw][qp.Port] = qp
+			}
+			qp.Queues = append( qp.Queues, &qm_queue{ Queue: clike.Atoi( f[2] ), Res: f[1], Min: clike.Atoi64( f[3] ), Max: clike.Atoi64( f[4] ), Pri: clike.Atoi( f[5] ), Commence: c, Conclude: e } )
+		}
+	}
+
+	if n != nil {
+		for _, link := range n.links {
+			if c, e, ok := link.Get_slice_window( ts ); ok {
+				add( link.Queues2str( ts ), c, e )
+			}
+		}
+
+		for _, link := range n.vlinks {
+			if c, e, ok := link.Get_slice_window( ts ); ok {
+				add( link.Queues2str( ts ), c, e )
+			}
+		}
+	}
+
+	sws := make( []string, 0, len( ports ) )
+	for sw := range ports {
+		sws = append( sws, sw )
+	}
+	sort.Strings( sws )
+
+	out := make( []*qm_switch, 0, len( sws ) )
+	for _, sw := range sws {
+		qs := &qm_switch{ Switch: sw, Ports: make( []*qm_port, 0, len( ports[sw] ) ) }
+		for _, qp := range ports[sw] {
+			sort.Sort( qm_queues( qp.Queues ) )
+			qs.Ports = append( qs.Ports, qp )
+		}
+		sort.Sort( qm_ports( qs.Ports ) )
+		out = append( out, qs )
+	}
+
+	jb, err := json.Marshal( &struct {
+		Time		int64			`json:"time"`
+		Switches	[]*qm_switch	`json:"switches"`
+	}{ ts, out } )
+	if err != nil {
+		net_sheep.Baa( 1, "unable to marshal queue map: %s", err )
+		return "{ }"
+	}
+
+	return string( jb )
+}
@@ -0,0 +1,137 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_quarantine
+	Abstract:	The network manager's part of host quarantine (res_mgr_quarantine.go). Res-mgr
+				passes each quarantine as it is added or lifted. A bandwidth, oneway or multicast
+				reservation with an endpoint that is a quarantined VM, or a VM on a quarantined
+				physical host, is rejected; and quarantined physical hosts (switches in the
+				graph) are skipped when a path is searched for so that reservations which only
+				pass through one are given a path around it if there is one.
+
+				Used only by the network manager goroutine; no locking.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"strings"
+
+	"github.com/att/tegu/gizmos"
+)
+
+var (
+	quar_vm		map[string]string			// quarantined VM ip -> quarantine name
+	quar_sw		map[string]string			// quarantined physical host (switch name less domain) -> quarantine name
+)
+
+/*
+	Add or lift a quarantine. The VM of an add must be known to the graph.
+*/
+func (n *Network) set_quarantine( qr *quar_req ) ( error ) {
+	if quar_vm == nil {
+		quar_vm = make( map[string]string )
+		quar_sw = make( map[string]string )
+	}
+
+	switch qr.action {
+		case "add":
+			if qr.kind == "vm" {
+				if n == nil {
+					return mk_err( ERR_NOT_FOUND, "network graph has not been built; try again later" )
+				}
+				ip, err := n.name2ip( &qr.target )
+				if err != nil {
+					return err
+				}
+				quar_vm[strings.TrimPrefix( *ip, "!" )] = qr.name
+			} else {
+				quar_sw[az_phost( qr.target )] = qr.name
+			}
+			net_sheep.Baa( 1, "quarantine %s added: %s %s", qr.name, qr.kind, qr.target )
+
+		case "del":
+			for k, name := range quar_vm {
+				if name == qr.name {
+					delete( quar_vm, k )
+				}
+			}
+			for k, name := range quar_sw {
+				if name == qr.name {
+					delete( quar_sw, k )
+				}
+			}
+			net_sheep.Baa( 1, "quarantine %s lifted", qr.name )
+	}
+
+	return nil
+}
+
+/*
+	Returns true if the switch is a quarantined physical host.
+*/
+func sw_quarantined( sw *gizmos.Switch ) ( bool ) {
+	if len( quar_sw ) == 0 || sw == nil || sw.Get_id() == nil {
+		return false
+	}
+
+	return quar_sw[az_phost( *sw.Get_id() )] != ""
+}
+
+/*
+	Return an error if any of the endpoints (ips as known to the graph; nil and external
+	addresses are skipped) is quarantined or lives on a quarantined physical host.
+*/
+func (n *Network) quar_admit( ips ...*string ) ( error ) {
+	if len( quar_vm ) == 0 && len( quar_sw ) == 0 {
+		return nil
+	}
+
+	for _, ip := range ips {
+		if ip == nil {
+			continue
+		}
+
+		lip := strings.TrimPrefix( *ip, "!" )
+		if name := quar_vm[lip]; name != "" {
+			return mk_err( ERR_BAD_REQUEST, "host is quarantined (%s): %s", name, lip )
+		}
+
+		h := n.hosts[lip]
+		for i := 0; h != nil; i++ {
+			sw, _ := h.Get_switch_port( i )
+			if sw == nil {
+				break
+			}
+			if sw_quarantined( sw ) {
+				return mk_err( ERR_BAD_REQUEST, "host %s is on a quarantined physical host (%s): %s", lip, quar_sw[az_phost( *sw.Get_id() )], *sw.Get_id() )
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_reach
+	Abstract:	Reachability pre-check for a pair of hosts: is there a path between them in
+				each direction, and what is the most that could be reserved over the window.
+				Intended for a UI to check a reservation before it is submitted. Nothing is
+				obligated and no pledge is created; the graph is used as it is (a VM that
+				isn't in it yet is reported as unknown rather than being fetched).
+
+				The path search is the one a bandwidth reservation uses (build_paths), so
+				projects, gateways, the tenant's fence, quarantines and the path cache all
+				apply. The most that could be reserved in a direction is the largest amount
+				for which a path is found and the zone and router leg checks pass, found by a
+				binary search to within 1/1024th of the largest link. In relaxed mode there
+				is no admission control and the largest link is reported.
+
+				The network bandwidth discount is not applied; the amounts are what would be
+				obligated.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	A reachability request as passed from http to the network manager; hosts are as
+	validated by osif.
+*/
+type reach_req struct {
+	h1			string
+	h2			string
+	commence	int64
+	conclude	int64
+}
+
+/*
+	Paths from ip1 to ip2 (or the reverse when rpath is set) which could take amt over the
+	window. Nil if there are none, or if the zone or router leg policies would refuse them.
+*/
+func (n *Network) reach_paths( ip1 *string, ip2 *string, commence int64, conclude int64, amt int64, find_all bool, rpath bool ) ( []*gizmos.Path, bool ) {
+	var pcount int
+	var plist []*gizmos.Path
+	var cap_trip bool
+
+	if rpath {
+		pcount, plist, cap_trip = n.build_paths( ip2, ip1, commence, conclude, amt, find_all, true )
+	} else {
+		pcount, plist, cap_trip = n.build_paths( ip1, ip2, commence, conclude, amt, find_all, false )
+	}
+	if pcount <= 0 {
+		return nil, cap_trip
+	}
+
+	if n.az_admit( ip1, []*string{ ip2 }, plist, commence, conclude ) != nil || n.gw_admit( plist, commence, conclude ) != nil {
+		return nil, true
+	}
+	return plist, false
+}
+
+/*
+	Find the most that can be reserved in one direction. Top is the largest amount worth
+	trying.
+*/
+func (n *Network) reach_room( ip1 *string, ip2 *string, commence int64, conclude int64, find_all bool, rpath bool, top int64 ) ( int64 ) {
+	lo := int64( 0 )						// known to fit
+	hi := top								// not known to fit
+	near := top / 1024
+	for hi - lo > near {
+		mid := lo + (hi - lo + 1) / 2
+		if plist, _ := n.reach_paths( ip1, ip2, commence, conclude, mid, find_all, rpath ); plist != nil {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return lo
+}
+
+/*
+	Number of links in the first path of the list.
+*/
+func reach_hops( plist []*gizmos.Path ) ( int ) {
+	if len( plist ) == 0 || plist[0] == nil {
+		return -1
+	}
+	return plist[0].Get_nlinks()
+}
+
+/*
+	Answer a reachability request with json. An error is returned only if a host isn't known.
+*/
+func (n *Network) reach( rr *reach_req, find_all bool ) ( string, error ) {
+	ip1, err := n.name2ip( &rr.h1 )
+	if err != nil {
+		return "", err
+	}
+	ip2, err := n.name2ip( &rr.h2 )
+	if err != nil {
+		return "", err
+	}
+
+	reason := ""
+	reachable := false
+	out_max := int64( 0 )
+	in_max := int64( 0 )
+	out_hops := -1
+	in_hops := -1
+
+	top := int64( 0 )
+	for _, l := range n.links {
+		if c := l.Get_allotment().Get_max_capacity(); c > top {
+			top = c
+		}
+	}
+
+	if err = n.quar_admit( ip1, ip2 ); err != nil {
+		reason = fmt.Sprintf( "%s", err )
+	} else {
+		oplist, ocap := n.reach_paths( ip1, ip2, rr.commence, rr.conclude, 0, find_all, false )
+		iplist, icap := n.reach_paths( ip1, ip2, rr.commence, rr.conclude, 0, find_all, true )
+		out_hops = reach_hops( oplist )
+		in_hops = reach_hops( iplist )
+
+		switch {
+			case oplist == nil && ocap:
+				reason = "no capacity, or refused by policy (h1->h2)"
+
+			case oplist == nil:
+				reason = "no path (h1->h2)"
+
+			case iplist == nil && icap:
+				reason = "no capacity, or refused by policy (h1<-h2)"
+
+			case iplist == nil:
+				reason = "no path (h1<-h2)"
+
+			case n.relaxed:
+				reachable = true
+				out_max = top
+				in_max = top
+
+			default:
+				reachable = true
+				out_max = n.reach_room( ip1, ip2, rr.commence, rr.conclude, find_all, false, top )
+				in_max = n.reach_room( ip1, ip2, rr.commence, rr.conclude, find_all, true, top )
+		}
+	}
+
+	max := out_max
+	if in_max < max {
+		max = in_max
+	}
+
+	net_sheep.Baa( 2, "reach: %s <-> %s reachable=%v out=%d in=%d %s", rr.h1, rr.h2, reachable, out_max, in_max, reason )
+
+	return fmt.Sprintf( `{ "h1": %q, "h2": %q, "commence": %d, "conclude": %d, "reachable": %v, "relaxed": %v, "max_bandwidth": %d, "out": { "hops": %d, "max_bandwidth": %d }, "in": { "hops": %d, "max_bandwidth": %d }, "reason": %q }`,
+		rr.h1, rr.h2, rr.commence, rr.conclude, reachable, n.relaxed, max, out_hops, out_max, in_hops, in_max, reason ), nil
+}
@@ -112,9 +112,17 @@
 						timeconsuming.
 				17 Dec 2015 - Shift from requesting all network hosts to requesting only L3 hosts 
 						from openstack.
+				16 Oct 2026 - Added kubernetes pod endpoints (REQ_K8S_POD).
+				16 Oct 2026 - Mask admin token in log message.
+				16 Oct 2026 - Simulated VMs and host list are used in simulation mode (see sim.go).
+				16 Oct 2026 - Added export of reservation state to openstack tags (osif_tags.go).
+				16 Oct 2026 - Added sync of reserved bandwidth to openstack quotas (osif_quota.go).
 
 	Deprecated messages -- do NOT reuse the number as it already maps to something in ops doc!
 				osif_sheep.Baa( 0, "WRN: no response channel for host list request  [TGUOSI011] DEPRECATED MESSAGE" )
+				16 Oct 2026 - Added VM labels from instance metadata for reservation selectors (osif_label.go).
+				16 Oct 2026 - Requests are logged with their correlation id.
+				16 Oct 2026 - K8s pod names are token validated against the owning project; saved pods are loaded at start.
 */
 
 package managers
@@ -299,7 +307,7 @@ func validate_admin_token( admin *ostack.Ostack, token *string, user *string ) (
 	osif_sheep.Baa( 2, "validating admin token" )
 	exp, err := admin.Token_validation( token, user ) 		// ensure token is good and was issued for user
 	if err == nil {
-		osif_sheep.Baa( 2, "admin token validated successfully: %s expires: ", *token, exp )
+		osif_sheep.Baa( 2, "admin token validated successfully: %s expires: %v", gizmos.Mask( *token ), exp )
 	} else {
 		osif_sheep.Baa( 1, "admin token invalid: %s", err )
 	}
@@ -635,6 +643,9 @@ func Osif_mgr( my_chan chan *ipc.Chmsg ) {
 		def_url		*string
 		def_project	*string
 		def_region	*string
+		tagw		*tag_writer					// openstack tag export (osif_tags.go); nil if not enabled
+		quotaw		*quota_writer				// openstack quota sync (osif_quota.go); nil if not enabled
+		labelr		*label_reader				// vm labels from instance metadata (osif_label.go); nil if not enabled
 	)
 
 	osif_sheep = bleater.Mk_bleater( 0, os.Stderr )		// allocate our bleater and attach it to the master
@@ -759,10 +770,15 @@ func Osif_mgr( my_chan chan *ipc.Chmsg ) {
 
 	// ---------------- end config parsing ----------------------------------------
 
+	k8s_init( cfg_data["osif"]["k8s_pod_file"] )								// saved pods; nil section yields nil
+
 
 	if os_admin != nil {														// only if we are using openstack as a database
 		//tklr.Add_spot( 3, my_chan, REQ_GENCREDS, nil, 1 )						// add tickle spot to drive us once in 3s and then another to drive us based on config refresh rate
 		tklr.Add_spot( int64( 180 ), my_chan, REQ_GENCREDS, nil, ipc.FOREVER )
+		tagw = mk_tag_writer( )
+		quotaw = mk_quota_writer( )
+		labelr = mk_label_reader( )
 	}
 
 	osif_sheep.Baa( 2, "osif manager is running  %x", my_chan )
@@ -770,8 +786,26 @@ func Osif_mgr( my_chan chan *ipc.Chmsg ) {
 		msg = <- my_chan					// wait for next message from tickler
 		msg.State = nil						// default to all OK
 
-		osif_sheep.Baa( 3, "processing request: %d", msg.Msg_type )
+		baa_req( osif_sheep, msg )
 		switch msg.Msg_type {
+			case REQ_K8S_POD:								// pod added or deleted via cni callback
+				msg.State = k8s_update( msg.Req_data.( *k8s_req ) )
+
+			case REQ_TAG_EXPORT:							// endpoint reservation state from res-mgr
+				msg.Response_ch = nil
+				if tagw != nil {
+					tagw.export( tagw.xlate( msg.Req_data.( map[string][]string ), os_projects ) )
+				}
+
+			case REQ_QUOTA_SYNC:							// reserved bandwidth by project from res-mgr
+				msg.Response_ch = nil
+				if quotaw != nil {
+					quotaw.sync( msg.Req_data.( map[string]int64 ) )
+				}
+
+			case REQ_LABEL_READ, REQ_LABEL_MAP, REQ_LABEL_VMS, REQ_LIST_LABELS:		// vm labels for reservation selectors
+				labelr.req( msg )
+
 			case REQ_GENMAPS:								// driven by tickler
 					// deprecated with switch to lazy update
 
@@ -800,6 +834,8 @@ func Osif_mgr( my_chan chan *ipc.Chmsg ) {
 				freq := ipc.Mk_chmsg( )										// need a new request to pass to fq_mgr
 				data, err := get_ip2mac( os_projects )
 				if err == nil {
+					k8s_fill_ip2mac( data )
+					sim_net.fill_ip2mac( data )
 					osif_sheep.Baa( 2, "sending ip2mac map to fq_mgr" )
 					freq.Send_req( fq_ch, nil, REQ_IP2MACMAP, data, nil )	// request data forward
 					msg.State = nil											// response ok back to requester
@@ -809,6 +845,10 @@ func Osif_mgr( my_chan chan *ipc.Chmsg ) {
 
 			case REQ_CHOSTLIST:
 				if msg.Response_ch != nil {										// no sense going off to ostack if no place to send the list
+					if sim_net != nil {
+						msg.Response_data = sim_net.host_list()
+						break
+					}
 					osif_sheep.Baa( 2, "starting list host" )
 					msg.Response_data, msg.State = get_hosts( os_refs )
 					osif_sheep.Baa( 2, "finishing list host" )
@@ -842,6 +882,14 @@ func Osif_mgr( my_chan chan *ipc.Chmsg ) {
 
 			case REQ_GET_HOSTINFO:						// dig out all of the bits of host info for a single host from openstack and return in a network update struct
 				if msg.Response_ch != nil {
+					if vm := k8s_hostinfo( msg.Req_data.( *string ) ); vm != nil {		// pods are known locally; no need to go to openstack
+						msg.Response_data = vm
+						break
+					}
+					if vm := sim_net.hostinfo( msg.Req_data.( *string ) ); vm != nil {
+						msg.Response_data = vm
+						break
+					}
 					go get_os_hostinfo( msg, os_refs, os_projects, id2pname, pname2id )			// do it asynch and return the result on the message channel
 					msg = nil							// prevent early response
 				}
@@ -860,6 +908,14 @@ func Osif_mgr( my_chan chan *ipc.Chmsg ) {
 
 			case REQ_VALIDATE_HOST:						// validate and translate a [token/]project-name/host  string
 				if msg.Response_ch != nil {
+					if pname, err := k8s_validate( msg.Req_data.( *string ), os_refs, req_token ); pname != nil || err != nil {	// token must be good for the pod's owner
+						msg.Response_data, msg.State = pname, err
+						break
+					}
+					if pname := sim_net.validate( msg.Req_data.( *string ) ); pname != nil {		// nor are simulated VMs
+						msg.Response_data = pname
+						break
+					}
 					if ! have_project(  msg.Req_data.( *string ), pname2id, id2pname ) {				// ensure that we have creds for this project, if not attempt to get
 						os_refs, pname2id, id2pname = update_project( os_admin, os_refs, os_projects, pname2id, id2pname, os_list == "all"  )
 					}
@@ -868,6 +924,14 @@ func Osif_mgr( my_chan chan *ipc.Chmsg ) {
 
 			case REQ_XLATE_HOST:						// accepts a [token/][project/]host name and translate project to an ID
 				if msg.Response_ch != nil {
+					if pname, _ := k8s_validate( msg.Req_data.( *string ), os_refs, false ); pname != nil {
+						msg.Response_data = pname
+						break
+					}
+					if pname := sim_net.validate( msg.Req_data.( *string ) ); pname != nil {
+						msg.Response_data = pname
+						break
+					}
 					if ! have_project( msg.Req_data.( *string ), pname2id, id2pname ) {				// ensure that we have creds for this project, if not attempt to get
 						os_refs, pname2id, id2pname = update_project( os_admin, os_refs, os_projects, pname2id, id2pname, os_list == "all"  )
 					}
@@ -0,0 +1,296 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+	Mnemonic:	osif_k8s.go
+	Abstract:	Kubernetes pod endpoints. Pods are learned from CNI plugin callbacks (cni_add and
+				cni_del requests on the API) which carry the namespace, pod name, address, mac,
+				the node that the pod was placed on, and the openstack project which owns the
+				namespace. Pods are named k8s.<namespace>/<pod> and once known osif treats them
+				as it does VMs: host info requests generate the network graph insertion struct,
+				and the pod addresses are added to the ip2mac map that is pushed to fq-mgr.
+
+				A pod is reserved as token/k8s.<namespace>/<pod>. When tokens are required
+				(osif:require_token) the token must be valid for the pod's owning project, just
+				as it must be valid for the project of a VM; a ! in place of the token marks
+				the pod as not authorised (cross-tenant) as it does for VMs. The cni requests
+				themselves are restricted to sysproc roles.
+
+				The pod map is owned by the osif goroutine and is only referenced from there.
+				It is saved to a file each time it changes and loaded when osif starts so that
+				pods added before a restart can still be reserved (CNI does not call again for
+				pods which are already running).
+
+	CFG:		osif:k8s_pod_file - file where the pod map is saved (/var/lib/tegu/k8s_pods)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Pods are owned by a project and tokens are validated against it; the
+					pod map is saved and reloaded.
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/att/gopkgs/ostack"
+)
+
+const (
+	K8S_PREFIX	string = "k8s."				// project portion of a pod name is k8s.<namespace>
+)
+
+/*
+	A pod. Exported fields are saved.
+*/
+type k8s_pod struct {
+	Name	string							// k8s.namespace/pod
+	Ip4		string							// project/ip form as used for VMs (k8s.namespace/ip)
+	Mac		string
+	Phost	string							// node (physical host) the pod is running on
+	Owner	string							// openstack project (name or ID) owning the namespace
+}
+
+/*
+	Data sent to osif with REQ_K8S_POD. If del is set, only the name is needed.
+*/
+type k8s_req struct {
+	del		bool
+	pod		*k8s_pod
+}
+
+var (
+	k8s_pods	map[string]*k8s_pod				// k8s.namespace/pod -> info
+	k8s_pod_file	string = "/var/lib/tegu/k8s_pods"
+)
+
+/*
+	Set up from the config and load the saved pods. Called once by osif before it starts
+	taking requests.
+*/
+func k8s_init( fname *string ) {
+	if fname != nil && *fname != "" {
+		k8s_pod_file = *fname
+	}
+
+	load_k8s_pods( )
+}
+
+/*
+	Load the pod file; silently does nothing if it is missing.
+*/
+func load_k8s_pods( ) {
+	k8s_pods = make( map[string]*k8s_pod )
+	buf, err := ioutil.ReadFile( k8s_pod_file )
+	if err != nil {
+		return
+	}
+
+	list := make( []*k8s_pod, 0 )
+	if err = json.Unmarshal( buf, &list ); err != nil {
+		osif_sheep.Baa( 0, "WRN: unable to parse k8s pod file %s: %s  [TGUOSI022]", k8s_pod_file, err )
+		return
+	}
+
+	for _, pod := range list {
+		if pod != nil && pod.Name != "" && pod.Owner != "" {		// a pod without an owner could be reserved by anybody
+			k8s_pods[pod.Name] = pod
+		}
+	}
+
+	osif_sheep.Baa( 1, "loaded %d k8s pods from %s", len( k8s_pods ), k8s_pod_file )
+}
+
+/*
+	Write the pods to the file.
+*/
+func save_k8s_pods( ) {
+	list := make( []*k8s_pod, 0, len( k8s_pods ) )
+	for _, pod := range k8s_pods {
+		list = append( list, pod )
+	}
+
+	buf, err := json.Marshal( list )
+	if err == nil {
+		err = ioutil.WriteFile( k8s_pod_file + ".new", buf, 0644 )
+	}
+	if err == nil {
+		err = os.Rename( k8s_pod_file + ".new", k8s_pod_file )
+	}
+	if err != nil {
+		osif_sheep.Baa( 1, "unable to save k8s pods: %s", err )
+	}
+}
+
+/*
+	Build a request to add a pod. Owner is the project (name or ID) which owns the namespace.
+*/
+func mk_k8s_add( ns string, pod string, ip4 string, mac string, phost string, owner string ) ( *k8s_req ) {
+	return &k8s_req {
+		pod: &k8s_pod {
+			Name:	K8S_PREFIX + ns + "/" + pod,
+			Ip4:	K8S_PREFIX + ns + "/" + ip4,
+			Mac:	strings.ToLower( mac ),
+			Phost:	phost,
+			Owner:	owner,
+		},
+	}
+}
+
+/*
+	Build a request to delete a pod.
+*/
+func mk_k8s_del( ns string, pod string ) ( *k8s_req ) {
+	return &k8s_req {
+		del: true,
+		pod: &k8s_pod { Name: K8S_PREFIX + ns + "/" + pod },
+	}
+}
+
+/*
+	Apply an add or delete request to the pod map and save the map.
+*/
+func k8s_update( r *k8s_req ) ( err error ) {
+	if r == nil || r.pod == nil {
+		return fmt.Errorf( "no pod information" )
+	}
+
+	if k8s_pods == nil {
+		k8s_pods = make( map[string]*k8s_pod )
+	}
+
+	if r.del {
+		if k8s_pods[r.pod.Name] == nil {
+			return fmt.Errorf( "unknown pod: %s", r.pod.Name )
+		}
+		delete( k8s_pods, r.pod.Name )
+		save_k8s_pods( )
+		osif_sheep.Baa( 1, "k8s pod removed: %s", r.pod.Name )
+		return nil
+	}
+
+	if strings.HasSuffix( r.pod.Ip4, "/" ) || r.pod.Phost == "" || r.pod.Owner == "" {
+		return fmt.Errorf( "pod address, node and owning project are required: %s", r.pod.Name )
+	}
+
+	k8s_pods[r.pod.Name] = r.pod
+	save_k8s_pods( )
+	osif_sheep.Baa( 1, "k8s pod added: %s ip=%s mac=%s node=%s owner=%s", r.pod.Name, r.pod.Ip4, r.pod.Mac, r.pod.Phost, r.pod.Owner )
+	return nil
+}
+
+/*
+	If the [token/]k8s.namespace/pod[:port][{vlan}] name references a known pod, the name
+	without the token is returned (with a leading ! if the token was !), otherwise nil. When
+	tok_req is set the token must be valid for the pod's owning project and an error is
+	returned if it isn't; nil and no error means the name isn't a pod's and validation is
+	left to the caller.
+*/
+func k8s_validate( raw *string, os_refs map[string]*ostack.Ostack, tok_req bool ) ( *string, error ) {
+	if raw == nil || k8s_pods == nil {
+		return nil, nil
+	}
+
+	if strings.Index( *raw, K8S_PREFIX ) < 0 {			// quick exit for the usual case
+		return nil, nil
+	}
+
+	tok := ""
+	name := *raw
+	if toks := strings.SplitN( name, "/", 3 ); len( toks ) == 3 {
+		tok = toks[0]
+		name = toks[1] + "/" + toks[2]
+	}
+	if ! strings.HasPrefix( name, K8S_PREFIX ) {
+		return nil, nil
+	}
+
+	key := name
+	if i := strings.IndexAny( key, ":{" ); i > 0 {			// port and/or vlan aren't part of the pod name
+		key = key[0:i]
+	}
+	pod := k8s_pods[key]
+	if pod == nil {
+		return nil, nil
+	}
+
+	if tok == "!" {											// not authorised; flagged just as validate_token() does for a VM
+		xstr := "!" + name
+		return &xstr, nil
+	}
+
+	if ! tok_req {
+		return &name, nil
+	}
+
+	if tok == "" {
+		return nil, fmt.Errorf( "token prefixed host names are required (token/k8s.namespace/pod): token not found" )
+	}
+
+	pname, idp, err := token2project( os_refs, &tok )
+	if pname == nil {
+		if err == nil {
+			err = fmt.Errorf( "no diagnostic" )
+		}
+		return nil, fmt.Errorf( "unable to determine project from token: %s", err )
+	}
+	if *pname != pod.Owner && *idp != pod.Owner {			// owner may have been given as either
+		osif_sheep.Baa( 1, "invalid token for k8s pod %s: owner is %s openstack reports: %s/%s", key, pod.Owner, *pname, *idp )
+		return nil, fmt.Errorf( "token is not valid for the project owning pod %s", key )
+	}
+
+	return &name, nil
+}
+
+/*
+	Build a network graph insertion struct for the pod if it's known.
+*/
+func k8s_hostinfo( name *string ) ( *Net_vm ) {
+	if name == nil || k8s_pods == nil {
+		return nil
+	}
+
+	pod := k8s_pods[*name]
+	if pod == nil {
+		return nil
+	}
+
+	n := pod.Name
+	ip := pod.Ip4
+	mac := pod.Mac
+	phost := pod.Phost
+	return Mk_netreq_vm( &n, &n, &ip, nil, &phost, &mac, nil, nil, nil )
+}
+
+/*
+	Add pod addresses to the ip2mac map.
+*/
+func k8s_fill_ip2mac( m map[string]*string ) {
+	for _, pod := range k8s_pods {
+		mac := pod.Mac
+		m[pod.Ip4] = &mac
+	}
+}
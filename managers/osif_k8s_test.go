@@ -0,0 +1,110 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+package managers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ostack"
+)
+
+/*
+	A pod must have an owner, must survive a restart (saved and loaded) and, when tokens are
+	required, may not be reserved without a token that openstack says is good for the owner.
+*/
+func TestK8s_pods( t *testing.T ) {
+	osif_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	dir, err := ioutil.TempDir( "", "tegu_k8s" )
+	if err != nil {
+		t.Fatal( err )
+	}
+	defer os.RemoveAll( dir )
+	fname := filepath.Join( dir, "k8s_pods" )
+	k8s_init( &fname )
+	defer func() { k8s_pods = nil }()
+
+	if err := k8s_update( mk_k8s_add( "ns1", "pod1", "10.1.0.5", "FA:16:3E:00:00:05", "node1", "" ) ); err == nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] pod without an owning project was accepted\n" )
+		errs++
+	}
+	if err := k8s_update( mk_k8s_add( "ns1", "pod1", "10.1.0.5", "FA:16:3E:00:00:05", "node1", "proj1" ) ); err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] pod add refused: %s\n", err )
+		errs++
+	}
+
+	k8s_pods = nil
+	k8s_init( &fname )											// as after a restart
+	if pod := k8s_pods["k8s.ns1/pod1"]; pod == nil || pod.Owner != "proj1" || pod.Mac != "fa:16:3e:00:00:05" {
+		fmt.Fprintf( os.Stderr, "[FAIL] pod not restored from %s: %v\n", fname, pod )
+		errs++
+	}
+
+	refs := make( map[string]*ostack.Ostack )					// no creds, so no token is found to be good
+	cases := []struct {
+		raw		string
+		tok_req	bool
+		expect	string										// empty if nil is expected
+		err		bool
+	} {
+		{ "tok/k8s.ns1/pod1", true, "", true },
+		{ "k8s.ns1/pod1", true, "", true },
+		{ "!/k8s.ns1/pod1:80", true, "!k8s.ns1/pod1:80", false },
+		{ "tok/k8s.ns1/pod1{10}", false, "k8s.ns1/pod1{10}", false },
+		{ "tok/k8s.ns1/nosuch", true, "", false },
+		{ "tok/proj1/vm1", true, "", false },
+	}
+	for _, c := range cases {
+		raw := c.raw
+		name, err := k8s_validate( &raw, refs, c.tok_req )
+		got := ""
+		if name != nil {
+			got = *name
+		}
+		if got != c.expect || (err != nil) != c.err {
+			fmt.Fprintf( os.Stderr, "[FAIL] validate %s (tok_req=%v): expected %q err=%v, got %q err=%v\n", c.raw, c.tok_req, c.expect, c.err, got, err )
+			errs++
+		}
+	}
+
+	if err := k8s_update( mk_k8s_del( "ns1", "pod1" ) ); err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] pod delete refused: %s\n", err )
+		errs++
+	}
+	k8s_init( &fname )
+	if len( k8s_pods ) != 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] deleted pod was restored\n" )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   k8s pods are owned, saved and token validated\n" )
+	} else {
+		t.Fail()
+	}
+}
@@ -0,0 +1,196 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	osif_keystone
+	Abstract:	A small keystone (v3) session for the osif jobs which write to openstack
+				services directly (tag export, quota sync) rather than through the ostack
+				package. The session authenticates with the osif admin credentials, keeps the
+				token until it is about to expire, and remembers the endpoint and service ID
+				of each service in the catalogue for the interface (and region) configured.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type os_session struct {
+	url			string							// keystone
+	usr			string
+	passwd		string
+	project		string
+	region		string
+	iface		string
+	client		*http.Client
+	hdrs		map[string]string				// added to every request
+	token		string
+	token_exp	time.Time
+	eps			map[string]string				// service type to endpoint from the catalogue
+	svc_ids		map[string]string				// service type to service id
+}
+
+/*
+	Create a session from the osif config section. Iface_key names the config item
+	giving the catalogue interface (public if not set). Nil is returned if the url or user
+	is missing.
+*/
+func mk_os_session( sect map[string]*string, iface_key string ) ( *os_session ) {
+	s := &os_session{
+		iface:		"public",
+		client:		&http.Client{ Timeout: 30 * time.Second },
+		hdrs:		make( map[string]string ),
+		eps:		make( map[string]string ),
+		svc_ids:	make( map[string]string ),
+	}
+	for k, v := range map[string]*string{ "url": &s.url, "usr": &s.usr, "passwd": &s.passwd, "project": &s.project, "region": &s.region, iface_key: &s.iface } {
+		if p := sect[k]; p != nil {
+			*v = *p
+		}
+	}
+	if s.url == "" || s.usr == "" {
+		return nil
+	}
+
+	return s
+}
+
+/*
+	Return the keystone url without a version.
+*/
+func (s *os_session) base( ) ( string ) {
+	base := strings.TrimRight( s.url, "/" )
+	return strings.TrimSuffix( strings.TrimSuffix( base, "/v2.0" ), "/v3" )
+}
+
+/*
+	Make a request to an openstack service. Data, if not nil, is sent as json; the response
+	is decoded into resp if it isn't nil.
+*/
+func (s *os_session) call( method string, url string, data interface{}, resp interface{} ) ( error ) {
+	var body *bytes.Reader
+	if data != nil {
+		jb, err := json.Marshal( data )
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader( jb )
+	} else {
+		body = bytes.NewReader( nil )
+	}
+
+	req, err := http.NewRequest( method, url, body )
+	if err != nil {
+		return err
+	}
+	req.Header.Set( "X-Auth-Token", s.token )
+	req.Header.Set( "Content-Type", "application/json" )
+	for k, v := range s.hdrs {
+		req.Header.Set( k, v )
+	}
+
+	rsp, err := s.client.Do( req )
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	rb, _ := ioutil.ReadAll( rsp.Body )
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf( "%s %s: status %d", method, url, rsp.StatusCode )
+	}
+	if resp != nil && len( rb ) > 0 {
+		return json.Unmarshal( rb, resp )
+	}
+
+	return nil
+}
+
+/*
+	Get a token, and the endpoints, if we don't have one or it expires soon. An error is
+	returned if any of the service types in need isn't in the catalogue.
+*/
+func (s *os_session) auth( need ...string ) ( error ) {
+	if s.token != "" && time.Now().Add( 5 * time.Minute ).Before( s.token_exp ) {
+		return nil
+	}
+
+	areq := fmt.Sprintf( `{ "auth": { "identity": { "methods": [ "password" ], "password": { "user": { "name": %q, "domain": { "id": "default" }, "password": %q } } }, "scope": { "project": { "name": %q, "domain": { "id": "default" } } } } }`,
+		s.usr, s.passwd, s.project )
+	rsp, err := s.client.Post( s.base() + "/v3/auth/tokens", "application/json", strings.NewReader( areq ) )
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != 201 {
+		return fmt.Errorf( "status %d", rsp.StatusCode )
+	}
+
+	var ar struct {
+		Token	struct {
+			Expires		time.Time	`json:"expires_at"`
+			Catalog		[]struct {
+				Id			string	`json:"id"`
+				Type		string	`json:"type"`
+				Endpoints	[]struct {
+					Interface	string	`json:"interface"`
+					Region		string	`json:"region"`
+					Url			string	`json:"url"`
+				}	`json:"endpoints"`
+			}	`json:"catalog"`
+		}	`json:"token"`
+	}
+	if err = json.NewDecoder( rsp.Body ).Decode( &ar ); err != nil {
+		return err
+	}
+
+	s.eps = make( map[string]string )
+	s.svc_ids = make( map[string]string )
+	for _, svc := range ar.Token.Catalog {
+		s.svc_ids[svc.Type] = svc.Id
+		for _, ep := range svc.Endpoints {
+			if ep.Interface == s.iface && (s.region == "" || ep.Region == s.region) {
+				s.eps[svc.Type] = strings.TrimRight( ep.Url, "/" )
+			}
+		}
+	}
+	for _, t := range need {
+		if s.eps[t] == "" {
+			return fmt.Errorf( "%s endpoint (%s) not in the catalogue", t, s.iface )
+		}
+	}
+
+	s.token = rsp.Header.Get( "X-Subject-Token" )
+	s.token_exp = ar.Token.Expires
+	return nil
+}
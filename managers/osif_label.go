@@ -0,0 +1,259 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	osif_label
+	Abstract:	VM labels for reservation selectors (res_mgr_label.go). A label is an item in
+				the instance (nova) metadata of a VM; a selector of project/@key.value matches
+				the VMs in the project whose metadata has key set to value.
+
+				The reader goroutine lists the servers of all projects with their metadata and
+				hands the result to osif (REQ_LABEL_MAP). Reads are driven by the tickler
+				(REQ_LABEL_READ); if the reader is still busy with the last read the tickle is
+				dropped. Once osif has the new labels res-mgr is told to evaluate its selectors
+				(REQ_SEL_EVAL) so that VMs which gained a label get a reservation, and those
+				that lost it have theirs cancelled.
+
+				The labels are kept only by the osif goroutine; VMs matching a selector are
+				requested with REQ_LABEL_VMS and the list of labels with REQ_LIST_LABELS.
+
+	CFG:		osif:label_select - true to enable (false)
+				osif:label_interval - seconds between reads of the VM metadata (60; min 15)
+				osif:label_interface - catalogue interface used (public)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+*/
+
+package managers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+)
+
+const (
+	LABEL_PAGE	int = 500						// servers requested from nova at once
+)
+
+type label_reader struct {
+	*os_session
+	kick		chan bool
+	vms			map[string]map[string]string	// project-id/vm to metadata; used only by the osif goroutine
+}
+
+/*
+	Create the reader from the osif config and start its goroutine. Nil is returned if label
+	selection isn't enabled.
+*/
+func mk_label_reader( ) ( *label_reader ) {
+	sect := cfg_data["osif"]
+	if sect == nil || sect["label_select"] == nil || *sect["label_select"] != "true" {
+		return nil
+	}
+
+	oss := mk_os_session( sect, "label_interface" )
+	if oss == nil {
+		osif_sheep.Baa( 0, "WRN: label selection enabled but osif url or usr is missing; selectors will match nothing  [TGUOSI019]" )
+		return nil
+	}
+
+	lr := &label_reader{
+		os_session:	oss,
+		kick:		make( chan bool, 1 ),
+		vms:		make( map[string]map[string]string ),
+	}
+
+	ivl := int64( 60 )
+	if p := sect["label_interval"]; p != nil {
+		if ivl = clike.Atoi64( *p ); ivl < 15 {
+			ivl = 15
+		}
+	}
+
+	go lr.run( )
+	lr.read( )																// first read now rather than after the first interval
+	add_spot( tklr, osif_sheep, "TGUOSI023", "vm label read", ivl, osif_ch, REQ_LABEL_READ, ipc.FOREVER )
+	osif_sheep.Baa( 1, "VM labels will be read from instance metadata every %ds", ivl )
+	return lr
+}
+
+/*
+	Start a read of the labels; dropped if the reader is busy.
+*/
+func (lr *label_reader) read( ) {
+	select {
+		case lr.kick <- true:
+
+		default:
+			osif_sheep.Baa( 2, "label read skipped: reader still busy with the last read" )
+	}
+}
+
+/*
+	Reader goroutine.
+*/
+func (lr *label_reader) run( ) {
+	for range lr.kick {
+		if err := lr.auth( "compute" ); err != nil {
+			osif_sheep.Baa( 0, "WRN: label read: unable to authorise with keystone: %s  [TGUOSI020]", err )
+			continue
+		}
+
+		vms, err := lr.list( )
+		if err != nil {
+			osif_sheep.Baa( 0, "WRN: label read: unable to list servers: %s  [TGUOSI021]", err )
+			continue
+		}
+
+		msg := ipc.Mk_chmsg( )
+		msg.Send_req( osif_ch, nil, REQ_LABEL_MAP, vms, nil )
+	}
+}
+
+/*
+	List the servers of all projects, a page at a time, and return the metadata of those
+	that have any keyed by project-id/vm.
+*/
+func (lr *label_reader) list( ) ( vms map[string]map[string]string, err error ) {
+	var sl struct {
+		Servers	[]struct {
+			Id			string				`json:"id"`
+			Name		string				`json:"name"`
+			Tenant_id	string				`json:"tenant_id"`
+			Metadata	map[string]string	`json:"metadata"`
+		}	`json:"servers"`
+	}
+
+	vms = make( map[string]map[string]string )
+	marker := ""
+	for {
+		surl := fmt.Sprintf( "%s/servers/detail?all_tenants=1&limit=%d", lr.eps["compute"], LABEL_PAGE )
+		if marker != "" {
+			surl += "&marker=" + url.QueryEscape( marker )
+		}
+		sl.Servers = nil
+		if err = lr.call( "GET", surl, nil, &sl ); err != nil {
+			return nil, err
+		}
+
+		for _, s := range sl.Servers {
+			if len( s.Metadata ) > 0 {
+				vms[s.Tenant_id + "/" + s.Name] = s.Metadata
+			}
+			marker = s.Id
+		}
+		if len( sl.Servers ) < LABEL_PAGE {
+			return vms, nil
+		}
+	}
+}
+
+/*
+	Return the sorted list of VMs (project-id/vm) in the project that have the label key
+	set to value.
+*/
+func (lr *label_reader) select_vms( project string, key string, value string ) ( vms []string ) {
+	vms = make( []string, 0 )
+	for vm, lm := range lr.vms {
+		if strings.HasPrefix( vm, project + "/" ) && lm[key] == value {
+			vms = append( vms, vm )
+		}
+	}
+
+	sort.Strings( vms )
+	return
+}
+
+/*
+	Generate the labels of the VMs in the project as json.
+*/
+func (lr *label_reader) to_json( project string ) ( string ) {
+	vms := make( []string, 0 )
+	for vm := range lr.vms {
+		if strings.HasPrefix( vm, project + "/" ) {
+			vms = append( vms, vm )
+		}
+	}
+	sort.Strings( vms )
+
+	jstr := `{ "labels": [ `
+	sep := ""
+	for _, vm := range vms {
+		keys := make( []string, 0, len( lr.vms[vm] ) )
+		for k := range lr.vms[vm] {
+			keys = append( keys, k )
+		}
+		sort.Strings( keys )
+
+		jstr += fmt.Sprintf( `%s{ "vm": %q, "labels": { `, sep, vm )
+		lsep := ""
+		for _, k := range keys {
+			jstr += fmt.Sprintf( `%s%q: %q`, lsep, k, lr.vms[vm][k] )
+			lsep = ", "
+		}
+		jstr += " } }"
+		sep = ", "
+	}
+
+	return jstr + " ] }"
+}
+
+/*
+	Handle a label request on the osif goroutine. Lr may be nil if labels aren't enabled.
+*/
+func (lr *label_reader) req( msg *ipc.Chmsg ) {
+	switch msg.Msg_type {
+		case REQ_LABEL_READ:
+			msg.Response_ch = nil
+			if lr != nil {
+				lr.read( )
+			}
+
+		case REQ_LABEL_MAP:							// new labels from the reader
+			msg.Response_ch = nil
+			lr.vms = msg.Req_data.( map[string]map[string]string )
+			osif_sheep.Baa( 2, "labels read for %d VMs", len( lr.vms ) )
+
+			emsg := ipc.Mk_chmsg( )
+			emsg.Send_req( rmgr_ch, nil, REQ_SEL_EVAL, nil, nil )		// bring selector members in line with the labels
+
+		case REQ_LABEL_VMS:							// data is project-id, key and value
+			if lr == nil {
+				msg.State = mk_err( ERR_BAD_REQUEST, "label selectors are not enabled" )
+				return
+			}
+			data := msg.Req_data.( []string )
+			msg.Response_data = lr.select_vms( data[0], data[1], data[2] )
+
+		case REQ_LIST_LABELS:						// data is the project-id
+			if lr == nil {
+				msg.State = mk_err( ERR_BAD_REQUEST, "label selectors are not enabled" )
+				return
+			}
+			msg.Response_data = lr.to_json( *(msg.Req_data.( *string )) )
+	}
+}
@@ -38,6 +38,8 @@
 				01 Apr 2015 - Added ipv6 support for finding gateway/routers.
 				16 Jun 2015 - Turned down some of the bleat messages.
 				12 Apr 2016 - Changed bleat message to make it more useful.
+				16 Oct 2026 - Fixed fip2ip map being saved as ip2fip. Floating ip moves are sent to
+					network (network_fip.go).
 */
 
 package managers
@@ -201,8 +203,13 @@ func (p *osif_project) refresh_maps( creds *ostack.Ostack ) ( rerr error ) {
 		} else {
 			osif_sheep.Baa( 2, "%s map sizes: ip2fip=%d fip2ip=%d", *p.name, len( ip2fip ), len( fip2ip ) )
 			if len( ip2fip ) > 0 &&  len( fip2ip ) > 0 {
+				if moves := fip_diff( p.fip2ip, fip2ip ); len( moves ) > 0 {		// re-associated floating ips break reservations using them
+					osif_sheep.Baa( 1, "%s: %d floating ip(s) moved or released", *p.name, len( moves ) )
+					msg := ipc.Mk_chmsg( )
+					msg.Send_req( nw_ch, nil, REQ_FIP_MOVED, moves, nil )
+				}
 				p.ip2fip = ip2fip
-				p.ip2fip = fip2ip
+				p.fip2ip = fip2ip
 			}
 		}
 
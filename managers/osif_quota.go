@@ -0,0 +1,299 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	osif_quota
+	Abstract:	Reflects the bandwidth each project has reserved into openstack so that quota
+				tooling and dashboards can show network guarantees alongside compute quotas.
+				Periodically res-mgr sends osif the bandwidth (both directions) of the active
+				bandwidth and oneway reservations summed by project (REQ_QUOTA_SYNC), and the
+				writer goroutine puts it, in Mbps, into one of:
+
+					limits	- a keystone unified limit (project limit) with the resource name
+							  given, under the service whose type is given. The registered limit
+							  for the resource must have been created by the operator; the project
+							  limit is created when first needed and changed only when the value
+							  changes (rounded up to a whole Mbps).
+
+					gnocchi	- a measure of the named metric on a generic resource whose id is
+							  the project ID (both are created if they don't exist). A measure is
+							  written each interval so that the metric is a time series.
+
+				A project whose reservations have all gone is written as 0 once. If the
+				writer is still busy with the last list when the next arrives, the new one
+				is dropped. The osif admin credentials are used (osif_keystone.go).
+
+	CFG:		osif:quota_sync - limits or gnocchi to enable (off)
+				osif:quota_interval - seconds between syncs (300; min 60)
+				osif:quota_resource - limit resource or metric name (tegu_reserved_mbps)
+				osif:quota_service - service type the limits are registered under (network)
+				osif:quota_archive - gnocchi archive policy for the metric (low)
+				osif:quota_interface - catalogue interface used (public)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type quota_writer struct {
+	*os_session
+	target		string							// limits or gnocchi
+	resource	string
+	service		string
+	archive		string
+	ch			chan map[string]int64			// project id to bits/sec reserved
+	last		map[string]int64				// project id to the Mbps last written
+	limit_ids	map[string]string				// project id to keystone limit id
+	known		map[string]bool					// projects with a gnocchi resource and metric
+}
+
+/*
+	Create the writer from the osif config and start its goroutine. Nil is returned if
+	quota sync isn't enabled.
+*/
+func mk_quota_writer( ) ( *quota_writer ) {
+	sect := cfg_data["osif"]
+	if sect == nil || sect["quota_sync"] == nil || *sect["quota_sync"] == "off" || *sect["quota_sync"] == "" {
+		return nil
+	}
+
+	target := *sect["quota_sync"]
+	if target != "limits" && target != "gnocchi" {
+		osif_sheep.Baa( 0, "WRN: quota sync target must be limits or gnocchi, not %s; quotas will not be written  [TGUOSI016]", target )
+		return nil
+	}
+
+	oss := mk_os_session( sect, "quota_interface" )
+	if oss == nil {
+		osif_sheep.Baa( 0, "WRN: quota sync enabled but osif url or usr is missing; quotas will not be written  [TGUOSI016]" )
+		return nil
+	}
+
+	qw := &quota_writer{
+		os_session:	oss,
+		target:		target,
+		resource:	"tegu_reserved_mbps",
+		service:	"network",
+		archive:	"low",
+		ch:			make( chan map[string]int64, 1 ),
+		last:		make( map[string]int64 ),
+		limit_ids:	make( map[string]string ),
+		known:		make( map[string]bool ),
+	}
+	for k, v := range map[string]*string{ "quota_resource": &qw.resource, "quota_service": &qw.service, "quota_archive": &qw.archive } {
+		if p := sect[k]; p != nil && *p != "" {
+			*v = *p
+		}
+	}
+
+	ivl := int64( 300 )
+	if p := sect["quota_interval"]; p != nil {
+		if ivl = clike.Atoi64( *p ); ivl < 60 {
+			ivl = 60
+		}
+	}
+
+	go qw.run( )
+	add_spot( tklr, osif_sheep, "TGUOSI023", "quota sync", ivl, rmgr_ch, REQ_QUOTA_SYNC, ipc.FOREVER )		// res-mgr sends us the bandwidth by project
+	osif_sheep.Baa( 1, "reserved bandwidth will be written to openstack %s as %s every %ds", qw.target, qw.resource, ivl )
+	return qw
+}
+
+/*
+	Pass the bandwidth by project to the writer; dropped if it is busy.
+*/
+func (qw *quota_writer) sync( pbw map[string]int64 ) {
+	select {
+		case qw.ch <- pbw:
+
+		default:
+			osif_sheep.Baa( 1, "quota sync skipped: writer still busy with the last sync" )
+	}
+}
+
+/*
+	Writer goroutine.
+*/
+func (qw *quota_writer) run( ) {
+	need := []string{ "metric" }
+	if qw.target == "limits" {
+		need = nil												// keystone itself; its url is in the config
+	}
+
+	for pbw := range qw.ch {
+		if err := qw.auth( need... ); err != nil {
+			osif_sheep.Baa( 0, "WRN: quota sync: unable to authorise with keystone: %s  [TGUOSI017]", err )
+			continue
+		}
+
+		mbw := make( map[string]int64, len( pbw ) + len( qw.last ) )
+		for pid, bw := range pbw {
+			mbw[pid] = (bw + 999999) / 1000000
+		}
+		for pid := range qw.last {									// those with nothing reserved now are written as 0
+			if _, ok := mbw[pid]; ! ok {
+				mbw[pid] = 0
+			}
+		}
+
+		nproj := 0
+		nerr := 0
+		for pid, v := range mbw {
+			if lv, ok := qw.last[pid]; ok && lv == v && qw.target == "limits" {
+				continue
+			}
+
+			nproj++
+			var err error
+			if qw.target == "limits" {
+				err = qw.set_limit( pid, v )
+			} else {
+				err = qw.add_measure( pid, v )
+			}
+			if err != nil {
+				nerr++
+				osif_sheep.Baa( 1, "quota sync: %s: %s", pid, err )
+				continue
+			}
+
+			if v == 0 {
+				delete( qw.last, pid )
+			} else {
+				qw.last[pid] = v
+			}
+		}
+
+		if nerr > 0 {
+			osif_sheep.Baa( 0, "WRN: quota sync: %d of %d projects could not be written  [TGUOSI018]", nerr, nproj )
+		} else {
+			osif_sheep.Baa( 2, "quota sync: %d projects written", nproj )
+		}
+	}
+}
+
+/*
+	Create or change the project's unified limit.
+*/
+func (qw *quota_writer) set_limit( pid string, mbps int64 ) ( error ) {
+	lurl := qw.base() + "/v3/limits"
+	if qw.limit_ids[pid] == "" {
+		var ll struct {
+			Limits	[]struct {
+				Id		string	`json:"id"`
+			}	`json:"limits"`
+		}
+		q := url.Values{}
+		q.Set( "project_id", pid )
+		q.Set( "resource_name", qw.resource )
+		q.Set( "service_id", qw.svc_ids[qw.service] )
+		if err := qw.call( "GET", lurl + "?" + q.Encode(), nil, &ll ); err != nil {
+			return err
+		}
+		if len( ll.Limits ) > 0 {
+			qw.limit_ids[pid] = ll.Limits[0].Id
+		}
+	}
+
+	if id := qw.limit_ids[pid]; id != "" {
+		return qw.call( "PATCH", lurl + "/" + id, map[string]interface{}{ "limit": map[string]int64{ "resource_limit": mbps } }, nil )
+	}
+
+	svc := qw.svc_ids[qw.service]
+	if svc == "" {
+		return fmt.Errorf( "service type %s is not in the catalogue", qw.service )
+	}
+	lim := map[string]interface{}{ "service_id": svc, "project_id": pid, "resource_name": qw.resource, "resource_limit": mbps }
+	if qw.region != "" {
+		lim["region_id"] = qw.region
+	}
+
+	var cl struct {
+		Limits	[]struct {
+			Id		string	`json:"id"`
+		}	`json:"limits"`
+	}
+	if err := qw.call( "POST", lurl, map[string]interface{}{ "limits": []interface{}{ lim } }, &cl ); err != nil {
+		return err
+	}
+	if len( cl.Limits ) > 0 {
+		qw.limit_ids[pid] = cl.Limits[0].Id
+	}
+
+	return nil
+}
+
+/*
+	Add a measure to the project's metric, creating the resource and metric the first time.
+	Either may exist already, so errors creating them are ignored; the measure will fail if
+	something is really wrong.
+*/
+func (qw *quota_writer) add_measure( pid string, mbps int64 ) ( error ) {
+	rurl := qw.eps["metric"] + "/v1/resource/generic"
+	if ! qw.known[pid] {
+		metric := map[string]interface{}{ qw.resource: map[string]string{ "archive_policy_name": qw.archive } }
+		qw.call( "POST", rurl, map[string]interface{}{ "id": pid, "project_id": pid, "metrics": metric }, nil )
+		qw.call( "POST", rurl + "/" + pid + "/metric", metric, nil )
+		qw.known[pid] = true
+	}
+
+	m := []map[string]interface{}{ { "timestamp": time.Now().UTC().Format( time.RFC3339 ), "value": mbps } }
+	if err := qw.call( "POST", rurl + "/" + pid + "/metric/" + qw.resource + "/measures", m, nil ); err != nil {
+		delete( qw.known, pid )										// try to create them again next time
+		return err
+	}
+
+	return nil
+}
+
+/*
+	Build the bandwidth reserved by each project for the quota sync: bandwidth and oneway
+	reservations which are active now. Run by res-mgr.
+*/
+func (inv *Inventory) project_bandw( ) ( map[string]int64 ) {
+	pbw := make( map[string]int64 )
+	for _, p := range inv.cache {
+		if p == nil || ! (*p).Is_active() {
+			continue
+		}
+
+		switch (*p).(type) {
+			case *gizmos.Pledge_bw, *gizmos.Pledge_bwow:
+				if pid := pledge_tenant( p ); pid != "" {
+					pbw[pid] += pledge_bandw( p )
+				}
+		}
+	}
+
+	return pbw
+}
@@ -0,0 +1,292 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	osif_tags
+	Abstract:	Export of reservation state to openstack resource tags. When enabled, the
+				instance (nova) and each of its ports (neutron) of a VM which is an endpoint of
+				a bandwidth or oneway reservation are tagged with the reservation and its phase
+				(res_mgr_watch.go):
+
+					tegu:res1f2a_00012:ACTIVE
+
+				Periodically res-mgr sends the reservation state of each endpoint to osif
+				(REQ_TAG_EXPORT) which translates the endpoints to VM IDs and hands the list to
+				the writer goroutine. The writer changes only the tags with the prefix so that
+				other tags on the instance or port are left alone, and only touches a VM when
+				its set of tags differs from what was last written; tags are removed from a VM
+				when none of its reservations remain. If the writer is still busy with the last
+				list when the next arrives, the new one is dropped.
+
+				The writer authenticates with keystone (v3) using the osif admin credentials and
+				finds the compute and network endpoints in the catalogue (osif_keystone.go).
+
+	CFG:		osif:tag_export - true to enable (false)
+				osif:tag_interval - seconds between exports (120; min 30)
+				osif:tag_prefix - prefix on the tags (tegu)
+				osif:tag_interface - catalogue interface used (public)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Keystone session moved to osif_keystone.go (shared with quota sync).
+*/
+
+package managers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	MAX_OS_TAG	int = 60							// nova and neutron limit
+)
+
+type tag_writer struct {
+	*os_session
+	prefix		string
+	ch			chan map[string][]string		// vm id to tags
+	last		map[string]string				// vm id to the tags last written (joined)
+}
+
+/*
+	Create the writer from the osif config and start its goroutine. Nil is returned if tag
+	export isn't enabled.
+*/
+func mk_tag_writer( ) ( *tag_writer ) {
+	sect := cfg_data["osif"]
+	if sect == nil || sect["tag_export"] == nil || *sect["tag_export"] != "true" {
+		return nil
+	}
+
+	oss := mk_os_session( sect, "tag_interface" )
+	if oss == nil {
+		osif_sheep.Baa( 0, "WRN: tag export enabled but osif url or usr is missing; tags will not be written  [TGUOSI013]" )
+		return nil
+	}
+	oss.hdrs["X-OpenStack-Nova-API-Version"] = "2.26"				// server tags
+
+	tw := &tag_writer{
+		os_session:	oss,
+		prefix:		"tegu",
+		ch:			make( chan map[string][]string, 1 ),
+		last:		make( map[string]string ),
+	}
+	if p := sect["tag_prefix"]; p != nil {
+		tw.prefix = *p
+	}
+
+	ivl := int64( 120 )
+	if p := sect["tag_interval"]; p != nil {
+		if ivl = clike.Atoi64( *p ); ivl < 30 {
+			ivl = 30
+		}
+	}
+
+	go tw.run( )
+	add_spot( tklr, osif_sheep, "TGUOSI023", "tag export", ivl, rmgr_ch, REQ_TAG_EXPORT, ipc.FOREVER )		// res-mgr sends us the state of each endpoint
+	osif_sheep.Baa( 1, "reservation state will be exported to openstack tags every %ds with prefix %s", ivl, tw.prefix )
+	return tw
+}
+
+/*
+	Pass the tags for each VM to the writer; dropped if it is busy.
+*/
+func (tw *tag_writer) export( vmtags map[string][]string ) {
+	select {
+		case tw.ch <- vmtags:
+
+		default:
+			osif_sheep.Baa( 1, "tag export skipped: writer still busy with the last export" )
+	}
+}
+
+/*
+	Translate the endpoint state sent by res-mgr (project-id/host to id:phase strings) to
+	tags for each VM ID. Endpoints that aren't VMs (external addresses) or can't be found
+	in the project maps are skipped.
+*/
+func (tw *tag_writer) xlate( hstate map[string][]string, projects map[string]*osif_project ) ( vmtags map[string][]string ) {
+	vmtags = make( map[string][]string, len( hstate ) )
+	for h, states := range hstate {
+		toks := strings.SplitN( h, "/", 2 )
+		if len( toks ) < 2 || projects[toks[0]] == nil {
+			continue
+		}
+
+		_, id, _, _, _, _, _, _ := projects[toks[0]].suss_info( &toks[1] )
+		if id == nil {
+			osif_sheep.Baa( 2, "tag export: no vm id for %s", h )
+			continue
+		}
+
+		for _, s := range states {
+			if t := tw.prefix + ":" + s; len( t ) <= MAX_OS_TAG {
+				vmtags[*id] = append( vmtags[*id], t )
+			}
+		}
+	}
+
+	return
+}
+
+/*
+	Writer goroutine.
+*/
+func (tw *tag_writer) run( ) {
+	for vmtags := range tw.ch {
+		if err := tw.auth( "compute", "network" ); err != nil {
+			osif_sheep.Baa( 0, "WRN: tag export: unable to authorise with keystone: %s  [TGUOSI014]", err )
+			continue
+		}
+
+		for id := range tw.last {									// those which no longer have reservations are cleared
+			if vmtags[id] == nil {
+				vmtags[id] = []string{ }
+			}
+		}
+
+		nvm := 0
+		nerr := 0
+		for id, tags := range vmtags {
+			sort.Strings( tags )
+			jt := strings.Join( tags, "," )
+			if lt, ok := tw.last[id]; ok && lt == jt {
+				continue
+			}
+
+			nvm++
+			if err := tw.set_vm( id, tags ); err != nil {
+				nerr++
+				osif_sheep.Baa( 1, "tag export: %s: %s", id, err )
+				continue
+			}
+			if len( tags ) == 0 {
+				delete( tw.last, id )
+			} else {
+				tw.last[id] = jt
+			}
+		}
+
+		if nerr > 0 {
+			osif_sheep.Baa( 0, "WRN: tag export: %d of %d VMs could not be tagged  [TGUOSI015]", nerr, nvm )
+		} else {
+			osif_sheep.Baa( 2, "tag export: %d VMs updated", nvm )
+		}
+	}
+}
+
+/*
+	Replace the tags with our prefix, on the instance and its ports, with those given.
+*/
+func (tw *tag_writer) set_vm( id string, tags []string ) ( error ) {
+	var sv struct {
+		Tags	[]string	`json:"tags"`
+	}
+	surl := tw.eps["compute"] + "/servers/" + id + "/tags"
+	if err := tw.call( "GET", surl, nil, &sv ); err != nil {
+		return err
+	}
+	if nt, changed := tw.merge( sv.Tags, tags ); changed {
+		if err := tw.call( "PUT", surl, map[string][]string{ "tags": nt }, nil ); err != nil {
+			return err
+		}
+	}
+
+	var pl struct {
+		Ports	[]struct {
+			Id		string		`json:"id"`
+			Tags	[]string	`json:"tags"`
+		}	`json:"ports"`
+	}
+	if err := tw.call( "GET", tw.eps["network"] + "/v2.0/ports?device_id=" + id, nil, &pl ); err != nil {
+		return err
+	}
+	for _, port := range pl.Ports {
+		if nt, changed := tw.merge( port.Tags, tags ); changed {
+			if err := tw.call( "PUT", tw.eps["network"] + "/v2.0/ports/" + port.Id + "/tags", map[string][]string{ "tags": nt }, nil ); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+	Replace the tags with our prefix in cur with ours. Returns the new list and true if it
+	differs from cur.
+*/
+func (tw *tag_writer) merge( cur []string, ours []string ) ( []string, bool ) {
+	nt := make( []string, 0, len( cur ) + len( ours ) )
+	had := make( []string, 0, len( cur ) )
+	for _, t := range cur {
+		if strings.HasPrefix( t, tw.prefix + ":" ) {
+			had = append( had, t )
+		} else {
+			nt = append( nt, t )
+		}
+	}
+	nt = append( nt, ours... )
+
+	sort.Strings( had )
+	return nt, strings.Join( had, "," ) != strings.Join( ours, "," )
+}
+
+/*
+	Build the state of each reservation endpoint for the tag export: the endpoint (project-id/host)
+	maps to a list of id:phase strings. Run by res-mgr; only bandwidth and oneway reservations
+	which haven't expired are included.
+*/
+func (inv *Inventory) tag_states( ) ( map[string][]string ) {
+	hstate := make( map[string][]string )
+	for id, p := range inv.cache {
+		if p == nil || (*p).Is_expired() {
+			continue
+		}
+
+		var h1, h2 *string
+		switch sp := (*p).(type) {
+			case *gizmos.Pledge_bw:
+				h1, h2 = sp.Get_hosts()
+
+			case *gizmos.Pledge_bwow:
+				h1, h2 = sp.Get_hosts()
+
+			default:
+				continue
+		}
+
+		s := id + ":" + inv.res_phase( id )
+		for _, h := range []*string{ h1, h2 } {
+			if h != nil && *h != "" {
+				hstate[*h] = append( hstate[*h], s )
+			}
+		}
+	}
+
+	return hstate
+}
@@ -46,6 +46,46 @@
 
 					resmgr:res_refresh - The rate (seconds) that reservations are refreshed if hto-limit is non-zero.
 
+					resmgr:acct_sink - Where accounting records are written (file:/path or http://url). See res_mgr_acct.
+
+					resmgr:approval_threshold, resmgr:approval_timeout - See res_mgr_approve.
+
+					resmgr:del_grace - See res_mgr_grace.
+
+					resmgr:expiry_warn, resmgr:expiry_summary_hour - See res_mgr_expiry.
+
+					resmgr:recovery_workers - See rm_recovery_async.
+
+					resmgr:chkpt_quarantine - See rm_recovery.
+
+					resmgr:activate_lead, resmgr:pause_expiry, resmgr:delete_expiry - See res_mgr_lead.
+
+					resmgr:pause_mode, resmgr:pause_rate - See res_mgr_pause.
+
+					resmgr:cap_check, resmgr:cap_drop - See res_mgr_capcheck.
+
+					resmgr:cons_check, resmgr:cons_repair - See res_mgr_consist.
+
+					resmgr:xtenant_consent, resmgr:peering, resmgr:consent_timeout - See res_mgr_consent.
+
+					resmgr:max_active, resmgr:max_active_tenant - See res_mgr_limits.
+
+					resmgr:project_tiers - See res_mgr_tiers.
+
+					resmgr:blackouts, resmgr:blackout_policy - See res_mgr_blackout.
+
+					resmgr:reopt, resmgr:reopt_gain - See res_mgr_reopt.
+
+					resmgr:late_min - See res_mgr_late.
+
+					resmgr:chain_templates - See res_mgr_ctmpl.
+
+					resmgr:bulk_margin - See res_mgr_bulk.
+
+					resmgr:ip_cache - See res_mgr_ipcache.
+
+					mirror:max_per_host, mirror:max_host_bw - See res_mgr_mirror.
+
 
 	TODO:		need a way to detect when skoogie/controller has been reset meaning that all
 				pushed reservations need to be pushed again.
@@ -111,6 +151,75 @@
 						later attempt will be successful.
 				12 Apr 2016 : Added support to detect when a duplicate reservaiton should be allowed, and the previous
 						one cancelled, due to a host move.	
+				16 Oct 2026 : Added handover (make-before-break) support for bandwidth reservations.
+				16 Oct 2026 : Generate accounting records on delete and expiry.
+				16 Oct 2026 : Publish reservation events.
+				16 Oct 2026 : Added two phase admission (approval) for large reservations.
+				16 Oct 2026 : Listing only gives full details for pledges that the cookie is valid for.
+				16 Oct 2026 : Cookies are masked in log messages.
+				16 Oct 2026 : Reservations on a host are pushed again when its agent reconnects.
+				16 Oct 2026 : Added impact report for host/switch maintenance.
+				16 Oct 2026 : Added snapshot request; inventory is loaded from the snapshot in replay mode.
+				16 Oct 2026 : Cross-tenant reservations wait for consent when configured.
+				16 Oct 2026 : Added global and per-tenant limits on active reservations.
+				16 Oct 2026 : New reservations are checked against switch flow table budgets.
+				16 Oct 2026 : Flow-mod status tracking, audit and interim usage records (res_mgr_fmstat.go).
+				16 Oct 2026 : Reservations are pushed via the pledge type registry (res_mgr_kinds.go).
+				16 Oct 2026 : Multicast reservations (res_mgr_mcast.go).
+				16 Oct 2026 : New mirrors are checked for loops and per host limits.
+				16 Oct 2026 : Lookup and admission errors are typed (tegu_err.go).
+				16 Oct 2026 : Requests to network manager time out rather than blocking forever (ipc_ctx.go).
+				16 Oct 2026 : Added scoped delete all (res_mgr_scope.go).
+				16 Oct 2026 : User deletes can have a grace period (res_mgr_grace.go).
+				16 Oct 2026 : Added expiration warnings and daily summary (res_mgr_expiry.go).
+				16 Oct 2026 : Added recovery report request (rm_recovery_report.go).
+				16 Oct 2026 : Checkpointed reservations are admitted in the background (rm_recovery_async.go).
+				16 Oct 2026 : Checkpoint records are formatted and written by a separate goroutine.
+				16 Oct 2026 : Added inventory stats request (res_mgr_stats.go).
+				16 Oct 2026 : Periodic over-capacity check (res_mgr_capcheck.go).
+				16 Oct 2026 : Inventory, graph and agent consistency check (res_mgr_consist.go).
+				16 Oct 2026 : Configurable activation lead and expiry stubs (res_mgr_lead.go).
+				16 Oct 2026 : Queue pause mode (res_mgr_pause.go).
+				16 Oct 2026 : Secondary indexes and search request (res_mgr_index.go).
+				16 Oct 2026 : Maintenance windows which hold pushes (res_mgr_maint.go).
+				16 Oct 2026 : Readmit reservations using a floating ip that moved (res_mgr_fip.go).
+				16 Oct 2026 : Nat match probe results kept with flow-mod status (res_mgr_fmstat.go).
+				16 Oct 2026 : Dscp trust reservations expire on delete as passthru does (res_mgr_trust.go).
+				16 Oct 2026 : Reservations on links whose capacity dropped are readmitted (res_mgr_capcheck.go).
+				16 Oct 2026 : Added cap_drop config option (repath or flag).
+				16 Oct 2026 : Reservation dependencies: held until what they depend on is pushed, deleted with it (res_mgr_deps.go).
+				16 Oct 2026 : Steering reservations expire on delete. Added service chain requests (res_mgr_chain.go).
+				16 Oct 2026 : Added set_meta (user metadata on a reservation).
+				16 Oct 2026 : Added res_label (user supplied name for events).
+				16 Oct 2026 : Added add_batch (batch requests, http_batch.go).
+				16 Oct 2026 : Added reservation status watches (res_mgr_watch.go).
+				16 Oct 2026 : Send reservation state for openstack tag export (osif_tags.go).
+				16 Oct 2026 : Host quarantines (res_mgr_quarantine.go).
+				16 Oct 2026 : Project tiers (res_mgr_tiers.go).
+				16 Oct 2026 : Bulk transfer progress (res_mgr_bulk.go).
+				16 Oct 2026 : Compaction of the inventory (compact.go).
+				16 Oct 2026 : Send reserved bandwidth by project for the openstack quota sync (osif_quota.go).
+				16 Oct 2026 : Address lookups and queue maps go through the network provider (network_provider.go).
+				16 Oct 2026 : Hosts translated in one request before a push and kept briefly (res_mgr_ipcache.go).
+				16 Oct 2026 : Verification results kept with the flow-mod status (fq_verify.go).
+				16 Oct 2026 : SLA breach detection and history (res_mgr_sla.go).
+				16 Oct 2026 : Checkpoints are written through the Checkpointer interface (seams.go).
+				16 Oct 2026 : Request origin given to admins (listres with the super cookie) and in added/deleted events.
+				16 Oct 2026 : New reservations which overlap a blackout period are refused (res_mgr_blackout.go).
+				16 Oct 2026 : Active reservations which opt in are moved to better paths (res_mgr_reopt.go).
+				16 Oct 2026 : Reservations whose window started while tegu was down are explained, or deleted
+							when too little of the window remains (res_mgr_late.go).
+				16 Oct 2026 : Timeline (gantt) data for reservations (res_mgr_timeline.go).
+				16 Oct 2026 : Owner groups; further cookies which may manage a reservation (gizmos/pledge_owners.go).
+				16 Oct 2026 : Service chain templates (res_mgr_ctmpl.go).
+				16 Oct 2026 : Checkpoint records are formatted on the res_mgr goroutine; only the write is done
+								by the writer goroutine.
+				16 Oct 2026 : New reservations are refused, and those not yet recovered report busy, while
+								recovery is running.
+				16 Oct 2026 : Label selectors are kept, checkpointed and evaluated by res-mgr (res_mgr_label.go).
+				16 Oct 2026 : Requests, adds, deletes and pushes are logged with the correlation id.
+				16 Oct 2026 : Periodic checks report when they can not be scheduled.
+				16 Oct 2026 : Index address lookups are made off of the res_mgr goroutine (REQ_HOST_ADDRS).
 */
 
 package managers
@@ -140,15 +249,44 @@ type Inventory struct {
 	cache		map[string]*gizmos.Pledge		// cache of pledges
 	retry		map[string]*gizmos.Pledge		// pledges loaded from datacache that have not vetted
 	ulcap_cache	map[string]int					// cache of user link capacity values (max value)
-	chkpt		*chkpt.Chkpt
+	accounted	map[string]bool					// pledges that have had an accounting record written
+	awaiting	map[string]int64				// pledges awaiting approval and the time they started to wait
+	consent_wait map[string]int64				// pledges awaiting cross-tenant consent and the time they started to wait
+	max_active	int								// max reservations active at once; 0 is no limit
+	max_tenant	int								// max reservations active at once for any one tenant; 0 is no limit
+	mirror_max	int								// max mirrors on a physical host at once; 0 is no limit
+	mirror_bw	int64							// max bandwidth mirrored on a physical host; 0 is no limit
+	fmstat		map[string]*res_fmstat			// flow-mod status of bandwidth reservations
+	doomed		map[string]int64				// reservations pending deletion and the time they are deleted
+	del_grace	int64							// seconds a user deleted reservation remains; 0 deletes now
+	warned		map[string]int64				// reservations warned about expiring and the expiry they were warned about
+	recovery	*recovery_report				// outcome of the last checkpoint load; nil if none
+	recovering	map[string]*gizmos.Pledge		// pledges from the checkpoint awaiting admission by the recovery workers
+	rcv_workers	int								// number of recovery workers; 0 admits during the load
+	ckpt_busy	chan bool						// holds a value while a checkpoint is being written
+	qmap_ids	map[string]bool					// queue (reservation) ids in the last queue map sent to fq-mgr
+	qmap_ts		int64							// time that the queue map was generated for
+	idx			*pledge_idx						// secondary indexes (res_mgr_index)
+	maint		map[string]*maint_window		// maintenance windows by name (res_mgr_maint)
+	quar		map[string]*quarantine			// host quarantines by name (res_mgr_quarantine)
+	tiers		map[string]*proj_tier			// project tiers by project name or ID (res_mgr_tiers)
+	ctmpls		map[string]*chain_tmpl			// service chain templates by name (res_mgr_ctmpl)
+	selectors	map[string]*label_sel			// label selectors by id (res_mgr_label)
+	sel_jobs	chan *sel_job					// selector evaluations for the worker (res_mgr_label)
+	watches		[]*res_watch					// held resstatus requests (res_mgr_watch)
+	sla			*sla_mon						// sla breach tracking and history (res_mgr_sla); nil if disabled
+	chkpt		Checkpointer					// checkpoint writer (seams.go)
 }
 
 // --- Private --------------------------------------------------------------------------
 
 /*
-	Encapsulate all of the current reservations into a single json blob.
+	Encapsulate all of the current reservations into a single json blob. Full information
+	is given only for pledges that the cookie is valid for (all pledges, with the origin of
+	the request that created them, if it is the super cookie); others are listed with id,
+	type and window only.
 */
-func ( i *Inventory ) res2json( ) (json string, err error) {
+func ( i *Inventory ) res2json( cookie *string ) (json string, err error) {
 	var (
 		sep 	string = ""
 	)
@@ -156,14 +294,25 @@ func ( i *Inventory ) res2json( ) (json string, err error) {
 	err = nil;
 	json = `{ "reservations": [ `
 
+	all := cookie != nil && super_cookie != nil && *cookie == *super_cookie
 	for _, p := range i.cache {
 		if ! (*p).Is_expired( ) {
-			json += fmt.Sprintf( "%s%s", sep, (*p).To_json( ) )
+			if all {
+				json += fmt.Sprintf( "%s%s", sep, (*p).Get_origin().Add_to_json( (*p).To_json( ) ) )		// admins also see where it came from
+			} else if (*p).Is_valid_cookie( cookie ) {
+				json += fmt.Sprintf( "%s%s", sep, (*p).To_json( ) )
+			} else {
+				json += fmt.Sprintf( "%s%s", sep, elided_json( p ) )
+			}
 			sep = ","
 		}
 	}
 
-	json += " ] }"
+	json += " ]"
+	if len( i.recovering ) > 0 {
+		json += `, "recovering": ` + i.recovering_json( )			// not yet admitted after restart
+	}
+	json += " }"
 
 	return
 }
@@ -180,13 +329,17 @@ func name2ip( name *string ) ( ip *string ) {
 		return
 	}
 
+	if ip = rm_ips.get( *name ); ip != nil {
+		return
+	}
+
 	ch := make( chan *ipc.Chmsg )
 	defer close( ch )									// close it on return
-	msg := ipc.Mk_chmsg( )
-	msg.Send_req( nw_ch, ch, REQ_GETIP, name, nil )
-	msg = <- ch
+	net_prov.Post( REQ_GETIP, name, ch )
+	msg := <- ch
 	if msg.State == nil {					// success
 		ip = msg.Response_data.(*string)
+		rm_ips.put( *name, ip )
 	} else {
 		rm_sheep.Baa( 2, "name didn't translate to ip: %s", name )
 	}
@@ -329,8 +482,8 @@ func send_meta_fmods( qlist []string, alt_table int ) {
 
 
 /*
-	Runs the list of reservations in the cache and pushes out any that are about to become active (in the
-	next 15 seconds).  Also handles undoing any mirror reservations that have expired.
+	Runs the list of reservations in the cache and pushes out any that are about to become active (within
+	the activation lead time; see res_mgr_lead.go).  Also handles undoing any mirror reservations that have expired.
 
 	Favour_v6 is passed to push_bw and will favour the IPv6 address if a host has both addresses defined.
 
@@ -338,17 +491,33 @@ func send_meta_fmods( qlist []string, alt_table int ) {
 */
 func (i *Inventory) push_reservations( ch chan *ipc.Chmsg, alt_table int, hto_limit int64, pref_v6 bool ) ( npushed int ) {
 	var (
-		bw_push_count	int = 0
-		st_push_count	int = 0
 		pend_count	int = 0
 		pushed_count int = 0
+		held_count	int = 0
+		dep_count	int = 0
+		late_count	int = 0
 	)
 
+	pctx := &push_ctx{ inv: i, ch: ch, alt_table: alt_table, hto_limit: hto_limit, pref_v6: pref_v6 }
+
 	rm_sheep.Baa( 4, "pushing reservations, %d in cache", len( i.cache ) )
+	if rm_ips != nil {											// translate the hosts of all that will be pushed in one go (res_mgr_ipcache)
+		names := make( map[string]bool )
+		for _, p := range i.cache {
+			if p != nil && ! (*p).Is_expired() && ! (*p).Is_awaiting_approval() && ! (*p).Is_pushed() && ((*p).Is_active() || (*p).Is_active_soon( activate_lead( *p ) )) {
+				push_names( names, *p )
+			}
+		}
+		rm_ips.prefetch( names )
+	}
+
 	for rname, p := range i.cache {							// run all pledges that are in the cache
 		if p != nil {
 			if (*p).Is_expired() {								// some reservations need to be explicitly undone at expiry
 				if (*p).Is_pushed() {							// no need if not pushed
+					i.account( rname, p, "expired" )
+					publish_event( "reservation.expired", (*p).To_json() )
+					i.cascade_deps( rname, "expired" )			// dependents go with it (res_mgr_deps)
 					switch (*p).(type) {
 						case *gizmos.Pledge_mirror: 				// mirror requests need to be undone when they become inactive
 							undo_mirror_reservation( p, rname, ch )
@@ -357,25 +526,31 @@ func (i *Inventory) push_reservations( ch chan *ipc.Chmsg, alt_table int, hto_li
 					(*p).Reset_pushed()
 				}
 			} else {
-				if ! (*p).Is_pushed() && ((*p).Is_active() || (*p).Is_active_soon( 15 )) {			// not pushed, and became active while we napped, or will activate in the next 15 seconds
-					switch (*p).(type) {
-						case *gizmos.Pledge_bwow:
-							bwow_push_res( p, &rname, ch, hto_limit, pref_v6 )
-							(*p).Set_pushed( )
+				if (*p).Is_awaiting_approval() {					// never pushed until approved
+					pend_count++
+					continue
+				}
 
-						case *gizmos.Pledge_bw:
-							bw_push_count++
-							bw_push_res( p, &rname, ch, hto_limit, alt_table, pref_v6 )
+				if ! (*p).Is_pushed() && ((*p).Is_active() || (*p).Is_active_soon( activate_lead( *p ) )) {	// not pushed, and became active while we napped, or will activate within the lead time
+					if i.dep_hold( rname, p ) {							// what it depends on must be pushed first (res_mgr_deps)
+						dep_count++
+						continue
+					}
 
-						case *gizmos.Pledge_steer:
-							st_push_count++
-							push_st_reservation( p, rname, ch, hto_limit )
+					if i.maint_hold( rname, p ) != nil {				// in a maintenance window; pushed when it closes (res_mgr_maint)
+						held_count++
+						continue
+					}
 
-						case *gizmos.Pledge_mirror:
-							push_mirror_reservation( p, rname, ch )
+					if i.late_hold( rname, p ) {						// too little left of a window that started while we were down (res_mgr_late)
+						late_count++
+						continue
+					}
 
-						case *gizmos.Pledge_pass:
-							pass_push_res( p, &rname, ch, hto_limit )
+					nm := rname
+					rm_sheep.Baa( 2, "pushing %s reservation: %s cid=%s", gizmos.Pledge_kind_name( *p ), rname, (*p).Get_cid() )
+					if ! gizmos.Push_pledge( p, &nm, pctx ) {			// push function registered for the kind (see res_mgr_kinds.go)
+						rm_sheep.Baa( 1, "no push function for %s reservation: %s", gizmos.Pledge_kind_name( *p ), rname )
 					}
 
 					pushed_count++
@@ -386,28 +561,66 @@ func (i *Inventory) push_reservations( ch chan *ipc.Chmsg, alt_table int, hto_li
 		}
 	}
 
-	if st_push_count > 0 || bw_push_count > 0 || rm_sheep.Would_baa( 3 ) {			// bleat if we pushed something, or if higher level is set in the sheep
-		rm_sheep.Baa( 1, "push_reservations: %d bandwidth, %d steering, %d pending, %d already pushed", bw_push_count, st_push_count, pend_count, pushed_count )
+	if pctx.nst > 0 || pctx.nbw > 0 || late_count > 0 || rm_sheep.Would_baa( 3 ) {			// bleat if we pushed something, or if higher level is set in the sheep
+		rm_sheep.Baa( 1, "push_reservations: %d bandwidth, %d steering, %d pending, %d already pushed, %d held for maintenance, %d held for dependency, %d started too late", pctx.nbw, pctx.nst, pend_count, pushed_count, held_count, dep_count, late_count )
 	}
 
 	return pushed_count
 }
 
+/*
+	Completes a handover (make-before-break) once the replacement pledge has been pushed.
+	The new flow-mods are installed with a different priority than the old ones, so it is
+	now safe to release the old pledge's capacity in the network and to shorten its expiry
+	which forces its flow-mods out without disturbing the new ones. If the replacement
+	wasn't pushed (bad IP address etc.), the old pledge is left alone and the handover
+	is attempted again on the next push.
+*/
+func (i *Inventory) handover( gp *gizmos.Pledge ) {
+	p, ok := (*gp).( *gizmos.Pledge_bw )
+	if !ok || p.Get_handover() == nil || ! p.Is_pushed() {
+		return
+	}
+
+	oid := p.Get_handover()
+	p.Clear_handover()
+
+	op := i.cache[*oid]
+	if op == nil || (*op).Is_expired() {
+		rm_sheep.Baa( 1, "handover: replaced reservation no longer active: %s", *oid )
+		return
+	}
+
+	req := nw_req( REQ_DEL, *op, nil )					// network must release before expiry is reset (see Del_res)
+	if req.State != nil {
+		rm_sheep.Baa( 1, "WRN: handover: network delete of replaced reservation failed: %s: %s  [TGURMG005]", *oid, req.State )
+	}
+
+	(*op).Set_expiry( delete_expiry( *op ) )			// force the old flow-mods out
+	(*op).Reset_pushed()
+	rm_sheep.Baa( 1, "handover: %s replaced by %s", *oid, *p.Get_id() )
+}
+
 /*
 	Turn pause mode on for all current reservations and reset their push flag so that they all get pushed again.
+	In queue pause mode the flow-mods stay and the push flag is left alone (see res_mgr_pause.go).
 */
 func (i *Inventory) pause_on( ) {
 	for _, p := range i.cache {
-		(*p).Pause( true )					// also reset the push flag
+		(*p).Pause( ! pause_queue )			// also reset the push flag
 	}
 }
 
 /*
 	Turn pause mode off for all current reservations and reset their push flag so that they all get pushed again.
+	In queue pause mode the flow-mods stay and the push flag is left alone. Reservations paused by a
+	quarantine stay paused.
 */
 func (i *Inventory) pause_off( ) {
-	for _, p := range i.cache {
-		(*p).Resume( true )					// also reset the push flag
+	for name, p := range i.cache {
+		if ! i.quar_holds( name ) {
+			(*p).Resume( ! pause_queue )		// also reset the push flag
+		}
 	}
 }
 
@@ -435,57 +648,123 @@ func (i *Inventory) reset_push() {
 	made in the same second, then all of them will be captured the next time a write is allowed and the
 	inventory is parsed.  If the checkpoint can be written, then false is returned.  In either case,
 	the time that the last checkpoint file was written is also returned.
+
+	Pledges may be changed only on the res_mgr goroutine, so a snapshot (copy) of each is taken here;
+	formatting the snapshot and writing the file are done by a separate goroutine so that neither holds
+	up requests. Only one write runs at a time; if one is still running, retry is returned.
 */
 func (i *Inventory) write_chkpt( last int64 ) ( retry bool, timestamp int64 ) {
 
+	if is_replay() {
+		return false, last			// replaying a snapshot; nothing is persisted
+	}
+
 	now := time.Now().Unix()
 	if now - last < 2 {
 		rm_sheep.Baa( 2, "retry checkpoint signaled" )
 		return true, last			// can only dump 1/min; show queued to force main loop to recall
 	}
 
-	err := i.chkpt.Create( )
-	if err != nil {
-		rm_sheep.Baa( 0, "CRI: resmgr: unable to create checkpoint file: %s  [TGURMG003]", err )
-		return false, last
+	select {
+		case i.ckpt_busy <- true:
+		default:
+			rm_sheep.Baa( 2, "checkpoint write still in progress; retry signaled" )
+			return true, last
 	}
 
-	for nm, v := range i.ulcap_cache {							// write out user link capacity limits that have been set
-		fmt.Fprintf( i.chkpt, "ucap: %s %d\n", nm, v ) 			// we'll check the overall error state on close
+	ulcaps := make( map[string]int, len( i.ulcap_cache ) )
+	for nm, v := range i.ulcap_cache {
+		ulcaps[nm] = v
 	}
 
+	plist := make( []*gizmos.Pledge, 0, len( i.cache ) + len( i.recovering ) + len( i.retry ) )
 	for key, p := range i.cache {
-		s := (*p).To_chkpt()
-		if s != "expired" {
-			fmt.Fprintf( i.chkpt, "%s\n", s )		 					// we'll check the overall error state on close
+		if ! (*p).Is_expired() {
+			plist = append( plist, p )
 		} else {
 			if (*p).Is_extinct( 120 ) && (*p).Is_pushed( ) {			// if really old and extension was pushed, safe to clean it out
 				rm_sheep.Baa( 1, "extinct reservation purged: %s", key )
 				delete( i.cache, key )
+				i.idx.drop( key )
+				delete( i.accounted, key )
 			}
 		}
 	}
 
+	for _, p := range i.recovering {								// not yet admitted, but mustn't be lost
+		plist = append( plist, p )
+	}
+
 	for key, p := range i.retry {
-		s := (*p).To_chkpt()
-		if s != "expired" {
-			fmt.Fprintf( i.chkpt, "%s\n", s )		 					// we'll check the overall error state on close
+		if ! (*p).Is_expired() {
+			plist = append( plist, p )
 		} else {
 			if (*p).Is_extinct( 120 ) && (*p).Is_pushed( ) {			// if really old and extension was pushed, safe to clean it out
 				rm_sheep.Baa( 1, "extinct reservation purged: %s", key )
 				delete( i.cache, key )
+				i.idx.drop( key )
+				delete( i.accounted, key )
 			}
 		}
 	}
 
-	ckpt_name, err := i.chkpt.Close( )
+	snap := make( []gizmos.Pledge, len( plist ) )		// copies the writer can format while the originals change
+	for n, p := range plist {
+		snap[n] = (*p).Snapshot( )
+	}
+
+	go chkpt_writer( i.chkpt, ulcaps, i.selector_recs( ), snap, i.ckpt_busy )
+
+	return false, now				// not queued, and send back the new chkpt time
+}
+
+/*
+	Format and write the checkpoint records then release the busy flag. Recs are records
+	already formatted (label selectors); snap is the snapshot of the pledges. Runs as a
+	goroutine and is the only user of the checkpoint object, and the snapshot, while it runs.
+*/
+func chkpt_writer( ck Checkpointer, ulcaps map[string]int, recs []string, snap []gizmos.Pledge, busy chan bool ) {
+	defer func( ) {
+		<- busy
+	}( )
+
+	for _, p := range snap {
+		if s := p.To_chkpt(); s != "expired" {
+			recs = append( recs, s )
+		}
+	}
+
+	err := ck.Create( )
+	if err != nil {
+		rm_sheep.Baa( 0, "CRI: resmgr: unable to create checkpoint file: %s  [TGURMG003]", err )
+		return
+	}
+
+	for nm, v := range ulcaps {									// write out user link capacity limits that have been set
+		fmt.Fprintf( ck, "ucap: %s %d\n", nm, v ) 				// we'll check the overall error state on close
+	}
+
+	for _, s := range recs {
+		fmt.Fprintf( ck, "%s\n", s )
+	}
+
+	ckpt_name, err := ck.Close( )
 	if err != nil {
 		rm_sheep.Baa( 0, "CRI: resmgr: checkpoint write failed: %s: %s  [TGURMG004]", ckpt_name, err )
 	} else {
-		rm_sheep.Baa( 1, "resmgr: checkpoint successful: %s", ckpt_name )
+		rm_sheep.Baa( 1, "resmgr: checkpoint successful: %s (%d reservations)", ckpt_name, len( recs ) )
 	}
+}
 
-	return false, time.Now().Unix()				// not queued, and send back the new chkpt time
+/*
+	Generate the json for a pledge that the requester does not own: only the id, the type and
+	the time window are given.
+*/
+func elided_json( p *gizmos.Pledge ) ( string ) {
+	ptype := gizmos.Pledge_kind_name( *p )
+
+	commence, expiry := (*p).Get_window()
+	return fmt.Sprintf( `{ "id": %q, "type": %q, "commence": %d, "expiry": %d, "elided": true }`, *(*p).Get_id(), ptype, commence, expiry )
 }
 
 /*
@@ -551,15 +830,38 @@ func Mk_inventory( ) (inv *Inventory) {
 	inv.cache = make( map[string]*gizmos.Pledge, 4096 )		// initial size is not a limit but a hint
 	inv.retry = make( map[string]*gizmos.Pledge, 2048 )
 	inv.ulcap_cache = make( map[string]int, 64 )
+	inv.accounted = make( map[string]bool, 64 )
+	inv.awaiting = make( map[string]int64, 64 )
+	inv.consent_wait = make( map[string]int64, 64 )
+	inv.fmstat = make( map[string]*res_fmstat, 4096 )
+	inv.doomed = make( map[string]int64, 64 )
+	inv.warned = make( map[string]int64, 64 )
+	inv.recovering = make( map[string]*gizmos.Pledge )
+	inv.ckpt_busy = make( chan bool, 1 )
+	inv.idx = mk_pledge_idx( )
+	inv.maint = make( map[string]*maint_window )
+	inv.quar = make( map[string]*quarantine )
+	inv.tiers = make( map[string]*proj_tier )
+	inv.ctmpls = make( map[string]*chain_tmpl )
+	inv.selectors = make( map[string]*label_sel )
+	inv.sel_jobs = make( chan *sel_job, MAX_SEL_JOBS )
 
 	return
 }
 
 /*
-	Stuff the pledge into the cache erroring if the pledge already exists.
+	Stuff the pledge into the cache erroring if the pledge already exists, or if adding it
+	would exceed the active reservation limits (res_mgr_limits).
 	Expect either a Pledge, or a pointer to a pledge.
 */
 func (inv *Inventory) Add_res( pi interface{} ) (err error) {
+	return inv.add_res( pi, true )
+}
+
+/*
+	Add the pledge to the cache, applying the limits only if limit is true.
+*/
+func (inv *Inventory) add_res( pi interface{}, limit bool ) (err error) {
 	var (
 		p *gizmos.Pledge
 	)
@@ -583,16 +885,68 @@ func (inv *Inventory) Add_res( pi interface{} ) (err error) {
 	id := (*p).Get_id()
 	if inv.cache[*id] != nil {
 		rm_sheep.Baa( 2, "reservation not added to inventory, already exists: %s", *id )
-		err = fmt.Errorf( "reservation already exists: %s", *id )
+		err = mk_err( ERR_DUPLICATE, "reservation already exists: %s", *id )
 		return
 	}
 
+	if limit {
+		if len( inv.recovering ) > 0 {							// recovered pledges may hold capacity and ids we can't see yet
+			err = mk_err( ERR_BUSY, "reservations are still being recovered after restart; try again shortly" )
+			release_refused( p )
+			return
+		}
+
+		if err = check_blackout( p ); err == nil {				// not active during a blackout (res_mgr_blackout)
+			if err = inv.check_depends( p ); err == nil {			// the pledge it depends on must exist (res_mgr_deps)
+				if err = inv.check_limits( p ); err == nil {
+					if err = inv.check_mirror( p ); err == nil {
+						err = check_flowtab( p )					// fqmgr refuses if a switch flow table would be over budget
+					}
+				}
+			}
+		}
+		if err != nil {
+			release_refused( p )								// network has already set the capacity aside
+			return
+		}
+	}
+
 	inv.cache[*id] = p
+	inv.idx.add( *id, p )
 
-	rm_sheep.Baa( 1, "resgmgr: added reservation: %s", (*p).To_chkpt() )
+	rm_sheep.Baa( 1, "resgmgr: added reservation: cid=%s %s", (*p).Get_cid(), gizmos.Redact_chkpt( (*p).To_chkpt() ) )
 	return
 }
 
+/*
+	Add the pledges from a batch request (http_batch.go). Each is checked for a duplicate,
+	including one added from earlier in the list, and then added as for REQ_ADD. The list
+	returned has the error for each pledge (nil if it was added).
+*/
+func (inv *Inventory) add_batch( plist []gizmos.Pledge, approval_thresh int64 ) ( []error ) {
+	errs := make( []error, len( plist ) )
+
+	for i := range plist {
+		p := plist[i]
+		if rid, _ := inv.dup_check( &p ); rid != nil {
+			errs[i] = mk_err( ERR_DUPLICATE, "reservation duplicates existing reservation: %s", *rid )
+			release_refused( &p )
+			continue
+		}
+
+		if errs[i] = inv.Add_res( p ); errs[i] == nil {
+			publish_event( "reservation.added", p.Get_origin().Add_to_json( p.To_json() ) )
+			if p.Get_consent() != "" {
+				inv.hold_for_consent( &p )
+			} else {
+				inv.hold_for_approval( &p, approval_thresh )
+			}
+		}
+	}
+
+	return errs
+}
+
 /*
 	Return the reservation that matches the name passed in provided that the cookie supplied
 	matches the cookie on the reservation as well.  The cookie may be either the cookie that
@@ -605,14 +959,18 @@ func (inv *Inventory) Get_res( name *string, cookie *string ) (p *gizmos.Pledge,
 	state = nil
 	p = inv.cache[*name]
 	if p == nil {
-		state = fmt.Errorf( "cannot find reservation: %s", *name )
+		if inv.recovering[*name] != nil {
+			state = mk_err( ERR_BUSY, "reservation is still being recovered after restart: %s", *name )
+		} else {
+			state = mk_err( ERR_NOT_FOUND, "cannot find reservation: %s", *name )
+		}
 		return
 	}
 
 	if ! (*p).Is_valid_cookie( cookie ) &&  *cookie != *super_cookie {
-		rm_sheep.Baa( 2, "resgmgr: denied fetch of reservation: cookie supplied (%s) didn't match that on pledge %s", *cookie, *name )
+		rm_sheep.Baa( 2, "resgmgr: denied fetch of reservation: cookie supplied (%s) didn't match that on pledge %s", gizmos.Mask( *cookie ), *name )
 		p = nil
-		state = fmt.Errorf( "not authorised to access or delete reservation: %s", *name )
+		state = mk_err( ERR_NOT_AUTHORISED, "not authorised to access or delete reservation: %s", *name )
 		return
 	}
 
@@ -629,14 +987,14 @@ func (inv *Inventory) Get_retry_res( name *string, cookie *string ) (p *gizmos.P
 	state = nil
 	p = inv.retry[*name]
 	if p == nil {
-		state = fmt.Errorf( "cannot find reservation in retry cache: %s", *name )
+		state = mk_err( ERR_NOT_FOUND, "cannot find reservation in retry cache: %s", *name )
 		return
 	}
 
 	if ! (*p).Is_valid_cookie( cookie ) &&  *cookie != *super_cookie {
-		rm_sheep.Baa( 2, "resgmgr: denied fetch of reservation: cookie supplied (%s) didn't match that on pledge %s", *cookie, *name )
+		rm_sheep.Baa( 2, "resgmgr: denied fetch of reservation: cookie supplied (%s) didn't match that on pledge %s", gizmos.Mask( *cookie ), *name )
 		p = nil
-		state = fmt.Errorf( "not authorised to access or delete reservation: %s", *name )
+		state = mk_err( ERR_NOT_AUTHORISED, "not authorised to access or delete reservation: %s", *name )
 		return
 	}
 
@@ -644,6 +1002,91 @@ func (inv *Inventory) Get_retry_res( name *string, cookie *string ) (p *gizmos.P
 	return
 }
 
+/*
+	Return the user supplied name of the reservation (cache or retry list); empty if it has
+	none. Events which carry only the id include it.
+*/
+func (inv *Inventory) res_label( id string ) ( string ) {
+	p := inv.cache[id]
+	if p == nil {
+		p = inv.retry[id]
+	}
+	if p == nil {
+		return ""
+	}
+
+	name, _ := (*p).Get_name()
+	return name
+}
+
+/*
+	Change the user metadata on a reservation; an empty value removes the key. Either all
+	of the pairs are applied or none are. The reservation is indexed again so that a search
+	finds it by the new values.
+*/
+func (inv *Inventory) set_meta( name *string, cookie *string, pairs map[string]string ) ( err error ) {
+	p, err := inv.Get_res( name, cookie )
+	if err != nil {
+		return err
+	}
+
+	old := (*p).Get_meta()
+	for k, v := range pairs {
+		if err = (*p).Set_meta( k, v ); err != nil {
+			for k := range pairs {							// put back what was there
+				(*p).Set_meta( k, old[k] )
+			}
+			return mk_err( ERR_BAD_REQUEST, "%s", err )
+		}
+	}
+
+	inv.idx.add( *name, p )
+	rm_sheep.Baa( 1, "metadata changed for reservation %s: %v", *name, pairs )
+	return nil
+}
+
+/*
+	Add cookies to, or remove them from, the owner group of a reservation (op is add or del),
+	or list the group (list). The cookie must be valid for the reservation (a member of the
+	group) or be the super cookie. The group, with the cookies masked, is returned.
+*/
+func (inv *Inventory) set_owners( name *string, cookie *string, op string, list []string ) ( jstr string, err error ) {
+	p, err := inv.Get_res( name, cookie )
+	if err != nil {
+		return "", err
+	}
+
+	if op != "list" {
+		old := (*p).Get_owners()
+		for _, c := range list {
+			if op == "add" {
+				err = (*p).Add_owner( c )
+			} else {
+				err = (*p).Del_owner( c )
+			}
+
+			if err != nil {
+				for _, c := range (*p).Get_owners() {			// put back what was there
+					(*p).Del_owner( c )
+				}
+				for _, c := range old {
+					(*p).Add_owner( c )
+				}
+				return "", mk_err( ERR_BAD_REQUEST, "%s", err )
+			}
+		}
+
+		rm_sheep.Baa( 1, "owner group of reservation %s changed: %s %d cookies", *name, op, len( list ) )
+		publish_event( "reservation.owners_changed", fmt.Sprintf( `{ "id": %q, "name": %q, "owners": %d }`, *name, inv.res_label( *name ), len( (*p).Get_owners() ) ) )
+	}
+
+	owners := (*p).Get_owners()
+	for i := range owners {
+		owners[i] = fmt.Sprintf( "%q", gizmos.Mask( owners[i] ) )
+	}
+	return fmt.Sprintf( `{ "id": %q, "owners": [ %s ] }`, *name, strings.Join( owners, ", " ) ), nil
+}
+
 /*
 	Check the two pledges (old, new) to see if the related physical hosts have moved.
 	Returns true if the physical hosts have changed. We get the current physical location
@@ -662,16 +1105,15 @@ func phosts_changed( old *gizmos.Pledge, new *gizmos.Pledge ) ( bool ) {
 	}
 
 	a1, a2 := (*new).Get_hosts( )							// get hosts from the new pledge
-	ch := make( chan *ipc.Chmsg )						// do not close -- senders close channels
-	req := ipc.Mk_chmsg( )
-	req.Send_req( nw_ch, ch, REQ_GETPHOST, a1, nil )	// xlate hostnames to physical host location
-	req = <- ch											// wait for response from network
-	p1 := req.Response_data.( *string )
+	req := nw_req( REQ_GETPHOST, a1, nil )				// xlate hostnames to physical host location
+	p1, ok := req.Response_data.( *string )
+	if ! ok {
+		return false									// unknown, or network didn't answer; assume not moved
+	}
 
 	if a2 != nil {
 		if len( *a2) > 1  &&  (*a2)[0:1] != "!" {				// !// names aren't known, don't map
-			req.Send_req( nw_ch, ch, REQ_GETPHOST, a2, nil )
-			req = <- ch									
+			req = nw_req( REQ_GETPHOST, a2, nil )
 			if req.Response_data != nil {					// for an external address this will be unknown
 				p2 = req.Response_data.( *string )
 			}
@@ -711,7 +1153,7 @@ func dup_in_cache( cache map[string]*gizmos.Pledge, target *gizmos.Pledge ) ( ri
 			if isbw {											// if passed pledge is a bandwidth, check paths
 				if ! phosts_changed( r, target ) {			// if they aren't on the same places, then we should refresh
 					(*r).Reset_pushed( )							// we'll force this out
-					(*r).Set_expiry( time.Now().Unix() + 15 )		// force expiry of old
+					(*r).Set_expiry( delete_expiry( *r ) )			// force expiry of old
 					rm_sheep.Baa( 1, "duplicate with different anchors will be refreshed: %s", *r )
 					return nil
 				}
@@ -749,6 +1191,12 @@ func (inv *Inventory) dup_check( p *gizmos.Pledge ) ( rid *string, state error )
 		return rid, nil
 	}
 
+	for _, r := range inv.recovering {						// not admitted yet, so no anchor refresh; just a duplicate
+		if (*p).Equals( r ) {
+			return (*r).Get_id(), nil
+		}
+	}
+
 /*
 	bwr2, isbw  := (*p).( *gizmos.Pledge_bw )
 	for _, r := range inv.cache {
@@ -831,27 +1279,28 @@ func (inv *Inventory) Del_res( name *string, cookie *string ) (state error) {
 	gp, state := inv.Get_res( name, cookie )
 
 	if gp != nil {
-		rm_sheep.Baa( 2, "resgmgr: deleted reservation: %s", (*gp).To_str() )
+		rm_sheep.Baa( 2, "resgmgr: deleted reservation: cid=%s %s", (*gp).Get_cid(), (*gp).To_str() )
 		state = nil
+		publish_event( "reservation.deleted", (*gp).Get_origin().Add_to_json( (*gp).To_json() ) )
 
 		switch p := (*gp).(type) {
 			case *gizmos.Pledge_mirror:
 				p.Set_expiry( time.Now().Unix() )					// expire the mirror NOW
 				p.Set_pushed()						// need this to force undo to occur
 
-			case *gizmos.Pledge_bw, *gizmos.Pledge_bwow:			// network handles either type
-				ch := make( chan *ipc.Chmsg )						// do not close -- senders close channels
-				req := ipc.Mk_chmsg( )
-				req.Send_req( nw_ch, ch, REQ_DEL, p, nil )			// delete from the network point of view
-				req = <- ch											// wait for response from network
+			case *gizmos.Pledge_bw, *gizmos.Pledge_bwow, *gizmos.Pledge_mcast:			// network handles each; a multicast tree is released as a whole
+				inv.account( *name, gp, "deleted" )
+				req := nw_req( REQ_DEL, p, nil )					// delete from the network point of view
 				state = req.State
-				p.Set_expiry( time.Now().Unix() + 15 )				// set the expiry to 15s from now which will force it out
+				p.Set_expiry( delete_expiry( *gp ) )				// set a short expiry which will force it out
 				(*gp).Reset_pushed()								// force push of flow-mods that reset the expiry
 
-			case *gizmos.Pledge_pass:
-				p.Set_expiry( time.Now().Unix() + 15 )				// set the expiry to 15s from now which will force it out
+			case *gizmos.Pledge_pass, *gizmos.Pledge_trust, *gizmos.Pledge_steer:
+				p.Set_expiry( delete_expiry( *gp ) )				// set a short expiry which will force it out
 				(*gp).Reset_pushed()								// force push of flow-mods that reset the expiry
 		}
+
+		inv.cascade_deps( *name, "deleted" )					// those that depend on it go too (res_mgr_deps)
 	} else {
 		if state == nil {
 			gp, state = inv.Get_retry_res( name, cookie )		// see if it's in the retry cache and cookie was valid for it
@@ -862,6 +1311,7 @@ func (inv *Inventory) Del_res( name *string, cookie *string ) (state error) {
 				// didn't have enough info to vet the pledge, and thus the existing flow-mods do need to be reset on the phyisical
 				// host.
 				delete( inv.retry, *name )						// for pledges on the retry cache, they can just be deleted since no flow-mods exist etc
+				inv.cascade_deps( *name, "deleted" )
 			}
 		} else {
 			rm_sheep.Baa( 2, "resgmgr: unable to delete reservation: not found: %s", *name )
@@ -877,35 +1327,7 @@ func (inv *Inventory) Del_res( name *string, cookie *string ) (state error) {
 	is a user cookie, then deletes all reservations that match the cookie.
 */
 func (inv *Inventory) Del_all_res( cookie *string ) ( ndel int ) {
-	var	(
-		plist	[]*string			// we'll create a list to avoid deletion issues with range
-		i		int
-	)
-
-	ndel = 0
-
-	plist = make( []*string, len( inv.cache ) )			// build a list so we can safely remove from the map
-	for _, pledge := range inv.cache {
-		if ! (*pledge).Is_expired( ) {
-			plist[i] = (*pledge).Get_id()
-			i++
-		}
-	}
-	plist = plist[:i]									// slice down to what was actually filled in
-
-	for _, pname := range plist {
-		rm_sheep.Baa( 2, "delete all attempt to delete: %s", *pname )
-		err := inv.Del_res( pname,  cookie )
-		if err == nil {
-			ndel++
-			rm_sheep.Baa( 1, "delete all deleted reservation %s", *pname )
-		} else {
-			rm_sheep.Baa( 1, "delete all skipped reservation %s", *pname )
-		}
-	}
-
-	rm_sheep.Baa( 1, "delete all deleted %d reservations %s", ndel )
-	return
+	return len( inv.del_scoped( &del_scope{ cookie: cookie } ) )
 }
 
 
@@ -939,12 +1361,10 @@ func (inv *Inventory) yank_res( name *string ) ( p *gizmos.Pledge, state error)
 
 				inv.cache[*name] = nil								// yank original from the list
 				delete( inv.cache, *name )
+				inv.idx.drop( *name )
 				pldg.Set_path_list( nil )							// no path list for this pledge
 
-				ch := make( chan *ipc.Chmsg )
-				req := ipc.Mk_chmsg( )
-				req.Send_req( nw_ch, ch, REQ_DEL, cp, nil )			// delete from the network point of view
-				req = <- ch											// wait for response from network
+				req := nw_req( REQ_DEL, cp, nil )					// delete from the network point of view
 				state = req.State
 
 																// now safe to set these
@@ -954,7 +1374,7 @@ func (inv *Inventory) yank_res( name *string ) ( p *gizmos.Pledge, state error)
 			// not supported for other pledge types
 		}
 	} else {
-		state = fmt.Errorf( "no reservation with name: %s", *name )
+		state = mk_err( ERR_NOT_FOUND, "no reservation with name: %s", *name )
 		rm_sheep.Baa( 2, "resgmgr: unable to yank, no reservation with name: %s", *name )
 	}
 
@@ -1011,9 +1431,31 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 		res_refresh	int64 = 0			// next time when we must force all reservations to refresh flow-mods (hto_limit nonzero)
 		rr_rate		int = 3600			// refresh rate (1 hour)
 		favour_v6 bool = true			// favour ipv6 addresses if a host has both defined.
+		approval_thresh	int64 = 0		// bandwidth above which reservations must be approved; 0 disables
+		approval_timeout int64 = 3600	// seconds a reservation may wait for approval
+		del_grace	int64 = 0			// seconds a deleted reservation remains (res_mgr_grace)
+		expiry_warn	int64 = 0			// seconds before expiry that a warning is given (res_mgr_expiry)
+		rcv_workers	int = 4				// background checkpoint recovery workers (rm_recovery_async)
+		cap_check	int64 = 300			// seconds between over-capacity checks; 0 disables (res_mgr_capcheck)
+		cap_drop	string = "repath"	// repath or flag reservations on a link whose capacity dropped (res_mgr_capcheck)
+		cons_check	int64 = 0			// seconds between consistency checks; 0 disables (res_mgr_consist)
+		cons_repair	map[string]bool		// discrepancies repaired by the timed consistency check
+		summary_hour int = -1			// hour (utc) of the daily expiry summary; -1 is off
+		last_summary string				// date of the last summary
+		max_active	int = 0				// active reservation limits; 0 disables
+		max_tenant	int = 0
+		mirror_max	int = 0				// mirror limits per physical host; 0 disables
+		mirror_bw	int64 = 0
+		fmod_audit	int64 = 60			// seconds between flow-mod audits; 0 disables
+		fmod_ack_wait int64 = 60		// seconds an agent has to acknowledge flow-mods
+		fmod_retries int = 3			// pushes of a reservation because of audit failures
+		usage_ivl	int64 = 0			// seconds between interim accounting records; 0 disables
+		reopt_ivl	int64 = 0			// seconds between re-optimisation passes; 0 disables (res_mgr_reopt)
+		reopt_gain	int64 = 10			// percentage points the busiest link must improve by to move a reservation
 	)
 
 	super_cookie = cookie				// global for all methods
+	register_pledge_ops( )
 
 	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )		// allocate our bleater and attach it to the master
 	rm_sheep.Set_prefix( "res_mgr" )
@@ -1069,6 +1511,81 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 			hto_limit = clike.Atoi( *p )
 		}
 
+		if p = cfg_data["resmgr"]["approval_threshold"]; p != nil {
+			approval_thresh = int64( clike.Atof( *p ) )
+		}
+		if p = cfg_data["resmgr"]["approval_timeout"]; p != nil {
+			approval_timeout = clike.Atoi64( *p )
+		}
+		if p = cfg_data["resmgr"]["del_grace"]; p != nil {
+			del_grace = clike.Atoi64( *p )
+		}
+		if p = cfg_data["resmgr"]["cons_check"]; p != nil {
+			cons_check = clike.Atoi64( *p )
+		}
+		if p = cfg_data["resmgr"]["cons_repair"]; p != nil {
+			cons_repair = repair_set( *p )
+		}
+		if p = cfg_data["resmgr"]["cap_check"]; p != nil {
+			cap_check = clike.Atoi64( *p )
+		}
+		if p = cfg_data["resmgr"]["cap_drop"]; p != nil {
+			if *p == "repath" || *p == "flag" {
+				cap_drop = *p
+			} else {
+				rm_sheep.Baa( 0, "WRN: cap_drop in config file must be repath or flag; %s ignored  [TGURMG018]", *p )
+			}
+		}
+		if p = cfg_data["resmgr"]["recovery_workers"]; p != nil {
+			rcv_workers = clike.Atoi( *p )
+		}
+		if p = cfg_data["resmgr"]["expiry_warn"]; p != nil {
+			expiry_warn = clike.Atoi64( *p )
+			gizmos.Set_expiry_warn( expiry_warn )
+		}
+		if p = cfg_data["resmgr"]["expiry_summary_hour"]; p != nil {
+			summary_hour = clike.Atoi( *p )
+			if summary_hour > 23 {
+				rm_sheep.Baa( 0, "WRN: resmgr:expiry_summary_hour must be 0-23; summaries are off: %s  [TGURMG011]", *p )
+				summary_hour = -1
+			}
+		}
+
+		if p = cfg_data["resmgr"]["max_active"]; p != nil {
+			max_active = clike.Atoi( *p )
+		}
+		if p = cfg_data["resmgr"]["max_active_tenant"]; p != nil {
+			max_tenant = clike.Atoi( *p )
+		}
+
+		if p = cfg_data["resmgr"]["fmod_audit"]; p != nil {
+			fmod_audit = clike.Atoi64( *p )
+		}
+		if p = cfg_data["resmgr"]["fmod_ack_wait"]; p != nil {
+			fmod_ack_wait = clike.Atoi64( *p )
+		}
+		if p = cfg_data["resmgr"]["fmod_retries"]; p != nil {
+			fmod_retries = clike.Atoi( *p )
+		}
+		if p = cfg_data["resmgr"]["usage_interval"]; p != nil {
+			usage_ivl = clike.Atoi64( *p )
+		}
+		if p = cfg_data["resmgr"]["reopt"]; p != nil {
+			reopt_ivl = clike.Atoi64( *p )
+		}
+		if p = cfg_data["resmgr"]["reopt_gain"]; p != nil {
+			reopt_gain = clike.Atoi64( *p )
+		}
+
+		if p = cfg_data["resmgr"]["acct_sink"]; p != nil && *p != "" {
+			var err error
+			if acct_sink, err = mk_sink( *p, 1024 ); err != nil {
+				rm_sheep.Baa( 0, "ERR: unable to create accounting sink: %s: %s  [TGURMG006]", *p, err )
+			} else {
+				rm_sheep.Baa( 1, "accounting records will be written to %s", *p )
+			}
+		}
+
 		p = cfg_data["resmgr"]["res_refresh"]				// rate that reservations are refreshed if hto_limit is non-zero
 		if p != nil {
 			rr_rate = clike.Atoi( *p )
@@ -1083,11 +1600,36 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 		}
 	}
 
+	lead_init( )
+	ip_cache_init( )
+	pause_init( )
+	blackout_init( )
+	late_init( )
+
+	if cfg_data["mirror"] != nil {
+		if p = cfg_data["mirror"]["max_per_host"]; p != nil {
+			mirror_max = clike.Atoi( *p )
+		}
+		if p = cfg_data["mirror"]["max_host_bw"]; p != nil {
+			mirror_bw = int64( clike.Atof( *p ) )
+		}
+	}
+
 	send_meta_counter := 200;										// send meta f-mods only now and again
 	rm_sheep.Baa( 1, "ovs table number %d used for metadata marking", alt_table )
 
 	res_refresh = time.Now().Unix() + int64( rr_rate )				// set first refresh in an hour (ignored if hto_limit not set
 	inv = Mk_inventory( )
+	inv.idx.rch = my_chan										// index address lookups report back to us
+	inv.max_active = max_active
+	inv.max_tenant = max_tenant
+	inv.tiers = tiers_init( )
+	inv.ctmpls = ctmpl_init( )
+	inv.sla = sla_init( )
+	inv.mirror_max = mirror_max
+	inv.mirror_bw = mirror_bw
+	inv.del_grace = del_grace
+	inv.rcv_workers = rcv_workers
 	inv.chkpt = chkpt.Mk_chkpt( ckptd, 10, 90 )
 
 	last_qcheck = time.Now().Unix()
@@ -1097,8 +1639,31 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 	tklr.Add_spot( 1, tkl_ch, REQ_SETQUEUES, nil, ipc.FOREVER )			// drives us to see if queues need to be adjusted
 	tklr.Add_spot( 5, tkl_ch, REQ_RTRY_CHKPT, nil, ipc.FOREVER )		// ensures that we retried any missed checkpoints
 	tklr.Add_spot( 60, tkl_ch, REQ_VET_RETRY, nil, ipc.FOREVER )		// run the retry queue if it has size
+	add_spot( tklr, rm_sheep, "TGURMG030", "approval check", 30, tkl_ch, REQ_APPROVAL_CHECK, ipc.FOREVER )	// reject reservations that waited too long for approval
+	if fmod_audit > 0 {
+		add_spot( tklr, rm_sheep, "TGURMG030", "flow-mod audit", fmod_audit, tkl_ch, REQ_FMOD_AUDIT, ipc.FOREVER )	// push again reservations whose flow-mods weren't installed
+	}
+	if cap_check > 0 {
+		add_spot( tklr, rm_sheep, "TGURMG030", "capacity check", cap_check, tkl_ch, REQ_CAP_CHECK, ipc.FOREVER )		// verify that no link is obligated beyond its capacity
+	}
+	if cons_check > 0 {
+		add_spot( tklr, rm_sheep, "TGURMG030", "consistency check", cons_check, tkl_ch, REQ_CONS_CHECK, ipc.FOREVER )	// inventory, graph and agent consistency
+	}
+	if usage_ivl > 0 {
+		add_spot( tklr, rm_sheep, "TGURMG030", "usage accounting", usage_ivl, tkl_ch, REQ_USAGE_POLL, ipc.FOREVER )	// interim accounting records
+	}
+	if reopt_ivl > 0 {
+		add_spot( tklr, rm_sheep, "TGURMG030", "re-optimisation", reopt_ivl, tkl_ch, REQ_REOPT, ipc.FOREVER )		// move reservations which opted in to better paths
+	}
+	if del_grace > 0 {
+		add_spot( tklr, rm_sheep, "TGURMG030", "grace period deletes", 5, tkl_ch, REQ_GRACE_CHECK, ipc.FOREVER )		// delete reservations whose grace period has passed
+	}
+	if expiry_warn > 0 || summary_hour >= 0 {
+		add_spot( tklr, rm_sheep, "TGURMG030", "expiry warnings", 60, tkl_ch, REQ_EXPIRY_CHECK, ipc.FOREVER )		// expiration warnings and daily summary
+	}
 
 	go rm_lookup( rmgrlu_ch, inv )
+	go sel_worker( inv.sel_jobs )
 
 	rm_sheep.Baa( 3, "res_mgr is running  %x", my_chan )
 	for {
@@ -1108,13 +1673,179 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 				my_chan <- msg;						// just pass it through; tkl_ch has a small buffer (blocks quickly) and this prevents filling the main queue w/ tickles if we get busy	
 
 			case msg = <- my_chan:					// process message from the main channel
-				rm_sheep.Baa( 3, "processing message: %d", msg.Msg_type )
+				baa_req( rm_sheep, msg )
 				switch msg.Msg_type {
 					case REQ_NOOP:			// just ignore
 
 					case REQ_ADD:
 						msg.State = inv.Add_res( msg.Req_data )			// add will determine the pledge type and do the right thing
 						msg.Response_data = nil
+						if p, ok := msg.Req_data.( gizmos.Pledge ); ok && msg.State == nil {
+							publish_event( "reservation.added", p.Get_origin().Add_to_json( p.To_json() ) )
+							if p.Get_consent() != "" {
+								inv.hold_for_consent( &p )					// approval, if needed, follows consent
+							} else {
+								inv.hold_for_approval( &p, approval_thresh )
+							}
+						}
+
+					case REQ_ADD_BATCH:										// data is the list of pledges; response is an error for each
+						msg.Response_data = inv.add_batch( msg.Req_data.( []gizmos.Pledge ), approval_thresh )
+						msg.State = nil
+
+					case REQ_APPROVE:										// data is name and "approve" or "reject"
+						data := msg.Req_data.( []string )
+						msg.State = inv.approve( &data[0], data[1] == "approve" )
+						msg.Response_data = nil
+						inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )
+
+					case REQ_CONSENT:										// data is name, "consent" or "refuse", and project ID
+						data := msg.Req_data.( []string )
+						msg.State = inv.give_consent( &data[0], data[2], data[1] == "consent", approval_thresh )
+						msg.Response_data = nil
+						inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )
+
+					case REQ_APPROVAL_CHECK:
+						if approval_thresh > 0 {
+							inv.expire_awaiting( approval_timeout )
+						}
+						if xtenant_consent {
+							inv.expire_consent( consent_timeout )
+						}
+
+					case REQ_FMOD_STATUS:								// agent manager: a bandwidth flow-mod action was sent or answered
+						msg.Response_ch = nil
+						inv.fmod_update( msg.Req_data.( *fmod_report ), fmod_retries )
+
+					case REQ_CAP_CHECK:									// network does the comparison; no response needed
+						cmsg := ipc.Mk_chmsg( )
+						cmsg.Send_req( nw_ch, nil, REQ_CAP_CHECK, inv.link_usage(), nil )
+
+					case REQ_CONS_CHECK:								// timed (no data) or requested; data is the list of discrepancies to repair
+						rset := cons_repair
+						if rl, ok := msg.Req_data.( *string ); ok && rl != nil {
+							rset = repair_set( *rl )
+						}
+
+						var need_push bool
+						msg.Response_data, need_push = inv.cons_check( rset, fmod_ack_wait )
+						msg.State = nil
+						if need_push {
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )		// queues first; reservations are pushed when the map arrives
+						}
+
+					case REQ_FMOD_AUDIT:
+						inv.fmod_audit( fmod_ack_wait, fmod_retries )
+						inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )
+
+					case REQ_USAGE_POLL:
+						inv.usage_poll( )
+
+					case REQ_RES_STATUS:								// flow-mod status of a reservation; data is name and cookie
+						data := msg.Req_data.( []*string )
+						msg.Response_data, msg.State = inv.fmstat_json( data[0], data[1] )
+
+					case REQ_RES_WATCH:									// resstatus with watch; held until the status changes or time is up
+						if msg.State = inv.add_watch( msg.Req_data.( *res_watch ), msg ); msg.State == nil {
+							msg.Response_ch = nil						// answered by check_watches
+						}
+
+					case REQ_TAG_EXPORT:								// tickled when osif exports reservation state to openstack tags
+						tmsg := ipc.Mk_chmsg( )
+						tmsg.Send_req( osif_ch, nil, REQ_TAG_EXPORT, inv.tag_states(), nil )
+
+					case REQ_ADD_SELECTOR:								// label selector from http; answered by the worker once its reservations are made
+						rch := msg.Response_ch
+						msg.Response_ch = nil
+						if msg.State = inv.add_selector( msg.Req_data.( *label_sel ), rch ); msg.State != nil {
+							msg.Response_ch = rch
+						} else {
+							retry_chkpt, last_chkpt = inv.write_chkpt( last_chkpt )
+						}
+
+					case REQ_SEL_EVAL:									// osif has read the vm labels
+						if inv.eval_selectors( ) {
+							retry_chkpt, last_chkpt = inv.write_chkpt( last_chkpt )
+						}
+
+					case REQ_SEL_MEMBERS:								// from the selector worker; data is the selector id
+						msg.Response_data, msg.State = inv.sel_members( msg.Req_data.( string ) )
+
+					case REQ_QUOTA_SYNC:								// tickled when osif syncs reserved bandwidth to openstack quotas
+						tmsg := ipc.Mk_chmsg( )
+						tmsg.Send_req( osif_ch, nil, REQ_QUOTA_SYNC, inv.project_bandw(), nil )
+
+					case REQ_SNAPSHOT:									// inventory as checkpoint records
+						msg.Response_data = inv.chkpt_recs( )
+						msg.State = nil
+
+					case REQ_HOST_ADDRS:								// addresses looked up for the index
+						inv.idx.set_addrs( msg.Req_data.( map[string]*host_addrs ) )
+
+					case REQ_RECOVERED:									// a recovery worker finished with a pledge
+						if inv.recovered( msg.Req_data.( *rcv_result ) ) {
+							inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )
+						}
+
+					case REQ_INV_STATS:									// aggregate counts and bandwidth for dashboards
+						msg.Response_data = inv.stats_json()
+						msg.State = nil
+
+					case REQ_COMPACT:									// data is true if only a report is wanted
+						msg.Response_data = inv.compact( msg.Req_data.( bool ) )
+						msg.State = nil
+
+					case REQ_RECOVERY:									// report from the last checkpoint load
+						msg.Response_data = inv.recovery.To_json()
+						msg.State = nil
+
+					case REQ_IMPACT:									// reservations traversing a host/switch; data is the name
+						msg.Response_data = inv.impact_json( *(msg.Req_data.( *string )) )
+						msg.State = nil
+
+					case REQ_FIP_MOVED:									// from network after its maps are updated; data is []*fip_move
+						if inv.fip_moved( msg.Req_data.( []*fip_move ) ) > 0 {
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )		// queues first; reservations are pushed when the map arrives
+						}
+
+					case REQ_REOPT:
+						if inv.reoptimise( reopt_ivl, reopt_gain ) > 0 {
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )		// queues first; reservations are pushed when the map arrives
+						}
+
+					case REQ_LINK_RECHECK:								// from network; links whose learned capacity dropped below their obligation
+						if inv.link_recheck( msg.Req_data.( []string ), cap_drop == "repath" ) > 0 {
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )
+						}
+
+					case REQ_BULK_USAGE:								// from fq-mgr; bytes moved by bulk transfers since the last count
+						msg.Response_ch = nil
+						if inv.bulk_usage( msg.Req_data.( map[string]int64 ) ) > 0 {
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )		// queues first; reservations are pushed when the map arrives
+						}
+
+					case REQ_NAT_PROBE_STATE:							// from fq-mgr; data is id, host, result
+						msg.Response_ch = nil
+						data := msg.Req_data.( []string )
+						inv.nat_update( data[0], data[1], data[2] )
+
+					case REQ_VERIFY_STATE:								// from fq-mgr; data is id, host and direction, result
+						msg.Response_ch = nil
+						data := msg.Req_data.( []interface{} )
+						inv.verify_update( data[0].( string ), data[1].( string ), data[2].( *verify_result ) )
+
+					case REQ_SLA_USAGE:									// from fq-mgr; rate and drops of reservations over the last poll
+						msg.Response_ch = nil
+						inv.sla_usage( msg.Req_data.( []*sla_sample ) )
+
+					case REQ_SLA_REPORT:								// sla breach history; data is the reservation id, empty for all
+						msg.Response_data = inv.sla_json( *(msg.Req_data.( *string )) )
+						msg.State = nil
+
+					case REQ_HOST_RECONCILE:							// agent for the host reconnected; data is the host name
+						if inv.reconcile_host( *(msg.Req_data.( *string )) ) > 0 {
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )		// queues first; reservations are pushed when the map arrives
+						}
 
 
 					case REQ_ALLUP:			// signals that all initialisation is complete (chkpting etc. can go)
@@ -1141,13 +1872,48 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 						if data[0] != nil  &&  *data[0] == "all" {
 							inv.Del_all_res( data[1] )
 							msg.State = nil
+						} else if data[0] != nil && inv.selectors[*data[0]] != nil {		// label selector and its reservations
+							msg.State = inv.del_selector( *data[0], data[1] )
+							msg.Response_data = nil
+							retry_chkpt, last_chkpt = inv.write_chkpt( last_chkpt )
 						} else {
-							msg.State = inv.Del_res( data[0], data[1] )
+							msg.Response_data, msg.State = inv.user_del( data[0], data[1] )		// response is the time of deletion if there is a grace period
 						}
 
 						inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )			// must force a push to push augmented (shortened) reservations
+
+					case REQ_CHAIN:											// service chain status, extend or delete; data is *chain_req
+						cr := msg.Req_data.( *chain_req )
+						msg.Response_data, msg.State = inv.chain( cr )
+						if cr.op != "status" {
+							inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )
+						}
+
+					case REQ_UNDELETE:										// data is name and cookie
+						data := msg.Req_data.( []*string )
+						msg.State = inv.undelete( data[0], data[1] )
 						msg.Response_data = nil
 
+					case REQ_EXPIRY_CHECK:
+						if expiry_warn > 0 {
+							inv.expiry_check( expiry_warn )
+						}
+						if summary_due( summary_hour, &last_summary ) {
+							inv.expiry_summary( )
+						}
+
+					case REQ_GRACE_CHECK:
+						if inv.reap_doomed( ) > 0 {
+							inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )
+						}
+
+					case REQ_DELALL:										// scoped delete all; response is the list of ids deleted (or that would be)
+						scope := msg.Req_data.( *del_scope )
+						msg.Response_data = inv.del_scoped( scope )
+						if ! scope.dryrun {
+							inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )
+						}
+
 					case REQ_DUPCHECK:
 						if msg.Req_data != nil {
 							msg.Response_data, msg.State = inv.dup_check(  msg.Req_data.( *gizmos.Pledge ) )
@@ -1157,12 +1923,56 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 						data := msg.Req_data.( []*string )					// assume pointers to name and cookie
 						msg.Response_data, msg.State = inv.Get_res( data[0], data[1] )
 
-					case REQ_LIST:											// list reservations	(for a client)
-						msg.Response_data, msg.State = inv.res2json( )
+					case REQ_LIST:											// list reservations	(for a client); data is the cookie or nil
+						cookie, _ := msg.Req_data.( *string )
+						msg.Response_data, msg.State = inv.res2json( cookie )
+
+					case REQ_SET_META:										// change user metadata; data is name, cookie and the key/value map
+						data := msg.Req_data.( []interface{} )
+						msg.Response_data = nil
+						msg.State = inv.set_meta( data[0].( *string ), data[1].( *string ), data[2].( map[string]string ) )
+
+					case REQ_OWNERS:										// data is name, cookie, op and the list of cookies
+						data := msg.Req_data.( []interface{} )
+						msg.Response_data, msg.State = inv.set_owners( data[0].( *string ), data[1].( *string ), data[2].( string ), data[3].( []string ) )
+
+					case REQ_MAINT:											// add, delete or list maintenance windows; data is *maint_req
+						msg.Response_data, msg.State = inv.maint_req( msg.Req_data.( *maint_req ) )
+
+					case REQ_QUARANTINE:									// add, lift or list host quarantines; data is *quar_req
+						var changed bool
+						msg.Response_data, changed, msg.State = inv.quar_req( msg.Req_data.( *quar_req ) )
+						if changed {
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )		// queues first; reservations are pushed when the map arrives
+						}
+
+					case REQ_PROJ_TIER:										// project tiers; data is *tier_req
+						msg.Response_data, msg.State = inv.tier_req( msg.Req_data.( *tier_req ) )
+
+					case REQ_CHAIN_TMPL:									// service chain templates; data is *ctmpl_req
+						msg.Response_data, msg.State = inv.ctmpl_req( msg.Req_data.( *ctmpl_req ) )
+
+					case REQ_SEARCH:										// find reservations; data is the field/value map, and cookie
+						data := msg.Req_data.( []interface{} )
+						cookie, _ := data[1].( *string )
+						msg.Response_data, msg.State = inv.search( data[0].( map[string]string ), cookie )
+
+					case REQ_TIMELINE:										// data is the field/value map (from and to included)
+						q := msg.Req_data.( map[string]string )
+						from := clike.Atoi64( q["from"] )
+						to := clike.Atoi64( q["to"] )
+						delete( q, "from" )
+						delete( q, "to" )
+						msg.Response_data, msg.State = inv.timeline( q, from, to )
 
 					case REQ_LOAD:								// load from a checkpoint file
 						data := msg.Req_data.( *string )		// assume pointers to name and cookie
-						msg.State = inv.load_chkpt( data )
+						if is_replay() {
+							msg.State = inv.load_replay( )		// inventory comes from the snapshot
+						} else {
+							msg.State = inv.load_chkpt( data )
+							inv.start_recovery( my_chan )		// admission of what was held continues in the background
+						}
 						msg.Response_data = nil
 						rm_sheep.Baa( 1, "checkpoint file loaded" )
 
@@ -1170,25 +1980,36 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 						msg.State = nil							// right now this cannot fail in ways we know about
 						msg.Response_data = ""
 						inv.pause_on()
-						res_refresh = 0;						// must force a push of everything on next push tickle
+						if pause_queue {						// queues change, flow-mods don't; a new queue map does it
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )
+						} else {
+							res_refresh = 0;					// must force a push of everything on next push tickle
+						}
 						rm_sheep.Baa( 1, "pausing..." )
 
 					case REQ_RESUME:
 						msg.State = nil							// right now this cannot fail in ways we know about
 						msg.Response_data = ""
-						res_refresh = 0;						// must force a push of everything on next push tickle
 						inv.pause_off()
+						if pause_queue {
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )
+						} else {
+							res_refresh = 0;					// must force a push of everything on next push tickle
+						}
 
 					case REQ_SETQUEUES:							// driven about every second to reset the queues if a reservation state has changed
 						now := time.Now().Unix()
 						if now > last_qcheck  &&  inv.any_concluded( now - last_qcheck ) || inv.any_commencing( now - last_qcheck, 0 ) {
 							rm_sheep.Baa( 1, "channel states: rm=%d rmlu=%d fq=%d net=%d agent=%d", len( rmgr_ch ), len( rmgrlu_ch ), len( fq_ch ), len( nw_ch ), len( am_ch ) )
 							rm_sheep.Baa( 1, "reservation state change detected, requesting queue map from net-mgr" )
-							tmsg := ipc.Mk_chmsg( )
-							tmsg.Send_req( nw_ch, my_chan, queue_gen_type, time.Now().Unix(), nil )		// get a queue map; when it arrives we'll push to fqmgr and trigger flow-mod push
+							net_prov.Post( queue_gen_type, time.Now().Unix(), my_chan )		// get a queue map; when it arrives we'll push to fqmgr and trigger flow-mod push
 						}
 						last_qcheck = now
 
+						if inv.maint_tick( now ) {				// a maintenance window closed; push what it held
+							net_prov.Post( queue_gen_type, now, my_chan )
+						}
+
 					case REQ_PUSH:								// driven every few seconds to check for need to refresh because of switch max timeout setting
 						if hto_limit > 0 {						// if reservation flow-mods are capped with a hard timeout limit
 							now := time.Now().Unix()
@@ -1222,6 +2043,9 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 						rm_sheep.Baa( 1, "received queue map from network manager" )
 
 						qlist := msg.Response_data.( []string )							// get the qulist map for our use first
+						if qts, ok := msg.Req_data.( int64 ); ok {
+							inv.note_qmap( qlist, qts )									// for the consistency check
+						}
 						if send_meta_counter >= 200 {
 							send_meta_fmods( qlist, alt_table )								// push meta rules
 							send_meta_counter = 0
@@ -1231,7 +2055,7 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 
 						msg.Response_ch = nil											// immediately disable to prevent loop
 						fq_data := make( []interface{}, 1 )
-						fq_data[FQ_QLIST] = msg.Response_data
+						fq_data[FQ_QLIST] = inv.pause_queues( qlist )					// paused reservations get best-effort queues in queue pause mode
 						tmsg := ipc.Mk_chmsg( )
 						tmsg.Send_req( fq_ch, nil, REQ_SETQUEUES, fq_data, nil )		// send the queue list to fq manager to deal with
 
@@ -1266,5 +2090,9 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 		if msg.Response_ch != nil {			// if a response channel was provided
 			msg.Response_ch <- msg			// send our result back to the requester
 		}
+
+		if len( inv.watches ) > 0 {
+			inv.check_watches( )
+		}
 	}
 }
@@ -0,0 +1,143 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_acct
+	Abstract:	Accounting (chargeback/showback) records for bandwidth reservations. A record
+				is written to the accounting sink when a bandwidth or oneway reservation is
+				deleted, or when it expires naturally. The record contains the tenant, the
+				amount of bandwidth, the requested and actual time that the reservation was
+				in force, and the path length.
+
+				Tegu does not collect traffic counters, so usage is expressed as the amount
+				of bandwidth committed over the time that the reservation was actually
+				active (committed_bytes), which is what the guarantee costs the provider.
+
+	CFG:		resmgr:acct_sink - sink spec (file:/path, /path or http[s]://url); records are not
+					generated when not set.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Rejected reservations are accounted as rejected, with no active time, rather
+					than deleted.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Return the tenant (project) portion of a project/host name.
+*/
+func acct_tenant( h *string ) ( string ) {
+	if h == nil {
+		return ""
+	}
+
+	toks := strings.Split( *h, "/" )
+	switch len( toks ) {
+		case 1:		return ""
+		case 2:		return toks[0]
+		default:	return toks[len( toks ) - 2]				// token/project/host
+	}
+}
+
+/*
+	Build the accounting record for the pledge. Reason is deleted, expired, rejected (not approved)
+	or refused (cross-tenant consent not given). Ended is the time that the reservation actually stopped; used to compute the active time when a reservation
+	is deleted before its expiry. An empty string is returned for pledges that do not reserve bandwidth.
+*/
+func acct_rec( p *gizmos.Pledge, reason string, ended int64 ) ( string ) {
+	var (
+		h1			*string
+		h2			*string
+		bw_in		int64
+		bw_out		int64
+		path_len	int
+	)
+
+	switch pldg := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			h1, h2 = pldg.Get_hosts()
+			bw_in = pldg.Get_bandw_in()
+			bw_out = pldg.Get_bandw_out()
+			if pl := pldg.Get_path_list(); len( pl ) > 0 && pl[0] != nil {
+				path_len = pl[0].Get_nlinks()
+			}
+
+		case *gizmos.Pledge_bwow:
+			h1, h2 = pldg.Get_hosts()
+			bw_out = pldg.Get_bandwidth()
+
+		case *gizmos.Pledge_mcast:
+			h1, h2 = pldg.Get_hosts()								// h2 is the group
+			bw_out = pldg.Get_bandwidth()
+			if pl := pldg.Get_path_list(); len( pl ) > 0 && pl[0] != nil {
+				path_len = pl[0].Get_nlinks()
+			}
+
+		default:
+			return ""
+	}
+
+	ptype := gizmos.Pledge_kind_name( *p )
+	commence, expiry := (*p).Get_window()
+	if ended > expiry {
+		ended = expiry
+	}
+	active := ended - commence
+	if active < 0 {
+		active = 0
+	}
+
+	return fmt.Sprintf( `{ "type": "accounting", "id": %q, "cid": %q, "ptype": %q, "tenant": %q, "host1": %q, "host2": %q, "bandw_in": %d, "bandw_out": %d, "commence": %d, "expiry": %d, "ended": %d, "duration": %d, "active": %d, "path_len": %d, "committed_bytes": %d, "reason": %q }`,
+			*(*p).Get_id(), (*p).Get_cid(), ptype, acct_tenant( h1 ), *h1, *h2, bw_in, bw_out, commence, expiry, ended, expiry - commence, active, path_len, ((bw_in + bw_out) / 8) * active, reason )
+}
+
+/*
+	Write the accounting record for the pledge if there is a sink. A pledge is accounted for
+	only once; deleted pledges are remembered so that the record is not generated again
+	when they expire. A rejected or refused pledge is accounted for before it is deleted so
+	that it isn't recorded as deleted. A pledge still awaiting approval or consent was never
+	in force, so its active time is 0.
+*/
+func (inv *Inventory) account( name string, p *gizmos.Pledge, reason string ) {
+	if acct_sink == nil || p == nil || inv.accounted[name] || strings.HasSuffix( name, ".yank" ) {
+		return
+	}
+
+	ended := time.Now().Unix()
+	if (*p).Is_awaiting_approval() {
+		ended, _ = (*p).Get_window()
+	}
+	if rec := acct_rec( p, reason, ended ); rec != "" {
+		acct_sink.send( rec )
+		rm_sheep.Baa( 2, "accounting record written for %s: %s", name, reason )
+	}
+	inv.accounted[name] = true
+}
@@ -0,0 +1,148 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_approve
+	Abstract:	Two phase admission. When an approval threshold is configured, bandwidth and
+				oneway reservations which ask for more than the threshold are added to the
+				inventory (and hold their capacity in the network) but are marked as awaiting
+				approval and are not pushed. An admin approves (pushed as normal) or rejects
+				(cancelled) them with the approve and reject API requests. Reservations that are
+				not acted on within the approval timeout are rejected.
+
+				The awaiting state is checkpointed; the time that the reservation started to
+				wait is not, so following a restart the timeout starts again.
+
+				Events are published for each transition: reservation.awaiting_approval,
+				reservation.approved, reservation.rejected and reservation.approval_expired.
+
+	CFG:		resmgr:approval_threshold - total bandwidth (e.g. 1G) above which approval is needed (0 disables)
+				resmgr:approval_timeout - seconds a reservation may wait for approval (3600)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Reservations waiting for cross-tenant consent can't be approved.
+				16 Oct 2026 - Rejected reservations get a rejected accounting record rather than deleted.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Return the total amount of bandwidth that the pledge reserves; 0 for types that don't.
+*/
+func pledge_bandwidth( p *gizmos.Pledge ) ( int64 ) {
+	switch pldg := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			return pldg.Get_bandw()
+
+		case *gizmos.Pledge_bwow:
+			return pldg.Get_bandwidth()
+
+		case *gizmos.Pledge_mcast:
+			return pldg.Get_bandwidth()
+	}
+
+	return 0
+}
+
+/*
+	If the newly added pledge is over the threshold, mark it as awaiting approval. Returns
+	true if the pledge must wait.
+*/
+func (inv *Inventory) hold_for_approval( p *gizmos.Pledge, threshold int64 ) ( bool ) {
+	if threshold <= 0 || pledge_bandwidth( p ) <= threshold {
+		return false
+	}
+
+	(*p).Set_awaiting_approval( true )
+	inv.awaiting[*(*p).Get_id()] = time.Now().Unix()
+	rm_sheep.Baa( 1, "reservation %s is awaiting approval: bandwidth %d exceeds %d", *(*p).Get_id(), pledge_bandwidth( p ), threshold )
+	publish_event( "reservation.awaiting_approval", (*p).To_json() )
+
+	return true
+}
+
+/*
+	Approve or reject the named reservation.
+*/
+func (inv *Inventory) approve( name *string, approved bool ) ( err error ) {
+	p := inv.cache[*name]
+	if p == nil || ! (*p).Is_awaiting_approval() || (*p).Is_expired() {
+		return fmt.Errorf( "no reservation awaiting approval with name: %s", *name )
+	}
+	if (*p).Get_consent() != "" {
+		return fmt.Errorf( "reservation %s is awaiting consent from project %s, not approval", *name, (*p).Get_consent() )
+	}
+
+	delete( inv.awaiting, *name )
+	if approved {
+		(*p).Set_awaiting_approval( false )
+		if ! (*p).Is_paused() {								// paused pledges are flagged as pushed; leave that alone
+			(*p).Reset_pushed()
+		}
+		rm_sheep.Baa( 1, "reservation %s was approved", *name )
+		publish_event( "reservation.approved", (*p).To_json() )
+		return nil
+	}
+
+	inv.account( *name, p, "rejected" )					// before delete so it isn't accounted as deleted
+	err = inv.Del_res( name, super_cookie )				// still flagged as awaiting so nothing is pushed before it expires
+	rm_sheep.Baa( 1, "reservation %s was rejected", *name )
+	publish_event( "reservation.rejected", (*p).To_json() )
+	return
+}
+
+/*
+	Reject reservations that have waited too long. Pledges that are awaiting approval but
+	aren't being timed (loaded from a checkpoint) start their wait now.
+*/
+func (inv *Inventory) expire_awaiting( timeout int64 ) {
+	now := time.Now().Unix()
+	for name, p := range inv.cache {
+		if p == nil || ! (*p).Is_awaiting_approval() || (*p).Is_expired() || (*p).Get_consent() != "" {		// consent waits are timed separately
+			delete( inv.awaiting, name )
+			continue
+		}
+
+		since, ok := inv.awaiting[name]
+		if !ok {
+			inv.awaiting[name] = now
+			continue
+		}
+
+		if now - since > timeout {
+			rm_sheep.Baa( 1, "reservation %s waited more than %ds for approval and was rejected", name, timeout )
+			publish_event( "reservation.approval_expired", (*p).To_json() )
+			delete( inv.awaiting, name )
+			nm := name
+			inv.account( nm, p, "rejected" )
+			inv.Del_res( &nm, super_cookie )
+		}
+	}
+}
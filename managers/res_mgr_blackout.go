@@ -0,0 +1,139 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_blackout
+	Abstract:	Blackout periods: site defined intervals during which reservations may not be
+				active (gizmos/blackout.go gives the forms). What happens to a request whose
+				window overlaps a blackout depends on the policy:
+					reject - the reservation is refused as it is added to the inventory
+					split  - a bandwidth reservation is split into one reservation for each
+							 part of the window outside of the blackouts; other types are refused
+
+				Blackouts are given in the config as a space separated list of name=spec, for example:
+					upgrades=weekly@sun@02:00+4h backup=daily@23:30+30m freeze=1798761600-1799366400
+
+				Reservations already in the inventory (from a checkpoint) are not affected, nor is
+				extending one. The calendar request lists the blackouts for users to plan around.
+
+	CFG:		resmgr:blackouts - list of blackout periods (none)
+				resmgr:blackout_policy - reject or split (reject)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"strings"
+
+	"github.com/att/tegu/gizmos"
+)
+
+const blackout_max_split int = 32					// more pieces than this and the request is refused rather than split
+
+var blackout_split bool = false						// split rather than reject bandwidth reservations which overlap
+
+/*
+	Load the blackouts from the config and set the policy.
+*/
+func blackout_init( ) {
+	list := make( []*gizmos.Blackout, 0 )
+	if cfg_data["resmgr"] == nil {
+		gizmos.Set_blackouts( list )
+		return
+	}
+
+	if p := cfg_data["resmgr"]["blackouts"]; p != nil {
+		for _, nspec := range strings.Fields( *p ) {
+			toks := strings.SplitN( nspec, "=", 2 )
+			if len( toks ) != 2 {
+				rm_sheep.Baa( 0, "WRN: resmgr:blackouts: expected name=spec: %s  [TGURMG027]", nspec )
+				continue
+			}
+
+			b, err := gizmos.Mk_blackout( toks[0], toks[1] )
+			if err != nil {
+				rm_sheep.Baa( 0, "WRN: resmgr:blackouts: %s  [TGURMG027]", err )
+				continue
+			}
+			list = append( list, b )
+		}
+	}
+
+	if p := cfg_data["resmgr"]["blackout_policy"]; p != nil {
+		blackout_split = *p == "split"
+	}
+
+	gizmos.Set_blackouts( list )
+	rm_sheep.Baa( 1, "%d blackout periods loaded from the config; policy=%s", len( list ), blackout_policy() )
+}
+
+func blackout_policy( ) ( string ) {
+	if blackout_split {
+		return "split"
+	}
+	return "reject"
+}
+
+/*
+	Refuse the pledge if its window overlaps a blackout. Under the split policy a bandwidth
+	pledge will already have been split by the http side so any that gets here overlapping
+	one is of another type.
+*/
+func check_blackout( p *gizmos.Pledge ) ( error ) {
+	c, e := (*p).Get_window()
+	name, bs, be := gizmos.Blackout_check( c, e )
+	if name == "" {
+		return nil
+	}
+
+	rm_sheep.Baa( 1, "reservation %s refused: window overlaps blackout %s (%d-%d)", *(*p).Get_id(), name, bs, be )
+	return mk_err( ERR_BAD_REQUEST, "reservation rejected: the window overlaps blackout %s (%d-%d); see the calendar request", name, bs, be )
+}
+
+/*
+	Return the windows that a bandwidth reservation for commence-expiry is to be split into
+	under the split policy. Nil is returned if no split is needed: the policy is reject, or no
+	blackout overlaps the window. An error is returned if blackouts cover the window, or it
+	would be split into too many pieces.
+*/
+func blackout_pieces( commence int64, expiry int64 ) ( wins [][2]int64, err error ) {
+	if ! blackout_split {
+		return nil, nil
+	}
+	if name, _, _ := gizmos.Blackout_check( commence, expiry ); name == "" {
+		return nil, nil
+	}
+
+	wins = gizmos.Blackout_split( commence, expiry )
+	if len( wins ) == 0 {
+		return nil, mk_err( ERR_BAD_REQUEST, "the window is within blackout periods; see the calendar request" )
+	}
+	if len( wins ) > blackout_max_split {
+		return nil, mk_err( ERR_BAD_REQUEST, "blackouts would split the window into more than %d reservations", blackout_max_split )
+	}
+
+	return wins, nil
+}
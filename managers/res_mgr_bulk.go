@@ -0,0 +1,198 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_bulk
+	Abstract:	Bulk (deadline) transfers. A bulk request asks for a number of bytes to be moved
+				between two hosts before a deadline rather than for a bandwidth; the http side
+				works out the rate and window that fit (http_bulk.go) and the result is an
+				ordinary bandwidth reservation which also carries the byte count.
+
+				Fq-mgr meters the bytes sent by the reservation's flow-mods (fq_bulkmeter.go)
+				and gives res-mgr the bytes moved since the last count. As each count arrives:
+
+					- when the bytes moved reach the count the reservation is deleted, so that
+					  the bandwidth is released before the deadline (reservation.bulk_complete);
+
+					- otherwise the rate needed to move what remains by the deadline (plus the
+					  margin) is computed, and if it is more than the reservation has the rate
+					  is raised: the reservation is released and admitted again with the new
+					  rate; if that doesn't fit it is put back as it was. The rate is not
+					  raised beyond the ceiling of the project's tier (res_mgr_tiers.go).
+					  Reservation.bulk_raised or reservation.bulk_behind is published.
+
+				The rate is never lowered; a transfer which is ahead just finishes early.
+
+	CFG:		resmgr:bulk_margin - percentage added to the rate needed to meet the deadline (10)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Return the percentage added to the rate that a bulk transfer needs. The config is read
+	only, so this is safe from any goroutine.
+*/
+func bulk_margin( ) ( int64 ) {
+	if cfg_data["resmgr"] != nil {
+		if p := cfg_data["resmgr"]["bulk_margin"]; p != nil {
+			if m := clike.Atoi64( *p ); m >= 0 {
+				return m
+			}
+		}
+	}
+
+	return 10
+}
+
+/*
+	Return the rate (bits/sec) needed to move the bytes in the seconds given, with the
+	margin added.
+*/
+func bulk_rate( nbytes int64, secs int64 ) ( int64 ) {
+	if secs <= 0 {
+		secs = 1
+	}
+
+	rate := (nbytes * 8 + secs - 1) / secs
+	return rate + (rate * bulk_margin( )) / 100
+}
+
+/*
+	Add the bytes moved by each bulk transfer (by reservation id) and complete or raise the
+	rate of those that need it. Returns the number of reservations changed; a new queue
+	map and push is needed if this isn't zero.
+*/
+func (inv *Inventory) bulk_usage( moved map[string]int64 ) ( n int ) {
+	now := time.Now().Unix()
+
+	for name, nb := range moved {
+		gp := inv.cache[name]
+		if gp == nil || (*gp).Is_expired() {
+			continue
+		}
+		p, ok := (*gp).( *gizmos.Pledge_bw )
+		if ! ok {
+			continue
+		}
+		total, _ := p.Get_bulk()
+		if total <= 0 {
+			continue
+		}
+
+		done := p.Add_bulk_moved( nb )
+		rm_sheep.Baa( 2, "bulk transfer %s: %d of %d bytes moved", name, done, total )
+		if done >= total {
+			nm := name
+			publish_event( "reservation.bulk_complete", fmt.Sprintf( `{ "id": %q, "name": %q, "bytes": %d, "moved": %d }`, name, inv.res_label( name ), total, done ) )
+			if err := inv.Del_res( &nm, super_cookie ); err != nil {
+				rm_sheep.Baa( 1, "bulk transfer %s complete, but the reservation could not be deleted: %s", name, err )
+				continue
+			}
+			rm_sheep.Baa( 1, "bulk transfer %s complete: %d bytes moved; reservation released", name, done )
+			n++
+			continue
+		}
+
+		if ! (*gp).Is_paused() && inv.bulk_pace( name, gp, p, total - done, now ) {
+			n++
+		}
+	}
+
+	return n
+}
+
+/*
+	Raise the rate of a bulk transfer if what remains can't be moved by the deadline at its
+	current rate. Returns true if the reservation was admitted again (a push is needed).
+*/
+func (inv *Inventory) bulk_pace( name string, gp *gizmos.Pledge, p *gizmos.Pledge_bw, remain int64, now int64 ) ( bool ) {
+	_, expiry := p.Get_window()
+	if expiry <= now {
+		return false
+	}
+
+	old_in := p.Get_bandw_in()
+	old_out := p.Get_bandw_out()
+	rate := old_out
+	if old_in > rate {
+		rate = old_in
+	}
+
+	need := bulk_rate( remain, expiry - now )
+	if need <= rate {
+		return false
+	}
+
+	nrate := inv.tier_for( pledge_tenant( gp ) ).clamp( need )
+	if nrate > rate {
+		if req := nw_req( REQ_DEL, p, nil ); req.State != nil {				// must release before the rate changes
+			rm_sheep.Baa( 1, "bulk transfer %s: network release failed: %s", name, req.State )
+		}
+
+		p.Set_bandw( nrate, nrate )
+		k := gizmos.Pledge_kind_of( *gp )
+		err := k.Admit( gp )
+		if err == nil {
+			(*gp).Reset_pushed()
+			inv.idx.add( name, gp )
+			rm_sheep.Baa( 1, "bulk transfer %s behind: rate raised %d -> %d to move %d bytes in %ds", name, rate, nrate, remain, expiry - now )
+			publish_event( "reservation.bulk_raised", fmt.Sprintf( `{ "id": %q, "name": %q, "remaining": %d, "old_rate": %d, "rate": %d }`, name, inv.res_label( name ), remain, rate, nrate ) )
+			return true
+		}
+
+		p.Set_bandw( old_in, old_out )										// it fitted before, so this is expected to work
+		if rerr := k.Admit( gp ); rerr != nil {
+			rm_sheep.Baa( 0, "WRN: bulk transfer %s could not be restored after a failed rate increase; moved to retry queue: %s  [TGURMG024]", name, rerr )
+			delete( inv.cache, name )
+			inv.idx.drop( name )
+			inv.Add_retry( gp )
+			return true
+		}
+		(*gp).Reset_pushed()
+		inv.idx.add( name, gp )
+		rm_sheep.Baa( 1, "bulk transfer %s behind: rate could not be raised to %d: %s", name, nrate, err )
+		inv.bulk_behind( name, remain, rate, need )
+		return true												// path may be different after the restore
+	}
+
+	inv.bulk_behind( name, remain, rate, need )
+	return false
+}
+
+/*
+	Publish that a transfer can't meet its deadline at the rate it has.
+*/
+func (inv *Inventory) bulk_behind( name string, remain int64, rate int64, need int64 ) {
+	publish_event( "reservation.bulk_behind", fmt.Sprintf( `{ "id": %q, "name": %q, "remaining": %d, "rate": %d, "needed": %d }`, name, inv.res_label( name ), remain, rate, need ) )
+}
@@ -35,6 +35,14 @@
 						a reservation.
 				06 Mar 2016 - Don't send channel to fq-mgr as it only ever responded to requests
 						sent to skoogi.
+				16 Oct 2026 - Set priority bump on fq requests for handover support.
+				16 Oct 2026 - Set rate on fq requests for the ovn backend.
+				16 Oct 2026 - Carry the correlation id to fq-mgr.
+				16 Oct 2026 - Short expiry when paused only in expiry pause mode.
+				16 Oct 2026 - Inter-switch legs added to fq requests for physical switch limits.
+				16 Oct 2026 - Fq requests of bulk transfers are marked so that their bytes are metered.
+				16 Oct 2026 - Switch/port/queues programmed are recorded on the pledge.
+				16 Oct 2026 - Single switch taken from the path; nothing sent for a local path.
 */
 
 package managers
@@ -87,7 +95,7 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 		return
 	}
 
-	h1, h2, p1, p2, _, expiry, _, _ := p.Get_values( )		// hosts, transport (tcp/udp) ports and expiry are all we need
+	h1, h2, p1, p2, _, expiry, bw_in, bw_out := p.Get_values( )		// hosts, transport (tcp/udp) ports, expiry and rates (ovn backend)
 	v1, v2 := p.Get_vlan( )									// vlan match criteria for one/both endpoints
 
 	ip1 := name2ip( h1 )
@@ -96,18 +104,32 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 	if ip1 != nil  &&  ip2 != nil {				// good ip addresses so we're good to go
 		plist := p.Get_path_list( )				// each path that is a part of the reservation
 
-		timestamp := time.Now().Unix() + 16					// assume this will fall within the first few seconds of the reservation as we use it to find queue in timeslice
+		timestamp := queue_ts( *gp )						// falls within the reservation's timeslice even when pushed before commence
+		p.Reset_touched( )									// what is programmed is recorded as the requests are sent (see Get_touched)
 
 		for i := range plist { 								// for each path, send fmgr requests for each endpoint
+			if plist[i].Is_local() {						// hosts behind one switch port; nothing we can queue
+				sw := ""
+				if ids := plist[i].Get_switch_ids(); len( ids ) > 0 {
+					sw = ids[0]
+				}
+				rm_sheep.Baa( 2, "res_mgr/push_res: path %d of %s is local to a port on %s; no flow-mods", i, *rname, sw )
+				p.Add_touched( gizmos.Mk_spq( sw, -1, 0 ), gizmos.TOUCH_LOCAL, plist[i].Get_h1().Get_address( pref_v6 ), plist[i].Get_h2().Get_address( pref_v6 ), 0 )
+				continue
+			}
+
 			freq := Mk_fqreq( rname )						// default flow mod request with empty match/actions (for bw requests, we don't need priority or such things)
 
 			freq.Ipv6 = p.Get_matchv6()						// should we force a match on IPv6 rather than IPv4?
 			freq.Cookie =	0xffff							// should be ignored, if we see this out there we've got problems
-			freq.Single_switch = false						// path involves multiple switches by default
+			freq.Single_switch = plist[i].Is_single_switch()	// both hosts on one switch; traffic never reaches br-rl
 			freq.Dscp, freq.Dscp_koe = p.Get_dscp()			// reservation supplied dscp value that we're to match and maybe preserve on exit
+			freq.Pbump = p.Get_pbump()						// non-zero when the pledge was created as a handover replacement
+			nbytes, _ := p.Get_bulk()
+			freq.Bulk = nbytes > 0							// fq-mgr meters the bytes sent by a bulk transfer
 
-			if (*p).Is_paused( ) {
-				freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force the flow-mods out
+			if pause_by_expiry( *gp ) {
+				freq.Expiry = pause_expiry( *gp )			// if reservation shows paused, then we set a short expiration which should force the flow-mods out
 			} else {
 				if to_limit > 0 && expiry > now + to_limit {
 					freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
@@ -116,6 +138,7 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 				}
 			}
 			freq.Id = rname
+			freq.Cid = p.Get_cid()
 
 			extip := plist[i].Get_extip()					// if an external IP address is necessary on the freq get it
 			if extip != nil {
@@ -124,11 +147,6 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 				freq.Extip = &empty_str
 			}
 
-			espq1, _ := plist[i].Get_endpoint_spq( rname, timestamp )		// end point switch, port, queue information; ep1 nil if single switch
-			if espq1 == nil {												// if single switch ep1 will be nil
-				freq.Single_switch = true
-			}
-
 			freq.Match.Ip1 = plist[i].Get_h1().Get_address( pref_v6 )		// must use path h1/h2 as this could be the reverse with respect to the overall pledge and thus reverse of pledge
 			freq.Match.Ip2 = plist[i].Get_h2().Get_address( pref_v6 )
 			freq.Espq = plist[i].Get_ilink_spq( rname, timestamp )			// spq info comes from the first link off of the switch, not the endpoint link back to the VM
@@ -136,6 +154,7 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 				freq.Espq.Queuenum = 1										// same switch always over br-rl queue 1
 			}
 			freq.Exttyp = plist[i].Get_extflag()		// indicates whether the external IP is the source or dest along this path
+			freq.Legs = plist[i].Get_forward_im_spq( timestamp )			// inter-switch legs; used only if physical switches are managed
 
 			tptype_list := p.Get_proto()								// pick up protocol supplied on the reservation
 			if (*p1 != "0" || *p2 != "0") && *tptype_list == "" {		// if either port is specified, and no specific proto on reservation
@@ -153,10 +172,12 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 					cfreq.Match.Tpsport= p2
 					cfreq.Match.Tpdport= p1
 					cfreq.Match.Vlan_id= v2
+					cfreq.Rate = bw_in
 				} else {
 					cfreq.Match.Tpsport= p1
 					cfreq.Match.Tpdport= p2
 					cfreq.Match.Vlan_id= v1
+					cfreq.Rate = bw_out
 				}
 
 				rm_sheep.Baa( 1, "res_mgr/push_rea: forward endpoint flow-mods for path %d: %s flag=%s tptyp=%s VMs=%s,%s dir=%s->%s tpsport=%s  tpdport=%s  spq=%s/%d/%d ext=%s exp/fm_exp=%d/%d",
@@ -169,6 +190,15 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 	
 				// WARNING:  this is q-lite only -- there is no attempt to set up intermediate switches!
 			}
+
+			if freq.Single_switch {
+				p.Add_touched( freq.Espq, gizmos.TOUCH_SAME, freq.Match.Ip1, freq.Match.Ip2, len( tptype_toks ) )
+			} else {
+				p.Add_touched( freq.Espq, gizmos.TOUCH_ENDPOINT, freq.Match.Ip1, freq.Match.Ip2, len( tptype_toks ) )
+				for _, leg := range freq.Legs {						// no flow-mods; listed so that a path's legs can be checked
+					p.Add_touched( leg, gizmos.TOUCH_LEG, freq.Match.Ip1, freq.Match.Ip2, 0 )
+				}
+			}
 		}
 
 		p.Set_pushed()				// safe to mark the pledge as having been pushed.
@@ -220,8 +250,8 @@ func bwow_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_lim
 			freq.Dscp = p.Get_dscp()						// reservation supplied dscp value that we're to match (koe is meaningless in one way)
 			freq.Dscp_koe = false							// meaningless for oneway, but ensure it's false so flag isn't accidently set later
 
-			if (*p).Is_paused( ) {
-				freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force existing flow-mods out
+			if pause_by_expiry( *gp ) {
+				freq.Expiry = pause_expiry( *gp )			// if reservation shows paused, then we set a short expiration which should force existing flow-mods out
 			} else {
 				if to_limit > 0 && expiry > now + to_limit {
 					freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
@@ -230,11 +260,13 @@ func bwow_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_lim
 				}
 			}
 			freq.Id = rname
+			freq.Cid = p.Get_cid()
 
 			freq.Match.Ip1 = gate.Get_src().Get_address( pref_v6 )		// should match pledge, but gate is the ultimate authority
 			freq.Match.Ip2 = gate.Get_dest().Get_address( pref_v6 )
-			freq.Espq = gate.Get_spq( rname, now + 16 )					// switch port queue
+			freq.Espq = gate.Get_spq( rname, queue_ts( *gp ) )			// switch port queue
 			freq.Extip = gate.Get_extip( )								// returns nil if not an external and that's what we need
+			freq.Rate = p.Get_bandwidth( )
 
 			tptype_list := p.Get_proto()											// pick up protocol supplied on the reservation
 			if (*src_tpport != "0" || *dest_tpport != "0") && *tptype_list == ""  {	// if port supplied we must set proto; default to both if
@@ -264,6 +296,9 @@ func bwow_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_lim
 				msg.Send_req( fq_ch, nil, REQ_BWOW_RESERVE, cfreq, nil )					// queue work with fq-manger to send cmds for bandwidth f-mod setup
 				
 			}
+
+			p.Reset_touched( )
+			p.Add_touched( freq.Espq, gizmos.TOUCH_ENDPOINT, freq.Match.Ip1, freq.Match.Ip2, len( tptype_toks ) )
 		}
 
 		p.Set_pushed()				// safe to mark the pledge as having been pushed.
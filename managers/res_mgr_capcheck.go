@@ -0,0 +1,236 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_capcheck
+	Abstract:	Over-capacity consistency check. Now and again res_mgr totals the bandwidth of
+				the active reservations on each link (from the reservations' paths) and sends
+				the totals, with the ids of the reservations that contribute, to network
+				manager. Network compares them with each link's reservable capacity and also
+				checks its own obligation for the link; either exceeding the capacity means an
+				accounting bug (or that something was changed by hand) and a critical log
+				message and a capacity.exceeded event, listing the reservations, are generated.
+
+				Res_mgr doesn't wait for the check; nothing is returned.
+
+				When network learns that a link's capacity dropped below its obligation (a bond
+				member went down, see network_inv.go) the reservations using the link are
+				readmitted; those which no longer fit are moved to the retry queue. When cap_drop
+				is set to flag the reservations are left as they are and a reservation.oversubscribed
+				event is published for each instead, leaving it to the operator to sort out.
+
+	CFG:		resmgr:cap_check - seconds between checks; 0 disables (300)
+				resmgr:cap_drop - repath or flag; what is done with the reservations on a link whose
+					capacity dropped below its obligation (repath)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Added link_recheck().
+				16 Oct 2026 - Reservations on a dropped link can be flagged rather than readmitted.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Bandwidth of active reservations on one link.
+*/
+type link_use struct {
+	bw		int64
+	ids		[]string
+}
+
+/*
+	Add the pledge's paths to the link totals. A link that appears on more than one path of
+	the same pledge (multicast tree) is counted once as the network does.
+*/
+func add_link_use( use map[string]*link_use, id string, plist []*gizmos.Path ) {
+	seen := make( map[string]bool )
+	for _, path := range plist {
+		bw := path.Get_bandwidth()
+		for _, lid := range path.Get_link_ids() {
+			if seen[lid] {
+				continue
+			}
+			seen[lid] = true
+
+			lu := use[lid]
+			if lu == nil {
+				lu = &link_use{ ids: make( []string, 0, 4 ) }
+				use[lid] = lu
+			}
+			lu.bw += bw
+			lu.ids = append( lu.ids, id )
+		}
+	}
+}
+
+/*
+	Total the bandwidth of active reservations on each link.
+*/
+func (inv *Inventory) link_usage( ) ( map[string]*link_use ) {
+	use := make( map[string]*link_use )
+	for id, p := range inv.cache {
+		if p == nil || ! (*p).Is_active() {
+			continue
+		}
+
+		switch pldg := (*p).(type) {
+			case *gizmos.Pledge_bw:
+				add_link_use( use, id, pldg.Get_path_list() )
+
+			case *gizmos.Pledge_mcast:
+				add_link_use( use, id, pldg.Get_path_list() )
+		}
+	}
+
+	return use
+}
+
+/*
+	Network side: compare the totals, and the network's obligation, with each link's capacity.
+	Returns the number of links over capacity.
+*/
+func (n *Network) cap_check( use map[string]*link_use ) ( nbad int ) {
+	if n == nil {
+		return 0
+	}
+
+	now := time.Now().Unix()
+	for lid, l := range n.links {
+		ob := l.Get_allotment()
+		if ob == nil {
+			continue
+		}
+
+		max := ob.Get_max_capacity()
+		obligated := l.Get_allocation( now )
+		var reserved int64 = 0
+		ids := []string{}
+		if lu := use[lid]; lu != nil {
+			reserved = lu.bw
+			ids = lu.ids
+		}
+
+		if reserved <= max && obligated <= max {
+			continue
+		}
+
+		nbad++
+		sort.Strings( ids )
+		net_sheep.Baa( 0, "CRI: link over capacity: %s capacity=%d reserved=%d obligated=%d reservations=%v  [TGUNET012]", lid, max, reserved, obligated, ids )
+		publish_event( "capacity.exceeded", fmt.Sprintf( `{ "link": %q, "capacity": %d, "reserved": %d, "obligated": %d, "reservations": %s }`, lid, max, reserved, obligated, ids2json( ids ) ) )
+	}
+
+	if nbad == 0 {
+		net_sheep.Baa( 2, "capacity check: no links over capacity" )
+	}
+	return nbad
+}
+
+/*
+	Readmit the active, or pending, reservations with a path over any of the links. All are
+	released first, then the smallest are readmitted first so that the most reservations fit. Returns the number
+	readmitted (including those moved to the retry queue). If repath is false the reservations are only
+	flagged (logged and an event published) and 0 is returned.
+*/
+func (inv *Inventory) link_recheck( lids []string, repath bool ) ( n int ) {
+	links := make( map[string]bool, len( lids ) )
+	for _, lid := range lids {
+		links[lid] = true
+	}
+
+	names := []string{}
+	for name, p := range inv.cache {
+		if p == nil || (*p).Is_expired() || strings.HasSuffix( name, ".yank" ) {
+			continue
+		}
+
+		for _, lid := range pledge_link_ids( p ) {
+			if links[lid] {
+				names = append( names, name )
+				break
+			}
+		}
+	}
+
+	sort.Strings( names )
+	for i := 1; i < len( names ); i++ {			// smallest first; few, so insertion sort is fine
+		for j := i; j > 0 && pledge_bandwidth( inv.cache[names[j]] ) < pledge_bandwidth( inv.cache[names[j-1]] ); j-- {
+			names[j], names[j-1] = names[j-1], names[j]
+		}
+	}
+
+	if ! repath {
+		for _, name := range names {
+			over := []string{}
+			for _, lid := range pledge_link_ids( inv.cache[name] ) {
+				if links[lid] {
+					over = append( over, fmt.Sprintf( "%q", lid ) )
+				}
+			}
+
+			rm_sheep.Baa( 0, "WRN: reservation is on a link whose capacity dropped below its obligation: %s links=%s  [TGURMG017]", name, strings.Join( over, "," ) )
+			publish_event( "reservation.oversubscribed", fmt.Sprintf( `{ "id": %q, "name": %q, "links": [ %s ] }`, name, inv.res_label( name ), strings.Join( over, ", " ) ) )
+		}
+
+		return 0
+	}
+
+	for _, name := range names {				// release them all before any is readmitted
+		if req := nw_req( REQ_DEL, *inv.cache[name], nil ); req.State != nil {
+			rm_sheep.Baa( 1, "link recheck: network release failed for %s: %s", name, req.State )
+		}
+	}
+
+	for _, name := range names {
+		p := inv.cache[name]
+		admitted := true
+		if k := gizmos.Pledge_kind_of( *p ); k != nil && k.Admit != nil {
+			if err := k.Admit( p ); err != nil {
+				rm_sheep.Baa( 0, "WRN: reservation no longer fits after link capacity dropped; moved to retry queue: %s: %s  [TGURMG016]", name, err )
+				delete( inv.cache, name )
+				inv.idx.drop( name )
+				inv.Add_retry( p )
+				admitted = false
+			}
+		}
+		if admitted {
+			(*p).Reset_pushed()
+			inv.idx.add( name, p )
+		}
+
+		n++
+		publish_event( "reservation.link_recheck", fmt.Sprintf( `{ "id": %q, "name": %q, "readmitted": %v }`, name, inv.res_label( name ), admitted ) )
+	}
+
+	rm_sheep.Baa( 1, "link recheck: %d reservations on %d links readmitted", n, len( lids ) )
+	return n
+}
@@ -0,0 +1,297 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_chain
+	Abstract:	Service chains: a steering reservation through one or more middleboxes and a
+				bandwidth reservation for each leg of the chain (ep1 to the first middlebox, between
+				middleboxes, and the last middlebox to ep2) created by one request (http_chain.go).
+
+				The chain is not a pledge of its own. Its members are ordinary pledges named for
+				the chain (<chain>.steer, <chain>.leg00, <chain>.leg01...) and each leg depends on
+				the steering reservation (res_mgr_deps.go); the legs are not pushed until the
+				steering flow-mods are, and go when it is deleted or expires. Nothing more than
+				the names is needed to find the chain after a restart.
+
+				Status combines the state of the members. Extend moves the expiry of every member,
+				reserving the legs again for the longer window; if any leg doesn't fit, all of them
+				are put back as they were and the chain isn't changed. Delete removes the steering
+				reservation (and so the legs), or the legs alone if the steering reservation is gone.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Status gives the chain template the chain was made from.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	A service chain request passed to res-mgr.
+*/
+type chain_req struct {
+	op		string						// status, extend or delete
+	id		string						// chain id
+	cookie	*string
+	expiry	int64						// new expiry for extend
+	now		bool						// delete without the grace period (failed create)
+}
+
+/*
+	Names of the chain's members.
+*/
+func chain_steer_id( chain string ) ( string ) {
+	return chain + ".steer"
+}
+
+func chain_leg_id( chain string, n int ) ( string ) {
+	return fmt.Sprintf( "%s.leg%02d", chain, n )
+}
+
+/*
+	Find the members of the chain which haven't expired, steering reservation first then the
+	legs in order. Members on the retry list are included. The cookie must be valid for them.
+*/
+func (inv *Inventory) chain_members( chain string, cookie *string ) ( names []string, err error ) {
+	prefix := chain + "."
+	for name, p := range inv.cache {
+		if p != nil && strings.HasPrefix( name, prefix ) && ! strings.HasSuffix( name, ".yank" ) && ! (*p).Is_expired() {
+			names = append( names, name )
+		}
+	}
+	for name, p := range inv.retry {
+		if p != nil && strings.HasPrefix( name, prefix ) {
+			names = append( names, name )
+		}
+	}
+
+	if len( names ) == 0 {
+		return nil, mk_err( ERR_NOT_FOUND, "cannot find service chain: %s", chain )
+	}
+
+	sort.Strings( names )								// legs sort before steer
+	if sid := chain_steer_id( chain ); names[len( names )-1] == sid {
+		names = append( []string{ sid }, names[0:len( names )-1]... )
+	}
+
+	p := inv.cache[names[0]]
+	if p == nil {
+		p = inv.retry[names[0]]
+	}
+	if ! (*p).Is_valid_cookie( cookie ) && *cookie != *super_cookie {
+		return nil, mk_err( ERR_NOT_AUTHORISED, "not authorised to access service chain: %s", chain )
+	}
+
+	return names, nil
+}
+
+/*
+	Dispatch a chain request. The response is the json status for status, the time that the
+	chain will be deleted (0 if now) for delete, and nil for extend.
+*/
+func (inv *Inventory) chain( cr *chain_req ) ( interface{}, error ) {
+	switch cr.op {
+		case "status":
+			return inv.chain_status( cr.id, cr.cookie )
+
+		case "extend":
+			return nil, inv.chain_extend( cr.id, cr.cookie, cr.expiry )
+
+		case "delete":
+			return inv.chain_delete( cr.id, cr.cookie, cr.now )
+	}
+
+	return nil, mk_err( ERR_BAD_REQUEST, "unknown service chain operation: %s", cr.op )
+}
+
+/*
+	Build the json status of the chain. The chain is DEGRADED if the steering reservation is
+	gone or a member is waiting on the retry list; otherwise its state is that of the steering
+	reservation. Pushed is true only when every member has been pushed.
+*/
+func (inv *Inventory) chain_status( chain string, cookie *string ) ( string, error ) {
+	names, err := inv.chain_members( chain, cookie )
+	if err != nil {
+		return "", err
+	}
+
+	degraded := inv.cache[chain_steer_id( chain )] == nil
+	pushed := true
+	jm := make( []string, 0, len( names ) )
+	for _, name := range names {
+		mstate := "RETRY"
+		mpushed := false
+		p := inv.cache[name]
+		if p != nil {
+			mstate = (*p).Get_state()
+			mpushed = (*p).Is_pushed()
+		} else {
+			p = inv.retry[name]
+			degraded = true
+		}
+		if inv.doomed[name] > 0 {
+			mstate = "DELETE_PENDING"
+		}
+
+		kind := "unknown"
+		if k := gizmos.Pledge_kind_of( *p ); k != nil {
+			kind = k.Name
+		}
+
+		pushed = pushed && mpushed
+		jm = append( jm, fmt.Sprintf( `{ "id": %q, "kind": %q, "state": %q, "pushed": %v }`, name, kind, mstate, mpushed ) )
+	}
+
+	state := "DEGRADED"
+	tmpl := ""
+	if ! degraded {
+		sp := inv.cache[chain_steer_id( chain )]
+		state = (*sp).Get_state()
+		if st, ok := (*sp).( *gizmos.Pledge_steer ); ok {
+			tmpl, _ = st.Get_template()
+		}
+	}
+
+	return fmt.Sprintf( `{ "chain": %q, "template": %q, "state": %q, "pushed": %v, "members": [ %s ] }`, chain, tmpl, state, pushed, strings.Join( jm, ", " ) ), nil
+}
+
+/*
+	Give a leg a new expiry and reserve it again. Release is false when the leg holds nothing
+	in the network (its admission under the new window failed).
+*/
+func (inv *Inventory) rewindow( name string, p *gizmos.Pledge, expiry int64, release bool ) ( error ) {
+	if release {
+		if req := nw_req( REQ_DEL, *p, nil ); req.State != nil {			// must release before the expiry changes
+			rm_sheep.Baa( 1, "service chain: network release failed for %s: %s", name, req.State )
+		}
+	}
+
+	(*p).Set_expiry( expiry )
+	if k := gizmos.Pledge_kind_of( *p ); k != nil && k.Admit != nil {
+		if err := k.Admit( p ); err != nil {
+			return err
+		}
+	}
+
+	(*p).Reset_pushed()
+	inv.idx.add( name, p )
+	return nil
+}
+
+/*
+	Move the expiry of every member of the chain. The legs are reserved again for the new
+	window; if one can't be, those already moved are put back and an error is returned.
+*/
+func (inv *Inventory) chain_extend( chain string, cookie *string, expiry int64 ) ( error ) {
+	names, err := inv.chain_members( chain, cookie )
+	if err != nil {
+		return err
+	}
+
+	sp := inv.cache[chain_steer_id( chain )]
+	if sp == nil {
+		return mk_err( ERR_BAD_REQUEST, "service chain %s has lost its steering reservation and cannot be extended", chain )
+	}
+
+	c, old := (*sp).Get_window()
+	if expiry <= time.Now().Unix() || expiry <= c {
+		return mk_err( ERR_BAD_REQUEST, "new expiry for service chain %s must be in the future and after the chain commences", chain )
+	}
+
+	for _, name := range names[1:] {
+		if inv.cache[name] == nil {
+			return mk_err( ERR_BAD_REQUEST, "service chain %s cannot be extended while leg %s is waiting on the retry list", chain, name )
+		}
+	}
+
+	for i, name := range names[1:] {
+		if err = inv.rewindow( name, inv.cache[name], expiry, true ); err != nil {
+			rm_sheep.Baa( 1, "service chain %s not extended: leg %s: %s", chain, name, err )
+			inv.chain_restore( name, inv.cache[name], old, false )
+			for j := i - 1; j >= 0; j-- {
+				inv.chain_restore( names[j+1], inv.cache[names[j+1]], old, true )
+			}
+			return mk_err( ERR_CAPACITY, "unable to extend service chain %s: %s", chain, err )
+		}
+	}
+
+	(*sp).Set_expiry( expiry )
+	rm_sheep.Baa( 1, "service chain %s extended: expiry %d -> %d", chain, old, expiry )
+	publish_event( "chain.extended", fmt.Sprintf( `{ "chain": %q, "old_expiry": %d, "expiry": %d }`, chain, old, expiry ) )
+	return nil
+}
+
+/*
+	Put a leg back to its original expiry. It fitted before, so failure is unexpected; if it
+	happens the leg goes to the retry list as a readmit failure would.
+*/
+func (inv *Inventory) chain_restore( name string, p *gizmos.Pledge, expiry int64, release bool ) {
+	if err := inv.rewindow( name, p, expiry, release ); err != nil {
+		rm_sheep.Baa( 0, "WRN: service chain leg %s could not be restored after a failed extend; moved to retry queue: %s  [TGURMG020]", name, err )
+		delete( inv.cache, name )
+		inv.idx.drop( name )
+		inv.Add_retry( p )
+	}
+}
+
+/*
+	Delete the chain. Deleting the steering reservation takes the legs with it; if it is gone
+	the remaining legs are deleted. Unless now is set the delete grace period applies and the
+	time of deletion is returned.
+*/
+func (inv *Inventory) chain_delete( chain string, cookie *string, now bool ) ( when int64, err error ) {
+	names, err := inv.chain_members( chain, cookie )
+	if err != nil {
+		return 0, err
+	}
+
+	if names[0] == chain_steer_id( chain ) {
+		names = names[0:1]
+	}
+
+	for _, name := range names {
+		nm := name
+		if now || inv.cache[name] == nil {					// nothing pushed for those on the retry list; no grace needed
+			err = inv.Del_res( &nm, cookie )
+		} else {
+			var w int64
+			w, err = inv.user_del( &nm, cookie )
+			if w > when {
+				when = w
+			}
+		}
+		if err != nil {
+			return when, err
+		}
+	}
+
+	rm_sheep.Baa( 1, "service chain %s deleted: %s", chain, strings.Join( names, " " ) )
+	return when, nil
+}
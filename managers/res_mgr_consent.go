@@ -0,0 +1,244 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_consent
+	Abstract:	Cross-tenant consent. When enabled, a bandwidth reservation between VMs in two
+				different projects is accepted (network capacity is set aside) but is not pushed
+				until the other project consents. The requester's project is the one for which
+				its token was validated: when osif requires tokens, a translated host without a
+				leading bang (ID/name) was validated and one given unvalidated (!ID/name) was
+				not, so consent is asked of the unvalidated host's project. A requester whose
+				token(s) were valid for both projects needs no consent. When tokens aren't
+				required there is nothing to go on and the first host is taken to be the
+				requester's (the second's project is asked). Consent is not needed when the two
+				projects are listed as peers. The other tenant gives or refuses consent with:
+					consent res-id project
+					refuse res-id project
+
+				where the auth token must be valid for the project. A reservation which is refused,
+				or which is not consented to within the timeout, is cancelled. A consented
+				reservation is then subject to admin approval (res_mgr_approve) as though it had
+				just been added.
+
+				The project whose consent is needed is kept in the pledge (and checkpoint) so the
+				wait survives a restart; the timeout restarts when the checkpoint is loaded.
+
+				Events are published for each transition: reservation.awaiting_consent,
+				reservation.consented, reservation.refused and reservation.consent_expired.
+
+	CFG:		resmgr:xtenant_consent - true to require consent (false)
+				resmgr:peering - space separated list of project pairs (p1:p2), names or IDs, which
+					may make reservations with each other without consent
+				resmgr:consent_timeout - seconds a reservation may wait for consent (86400)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Consent is asked of the project other than the requester's (from the
+							validated token) rather than always that of the second host.
+				16 Oct 2026 - Refused and consent-expired reservations get a refused accounting record
+							rather than deleted.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Pull the consent settings from the config. Called from Initialise.
+*/
+func consent_init( ) {
+	if cfg_data["resmgr"] == nil {
+		return
+	}
+
+	if p := cfg_data["resmgr"]["xtenant_consent"]; p != nil {
+		xtenant_consent = *p == "true"
+	}
+	if p := cfg_data["resmgr"]["peering"]; p != nil {
+		peering = strings.Fields( *p )
+	}
+	if p := cfg_data["resmgr"]["consent_timeout"]; p != nil {
+		consent_timeout = clike.Atoi64( *p )
+	}
+	if cfg_data["osif"] != nil {
+		if p := cfg_data["osif"]["require_token"]; p != nil {			// as osif reads it
+			consent_tokens = *p == "true"
+		}
+	}
+}
+
+/*
+	Return the project (ID) of a translated host name (ID/name); empty string if there is
+	no project (external address).
+*/
+func host_project( h *string ) ( string ) {
+	if h == nil || *h == "" || (*h)[0:1] == "!" {
+		return ""
+	}
+
+	toks := strings.SplitN( *h, "/", 2 )
+	if len( toks ) < 2 {
+		return ""
+	}
+
+	return toks[0]
+}
+
+/*
+	Return the project (ID) of a translated host and true if the requester's token was
+	validated for it. An unvalidated host (!ID/name) has a project, but isn't validated;
+	an external address (!//addr) has neither.
+*/
+func host_project_auth( h *string ) ( pid string, valid bool ) {
+	if h == nil || *h == "" {
+		return "", false
+	}
+
+	if (*h)[0:1] == "!" {
+		hx := (*h)[1:]
+		return host_project( &hx ), false
+	}
+
+	return host_project( h ), consent_tokens
+}
+
+/*
+	Given the translated hosts of a new reservation, return the project whose consent is
+	needed before it may be pushed; empty string if none is needed. The project asked is
+	the one the requester's token was not validated for. Must not be called from the osif
+	goroutine.
+*/
+func consent_needed( h1 *string, h2 *string ) ( string ) {
+	if ! xtenant_consent {
+		return ""
+	}
+
+	t1, v1 := host_project_auth( h1 )
+	t2, v2 := host_project_auth( h2 )
+	if t1 == "" || t2 == "" || t1 == t2 {
+		return ""
+	}
+
+	if v1 && v2 {											// requester's tokens were good for both projects
+		return ""
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	for _, pair := range peering {
+		ptoks := strings.SplitN( pair, ":", 2 )
+		if len( ptoks ) < 2 {
+			continue
+		}
+
+		p1 := proj2id( ptoks[0], my_ch )
+		p2 := proj2id( ptoks[1], my_ch )
+		if (p1 == t1 && p2 == t2) || (p1 == t2 && p2 == t1) {
+			return ""
+		}
+	}
+
+	if v2 && ! v1 {											// requester is the second host's project
+		return t1
+	}
+	return t2
+}
+
+/*
+	Start timing a newly added pledge which is waiting for consent.
+*/
+func (inv *Inventory) hold_for_consent( p *gizmos.Pledge ) {
+	(*p).Set_awaiting_approval( true )						// must not be pushed while waiting
+	inv.consent_wait[*(*p).Get_id()] = time.Now().Unix()
+	rm_sheep.Baa( 1, "reservation %s is awaiting consent from project %s", *(*p).Get_id(), (*p).Get_consent() )
+	publish_event( "reservation.awaiting_consent", (*p).To_json() )
+}
+
+/*
+	Give (granted == true) or refuse consent for the named reservation on behalf of project.
+	A consented pledge is held if it needs admin approval, otherwise it is released to be pushed.
+*/
+func (inv *Inventory) give_consent( name *string, project string, granted bool, threshold int64 ) ( err error ) {
+	p := inv.cache[*name]
+	if p == nil || (*p).Get_consent() == "" || (*p).Is_expired() {
+		return fmt.Errorf( "no reservation awaiting consent with name: %s", *name )
+	}
+	if (*p).Get_consent() != project {
+		return fmt.Errorf( "reservation %s is not awaiting consent from project %s", *name, project )
+	}
+
+	delete( inv.consent_wait, *name )
+	if granted {
+		(*p).Set_consent( "" )
+		(*p).Set_awaiting_approval( false )
+		rm_sheep.Baa( 1, "project %s consented to reservation %s", project, *name )
+		publish_event( "reservation.consented", (*p).To_json() )
+
+		if ! inv.hold_for_approval( p, threshold ) && ! (*p).Is_paused() {
+			(*p).Reset_pushed()
+		}
+		return nil
+	}
+
+	inv.account( *name, p, "refused" )					// before delete so it isn't accounted as deleted
+	err = inv.Del_res( name, super_cookie )				// still flagged as awaiting so nothing is pushed before it expires
+	rm_sheep.Baa( 1, "project %s refused reservation %s", project, *name )
+	publish_event( "reservation.refused", (*p).To_json() )
+	return
+}
+
+/*
+	Cancel reservations that have waited too long for consent. Those which aren't being
+	timed (loaded from a checkpoint) start their wait now.
+*/
+func (inv *Inventory) expire_consent( timeout int64 ) {
+	now := time.Now().Unix()
+	for name, p := range inv.cache {
+		if p == nil || (*p).Get_consent() == "" || (*p).Is_expired() {
+			delete( inv.consent_wait, name )
+			continue
+		}
+
+		since, ok := inv.consent_wait[name]
+		if !ok {
+			inv.consent_wait[name] = now
+			continue
+		}
+
+		if now - since > timeout {
+			rm_sheep.Baa( 1, "reservation %s waited more than %ds for consent from project %s and was cancelled", name, timeout, (*p).Get_consent() )
+			publish_event( "reservation.consent_expired", (*p).To_json() )
+			delete( inv.consent_wait, name )
+			nm := name
+			inv.account( nm, p, "refused" )
+			inv.Del_res( &nm, super_cookie )
+		}
+	}
+}
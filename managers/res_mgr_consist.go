@@ -0,0 +1,309 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_consist
+	Abstract:	Consistency check between the inventory, the network graph and the agents.
+				For each active reservation:
+					path	- every link on the reservation's path(s) is still in the graph
+					queue	- the reservation's queue was in the last queue map sent to fq-mgr
+							  (only reservations active when that map was generated)
+					fmod	- every set of flow-mods pushed for the reservation has been
+							  confirmed by an agent (see res_mgr_fmstat)
+
+				Discrepancies are logged, published as a consistency.discrepancy event, and
+				returned as json. Each kind of discrepancy can be repaired:
+					path	- the network capacity is released and the reservation admitted
+							  again (new path); if that fails it is moved to the retry queue
+					queue, fmod - the reservation is pushed again after a new queue map
+							  is generated
+
+				The check is run on a timer and on demand (conscheck request).
+
+	CFG:		resmgr:cons_check - seconds between checks; 0 disables (0)
+				resmgr:cons_repair - comma separated list of discrepancies to repair
+					on the timed check: path, queue, fmod, all or none (none)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	One problem found.
+*/
+type discrepancy struct {
+	id			string
+	check		string				// path, queue or fmod
+	detail		string
+	repaired	bool
+}
+
+/*
+	Convert the repair list (comma separated) to a map; all sets every kind.
+*/
+func repair_set( list string ) ( map[string]bool ) {
+	rs := make( map[string]bool )
+	for _, r := range strings.Split( list, "," ) {
+		switch r = strings.TrimSpace( r ); r {
+			case "all":
+				rs["path"] = true
+				rs["queue"] = true
+				rs["fmod"] = true
+
+			case "", "none":
+
+			default:
+				rs[r] = true
+		}
+	}
+
+	return rs
+}
+
+/*
+	Remember which queue ids were in the queue map sent to fq-mgr, and when the map was for.
+	Tokens are swid/port,res-id,queue,min,max,pri.
+*/
+func (inv *Inventory) note_qmap( qlist []string, ts int64 ) {
+	inv.qmap_ids = make( map[string]bool, len( qlist ) )
+	for _, tok := range qlist {
+		if f := strings.SplitN( tok, ",", 3 ); len( f ) > 1 {
+			inv.qmap_ids[f[1]] = true
+		}
+	}
+	inv.qmap_ts = ts
+}
+
+/*
+	Return the ids of links on the pledge's path(s); nil if the pledge has no paths.
+*/
+func pledge_link_ids( p *gizmos.Pledge ) ( ids []string ) {
+	var plist []*gizmos.Path
+
+	switch pldg := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			plist = pldg.Get_path_list()
+		case *gizmos.Pledge_mcast:
+			plist = pldg.Get_path_list()
+		default:
+			return nil
+	}
+
+	for _, path := range plist {
+		ids = append( ids, path.Get_link_ids()... )
+	}
+	return ids
+}
+
+/*
+	Return the queue id of the pledge; nil if the kind has no queue.
+*/
+func pledge_qid( p *gizmos.Pledge ) ( *string ) {
+	switch pldg := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			return pldg.Get_qid()
+		case *gizmos.Pledge_mcast:
+			return pldg.Get_qid()
+	}
+
+	return nil
+}
+
+/*
+	Network side: return the ids in the list which aren't links in the graph.
+*/
+func (n *Network) missing_links( ids []string ) ( missing []string ) {
+	missing = make( []string, 0 )
+	if n == nil {
+		return missing
+	}
+
+	for _, id := range ids {
+		if n.links[id] == nil && n.vlinks[id] == nil {
+			missing = append( missing, id )
+		}
+	}
+
+	return missing
+}
+
+/*
+	Give back the pledge's capacity and admit it again. If admission fails the pledge is
+	moved to the retry queue. Returns true if it was admitted.
+*/
+func (inv *Inventory) readmit( name string, p *gizmos.Pledge ) ( bool ) {
+	if req := nw_req( REQ_DEL, *p, nil ); req.State != nil {
+		rm_sheep.Baa( 1, "consistency: network release failed for %s: %s", name, req.State )
+	}
+
+	if k := gizmos.Pledge_kind_of( *p ); k != nil && k.Admit != nil {
+		if err := k.Admit( p ); err != nil {
+			rm_sheep.Baa( 1, "consistency: unable to find a new path for %s; moved to retry queue: %s", name, err )
+			delete( inv.cache, name )
+			inv.idx.drop( name )
+			inv.Add_retry( p )
+			return false
+		}
+	}
+
+	(*p).Reset_pushed()
+	inv.idx.add( name, p )							// new path
+	return true
+}
+
+/*
+	Run the checks, repairing the kinds of discrepancy in repair. Flow-mods sent less than
+	ack_wait seconds ago aren't expected to be confirmed yet. Returns the json report and
+	true if a new queue map should be requested (which leads to a push).
+*/
+func (inv *Inventory) cons_check( repair map[string]bool, ack_wait int64 ) ( jstr string, need_push bool ) {
+	now := time.Now().Unix()
+	found := make( []*discrepancy, 0 )
+	checked := 0
+
+	link_ids := make( map[string][]string )				// links of each pledge; all sent to network in one request
+	all_links := make( map[string]bool )
+	for name, p := range inv.cache {
+		if p == nil || ! (*p).Is_active() || (*p).Is_paused() || (*p).Is_awaiting_approval() || (*p).Get_consent() != "" || strings.HasSuffix( name, ".yank" ) {
+			continue
+		}
+		checked++
+
+		if ids := pledge_link_ids( p ); ids != nil {
+			link_ids[name] = ids
+			for _, id := range ids {
+				all_links[id] = true
+			}
+		}
+
+		if qid := pledge_qid( p ); qid != nil && inv.qmap_ids != nil {
+			if c, _ := (*p).Get_window(); c < inv.qmap_ts && ! inv.qmap_ids[*qid] {
+				found = append( found, &discrepancy{ id: name, check: "queue", detail: fmt.Sprintf( "queue %s not in the last queue map", *qid ) } )
+			}
+		}
+
+		if rs := inv.fmstat[name]; rs != nil && (*p).Is_pushed() {
+			for _, st := range rs.fmods {
+				if st.State == "failed" || st.State == "unsent" || (st.State != "installed" && now - st.Sent > ack_wait) {
+					found = append( found, &discrepancy{ id: name, check: "fmod", detail: fmt.Sprintf( "%s on %s is %s", st.Atype, st.Host, st.State ) } )
+					break
+				}
+			}
+		}
+	}
+
+	if len( all_links ) > 0 {
+		ids := make( []string, 0, len( all_links ) )
+		for id := range all_links {
+			ids = append( ids, id )
+		}
+
+		req := nw_req( REQ_LINKS_EXIST, ids, nil )
+		if req.State != nil {
+			rm_sheep.Baa( 1, "consistency: unable to verify paths: %s", req.State )
+		} else {
+			gone := make( map[string]bool )
+			for _, id := range req.Response_data.( []string ) {
+				gone[id] = true
+			}
+
+			for name, lids := range link_ids {
+				for _, id := range lids {
+					if gone[id] {
+						found = append( found, &discrepancy{ id: name, check: "path", detail: fmt.Sprintf( "link %s is not in the graph", id ) } )
+						break
+					}
+				}
+			}
+		}
+	}
+
+	sort.Sort( discrepancies( found ) )
+	readmitted := make( map[string]bool )
+	for _, d := range found {
+		if ! repair[d.check] {
+			continue
+		}
+
+		p := inv.cache[d.id]
+		if p == nil {
+			continue						// moved to retry by a path repair
+		}
+
+		switch d.check {
+			case "path":
+				d.repaired = inv.readmit( d.id, p )
+				readmitted[d.id] = true
+
+			default:
+				if ! readmitted[d.id] {
+					(*p).Reset_pushed()
+				}
+				d.repaired = true
+		}
+		need_push = need_push || d.repaired
+	}
+
+	jstr = fmt.Sprintf( `{ "checked": %d, "discrepancies": [ `, checked )
+	sep := ""
+	for _, d := range found {
+		dj := fmt.Sprintf( `{ "id": %q, "check": %q, "detail": %q, "repaired": %v }`, d.id, d.check, d.detail, d.repaired )
+		jstr += sep + dj
+		sep = ", "
+
+		rm_sheep.Baa( 1, "WRN: consistency: %s: %s: %s (repaired=%v)  [TGURMG013]", d.id, d.check, d.detail, d.repaired )
+		publish_event( "consistency.discrepancy", dj )
+	}
+	jstr += " ] }"
+
+	rm_sheep.Baa( 1, "consistency check: %d reservations checked, %d discrepancies", checked, len( found ) )
+	return jstr, need_push
+}
+
+/*
+	Sort by id then check so that the report is stable and path (which may readmit) is
+	handled before the others for the same reservation.
+*/
+type discrepancies []*discrepancy
+
+func (d discrepancies) Len( ) int { return len( d ) }
+func (d discrepancies) Swap( i, j int ) { d[i], d[j] = d[j], d[i] }
+func (d discrepancies) Less( i, j int ) bool {
+	if d[i].id != d[j].id {
+		return d[i].id < d[j].id
+	}
+	return check_rank[d[i].check] < check_rank[d[j].check]
+}
+
+var check_rank = map[string]int{ "path": 0, "queue": 1, "fmod": 2 }
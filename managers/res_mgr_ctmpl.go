@@ -0,0 +1,268 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+/*
+
+	Mnemonic:	res_mgr_ctmpl
+	Abstract:	Service chain templates. A template names the roles of the middleboxes that traffic
+				is steered through (in order), and optionally the match (proto) and an offset added
+				to the priority of the chain's steering flow-mods. A tenant instantiates the template
+				on a chain request (template=name) by binding each role to one of its own middleboxes:
+
+					chain template=web 10M +3600 tenant ep1 ep2 fw:vm3,lb:vm7 cookie voice
+
+				The bindings are checked before anything is reserved: every role must be given one
+				middlebox, and roles not in the template are refused. The middleboxes themselves are
+				then validated as for any chain (they must belong to the tenant), so no flow-mods are
+				sent unless the whole instance is good.
+
+				Templates are given in the config as a space separated list of name:settings where
+				settings is a comma separated list of roles=role1+role2..., proto=p and pri=n. Roles
+				must be given. For example:
+					web:roles=fw+ids+lb,proto=tcp:80,pri=20 inspect:roles=ids
+
+				Templates may be set, replaced and deleted with the chaintemplate admin request; those
+				changes are kept only in memory and are lost on restart. Chains already created keep
+				the middleboxes and settings they were given.
+
+	CFG:		resmgr:chain_templates - list of service chain templates (none)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type chain_tmpl struct {
+	name		string
+	roles		[]string					// middlebox roles in the order traffic passes through them
+	proto		string						// match applied when the request gives none; empty for all traffic
+	pri			int							// offset added to the steering flow-mod priorities
+}
+
+/*
+	Request data for REQ_CHAIN_TMPL.
+*/
+type ctmpl_req struct {
+	action		string						// get, list, set or del
+	name		string
+	tmpl		*chain_tmpl					// set only
+}
+
+/*
+	Parse one template: name:roles=r1+r2...,proto=p,pri=n.
+*/
+func mk_chain_tmpl( spec string ) ( *chain_tmpl, error ) {
+	toks := strings.SplitN( spec, ":", 2 )
+	if toks[0] == "" {
+		return nil, fmt.Errorf( "chain template has no name: %s", spec )
+	}
+
+	t := &chain_tmpl{ name: toks[0] }
+	if len( toks ) > 1 {
+		for _, kv := range strings.Split( toks[1], "," ) {
+			if kv == "" {
+				continue
+			}
+
+			ktoks := strings.SplitN( kv, "=", 2 )
+			if len( ktoks ) < 2 || ktoks[1] == "" {
+				return nil, fmt.Errorf( "chain template setting must be key=value: %s", kv )
+			}
+			switch ktoks[0] {
+				case "roles":
+					t.roles = strings.Split( ktoks[1], "+" )
+
+				case "proto":
+					t.proto = ktoks[1]
+
+				case "pri":
+					t.pri = clike.Atoi( ktoks[1] )
+
+				default:
+					return nil, fmt.Errorf( "unknown chain template setting: %s", ktoks[0] )
+			}
+		}
+	}
+
+	if len( t.roles ) == 0 {
+		return nil, fmt.Errorf( "chain template %s has no roles", t.name )
+	}
+	seen := make( map[string]bool, len( t.roles ) )
+	for _, r := range t.roles {
+		if r == "" || seen[r] {
+			return nil, fmt.Errorf( "chain template %s has an empty or duplicate role: %s", t.name, strings.Join( t.roles, "+" ) )
+		}
+		seen[r] = true
+	}
+	if t.pri < 0 || t.pri > gizmos.MAX_STEER_PRI {
+		return nil, fmt.Errorf( "chain template %s priority offset must be between 0 and %d: %d", t.name, gizmos.MAX_STEER_PRI, t.pri )
+	}
+
+	return t, nil
+}
+
+/*
+	Build the template map from the config. Bad entries are logged and skipped.
+*/
+func ctmpl_init( ) ( tmpls map[string]*chain_tmpl ) {
+	tmpls = make( map[string]*chain_tmpl )
+	if cfg_data["resmgr"] == nil || cfg_data["resmgr"]["chain_templates"] == nil {
+		return
+	}
+
+	for _, spec := range strings.Fields( *cfg_data["resmgr"]["chain_templates"] ) {
+		t, err := mk_chain_tmpl( spec )
+		if err != nil {
+			rm_sheep.Baa( 0, "WRN: resmgr:chain_templates: %s  [TGURMG029]", err )
+			continue
+		}
+		tmpls[t.name] = t
+	}
+
+	rm_sheep.Baa( 1, "%d service chain templates loaded from the config", len( tmpls ) )
+	return
+}
+
+func (t *chain_tmpl) to_json( ) ( string ) {
+	jroles := make( []string, len( t.roles ) )
+	for i, r := range t.roles {
+		jroles[i] = fmt.Sprintf( "%q", r )
+	}
+
+	return fmt.Sprintf( `{ "name": %q, "roles": [ %s ], "proto": %q, "pri": %d }`, t.name, strings.Join( jroles, ", " ), t.proto, t.pri )
+}
+
+/*
+	Bind the template's roles to middleboxes. Bindings is the comma separated role:mbox list
+	from the request. The middlebox list, in the template's role order, is returned; an error
+	if a role isn't bound, is bound more than once, or isn't one of the template's.
+*/
+func (t *chain_tmpl) bind( bindings string ) ( string, error ) {
+	mbs := make( map[string]string, len( t.roles ) )
+	for _, b := range strings.Split( bindings, "," ) {
+		btoks := strings.SplitN( b, ":", 2 )
+		if len( btoks ) < 2 || btoks[0] == "" || btoks[1] == "" {
+			return "", fmt.Errorf( "middlebox for chain template %s must be given as role:mbox: %s", t.name, b )
+		}
+		if mbs[btoks[0]] != "" {
+			return "", fmt.Errorf( "role %s of chain template %s is given more than once", btoks[0], t.name )
+		}
+		mbs[btoks[0]] = btoks[1]
+	}
+
+	mblist := make( []string, len( t.roles ) )
+	missing := make( []string, 0, len( t.roles ) )
+	for i, r := range t.roles {
+		mblist[i] = mbs[r]
+		if mblist[i] == "" {
+			missing = append( missing, r )
+		}
+		delete( mbs, r )
+	}
+	if len( missing ) > 0 {
+		return "", fmt.Errorf( "no middlebox given for role(s) of chain template %s: %s", t.name, strings.Join( missing, " " ) )
+	}
+	if len( mbs ) > 0 {
+		extra := make( []string, 0, len( mbs ) )
+		for r := range mbs {
+			extra = append( extra, r )
+		}
+		sort.Strings( extra )
+		return "", fmt.Errorf( "role(s) not in chain template %s: %s", t.name, strings.Join( extra, " " ) )
+	}
+
+	return strings.Join( mblist, "," ), nil
+}
+
+/*
+	Return a copy of the named template from res-mgr.
+*/
+func chain_template( name string ) ( *chain_tmpl, error ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_CHAIN_TMPL, &ctmpl_req{ action: "get", name: name }, nil )
+	req = <- my_ch
+	if req.State != nil {
+		return nil, req.State
+	}
+
+	t := req.Response_data.( chain_tmpl )
+	return &t, nil
+}
+
+/*
+	Act on a template request. Get returns a copy of the template; the others return json.
+*/
+func (inv *Inventory) ctmpl_req( tr *ctmpl_req ) ( interface{}, error ) {
+	switch tr.action {
+		case "get":
+			t := inv.ctmpls[tr.name]
+			if t == nil {
+				return nil, mk_err( ERR_NOT_FOUND, "no service chain template: %s", tr.name )
+			}
+			c := *t
+			c.roles = append( []string{}, t.roles... )
+			return c, nil
+
+		case "set":
+			inv.ctmpls[tr.tmpl.name] = tr.tmpl
+			rm_sheep.Baa( 1, "service chain template set: %s", tr.tmpl.to_json() )
+			return tr.tmpl.to_json(), nil
+
+		case "del":
+			if inv.ctmpls[tr.name] == nil {
+				return nil, mk_err( ERR_NOT_FOUND, "no service chain template: %s", tr.name )
+			}
+			delete( inv.ctmpls, tr.name )
+			rm_sheep.Baa( 1, "service chain template deleted: %s", tr.name )
+			return fmt.Sprintf( `{ "deleted": %q }`, tr.name ), nil
+	}
+
+	names := make( []string, 0, len( inv.ctmpls ) )
+	for name := range inv.ctmpls {
+		names = append( names, name )
+	}
+	sort.Strings( names )
+
+	jstr := `{ "templates": [ `
+	sep := ""
+	for _, name := range names {
+		jstr += sep + inv.ctmpls[name].to_json()
+		sep = ", "
+	}
+
+	return jstr + " ] }", nil
+}
@@ -0,0 +1,139 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_deps
+	Abstract:	Reservation dependencies. A pledge may name another pledge (depends=id on the
+				request) which must be pushed before it is: a bandwidth guarantee which should
+				not take effect until the steering chain that carries the traffic is in place,
+				for example. Push_reservations() holds a dependent pledge until the pledge it
+				depends on has been pushed.
+
+				When a pledge is deleted, or expires, the pledges which depend on it are deleted
+				too (and in turn those which depend on them) and a reservation.dependency_removed
+				event is published for each.
+
+				The dependency is checked only when the request is made: the pledge named must
+				exist and must not expire before the dependent commences. Checkpointed pledges
+				are loaded in no particular order and so are not checked; one whose dependency
+				didn't survive the restart is deleted when it would otherwise be pushed.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Verify that the pledge a new pledge depends on exists and lives long enough. Nil is returned
+	if the pledge has no dependency.
+*/
+func (inv *Inventory) check_depends( p *gizmos.Pledge ) ( error ) {
+	dep := (*p).Get_depends()
+	if dep == "" {
+		return nil
+	}
+
+	if dep == *(*p).Get_id() {
+		return mk_err( ERR_BAD_REQUEST, "reservation cannot depend on itself: %s", dep )
+	}
+
+	dp := inv.cache[dep]
+	if dp == nil || (*dp).Is_expired() {
+		return mk_err( ERR_NOT_FOUND, "reservation depended on does not exist or has expired: %s", dep )
+	}
+
+	c, _ := (*p).Get_window()
+	_, de := (*dp).Get_window()
+	if de <= c {
+		return mk_err( ERR_BAD_REQUEST, "reservation depended on (%s) expires before this reservation commences", dep )
+	}
+
+	return nil
+}
+
+/*
+	Returns true if the pledge must not be pushed yet because the pledge it depends on hasn't
+	been. If that pledge is gone (expired, or lost on a restart) the dependent is deleted and
+	true is returned.
+*/
+func (inv *Inventory) dep_hold( rname string, p *gizmos.Pledge ) ( bool ) {
+	dep := (*p).Get_depends()
+	if dep == "" {
+		return false
+	}
+
+	dp := inv.cache[dep]
+	if dp == nil || (*dp).Is_expired() {
+		inv.drop_dependent( rname, dep, "missing" )
+		return true
+	}
+
+	if ! (*dp).Is_pushed() {
+		rm_sheep.Baa( 2, "reservation %s held: depends on %s which has not been pushed", rname, dep )
+		return true
+	}
+
+	return false
+}
+
+/*
+	Delete the pledges which depend on the named pledge; why is given in the event (deleted,
+	expired, missing).
+*/
+func (inv *Inventory) cascade_deps( name string, why string ) ( n int ) {
+	for rname, p := range inv.cache {
+		if p != nil && ! (*p).Is_expired() && (*p).Get_depends() == name {
+			inv.drop_dependent( rname, name, why )
+			n++
+		}
+	}
+
+	for rname, p := range inv.retry {
+		if p != nil && (*p).Get_depends() == name {
+			inv.drop_dependent( rname, name, why )
+			n++
+		}
+	}
+
+	return n
+}
+
+/*
+	Delete one dependent pledge (Del_res cascades to its dependents).
+*/
+func (inv *Inventory) drop_dependent( rname string, dep string, why string ) {
+	rm_sheep.Baa( 1, "reservation %s deleted: reservation it depends on (%s) is %s", rname, dep, why )
+	publish_event( "reservation.dependency_removed", fmt.Sprintf( `{ "id": %q, "name": %q, "depends": %q, "reason": %q }`, rname, inv.res_label( rname ), dep, why ) )
+
+	name := rname
+	if err := inv.Del_res( &name, super_cookie ); err != nil {
+		rm_sheep.Baa( 1, "WRN: unable to delete reservation %s whose dependency was removed: %s  [TGURMG019]", rname, err )
+	}
+}
@@ -0,0 +1,131 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_expiry
+	Abstract:	Expiration warnings. When a warning time is configured, an active reservation
+				that is within that many seconds of its expiry is shown with the state
+				EXPIRING_SOON and a reservation.expiring event is published for it (once; again
+				if it is extended and later nears its new expiry). This gives the owner a chance
+				to replace it with a longer reservation before it ends.
+
+				Once a day, at the configured hour (UTC), a reservation.expiry_summary event is
+				published for each tenant that has reservations expiring in the next 24 hours
+				listing those reservations.
+
+	CFG:		resmgr:expiry_warn - seconds before expiry that the warning is given (0, off)
+				resmgr:expiry_summary_hour - hour (0-23 UTC) of the daily summary (-1, off)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+	Publish a warning event for each active reservation that is close to expiring and hasn't
+	been warned about.
+*/
+func (inv *Inventory) expiry_check( warn int64 ) {
+	now := time.Now().Unix()
+	for name, p := range inv.cache {
+		if p == nil || ! (*p).Is_active() || (*p).Is_paused() {
+			delete( inv.warned, name )
+			continue
+		}
+
+		_, expiry := (*p).Get_window()
+		if expiry - now > warn {
+			delete( inv.warned, name )				// extended since the warning (or not yet close)
+			continue
+		}
+
+		if inv.warned[name] == expiry {
+			continue
+		}
+
+		inv.warned[name] = expiry
+		rm_sheep.Baa( 2, "reservation %s expires in %ds", name, expiry - now )
+		publish_event( "reservation.expiring", (*p).To_json() )
+	}
+}
+
+/*
+	Publish a summary event for each tenant with reservations that expire in the next day.
+*/
+func (inv *Inventory) expiry_summary( ) {
+	now := time.Now().Unix()
+	by_tenant := make( map[string][]string )
+	for name, p := range inv.cache {
+		if p == nil || (*p).Is_expired() {
+			continue
+		}
+
+		_, expiry := (*p).Get_window()
+		if expiry - now > 86400 {
+			continue
+		}
+
+		tenant := pledge_tenant( p )
+		by_tenant[tenant] = append( by_tenant[tenant], fmt.Sprintf( `{ "id": %q, "expiry": %d }`, name, expiry ) )
+	}
+
+	for tenant, list := range by_tenant {
+		sort.Strings( list )
+		jlist := ""
+		sep := ""
+		for _, r := range list {
+			jlist += sep + r
+			sep = ", "
+		}
+
+		publish_event( "reservation.expiry_summary", fmt.Sprintf( `{ "tenant": %q, "count": %d, "reservations": [ %s ] }`, tenant, len( list ), jlist ) )
+	}
+
+	rm_sheep.Baa( 1, "expiry summaries published for %d tenants", len( by_tenant ) )
+}
+
+/*
+	Return true if the summary should be sent now: it is the summary hour and one hasn't
+	been sent today. Last is updated when true is returned.
+*/
+func summary_due( hour int, last *string ) ( bool ) {
+	if hour < 0 {
+		return false
+	}
+
+	now := time.Now().UTC()
+	today := now.Format( "2006-01-02" )
+	if now.Hour() != hour || *last == today {
+		return false
+	}
+
+	*last = today
+	return true
+}
@@ -0,0 +1,83 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_fip
+	Abstract:	Reservations affected by a floating IP move (see network_fip.go). A bandwidth
+				reservation whose path matches on a floating IP that moved is readmitted: its
+				obligations are released and new paths are found using the current mapping. The
+				flow-mods are then pushed again. If the far end no longer has a floating IP the
+				reservation can't be admitted and is moved to the retry queue.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Readmit the reservations using any of the floating IPs. Returns the number readmitted
+	(including those that moved to the retry queue).
+*/
+func (inv *Inventory) fip_moved( moves []*fip_move ) ( n int ) {
+	fips := make( map[string]*fip_move, len( moves ) )
+	for _, m := range moves {
+		fips[m.fip] = m
+	}
+
+	for name, p := range inv.cache {
+		if p == nil || (*p).Is_expired() || strings.HasSuffix( name, ".yank" ) {
+			continue
+		}
+
+		bwp, ok := (*p).( *gizmos.Pledge_bw )
+		if ! ok {
+			continue
+		}
+
+		var m *fip_move
+		for _, path := range bwp.Get_path_list() {
+			if x := path.Get_extip(); x != nil && fips[*x] != nil {
+				m = fips[*x]
+				break
+			}
+		}
+		if m == nil {
+			continue
+		}
+
+		readmitted := inv.readmit( name, p )
+		n++
+		rm_sheep.Baa( 1, "reservation %s used floating ip %s (%s -> %s); readmitted=%v", name, m.fip, m.old, m.new, readmitted )
+		publish_event( "reservation.fip_changed", fmt.Sprintf( `{ "id": %q, "name": %q, "fip": %q, "old": %q, "new": %q, "readmitted": %v }`, name, inv.res_label( name ), m.fip, m.old, m.new, readmitted ) )
+	}
+
+	return n
+}
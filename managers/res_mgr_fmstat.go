@@ -0,0 +1,387 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_fmstat
+	Abstract:	Flow-mod status, audit and usage for bandwidth reservations (bidirectional,
+				oneway and multicast), steering reservations and mirrors. The agent manager reports
+				each bw_fmod, bwow_fmod, mcast_fmod, steering flowmod or mirrorwiz action when it is
+				sent to an agent and again when the agent responds (see agent_log.go); the action
+				id in the response ties it to the reservation (fq-mgr reports each ovn qos rule
+				in the same way, see fq_ovn.go). We keep the latest state of every
+				set of flow-mods (host and match) for each reservation:
+					sent		- written to an agent, no response yet
+					installed	- the agent reported success
+					failed		- the agent reported failure
+					unsent		- there was no agent to send it to; held for replay
+					dropped		- there was no agent to send it to and it could not be held
+					requeued	- the agent dropped; it will be sent to another
+
+				Periodically the pushed reservations are audited: one with a flow-mod set that
+				failed, was never sent, or was not acknowledged within fmod_ack_wait seconds is
+				pushed again, up to fmod_retries times, after which an install_failed event is
+				published. An installed event is published when all of a reservation's flow-mods
+				are first acknowledged (or are acknowledged after an install failure); the retry
+				count is reset whenever they are. A reservation with dropped or failed flow-mods is
+				not left for the audit; it is pushed again straight away (this too counts as a retry).
+
+				Also periodically, an interim accounting record is written for every active
+				bandwidth reservation (usage to date) so that long running reservations are
+				accounted for before they end.
+
+				The resstatus API request shows the state of each set of flow-mods for a
+				reservation, the switch/port/queues its last push programmed (pledge_touch.go),
+				the result of the nat match probe on each host for those
+				matching on a floating ip (see fq_natprobe.go), and the result of the
+				verification of each direction (see fq_verify.go).
+
+	CFG:		resmgr:fmod_audit - seconds between audits; 0 disables (60)
+				resmgr:fmod_ack_wait - seconds to wait for an agent response before retrying (60)
+				resmgr:fmod_retries - max pushes of a reservation because of an audit failure (3)
+				resmgr:usage_interval - seconds between interim accounting records; 0 disables (0)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Nat match probe results.
+				16 Oct 2026 - Status has the reservation's phase; includes the retry list.
+				16 Oct 2026 - Dropped flow-mods cause the reservation to be pushed again immediately.
+				16 Oct 2026 - Steering and mirror actions are tracked; failures are pushed again immediately.
+				16 Oct 2026 - Status includes the switch/port/queues programmed by the last push.
+				16 Oct 2026 - Status includes reservation verification results (fq_verify.go).
+				16 Oct 2026 - Status includes the request origin when the super cookie is given.
+				16 Oct 2026 - Refused (never sent) actions are marked failed without a push again.
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Report from the agent manager about one bandwidth action.
+*/
+type fmod_report struct {
+	resid	string
+	aid		uint32
+	atype	string
+	host	string
+	key		string
+	outcome	string						// sent, unsent, dropped, refused, requeued, ok or failed (n)
+	ts		int64
+}
+
+/*
+	Latest state of one set of flow-mods.
+*/
+type fmod_stat struct {
+	Aid		uint32	`json:"aid"`
+	Atype	string	`json:"atype"`
+	Host	string	`json:"host"`
+	State	string	`json:"state"`
+	Sent	int64	`json:"sent"`
+	Updated	int64	`json:"updated"`
+}
+
+/*
+	Flow-mod state of a reservation.
+*/
+type res_fmstat struct {
+	fmods	map[string]*fmod_stat		// keyed by host/match
+	retries	int							// pushes caused by the audit
+	event	string						// last event published (installed or install_failed)
+	nat		map[string]string			// nat match probe result by host
+	verify	map[string]*verify_result	// verification result by host and direction (fq_verify.go)
+}
+
+/*
+	Apply a report from the agent manager. Max_retries limits the pushes caused by dropped
+	or failed flow-mods as it does those caused by the audit.
+*/
+func (inv *Inventory) fmod_update( r *fmod_report, max_retries int ) {
+	p := inv.cache[r.resid]
+	if p == nil {
+		return								// deleted or yanked; nothing to track
+	}
+
+	rs := inv.fmstat[r.resid]
+	if rs == nil {
+		rs = &res_fmstat{ fmods: make( map[string]*fmod_stat ) }
+		inv.fmstat[r.resid] = rs
+	}
+
+	st := rs.fmods[r.key]
+	switch r.outcome {
+		case "sent", "unsent":				// a new push replaces whatever was there
+			rs.fmods[r.key] = &fmod_stat{ Aid: r.aid, Atype: r.atype, Host: r.host, State: r.outcome, Sent: r.ts, Updated: r.ts }
+			return
+
+		case "dropped":
+			rs.fmods[r.key] = &fmod_stat{ Aid: r.aid, Atype: r.atype, Host: r.host, State: r.outcome, Sent: r.ts, Updated: r.ts }
+			inv.fmod_retry( r.resid, rs, r.host, max_retries )
+			return
+
+		case "refused":						// never sent (agent vetting); pushing again would be refused too
+			rs.fmods[r.key] = &fmod_stat{ Atype: r.atype, Host: r.host, State: "failed", Sent: r.ts, Updated: r.ts }
+			rm_sheep.Baa( 1, "WRN: %s refused for %s on %s; not sent to the agent  [TGURMG008]", r.atype, r.resid, r.host )
+			publish_event( "reservation.fmod_failed", fmt.Sprintf( `{ "id": %q, "name": %q, "atype": %q, "host": %q, "outcome": %q }`, r.resid, inv.res_label( r.resid ), r.atype, r.host, r.outcome ) )
+			return
+
+		case "requeued":
+			if st != nil && st.Aid == r.aid {
+				st.State = "requeued"
+				st.Updated = r.ts
+			}
+			return
+	}
+
+	if st == nil || st.Aid != r.aid {
+		return								// response to a push that has since been replaced
+	}
+
+	st.Updated = r.ts
+	if r.outcome != "ok" {
+		st.State = "failed"
+		rm_sheep.Baa( 1, "WRN: %s failed on %s for reservation %s: %s  [TGURMG008]", r.atype, r.host, r.resid, r.outcome )
+		publish_event( "reservation.fmod_failed", fmt.Sprintf( `{ "id": %q, "name": %q, "atype": %q, "host": %q, "outcome": %q }`, r.resid, inv.res_label( r.resid ), r.atype, r.host, r.outcome ) )
+		inv.fmod_retry( r.resid, rs, r.host, max_retries )
+		return
+	}
+
+	st.State = "installed"
+	if rs.all_installed( ) {
+		rs.retries = 0
+		if rs.event == "installed" {
+			return
+		}
+
+		rs.event = "installed"
+		rm_sheep.Baa( 2, "all flow-mods for reservation %s are installed", r.resid )
+		publish_event( "reservation.installed", (*p).To_json() )
+	}
+}
+
+/*
+	Record the result of a nat match probe on a host.
+*/
+func (inv *Inventory) nat_update( resid string, host string, state string ) {
+	if inv.cache[resid] == nil {
+		return
+	}
+
+	rs := inv.fmstat[resid]
+	if rs == nil {
+		rs = &res_fmstat{ fmods: make( map[string]*fmod_stat ) }
+		inv.fmstat[resid] = rs
+	}
+	if rs.nat == nil {
+		rs.nat = make( map[string]string )
+	}
+
+	rs.nat[host] = state
+}
+
+/*
+	Record the result of a verification of one direction of a reservation.
+*/
+func (inv *Inventory) verify_update( resid string, hdir string, vr *verify_result ) {
+	if inv.cache[resid] == nil || vr == nil {
+		return
+	}
+
+	rs := inv.fmstat[resid]
+	if rs == nil {
+		rs = &res_fmstat{ fmods: make( map[string]*fmod_stat ) }
+		inv.fmstat[resid] = rs
+	}
+	if rs.verify == nil {
+		rs.verify = make( map[string]*verify_result )
+	}
+
+	rs.verify[hdir] = vr
+}
+
+/*
+	Return true if every set of flow-mods has been acknowledged.
+*/
+func (rs *res_fmstat) all_installed( ) ( bool ) {
+	for _, st := range rs.fmods {
+		if st.State != "installed" {
+			return false
+		}
+	}
+
+	return len( rs.fmods ) > 0
+}
+
+/*
+	Verify that the flow-mods of pushed reservations are believed installed; push again those
+	that aren't. Status of reservations no longer in the cache is dropped.
+*/
+func (inv *Inventory) fmod_audit( ack_wait int64, max_retries int ) {
+	now := time.Now().Unix()
+	for name, rs := range inv.fmstat {
+		p := inv.cache[name]
+		if p == nil || (*p).Is_expired() {
+			delete( inv.fmstat, name )
+			continue
+		}
+
+		if ! (*p).Is_pushed() || (*p).Is_paused() || (*p).Is_awaiting_approval() {
+			continue
+		}
+
+		bad := ""
+		for _, st := range rs.fmods {
+			if st.State == "failed" || st.State == "unsent" || st.State == "dropped" || (st.State != "installed" && now - st.Sent > ack_wait) {
+				bad = st.Host
+				break
+			}
+		}
+		if bad != "" {
+			inv.fmod_retry( name, rs, bad, max_retries )
+		}
+	}
+}
+
+/*
+	Push the reservation again because flow-mods on host were not installed, or publish the
+	install_failed event if it has been pushed again too many times already.
+*/
+func (inv *Inventory) fmod_retry( name string, rs *res_fmstat, host string, max_retries int ) {
+	p := inv.cache[name]
+	if p == nil || ! (*p).Is_pushed() || (*p).Is_paused() || (*p).Is_awaiting_approval() {
+		return
+	}
+
+	if rs.retries < max_retries {
+		rs.retries++
+		rm_sheep.Baa( 1, "reservation %s flow-mods not installed on %s; pushing again (%d of %d)", name, host, rs.retries, max_retries )
+		(*p).Reset_pushed()
+		return
+	}
+
+	if rs.event != "install_failed" {
+		rs.event = "install_failed"
+		rm_sheep.Baa( 0, "ERR: reservation %s flow-mods could not be installed on %s after %d attempts  [TGURMG009]", name, host, rs.retries + 1 )
+		publish_event( "reservation.install_failed", (*p).To_json() )
+	}
+}
+
+/*
+	Write an interim accounting record for each active bandwidth reservation.
+*/
+func (inv *Inventory) usage_poll( ) {
+	if acct_sink == nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	n := 0
+	for _, p := range inv.cache {
+		if p == nil || ! (*p).Is_active() || (*p).Is_paused() || (*p).Is_awaiting_approval() {
+			continue
+		}
+
+		if rec := acct_rec( p, "interim", now ); rec != "" {
+			acct_sink.send( rec )
+			n++
+		}
+	}
+
+	rm_sheep.Baa( 2, "interim accounting records written for %d reservations", n )
+}
+
+/*
+	Generate the status of the named reservation's flow-mods, and its phase (res_mgr_watch.go).
+	The cookie must be valid for the reservation; one on the retry list is included.
+*/
+func (inv *Inventory) fmstat_json( name *string, cookie *string ) ( jstr string, err error ) {
+	p, err := inv.Get_res( name, cookie )
+	if err != nil && inv.retry[*name] != nil {
+		p, err = inv.Get_retry_res( name, cookie )
+	}
+	if err != nil {
+		return "", err
+	}
+
+	list := make( []*fmod_stat, 0 )
+	retries := 0
+	event := ""
+	nat := map[string]string{}
+	verify := map[string]*verify_result{}
+	if rs := inv.fmstat[*name]; rs != nil {
+		keys := make( []string, 0, len( rs.fmods ) )
+		for k := range rs.fmods {
+			keys = append( keys, k )
+		}
+		sort.Strings( keys )
+		for _, k := range keys {
+			list = append( list, rs.fmods[k] )
+		}
+		retries = rs.retries
+		event = rs.event
+		if rs.nat != nil {
+			nat = rs.nat
+		}
+		if rs.verify != nil {
+			verify = rs.verify
+		}
+	}
+
+	jfm, err := json.Marshal( list )
+	if err != nil {
+		return "", err
+	}
+
+	jnat, err := json.Marshal( nat )
+	if err != nil {
+		return "", err
+	}
+
+	jver, err := json.Marshal( verify )
+	if err != nil {
+		return "", err
+	}
+
+	touched, nreqs := (*p).Get_touched()						// what res-mgr asked to have programmed (nil if not pushed)
+	if touched == nil {
+		touched = []gizmos.Touch{}
+	}
+	jtouch, err := json.Marshal( touched )
+	if err != nil {
+		return "", err
+	}
+
+	origin := "null"											// only admins see where the request came from
+	if cookie != nil && super_cookie != nil && *cookie == *super_cookie {
+		origin = (*p).Get_origin().To_json()
+	}
+
+	return fmt.Sprintf( `{ "id": %q, "state": %q, "pushed": %v, "paused": %v, "retries": %d, "last_event": %q, "fmods": %s, "nat_match": %s, "fmod_reqs": %d, "touched": %s, "verify": %s, "origin": %s }`,
+		*name, inv.res_phase( *name ), (*p).Is_pushed(), (*p).Is_paused(), retries, event, jfm, jnat, nreqs, jtouch, jver, origin ), nil
+}
@@ -0,0 +1,128 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_grace
+	Abstract:	Two step delete. When a grace period is configured a user's delete (single or
+				delete all) only marks the reservation; it stays active, and the owner may undo
+				the delete with the undelete request, until the grace period passes. It is then
+				deleted in the usual way (network capacity released and the expiry set a few
+				seconds out). Deletes that tegu does itself (rejection, consent refused, etc.)
+				are not delayed.
+
+				The pending state is not checkpointed; if tegu is restarted during the grace
+				period the reservation is not deleted.
+
+				Events are published when a delete is pending (reservation.delete_pending)
+				and when one is undone (reservation.delete_undone).
+
+	CFG:		resmgr:del_grace - seconds a deleted reservation remains before removal (0, no grace)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+	Delete a reservation on behalf of a user. With no grace period the reservation is deleted
+	now; otherwise it is marked and the time that it will be deleted is returned.
+*/
+func (inv *Inventory) user_del( name *string, cookie *string ) ( when int64, err error ) {
+	if inv.del_grace <= 0 {
+		return 0, inv.Del_res( name, cookie )
+	}
+
+	p, err := inv.Get_res( name, cookie )
+	if p == nil {
+		if err == nil {
+			err = mk_err( ERR_NOT_FOUND, "cannot find reservation: %s", *name )
+		}
+		return 0, err
+	}
+
+	if (*p).Is_expired() {
+		return 0, mk_err( ERR_NOT_FOUND, "reservation has expired: %s", *name )
+	}
+
+	if when = inv.doomed[*name]; when > 0 {
+		return when, nil										// already pending; the clock isn't restarted
+	}
+
+	when = time.Now().Unix() + inv.del_grace
+	inv.doomed[*name] = when
+	rm_sheep.Baa( 1, "reservation %s marked for deletion in %ds", *name, inv.del_grace )
+	publish_event( "reservation.delete_pending", fmt.Sprintf( `{ "id": %q, "name": %q, "delete_at": %d }`, *name, inv.res_label( *name ), when ) )
+	return when, nil
+}
+
+/*
+	Cancel a pending delete. The cookie must be valid for the reservation.
+*/
+func (inv *Inventory) undelete( name *string, cookie *string ) ( err error ) {
+	if _, err = inv.Get_res( name, cookie ); err != nil {
+		return err
+	}
+
+	if _, ok := inv.doomed[*name]; ! ok {
+		return mk_err( ERR_NOT_FOUND, "reservation is not pending deletion: %s", *name )
+	}
+
+	delete( inv.doomed, *name )
+	rm_sheep.Baa( 1, "pending delete of reservation %s was undone", *name )
+	publish_event( "reservation.delete_undone", fmt.Sprintf( `{ "id": %q, "name": %q }`, *name, inv.res_label( *name ) ) )
+	return nil
+}
+
+/*
+	Delete the reservations whose grace period has passed. Returns the number deleted so
+	that the caller knows whether a push is needed.
+*/
+func (inv *Inventory) reap_doomed( ) ( n int ) {
+	now := time.Now().Unix()
+	for name, when := range inv.doomed {
+		if when > now {
+			continue
+		}
+
+		delete( inv.doomed, name )
+		if p := inv.cache[name]; p == nil || (*p).Is_expired() {		// expired (or yanked) on its own during the grace period
+			continue
+		}
+
+		nm := name
+		if err := inv.Del_res( &nm, super_cookie ); err != nil {
+			rm_sheep.Baa( 1, "pending delete of reservation %s failed: %s", name, err )
+			continue
+		}
+		rm_sheep.Baa( 1, "reservation %s deleted; grace period passed", name )
+		n++
+	}
+
+	return n
+}
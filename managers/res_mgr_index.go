@@ -0,0 +1,455 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_index
+	Abstract:	Secondary indexes on the inventory so that reservations can be found by
+				something other than their id without walking the cache:
+					host	- host name as given on the reservation (project/vm)
+					vm		- vm id or name (host name without the project)
+					project	- project (tenant) id
+					dscp	- dscp value matched by the reservation
+					switch	- switch on one of the reservation's paths
+					link	- link on one of the reservation's paths
+					ip, mac	- address of one of the reservation's hosts
+					tag.key	- value of the user metadata key (gizmos/pledge_meta.go)
+					name	- user supplied name
+
+				An entry is indexed when it is added to the cache and dropped when it is
+				removed; a pledge whose path changes is indexed again. The addresses of the
+				hosts at the ends of a pledge's paths are indexed with the path. Hosts of
+				pledges without paths are looked up from the network manager by a goroutine
+				of their own (get_hostinfo waits on network) which sends the addresses to
+				res_mgr (REQ_HOST_ADDRS); they are kept for a few minutes and looked up again
+				when an ip or mac search finds them stale. A search answers with the addresses
+				known at the time.
+
+				Used only by the res_mgr goroutine; no locking.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Index user metadata as tag.key fields.
+				16 Oct 2026 - Index the user supplied name.
+				16 Oct 2026 - Added size() and shrink() for compaction.
+				16 Oct 2026 - Split idx_find() from search() for the timeline.
+				16 Oct 2026 - Addresses are taken from paths or looked up off of the res_mgr goroutine.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+const HOST_ADDR_TTL int64 = 300					// seconds host addresses are kept
+
+var idx_fields = map[string]bool{ "host": true, "vm": true, "project": true, "dscp": true, "switch": true, "link": true, "ip": true, "mac": true, "name": true }
+
+type idx_key struct {
+	field	string
+	value	string
+}
+
+type host_addrs struct {
+	ip		string
+	mac		string
+	ts		int64								// time looked up
+}
+
+type pledge_idx struct {
+	by		map[string]map[string]map[string]bool	// field -> value -> pledge ids
+	keys	map[string][]idx_key					// pledge id -> entries, for removal
+	addrs	map[string]*host_addrs					// host name -> addresses
+	unknown	map[string]bool							// hosts whose addresses need to be looked up
+	looking	bool									// a lookup is outstanding
+	rch		chan *ipc.Chmsg							// where lookup results are sent (res_mgr); none are made if nil
+}
+
+func mk_pledge_idx( ) ( *pledge_idx ) {
+	return &pledge_idx{
+		by:		make( map[string]map[string]map[string]bool ),
+		keys:	make( map[string][]idx_key, 4096 ),
+		addrs:	make( map[string]*host_addrs ),
+		unknown: make( map[string]bool ),
+	}
+}
+
+/*
+	Add one entry.
+*/
+func (px *pledge_idx) put( id string, field string, value string ) {
+	if value == "" {
+		return
+	}
+
+	vals := px.by[field]
+	if vals == nil {
+		vals = make( map[string]map[string]bool )
+		px.by[field] = vals
+	}
+	if vals[value] == nil {
+		vals[value] = make( map[string]bool )
+	}
+	if ! vals[value][id] {
+		vals[value][id] = true
+		px.keys[id] = append( px.keys[id], idx_key{ field, value } )
+	}
+}
+
+/*
+	Drop all entries for the pledge.
+*/
+func (px *pledge_idx) drop( id string ) {
+	for _, k := range px.keys[id] {
+		if ids := px.by[k.field][k.value]; ids != nil {
+			delete( ids, id )
+			if len( ids ) == 0 {
+				delete( px.by[k.field], k.value )
+			}
+		}
+	}
+	delete( px.keys, id )
+}
+
+/*
+	Return the number of pledges indexed, the number of field values and the number of
+	cached host addresses.
+*/
+func (px *pledge_idx) size( ) ( ids int, values int, addrs int ) {
+	for _, vals := range px.by {
+		values += len( vals )
+	}
+
+	return len( px.keys ), values, len( px.addrs )
+}
+
+/*
+	Copy the maps so that the space held by dropped entries is released. Addresses past
+	their ttl are forgotten.
+*/
+func (px *pledge_idx) shrink( now int64 ) {
+	by := make( map[string]map[string]map[string]bool, len( px.by ) )
+	for field, vals := range px.by {
+		if len( vals ) == 0 {
+			continue
+		}
+		nvals := make( map[string]map[string]bool, len( vals ) )
+		for v, ids := range vals {
+			nids := make( map[string]bool, len( ids ) )
+			for id := range ids {
+				nids[id] = true
+			}
+			nvals[v] = nids
+		}
+		by[field] = nvals
+	}
+	px.by = by
+
+	keys := make( map[string][]idx_key, len( px.keys ) )
+	for id, kl := range px.keys {
+		keys[id] = kl
+	}
+	px.keys = keys
+
+	addrs := make( map[string]*host_addrs, len( px.addrs ) )
+	for h, ha := range px.addrs {
+		if now - ha.ts <= HOST_ADDR_TTL {
+			addrs[h] = ha
+		}
+	}
+	px.addrs = addrs
+}
+
+/*
+	Index the pledge, replacing what was indexed for it before.
+*/
+func (px *pledge_idx) add( id string, p *gizmos.Pledge ) {
+	if px == nil || p == nil || strings.HasSuffix( id, ".yank" ) {
+		return
+	}
+
+	px.drop( id )
+
+	h1, h2 := (*p).Get_hosts()
+	for _, h := range []*string{ h1, h2 } {
+		if h == nil || *h == "" {
+			continue
+		}
+
+		px.put( id, "host", *h )
+		px.put( id, "project", host_project( h ) )
+
+		vm := strings.TrimLeft( *h, "!" )
+		if i := strings.LastIndex( vm, "/" ); i >= 0 {
+			vm = vm[i+1:]
+		}
+		if net.ParseIP( vm ) != nil {				// external or unnamed; the address is all there is
+			px.put( id, "ip", vm )
+		} else {
+			px.put( id, "vm", vm )
+		}
+	}
+
+	for k, v := range (*p).Get_meta() {
+		px.put( id, "tag." + k, v )
+	}
+	if n, _ := (*p).Get_name(); n != "" {
+		px.put( id, "name", n )
+	}
+
+	var plist []*gizmos.Path
+	switch pldg := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			d, _ := pldg.Get_dscp()
+			if d > 0 {
+				px.put( id, "dscp", fmt.Sprintf( "%d", d ) )
+			}
+			plist = pldg.Get_path_list()
+
+		case *gizmos.Pledge_bwow:
+			if d := pldg.Get_dscp(); d > 0 {
+				px.put( id, "dscp", fmt.Sprintf( "%d", d ) )
+			}
+
+		case *gizmos.Pledge_mcast:
+			if d := pldg.Get_dscp(); d > 0 {
+				px.put( id, "dscp", fmt.Sprintf( "%d", d ) )
+			}
+			plist = pldg.Get_path_list()
+	}
+
+	for _, path := range plist {
+		for _, sw := range path.Get_switch_ids() {
+			px.put( id, "switch", sw )
+		}
+		for _, l := range path.Get_link_ids() {
+			px.put( id, "link", l )
+		}
+		h1, h2 := path.Get_hosts()
+		for _, ph := range []*gizmos.Host{ h1, h2 } {
+			if ph == nil {
+				continue
+			}
+			ip4, ip6 := ph.Get_addresses()			// empty ones aren't indexed
+			px.put( id, "ip", *ip4 )
+			px.put( id, "ip", *ip6 )
+			px.put( id, "mac", strings.ToLower( *ph.Get_mac() ) )
+		}
+	}
+
+	if len( plist ) == 0 {
+		for _, h := range []*string{ h1, h2 } {
+			if h != nil && addr_host( *h ) && px.addrs[*h] == nil {
+				px.unknown[*h] = true
+			}
+		}
+		px.lookup( )
+	}
+}
+
+/*
+	Return true if the host is one that network can give addresses for; external hosts and
+	those named by address aren't.
+*/
+func addr_host( h string ) ( bool ) {
+	if h == "" || strings.HasPrefix( h, "!" ) {
+		return false
+	}
+	if i := strings.LastIndex( h, "/" ); i >= 0 {
+		h = h[i+1:]
+	}
+
+	return net.ParseIP( h ) == nil
+}
+
+/*
+	Start a goroutine to look up the addresses of the hosts that need them unless one is
+	already running. The results come back to res_mgr which gives them to set_addrs().
+*/
+func (px *pledge_idx) lookup( ) {
+	if px.looking || px.rch == nil || len( px.unknown ) == 0 {
+		return
+	}
+
+	hosts := make( []string, 0, len( px.unknown ) )
+	for h := range px.unknown {
+		hosts = append( hosts, h )
+	}
+	px.unknown = make( map[string]bool )
+	px.looking = true
+
+	go func( ) {
+		found := make( map[string]*host_addrs, len( hosts ) )
+		for _, h := range hosts {
+			hn := h
+			ha := &host_addrs{ }
+			if ip, mac, _, _ := get_hostinfo( &hn ); ip != nil {
+				ha.ip = *ip
+				ha.mac = *mac
+			}
+			ha.ts = time.Now().Unix()
+			found[h] = ha
+		}
+
+		msg := ipc.Mk_chmsg( )
+		msg.Send_req( px.rch, nil, REQ_HOST_ADDRS, found, nil )
+	}( )
+}
+
+/*
+	Keep the addresses from a lookup, forgetting hosts that are no longer on any reservation,
+	and start another lookup if hosts were queued while this one ran.
+*/
+func (px *pledge_idx) set_addrs( found map[string]*host_addrs ) {
+	px.looking = false
+	for h, ha := range found {
+		if px.by["host"][h] != nil {
+			px.addrs[h] = ha
+		}
+	}
+
+	for h := range px.addrs {
+		if px.by["host"][h] == nil {
+			delete( px.addrs, h )
+		}
+	}
+
+	px.lookup( )
+}
+
+/*
+	Return the ids of pledges having a host with the address (ip or mac). Only addresses
+	already known are used; those that are stale, or hosts never looked up, are queued for
+	a lookup so that a later search will have them. Nothing here waits on network.
+*/
+func (px *pledge_idx) by_addr( field string, addr string ) ( map[string]bool ) {
+	now := time.Now().Unix()
+	found := make( map[string]bool )
+
+	if field == "mac" {
+		addr = strings.ToLower( addr )
+	}
+	for id := range px.by[field][addr] {			// indexed directly (path ends, external addresses)
+		found[id] = true
+	}
+
+	for h, ids := range px.by["host"] {
+		ha := px.addrs[h]
+		if ! px.looking && (ha == nil || now - ha.ts > HOST_ADDR_TTL) && addr_host( h ) {		// if looking, the next search queues it
+			px.unknown[h] = true
+		}
+		if ha == nil {
+			continue
+		}
+
+		if (field == "ip" && ha.ip == addr) || (field == "mac" && strings.EqualFold( ha.mac, addr )) {
+			for id := range ids {
+				found[id] = true
+			}
+		}
+	}
+
+	px.lookup( )
+	return found
+}
+
+/*
+	Return the ids of the pledges matching all of the field/value pairs given.
+*/
+func (inv *Inventory) idx_find( q map[string]string ) ( map[string]bool, error ) {
+	var found map[string]bool
+	for field, value := range q {
+		if ! idx_fields[field] && ! strings.HasPrefix( field, "tag." ) {
+			return nil, mk_err( ERR_BAD_REQUEST, "unknown search field: %s", field )
+		}
+
+		var ids map[string]bool
+		if field == "ip" || field == "mac" {
+			ids = inv.idx.by_addr( field, value )
+		} else {
+			ids = inv.idx.by[field][value]
+		}
+
+		if found == nil {
+			found = make( map[string]bool, len( ids ) )
+			for id := range ids {
+				found[id] = true
+			}
+		} else {
+			for id := range found {
+				if ! ids[id] {
+					delete( found, id )
+				}
+			}
+		}
+	}
+
+	return found, nil
+}
+
+/*
+	Find the reservations matching all of the field/value pairs given. Full information is
+	given only for those that the cookie is valid for (see res2json). Expired reservations
+	aren't listed.
+*/
+func (inv *Inventory) search( q map[string]string, cookie *string ) ( string, error ) {
+	if len( q ) == 0 {
+		return "", mk_err( ERR_BAD_REQUEST, "no search fields given" )
+	}
+
+	found, err := inv.idx_find( q )
+	if err != nil {
+		return "", err
+	}
+
+	names := make( []string, 0, len( found ) )
+	for id := range found {
+		if p := inv.cache[id]; p != nil && ! (*p).Is_expired() {
+			names = append( names, id )
+		}
+	}
+	sort.Strings( names )
+
+	all := cookie != nil && super_cookie != nil && *cookie == *super_cookie
+	jstr := `{ "reservations": [ `
+	sep := ""
+	for _, id := range names {
+		p := inv.cache[id]
+		if all || (*p).Is_valid_cookie( cookie ) {
+			jstr += sep + (*p).To_json()
+		} else {
+			jstr += sep + elided_json( p )
+		}
+		sep = ", "
+	}
+	jstr += " ] }"
+
+	rm_sheep.Baa( 2, "search %v: %d reservations", q, len( names ) )
+	return jstr, nil
+}
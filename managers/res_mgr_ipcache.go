@@ -0,0 +1,184 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_ipcache
+	Abstract:	Name to IP address translations kept for a few seconds by res-mgr. The push
+				functions translate the hosts of each pledge (name2ip) and each translation
+				was a round trip to network manager; a push of hundreds of reservations was
+				hundreds of round trips one after the other.
+
+				Before a push, the hosts of the pledges that are about to be pushed are sent
+				to network manager in one REQ_GETIPS request and the answers are kept; name2ip
+				uses a kept answer if there is one and it hasn't expired, and asks network
+				manager (and keeps the answer) otherwise. Names that could not be translated
+				are not kept so that they are tried again by name2ip.
+
+				Answers are kept for resmgr:ip_cache seconds; long enough for a push cycle,
+				short enough that a VM which has a new address is soon noticed. The cache may
+				be used by the recovery workers as well as res-mgr so it is locked.
+
+	CFG:		resmgr:ip_cache - seconds that translations are kept; 0 disables (5)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type ip_entry struct {
+	ip		*string
+	expiry	int64
+}
+
+type ip_cache struct {
+	mu		sync.Mutex
+	ttl		int64
+	ips		map[string]*ip_entry
+
+	hits	int64
+	misses	int64
+	batches	int64
+}
+
+var rm_ips	*ip_cache				// nil when disabled
+
+/*
+	Create the cache from the config. Called when res-mgr starts.
+*/
+func ip_cache_init( ) {
+	ttl := int64( 5 )
+	if cfg_data["resmgr"] != nil {
+		if p := cfg_data["resmgr"]["ip_cache"]; p != nil {
+			ttl = clike.Atoi64( *p )
+		}
+	}
+
+	if ttl <= 0 {
+		rm_sheep.Baa( 1, "name to address translations are not cached" )
+		return
+	}
+
+	rm_ips = &ip_cache{ ttl: ttl, ips: make( map[string]*ip_entry ) }
+	rm_sheep.Baa( 1, "name to address translations are kept for %ds", ttl )
+}
+
+/*
+	Return the address kept for the name, nil if there isn't one.
+*/
+func (ic *ip_cache) get( name string ) ( *string ) {
+	if ic == nil {
+		return nil
+	}
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	if e := ic.ips[name]; e != nil {
+		if e.expiry > time.Now().Unix() {
+			ic.hits++
+			return e.ip
+		}
+		delete( ic.ips, name )
+	}
+
+	ic.misses++
+	return nil
+}
+
+func (ic *ip_cache) put( name string, ip *string ) {
+	if ic == nil || ip == nil {
+		return
+	}
+
+	ic.mu.Lock()
+	ic.ips[name] = &ip_entry{ ip: ip, expiry: time.Now().Unix() + ic.ttl }
+	ic.mu.Unlock()
+}
+
+/*
+	Translate, in one request to network manager, those names that aren't already kept.
+*/
+func (ic *ip_cache) prefetch( names map[string]bool ) {
+	if ic == nil || len( names ) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	want := make( []string, 0, len( names ) )
+	ic.mu.Lock()
+	for name := range names {
+		if e := ic.ips[name]; e == nil || e.expiry <= now {
+			want = append( want, name )
+		}
+	}
+	ic.mu.Unlock()
+	if len( want ) == 0 {
+		return
+	}
+
+	ch := make( chan *ipc.Chmsg, 1 )
+	net_prov.Post( REQ_GETIPS, want, ch )
+	msg := <- ch
+	if msg.State != nil {
+		rm_sheep.Baa( 1, "batch translation of %d names failed: %s", len( want ), msg.State )
+		return
+	}
+
+	found := msg.Response_data.( map[string]*string )
+	expiry := time.Now().Unix() + ic.ttl
+	ic.mu.Lock()
+	for name, ip := range found {
+		ic.ips[name] = &ip_entry{ ip: ip, expiry: expiry }
+	}
+	for name, e := range ic.ips {							// keep it from growing with names no longer used
+		if e.expiry <= now {
+			delete( ic.ips, name )
+		}
+	}
+	ic.batches++
+	ic.mu.Unlock()
+
+	rm_sheep.Baa( 2, "batch translation: %d of %d names translated", len( found ), len( want ) )
+}
+
+/*
+	Add the hosts of the pledge to the set of names to translate.
+*/
+func push_names( names map[string]bool, p gizmos.Pledge ) {
+	h1, h2 := p.Get_hosts()
+	for _, h := range []*string{ h1, h2 } {
+		if h != nil && *h != "" {
+			names[*h] = true
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_kinds
+	Abstract:	Admission and push functions for the built-in pledge kinds which are attached
+				to the gizmos pledge registry (pledge_reg.go). Push_reservations() and the
+				checkpoint vetting invoke these through the registry so a new kind of pledge
+				can be added by registering it with its own functions.
+
+				Admission is done when a pledge is loaded from a checkpoint or moved from the
+				retry list: the network must again find a path (bandwidth), gate (oneway) or
+				physical host (passthru) or tree (multicast), or the middleboxes (steering) for it. A non-nil error causes the pledge to be put
+				on the retry list.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Added multicast.
+				16 Oct 2026 - Network requests time out (ipc_ctx.go).
+				16 Oct 2026 - Added dscp trust (res_mgr_trust.go).
+				16 Oct 2026 - Steering pledges are admitted (admit_steer in res_mgr_steer.go).
+*/
+
+package managers
+
+import (
+	"fmt"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Context passed to the push functions by push_reservations().
+*/
+type push_ctx struct {
+	inv			*Inventory
+	ch			chan *ipc.Chmsg
+	alt_table	int
+	hto_limit	int64
+	pref_v6		bool
+	nbw			int						// counts for the summary bleat
+	nst			int
+}
+
+/*
+	Attach our functions to the built-in kinds. Called once when res-mgr starts.
+*/
+func register_pledge_ops( ) {
+	gizmos.Set_pledge_ops( gizmos.PT_BANDWIDTH, admit_bw, push_bw )
+	gizmos.Set_pledge_ops( gizmos.PT_OWBANDWIDTH, admit_bwow, push_bwow )
+	gizmos.Set_pledge_ops( gizmos.PT_MIRRORING, nil, push_mirror )
+	gizmos.Set_pledge_ops( gizmos.PT_STEERING, admit_steer, push_steer )
+	gizmos.Set_pledge_ops( gizmos.PT_PASSTHRU, admit_pass, push_pass )
+	gizmos.Set_pledge_ops( gizmos.PT_MULTICAST, admit_mcast, push_mcast )
+	gizmos.Set_pledge_ops( gizmos.PT_TRUST, admit_trust, push_trust )
+}
+
+// ---- push -----------------------------------------------------------------------------
+
+func push_bw( p *gizmos.Pledge, rname *string, ctx interface{} ) {
+	pc := ctx.( *push_ctx )
+	pc.nbw++
+	bw_push_res( p, rname, pc.ch, pc.hto_limit, pc.alt_table, pc.pref_v6 )
+	pc.inv.handover( p )								// if this replaces another, the old one can go now that the new fmods are out
+}
+
+func push_bwow( p *gizmos.Pledge, rname *string, ctx interface{} ) {
+	pc := ctx.( *push_ctx )
+	bwow_push_res( p, rname, pc.ch, pc.hto_limit, pc.pref_v6 )
+	(*p).Set_pushed( )
+}
+
+func push_steer( p *gizmos.Pledge, rname *string, ctx interface{} ) {
+	pc := ctx.( *push_ctx )
+	pc.nst++
+	push_st_reservation( p, *rname, pc.ch, pc.hto_limit )
+}
+
+func push_mirror( p *gizmos.Pledge, rname *string, ctx interface{} ) {
+	push_mirror_reservation( p, *rname, ctx.( *push_ctx ).ch )
+}
+
+func push_pass( p *gizmos.Pledge, rname *string, ctx interface{} ) {
+	pc := ctx.( *push_ctx )
+	pass_push_res( p, rname, pc.ch, pc.hto_limit )
+}
+
+func push_mcast( p *gizmos.Pledge, rname *string, ctx interface{} ) {
+	pc := ctx.( *push_ctx )
+	pc.nbw++
+	mcast_push_res( p, rname, pc.hto_limit, pc.pref_v6 )
+}
+
+// ---- admission ------------------------------------------------------------------------
+
+/*
+	Find a path for a bandwidth pledge.
+*/
+func admit_bw( p *gizmos.Pledge ) ( error ) {
+	sp := (*p).( *gizmos.Pledge_bw )
+	h1, h2 := sp.Get_hosts( )							// get the host names, fetch ostack data and update graph
+	update_graph( h1, false, false )					// don't need to block on this one, nor update fqmgr
+	update_graph( h2, true, true )						// wait for netmgr to update graph and then push related data to fqmgr
+
+	rm_sheep.Baa( 2, "reserving path starts" )
+	req := nw_req( REQ_BW_RESERVE, sp, release_late( sp ) )	// now safe to ask netmgr to find a path; should be OK, but the underlying network could have changed
+
+	if req.Response_data == nil {
+		return fmt.Errorf( "unable to reserve for pledge: %s", (*p).To_str() )
+	}
+
+	rm_sheep.Baa( 2, "reserving path finished" )
+	path_list := req.Response_data.( []*gizmos.Path )	// path(s) that were found to be suitable for the reservation
+	sp.Set_path_list( path_list )
+	rm_sheep.Baa( 1, "path allocated for chkptd reservation: %s %s %s; path length= %d", *(sp.Get_id()), *h1, *h2, len( path_list ) )
+	return nil
+}
+
+/*
+	Find a gate for a oneway pledge.
+*/
+func admit_bwow( p *gizmos.Pledge ) ( error ) {
+	sp := (*p).( *gizmos.Pledge_bwow )
+	h1, h2 := sp.Get_hosts( )							// get the host names, fetch ostack data and update graph
+	push_block := h2 == nil
+	update_graph( h1, push_block, push_block )			// dig h1 info; push to netmgr if h2 isn't known and block on response
+	if h2 != nil {
+		update_graph( h2, true, true )					// dig h2 data and push to netmgr blocking for a netmgr response
+	}
+
+	req := nw_req( REQ_BWOW_RESERVE, sp, release_late( sp ) )	// now safe to ask netmgr to validate the oneway pledge
+
+	if req.Response_data == nil {
+		return fmt.Errorf( "unable to reserve for oneway pledge: %s", (*p).To_str() )
+	}
+
+	gate := req.Response_data.( *gizmos.Gate )			// expect that network sent us a gate
+	sp.Set_gate( gate )
+
+	gate_ip := "nil"
+	if gipp := gate.Get_extip(); gipp != nil {
+		gate_ip = *gipp
+	}
+	h2s := "nil"
+	if h2 != nil {
+		h2s = *h2
+	}
+	rm_sheep.Baa( 1, "gate allocated for oneway reservation: %s h1=%s h2=%s gate_ip=%s", *(sp.Get_id()), *h1, h2s, gate_ip )
+	return nil
+}
+
+/*
+	Find the physical host of a passthru pledge's VM.
+*/
+func admit_pass( p *gizmos.Pledge ) ( error ) {
+	sp := (*p).( *gizmos.Pledge_pass )
+	host, _ := sp.Get_hosts()
+	update_graph( host, true, true )
+
+	req := nw_req( REQ_GETPHOST, host, nil )			// need to find the current phost for the vm
+
+	if req.Response_data == nil {
+		s := fmt.Errorf( "unknown reason" )
+		if req.State != nil {
+			s = req.State
+		}
+		rm_sheep.Baa( 0, "erroring passthru pledge: %s", (*p).To_str() )
+		return fmt.Errorf( "unable to find phost for passthru pledge: %s", s )
+	}
+
+	phost := req.Response_data.( *string  )
+	sp.Set_phost( phost )
+	rm_sheep.Baa( 1, "passthrou phost found  for chkptd reservation: %s %s %s", *(sp.Get_id()), *host, *phost )
+	return nil
+}
+
+/*
+	Find the tree (a path to each receiver) for a multicast pledge.
+*/
+func admit_mcast( p *gizmos.Pledge ) ( error ) {
+	sp := (*p).( *gizmos.Pledge_mcast )
+	src, _ := sp.Get_hosts( )
+	update_graph( src, false, false )
+	rcvrs := sp.Get_receivers( )
+	for i, r := range rcvrs {
+		last := i == len( rcvrs ) - 1
+		update_graph( r, last, last )					// block on the last so the graph has them all
+	}
+
+	req := nw_req( REQ_MCAST_RESERVE, sp, release_late( sp ) )
+
+	if req.Response_data == nil {
+		return fmt.Errorf( "unable to reserve for multicast pledge: %s: %v", (*p).To_str(), req.State )
+	}
+
+	path_list := req.Response_data.( []*gizmos.Path )
+	sp.Set_path_list( path_list )
+	rm_sheep.Baa( 1, "tree allocated for chkptd multicast reservation: %s %s; branches= %d", *(sp.Get_id()), *src, len( path_list ) )
+	return nil
+}
@@ -0,0 +1,354 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_label
+	Abstract:	Label selectors. A host on a reserve request may be given as a selector of the
+				form project/@key.value (http_label.go) which is expanded into one bandwidth
+				reservation for each VM in the project that carries the label in its instance
+				metadata (osif_label.go).
+
+				The selector is kept by res-mgr and checkpointed (lsel: records). Its members
+				are ordinary pledges which carry the selector's id, so nothing more is needed to
+				find them after a restart; the member VM is the host on the selector side of the
+				pledge. Each time osif reads the labels (REQ_SEL_EVAL) the selectors are handed
+				to the worker goroutine which asks osif for the VMs that have the label, creates
+				a reservation for those that don't have one, and cancels those of VMs which no
+				longer have the label. The worker can't run on the res-mgr goroutine as it sends
+				the new reservations, and deletes, to res-mgr.
+
+				Selectors are dropped when they expire. Cancelling the selector's id removes the
+				selector and all of its members. A member cancelled on its own is created again
+				the next time the selector is evaluated if the VM still has the label.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+*/
+
+package managers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	MAX_SEL_JOBS	int = 256					// selector evaluations queued for the worker
+)
+
+/*
+	A selector and the reservation parameters that are applied to each VM that it matches.
+	Fields are exported only so that the json package can build the checkpoint record.
+*/
+type label_sel struct {
+	Id			string
+	Project		string				// project ID that the selector is confined to
+	Key			string
+	Value		string
+	Other		string				// the other (non-selector) host
+	Oport		string				// transport port and vlan for the other host
+	Ovlan		string
+	Sel_first	bool				// selector was h1 on the request
+	Commence	int64
+	Expiry		int64
+	Bandw_in	int64
+	Bandw_out	int64
+	Cookie		string
+	Dscp		int
+	Dscp_koe	bool
+	Proto		string
+	Cid			string				// correlation id of the request that created the selector
+}
+
+/*
+	An evaluation for the worker. Rch, if not nil, is the channel of the request that
+	added the selector; it is sent the counts of reservations created and failed.
+*/
+type sel_job struct {
+	sel		label_sel				// copy; the inventory's may change while the worker runs
+	rch		chan *ipc.Chmsg
+}
+
+/*
+	Add a selector and queue its first evaluation.
+*/
+func (inv *Inventory) add_selector( sel *label_sel, rch chan *ipc.Chmsg ) ( err error ) {
+	if inv.selectors[sel.Id] != nil {
+		return mk_err( ERR_DUPLICATE, "selector already exists: %s", sel.Id )
+	}
+	if ! inv.sel_eval( sel, rch ) {
+		return mk_err( ERR_BUSY, "too many selector evaluations queued; try again later" )
+	}
+
+	inv.selectors[sel.Id] = sel
+	rm_sheep.Baa( 1, "selector %s added: %s/@%s.%s paired with %s", sel.Id, sel.Project, sel.Key, sel.Value, sel.Other )
+	return nil
+}
+
+/*
+	Queue an evaluation of the selector for the worker. Returns false if the queue is full.
+*/
+func (inv *Inventory) sel_eval( sel *label_sel, rch chan *ipc.Chmsg ) ( bool ) {
+	select {
+		case inv.sel_jobs <- &sel_job{ sel: *sel, rch: rch }:
+			return true
+
+		default:
+			rm_sheep.Baa( 1, "selector %s: evaluation skipped: worker queue is full", sel.Id )
+			return false
+	}
+}
+
+/*
+	Drop expired selectors and queue an evaluation of the others. Returns true if any were
+	dropped (the checkpoint should be written).
+*/
+func (inv *Inventory) eval_selectors( ) ( dropped bool ) {
+	now := time.Now().Unix()
+	for id, sel := range inv.selectors {
+		if sel.Expiry <= now {
+			rm_sheep.Baa( 1, "selector %s expired", id )
+			delete( inv.selectors, id )
+			dropped = true
+		} else {
+			inv.sel_eval( sel, nil )
+		}
+	}
+
+	return dropped
+}
+
+/*
+	Return the current members of the selector: VM to reservation id. Members pending
+	deletion are left out.
+*/
+func (inv *Inventory) sel_members( id string ) ( members map[string]string, err error ) {
+	sel := inv.selectors[id]
+	if sel == nil {
+		return nil, mk_err( ERR_NOT_FOUND, "selector no longer exists: %s", id )
+	}
+
+	members = make( map[string]string )
+	for name, p := range inv.cache {
+		bp, ok := (*p).( *gizmos.Pledge_bw )
+		if !ok || bp.Get_selector() != id || bp.Is_expired() || inv.doomed[name] > 0 {
+			continue
+		}
+
+		h1, h2 := bp.Get_hosts()
+		if sel.Sel_first {
+			members[*h1] = name
+		} else {
+			members[*h2] = name
+		}
+	}
+
+	return members, nil
+}
+
+/*
+	Delete the selector and all of its members. The cookie must be the one given when the
+	selector was created, or the super cookie.
+*/
+func (inv *Inventory) del_selector( id string, cookie *string ) ( err error ) {
+	sel := inv.selectors[id]
+	if sel == nil {
+		return mk_err( ERR_NOT_FOUND, "cannot find selector: %s", id )
+	}
+	if (cookie == nil || *cookie != sel.Cookie) && (cookie == nil || super_cookie == nil || *cookie != *super_cookie) {
+		return mk_err( ERR_NOT_AUTHORISED, "cookie is not valid for selector: %s", id )
+	}
+
+	members, _ := inv.sel_members( id )
+	delete( inv.selectors, id )
+	for vm, name := range members {
+		if _, err := inv.user_del( &name, cookie ); err != nil {
+			rm_sheep.Baa( 1, "selector %s: unable to cancel reservation %s for %s: %s", id, name, vm, err )
+		}
+	}
+
+	rm_sheep.Baa( 1, "selector %s deleted with %d reservations", id, len( members ) )
+	return nil
+}
+
+/*
+	Generate the checkpoint records for the selectors.
+*/
+func (inv *Inventory) selector_recs( ) ( recs []string ) {
+	recs = make( []string, 0, len( inv.selectors ) )
+	for _, sel := range inv.selectors {
+		if jb, err := json.Marshal( sel ); err == nil {
+			recs = append( recs, "lsel: " + string( jb ) )
+		}
+	}
+
+	return recs
+}
+
+/*
+	Restore a selector from the json of a checkpoint record.
+*/
+func (inv *Inventory) load_selector( jstr string ) ( err error ) {
+	sel := &label_sel{ }
+	if err = json.Unmarshal( []byte( jstr ), sel ); err != nil {
+		return err
+	}
+	if sel.Id == "" {
+		return fmt.Errorf( "selector has no id" )
+	}
+
+	inv.selectors[sel.Id] = sel
+	return nil
+}
+
+/*
+	Runs as a goroutine to evaluate the selectors queued by res-mgr. If the first evaluation
+	of a new selector fails it is deleted and the error returned to the requester.
+*/
+func sel_worker( jobs chan *sel_job ) {
+	for job := range jobs {
+		nadded, nfailed, err := job.sel.evaluate( )
+		if job.rch != nil {
+			if err != nil {										// first evaluation; the selector isn't kept if the labels couldn't be had
+				dmsg := ipc.Mk_chmsg( )
+				dmsg.Send_req( rmgr_ch, nil, REQ_DEL, []*string{ &job.sel.Id, &job.sel.Cookie }, nil )
+			}
+
+			rmsg := ipc.Mk_chmsg( )
+			rmsg.Response_data = []int{ nadded, nfailed }
+			rmsg.State = err
+			job.rch <- rmsg
+		}
+	}
+}
+
+/*
+	Bring the selector's members in line with the VMs that have the label. Returns the
+	number of reservations added and the number that couldn't be.
+*/
+func (sel *label_sel) evaluate( ) ( nadded int, nfailed int, err error ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( osif_ch, my_ch, REQ_LABEL_VMS, []string{ sel.Project, sel.Key, sel.Value }, nil )
+	req = <- my_ch
+	if req.State != nil {
+		return 0, 0, req.State
+	}
+	current := req.Response_data.( []string )
+
+	req = ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_SEL_MEMBERS, sel.Id, nil )
+	req = <- my_ch
+	if req.State != nil {
+		return 0, 0, req.State						// deleted or expired since it was queued
+	}
+	members := req.Response_data.( map[string]string )
+
+	cmap := make( map[string]bool, len( current ) )
+	for _, vm := range current {
+		cmap[vm] = true
+		if _, ok := members[vm]; !ok {
+			rid, err := sel.add_member( vm )
+			if err == nil {
+				nadded++
+				rm_sheep.Baa( 1, "selector %s: reservation %s added for %s (%s=%s)", sel.Id, rid, vm, sel.Key, sel.Value )
+			} else {
+				nfailed++
+				rm_sheep.Baa( 1, "selector %s: unable to add reservation for %s: %s", sel.Id, vm, err )
+			}
+		}
+	}
+
+	for vm, rid := range members {
+		if !cmap[vm] {
+			sel.drop_member( vm, rid )
+		}
+	}
+
+	return nadded, nfailed, nil
+}
+
+/*
+	Create and finalise the reservation for a single member of the selector. Returns the
+	reservation id on success.
+*/
+func (sel *label_sel) add_member( vm string ) ( rid string, err error ) {
+	h1 := vm
+	h2 := sel.Other
+	p1 := zero_string
+	p2 := sel.Oport
+	v1 := empty_str
+	v2 := sel.Ovlan
+	if ! sel.Sel_first {
+		h1, h2 = h2, h1
+		p1, p2 = p2, p1
+		v1, v2 = v2, v1
+	}
+
+	update_graph( &h1, false, false )
+	update_graph( &h2, true, true )
+
+	commence := sel.Commence
+	if now := time.Now().Unix(); commence < now {
+		commence = now
+	}
+
+	rid = mk_resname( )
+	res, err := gizmos.Mk_bw_pledge( &h1, &h2, &p1, &p2, commence, sel.Expiry, sel.Bandw_in, sel.Bandw_out, &rid, &sel.Cookie, sel.Dscp, sel.Dscp_koe )
+	if err != nil {
+		return
+	}
+	res.Set_vlan( &v1, &v2 )
+	if sel.Proto != "" {
+		res.Add_proto( &sel.Proto )
+	}
+	res.Set_cid( sel.Cid )
+	res.Set_selector( sel.Id )
+
+	reason, _, nerr, code := finalise_bw_res( context.Background(), res, res_paused )
+	if nerr > 0 {
+		err = mk_err( code, "%s", reason )
+	}
+
+	return
+}
+
+/*
+	Cancel the reservation of a member whose VM no longer has the label.
+*/
+func (sel *label_sel) drop_member( vm string, rid string ) {
+	my_ch := make( chan *ipc.Chmsg )
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_DEL, []*string{ &rid, &sel.Cookie }, nil )
+	req = <- my_ch
+	if req.State != nil {
+		rm_sheep.Baa( 1, "selector %s: unable to cancel reservation %s for %s: %s", sel.Id, rid, vm, req.State )
+	} else {
+		rm_sheep.Baa( 1, "selector %s: cancelled reservation %s; %s no longer has %s=%s", sel.Id, rid, vm, sel.Key, sel.Value )
+	}
+}
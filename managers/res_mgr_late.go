@@ -0,0 +1,106 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_late
+	Abstract:	Reservations whose window had started before tegu was started. Such a pledge
+				became active while tegu was down (or was active when it went down); when it is
+				reloaded from the checkpoint its commence time is moved forward to the reload time,
+				so the queue timeslices obligated for it cover only what remains of the window, and
+				its flow-mods are pushed with the reservation's own expiry.
+
+				At push time a reservation which started late is either pushed, with a
+				reservation.late_start event giving the commence asked for and the seconds that
+				remain, or, when less than late_min seconds remain, it is deleted rather than
+				pushed and a reservation.late_skipped event explains why. Deleting, rather than
+				simply ignoring, releases its capacity in the network and forces out any of its
+				flow-mods which are still on the switches from before the restart.
+
+				Pledges made through the API with a commence time in the past are not treated as
+				late unless that time is before tegu was started.
+
+	CFG:		resmgr:late_min - seconds of the window which must remain for a reservation that
+					started while tegu was down to be pushed (60)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+var (
+	late_min	int64 = 60				// seconds that must remain to push a late reservation
+	rm_started	int64 = 0				// when res_mgr started; commence times before this are late
+)
+
+/*
+	Read the config and note the start time.
+*/
+func late_init( ) {
+	rm_started = time.Now().Unix()
+
+	if cfg_data["resmgr"] != nil {
+		if p := cfg_data["resmgr"]["late_min"]; p != nil {
+			late_min = clike.Atoi64( *p )
+		}
+	}
+}
+
+/*
+	Deal with a pledge, about to be pushed, whose window started before res_mgr did. Returns
+	true if the pledge was deleted and must not be pushed. A pledge is dealt with only
+	once; later pushes (refresh, pause) are left alone.
+*/
+func (inv *Inventory) late_hold( rname string, p *gizmos.Pledge ) ( bool ) {
+	asked := (*p).Get_late_start()
+	if asked <= 0 || asked >= rm_started {
+		return false
+	}
+	(*p).Clear_late_start()
+
+	now := time.Now().Unix()
+	_, expiry := (*p).Get_window()
+	remain := expiry - now
+	if remain >= late_min {
+		rm_sheep.Baa( 1, "reservation started while tegu was down; pushed with %ds of its window left: %s commence=%d", remain, rname, asked )
+		publish_event( "reservation.late_start", fmt.Sprintf( `{ "id": %q, "name": %q, "commence": %d, "pushed": %d, "remaining": %d }`, rname, inv.res_label( rname ), asked, now, remain ) )
+		return false
+	}
+
+	rm_sheep.Baa( 0, "WRN: reservation started while tegu was down and only %ds of its window remain (late_min=%d); deleted, not pushed: %s  [TGURMG028]", remain, late_min, rname )
+	publish_event( "reservation.late_skipped", fmt.Sprintf( `{ "id": %q, "name": %q, "commence": %d, "remaining": %d, "late_min": %d }`, rname, inv.res_label( rname ), asked, remain, late_min ) )
+
+	name := rname
+	if err := inv.Del_res( &name, super_cookie ); err != nil {
+		rm_sheep.Baa( 1, "unable to delete late reservation %s: %s", rname, err )
+	}
+	return true
+}
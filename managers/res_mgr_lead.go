@@ -0,0 +1,181 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_lead
+	Abstract:	Activation lead time and the short expiry times used to force flow-mods out.
+				A reservation is pushed when it is active, or will be within the lead time, so
+				that the flow-mods are in place at commence. Flow-mods for a paused reservation,
+				and for one that has been deleted or replaced, are sent with an expiry a few
+				seconds out which pushes the existing flow-mods out of the switch.
+
+				Each can be set for the deployment and overridden for a kind of pledge using
+				the kind's listing name (bandwidth, oneway, mirror, steering, passthru,
+				multicast) as a suffix (e.g. activate_lead_mirror = 30).
+
+				The timestamp used to find a reservation's queues in the network timeslices
+				is taken from the reservation's commence time; when pushed early, the current
+				time isn't in the reservation's slice.
+
+				Values are read once at start; used only by the res_mgr goroutine.
+
+	CFG:		resmgr:activate_lead[_kind] - seconds before commence that a reservation is pushed (15)
+				resmgr:pause_expiry[_kind] - flow-mod expiry (seconds from now) when paused in expiry
+					pause mode (15)
+				resmgr:delete_expiry[_kind] - flow-mod expiry (seconds from now) when deleted or replaced (15)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+type lead_times struct {
+	lead	int64						// push this many seconds before commence
+	pause	int64						// expiry stub for paused reservations
+	del		int64						// expiry stub for deleted/replaced reservations
+}
+
+var (
+	def_leads	= lead_times{ lead: 15, pause: 15, del: 15 }
+	kind_leads	= make( map[string]*lead_times )		// per kind overrides keyed by kind name
+)
+
+/*
+	Set one value from the config; the value must be >= min or it is ignored.
+*/
+func set_lead( dest *int64, key string, val string, min int64 ) {
+	v := clike.Atoi64( val )
+	if v < min {
+		rm_sheep.Baa( 0, "WRN: resmgr:%s must be at least %d; ignored: %s  [TGURMG014]", key, min, val )
+		return
+	}
+
+	*dest = v
+}
+
+/*
+	Read the config. Deployment values are set first so that a kind override which
+	sets only one value inherits the others.
+*/
+func lead_init( ) {
+	if cfg_data["resmgr"] == nil {
+		return
+	}
+
+	for key, p := range cfg_data["resmgr"] {
+		switch key {
+			case "activate_lead":
+				set_lead( &def_leads.lead, key, *p, 0 )
+			case "pause_expiry":
+				set_lead( &def_leads.pause, key, *p, 1 )
+			case "delete_expiry":
+				set_lead( &def_leads.del, key, *p, 1 )
+		}
+	}
+
+	for key, p := range cfg_data["resmgr"] {
+		for _, base := range []string{ "activate_lead_", "pause_expiry_", "delete_expiry_" } {
+			if ! strings.HasPrefix( key, base ) {
+				continue
+			}
+
+			kind := key[len( base ):]
+			lt := kind_leads[kind]
+			if lt == nil {
+				lt = &lead_times{}
+				*lt = def_leads
+				kind_leads[kind] = lt
+			}
+
+			switch base {
+				case "activate_lead_":
+					set_lead( &lt.lead, key, *p, 0 )
+				case "pause_expiry_":
+					set_lead( &lt.pause, key, *p, 1 )
+				default:
+					set_lead( &lt.del, key, *p, 1 )
+			}
+		}
+	}
+
+	rm_sheep.Baa( 1, "activation lead %ds, pause expiry %ds, delete expiry %ds; %d kind overrides", def_leads.lead, def_leads.pause, def_leads.del, len( kind_leads ) )
+}
+
+/*
+	Return the times for the pledge's kind.
+*/
+func leads( p gizmos.Pledge ) ( *lead_times ) {
+	if lt := kind_leads[gizmos.Pledge_kind_name( p )]; lt != nil {
+		return lt
+	}
+
+	return &def_leads
+}
+
+/*
+	Seconds before commence that the pledge should be pushed.
+*/
+func activate_lead( p gizmos.Pledge ) ( int64 ) {
+	return leads( p ).lead
+}
+
+/*
+	Expiry for the flow-mods of a paused pledge.
+*/
+func pause_expiry( p gizmos.Pledge ) ( int64 ) {
+	return time.Now().Unix() + leads( p ).pause
+}
+
+/*
+	Expiry for a pledge that has been deleted or replaced.
+*/
+func delete_expiry( p gizmos.Pledge ) ( int64 ) {
+	return time.Now().Unix() + leads( p ).del
+}
+
+/*
+	Timestamp used to look up the pledge's queues: now if the pledge is active, otherwise
+	just after commence. Slices which abut share the boundary timestamp, so commence
+	itself could find the slice before the reservation.
+*/
+func queue_ts( p gizmos.Pledge ) ( int64 ) {
+	ts := time.Now().Unix()
+	c, e := p.Get_window()
+	if ts <= c {
+		ts = c + 1
+	}
+	if ts > e {
+		ts = e
+	}
+
+	return ts
+}
@@ -0,0 +1,184 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_limits
+	Abstract:	Caps on the number of reservations that may be active at the same time, both
+				overall and for any one tenant, so that a single tenant cannot exhaust the flow
+				table and queue capacity of the switches. A new reservation is refused when adding
+				it would put more than the limit in effect at any moment during its window; pledges
+				which don't overlap the window in time don't count against it.
+
+				The tenant of a reservation is the project of its first host (the source of a one
+				way reservation) or of the second host if the first is external.
+
+				Limits are applied only to new requests; reservations loaded from a checkpoint or
+				moved from the retry list were admitted before and are not refused if the limits
+				have since been lowered.
+
+	CFG:		resmgr:max_active - max reservations active at once (0, no limit)
+				resmgr:max_active_tenant - max reservations active at once for each tenant (0, no limit)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Window overlap is weighted so that the project tier total can use it.
+*/
+
+package managers
+
+import (
+	"sort"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Return the tenant (project) of the pledge; empty string if it can't be determined.
+*/
+func pledge_tenant( p *gizmos.Pledge ) ( string ) {
+	h1, h2 := (*p).Get_hosts()
+	if t := host_project( h1 ); t != "" {
+		return t
+	}
+
+	return host_project( h2 )
+}
+
+/*
+	Start (+weight) or end (-weight) of a window; sorted by time with ends before starts at
+	the same time as a window ending as another starts isn't an overlap.
+*/
+type win_edge struct {
+	ts		int64
+	delta	int64
+}
+
+type win_edges []win_edge
+
+func (we win_edges) Len( ) int { return len( we ) }
+func (we win_edges) Swap( i, j int ) { we[i], we[j] = we[j], we[i] }
+func (we win_edges) Less( i, j int ) bool {
+	if we[i].ts == we[j].ts {
+		return we[i].delta < we[j].delta
+	}
+	return we[i].ts < we[j].ts
+}
+
+/*
+	Return the max of the summed weights of the windows which overlap at any moment between
+	commence and expiry. Windows are given as commence/expiry pairs; each has a weight of 1
+	if weights is nil.
+*/
+func peak_sum( windows [][2]int64, weights []int64, commence int64, expiry int64 ) ( int64 ) {
+	edges := make( win_edges, 0, len( windows ) * 2 )
+	for i, w := range windows {
+		if w[0] >= expiry || w[1] <= commence {
+			continue
+		}
+
+		s := w[0]
+		if s < commence {
+			s = commence
+		}
+		e := w[1]
+		if e > expiry {
+			e = expiry
+		}
+		wt := int64( 1 )
+		if weights != nil {
+			wt = weights[i]
+		}
+		edges = append( edges, win_edge{ s, wt }, win_edge{ e, -wt } )
+	}
+	sort.Sort( edges )
+
+	max := int64( 0 )
+	n := int64( 0 )
+	for _, e := range edges {
+		n += e.delta
+		if n > max {
+			max = n
+		}
+	}
+
+	return max
+}
+
+/*
+	Return the max number of windows which overlap at any moment between commence and
+	expiry.
+*/
+func max_concurrent( windows [][2]int64, commence int64, expiry int64 ) ( int ) {
+	return int( peak_sum( windows, nil, commence, expiry ) )
+}
+
+/*
+	Return an error if adding the pledge would exceed either limit, or its project tier's
+	total bandwidth, during its window.
+*/
+func (inv *Inventory) check_limits( p *gizmos.Pledge ) ( err error ) {
+	if err = inv.check_tier( p ); err != nil {					// project's total bandwidth (res_mgr_tiers)
+		return err
+	}
+
+	if inv.max_active <= 0 && inv.max_tenant <= 0 {
+		return nil
+	}
+
+	tenant := pledge_tenant( p )
+	all := make( [][2]int64, 0, len( inv.cache ) )
+	mine := make( [][2]int64, 0, 64 )
+	for _, ip := range inv.cache {
+		if ip == nil || (*ip).Is_expired() {
+			continue
+		}
+
+		c, e := (*ip).Get_window()
+		all = append( all, [2]int64{ c, e } )
+		if tenant != "" && pledge_tenant( ip ) == tenant {
+			mine = append( mine, [2]int64{ c, e } )
+		}
+	}
+
+	c, e := (*p).Get_window()
+	if inv.max_active > 0 && max_concurrent( all, c, e ) >= inv.max_active {
+		rm_sheep.Baa( 1, "WRN: reservation %s refused: %d reservations would be active at once  [TGURMG007]", *(*p).Get_id(), inv.max_active + 1 )
+		return mk_err( ERR_CAPACITY, "reservation rejected: the limit of %d active reservations would be exceeded", inv.max_active )
+	}
+
+	if tenant != "" && inv.max_tenant > 0 && max_concurrent( mine, c, e ) >= inv.max_tenant {
+		rm_sheep.Baa( 1, "WRN: reservation %s refused: tenant %s would have %d reservations active at once  [TGURMG007]", *(*p).Get_id(), tenant, inv.max_tenant + 1 )
+		return mk_err( ERR_CAPACITY, "reservation rejected: the limit of %d active reservations for the tenant would be exceeded", inv.max_tenant )
+	}
+
+	return nil
+}
+
+/*
+	Give back the network capacity set aside for a pledge that was refused.
+*/
+func release_refused( p *gizmos.Pledge ) {
+	switch sp := (*p).(type) {
+		case *gizmos.Pledge_bw, *gizmos.Pledge_bwow, *gizmos.Pledge_mcast:
+			nw_req( REQ_DEL, sp, nil )
+	}
+}
@@ -0,0 +1,191 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_maint
+	Abstract:	Named maintenance windows. While a window is open, reservations it covers
+				are not pushed: new reservations that become active, and reservations that
+				would be pushed again (refresh, pause, delete, repair), are left unpushed.
+				A window covers everything (global), the reservations with a host, or the
+				reservations with a switch on their path (see res_mgr_index).
+
+				When a window closes a new queue map is requested which leads to a push of
+				everything that was held. A maintenance.started and a maintenance.ended event
+				are published; the latter gives the number of reservations that were held.
+
+				Windows are kept only in memory; they aren't checkpointed.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+type maint_window struct {
+	name	string
+	scope	string						// global, host or switch
+	target	string						// host or switch name; empty for global
+	start	int64
+	end		int64
+	started	bool						// start event published
+	held	map[string]bool				// reservations not pushed because of the window
+}
+
+/*
+	Request data for REQ_MAINT.
+*/
+type maint_req struct {
+	action	string						// add, del or list
+	w		*maint_window
+}
+
+func (mw *maint_window) is_open( now int64 ) ( bool ) {
+	return mw.start <= now && now < mw.end
+}
+
+func (mw *maint_window) to_json( now int64 ) ( string ) {
+	return fmt.Sprintf( `{ "name": %q, "scope": %q, "target": %q, "start": %d, "end": %d, "open": %v, "held": %d }`,
+		mw.name, mw.scope, mw.target, mw.start, mw.end, mw.is_open( now ), len( mw.held ) )
+}
+
+/*
+	Return true if the window covers the pledge.
+*/
+func (inv *Inventory) maint_covers( mw *maint_window, name string, p *gizmos.Pledge ) ( bool ) {
+	switch mw.scope {
+		case "global":
+			return true
+
+		case "host":
+			return pledge_has_host( p, mw.target )
+
+		case "switch":
+			return inv.idx.by["switch"][mw.target][name]
+	}
+
+	return false
+}
+
+/*
+	Return the open window that holds the pledge; nil if none does. Called as pledges are
+	about to be pushed; the pledge is remembered by the window.
+*/
+func (inv *Inventory) maint_hold( name string, p *gizmos.Pledge ) ( *maint_window ) {
+	if len( inv.maint ) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	for _, mw := range inv.maint {
+		if mw.is_open( now ) && inv.maint_covers( mw, name, p ) {
+			mw.held[name] = true
+			return mw
+		}
+	}
+
+	return nil
+}
+
+/*
+	Publish start events for windows that have opened, and drop windows that have closed.
+	Returns true if a window closed (the held reservations should be pushed).
+*/
+func (inv *Inventory) maint_tick( now int64 ) ( closed bool ) {
+	for name, mw := range inv.maint {
+		if ! mw.started && mw.is_open( now ) {
+			mw.started = true
+			rm_sheep.Baa( 1, "maintenance window %s started: %s %s until %d", name, mw.scope, mw.target, mw.end )
+			publish_event( "maintenance.started", mw.to_json( now ) )
+		}
+
+		if now >= mw.end {
+			rm_sheep.Baa( 1, "maintenance window %s ended: %d held reservations will be pushed", name, len( mw.held ) )
+			publish_event( "maintenance.ended", mw.to_json( now ) )
+			delete( inv.maint, name )
+			closed = true
+		}
+	}
+
+	return closed
+}
+
+/*
+	Add, delete or list windows. Deleting an open window closes it; the next tick pushes
+	what it held.
+*/
+func (inv *Inventory) maint_req( mr *maint_req ) ( string, error ) {
+	now := time.Now().Unix()
+
+	switch mr.action {
+		case "add":
+			mw := mr.w
+			if inv.maint[mw.name] != nil {
+				return "", mk_err( ERR_DUPLICATE, "maintenance window already exists: %s", mw.name )
+			}
+			if mw.end <= now || mw.end <= mw.start {
+				return "", mk_err( ERR_BAD_REQUEST, "maintenance window ends before it starts or in the past: %s", mw.name )
+			}
+
+			mw.held = make( map[string]bool )
+			inv.maint[mw.name] = mw
+			rm_sheep.Baa( 1, "maintenance window %s added: %s %s %d-%d", mw.name, mw.scope, mw.target, mw.start, mw.end )
+			return mw.to_json( now ), nil
+
+		case "del":
+			mw := inv.maint[mr.w.name]
+			if mw == nil {
+				return "", mk_err( ERR_NOT_FOUND, "no such maintenance window: %s", mr.w.name )
+			}
+			if mw.start > now {
+				delete( inv.maint, mw.name )			// never opened; nothing to release
+			} else {
+				mw.end = now							// tick releases held reservations
+			}
+			rm_sheep.Baa( 1, "maintenance window %s deleted", mw.name )
+			return mw.to_json( now ), nil
+	}
+
+	names := make( []string, 0, len( inv.maint ) )
+	for name := range inv.maint {
+		names = append( names, name )
+	}
+	sort.Strings( names )
+
+	jstr := `{ "windows": [ `
+	sep := ""
+	for _, name := range names {
+		jstr += sep + inv.maint[name].to_json( now )
+		sep = ", "
+	}
+	jstr += " ] }"
+
+	return jstr, nil
+}
@@ -0,0 +1,133 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_mcast
+	Abstract:	Reservation manager functions for multicast pledges. The tree is pushed as one
+				fq-mgr request per switch: the switch where the source attaches marks and queues
+				traffic sent to the group, and each switch with receivers replicates the group's
+				traffic to the receivers' ports. When the source and some receivers share a
+				switch a single request does both.
+
+				As with other bandwidth reservations, deleting or pausing (expiry pause mode)
+				the reservation sets a short expiry on the pledge and the push sends the same
+				requests with a short timeout which clears the flow-mods across the whole tree.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Send the fq-mgr requests needed to set up (or refresh) the flow-mods for a multicast pledge.
+	To_limit caps the flow-mod timeout as it does for bandwidth pledges.
+*/
+func mcast_push_res( gp *gizmos.Pledge, rname *string, to_limit int64, pref_v6 bool ) {
+	p, ok := (*gp).( *gizmos.Pledge_mcast )
+	if ! ok {
+		rm_sheep.Baa( 1, "internal mishap in mcast_push_res: pledge isn't a multicast pledge" )
+		(*gp).Set_pushed()
+		return
+	}
+
+	now := time.Now().Unix()
+	_, expiry := p.Get_window()
+	plist := p.Get_path_list()
+	if len( plist ) == 0 {
+		rm_sheep.Baa( 1, "multicast reservation not pushed: no branches: %s", *rname )
+		p.Set_pushed()
+		return
+	}
+
+	base := Mk_fqreq( rname )
+	base.Ipv6 = p.Get_matchv6()
+	base.Cookie = 0xffff
+	base.Dscp = p.Get_dscp()
+	base.Rate = p.Get_bandwidth()
+	base.Id = rname
+	base.Cid = p.Get_cid()
+	base.Match.Ip2 = p.Get_group()
+	if pause_by_expiry( *gp ) {
+		base.Expiry = pause_expiry( *gp )					// short timeout forces existing flow-mods out
+	} else {
+		if to_limit > 0 && expiry > now + to_limit {
+			base.Expiry = now + to_limit
+		} else {
+			base.Expiry = expiry
+		}
+	}
+	if proto := p.Get_proto(); proto != nil && *proto != "" {		// udp:port or tcp:port
+		toks := strings.SplitN( *proto, ":", 2 )
+		base.Tptype = &toks[0]
+		if len( toks ) > 1 {
+			base.Match.Tpdport = &toks[1]
+		}
+	}
+
+	reqs := make( map[string]*Fq_req )						// one request per switch, in the order they were first seen
+	order := make( []string, 0, len( plist ) + 1 )
+	get_req := func( sw string ) ( *Fq_req ) {
+		if reqs[sw] == nil {
+			reqs[sw] = base.Clone()
+			reqs[sw].Espq = gizmos.Mk_spq( sw, -1, 0 )
+			order = append( order, sw )
+		}
+		return reqs[sw]
+	}
+
+	ispq := plist[0].Get_ilink_spq( rname, queue_ts( *gp ) )		// source switch and queue are the same on every branch
+	if ispq != nil && ispq.Switch != "" {
+		freq := get_req( ispq.Switch )
+		freq.Espq = ispq
+		freq.Match.Ip1 = plist[0].Get_h1().Get_address( pref_v6 )
+	}
+
+	for _, path := range plist {
+		h2 := path.Get_h2()
+		sw := h2.Get_switch_id( 0 )
+		if sw == nil || *sw == "" {
+			rm_sheep.Baa( 1, "multicast receiver has no switch; skipped for %s: %s", *rname, h2.To_str() )
+			continue
+		}
+		freq := get_req( *sw )
+		freq.Rcvrs = append( freq.Rcvrs, h2.Get_address( pref_v6 ) )
+	}
+
+	for _, sw := range order {
+		freq := reqs[sw]
+		rm_sheep.Baa( 1, "res_mgr/push_mcast: %s switch=%s source=%v receivers=%d exp/fm_exp=%d/%d", *rname, sw, freq.Match.Ip1 != nil, len( freq.Rcvrs ), expiry, freq.Expiry )
+		msg := ipc.Mk_chmsg()
+		msg.Send_req( fq_ch, nil, REQ_MCAST_RESERVE, freq, nil )
+	}
+
+	p.Set_pushed()
+}
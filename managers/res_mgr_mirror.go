@@ -22,12 +22,26 @@
 	Mnemonic:	res_mgr_mirror
 	Abstract:	Reservation manager functions that are directly related to mirroring.
 
+				New mirrors are checked before they are added to the inventory: a mirror may not
+				send its output to a port that another mirror is mirroring, nor mirror a port that
+				is the output of another (either creates a loop that floods the host), and the
+				number of mirrors and the total bandwidth mirrored on any one physical host can be
+				capped. Only mirrors whose windows overlap the new mirror's window are considered;
+				the bandwidth is the sum of those mirrors' bandwidth and so may overstate what is
+				mirrored at any one moment.
+
+	CFG:		mirror:max_per_host - max mirrors on a physical host at once (0, no limit)
+				mirror:max_host_bw - max bandwidth mirrored on a physical host (0, no limit)
+
 	Author:		Robert Eby
 
 	Mods:		23 Feb 2015 - Created.
 				26 May 2015 - Changes to support pledge as an interface.
 				16 Nov 2015 - Add save_mirror_response()
 				24 Nov 2015 - Add options
+				16 Oct 2026 - Add loop, per host count and bandwidth checks.
+				16 Oct 2026 - Pass the configured flowmod priority (pri=n) in the options.
+				16 Oct 2026 - The add action carries the mirror id so the agent's response is tracked.
 */
 
 package managers
@@ -40,6 +54,26 @@ import (
 	"github.com/att/tegu/gizmos"
 )
 
+/*
+ *	Return the options to pass to the agent for the mirror: the user's options plus the
+ *	priority of flowmod based mirrors if the mirror priority tier is configured (fq_pri.go).
+ */
+func mirror_opts( p *gizmos.Pledge_mirror ) ( string ) {
+	opts := ""
+	if o := p.Get_Options(); o != nil {
+		opts = *o
+	}
+
+	if pri_adjust( gizmos.PT_MIRRORING ) != 0 {
+		if opts != "" {
+			opts += ","
+		}
+		opts += fmt.Sprintf( "pri=%d", pri_base( gizmos.PT_MIRRORING ) )
+	}
+
+	return opts
+}
+
 /*
  *	Push an "add mirror" request out to an agent in order to create the mirror.
  */
@@ -58,9 +92,8 @@ func push_mirror_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chms
 	// This is somewhat of a hack, but as long as the code in tegu_agent:do_mirrorwiz doesn't change, it should work
 	id := p.Get_id( )
 	arg := *id
-	opts := p.Get_Options()
-	if opts != nil && *opts != "" {
-		arg = fmt.Sprintf("-o%s %s", *opts, *id)
+	if opts := mirror_opts( p ); opts != "" {
+		arg = fmt.Sprintf("-o%s %s", opts, *id)
 	}
 
 	host := p.Get_qid( )
@@ -68,6 +101,7 @@ func push_mirror_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chms
 	json := `{ "ctype": "action_list", "actions": [ { `
 	json += `"atype": "mirrorwiz", `
 	json += fmt.Sprintf(`"hosts": [ %q ], `,  *host)
+	json += fmt.Sprintf(`"data": { "resid": %q }, `, *id)			// ties the agent's response back to the pledge (agent_log.go)
 	if strings.Contains(ports2, ",vlan:") {
 		// Because we have to store the ports list and the vlans in the same field
 		// we split it out here
@@ -100,9 +134,8 @@ func undo_mirror_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chms
 	id := p.Get_id( )
 	// This is somewhat of a hack, but as long as the code in tegu_agent:do_mirrorwiz doesn't change, it should work
 	arg := *id
-	opts := p.Get_Options()
-	if opts != nil && *opts != "" {
-		arg = fmt.Sprintf("-o%s %s", *opts, *id)
+	if opts := mirror_opts( p ); opts != "" {
+		arg = fmt.Sprintf("-o%s %s", opts, *id)
 	}
 
 	host := p.Get_qid( )
@@ -140,3 +173,77 @@ func save_mirror_response( stdout []string, stderr []string ) {
 	}
 	rm_sheep.Baa( 1, "save_mirror_response: could not find the mirror name" )
 }
+
+/*
+	Return true if the string is in the list.
+*/
+func in_list( s string, list []string ) ( bool ) {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Return an error if the mirror pledge would create a loop with, or together with the other
+	mirrors on its physical host exceed the count or bandwidth limit.
+*/
+func (inv *Inventory) check_mirror( p *gizmos.Pledge ) ( err error ) {
+	mp, ok := (*p).( *gizmos.Pledge_mirror )
+	if ! ok {
+		return nil
+	}
+
+	id := mp.Get_id()
+	phost := mp.Get_qid()
+	ports := mp.Get_ports()
+	_, out := mp.Get_hosts()
+	if in_list( *out, ports ) {
+		rm_sheep.Baa( 1, "WRN: mirror %s refused: output port %s is also mirrored  [TGURMG010]", *id, *out )
+		return mk_err( ERR_BAD_REQUEST, "mirror rejected: output port %s is one of the mirrored ports", *out )
+	}
+
+	c, e := mp.Get_window()
+	count := 0
+	bw := mp.Get_bandwidth()
+	for _, ip := range inv.cache {
+		om, ok := (*ip).( *gizmos.Pledge_mirror )
+		if ! ok || om.Is_expired() {
+			continue
+		}
+		oc, oe := om.Get_window()
+		if oc >= e || oe <= c {
+			continue
+		}
+
+		_, oout := om.Get_hosts()
+		if in_list( *oout, ports ) {
+			rm_sheep.Baa( 1, "WRN: mirror %s refused: port %s is the output of mirror %s  [TGURMG010]", *id, *oout, *om.Get_id() )
+			return mk_err( ERR_BAD_REQUEST, "mirror rejected: port %s is the output of mirror %s and mirroring it would create a loop", *oout, *om.Get_id() )
+		}
+		if in_list( *out, om.Get_ports() ) {
+			rm_sheep.Baa( 1, "WRN: mirror %s refused: output %s is mirrored by %s  [TGURMG010]", *id, *out, *om.Get_id() )
+			return mk_err( ERR_BAD_REQUEST, "mirror rejected: output port %s is mirrored by mirror %s and using it would create a loop", *out, *om.Get_id() )
+		}
+
+		if gizmos.Strings_equal( phost, om.Get_qid() ) {
+			count++
+			bw += om.Get_bandwidth()
+		}
+	}
+
+	if inv.mirror_max > 0 && count >= inv.mirror_max {
+		rm_sheep.Baa( 1, "WRN: mirror %s refused: host %s would have %d mirrors  [TGURMG010]", *id, *phost, count + 1 )
+		return mk_err( ERR_CAPACITY, "mirror rejected: the limit of %d mirrors on host %s would be exceeded", inv.mirror_max, *phost )
+	}
+
+	if inv.mirror_bw > 0 && bw > inv.mirror_bw {
+		rm_sheep.Baa( 1, "WRN: mirror %s refused: host %s would mirror %d bps  [TGURMG010]", *id, *phost, bw )
+		return mk_err( ERR_CAPACITY, "mirror rejected: mirrored bandwidth on host %s would be %d which exceeds the limit of %d", *phost, bw, inv.mirror_bw )
+	}
+
+	return nil
+}
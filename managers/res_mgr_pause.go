@@ -0,0 +1,140 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_pause
+	Abstract:	Pause modes. The original (expiry) mode pushes every reservation again with
+				a flow-mod expiry a few seconds out which forces the flow-mods out of the
+				switches, and pushes everything once more on resume. Each refresh while paused
+				pushes them all again.
+
+				In queue mode the flow-mods are left alone. The queues of paused reservations
+				are set to best-effort in the queue map sent to the agents: the minimum rate
+				is set to 0 so nothing is guaranteed, and the maximum is capped at pause_rate
+				if it is set. Traffic still lands in the reservation's queue, it just gets no
+				better treatment than anything else. Pause and resume each send one new queue
+				map; no flow-mods are pushed.
+
+				Reservations accepted while paused are marked paused and their queues are
+				treated the same way.
+
+	CFG:		resmgr:pause_mode - expiry or queue (expiry)
+				resmgr:pause_rate - max rate (bits/sec) of a paused reservation's queues in
+					queue mode; 0 leaves the max as reserved (0)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/tegu/gizmos"
+)
+
+var (
+	pause_queue	bool = false				// true when pause_mode is queue
+	pause_rate	int64 = 0
+)
+
+/*
+	Read the config.
+*/
+func pause_init( ) {
+	if cfg_data["resmgr"] == nil {
+		return
+	}
+
+	if p := cfg_data["resmgr"]["pause_mode"]; p != nil {
+		switch *p {
+			case "queue":
+				pause_queue = true
+			case "expiry":
+				pause_queue = false
+			default:
+				rm_sheep.Baa( 0, "WRN: resmgr:pause_mode must be expiry or queue; expiry used: %s  [TGURMG015]", *p )
+		}
+	}
+
+	if p := cfg_data["resmgr"]["pause_rate"]; p != nil {
+		pause_rate = int64( clike.Atof( *p ) )
+	}
+
+	if pause_queue {
+		rm_sheep.Baa( 1, "pause mode is queue; paused reservations capped at %d", pause_rate )
+	}
+}
+
+/*
+	Returns true if the pledge's flow-mods should be pushed with the short pause expiry.
+*/
+func pause_by_expiry( p gizmos.Pledge ) ( bool ) {
+	return ! pause_queue && p.Is_paused()
+}
+
+/*
+	Set the queues of paused pledges in the queue map to best-effort. Tokens are
+	swid/port,res-id,queue,min,max,pri. Returns the list given if nothing is paused.
+*/
+func (inv *Inventory) pause_queues( qlist []string ) ( []string ) {
+	if ! pause_queue {
+		return qlist
+	}
+
+	paused := make( map[string]bool )
+	for _, p := range inv.cache {
+		if p != nil && (*p).Is_paused() {
+			if qid := pledge_qid( p ); qid != nil {
+				paused[*qid] = true
+			}
+		}
+	}
+	if len( paused ) == 0 {
+		return qlist
+	}
+
+	nq := make( []string, len( qlist ) )
+	n := 0
+	for i, tok := range qlist {
+		nq[i] = tok
+
+		f := strings.Split( tok, "," )
+		if len( f ) < 6 || ! paused[f[1]] {
+			continue
+		}
+
+		max := f[4]
+		if pause_rate > 0 && clike.Atoi64( max ) > pause_rate {
+			max = fmt.Sprintf( "%d", pause_rate )
+		}
+		nq[i] = fmt.Sprintf( "%s,%s,%s,0,%s,%s", f[0], f[1], f[2], max, f[5] )
+		n++
+	}
+
+	rm_sheep.Baa( 2, "pause: %d queues set to best-effort", n )
+	return nq
+}
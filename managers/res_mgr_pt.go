@@ -26,7 +26,8 @@
 	Date:		26 January 2016
 	Author:		E. Scott Daniels
 
-	Mods:		
+	Mods:		16 Oct 2026 - Carry the correlation id to fq-mgr.
+				16 Oct 2026 - Short expiry when paused only in expiry pause mode.
 */
 
 package managers
@@ -81,8 +82,8 @@ func pass_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_lim
 
 		freq.Cookie = 0xffff							// should be ignored, if we see this out there we've got problems
 
-		if (*p).Is_paused( ) {
-			freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force the flow-mods out
+		if pause_by_expiry( *gp ) {
+			freq.Expiry = pause_expiry( *gp )			// if reservation shows paused, then we set a short expiration which should force the flow-mods out
 		} else {
 			if to_limit > 0 && expiry > now + to_limit {
 				freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
@@ -91,6 +92,7 @@ func pass_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_lim
 			}
 		}
 		freq.Id = rname
+		freq.Cid = p.Get_cid()
 
 		freq.Extip = &empty_str
 
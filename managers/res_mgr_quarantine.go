@@ -0,0 +1,256 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_quarantine
+	Abstract:	Host quarantine. A named quarantine is placed on a VM or on a physical host
+				(for a security incident, or while flaky hardware is looked at) and stays until
+				it is lifted. While it is in place:
+
+					- reservations with an endpoint that is the VM, or a VM on the physical
+					  host, are paused;
+					- reservations whose path only passes through the physical host are
+					  readmitted and so given a path around it; those that no longer fit are
+					  moved to the retry queue;
+					- new reservations naming the VM, or a VM on the physical host, are
+					  rejected, and paths for others avoid the physical host
+					  (network_quarantine.go).
+
+				When the quarantine is lifted the reservations it paused are resumed (unless
+				everything is paused). A new queue map is requested after either so that the
+				queues follow. The quarantine.added and quarantine.lifted events are published.
+
+				Quarantines are kept only in memory; they aren't checkpointed.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+type quarantine struct {
+	name	string
+	kind	string							// vm or phost
+	target	string							// vm as validated, or the physical host name
+	reason	string
+	since	int64
+	paused	map[string]bool					// reservations paused because of the quarantine
+	repathed int							// reservations readmitted when it was added
+}
+
+/*
+	Request data for REQ_QUARANTINE; passed on to network for add and del.
+*/
+type quar_req struct {
+	action	string							// add, del or list
+	name	string
+	kind	string
+	target	string
+	reason	string
+}
+
+func (q *quarantine) to_json( ) ( string ) {
+	return fmt.Sprintf( `{ "name": %q, "kind": %q, "target": %q, "reason": %q, "since": %d, "paused": %d, "repathed": %d }`,
+		q.name, q.kind, q.target, q.reason, q.since, len( q.paused ), q.repathed )
+}
+
+/*
+	Returns true if the pledge has an endpoint on the physical host. Bandwidth and multicast
+	paths may also pass through it; the other kinds touch a host only at their endpoints.
+*/
+func pledge_ep_on( p *gizmos.Pledge, match func( string ) bool ) ( bool ) {
+	var plist []*gizmos.Path
+
+	switch pldg := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			plist = pldg.Get_path_list()
+
+		case *gizmos.Pledge_mcast:
+			plist = pldg.Get_path_list()
+
+		default:
+			return pledge_touches( p, match )
+	}
+
+	for _, path := range plist {
+		h1, h2 := path.Get_hosts()
+		for _, h := range []*gizmos.Host{ h1, h2 } {
+			if sw := h.Get_switch_id( 0 ); sw != nil && match( *sw ) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+	Returns true if any quarantine paused the reservation.
+*/
+func (inv *Inventory) quar_holds( name string ) ( bool ) {
+	for _, q := range inv.quar {
+		if q.paused[name] {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Pause the reservations with an endpoint in the quarantine and readmit those whose path
+	passes through it. Network has been told of the quarantine, so readmission finds a path
+	that avoids it.
+*/
+func (inv *Inventory) quar_apply( q *quarantine ) {
+	match := host_matcher( q.target )
+	names := []string{}
+
+	for name, p := range inv.cache {
+		if p == nil || (*p).Is_expired() || strings.HasSuffix( name, ".yank" ) {
+			continue
+		}
+
+		ep := false
+		if q.kind == "vm" {
+			ep = pledge_has_host( p, q.target )
+		} else {
+			ep = pledge_ep_on( p, match )
+			if ! ep && pledge_touches( p, match ) {
+				names = append( names, name )
+				continue
+			}
+		}
+
+		if ep {
+			q.paused[name] = true
+			if ! (*p).Is_paused() {
+				(*p).Pause( ! pause_queue )
+			}
+			rm_sheep.Baa( 2, "quarantine %s: %s paused", q.name, name )
+		}
+	}
+
+	sort.Strings( names )
+	for _, name := range names {				// release them all before any is readmitted
+		if req := nw_req( REQ_DEL, *inv.cache[name], nil ); req.State != nil {
+			rm_sheep.Baa( 1, "quarantine %s: network release failed for %s: %s", q.name, name, req.State )
+		}
+	}
+
+	for _, name := range names {
+		p := inv.cache[name]
+		if k := gizmos.Pledge_kind_of( *p ); k != nil && k.Admit != nil {
+			if err := k.Admit( p ); err != nil {
+				rm_sheep.Baa( 0, "WRN: reservation has no path around quarantined host %s; moved to retry queue: %s: %s  [TGURMG021]", q.target, name, err )
+				delete( inv.cache, name )
+				inv.idx.drop( name )
+				inv.Add_retry( p )
+				continue
+			}
+		}
+		(*p).Reset_pushed()
+		inv.idx.add( name, p )
+	}
+	q.repathed = len( names )
+}
+
+/*
+	Resume the reservations paused by the quarantine which no other quarantine holds.
+*/
+func (inv *Inventory) quar_release( q *quarantine ) {
+	for name := range q.paused {
+		p := inv.cache[name]
+		if p == nil || res_paused || inv.quar_holds( name ) {
+			continue
+		}
+
+		(*p).Resume( ! pause_queue )
+		rm_sheep.Baa( 2, "quarantine %s: %s resumed", q.name, name )
+	}
+}
+
+/*
+	Add, lift or list quarantines. Returns the json for the quarantine (all of them for
+	list) and true if reservations were changed and a new queue map is needed.
+*/
+func (inv *Inventory) quar_req( qr *quar_req ) ( string, bool, error ) {
+	switch qr.action {
+		case "add":
+			if inv.quar[qr.name] != nil {
+				return "", false, mk_err( ERR_DUPLICATE, "quarantine already exists: %s", qr.name )
+			}
+			if req := nw_req( REQ_QUARANTINE, qr, nil ); req.State != nil {
+				return "", false, req.State
+			}
+
+			q := &quarantine{ name: qr.name, kind: qr.kind, target: qr.target, reason: qr.reason, since: time.Now().Unix(), paused: make( map[string]bool ) }
+			inv.quar[q.name] = q
+			inv.quar_apply( q )
+
+			rm_sheep.Baa( 1, "quarantine %s added: %s %s: %d reservations paused, %d readmitted", q.name, q.kind, q.target, len( q.paused ), q.repathed )
+			publish_event( "quarantine.added", q.to_json() )
+			return q.to_json(), len( q.paused ) + q.repathed > 0, nil
+
+		case "del":
+			q := inv.quar[qr.name]
+			if q == nil {
+				return "", false, mk_err( ERR_NOT_FOUND, "no such quarantine: %s", qr.name )
+			}
+			if req := nw_req( REQ_QUARANTINE, qr, nil ); req.State != nil {
+				rm_sheep.Baa( 1, "quarantine %s: network did not lift it: %s", q.name, req.State )
+			}
+
+			delete( inv.quar, q.name )
+			inv.quar_release( q )
+
+			rm_sheep.Baa( 1, "quarantine %s lifted after %ds", q.name, time.Now().Unix() - q.since )
+			publish_event( "quarantine.lifted", q.to_json() )
+			return q.to_json(), len( q.paused ) > 0, nil
+	}
+
+	names := make( []string, 0, len( inv.quar ) )
+	for name := range inv.quar {
+		names = append( names, name )
+	}
+	sort.Strings( names )
+
+	jstr := `{ "quarantines": [ `
+	sep := ""
+	for _, name := range names {
+		jstr += sep + inv.quar[name].to_json()
+		sep = ", "
+	}
+	jstr += " ] }"
+
+	return jstr, false, nil
+}
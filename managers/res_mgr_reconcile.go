@@ -0,0 +1,179 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_reconcile
+	Abstract:	Per-host reconciliation. When the agent for a host reconnects (the host or
+				OVS was likely restarted and the flow-mods are gone) the agent manager sends
+				us the host name. Every active reservation which touches the host has its
+				pushed flag reset and a new queue map is requested; when the map arrives the
+				queues are set and the reservations are pushed again. Reservations which do
+				not touch the host are left alone.
+
+				The same test is used to generate the impact report: the reservations whose
+				paths traverse a hypervisor or switch along with their tenants and expiry
+				times so that operators can judge the effect of taking the hardware down.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Trust reservations touch the hosts of their members.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Return a function which compares a switch/host name with host ignoring any domain
+	suffix on either.
+*/
+func host_matcher( host string ) ( func( string ) bool ) {
+	short := strings.SplitN( host, ".", 2 )[0]
+	return func( name string ) bool {
+		return strings.SplitN( name, ".", 2 )[0] == short
+	}
+}
+
+/*
+	Returns true if the pledge has flow-mods on the host.
+*/
+func pledge_touches( p *gizmos.Pledge, match func( string ) bool ) ( bool ) {
+	switch pldg := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			for _, path := range pldg.Get_path_list() {
+				if path.Has_switch( match ) {
+					return true
+				}
+			}
+
+		case *gizmos.Pledge_bwow:
+			if sw := pldg.Get_gate().Get_sw_name(); sw != nil {
+				return match( *sw )
+			}
+
+		case *gizmos.Pledge_mcast:
+			for _, path := range pldg.Get_path_list() {
+				if path.Has_switch( match ) {
+					return true
+				}
+			}
+
+		case *gizmos.Pledge_pass:
+			if ph := pldg.Get_phost(); ph != nil {
+				return match( *ph )
+			}
+
+		case *gizmos.Pledge_trust:
+			for _, ph := range pldg.Get_members() {
+				if ph != nil && match( *ph ) {
+					return true
+				}
+			}
+	}
+
+	return false
+}
+
+/*
+	Reset the pushed flag on active reservations which touch the host so that they are
+	pushed again. Returns the number reset.
+*/
+func (inv *Inventory) reconcile_host( host string ) ( n int ) {
+	match := host_matcher( host )
+	for name, p := range inv.cache {
+		if p == nil || ! (*p).Is_active() || ! (*p).Is_pushed() || (*p).Is_paused() {
+			continue
+		}
+
+		if pledge_touches( p, match ) {
+			(*p).Reset_pushed()
+			rm_sheep.Baa( 2, "reconcile: %s will be pushed again to %s", name, host )
+			n++
+		}
+	}
+
+	rm_sheep.Baa( 1, "reconcile: agent for %s reconnected: %d reservations will be pushed again", host, n )
+	return n
+}
+
+/*
+	Generate the impact report for the named host or switch: every reservation that has not
+	expired and which touches it.
+*/
+func (inv *Inventory) impact_json( name string ) ( string ) {
+	match := host_matcher( name )
+	tenants := make( map[string]bool )
+	jstr := ""
+	sep := ""
+	n := 0
+
+	for rname, p := range inv.cache {
+		if p == nil || (*p).Is_expired() || strings.HasSuffix( rname, ".yank" ) || ! pledge_touches( p, match ) {
+			continue
+		}
+
+		ptype := gizmos.Pledge_kind_name( *p )
+		h1, h2 := (*p).Get_hosts()
+
+		if h1 == nil {
+			h1 = &empty_str
+		}
+		if h2 == nil {
+			h2 = &empty_str
+		}
+
+		state := "pending"
+		if (*p).Is_active() {
+			state = "active"
+		}
+
+		rtenants := ""
+		tsep := ""
+		for _, t := range []string{ acct_tenant( h1 ), acct_tenant( h2 ) } {
+			if t != "" && !strings.Contains( rtenants, fmt.Sprintf( "%q", t ) ) {
+				rtenants += fmt.Sprintf( "%s%q", tsep, t )
+				tsep = ", "
+				tenants[t] = true
+			}
+		}
+
+		commence, expiry := (*p).Get_window()
+		jstr += fmt.Sprintf( `%s{ "id": %q, "type": %q, "state": %q, "tenants": [ %s ], "host1": %q, "host2": %q, "commence": %d, "expiry": %d }`,
+				sep, rname, ptype, state, rtenants, *h1, *h2, commence, expiry )
+		sep = ", "
+		n++
+	}
+
+	tlist := make( []string, 0, len( tenants ) )
+	for t := range tenants {
+		tlist = append( tlist, fmt.Sprintf( "%q", t ) )
+	}
+	sort.Strings( tlist )
+
+	return fmt.Sprintf( `{ "host": %q, "count": %d, "tenants": [ %s ], "reservations": [ %s ] }`, name, n, strings.Join( tlist, ", " ), jstr )
+}
@@ -0,0 +1,256 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_reopt
+	Abstract:	Re-optimisation of active bandwidth reservations. Paths are chosen when a
+				reservation is admitted and are kept until it expires, so a reservation made while
+				a link was down keeps its longer path after the link is repaired. Now and again
+				res_mgr asks the network for a new path for each active reservation which opted in
+				(reopt=true on the reserve request) and moves the reservation when the new path is
+				shorter, or when its busiest link is sufficiently less loaded than the busiest link
+				of the current path.
+
+				The move is make-before-break: the new path is obligated, under the same queue id,
+				while the old one is still held; only then is the old path released. The network
+				must therefore have room for both for a moment; when it doesn't the reservation
+				simply stays where it is. The flow-mods and queues are pushed again once the
+				reservation has moved.
+
+				Load is the link's obligation, less what the reservation itself has on the link, as
+				a percentage of the link's capacity. The reservation's own bandwidth is added back
+				for the path being scored so that the two paths are compared as if each were the
+				only one held.
+
+	CFG:		resmgr:reopt - seconds between passes; 0 disables (0)
+				resmgr:reopt_gain - percentage points that the busiest link of a path of the same
+					length must improve by for the reservation to be moved (10)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Obligation and capacity of one link.
+*/
+type link_load struct {
+	alloc	int64
+	max		int64
+}
+
+/*
+	Network side: return the current obligation and capacity of each link in the list.
+	Links that are no longer in the graph are omitted.
+*/
+func (n *Network) link_loads( lids []string ) ( map[string]*link_load ) {
+	loads := make( map[string]*link_load, len( lids ) )
+	if n == nil {
+		return loads
+	}
+
+	now := time.Now().Unix()
+	for _, lid := range lids {
+		l := n.links[lid]
+		if l == nil || l.Get_allotment() == nil {
+			continue
+		}
+
+		loads[lid] = &link_load{ alloc: l.Get_allocation( now ), max: l.Get_allotment().Get_max_capacity() }
+	}
+
+	return loads
+}
+
+/*
+	Add the bandwidth of each path to the links it traverses.
+*/
+func add_path_bw( bw map[string]int64, plist []*gizmos.Path ) {
+	for _, path := range plist {
+		for _, lid := range path.Get_link_ids() {
+			bw[lid] += path.Get_bandwidth()
+		}
+	}
+}
+
+/*
+	Score a path list: the number of hops and the load (percent) of its busiest link. Held is
+	the bandwidth that the reservation has on each link over both the old and the new paths;
+	it is removed from the link's obligation and the path list's own bandwidth added back.
+	Links without a known capacity are ignored.
+*/
+func score_paths( plist []*gizmos.Path, loads map[string]*link_load, held map[string]int64 ) ( hops int, peak int64 ) {
+	own := make( map[string]int64 )
+	add_path_bw( own, plist )
+
+	for _, path := range plist {
+		hops += path.Get_nlinks()
+	}
+
+	for lid, bw := range own {
+		ll := loads[lid]
+		if ll == nil || ll.max <= 0 {
+			continue
+		}
+
+		if pct := ((ll.alloc - held[lid] + bw) * 100) / ll.max; pct > peak {
+			peak = pct
+		}
+	}
+
+	return hops, peak
+}
+
+/*
+	Returns true if the two path lists traverse the same links.
+*/
+func same_links( a []*gizmos.Path, b []*gizmos.Path ) ( bool ) {
+	al := []string{}
+	bl := []string{}
+	for _, path := range a {
+		al = append( al, path.Get_link_ids()... )
+	}
+	for _, path := range b {
+		bl = append( bl, path.Get_link_ids()... )
+	}
+	if len( al ) != len( bl ) {
+		return false
+	}
+
+	sort.Strings( al )
+	sort.Strings( bl )
+	for i := range al {
+		if al[i] != bl[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	Find a new path for the pledge and move it there if the path is better. The trial is a
+	clone with the same id, and thus the same queue id, so that the network adds its
+	obligation to the queues already held; releasing either the trial or the old path then
+	leaves the queues as they would have been had only the other been reserved.
+	Returns true if the pledge was moved.
+*/
+func (inv *Inventory) reopt_one( name string, p *gizmos.Pledge, gain int64 ) ( bool ) {
+	sp := (*p).( *gizmos.Pledge_bw )
+	opaths := sp.Get_path_list()
+	if len( opaths ) == 0 {
+		return false
+	}
+
+	trial := sp.Clone( name )
+	trial.Set_path_list( nil )
+	req := nw_req( REQ_BW_RESERVE, trial, release_late( trial ) )
+	if req.Response_data == nil {
+		rm_sheep.Baa( 2, "reopt: no path for %s: %v", name, req.State )
+		return false
+	}
+	tpaths := req.Response_data.( []*gizmos.Path )
+	trial.Set_path_list( tpaths )
+
+	moved := false
+	var ohops, thops int
+	var opeak, tpeak int64
+	if ! same_links( opaths, tpaths ) {
+		held := make( map[string]int64 )
+		add_path_bw( held, opaths )
+		add_path_bw( held, tpaths )
+		lids := make( []string, 0, len( held ) )
+		for lid := range held {
+			lids = append( lids, lid )
+		}
+
+		if lreq := nw_req( REQ_LINK_LOAD, lids, nil ); lreq.State == nil && lreq.Response_data != nil {
+			loads := lreq.Response_data.( map[string]*link_load )
+			ohops, opeak = score_paths( opaths, loads, held )
+			thops, tpeak = score_paths( tpaths, loads, held )
+			moved = (thops < ohops && tpeak <= opeak) || (thops <= ohops && opeak - tpeak >= gain)
+		}
+	}
+
+	if ! moved {
+		if dreq := nw_req( REQ_DEL, trial, nil ); dreq.State != nil {
+			rm_sheep.Baa( 1, "reopt: network release of trial path failed for %s: %s", name, dreq.State )
+		}
+		return false
+	}
+
+	old := sp.Clone( name )					// carries the old path list for the release
+	sp.Set_path_list( tpaths )
+	if dreq := nw_req( REQ_DEL, old, nil ); dreq.State != nil {
+		rm_sheep.Baa( 1, "reopt: network release of old path failed for %s: %s", name, dreq.State )
+	}
+	(*p).Reset_pushed()
+	inv.idx.add( name, p )
+
+	rm_sheep.Baa( 1, "reservation moved to a better path: %s hops %d -> %d, peak load %d%% -> %d%%", name, ohops, thops, opeak, tpeak )
+	publish_event( "reservation.reoptimised", fmt.Sprintf( `{ "id": %q, "name": %q, "hops": [ %d, %d ], "peak_load": [ %d, %d ] }`, name, inv.res_label( name ), ohops, thops, opeak, tpeak ) )
+	return true
+}
+
+/*
+	Look for better paths for the active bandwidth reservations which opted in. Reservations
+	which are paused, not yet pushed, in the middle of a handover, or expire before the
+	next pass are left alone. Returns the number moved.
+*/
+func (inv *Inventory) reoptimise( ivl int64, gain int64 ) ( n int ) {
+	now := time.Now().Unix()
+	names := []string{}
+	for name, p := range inv.cache {
+		if p == nil || ! (*p).Is_active() || ! (*p).Is_pushed() || (*p).Is_paused() {
+			continue
+		}
+
+		sp, ok := (*p).( *gizmos.Pledge_bw )
+		if ! ok || ! sp.Is_reopt() || sp.Get_handover() != nil {
+			continue
+		}
+		if _, expiry := sp.Get_window(); expiry - now <= ivl {
+			continue
+		}
+
+		names = append( names, name )
+	}
+
+	sort.Strings( names )
+	for _, name := range names {
+		if inv.reopt_one( name, inv.cache[name], gain ) {
+			n++
+		}
+	}
+
+	rm_sheep.Baa( 2, "reopt: %d of %d reservations moved", n, len( names ) )
+	return n
+}
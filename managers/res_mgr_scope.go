@@ -0,0 +1,145 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_scope
+	Abstract:	Scoped delete all. A delete of "all" reservations may be limited to those with
+				a given host, those belonging to a project, or those which are active at some
+				point in a time window. As with an unscoped delete all, only the reservations
+				that the cookie allows are deleted. A dry run returns the list of reservations
+				that would be deleted without deleting any.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Limits for a delete all; empty or zero fields don't limit.
+*/
+type del_scope struct {
+	cookie	*string
+	host	string			// host name or address; the project portion of the pledge's host names isn't needed
+	project	string			// project (tenant) id
+	start	int64			// reservations active at any time between start and end
+	end		int64
+	dryrun	bool			// list only
+}
+
+/*
+	Return true if the pledge is within the scope.
+*/
+func (s *del_scope) matches( p *gizmos.Pledge ) ( bool ) {
+	if s.host != "" && ! pledge_has_host( p, s.host ) {
+		return false
+	}
+
+	if s.project != "" && ! pledge_in_project( p, s.project ) {
+		return false
+	}
+
+	if s.end > 0 {
+		c, e := (*p).Get_window()
+		if c >= s.end || e <= s.start {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+	Return true if either host of the pledge is the name, or is the name once the project
+	is removed.
+*/
+func pledge_has_host( p *gizmos.Pledge, name string ) ( bool ) {
+	if (*p).Has_host( &name ) {
+		return true
+	}
+
+	h1, h2 := (*p).Get_hosts()
+	for _, h := range []*string{ h1, h2 } {
+		if h == nil {
+			continue
+		}
+		if idx := strings.LastIndex( *h, "/" ); idx >= 0 && (*h)[idx+1:] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Return true if either host of the pledge belongs to the project.
+*/
+func pledge_in_project( p *gizmos.Pledge, project string ) ( bool ) {
+	h1, h2 := (*p).Get_hosts()
+	return host_project( h1 ) == project || host_project( h2 ) == project
+}
+
+/*
+	Delete the active reservations, that the cookie allows, which are in scope. The ids of
+	those deleted (or that would be with a dry run) are returned in order.
+*/
+func (inv *Inventory) del_scoped( s *del_scope ) ( ids []string ) {
+	ids = make( []string, 0 )
+	for id, p := range inv.cache {
+		if p == nil || (*p).Is_expired() || ! s.matches( p ) {
+			continue
+		}
+
+		if _, err := inv.Get_res( &id, s.cookie ); err != nil {			// cookie doesn't allow
+			continue
+		}
+
+		ids = append( ids, id )
+	}
+	sort.Strings( ids )
+
+	if s.dryrun {
+		rm_sheep.Baa( 1, "delete all (dry run) would delete %d reservations", len( ids ) )
+		return
+	}
+
+	deleted := make( []string, 0, len( ids ) )
+	for i := range ids {
+		if _, err := inv.user_del( &ids[i], s.cookie ); err == nil {			// subject to the grace period
+			deleted = append( deleted, ids[i] )
+			rm_sheep.Baa( 1, "delete all deleted reservation %s", ids[i] )
+		} else {
+			rm_sheep.Baa( 1, "delete all skipped reservation %s: %s", ids[i], err )
+		}
+	}
+
+	rm_sheep.Baa( 1, "delete all deleted %d reservations", len( deleted ) )
+	return deleted
+}
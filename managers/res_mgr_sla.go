@@ -0,0 +1,281 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+
+	Mnemonic:	res_mgr_sla
+	Abstract:	SLA breach detection for bandwidth reservations. Fq-mgr polls the agents for
+				the bytes sent by each direction of a reservation and the drops of the queue its
+				traffic is assigned to (fq_sla.go) and gives us the rate and drops over each
+				interval. An interval where packets were dropped while the rate was more than
+				resmgr:sla_tolerance percent below the reserved rate is a breaching interval;
+				the traffic wanted more than it was given. Any other interval ends a breach
+				(without drops the traffic is getting what it asks for even if that is below
+				the guarantee); one where the drops couldn't be counted changes nothing.
+
+				When a direction has breached for resmgr:sla_threshold seconds the pledge is
+				marked (phase SLA_BREACH in resstatus, sla_breach in its json), a warning is
+				logged and a reservation.sla_breach event is published. The mark is removed,
+				and a reservation.sla_cleared event published, when none of the reservation's
+				directions are breaching.
+
+				Every breach is kept, newest last, in a history of at most resmgr:sla_history
+				entries (start, end, guarantee, lowest rate seen and drops) which is given by
+				the slareport admin request. A breach still in progress has an end of 0. The
+				history is kept only in memory.
+
+	CFG:		resmgr:sla_threshold - seconds a breach must last before it is reported; 0 disables (300)
+				resmgr:sla_tolerance - percentage below the reserved rate still taken as meeting it (5)
+				resmgr:sla_history - number of breaches kept for reporting (500)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+/*
+	One breach of a reservation's guarantee in one direction; shown by slareport.
+*/
+type sla_breach struct {
+	Id			string	`json:"id"`
+	Flow		string	`json:"flow"`				// host and direction (smac>dmac)
+	Start		int64	`json:"start"`
+	End			int64	`json:"end"`				// 0 while in progress
+	Guarantee	int64	`json:"reserved_bps"`
+	Min_rate	int64	`json:"min_bps"`			// lowest rate seen while breaching
+	Drops		int64	`json:"drops"`
+}
+
+/*
+	Tracking for one direction of a reservation.
+*/
+type sla_track struct {
+	since		int64					// time of the first breaching interval; 0 if not breaching
+	last		int64					// time of the last sample
+	min_rate	int64
+	drops		int64					// drops since the breach started
+	rec			*sla_breach				// set once the breach has been reported
+}
+
+type sla_mon struct {
+	threshold	int64
+	tol			int64
+	max			int
+	flows		map[string]*sla_track	// keyed by id, host and direction
+	hist		[]*sla_breach
+}
+
+/*
+	Build the monitor from the config. Nil is returned if breach detection is disabled.
+*/
+func sla_init( ) ( sm *sla_mon ) {
+	sm = &sla_mon{
+		threshold:	300,
+		tol:		5,
+		max:		500,
+		flows:		make( map[string]*sla_track ),
+	}
+
+	if cfg_data["resmgr"] != nil {
+		if p := cfg_data["resmgr"]["sla_threshold"]; p != nil {
+			sm.threshold = clike.Atoi64( *p )
+		}
+		if p := cfg_data["resmgr"]["sla_tolerance"]; p != nil {
+			sm.tol = clike.Atoi64( *p )
+		}
+		if p := cfg_data["resmgr"]["sla_history"]; p != nil {
+			sm.max = clike.Atoi( *p )
+		}
+	}
+
+	if sm.threshold <= 0 {
+		rm_sheep.Baa( 1, "sla breach detection is disabled" )
+		return nil
+	}
+	if sm.max < 1 {
+		sm.max = 1
+	}
+
+	rm_sheep.Baa( 1, "sla breaches are reported after %ds; tolerance=%d%% history=%d", sm.threshold, sm.tol, sm.max )
+	return sm
+}
+
+/*
+	Add a breach to the history, dropping the oldest if it is full.
+*/
+func (sm *sla_mon) add_hist( b *sla_breach ) {
+	sm.hist = append( sm.hist, b )
+	if len( sm.hist ) > sm.max {
+		sm.hist = sm.hist[len( sm.hist ) - sm.max:]
+	}
+}
+
+/*
+	Returns true if any direction of the reservation has a reported breach.
+*/
+func (sm *sla_mon) breaching( id string ) ( bool ) {
+	for _, t := range sm.flows {
+		if t.rec != nil && t.rec.Id == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	End the breach (if any) being tracked by t. When it was the reservation's last, the
+	mark is taken off the pledge (if it is still around) and the cleared event published.
+*/
+func (inv *Inventory) sla_end( t *sla_track, ts int64 ) {
+	t.since = 0
+	t.drops = 0
+	if t.rec == nil {
+		return
+	}
+
+	rec := t.rec
+	rec.End = ts
+	t.rec = nil
+
+	if ! inv.sla.breaching( rec.Id ) {
+		if p := inv.cache[rec.Id]; p != nil {
+			(*p).Set_sla_breach( false )
+		}
+	}
+
+	rm_sheep.Baa( 1, "sla breach ended: %s %s after %ds, drops=%d", rec.Id, rec.Flow, rec.End - rec.Start, rec.Drops )
+	jrec, _ := json.Marshal( rec )
+	publish_event( "reservation.sla_cleared", string( jrec ) )
+}
+
+/*
+	Evaluate the samples sent by fq-mgr. Directions which are no longer sampled (the
+	reservation ended, or its flow-mods are gone) are ended once three thresholds pass
+	without a sample.
+*/
+func (inv *Inventory) sla_usage( samples []*sla_sample ) {
+	sm := inv.sla
+	if sm == nil {
+		return
+	}
+
+	for _, s := range samples {
+		key := s.Id + " " + s.Flow
+		t := sm.flows[key]
+
+		p := inv.cache[s.Id]
+		if p == nil || ! (*p).Is_active() || (*p).Is_paused() {
+			if t != nil {
+				inv.sla_end( t, s.Ts )
+				delete( sm.flows, key )
+			}
+			continue
+		}
+
+		if s.Drops < 0 {
+			continue								// can't tell; leave it as it is
+		}
+
+		if t == nil {
+			t = &sla_track{ }
+			sm.flows[key] = t
+		}
+		t.last = s.Ts
+
+		if s.Drops == 0 || s.Rate * 100 >= s.Guarantee * (100 - sm.tol) {
+			inv.sla_end( t, s.Ts )
+			continue
+		}
+
+		if t.since == 0 {
+			t.since = s.Ts
+			t.min_rate = s.Rate
+		}
+		if s.Rate < t.min_rate {
+			t.min_rate = s.Rate
+		}
+		t.drops += s.Drops
+
+		if t.rec != nil {
+			t.rec.Min_rate = t.min_rate
+			t.rec.Drops = t.drops
+			continue
+		}
+
+		if s.Ts - t.since >= sm.threshold {
+			t.rec = &sla_breach{ Id: s.Id, Flow: s.Flow, Start: t.since, Guarantee: s.Guarantee, Min_rate: t.min_rate, Drops: t.drops }
+			sm.add_hist( t.rec )
+			(*p).Set_sla_breach( true )
+
+			rm_sheep.Baa( 0, "WRN: reservation %s is below its guarantee on %s: %d of %d bps with %d drops for %ds  [TGURMG026]",
+				s.Id, s.Flow, s.Rate, s.Guarantee, t.drops, s.Ts - t.since )
+			jrec, _ := json.Marshal( t.rec )
+			publish_event( "reservation.sla_breach", fmt.Sprintf( `{ "breach": %s, "reservation": %s }`, jrec, (*p).To_json() ) )
+		}
+	}
+
+	now := time.Now().Unix()
+	for key, t := range sm.flows {
+		if now - t.last > sm.threshold * 3 {
+			inv.sla_end( t, now )
+			delete( sm.flows, key )
+		}
+	}
+}
+
+/*
+	Generate the breach history, for one reservation if id isn't empty.
+*/
+func (inv *Inventory) sla_json( id string ) ( string ) {
+	sm := inv.sla
+	if sm == nil {
+		return `{ "enabled": false, "open": 0, "breaches": [] }`
+	}
+
+	list := make( []*sla_breach, 0 )
+	open := 0
+	for _, b := range sm.hist {
+		if id != "" && b.Id != id {
+			continue
+		}
+		if b.End == 0 {
+			open++
+		}
+		list = append( list, b )
+	}
+
+	jlist, err := json.Marshal( list )
+	if err != nil {
+		jlist = []byte( "[]" )
+	}
+
+	return fmt.Sprintf( `{ "enabled": true, "threshold": %d, "tolerance": %d, "open": %d, "breaches": %s }`, sm.threshold, sm.tol, open, jlist )
+}
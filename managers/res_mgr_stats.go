@@ -0,0 +1,165 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_stats
+	Abstract:	Aggregate statistics about the inventory for dashboards and alerting: counts
+				by state and by pledge type, bandwidth reserved by active reservations per
+				tenant and per link, the fraction of flow-mod sets that failed to install, and
+				the age of the oldest reservation that is active but hasn't been pushed.
+
+				Bandwidth is given in Mbps. Link totals come from the paths of active bandwidth
+				and multicast reservations; one way reservations have no path and are counted
+				only against the tenant.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+type inv_stats struct {
+	Total			int					`json:"total"`
+	By_state		map[string]int		`json:"by_state"`
+	By_type			map[string]int		`json:"by_type"`
+	Tenant_mbps		map[string]float64	`json:"tenant_mbps"`
+	Link_mbps		map[string]float64	`json:"link_mbps"`
+	Fmod_sets		int					`json:"fmod_sets"`
+	Fmod_failed		int					`json:"fmod_failed"`
+	Push_fail_rate	float64				`json:"push_fail_rate"`
+	Oldest_unpushed	int64				`json:"oldest_unpushed"`		// seconds; 0 if none
+}
+
+/*
+	Convert bits/sec to Mbps.
+*/
+func mbps( bw int64 ) ( float64 ) {
+	return float64( bw ) / 1000000.0
+}
+
+/*
+	Add the bandwidth of each path to the links it uses.
+*/
+func add_link_bw( links map[string]float64, plist []*gizmos.Path ) {
+	for _, path := range plist {
+		bw := mbps( path.Get_bandwidth() )
+		for _, id := range path.Get_link_ids() {
+			links[id] += bw
+		}
+	}
+}
+
+/*
+	Compute the statistics and return them as json.
+*/
+func (inv *Inventory) stats_json( ) ( string ) {
+	st := &inv_stats{
+		By_state:		make( map[string]int ),
+		By_type:		make( map[string]int ),
+		Tenant_mbps:	make( map[string]float64 ),
+		Link_mbps:		make( map[string]float64 ),
+	}
+
+	now := time.Now().Unix()
+	for name, p := range inv.cache {
+		if p == nil || strings.HasSuffix( name, ".yank" ) {
+			continue
+		}
+
+		st.Total++
+		st.By_state[(*p).Get_state()]++
+		st.By_type[gizmos.Pledge_kind_name( *p )]++
+
+		switch {												// states that overlay the window state
+			case (*p).Is_awaiting_approval():
+				st.By_state["AWAITING_APPROVAL"]++
+			case (*p).Get_consent() != "":
+				st.By_state["AWAITING_CONSENT"]++
+			case (*p).Is_paused():
+				st.By_state["PAUSED"]++
+		}
+		if _, ok := inv.doomed[name]; ok {
+			st.By_state["DELETE_PENDING"]++
+		}
+
+		if ! (*p).Is_active() {
+			continue
+		}
+
+		if ! (*p).Is_pushed() && ! (*p).Is_awaiting_approval() && (*p).Get_consent() == "" && ! (*p).Is_paused() {
+			c, _ := (*p).Get_window()
+			if age := now - c; age > st.Oldest_unpushed {
+				st.Oldest_unpushed = age
+			}
+		}
+
+		tenant := pledge_tenant( p )
+		switch pldg := (*p).(type) {
+			case *gizmos.Pledge_bw:
+				st.Tenant_mbps[tenant] += mbps( pldg.Get_bandw() )
+				add_link_bw( st.Link_mbps, pldg.Get_path_list() )
+
+			case *gizmos.Pledge_bwow:
+				st.Tenant_mbps[tenant] += mbps( pldg.Get_bandwidth() )
+
+			case *gizmos.Pledge_mcast:
+				st.Tenant_mbps[tenant] += mbps( pldg.Get_bandwidth() )
+				add_link_bw( st.Link_mbps, pldg.Get_path_list() )
+		}
+	}
+
+	if len( inv.recovering ) > 0 {
+		st.By_state["RECOVERING"] = len( inv.recovering )
+	}
+	if len( inv.retry ) > 0 {
+		st.By_state["RETRY"] = len( inv.retry )
+	}
+
+	for _, rs := range inv.fmstat {
+		for _, fs := range rs.fmods {
+			st.Fmod_sets++
+			if fs.State == "failed" {
+				st.Fmod_failed++
+			}
+		}
+	}
+	if st.Fmod_sets > 0 {
+		st.Push_fail_rate = float64( st.Fmod_failed ) / float64( st.Fmod_sets )
+	}
+
+	jb, err := json.Marshal( st )
+	if err != nil {
+		rm_sheep.Baa( 1, "unable to marshal inventory stats: %s", err )
+		return "{ }"
+	}
+
+	return string( jb )
+}
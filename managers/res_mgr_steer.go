@@ -31,24 +31,74 @@
 				27 Feb 2015 - Changes to work with lazy updates, long duration reservations
 					and e*->l* fixes.
 				26 May 2015 - Changes to support pledge as an interface.
+				16 Oct 2026 - Added admit_steer() so steering reservations are restored from a checkpoint.
+				16 Oct 2026 - The pledge's priority offset (chain templates) is added to each flow-mod.
 */
 
 package managers
 
 import (
 	//"encoding/json"
-	//"fmt"
+	"fmt"
 	//"os"
 	"strings"
 	"time"
 
 	//"github.com/att/gopkgs/bleater"
-	//"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/clike"
 	"github.com/att/gopkgs/ipc"
 	"github.com/att/tegu/gizmos"
 )
 
 
+/*
+	Admit a steering pledge loaded from a checkpoint. The endpoints are added to the graph, and
+	each middlebox is found again as the VM may have moved while we were down. Middlebox names
+	without a project are given the project of the first endpoint as was done when the request
+	was accepted. A middlebox which can't be found puts the pledge on the retry list rather than
+	steering traffic to where it used to be.
+*/
+func admit_steer( gp *gizmos.Pledge ) ( error ) {
+	p := (*gp).( *gizmos.Pledge_steer )
+	h1, h2 := p.Get_hosts( )
+	for _, h := range []*string{ h1, h2 } {
+		if h != nil && *h != "" && ! strings.HasSuffix( *h, "*" ) {			// E* and L* aren't in the graph
+			update_graph( h, true, true )
+		}
+	}
+
+	proj := ""
+	if h1 != nil {
+		if i := strings.LastIndex( *h1, "/" ); i >= 0 {
+			proj = (*h1)[0:i+1]
+		}
+	}
+
+	for i := 0; i < p.Get_mbox_count(); i++ {
+		mb := p.Get_mbox( i )
+		mbn := *mb.Get_id()
+		if strings.Index( mbn, "/" ) < 0 {
+			mbn = proj + mbn
+		}
+
+		update_graph( &mbn, true, true )
+		req := nw_req( REQ_HOSTINFO, &mbn, nil )
+		hinfo, ok := req.Response_data.( string )
+		if req.State != nil || ! ok {
+			return fmt.Errorf( "unable to find middlebox %s for steering pledge: %v", mbn, req.State )
+		}
+
+		htoks := strings.Split( hinfo, "," )					// ip, mac, switch-id, switch-port
+		if len( htoks ) < 4 {
+			return fmt.Errorf( "bad host info for middlebox %s: %s", mbn, hinfo )
+		}
+		p.Set_mbox( i, gizmos.Mk_mbox( mb.Get_id(), &htoks[1], &htoks[2], clike.Atoi( htoks[3] ) ) )
+	}
+
+	rm_sheep.Baa( 1, "middleboxes found for chkptd steering reservation: %s mboxes=%d", *p.Get_id(), p.Get_mbox_count() )
+	return nil
+}
+
 /*
 	Given a protocol string and directionm, set the proper transport port values in
 	the fq_req structure. Direction is supplied as a forward == true or false value.
@@ -78,14 +128,14 @@ func set_proto_port( fq_data *Fq_req, proto *string, forward bool ) {
 	Generate flow-mod requests to the fq-manager for a given src,dest pair and list of
 	middleboxes.  This assumes that the middlebox list has been reversed if necessary.
 	Either source (ep1) or dest (ep2) may be nil which indicates a "to any" or "from any"
-	intention.
+	intention. Pri is added to the priority of every flow-mod.
 
 	DANGER:  We generate the flowmods in reverse order which _should_ generate the highest
 			priority f-mods first. This is absolutely necessary to prevent packet loops
 			on the switches which can happen if a higher priority rule isn't in place
 			that would cause the lower priority rule to be skipped over.
 */
-func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64, rname *string, proto *string, forward bool ) {
+func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64, rname *string, proto *string, forward bool, pri int ) {
 	var (
 		fq_data *Fq_req
 		fq_match *Fq_parms
@@ -117,7 +167,7 @@ func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64,
 			fq_match = fq_data.Match
 			fq_action = fq_data.Action
 
-			fq_data.Pri = 300
+			fq_data.Pri = 300 + pri
 			fq_data.Expiry = expiry
 
 			mb = mblist[i]
@@ -165,7 +215,7 @@ func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64,
 		set_proto_port( fq_data, proto, forward ) 		// set the protocol match port dest in forward direction, src in reverse
 
 		if i == 0 {										// push the ingress rule (possibly to all switches)
-			fq_data.Pri = 100
+			fq_data.Pri = 100 + pri
 
 			mb = mblist[i]
 			if ep1 != nil {
@@ -210,14 +260,14 @@ func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64,
 				//clonedfq_210.Action.Resub = &resub_2xx
 
 				fq_210.Match.Ip2 = ep1											// the 210 rule will match the reverse (ip2 is the dest which we need to match on the fmod)
-				fq_210.Pri = 210
+				fq_210.Pri = 210 + pri
 
 				msg := ipc.Mk_chmsg()
 				msg.Send_req( fq_ch, nil, REQ_ST_RESERVE, fq_210, nil )			// no response right now -- eventually we want an asynch error
 
-				fq_data.Pri = 200
+				fq_data.Pri = 200 + pri
 			} else {
-				fq_data.Pri = 210												// ensure rule with a dest matches before a 2xx rule without dest
+				fq_data.Pri = 210 + pri												// ensure rule with a dest matches before a 2xx rule without dest
 			}
 
 
@@ -270,13 +320,14 @@ func push_st_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chmsg, h
 	for i := range mblist {
 		mblist[i] = p.Get_mbox( i )
 	}
-	steer_fmods( ep1, ep2, mblist, duration, &rname, p.Get_proto(), true )			// set forward fmods
+	_, pri := p.Get_template( )
+	steer_fmods( ep1, ep2, mblist, duration, &rname, p.Get_proto(), true, pri )		// set forward fmods
 
 	nmb--
 	for i := range mblist {											// build middlebox list in reverse
 		mblist[nmb-i] = p.Get_mbox( i )
 	}
-	steer_fmods( ep2, ep1, mblist, duration, &rname, p.Get_proto(), false )			// set backward fmods
+	steer_fmods( ep2, ep1, mblist, duration, &rname, p.Get_proto(), false, pri )	// set backward fmods
 
 	p.Set_pushed()
 }
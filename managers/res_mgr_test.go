@@ -0,0 +1,525 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+
+package managers
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Make a passthrough pledge (no network capacity to release if it's refused).
+*/
+func mk_test_pass( id string, host string ) ( *gizmos.Pledge ) {
+	port := "0"
+	cookie := "cookie"
+	now := time.Now().Unix()
+	pp, err := gizmos.Mk_pass_pledge( &host, &port, now, now + 3600, &id, &cookie )
+	if err != nil {
+		return nil
+	}
+
+	var p gizmos.Pledge = pp
+	return &p
+}
+
+/*
+	While pledges from the checkpoint are still recovering, a new reservation must be refused,
+	one still recovering must be reported as busy, and a duplicate of a recovering pledge
+	must be found. Once recovery is done the new reservation can be added.
+*/
+func TestRes_recovering( t *testing.T ) {
+	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	inv := Mk_inventory( )
+	held := mk_test_pass( "res-held", "host1" )
+	inv.recovering["res-held"] = held
+
+	np := mk_test_pass( "res-new", "host2" )
+	if err := inv.Add_res( np ); err_code( err ) != ERR_BUSY {
+		fmt.Fprintf( os.Stderr, "[FAIL] add during recovery not refused as busy: %v\n", err )
+		errs++
+	}
+
+	name := "res-held"
+	cookie := "cookie"
+	if _, err := inv.Get_res( &name, &cookie ); err_code( err ) != ERR_BUSY {
+		fmt.Fprintf( os.Stderr, "[FAIL] recovering reservation not reported busy: %v\n", err )
+		errs++
+	}
+
+	dup := mk_test_pass( "res-dup", "host1" )
+	if rid, _ := inv.dup_check( dup ); rid == nil || *rid != "res-held" {
+		fmt.Fprintf( os.Stderr, "[FAIL] duplicate of recovering reservation not detected\n" )
+		errs++
+	}
+
+	delete( inv.recovering, "res-held" )
+	if err := inv.Add_res( np ); err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] add after recovery refused: %s\n", err )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   reservations refused or busy while recovering\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	A recovery worker admits a copy; the held pledge must not change until res_mgr applies
+	the result.
+*/
+func TestRes_recovered( t *testing.T ) {
+	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	inv := Mk_inventory( )
+	inv.recovery = mk_recovery_report( "test" )
+	inv.recovery.pending = 1
+	held := mk_test_pass( "res-held", "host1" )
+	inv.recovering["res-held"] = held
+
+	r := &rcv_result{ p: held, admitted: (*held).Snapshot( ), ds: DS_ADD }
+	phost := "phost1"
+	r.admitted.( *gizmos.Pledge_pass ).Set_phost( &phost )			// as admit_pass would in the worker
+	if (*held).( *gizmos.Pledge_pass ).Get_phost( ) != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] admitting the copy changed the held pledge\n" )
+		errs++
+	}
+
+	if ! inv.recovered( r ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] recovered pledge was not added\n" )
+		errs++
+	}
+	if ph := (*held).( *gizmos.Pledge_pass ).Get_phost( ); ph == nil || *ph != "phost1" {
+		fmt.Fprintf( os.Stderr, "[FAIL] admitted copy was not applied to the held pledge\n" )
+		errs++
+	}
+	if len( inv.recovering ) != 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] pledge still recovering\n" )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   admitted copy applied by recovered()\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	Consent must be asked of the project that the requester's token wasn't validated for.
+*/
+func TestRes_consent_needed( t *testing.T ) {
+	errs := 0
+	xtenant_consent = true
+	consent_tokens = true
+	defer func() { xtenant_consent = false; consent_tokens = false }()
+
+	mine := "p1/vm1"
+	theirs := "!p2/vm2"
+	mine2 := "p2/vm2"
+	ext := "!//10.0.0.1"
+	cases := []struct {
+		h1		*string
+		h2		*string
+		expect	string
+	} {
+		{ &mine, &theirs, "p2" },
+		{ &theirs, &mine, "p2" },
+		{ &mine, &mine2, "" },							// token was good for both
+		{ &mine, &ext, "" },
+	}
+
+	for i, c := range cases {
+		if pid := consent_needed( c.h1, c.h2 ); pid != c.expect {
+			fmt.Fprintf( os.Stderr, "[FAIL] case %d: %s %s: expected consent from %q, got %q\n", i, *c.h1, *c.h2, c.expect, pid )
+			errs++
+		}
+	}
+
+	consent_tokens = false											// nothing validated; second host's project is asked
+	if pid := consent_needed( &mine, &mine2 ); pid != "p2" {
+		fmt.Fprintf( os.Stderr, "[FAIL] without tokens expected consent from p2, got %q\n", pid )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   consent asked of the other project\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	Make a bandwidth pledge created by the selector; vm is host1.
+*/
+func mk_test_member( id string, vm string, sel string ) ( *gizmos.Pledge ) {
+	other := "proj/other"
+	port := "0"
+	cookie := "cookie"
+	now := time.Now().Unix()
+	bp, err := gizmos.Mk_bw_pledge( &vm, &other, &port, &port, now, now + 3600, 1000, 1000, &id, &cookie, 0, false )
+	if err != nil {
+		return nil
+	}
+	bp.Set_selector( sel )
+
+	var p gizmos.Pledge = bp
+	return &p
+}
+
+/*
+	The members of a selector are the pledges which carry its id; the selector must survive
+	the checkpoint, and deleting it needs its cookie and takes its members with it.
+*/
+func TestRes_selectors( t *testing.T ) {
+	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	inv := Mk_inventory( )
+	inv.del_grace = 60											// members are marked rather than sent to the network
+	inv.selectors["sel1"] = &label_sel{ Id: "sel1", Project: "proj", Key: "tier", Value: "web", Other: "proj/other", Sel_first: true, Expiry: time.Now().Unix() + 3600, Cookie: "cookie" }
+	inv.cache["res1"] = mk_test_member( "res1", "proj/vm1", "sel1" )
+	inv.cache["res2"] = mk_test_member( "res2", "proj/vm2", "sel1" )
+	inv.cache["res3"] = mk_test_member( "res3", "proj/vm3", "" )
+
+	members, err := inv.sel_members( "sel1" )
+	if err != nil || len( members ) != 2 || members["proj/vm1"] != "res1" || members["proj/vm2"] != "res2" {
+		fmt.Fprintf( os.Stderr, "[FAIL] selector members wrong: %v %v\n", members, err )
+		errs++
+	}
+
+	ninv := Mk_inventory( )
+	recs := strings.Join( inv.selector_recs(), "\n" ) + "\n"
+	fname := "test"
+	if err = ninv.load_chkpt_rdr( bufio.NewReader( strings.NewReader( recs ) ), &fname, "", false ); err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] selector checkpoint load: %s\n", err )
+		errs++
+	}
+	if s := ninv.selectors["sel1"]; s == nil || *s != *inv.selectors["sel1"] {
+		fmt.Fprintf( os.Stderr, "[FAIL] selector not restored from checkpoint: %v\n", s )
+		errs++
+	}
+
+	bad := "biscuit"
+	if err = inv.del_selector( "sel1", &bad ); err_code( err ) != ERR_NOT_AUTHORISED || inv.selectors["sel1"] == nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] selector deleted with the wrong cookie: %v\n", err )
+		errs++
+	}
+
+	cookie := "cookie"
+	if err = inv.del_selector( "sel1", &cookie ); err != nil || inv.selectors["sel1"] != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] selector not deleted: %v\n", err )
+		errs++
+	}
+	if inv.doomed["res1"] == 0 || inv.doomed["res2"] == 0 || inv.doomed["res3"] != 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] selector members not deleted with it: %v\n", inv.doomed )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   selector members, checkpoint and delete\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	A held watch must be answered on the requester's channel even though res-mgr clears the
+	response channel in the request it holds.
+*/
+func TestRes_watch_answer( t *testing.T ) {
+	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+
+	inv := Mk_inventory( )
+	inv.cache["res-w"] = mk_test_pass( "res-w", "host1" )
+
+	cookie := "cookie"
+	rch := make( chan *ipc.Chmsg, 1 )
+	msg := ipc.Mk_chmsg( )
+	msg.Response_ch = rch
+	if err := inv.add_watch( &res_watch{ name: "res-w", cookie: &cookie, secs: 60 }, msg ); err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] watch not started: %s\n", err )
+		t.Fail()
+		return
+	}
+	msg.Response_ch = nil										// as the res-mgr loop does for a held request
+
+	delete( inv.cache, "res-w" )
+	inv.check_watches( )
+	select {
+		case rmsg := <- rch:
+			if err_code( rmsg.State ) != ERR_NOT_FOUND {
+				fmt.Fprintf( os.Stderr, "[FAIL] watch answer wasn't not-found: %v\n", rmsg.State )
+				t.Fail()
+				return
+			}
+
+		default:
+			fmt.Fprintf( os.Stderr, "[FAIL] watch not answered on the requester's channel\n" )
+			t.Fail()
+			return
+	}
+
+	fmt.Fprintf( os.Stderr, "[OK]   held watch answered\n" )
+}
+
+/*
+	A rejected reservation is accounted as rejected, with no active time, and the delete which
+	follows must not write a second record.
+*/
+func TestRes_acct_rejected( t *testing.T ) {
+	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	osink := acct_sink
+	oprov := net_prov
+	ocookie := super_cookie
+	acct_sink = &rec_sink{ name: "test", ch: make( chan string, 16 ) }			// no writer; records are left on the queue
+	net_prov = &noop_provider{ }
+	admin := "admin"
+	super_cookie = &admin
+	defer func( ) { acct_sink = osink; net_prov = oprov; super_cookie = ocookie }( )
+
+	inv := Mk_inventory( )
+	p := mk_test_member( "res-rej", "proj/vm1", "" )
+	(*p).Set_awaiting_approval( true )
+	inv.cache["res-rej"] = p
+
+	name := "res-rej"
+	if err := inv.approve( &name, false ); err != nil {
+		fmt.Fprintf( os.Stderr, "[FAIL] reject failed: %s\n", err )
+		t.Fail()
+		return
+	}
+
+	if n := len( acct_sink.ch ); n != 1 {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected one accounting record, got %d\n", n )
+		t.Fail()
+		return
+	}
+	rec := <- acct_sink.ch
+	if !strings.Contains( rec, `"reason": "rejected"` ) || !strings.Contains( rec, `"active": 0,` ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] rejected accounting record wrong: %s\n", rec )
+		t.Fail()
+		return
+	}
+
+	fmt.Fprintf( os.Stderr, "[OK]   rejected reservation accounted once as rejected\n" )
+}
+
+/*
+	A reservation cancelled because consent wasn't given in time is accounted as refused
+	rather than deleted.
+*/
+func TestRes_acct_refused( t *testing.T ) {
+	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	osink := acct_sink
+	oprov := net_prov
+	ocookie := super_cookie
+	acct_sink = &rec_sink{ name: "test", ch: make( chan string, 16 ) }
+	net_prov = &noop_provider{ }
+	admin := "admin"
+	super_cookie = &admin
+	defer func( ) { acct_sink = osink; net_prov = oprov; super_cookie = ocookie }( )
+
+	inv := Mk_inventory( )
+	p := mk_test_member( "res-ref", "proj/vm1", "" )
+	(*p).Set_awaiting_approval( true )
+	(*p).Set_consent( "proj2" )
+	inv.cache["res-ref"] = p
+	inv.consent_wait["res-ref"] = time.Now().Unix() - 120
+
+	inv.expire_consent( 60 )
+
+	if n := len( acct_sink.ch ); n != 1 {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected one accounting record, got %d\n", n )
+		t.Fail()
+		return
+	}
+	if rec := <- acct_sink.ch; !strings.Contains( rec, `"reason": "refused"` ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] consent expiry accounting record wrong: %s\n", rec )
+		t.Fail()
+		return
+	}
+
+	fmt.Fprintf( os.Stderr, "[OK]   consent expiry accounted as refused\n" )
+}
+
+/*
+	Wait for the checkpoint writer to release the busy flag; false if it doesn't within a
+	couple of seconds.
+*/
+func chkpt_done( inv *Inventory ) ( bool ) {
+	for i := 0; i < 200; i++ {
+		if len( inv.ckpt_busy ) == 0 {
+			return true
+		}
+		time.Sleep( 10 * time.Millisecond )
+	}
+
+	return false
+}
+
+/*
+	A checkpoint cycle must write the user caps, the selectors and the pledges and release the
+	busy flag; if the checkpoint can't be created nothing is saved and the flag is still
+	released so that the next cycle can run.
+*/
+func TestRes_chkpt_cycle( t *testing.T ) {
+	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	mc := mk_mem_chkpt( "test" )
+	inv := Mk_inventory( )
+	inv.chkpt = mc
+	inv.ulcap_cache["proj"] = 40
+	inv.selectors["sel1"] = &label_sel{ Id: "sel1", Project: "proj", Key: "tier", Value: "web", Other: "proj/other", Sel_first: true, Expiry: time.Now().Unix() + 3600, Cookie: "cookie" }
+	inv.cache["res1"] = mk_test_member( "res1", "proj/vm1", "sel1" )
+
+	if retry, _ := inv.write_chkpt( 0 ); retry || ! chkpt_done( inv ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] checkpoint not written: retry=%v busy=%d\n", retry, len( inv.ckpt_busy ) )
+		t.Fail()
+		return
+	}
+
+	name, ckpt := mc.latest( )
+	if name != "test.1" {
+		fmt.Fprintf( os.Stderr, "[FAIL] checkpoint name: expected test.1 got %q\n", name )
+		errs++
+	}
+	for _, want := range []string{ "ucap: proj 40\n", "lsel: ", `"res1"` } {
+		if ! strings.Contains( ckpt, want ) {
+			fmt.Fprintf( os.Stderr, "[FAIL] checkpoint does not contain %q: %s\n", want, ckpt )
+			errs++
+		}
+	}
+
+	mc.fail_create = true
+	if retry, _ := inv.write_chkpt( 0 ); retry || ! chkpt_done( inv ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] busy flag not released after a failed create: retry=%v\n", retry )
+		errs++
+	}
+	if name, _ := mc.latest( ); name != "test.1" {
+		fmt.Fprintf( os.Stderr, "[FAIL] checkpoint saved though create failed: %s\n", name )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   checkpoint cycle written through the checkpointer and busy released\n" )
+	} else {
+		t.Fail()
+	}
+}
+
+/*
+	An address search must not wait on network: it answers with what is known and the host
+	is looked up in the background. Once the lookup comes back the search finds the pledge.
+	Addresses of a path's end hosts are indexed without a lookup.
+*/
+func TestRes_index_addrs( t *testing.T ) {
+	rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	errs := 0
+
+	old_nw := nw_ch
+	nch := make( chan *ipc.Chmsg, 1 )
+	nw_ch = nch
+	defer func( ) { nw_ch = old_nw }( )
+	go func( ) {												// plays network for the lookup
+		for req := range nch {
+			req.Response_data = "10.0.0.5,FA:16:3E:00:00:05,sw1,3"
+			req.State = nil
+			req.Response_ch <- req
+		}
+	}( )
+
+	rch := make( chan *ipc.Chmsg, 1 )
+	px := mk_pledge_idx( )
+	px.rch = rch
+	px.add( "r1", mk_test_pass( "r1", "proj1/vm1" ) )
+	px.add( "r2", mk_test_pass( "r2", "!/192.168.1.1" ) )
+
+	if ids := px.by_addr( "ip", "10.0.0.5" ); len( ids ) != 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] address found before it was looked up: %v\n", ids )
+		errs++
+	}
+
+	select {
+		case msg := <- rch:
+			if msg.Msg_type != REQ_HOST_ADDRS {
+				fmt.Fprintf( os.Stderr, "[FAIL] lookup sent message type %d\n", msg.Msg_type )
+				errs++
+				break
+			}
+			found := msg.Req_data.( map[string]*host_addrs )
+			if len( found ) != 1 || found["proj1/vm1"] == nil {
+				fmt.Fprintf( os.Stderr, "[FAIL] expected only proj1/vm1 to be looked up: %v\n", found )
+				errs++
+			}
+			px.set_addrs( found )
+
+		case <- time.After( 5 * time.Second ):
+			fmt.Fprintf( os.Stderr, "[FAIL] no lookup result was sent\n" )
+			errs++
+	}
+
+	if ids := px.by_addr( "ip", "10.0.0.5" ); ! ids["r1"] {
+		fmt.Fprintf( os.Stderr, "[FAIL] ip search after lookup: %v\n", ids )
+		errs++
+	}
+	if ids := px.by_addr( "mac", "fa:16:3e:00:00:05" ); ! ids["r1"] {
+		fmt.Fprintf( os.Stderr, "[FAIL] mac search after lookup: %v\n", ids )
+		errs++
+	}
+	if ids := px.by_addr( "ip", "192.168.1.1" ); ! ids["r2"] {
+		fmt.Fprintf( os.Stderr, "[FAIL] external address not indexed: %v\n", ids )
+		errs++
+	}
+
+	px.rch = nil												// no more lookups; the path gives the addresses
+	h1 := gizmos.Mk_host( "FA:16:3E:00:00:07", "10.0.0.7", "" )
+	h2 := gizmos.Mk_host( "FA:16:3E:00:00:08", "10.0.0.8", "" )
+	bp := mk_test_member( "r3", "proj1/vm7", "" )
+	path := gizmos.Mk_path( h1, h2 )
+	(*bp).( *gizmos.Pledge_bw ).Set_path_list( []*gizmos.Path{ path } )
+	px.add( "r3", bp )
+	if ids := px.by_addr( "mac", "FA:16:3E:00:00:08" ); ! ids["r3"] {
+		fmt.Fprintf( os.Stderr, "[FAIL] path host address not indexed: %v\n", ids )
+		errs++
+	}
+
+	if errs == 0 {
+		fmt.Fprintf( os.Stderr, "[OK]   index address searches don't wait on network\n" )
+	} else {
+		t.Fail()
+	}
+}
@@ -0,0 +1,388 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_tiers
+	Abstract:	Per-project service tiers. A tier gives a project a default traffic class,
+				used when a bandwidth or oneway reservation request doesn't supply one, a
+				ceiling on the bandwidth of any one reservation, and a ceiling on the total
+				bandwidth the project may have reserved at any moment. A request whose bandwidth
+				is over the per reservation ceiling is clamped to it (in each direction); one which
+				would put the project over its total is refused. Both directions of a bandwidth
+				reservation count toward the total.
+
+				Tiers are given in the config as a space separated list of project:settings where
+				settings is a comma separated list of dscp=class, max=bandwidth and total=bandwidth
+				(bandwidth as on a reservation, e.g. 100M). The project may be a name or ID; the
+				project * gives the tier for projects which aren't listed. For example:
+					gold:dscp=voice,max=1G,total=10G bronze:dscp=data,max=100M,total=500M *:max=200M
+
+				Tiers may be set, replaced and deleted with the tier admin request; those changes
+				are kept only in memory and are lost on restart.
+
+				Res-mgr holds the tiers. The defaults and per reservation ceiling are applied by
+				the http request handler before the network is asked for a path (so that the
+				clamped bandwidth is what is set aside); the total is checked by res-mgr as the
+				reservation is added, and the tenant is that used by the active limits
+				(res_mgr_limits.go). Project names are translated to IDs by the http side which
+				tells res-mgr the ID of a tier when it learns it.
+
+	CFG:		resmgr:project_tiers - list of project tiers (none)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/att/gopkgs/clike"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type proj_tier struct {
+	project		string						// name or ID as given; * for the default tier
+	id			string						// project ID once the http side has translated the name
+	dscp		string						// traffic class when a request has none; empty leaves the default
+	max_bw		int64						// max bandwidth of a reservation in either direction; 0 is no limit
+	max_total	int64						// max bandwidth reserved by the project at any moment; 0 is no limit
+}
+
+/*
+	Request data for REQ_PROJ_TIER.
+*/
+type tier_req struct {
+	action		string						// get, list, set, del or alias
+	project		string
+	id			string						// alias only
+	tier		*proj_tier					// set only
+}
+
+/*
+	Parse one tier: project:dscp=class,max=bw,total=bw. Settings not given are left
+	unset.
+*/
+func mk_proj_tier( spec string ) ( *proj_tier, error ) {
+	toks := strings.SplitN( spec, ":", 2 )
+	if toks[0] == "" {
+		return nil, fmt.Errorf( "project tier has no project: %s", spec )
+	}
+
+	t := &proj_tier{ project: toks[0] }
+	if len( toks ) < 2 {
+		return t, nil
+	}
+
+	for _, kv := range strings.Split( toks[1], "," ) {
+		if kv == "" {
+			continue
+		}
+
+		ktoks := strings.SplitN( kv, "=", 2 )
+		if len( ktoks ) < 2 || ktoks[1] == "" {
+			return nil, fmt.Errorf( "project tier setting must be key=value: %s", kv )
+		}
+		switch ktoks[0] {
+			case "dscp":
+				t.dscp = ktoks[1]
+
+			case "max":
+				t.max_bw = int64( clike.Atof( ktoks[1] ) )
+
+			case "total":
+				t.max_total = int64( clike.Atof( ktoks[1] ) )
+
+			default:
+				return nil, fmt.Errorf( "unknown project tier setting: %s", ktoks[0] )
+		}
+	}
+
+	if t.max_bw < 0 || t.max_total < 0 {
+		return nil, fmt.Errorf( "project tier bandwidth may not be negative: %s", spec )
+	}
+
+	return t, nil
+}
+
+/*
+	Build the tier map from the config. Bad entries are logged and skipped.
+*/
+func tiers_init( ) ( tiers map[string]*proj_tier ) {
+	tiers = make( map[string]*proj_tier )
+	if cfg_data["resmgr"] == nil || cfg_data["resmgr"]["project_tiers"] == nil {
+		return
+	}
+
+	for _, spec := range strings.Fields( *cfg_data["resmgr"]["project_tiers"] ) {
+		t, err := mk_proj_tier( spec )
+		if err != nil {
+			rm_sheep.Baa( 0, "WRN: resmgr:project_tiers: %s  [TGURMG022]", err )
+			continue
+		}
+		tiers[t.project] = t
+	}
+
+	rm_sheep.Baa( 1, "%d project tiers loaded from the config", len( tiers ) )
+	return
+}
+
+func (t *proj_tier) to_json( ) ( string ) {
+	return fmt.Sprintf( `{ "project": %q, "id": %q, "dscp": %q, "max": %d, "total": %d }`, t.project, t.id, t.dscp, t.max_bw, t.max_total )
+}
+
+/*
+	Return the dscp value, and keep on exit flag, of the tier's traffic class. The values
+	passed in are returned if there is no tier, it has no class, or the class isn't known.
+	Must be called from the http side (tclass2dscp).
+*/
+func (t *proj_tier) def_dscp( dscp int, koe bool ) ( int, bool ) {
+	if t == nil || t.dscp == "" {
+		return dscp, koe
+	}
+
+	tkoe := strings.HasPrefix( t.dscp, "global_" )
+	if v := tclass2dscp[strings.TrimPrefix( t.dscp, "global_" )]; v > 0 {
+		return v, tkoe
+	}
+
+	http_sheep.Baa( 1, "project tier %s has an unknown traffic class; default used: %s", t.project, t.dscp )
+	return dscp, koe
+}
+
+/*
+	Return the bandwidth clamped to the tier's per reservation ceiling.
+*/
+func (t *proj_tier) clamp( bw int64 ) ( int64 ) {
+	if t == nil || t.max_bw <= 0 || bw <= t.max_bw {
+		return bw
+	}
+
+	return t.max_bw
+}
+
+/*
+	Apply the tier to the values of a request: the tier's class when the request didn't
+	give one (given is false), and the ceiling to each bandwidth.
+*/
+func (t *proj_tier) apply( given bool, dscp *int, koe *bool, bws ...*int64 ) {
+	if t == nil {
+		return
+	}
+
+	if ! given {
+		*dscp, *koe = t.def_dscp( *dscp, *koe )
+	}
+	for _, bw := range bws {
+		if cbw := t.clamp( *bw ); cbw != *bw {
+			http_sheep.Baa( 1, "bandwidth %d clamped to the ceiling of project tier %s: %d", *bw, t.project, cbw )
+			*bw = cbw
+		}
+	}
+}
+
+/*
+	Return the project (ID) of the first host, or the second if the first is external. A
+	label selector's project is used for the selector host.
+*/
+func hosts_project( h1 string, h2 string ) ( string ) {
+	for _, h := range []string{ h1, h2 } {
+		if is_selector( h ) {
+			if pid, _, _, err := split_selector( h ); err == nil {
+				return pid
+			}
+			continue
+		}
+
+		if pid := host_project( &h ); pid != "" {
+			return pid
+		}
+	}
+
+	return ""
+}
+
+/*
+	Return a copy of the tier for the project (ID) from res-mgr; nil if there isn't one.
+	Tiers given by name are matched by translating the name; res-mgr is told the ID so
+	that it can find the tier when checking the total.
+*/
+func project_tier( pid string ) ( *proj_tier ) {
+	if pid == "" {
+		return nil
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_PROJ_TIER, &tier_req{ action: "get" }, nil )
+	req = <- my_ch
+	tiers, _ := req.Response_data.( []proj_tier )
+
+	var def *proj_tier
+	for i := range tiers {
+		t := &tiers[i]
+		switch {
+			case t.project == "*":
+				def = t
+
+			case t.project == pid || t.id == pid:
+				return t
+
+			case t.id == "":
+				if proj2id( t.project, my_ch ) == pid {
+					areq := ipc.Mk_chmsg( )
+					areq.Send_req( rmgr_ch, nil, REQ_PROJ_TIER, &tier_req{ action: "alias", project: t.project, id: pid }, nil )
+					t.id = pid
+					return t
+				}
+		}
+	}
+
+	return def
+}
+
+/*
+	Return the tier res-mgr uses for the project (ID); the default tier if none is set.
+*/
+func (inv *Inventory) tier_for( pid string ) ( *proj_tier ) {
+	if t := inv.tiers[pid]; t != nil {
+		return t
+	}
+	for _, t := range inv.tiers {
+		if t.id == pid {
+			return t
+		}
+	}
+
+	return inv.tiers["*"]
+}
+
+/*
+	Return the bandwidth that a pledge counts toward its project's total.
+*/
+func pledge_bandw( p *gizmos.Pledge ) ( int64 ) {
+	switch sp := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			return sp.Get_bandw_in() + sp.Get_bandw_out()
+
+		case *gizmos.Pledge_bwow:
+			return sp.Get_bandwidth()
+	}
+
+	return 0
+}
+
+/*
+	Return an error if adding the pledge would put its project over the total bandwidth
+	of its tier at any moment during its window.
+*/
+func (inv *Inventory) check_tier( p *gizmos.Pledge ) ( error ) {
+	bw := pledge_bandw( p )
+	if len( inv.tiers ) == 0 || bw <= 0 {
+		return nil
+	}
+
+	tenant := pledge_tenant( p )
+	t := inv.tier_for( tenant )
+	if tenant == "" || t == nil || t.max_total <= 0 {
+		return nil
+	}
+
+	windows := make( [][2]int64, 0, 64 )
+	weights := make( []int64, 0, 64 )
+	for _, ip := range inv.cache {
+		if ip == nil || (*ip).Is_expired() || pledge_tenant( ip ) != tenant {
+			continue
+		}
+
+		c, e := (*ip).Get_window()
+		windows = append( windows, [2]int64{ c, e } )
+		weights = append( weights, pledge_bandw( ip ) )
+	}
+
+	c, e := (*p).Get_window()
+	if peak := peak_sum( windows, weights, c, e ); peak + bw > t.max_total {
+		rm_sheep.Baa( 1, "WRN: reservation %s refused: tenant %s would have %d reserved at once; tier total is %d  [TGURMG023]", *(*p).Get_id(), tenant, peak + bw, t.max_total )
+		return mk_err( ERR_CAPACITY, "reservation rejected: the project's total bandwidth of %d would be exceeded (%d already reserved)", t.max_total, peak )
+	}
+
+	return nil
+}
+
+/*
+	Get, list, set or delete tiers; alias records the ID of a tier given by name. Get
+	returns copies of the tiers, list the json, and set the json of the new tier.
+*/
+func (inv *Inventory) tier_req( tr *tier_req ) ( interface{}, error ) {
+	switch tr.action {
+		case "get":
+			tiers := make( []proj_tier, 0, len( inv.tiers ) )
+			for _, t := range inv.tiers {
+				tiers = append( tiers, *t )
+			}
+			return tiers, nil
+
+		case "alias":
+			if t := inv.tiers[tr.project]; t != nil {
+				t.id = tr.id
+			}
+			return nil, nil
+
+		case "set":
+			if old := inv.tiers[tr.tier.project]; old != nil && tr.tier.id == "" {
+				tr.tier.id = old.id
+			}
+			inv.tiers[tr.tier.project] = tr.tier
+			rm_sheep.Baa( 1, "project tier set: %s", tr.tier.to_json() )
+			return tr.tier.to_json(), nil
+
+		case "del":
+			if inv.tiers[tr.project] == nil {
+				return nil, mk_err( ERR_NOT_FOUND, "no tier for project: %s", tr.project )
+			}
+			delete( inv.tiers, tr.project )
+			rm_sheep.Baa( 1, "project tier deleted: %s", tr.project )
+			return fmt.Sprintf( `{ "deleted": %q }`, tr.project ), nil
+	}
+
+	names := make( []string, 0, len( inv.tiers ) )
+	for name := range inv.tiers {
+		names = append( names, name )
+	}
+	sort.Strings( names )
+
+	jstr := `{ "tiers": [ `
+	sep := ""
+	for _, name := range names {
+		jstr += sep + inv.tiers[name].to_json()
+		sep = ", "
+	}
+
+	return jstr + " ] }", nil
+}
@@ -0,0 +1,142 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_timeline
+	Abstract:	Timeline (Gantt) data for the reservations whose windows overlap a period. Each
+				row is one reservation with its start and end, the bandwidth it holds and the
+				times that its state changes, so that a chart shows at a glance where
+				reservations pile up on a link or host. The rows may be limited with the same
+				fields that search uses (host, link, switch, project...).
+
+				Rows are sorted by start time; the group is the pair of hosts so that a chart
+				can put the reservations between the same hosts on one line.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	One reservation on the timeline.
+*/
+type tl_row struct {
+	Id			string				`json:"id"`
+	Name		string				`json:"name"`
+	Kind		string				`json:"kind"`
+	Group		string				`json:"group"`
+	Start		int64				`json:"start"`
+	End			int64				`json:"end"`
+	Asked		int64				`json:"asked_start,omitempty"`		// commence asked for when it was moved forward (res_mgr_late)
+	Bandwidth	int64				`json:"bandwidth"`
+	State		string				`json:"state"`
+	Paused		bool				`json:"paused"`
+	Awaiting	bool				`json:"awaiting_approval"`
+	Changes		[]gizmos.Transition	`json:"transitions"`
+}
+
+type timeline struct {
+	From		int64		`json:"from"`
+	To			int64		`json:"to"`
+	Now			int64		`json:"now"`
+	Rows		[]*tl_row	`json:"rows"`
+}
+
+/*
+	Build the timeline json for reservations whose windows overlap from-to. If q has
+	fields, only the reservations matching all of them are included (see idx_find).
+*/
+func (inv *Inventory) timeline( q map[string]string, from int64, to int64 ) ( string, error ) {
+	if to <= from {
+		return "", mk_err( ERR_BAD_REQUEST, "timeline end (%d) must be after its start (%d)", to, from )
+	}
+
+	var ids map[string]bool
+	if len( q ) > 0 {
+		var err error
+		if ids, err = inv.idx_find( q ); err != nil {
+			return "", err
+		}
+	}
+
+	tl := &timeline{ From: from, To: to, Now: time.Now().Unix(), Rows: make( []*tl_row, 0 ) }
+	for name, p := range inv.cache {
+		if p == nil || strings.HasSuffix( name, ".yank" ) || (ids != nil && ! ids[name]) {
+			continue
+		}
+
+		c, e := (*p).Get_window()
+		if c >= to || e <= from {
+			continue
+		}
+
+		group := ""
+		h1, h2 := (*p).Get_hosts()
+		if h1 != nil {
+			group = *h1
+		}
+		if h2 != nil && *h2 != "" {
+			group += "," + *h2
+		}
+
+		tl.Rows = append( tl.Rows, &tl_row{
+			Id:			name,
+			Name:		inv.res_label( name ),
+			Kind:		gizmos.Pledge_kind_name( *p ),
+			Group:		group,
+			Start:		c,
+			End:		e,
+			Asked:		(*p).Get_late_start(),
+			Bandwidth:	pledge_bandwidth( p ),
+			State:		(*p).Get_state(),
+			Paused:		(*p).Is_paused(),
+			Awaiting:	(*p).Is_awaiting_approval(),
+			Changes:	(*p).Get_transitions(),
+		} )
+	}
+
+	sort.Slice( tl.Rows, func( i, j int ) bool {
+		if tl.Rows[i].Start != tl.Rows[j].Start {
+			return tl.Rows[i].Start < tl.Rows[j].Start
+		}
+		return tl.Rows[i].Id < tl.Rows[j].Id
+	} )
+
+	jb, err := json.Marshal( tl )
+	if err != nil {
+		return "", mk_err( ERR_INTERNAL, "unable to build timeline: %s", err )
+	}
+
+	rm_sheep.Baa( 2, "timeline %d-%d %v: %d reservations", from, to, q, len( tl.Rows ) )
+	return string( jb ), nil
+}
@@ -0,0 +1,147 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_trust
+	Abstract:	Functions which apply only to dscp trust reservations (see gizmos/pledge_trust.go).
+				The members, each VM in scope and its physical host, are found by the network
+				manager each time the reservation is pushed; a VM added to a trusted project
+				is picked up when the reservation is next refreshed. A passthru flow-mod
+				request is sent to fq-mgr for each member. Nothing is obligated in the network
+				so there is nothing to release on delete.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Find the VMs (project/ip) in the pledge's scope and their physical hosts.
+*/
+func trust_members( p *gizmos.Pledge_trust ) ( map[string]*string, error ) {
+	host, _ := p.Get_hosts()
+
+	if p.Is_project() {
+		pid := p.Get_project()
+		req := nw_req( REQ_PROJ_MEMBERS, &pid, nil )
+		if req.State != nil {
+			return nil, req.State
+		}
+		m, _ := req.Response_data.( map[string]*string )
+		return m, nil
+	}
+
+	update_graph( host, true, true )
+	ip := name2ip( host )
+	if ip == nil {
+		return nil, fmt.Errorf( "unable to find address of %s", *host )
+	}
+
+	req := nw_req( REQ_GETPHOST, host, nil )
+	phost, _ := req.Response_data.( *string )
+	if phost == nil {
+		return nil, fmt.Errorf( "unable to find phost of %s: %v", *host, req.State )
+	}
+
+	return map[string]*string{ *ip: phost }, nil
+}
+
+/*
+	Find the members of a trust pledge loaded from a checkpoint. A VM scoped pledge whose VM
+	can't be found is put on the retry list; a project with no known VMs is not an error.
+*/
+func admit_trust( gp *gizmos.Pledge ) ( error ) {
+	p := (*gp).( *gizmos.Pledge_trust )
+	m, err := trust_members( p )
+	if err != nil {
+		return err
+	}
+
+	p.Set_members( m )
+	rm_sheep.Baa( 1, "trust members found for chkptd reservation: %s %d", *p.Get_id(), len( m ) )
+	return nil
+}
+
+/*
+	Push a trust pledge: a passthru flow-mod request to fq-mgr for each member. Expiry is
+	capped at to_limit as is done for passthru reservations.
+*/
+func push_trust( gp *gizmos.Pledge, rname *string, ctx interface{} ) {
+	pc := ctx.( *push_ctx )
+
+	p, ok := (*gp).( *gizmos.Pledge_trust )
+	if ! ok {
+		rm_sheep.Baa( 1, "internal error in push_trust: pledge isn't a trust pledge" )
+		(*gp).Set_pushed()						// prevent looping
+		return
+	}
+
+	m, err := trust_members( p )
+	if err != nil {
+		rm_sheep.Baa( 1, "unable to find members of trust reservation %s: %s", *rname, err )
+		return									// not marked pushed; tried again on the next push
+	}
+	p.Set_members( m )
+
+	now := time.Now().Unix()
+	_, _, expiry, proto := p.Get_values()
+	if pause_by_expiry( *gp ) {
+		expiry = pause_expiry( *gp )
+	} else {
+		if pc.hto_limit > 0 && expiry > now + pc.hto_limit {
+			expiry = now + pc.hto_limit
+		}
+	}
+
+	for ip, phost := range m {
+		sip := ip								// range var is reused; each request needs its own
+		freq := Mk_fqreq( rname )
+		freq.Match.Smac = &sip					// fq-mgr converts to mac
+		freq.Swid = phost
+		freq.Cookie = 0xffff
+		freq.Expiry = expiry
+		freq.Id = rname
+		freq.Cid = p.Get_cid()
+		freq.Extip = &empty_str
+		dup_str := ""
+		freq.Exttyp = &dup_str
+		freq.Match.Ip1 = proto
+		freq.Match.Ip2 = nil
+		freq.Espq = nil
+
+		msg := ipc.Mk_chmsg()
+		msg.Send_req( fq_ch, pc.ch, REQ_PT_RESERVE, freq, nil )
+	}
+
+	rm_sheep.Baa( 1, "pushing trust reservation: %s members=%d", p, len( m ) )
+	p.Set_pushed()
+}
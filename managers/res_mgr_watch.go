@@ -0,0 +1,178 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	res_mgr_watch
+	Abstract:	Watches on reservation status (resstatus watch=sec). Rather than answering the
+				request straight away res-mgr holds it until the reservation's status changes
+				or the watch times out, then responds with the status as resstatus would. The
+				status is the reservation's phase (below), whether it is pushed or paused, and
+				the last flow-mod event (installed or install_failed, res_mgr_fmstat.go).
+
+				Phases are PENDING, ACTIVE and EXPIRED (the window), or AWAITING_CONSENT,
+				AWAITING_APPROVAL, DELETE_PENDING, SLA_BREACH (res_mgr_sla.go) and RETRY. If the reservation is deleted
+				while it's being watched the watch ends with a not found error.
+
+				The watches are checked after each message that res-mgr processes; the timed
+				push and queue tickles ensure that this happens at least every couple of seconds
+				so a watch ends close to its deadline.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Phase of a reservation marked in breach of its guarantee is SLA_BREACH.
+				16 Oct 2026 - The response channel is kept with the watch; res-mgr clears the one in the held request.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+const (
+	MAX_WATCHES		int = 1024					// outstanding watches
+	MAX_WATCH_SECS	int64 = 300					// longest a watch may wait
+)
+
+/*
+	An outstanding watch.
+*/
+type res_watch struct {
+	name		string
+	cookie		*string
+	secs		int64							// requested wait
+	sig			string							// status when the watch started
+	deadline	int64
+	msg			*ipc.Chmsg						// request to answer
+	rch			chan *ipc.Chmsg					// its response channel; res-mgr clears the one in msg
+}
+
+/*
+	Return the phase of the reservation; empty string if it's not known.
+*/
+func (inv *Inventory) res_phase( name string ) ( string ) {
+	p := inv.cache[name]
+	if p == nil {
+		if inv.retry[name] != nil {
+			return "RETRY"
+		}
+		return ""
+	}
+
+	switch {
+		case inv.doomed[name] > 0:
+			return "DELETE_PENDING"
+
+		case (*p).Get_consent() != "":
+			return "AWAITING_CONSENT"
+
+		case (*p).Is_awaiting_approval():
+			return "AWAITING_APPROVAL"
+
+		case (*p).Is_sla_breach():
+			return "SLA_BREACH"
+	}
+
+	return (*p).Get_state()
+}
+
+/*
+	Build the status signature compared by a watch; empty if the reservation is gone.
+*/
+func (inv *Inventory) watch_sig( name string ) ( string ) {
+	phase := inv.res_phase( name )
+	if phase == "" {
+		return ""
+	}
+
+	pushed := false
+	paused := false
+	if p := inv.cache[name]; p != nil {
+		pushed = (*p).Is_pushed()
+		paused = (*p).Is_paused()
+	}
+	event := ""
+	if rs := inv.fmstat[name]; rs != nil {
+		event = rs.event
+	}
+
+	return fmt.Sprintf( "%s/%v/%v/%s", phase, pushed, paused, event )
+}
+
+/*
+	Start a watch. The status is validated (the reservation must exist and the cookie be
+	valid) and an error returned if not, or if there are too many watches; the request must
+	then be answered now. A nil return means the request is held and answered later.
+*/
+func (inv *Inventory) add_watch( w *res_watch, msg *ipc.Chmsg ) ( error ) {
+	if _, err := inv.fmstat_json( &w.name, w.cookie ); err != nil {
+		return err
+	}
+	if len( inv.watches ) >= MAX_WATCHES {
+		return mk_err( ERR_CAPACITY, "too many reservation watches outstanding; try again later" )
+	}
+
+	if w.secs <= 0 || w.secs > MAX_WATCH_SECS {
+		w.secs = MAX_WATCH_SECS
+	}
+	w.sig = inv.watch_sig( w.name )
+	w.deadline = time.Now().Unix() + w.secs
+	w.msg = msg
+	w.rch = msg.Response_ch
+	inv.watches = append( inv.watches, w )
+
+	rm_sheep.Baa( 2, "watch started on %s for %ds: %s", w.name, w.secs, w.sig )
+	return nil
+}
+
+/*
+	Answer the watches whose reservation has changed, gone, or whose time is up.
+*/
+func (inv *Inventory) check_watches( ) {
+	now := time.Now().Unix()
+
+	keep := inv.watches[:0]
+	for _, w := range inv.watches {
+		sig := inv.watch_sig( w.name )
+		if sig == w.sig && now < w.deadline {
+			keep = append( keep, w )
+			continue
+		}
+
+		if sig == "" {
+			w.msg.Response_data = nil
+			w.msg.State = mk_err( ERR_NOT_FOUND, "reservation no longer exists: %s", w.name )
+		} else {
+			w.msg.Response_data, w.msg.State = inv.fmstat_json( &w.name, w.cookie )
+		}
+		rm_sheep.Baa( 2, "watch on %s ended: changed=%v %s", w.name, sig != w.sig, sig )
+		w.rch <- w.msg
+	}
+
+	for i := len( keep ); i < len( inv.watches ); i++ {
+		inv.watches[i] = nil										// let go of those answered
+	}
+	inv.watches = keep
+}
@@ -23,6 +23,8 @@
 	Mnemonic:	rm_recovery
 	Abstract:	Functions associated with recovering reservations either from a checkpoint/datacache
 				or that had recoverable failures during checkpoint/datacache recovery.
+	CFG:		resmgr:chkpt_quarantine - file that records which can't be loaded are appended to (<chkpt_dir>/quarantine)
+
 	Date:		22 March 2016  (extracted from res_mgr)
 	Author:		E. Scott Daniels
 
@@ -31,6 +33,17 @@
 						Corrected bad bleat message.
 						Correct potential nil ptr exeeption in vet.
 				20 Apr 2017 - Prevent core dump if chkpt file has blank line.
+				16 Oct 2026 - Mask cookies when logging checkpoint strings.
+				16 Oct 2026 - Split reading the records from opening the file so that snapshots can be loaded.
+				16 Oct 2026 - Active reservation limits are not applied to reloaded pledges.
+				16 Oct 2026 - Vetting uses the admission function registered for the pledge kind.
+				16 Oct 2026 - Vetting returns the reason; checkpoint load builds a recovery report (rm_recovery_report.go).
+				16 Oct 2026 - Checkpoint load can leave admission to background workers (rm_recovery_async.go).
+				16 Oct 2026 - A record that can't be decoded is reported with its line in the checkpoint.
+				16 Oct 2026 - Records that can't be decoded or restored are written to a quarantine file and the
+						load continues; read errors are kept apart from record errors so that one bad record
+						no longer ends the load.
+				16 Oct 2026 - Label selector (lsel:) records are restored.
 */
 
 package managers
@@ -42,126 +55,75 @@ import (
 	"os"
 	"strings"
 
-	"github.com/att/gopkgs/ipc"
 	"github.com/att/tegu/gizmos"
 )
 
 /*
-	Given a pledge, vet it. Called during checkpoint load, or when running the 
-	retry queue. Returns a diposition state:
-		DS_ADD 		- Add pledge to reservation cache
-		DS_RETRY	- Add to retry queue (recoverable error)
-		DS_DISCARD	- Discard it; error but not recoverable
+	Return the name of the file that records which can't be loaded from a checkpoint are
+	written to: resmgr:chkpt_quarantine, or quarantine in the checkpoint directory. The
+	config is read only, so this is safe from any goroutine.
 */
-func vet_pledge( p *gizmos.Pledge ) ( disposition int ) {
-	var (
-		my_ch	chan	*ipc.Chmsg
-	)
-
-	if p == nil {
-		return DS_DISCARD
+func chkpt_quarantine( ) ( string ) {
+	dir := "/var/lib/tegu"
+	if cfg_data["resmgr"] != nil {
+		if p := cfg_data["resmgr"]["chkpt_quarantine"]; p != nil && *p != "" {
+			return *p
+		}
+		if p := cfg_data["resmgr"]["chkpt_dir"]; p != nil {
+			dir = *p
+		}
 	}
 
-	if  (*p).Is_expired() {
-		rm_sheep.Baa( 1, "resmgr: ckpt_load: ignored expired pledge: %s", (*p).String() )
-		return DS_DISCARD
-	} else {
-		switch sp := (*p).(type) {									// work on specific pledge type, but pass the Pledge interface to add()
-			case *gizmos.Pledge_mirror:
-				//err = i.Add_res( p )								// assume we can just add it back in as is
-
-			case *gizmos.Pledge_steer:
-				rm_sheep.Baa( 0, "did not restore steering reservation from checkpoint; not implemented" )
-				return DS_DISCARD
-
-			case *gizmos.Pledge_bwow:
-				h1, h2 := sp.Get_hosts( )							// get the host names, fetch ostack data and update graph
-				push_block := h2 == nil
-				update_graph( h1, push_block, push_block )			// dig h1 info; push to netmgr if h2 isn't known and block on response
-				if h2 != nil {
-					update_graph( h2, true, true )					// dig h2 data and push to netmgr blocking for a netmgr response
-				}
-
-				my_ch = make( chan *ipc.Chmsg )
-				req := ipc.Mk_chmsg( )								// now safe to ask netmgr to validate the oneway pledge
-				req.Send_req( nw_ch, my_ch, REQ_BWOW_RESERVE, sp, nil )
-				req = <- my_ch										// should be OK, but the underlying network could have changed
+	return dir + "/quarantine"
+}
 
-				if req.Response_data != nil {
-					gate := req.Response_data.( *gizmos.Gate )		// expect that network sent us a gate
-					sp.Set_gate( gate )
+/*
+	Given a pledge, vet it. Called during checkpoint load, or when running the 
+	retry queue. Returns a diposition state and the reason when it's not DS_ADD:
+		DS_ADD 		- Add pledge to reservation cache
+		DS_RETRY	- Add to retry queue (recoverable error)
+		DS_DISCARD	- Discard it; error but not recoverable (reason is "expired" if it expired)
 
-					gate_ip := "nil"
-					gipp := gate.Get_extip()
-					if gipp != nil {
-						gate_ip = *gipp
-					}
-					h2s := "nil"
-					if h2 != nil {
-						h2s = *h2
-					}
-					rm_sheep.Baa( 1, "gate allocated for oneway reservation: %s h1=%s h2=%s gate_ip=%s", *(sp.Get_id()), *h1, h2s, gate_ip )
-					//err = i.Add_res( p )
-				} else {
-					rm_sheep.Baa( 0, "WRN: pledge_vet: unable to reserve for oneway pledge: %s	[TGURMG000]", (*p).To_str() )
-					return  DS_RETRY
-				}
+	Logging is left to the caller.
+*/
+func vet_pledge( p *gizmos.Pledge ) ( disposition int, why string ) {
+	if disposition, why = vet_static( p ); disposition != DS_ADD {
+		return
+	}
 
-			case *gizmos.Pledge_bw:
-				h1, h2 := sp.Get_hosts( )							// get the host names, fetch ostack data and update graph
-				update_graph( h1, false, false )					// don't need to block on this one, nor update fqmgr
-				update_graph( h2, true, true )						// wait for netmgr to update graph and then push related data to fqmgr
-
-				my_ch = make( chan *ipc.Chmsg )
-				req := ipc.Mk_chmsg( )								// now safe to ask netmgr to find a path for the pledge
-				rm_sheep.Baa( 2, "reserving path starts" )
-				req.Send_req( nw_ch, my_ch, REQ_BW_RESERVE, sp, nil )
-				req = <- my_ch										// should be OK, but the underlying network could have changed
-
-				if req.Response_data != nil {
-				rm_sheep.Baa( 2, "reserving path finished" )
-					path_list := req.Response_data.( []*gizmos.Path )			// path(s) that were found to be suitable for the reservation
-					sp.Set_path_list( path_list )
-					rm_sheep.Baa( 1, "path allocated for chkptd reservation: %s %s %s; path length= %d", *(sp.Get_id()), *h1, *h2, len( path_list ) )
-					//err = i.Add_res( p )
-				} else {
-					rm_sheep.Baa( 0, "WRN: pledge_vet: unable to reserve for pledge: %s	[TGURMG000]", (*p).To_str() )
-					return  DS_RETRY
-				}
+	k := gizmos.Pledge_kind_of( *p )						// admission is specific to the kind of pledge (see res_mgr_kinds.go)
+	if k.Admit != nil {
+		if err := k.Admit( p ); err != nil {
+			return DS_RETRY, err.Error()
+		}
+	}
 
-			case *gizmos.Pledge_pass:
-				host, _ := sp.Get_hosts()
-				update_graph( host, true, true )
+	return DS_ADD, ""
+}
 
-				my_ch = make( chan *ipc.Chmsg )
-				req := ipc.Mk_chmsg( )								// now safe to ask netmgr to find a path for the pledge
-				req.Send_req( nw_ch, my_ch, REQ_GETPHOST, host, nil )		// need to find the current phost for the vm
-				req = <- my_ch
+/*
+	The checks that don't need the network: the pledge hasn't expired and is a kind that
+	can be restored. DS_ADD is returned if admission is all that remains.
+*/
+func vet_static( p *gizmos.Pledge ) ( disposition int, why string ) {
+	if p == nil {
+		return DS_DISCARD, "no pledge"
+	}
 
-				if req.Response_data != nil {
-					phost := req.Response_data.( *string  )
-					sp.Set_phost( phost )
-					rm_sheep.Baa( 1, "passthrou phost found  for chkptd reservation: %s %s %s", *(sp.Get_id()), *host, *phost )
-					//err = i.Add_res( p )
-				} else {
-					s := fmt.Errorf( "unknown reason" )
-					if req.State != nil {
-						s = req.State
-					}
-					rm_sheep.Baa( 0, "WRN: pledge_vet: unable to find phost for passthru pledge: %s	[TGURMG000]", s )
-					rm_sheep.Baa( 0, "erroring passthru pledge: %s", (*p).To_str() )
-					return  DS_RETRY
-				}
-				
+	if  (*p).Is_expired() {
+		return DS_DISCARD, "expired"
+	}
 
-			default:
-				rm_sheep.Baa( 0, "rmgr/vet_pledge: unrecognised pledge type" )
-				return DS_DISCARD
+	k := gizmos.Pledge_kind_of( *p )						// admission is specific to the kind of pledge (see res_mgr_kinds.go)
+	if k == nil {
+		return DS_DISCARD, "unrecognised pledge type"
+	}
 
-		}						// end switch on specific pledge type
+	if ! k.Restore {
+		return DS_DISCARD, fmt.Sprintf( "restore of %s reservations is not implemented", k.Name )
 	}
 
-	return DS_ADD
+	return DS_ADD, ""
 }
 
 /*
@@ -198,7 +160,7 @@ func (inv *Inventory) Add_retry( pi interface{} ) (err error) {
 
 	inv.retry[*id] = p
 
-	rm_sheep.Baa( 1, "resgmgr: added reservation to retry cache: %s", (*p).To_chkpt() )
+	rm_sheep.Baa( 1, "resgmgr: added reservation to retry cache: %s", gizmos.Redact_chkpt( (*p).To_chkpt() ) )
 	return
 }
 
@@ -206,17 +168,9 @@ func (inv *Inventory) Add_retry( pi interface{} ) (err error) {
 	Opens the filename passed in and reads the reservation data from it. The assumption is
 	that records in the file were saved via the write_chkpt() function and are JSON pledges
 	or other serializable objects.  We will drop any pledges that expired while 'sitting'
-	in the file.
+	in the file. Records that can't be loaded are quarantined (see load_chkpt_rdr).
 */
 func (inv *Inventory) load_chkpt( fname *string ) ( err error ) {
-	var (
-		rec		string
-		nrecs	int = 0
-		p		*gizmos.Pledge
-	)
-
-	err = nil
-
 	f, err := os.Open( *fname )
 	if err != nil {
 		rm_sheep.Baa( 1, "checkpoint open failed for %s: %s", *fname, err )
@@ -224,16 +178,49 @@ func (inv *Inventory) load_chkpt( fname *string ) ( err error ) {
 	}
 	defer f.Close( )
 
+	return inv.load_chkpt_rdr( bufio.NewReader( f ), fname, chkpt_quarantine( ), true )
+}
+
+/*
+	Read checkpoint records from the reader; fname is used only in messages. If async is
+	true, and recovery workers are configured, pledges which pass the static checks are
+	held as recovering and admitted later by the workers (see start_recovery).
+
+	A record which can't be decoded, or a pledge which is dropped for a reason other than
+	having expired, is appended to the quarantine file (qname; none if empty) and the load
+	carries on with the next record. Each quarantined record is preceded by a comment line
+	giving the source and reason; comment lines are skipped here, so a repaired quarantine
+	file can itself be loaded. The error returned is a read error, if any; record errors
+	are only in the recovery report.
+*/
+func (inv *Inventory) load_chkpt_rdr( br *bufio.Reader, fname *string, qname string, async bool ) ( err error ) {
+	var (
+		rec		string
+		rerr	error				// read error; kept apart from record errors so they don't end the loop
+		nrecs	int = 0
+		lineno	int = 0				// line in the checkpoint, for messages
+	)
+
+	err = nil
 	rm_sheep.Baa( 1, "loading from checkpoint: %s", *fname )
 
-	added := 0			// counters for end bleat
-	queued := 0
-	failed := 0
+	async = async && inv.rcv_workers > 0
+	inv.recovery = mk_recovery_report( *fname )			// individual dispositions go to the report rather than the log
+	inv.recovery.qfile = qname
+	defer func( ) {
+		inv.recovery.nrecs = nrecs
+		inv.recovery.err = err
+		if inv.recovery.pending == 0 {
+			inv.recovery_done( )
+		} else {
+			rm_sheep.Baa( 1, "checkpoint read: %d reservations will be recovered in the background", inv.recovery.pending )
+		}
+	}( )
 
-	br := bufio.NewReader( f )
-	for ; err == nil ; {
-		rec, err = br.ReadString( '\n' )
-		if err == nil && len( rec ) > 5  {
+	for ; rerr == nil ; {
+		rec, rerr = br.ReadString( '\n' )					// last record may not have a newline, so rec is used even at eof
+		lineno++
+		if len( rec ) > 5 && rec[0] != '#' {
 			nrecs++
 
 			switch rec[0:5] {
@@ -241,42 +228,102 @@ func (inv *Inventory) load_chkpt( fname *string ) ( err error ) {
 					toks := strings.Split( rec, " " )
 					if len( toks ) == 3 {
 						inv.add_ulcap( &toks[1], &toks[2] )
+					} else {
+						inv.recovery.quarantine( rec, "", fmt.Sprintf( "line %d: malformed user cap record", lineno ) )
+					}
+
+				case "lsel:":										// label selector (res_mgr_label)
+					if serr := inv.load_selector( strings.TrimSpace( rec[5:] ) ); serr != nil {
+						inv.recovery.quarantine( rec, "", fmt.Sprintf( "line %d: bad selector record: %s", lineno, serr ) )
 					}
 
 				default:
-					p, err = gizmos.Json2pledge( &rec )			// convert any type of json pledge to Pledge
-					if err == nil {
-						switch vet_pledge( p ) {
-							case DS_ADD:
-								rm_sheep.Baa( 2, "reservaton vetted; added to the cache: %s", *((*p).Get_id()) )
-								err = inv.Add_res( p )				// vet ok, add to reservation cache
-								added++
-
-							case DS_RETRY:
-								rm_sheep.Baa( 2, "reservaton had recoverable errors; added to retry list: %s", *((*p).Get_id()) )
-								inv.Add_retry( p )
-								queued++
-
-							default:
-								rm_sheep.Baa( 2, "reservaton expired or had unrecoverable errors; discarded: %s", p )
-								failed++
+					p, perr := gizmos.Json2pledge( &rec )			// convert any type of json pledge to Pledge
+					if perr == nil {
+						if async {
+							ds, why := vet_static( p )
+							id := *((*p).Get_id())
+							if ds == DS_ADD && inv.recovering[id] == nil {
+								rm_sheep.Baa( 2, "reservation held for background recovery: %s", id )
+								inv.recovering[id] = p
+								inv.recovery.pending++
+							} else {
+								if ds == DS_ADD {
+									ds = DS_DISCARD
+									why = "duplicate in checkpoint"
+								}
+								inv.settle_pledge( p, ds, why )
+							}
+						} else {
+							ds, why := vet_pledge( p )
+							inv.settle_pledge( p, ds, why )
 						}
 					} else {
-						rm_sheep.Baa( 0, "CRI: %s", err )
-						return			// quickk escape
+						why := fmt.Sprintf( "line %d: %s", lineno, gizmos.Redact_chkpt( perr.Error() ) )
+						rm_sheep.Baa( 1, "checkpoint %s %s", *fname, why )
+						inv.recovery.quarantine( rec, "", why )
 					}
 			}				// outer switch
 		}
 	}
 
-	if err == io.EOF {
-		err = nil
+	if rerr != io.EOF {
+		err = fmt.Errorf( "checkpoint %s line %d: read failed: %s", *fname, lineno, rerr )
+		rm_sheep.Baa( 0, "CRI: %s", err )
 	}
 
-	rm_sheep.Baa( 1, "read %d records from checkpoint file: %s:  %d adds; %d queued for retry; %d dropped", nrecs, *fname, added, queued, failed )
 	return
 }
 
+/*
+	Act on the disposition of a vetted pledge read from the checkpoint and record it in the
+	recovery report. Returns true if the pledge was added to the cache.
+*/
+func (inv *Inventory) settle_pledge( p *gizmos.Pledge, ds int, why string ) ( added bool ) {
+	id := *((*p).Get_id())
+	switch ds {
+		case DS_ADD:
+			rm_sheep.Baa( 2, "reservaton vetted; added to the cache: %s", id )
+			if err := inv.add_res( p, false ); err != nil {		// vet ok, add to reservation cache; admitted before so limits don't apply
+				ds = DS_DISCARD
+				why = err.Error()
+			} else {
+				added = true
+			}
+
+		case DS_RETRY:
+			rm_sheep.Baa( 2, "reservaton had recoverable errors; added to retry list: %s: %s", id, why )
+			inv.Add_retry( p )
+
+		default:
+			rm_sheep.Baa( 2, "reservaton discarded: %s: %s", id, why )
+			if why != "expired" && inv.recovery != nil {
+				inv.recovery.quarantine( (*p).To_chkpt(), id, why )
+			}
+	}
+
+	if inv.recovery != nil {
+		inv.recovery.add( id, ds, why )
+	}
+	return added
+}
+
+/*
+	Log and publish the recovery report once every pledge read from the checkpoint has
+	been dealt with.
+*/
+func (inv *Inventory) recovery_done( ) {
+	rpt := inv.recovery
+	rm_sheep.Baa( 1, "checkpoint recovery: %s", rpt )
+	if len( rpt.retry ) + len( rpt.dropped ) > 0 {
+		rm_sheep.Baa( 0, "WRN: not all reservations were recovered from checkpoint; %d queued for retry, %d dropped; see the recovery report  [TGURMG012]", len( rpt.retry ), len( rpt.dropped ) )
+	}
+	if len( rpt.quarantined ) > 0 {
+		rm_sheep.Baa( 0, "WRN: %d checkpoint records could not be loaded; see the quarantine file %q  [TGURMG025]", len( rpt.quarantined ), rpt.qfile )
+	}
+	publish_event( "recovery.report", rpt.To_json() )
+}
+
 /*
 	Driven now and again to attempt to push any reservations in the retry cash back into 
 	the real world. 
@@ -288,9 +335,10 @@ func( inv *Inventory ) vet_retries( ) {
 	for k, v := range inv.retry {
 		tried++
 
-		switch vet_pledge( v ) {
+		ds, why := vet_pledge( v )
+		switch ds {
 			case DS_ADD:						// pledge can now be supported
-				err := inv.Add_res( v )
+				err := inv.add_res( v, false )
 				if err == nil {
 					moved++
 					delete( inv.retry, k )			// drop from retry queue
@@ -299,11 +347,11 @@ func( inv *Inventory ) vet_retries( ) {
 				}
 
 			case DS_DISCARD:					// something didn't work in a non-recoverable way, drop the reserbation
-				rm_sheep.Baa( 1, "pledge vetting failed in a non-recoverable way, dropped" )
+				rm_sheep.Baa( 1, "pledge vetting failed in a non-recoverable way, dropped: %s: %s", k, why )
 				delete( inv.retry, k )			// drop from retry queue
 
 			default:							// let it ride
-				rm_sheep.Baa( 2, "reservaton had recoverable errors; kept on the retry list: %s", k )
+				rm_sheep.Baa( 2, "reservaton had recoverable errors; kept on the retry list: %s: %s", k, why )
 		}
 	}
 
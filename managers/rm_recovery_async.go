@@ -0,0 +1,155 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	rm_recovery_async
+	Abstract:	Background recovery of checkpointed reservations. Admitting a pledge read from
+				the checkpoint means a round trip (or several) to network manager for each one,
+				and with a large checkpoint that held up the opening of the API. Instead, the
+				load only makes the checks that don't need the network and holds the pledges
+				that pass as recovering; the load request returns and the API opens at once.
+				A small pool of workers then admits the held pledges, sending each result back
+				to res_mgr (REQ_RECOVERED) which adds the pledge to the cache, where it is
+				pushed on the next push tickle, or queues it for retry.
+
+				The held pledges are read on the res_mgr goroutine (checkpoints, listres)
+				while the workers run, so a worker admits a copy of the pledge (Snapshot())
+				and the copy, with the paths, gate or phost that admission set, replaces the
+				held pledge when res_mgr deals with the result.
+
+				Recovering pledges are written to checkpoints, are listed (ids only) by
+				listres, and progress is given in the recovery report and by recovery.progress
+				events.
+
+				Until the last of them is settled the inventory can't say what capacity is in
+				use, so new reservations are refused (busy) rather than admitted against a
+				partial picture. Fetching a reservation that is still recovering reports busy
+				rather than not found, and the duplicate check includes recovering pledges.
+
+	CFG:		resmgr:recovery_workers - number of background workers; 0 admits during the load (4)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+		16 Oct 2026 - Refuse new reservations, and report busy for those not yet recovered, until recovery finishes.
+		16 Oct 2026 - Workers admit a copy of the pledge which is applied by res_mgr (data race).
+*/
+
+package managers
+
+import (
+	"fmt"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Result of admitting one pledge sent from a worker to res_mgr.
+*/
+type rcv_result struct {
+	p		*gizmos.Pledge
+	admitted	gizmos.Pledge					// the copy that the worker admitted
+	ds		int
+	why		string
+}
+
+/*
+	Start the workers for the pledges held by the checkpoint load. Results are sent to the
+	channel (res_mgr's).
+*/
+func (inv *Inventory) start_recovery( rch chan *ipc.Chmsg ) {
+	if len( inv.recovering ) == 0 {
+		return
+	}
+
+	work := make( chan *rcv_result, len( inv.recovering ) )
+	for _, p := range inv.recovering {
+		work <- &rcv_result{ p: p, admitted: (*p).Snapshot( ) }
+	}
+	close( work )
+
+	n := inv.rcv_workers
+	if n > len( inv.recovering ) {
+		n = len( inv.recovering )
+	}
+	rm_sheep.Baa( 1, "starting %d workers to recover %d reservations", n, len( inv.recovering ) )
+	for i := 0; i < n; i++ {
+		go rcv_worker( work, rch )
+	}
+}
+
+/*
+	Admit pledges until the work runs out. Vet_pledge makes no reference to the inventory,
+	and admission changes only the copy, so this is safe off of the res_mgr goroutine. The
+	copy is made by start_recovery() on the res_mgr goroutine.
+*/
+func rcv_worker( work chan *rcv_result, rch chan *ipc.Chmsg ) {
+	for r := range work {
+		r.ds, r.why = vet_pledge( &r.admitted )
+		msg := ipc.Mk_chmsg( )
+		msg.Send_req( rch, nil, REQ_RECOVERED, r, nil )
+	}
+}
+
+/*
+	Deal with a worker's result. Returns true if the pledge was added to the cache and thus
+	a push is needed.
+*/
+func (inv *Inventory) recovered( r *rcv_result ) ( added bool ) {
+	id := *((*r.p).Get_id())
+	if inv.recovering[id] == nil {
+		return false							// shouldn't happen
+	}
+	delete( inv.recovering, id )
+
+	if r.ds == DS_ADD && r.admitted != nil {
+		*r.p = r.admitted						// take the admitted copy; a retry is admitted again from the original
+	}
+	added = inv.settle_pledge( r.p, r.ds, r.why )
+	rpt := inv.recovery
+	rpt.pending--
+
+	done := len( rpt.loaded ) + len( rpt.expired ) + len( rpt.retry ) + len( rpt.dropped )
+	if rpt.pending == 0 {
+		inv.recovery_done( )
+	} else {
+		if done % 25 == 0 {
+			rm_sheep.Baa( 1, "recovery progress: %d done, %d remaining", done, rpt.pending )
+			publish_event( "recovery.progress", fmt.Sprintf( `{ "done": %d, "remaining": %d }`, done, rpt.pending ) )
+		}
+	}
+
+	return added
+}
+
+/*
+	Return the ids of the recovering pledges as a json array.
+*/
+func (inv *Inventory) recovering_json( ) ( string ) {
+	ids := make( []string, 0, len( inv.recovering ) )
+	for id := range inv.recovering {
+		ids = append( ids, id )
+	}
+
+	return ids2json( ids )
+}
@@ -0,0 +1,188 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	rm_recovery_report
+	Abstract:	The outcome of a checkpoint load collected in one place. Each pledge read is
+				listed as loaded, dropped because it expired while tegu was down, queued for
+				retry (admission, usually finding a path, failed in a recoverable way) or
+				dropped for some other reason, along with the reason. The report is published
+				as a recovery.report event when the load finishes and kept so that it can be
+				fetched later with the recovery admin request. This lets an operator confirm
+				after a restart that nothing of importance was quietly lost.
+
+				Records which couldn't be decoded, and pledges dropped for a reason other than
+				expiry, are also quarantined: appended, each after a comment line with the time,
+				source and reason, to the quarantine file so that they can be repaired and
+				loaded again. The file is only ever appended to; it is up to the operator to
+				clear it.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Added pending count for background recovery.
+				16 Oct 2026 - Added quarantined records.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+	A pledge that wasn't loaded and why.
+*/
+type recovery_item struct {
+	id		string
+	why		string
+}
+
+type recovery_report struct {
+	fname	string
+	when	int64
+	nrecs	int						// records read
+	loaded	[]string
+	expired	[]string
+	retry	[]*recovery_item		// recoverable failures; on the retry queue
+	dropped	[]*recovery_item		// unrecoverable failures
+	pending	int						// still being recovered by the background workers
+	err		error					// load stopped early
+	qfile	string					// quarantine file; records aren't written if empty
+	qerr	error					// first error writing the quarantine file
+	quarantined	[]*recovery_item	// records written (or that should have been) to the quarantine file
+}
+
+func mk_recovery_report( fname string ) ( *recovery_report ) {
+	return &recovery_report{
+		fname:		fname,
+		when:		time.Now().Unix(),
+		loaded:		make( []string, 0 ),
+		expired:	make( []string, 0 ),
+		retry:		make( []*recovery_item, 0 ),
+		dropped:	make( []*recovery_item, 0 ),
+		quarantined: make( []*recovery_item, 0 ),
+	}
+}
+
+/*
+	Append a record that couldn't be loaded to the quarantine file. Id is empty if the record
+	couldn't be decoded. The file is opened for each record as there are expected to be
+	few; it is readable only by the owner as records hold cookies. If the file can't be
+	written the record is still listed in the report and the failure is logged once.
+*/
+func (r *recovery_report) quarantine( rec string, id string, why string ) {
+	r.quarantined = append( r.quarantined, &recovery_item{ id: id, why: why } )
+	if r.qfile == "" || r.qerr != nil {
+		return
+	}
+
+	if ! strings.HasSuffix( rec, "\n" ) {
+		rec += "\n"
+	}
+
+	f, err := os.OpenFile( r.qfile, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0600 )
+	if err == nil {
+		_, err = fmt.Fprintf( f, "# %s %s %s\n%s", time.Now().UTC().Format( time.RFC3339 ), r.fname, strings.Replace( why, "\n", " ", -1 ), rec )
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		r.qerr = err
+		rm_sheep.Baa( 0, "ERR: unable to write checkpoint record to quarantine file: %s: %s  [TGURMG025]", r.qfile, err )
+	}
+}
+
+/*
+	Record the disposition of a pledge.
+*/
+func (r *recovery_report) add( id string, disposition int, why string ) {
+	switch disposition {
+		case DS_ADD:
+			r.loaded = append( r.loaded, id )
+
+		case DS_RETRY:
+			r.retry = append( r.retry, &recovery_item{ id: id, why: why } )
+
+		default:
+			if why == "expired" {
+				r.expired = append( r.expired, id )
+			} else {
+				r.dropped = append( r.dropped, &recovery_item{ id: id, why: why } )
+			}
+	}
+}
+
+/*
+	One line summary for the log.
+*/
+func (r *recovery_report) String( ) ( string ) {
+	return fmt.Sprintf( "%s: %d records; %d loaded; %d expired; %d queued for retry; %d dropped; %d quarantined; %d recovering", r.fname, r.nrecs, len( r.loaded ), len( r.expired ), len( r.retry ), len( r.dropped ), len( r.quarantined ), r.pending )
+}
+
+func ids2json( ids []string ) ( string ) {
+	s := "[ "
+	sep := ""
+	for _, id := range ids {
+		s += fmt.Sprintf( "%s%q", sep, id )
+		sep = ", "
+	}
+
+	return s + " ]"
+}
+
+func items2json( items []*recovery_item ) ( string ) {
+	s := "[ "
+	sep := ""
+	for _, it := range items {
+		s += fmt.Sprintf( `%s{ "id": %q, "reason": %q }`, sep, it.id, it.why )
+		sep = ", "
+	}
+
+	return s + " ]"
+}
+
+/*
+	Generate the json report. Nil safe; a report with no load says so.
+*/
+func (r *recovery_report) To_json( ) ( string ) {
+	if r == nil {
+		return `{ "loaded": false }`
+	}
+
+	emsg := ""
+	if r.err != nil {
+		emsg = r.err.Error()
+	}
+
+	qemsg := ""
+	if r.qerr != nil {
+		qemsg = r.qerr.Error()
+	}
+
+	return fmt.Sprintf( `{ "loaded": true, "file": %q, "time": %d, "records": %d, "error": %q, "complete": %v, "counts": { "loaded": %d, "expired": %d, "retry": %d, "dropped": %d, "quarantined": %d, "recovering": %d }, "loaded_ids": %s, "expired_ids": %s, "retry": %s, "dropped": %s, "quarantine_file": %q, "quarantine_error": %q, "quarantined": %s }`,
+		r.fname, r.when, r.nrecs, emsg, r.pending == 0, len( r.loaded ), len( r.expired ), len( r.retry ), len( r.dropped ), len( r.quarantined ), r.pending,
+		ids2json( r.loaded ), ids2json( r.expired ), items2json( r.retry ), items2json( r.dropped ), r.qfile, qemsg, items2json( r.quarantined ) )
+}
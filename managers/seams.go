@@ -0,0 +1,92 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+
+	Mnemonic:	seams
+	Abstract:	The small interfaces that the managers use in place of the gopkgs types which
+				need real sockets, files and timers:
+					Ticker		- the tickler (ipc.Tickler) that drives periodic work
+					Checkpointer - the checkpoint file writer (chkpt.Chkpt)
+					ConnManager	- the session manager (connman.Cmgr) that agent manager
+								  writes to agents through
+
+				The real types satisfy these without change. The in-memory versions used by the
+				tests (seams_mem_test.go) can be put in place (the ticker given to fq_mgr, tklr,
+				the inventory's chkpt field, and new_connman) so that push logic, agent routing
+				and checkpoint cycles can be driven without the network or the filesystem.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - The in-memory versions are in test files; fq_mgr is given its ticker.
+				16 Oct 2026 - Added add_spot() which reports a full ticker.
+*/
+
+package managers
+
+import (
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/connman"
+	"github.com/att/gopkgs/ipc"
+)
+
+/*
+	Schedules a message to be sent on a channel every delay seconds, count times
+	(ipc.FOREVER for no limit).
+*/
+type Ticker interface {
+	Add_spot( delay int64, ch chan *ipc.Chmsg, mtype int, data interface{}, count int ) ( int, error )
+}
+
+/*
+	Add a spot to the ticker. The ticker has a fixed number of spots and a spot that can't be
+	added means that the work it drives never happens, so a failure is logged as critical
+	with the message id given. What describes the work for the message.
+*/
+func add_spot( tk Ticker, sheep *bleater.Bleater, msgid string, what string, delay int64, ch chan *ipc.Chmsg, mtype int, count int ) {
+	if _, err := tk.Add_spot( delay, ch, mtype, nil, count ); err != nil {
+		sheep.Baa( 0, "CRI: unable to schedule %s; it will not be run: %s  [%s]", what, err, msgid )
+	}
+}
+
+/*
+	Writes a checkpoint: Create starts a new one, it's written to as an io.Writer, and
+	Close finishes it returning its name.
+*/
+type Checkpointer interface {
+	Create( ) ( error )
+	Write( buf []byte ) ( int, error )
+	Close( ) ( string, error )
+}
+
+/*
+	Writes to the session (agent) with the given id.
+*/
+type ConnManager interface {
+	Write( id string, buf []byte )
+}
+
+/*
+	Creates the session manager that agent manager listens with; replaced to run agent
+	manager without a socket.
+*/
+var new_connman = func( port string, ch chan *connman.Sess_data ) ( ConnManager ) {
+	return connman.NewManager( port, ch )
+}
@@ -0,0 +1,224 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+
+	Mnemonic:	seams_mem_test
+	Abstract:	In-memory versions of the seams (seams.go) for driving the managers without
+				the network, the filesystem or the clock:
+					mem_ticker	- records spots; fire() sends the messages of the spots for
+								  a message type as if they had come due
+					mem_chkpt	- keeps each closed checkpoint, by name, in memory; create
+								  and write failures can be forced
+					mem_connman	- records what is written to each session
+
+				A maximum may be set on the mem_ticker to have it refuse spots as a full
+				tickler would.
+
+				Fire sends on the spot's channel and will block if it's unbuffered and nobody
+				is reading.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+// ---- tickler ---------------------------------------------------------------------------
+
+type mem_spot struct {
+	delay	int64
+	ch		chan *ipc.Chmsg
+	mtype	int
+	data	interface{}
+	count	int					// ipc.FOREVER if it doesn't run out
+	fired	int
+}
+
+type mem_ticker struct {
+	mu		sync.Mutex
+	spots	[]*mem_spot
+	max		int					// if > 0, spots beyond this are refused as a full tickler would
+}
+
+func mk_mem_ticker( ) ( *mem_ticker ) {
+	return &mem_ticker{ spots: make( []*mem_spot, 0 ) }
+}
+
+func (mt *mem_ticker) Add_spot( delay int64, ch chan *ipc.Chmsg, mtype int, data interface{}, count int ) ( int, error ) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if mt.max > 0 && len( mt.spots ) >= mt.max {
+		return -1, fmt.Errorf( "no room in ticker for another spot (max %d)", mt.max )
+	}
+	mt.spots = append( mt.spots, &mem_spot{ delay: delay, ch: ch, mtype: mtype, data: data, count: count } )
+	return len( mt.spots ) - 1, nil
+}
+
+/*
+	Return the delay of each spot added for the message type.
+*/
+func (mt *mem_ticker) delays( mtype int ) ( []int64 ) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	d := make( []int64, 0 )
+	for _, s := range mt.spots {
+		if s.mtype == mtype {
+			d = append( d, s.delay )
+		}
+	}
+
+	return d
+}
+
+/*
+	Send the message of every spot for the message type which hasn't run out. Returns the
+	number sent.
+*/
+func (mt *mem_ticker) fire( mtype int ) ( n int ) {
+	mt.mu.Lock()
+	due := make( []*mem_spot, 0 )
+	for _, s := range mt.spots {
+		if s.mtype == mtype && (s.count == ipc.FOREVER || s.fired < s.count) {
+			s.fired++
+			due = append( due, s )
+		}
+	}
+	mt.mu.Unlock()
+
+	for _, s := range due {								// not under the lock; the reader may add spots
+		msg := ipc.Mk_chmsg( )
+		msg.Send_req( s.ch, nil, s.mtype, s.data, nil )
+	}
+
+	return len( due )
+}
+
+// ---- checkpoint ------------------------------------------------------------------------
+
+type mem_chkpt struct {
+	mu			sync.Mutex
+	base		string
+	seq			int
+	cur			*bytes.Buffer			// nil when no checkpoint is open
+	saved		map[string]string		// closed checkpoints by name
+	last		string					// name of the last one closed
+	fail_create	bool
+	fail_write	bool
+}
+
+func mk_mem_chkpt( base string ) ( *mem_chkpt ) {
+	return &mem_chkpt{ base: base, saved: make( map[string]string ) }
+}
+
+func (mc *mem_chkpt) Create( ) ( error ) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.fail_create {
+		return mk_err( ERR_INTERNAL, "checkpoint create failed (forced)" )
+	}
+
+	mc.cur = &bytes.Buffer{}
+	return nil
+}
+
+func (mc *mem_chkpt) Write( buf []byte ) ( int, error ) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.cur == nil {
+		return 0, mk_err( ERR_INTERNAL, "checkpoint write without create" )
+	}
+	if mc.fail_write {
+		return 0, mk_err( ERR_INTERNAL, "checkpoint write failed (forced)" )
+	}
+
+	return mc.cur.Write( buf )
+}
+
+func (mc *mem_chkpt) Close( ) ( string, error ) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.cur == nil {
+		return "", mk_err( ERR_INTERNAL, "checkpoint close without create" )
+	}
+
+	mc.seq++
+	name := fmt.Sprintf( "%s.%d", mc.base, mc.seq )
+	mc.saved[name] = mc.cur.String()
+	mc.last = name
+	mc.cur = nil
+	return name, nil
+}
+
+/*
+	Return the name and contents of the last checkpoint closed; empty strings if none.
+*/
+func (mc *mem_chkpt) latest( ) ( string, string ) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	return mc.last, mc.saved[mc.last]
+}
+
+// ---- session manager -------------------------------------------------------------------
+
+type mem_connman struct {
+	mu		sync.Mutex
+	writes	map[string][][]byte			// by session id, oldest first
+}
+
+func mk_mem_connman( ) ( *mem_connman ) {
+	return &mem_connman{ writes: make( map[string][][]byte ) }
+}
+
+func (mc *mem_connman) Write( id string, buf []byte ) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	b := make( []byte, len( buf ) )
+	copy( b, buf )
+	mc.writes[id] = append( mc.writes[id], b )
+}
+
+/*
+	Return, and forget, what was written to the session.
+*/
+func (mc *mem_connman) take( id string ) ( [][]byte ) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	w := mc.writes[id]
+	delete( mc.writes, id )
+	return w
+}
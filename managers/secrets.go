@@ -0,0 +1,154 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	secrets
+	Abstract:	Credentials (openstack passwords, key files, tokens, sink urls...) need not be kept
+				in the main config file so that it can be put under version control. Once the
+				config is parsed two overlays are applied to it:
+
+					- default:secrets_file names a file, in the same format as the config, whose
+					  values are added to, or replace, those in the config. The file must not be
+					  readable or writable by group or other; tegu refuses to start if it is.
+
+					- any value of the form env:NAME is replaced with the value of the environment
+					  variable NAME. Tegu refuses to start if the variable is not set. References
+					  may be used in the secrets file too.
+
+				Because the overlays are applied to cfg_data before any manager reads it, every
+				config value may come from either source. The names of the overridden keys are
+				logged; values never are.
+
+	CFG:		default:secrets_file - path of the secrets file (none if unset)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/att/gopkgs/config"
+)
+
+const env_ref_prefix string = "env:"
+
+/*
+	Apply the secrets file and environment references to the config. An error is returned
+	if either can't be satisfied.
+*/
+func apply_secrets( cfg map[string]map[string]*string ) ( err error ) {
+	if cfg == nil {
+		return nil
+	}
+
+	if cfg["default"] != nil {
+		if p := cfg["default"]["secrets_file"]; p != nil && *p != "" {
+			fname := *p
+			if strings.HasPrefix( fname, env_ref_prefix ) {
+				if fname, err = env_ref( fname ); err != nil {
+					return fmt.Errorf( "default:secrets_file: %s", err )
+				}
+			}
+
+			if err = merge_secrets( cfg, fname ); err != nil {
+				return err
+			}
+		}
+	}
+
+	nenv := 0
+	for sect, keys := range cfg {
+		for k, v := range keys {
+			if v == nil || ! strings.HasPrefix( *v, env_ref_prefix ) {
+				continue
+			}
+
+			val, err := env_ref( *v )
+			if err != nil {
+				return fmt.Errorf( "%s:%s: %s", sect, k, err )
+			}
+			keys[k] = &val
+			nenv++
+		}
+	}
+	if nenv > 0 {
+		tegu_sheep.Baa( 1, "%d config values were taken from the environment", nenv )
+	}
+
+	return nil
+}
+
+/*
+	Parse the secrets file and add its values to the config. The file is not read if its
+	permissions allow access by anybody but the owner.
+*/
+func merge_secrets( cfg map[string]map[string]*string, fname string ) ( err error ) {
+	fi, err := os.Stat( fname )
+	if err != nil {
+		return fmt.Errorf( "secrets file: %s", err )
+	}
+	if fi.Mode().Perm() & 077 != 0 {
+		tegu_sheep.Baa( 0, "ERR: secrets file %s has mode %04o; it must not be accessible by group or other (chmod 600)  [TGUSEC000]", fname, fi.Mode().Perm() )
+		return fmt.Errorf( "secrets file %s is accessible by group or other", fname )
+	}
+
+	sdata, err := config.Parse2strs( nil, fname )
+	if err != nil {
+		return fmt.Errorf( "unable to parse secrets file %s: %s", fname, err )
+	}
+
+	for sect, keys := range sdata {
+		if cfg[sect] == nil {
+			cfg[sect] = make( map[string]*string, len( keys ) )
+		}
+		for k, v := range keys {
+			cfg[sect][k] = v
+			tegu_sheep.Baa( 2, "config %s:%s taken from secrets file", sect, k )
+		}
+	}
+
+	tegu_sheep.Baa( 1, "secrets loaded from %s", fname )
+	return nil
+}
+
+/*
+	Return the value of the environment variable named by the env:NAME reference.
+*/
+func env_ref( ref string ) ( string, error ) {
+	name := strings.TrimSpace( ref[len( env_ref_prefix ):] )
+	if name == "" {
+		return "", fmt.Errorf( "missing variable name in %s", ref )
+	}
+
+	val, ok := os.LookupEnv( name )
+	if !ok {
+		return "", fmt.Errorf( "environment variable %s is not set", name )
+	}
+
+	return val, nil
+}
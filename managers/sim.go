@@ -0,0 +1,247 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	sim
+	Abstract:	Simulation mode. When simulate:topology names a file tegu runs without openstack,
+				an SDN controller or agents so that the reservation pipeline can be driven
+				(integration tests, capacity what-if studies) without any hardware:
+					- network manager builds the graph from the links in the file
+					- the VMs listed in the file stand in for openstack; osif answers host info,
+					  host validation and host list requests from them
+					- agent manager adds an in-process mock agent (agent_sim.go) which records
+					  the commands it is given and responds as a real agent would
+
+				The file is json:
+					{
+						"links": [ { "Src-switch": "spine1", "Src-port": 1, "Dst-switch": "host1@em1", "Dst-port": -128,
+									"Direction": "bidirectional", "Capacity": 10000000000 }, ... ],
+						"vms": [ { "project": "p1", "name": "vm1", "ip": "10.0.0.1", "mac": "fa:de:ad:00:00:01", "phost": "host1" }, ... ]
+					}
+
+				Links are given as they are for the static physical graph; each VM is attached to
+				the switch named by its physical host. Reservations name simulated VMs with
+				[token/]project/name or [token/]project/ip; tokens are not validated.
+
+				A snapshot (snapshot.go) is a superset of the topology file, so it can also be
+				used to start tegu in simulation mode (replay).
+
+				The simulation is loaded before the managers are started and is not changed after
+				that, so it may be referenced from any goroutine.
+
+	CFG:		simulate:topology - file describing the network and VMs (not simulating if unset)
+				simulate:cmd_log - file where the mock agent records commands (/var/lib/tegu/sim_cmds.log)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/att/tegu/gizmos"
+)
+
+type sim_vm struct {
+	Project	string
+	Name	string
+	Ip		string
+	Mac		string
+	Phost	string
+}
+
+type sim_topo struct {
+	fname	string						// topology file
+	cmd_log	string						// where the mock agent records commands
+	Links	[]gizmos.FL_link_json
+	Vms		[]*sim_vm
+	Inventory	[]string			// checkpoint records (snapshots only)
+	vms		map[string]*sim_vm			// project/name and project/ip -> vm
+	replay	bool						// started from a snapshot
+}
+
+var sim_net	*sim_topo					// nil when not simulating
+
+/*
+	Load the simulation from the config. Called from Initialise.
+*/
+func sim_init( ) {
+	if cfg_data["simulate"] == nil {
+		return
+	}
+
+	p := cfg_data["simulate"]["topology"]
+	if p == nil || *p == "" {
+		return
+	}
+
+	s, err := load_sim( *p )
+	if err != nil {
+		tegu_sheep.Baa( 0, "ERR: unable to load simulation topology: %s: %s  [TGUSIM000]", *p, err )
+		return
+	}
+
+	sim_start( s )
+}
+
+/*
+	Put the loaded simulation into effect.
+*/
+func sim_start( s *sim_topo ) {
+	s.cmd_log = "/var/lib/tegu/sim_cmds.log"
+	if cfg_data != nil && cfg_data["simulate"] != nil {
+		if p := cfg_data["simulate"]["cmd_log"]; p != nil {
+			s.cmd_log = *p
+		}
+	}
+
+	sim_net = s
+	tegu_sheep.Baa( 0, "WRN: simulation mode: %d links and %d VMs loaded from %s; openstack, sdn controller and agents are not used  [TGUSIM001]", len( s.Links ), len( s.Vms ), s.fname )
+}
+
+/*
+	Read and vet the topology file.
+*/
+func load_sim( fname string ) ( s *sim_topo, err error ) {
+	buf, err := ioutil.ReadFile( fname )
+	if err != nil {
+		return nil, err
+	}
+
+	s = &sim_topo{ fname: fname }
+	if err = json.Unmarshal( buf, s ); err != nil {
+		return nil, err
+	}
+	if len( s.Links ) <= 0 {
+		return nil, fmt.Errorf( "no links defined" )
+	}
+
+	s.vms = make( map[string]*sim_vm, len( s.Vms ) * 2 )
+	for i, vm := range s.Vms {
+		if vm == nil || vm.Project == "" || vm.Name == "" || vm.Ip == "" || vm.Phost == "" {
+			return nil, fmt.Errorf( "vm %d: project, name, ip and phost are required", i )
+		}
+		vm.Mac = strings.ToLower( vm.Mac )
+		s.vms[vm.Project + "/" + vm.Name] = vm
+		s.vms[vm.Project + "/" + vm.Ip] = vm
+	}
+
+	return s, nil
+}
+
+/*
+	If the [token/]project/vm[:port][{vlan}] name references a simulated VM, the name
+	without the token is returned, otherwise nil.
+*/
+func (s *sim_topo) validate( raw *string ) ( *string ) {
+	if s == nil || raw == nil {
+		return nil
+	}
+
+	name := *raw
+	if toks := strings.SplitN( name, "/", 3 ); len( toks ) == 3 {
+		name = toks[1] + "/" + toks[2]
+	}
+
+	key := name
+	if i := strings.IndexAny( key, ":{" ); i > 0 {			// port and/or vlan aren't part of the vm name
+		key = key[0:i]
+	}
+	if s.vms[key] == nil {
+		return nil
+	}
+
+	return &name
+}
+
+/*
+	Build a network graph insertion struct for the VM if it's known.
+*/
+func (s *sim_topo) hostinfo( name *string ) ( *Net_vm ) {
+	if s == nil || name == nil {
+		return nil
+	}
+
+	vm := s.vms[*name]
+	if vm == nil {
+		return nil
+	}
+
+	n := vm.Project + "/" + vm.Name
+	ip := vm.Project + "/" + vm.Ip
+	mac := vm.Mac
+	phost := vm.Phost
+	return Mk_netreq_vm( &n, &n, &ip, nil, &phost, &mac, nil, nil, nil )
+}
+
+/*
+	Add VM addresses to the ip2mac map.
+*/
+func (s *sim_topo) fill_ip2mac( m map[string]*string ) {
+	if s == nil {
+		return
+	}
+
+	for _, vm := range s.Vms {
+		mac := vm.Mac
+		m[vm.Project + "/" + vm.Ip] = &mac
+	}
+}
+
+/*
+	Return the space separated list of physical hosts as osif would for openstack.
+*/
+func (s *sim_topo) host_list( ) ( *string ) {
+	seen := make( map[string]bool )
+	hosts := make( []string, 0 )
+	for _, vm := range s.Vms {
+		if ! seen[vm.Phost] {
+			seen[vm.Phost] = true
+			hosts = append( hosts, vm.Phost )
+		}
+	}
+	sort.Strings( hosts )
+
+	hl := strings.Join( hosts, " " )
+	return &hl
+}
+
+/*
+	Generate the "phost mac" records that a real agent returns for map_mac2phost.
+*/
+func (s *sim_topo) mac2phost( ) ( []string ) {
+	recs := make( []string, 0, len( s.Vms ) )
+	for _, vm := range s.Vms {
+		if vm.Mac != "" {
+			recs = append( recs, vm.Phost + " " + vm.Mac )
+		}
+	}
+
+	return recs
+}
@@ -0,0 +1,191 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	sink
+	Abstract:	Record sinks. A sink accepts json records (one per call) and delivers them
+				to a destination given by a spec string:
+					file:/path or /path		- records are appended to the file, one per line
+					http://... or https://	- each record is POSTed to the URL
+					kafka:broker[,broker...]/topic - records are published to the kafka topic
+					amqp://user:pw@host:port/vhost?exchange=name&key=routing-key
+											- records are published to the amqp exchange
+
+				Delivery is done by a goroutine so that the manager writing records is never
+				blocked by a slow destination. If the sink's queue fills, records are dropped
+				and a count of dropped records is logged.
+
+				Sink types are registered in sink_types so that others can be added without
+				changing the users of a sink.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:		16 Oct 2026 - Added kafka and amqp sink types (sink_bus.go).
+*/
+
+package managers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+	The destination specific writer.
+*/
+type sink_writer interface {
+	write( rec string ) ( error )
+}
+
+/*
+	Function that creates a writer given the spec with the type prefix removed.
+*/
+type sink_maker func( dest string ) ( sink_writer, error )
+
+var sink_types = map[string]sink_maker {
+	"file":		mk_file_writer,
+	"http":		mk_http_writer,
+	"https":	mk_http_writer,
+}
+
+type rec_sink struct {
+	name	string				// spec for log messages
+	ch		chan string
+	w		sink_writer
+	dropped	int64
+}
+
+// ---- file ---------------------------------------------------------------------
+
+type file_writer struct {
+	fname	string
+	f		*os.File
+}
+
+func mk_file_writer( dest string ) ( sink_writer, error ) {
+	f, err := os.OpenFile( dest, os.O_CREATE | os.O_APPEND | os.O_WRONLY, 0644 )
+	if err != nil {
+		return nil, err
+	}
+
+	return &file_writer{ fname: dest, f: f }, nil
+}
+
+func (fw *file_writer) write( rec string ) ( error ) {
+	_, err := fmt.Fprintf( fw.f, "%s\n", rec )
+	return err
+}
+
+// ---- http ---------------------------------------------------------------------
+
+type http_writer struct {
+	url		string
+	client	*http.Client
+}
+
+func mk_http_writer( dest string ) ( sink_writer, error ) {
+	return &http_writer{ url: dest, client: &http.Client{ Timeout: 10 * time.Second } }, nil
+}
+
+func (hw *http_writer) write( rec string ) ( error ) {
+	resp, err := hw.client.Post( hw.url, "application/json", strings.NewReader( rec ) )
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf( "%s: status %d", hw.url, resp.StatusCode )
+	}
+
+	return nil
+}
+
+// -------------------------------------------------------------------------------
+
+/*
+	Create a sink from the spec and start its writer. Qsize is the number of records that
+	may be queued before they are dropped.
+*/
+func mk_sink( spec string, qsize int ) ( s *rec_sink, err error ) {
+	stype := "file"
+	dest := spec
+	if strings.HasPrefix( spec, "http://" ) || strings.HasPrefix( spec, "https://" ) || strings.HasPrefix( spec, "amqp://" ) || strings.HasPrefix( spec, "amqps://" ) {
+		stype = spec[0:strings.Index( spec, ":" )]					// url is given to the writer intact
+	} else {
+		if i := strings.Index( spec, ":" ); i > 0 {
+			stype = spec[0:i]
+			dest = spec[i+1:]
+		}
+	}
+
+	maker := sink_types[stype]
+	if maker == nil {
+		return nil, fmt.Errorf( "unknown sink type: %s", stype )
+	}
+
+	w, err := maker( dest )
+	if err != nil {
+		return nil, err
+	}
+
+	if qsize < 16 {
+		qsize = 16
+	}
+	s = &rec_sink{ name: spec, ch: make( chan string, qsize ), w: w }
+	go s.writer()
+
+	return s, nil
+}
+
+/*
+	Queue a record for the sink; never blocks.
+*/
+func (s *rec_sink) send( rec string ) {
+	if s == nil {
+		return
+	}
+
+	select {
+		case s.ch <- rec:
+
+		default:
+			s.dropped++
+			if s.dropped == 1 || s.dropped % 100 == 0 {
+				tegu_sheep.Baa( 0, "WRN: sink %s is backed up; %d records dropped  [TGUSNK000]", s.name, s.dropped )
+			}
+	}
+}
+
+/*
+	Goroutine that drains the queue.
+*/
+func (s *rec_sink) writer( ) {
+	for rec := range s.ch {
+		if err := s.w.write( rec ); err != nil {
+			tegu_sheep.Baa( 1, "WRN: sink %s: write failed: %s  [TGUSNK001]", s.name, err )
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	sink_bus
+	Abstract:	Message bus sink writers (kafka and amqp). These register themselves with
+				the sink type table so that any sink (events, accounting) can be directed
+				to a bus.
+
+				Connections are made lazily and are dropped when a publish fails; the next
+				record causes a reconnect attempt. Writers run on the sink's goroutine so
+				a bus that is down never blocks the manager generating the records.
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/streadway/amqp"
+)
+
+func init() {
+	sink_types["kafka"] = mk_kafka_writer
+	sink_types["amqp"] = mk_amqp_writer
+	sink_types["amqps"] = mk_amqp_writer
+}
+
+// ---- kafka --------------------------------------------------------------------
+
+type kafka_writer struct {
+	brokers		[]string
+	topic		string
+	producer	sarama.SyncProducer
+}
+
+/*
+	Dest is broker[,broker...]/topic.
+*/
+func mk_kafka_writer( dest string ) ( sink_writer, error ) {
+	toks := strings.SplitN( dest, "/", 2 )
+	if len( toks ) != 2 || toks[0] == "" || toks[1] == "" {
+		return nil, fmt.Errorf( "kafka sink must be kafka:broker[,broker...]/topic: %s", dest )
+	}
+
+	return &kafka_writer{ brokers: strings.Split( toks[0], "," ), topic: toks[1] }, nil
+}
+
+func (kw *kafka_writer) write( rec string ) ( err error ) {
+	if kw.producer == nil {
+		cfg := sarama.NewConfig()
+		cfg.Producer.Return.Successes = true					// required for the sync producer
+		cfg.Producer.RequiredAcks = sarama.WaitForLocal
+		if kw.producer, err = sarama.NewSyncProducer( kw.brokers, cfg ); err != nil {
+			kw.producer = nil
+			return err
+		}
+	}
+
+	_, _, err = kw.producer.SendMessage( &sarama.ProducerMessage{ Topic: kw.topic, Value: sarama.StringEncoder( rec ) } )
+	if err != nil {
+		kw.producer.Close()
+		kw.producer = nil
+	}
+
+	return err
+}
+
+// ---- amqp ---------------------------------------------------------------------
+
+type amqp_writer struct {
+	url			string					// url without our query parms
+	exchange	string
+	key			string
+	conn		*amqp.Connection
+	ch			*amqp.Channel
+}
+
+/*
+	Dest is the amqp url with exchange= and key= query parameters; the exchange is declared
+	as a durable topic exchange. Exchange defaults to tegu and key to events.
+*/
+func mk_amqp_writer( dest string ) ( sink_writer, error ) {
+	u, err := url.Parse( dest )
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	aw := &amqp_writer{ exchange: q.Get( "exchange" ), key: q.Get( "key" ) }
+	if aw.exchange == "" {
+		aw.exchange = "tegu"
+	}
+	if aw.key == "" {
+		aw.key = "events"
+	}
+	q.Del( "exchange" )
+	q.Del( "key" )
+	u.RawQuery = q.Encode()
+	aw.url = u.String()
+
+	return aw, nil
+}
+
+func (aw *amqp_writer) connect( ) ( err error ) {
+	if aw.conn, err = amqp.Dial( aw.url ); err != nil {
+		return err
+	}
+
+	if aw.ch, err = aw.conn.Channel(); err == nil {
+		err = aw.ch.ExchangeDeclare( aw.exchange, "topic", true, false, false, false, nil )
+	}
+	if err != nil {
+		aw.conn.Close()
+		aw.conn = nil
+	}
+
+	return err
+}
+
+func (aw *amqp_writer) write( rec string ) ( err error ) {
+	if aw.conn == nil {
+		if err = aw.connect(); err != nil {
+			return err
+		}
+	}
+
+	err = aw.ch.Publish( aw.exchange, aw.key, false, false, amqp.Publishing{ ContentType: "application/json", Body: []byte( rec ) } )
+	if err != nil {
+		aw.conn.Close()
+		aw.conn = nil
+	}
+
+	return err
+}
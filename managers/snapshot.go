@@ -0,0 +1,200 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	snapshot
+	Abstract:	Snapshots of tegu's internal state for debugging. The snapshot request writes a
+				json file with the physical links and the VMs known to network manager (in the
+				simulation topology form, see sim.go), the network graph with the obligations
+				on each link, and the reservation inventory as checkpoint records:
+					{ "ts": unix-time, "version": "...", "links": [...], "vms": [...],
+					  "graph": {...}, "inventory": [...] }
+
+				Starting tegu with -r snapshot-file puts it into replay mode: it runs as in
+				simulation mode using the links and VMs from the snapshot, and the inventory is
+				loaded from the snapshot (rather than a checkpoint) which rebuilds the link
+				obligations so that admission decisions can be reproduced locally. Nothing is
+				sent to the real network and checkpoints are not written. The graph in the file
+				is for reference; it is not loaded.
+
+				Reservations which have expired by the time the snapshot is replayed are
+				dropped, as they are when a checkpoint is loaded. The network and the inventory
+				are captured by separate requests, so a reservation added or deleted between
+				the two may show in one and not the other.
+
+	CFG:		resmgr:chkpt_dir - snapshots are written to this directory (/var/lib/tegu)
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+*/
+
+package managers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type snapshot struct {
+	Ts			int64
+	Version		string
+	Links		[]gizmos.FL_link_json
+	Vms			[]*sim_vm
+	Graph		json.RawMessage				// for reference only
+	Inventory	[]string					// checkpoint records
+}
+
+/*
+	Start replay mode from the snapshot file. Must be called after Initialise and before
+	the managers are started.
+*/
+func Load_replay( fname string ) ( err error ) {
+	s, err := load_sim( fname )
+	if err != nil {
+		return err
+	}
+
+	s.replay = true
+	sim_start( s )
+	tegu_sheep.Baa( 0, "WRN: replay mode: %d inventory records will be loaded from %s; checkpoints are not written  [TGUSIM002]", len( s.Inventory ), fname )
+	return nil
+}
+
+/*
+	Returns true if running from a snapshot.
+*/
+func is_replay( ) ( bool ) {
+	return sim_net != nil && sim_net.replay
+}
+
+/*
+	Collect the network and inventory state and write the snapshot file. The name of the
+	file is returned. Must not be called from network or reservation manager goroutines.
+*/
+func take_snapshot( ) ( fname string, err error ) {
+	my_ch := make( chan *ipc.Chmsg )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( nw_ch, my_ch, REQ_SNAPSHOT, nil, nil )
+	req = <- my_ch
+	snap, ok := req.Response_data.( *snapshot )
+	if !ok || snap == nil {
+		return "", fmt.Errorf( "network manager did not return a snapshot" )
+	}
+
+	req.Send_req( rmgr_ch, my_ch, REQ_SNAPSHOT, nil, nil )
+	req = <- my_ch
+	snap.Inventory, _ = req.Response_data.( []string )
+
+	snap.Ts = time.Now().Unix()
+	snap.Version = version
+
+	jbuf, err := json.Marshal( snap )
+	if err != nil {
+		return "", err
+	}
+
+	dir := "/var/lib/tegu"
+	if cfg_data["resmgr"] != nil {
+		if p := cfg_data["resmgr"]["chkpt_dir"]; p != nil {
+			dir = *p
+		}
+	}
+
+	fname = fmt.Sprintf( "%s/snapshot.%d.json", dir, snap.Ts )
+	if err = ioutil.WriteFile( fname + ".tmp", jbuf, 0644 ); err != nil {
+		return "", err
+	}
+	if err = os.Rename( fname + ".tmp", fname ); err != nil {
+		return "", err
+	}
+
+	return fname, nil
+}
+
+/*
+	Build the network portion of a snapshot. VMs without a project or a physical host
+	can't be replayed and are left out.
+*/
+func (n *Network) snapshot( ) ( snap *snapshot ) {
+	snap = &snapshot{ Links: n.fl_links, Vms: make( []*sim_vm, 0, len( n.ip2mac ) ) }
+
+	for ip, mac := range n.ip2mac {
+		toks := strings.SplitN( ip, "/", 2 )
+		vmid := n.ip2vmid[ip]
+		if len( toks ) < 2 || mac == nil || vmid == nil || n.vmid2phost[*vmid] == nil {
+			continue
+		}
+
+		name := *vmid
+		if vn := n.ip2vm[ip]; vn != nil {
+			name = *vn
+		}
+		if i := strings.LastIndex( name, "/" ); i >= 0 {
+			name = name[i+1:]
+		}
+
+		snap.Vms = append( snap.Vms, &sim_vm{ Project: toks[0], Name: name, Ip: toks[1], Mac: *mac, Phost: *n.vmid2phost[*vmid] } )
+	}
+
+	snap.Graph = json.RawMessage( n.to_json() )
+	return snap
+}
+
+/*
+	Generate the inventory as checkpoint records.
+*/
+func (inv *Inventory) chkpt_recs( ) ( recs []string ) {
+	recs = make( []string, 0, len( inv.ulcap_cache ) + len( inv.cache ) + len( inv.retry ) )
+
+	for nm, v := range inv.ulcap_cache {
+		recs = append( recs, fmt.Sprintf( "ucap: %s %d", nm, v ) )
+	}
+	recs = append( recs, inv.selector_recs()... )
+
+	for _, pmap := range []map[string]*gizmos.Pledge{ inv.cache, inv.retry } {
+		for _, p := range pmap {
+			if s := (*p).To_chkpt(); s != "expired" {
+				recs = append( recs, s )
+			}
+		}
+	}
+
+	return recs
+}
+
+/*
+	Load the inventory from the snapshot being replayed.
+*/
+func (inv *Inventory) load_replay( ) ( err error ) {
+	recs := strings.Join( sim_net.Inventory, "\n" ) + "\n"
+	return inv.load_chkpt_rdr( bufio.NewReader( strings.NewReader( recs ) ), &sim_net.fname, "", false )
+}
@@ -0,0 +1,128 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	tegu_err
+	Abstract:	Typed errors passed back through Chmsg.State by the managers. Each carries a
+				short machine readable code (not_found, capacity, etc.) in addition to the
+				message so that the http layer can set a sensible status and include the code
+				in the reqstate output where a client can branch on it rather than having to
+				pick apart the comment text. Errors created with fmt.Errorf() are still fine
+				and are reported as code "error".
+
+	Date:		16 October 2026
+	Author:		E. Scott Daniels
+
+	Mods:
+		16 Oct 2026 - Added busy for requests refused while reservations are being recovered.
+*/
+
+package managers
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	ERR_NOT_FOUND		string = "not_found"			// reservation, host, etc. isn't known
+	ERR_NOT_AUTHORISED	string = "not_authorised"		// cookie or token didn't allow it
+	ERR_CAPACITY		string = "capacity"				// would exceed bandwidth or a configured limit
+	ERR_NO_PATH			string = "no_path"				// network couldn't find a path between the endpoints
+	ERR_AGENT_DOWN		string = "agent_down"			// no agent, or the agent doesn't know the host(s)
+	ERR_TIMEOUT			string = "timeout"				// request abandoned; deadline passed or the client went away
+	ERR_DUPLICATE		string = "duplicate"			// duplicates an existing reservation
+	ERR_BAD_REQUEST		string = "bad_request"			// invalid parameters
+	ERR_BUSY			string = "busy"					// can't be done now; try again shortly (e.g. recovery running)
+	ERR_INTERNAL		string = "internal"				// something we did (or didn't do)
+	ERR_UNTYPED			string = "error"				// error not created with mk_err()
+)
+
+/*
+	An error with a code.
+*/
+type Tegu_err struct {
+	Code	string
+	msg		string
+}
+
+/*
+	Create an error with the code and a printf style message.
+*/
+func mk_err( code string, format string, parms ...interface{} ) ( error ) {
+	return &Tegu_err{ Code: code, msg: fmt.Sprintf( format, parms... ) }
+}
+
+/*
+	Error interface; just the message, the code isn't added.
+*/
+func (e *Tegu_err) Error( ) ( string ) {
+	if e == nil {
+		return ""
+	}
+
+	return e.msg
+}
+
+/*
+	Return the code for the error; empty string if err is nil.
+*/
+func err_code( err error ) ( string ) {
+	if err == nil {
+		return ""
+	}
+
+	if te, ok := err.( *Tegu_err ); ok {
+		return te.Code
+	}
+
+	return ERR_UNTYPED
+}
+
+/*
+	Map a code to an http status.
+*/
+func err_status( code string ) ( int ) {
+	switch code {
+		case "":
+			return http.StatusOK
+
+		case ERR_NOT_FOUND:
+			return http.StatusNotFound
+
+		case ERR_NOT_AUTHORISED:
+			return http.StatusForbidden
+
+		case ERR_CAPACITY, ERR_DUPLICATE, ERR_NO_PATH:
+			return http.StatusConflict
+
+		case ERR_AGENT_DOWN, ERR_BUSY:
+			return http.StatusServiceUnavailable
+
+		case ERR_TIMEOUT:
+			return http.StatusGatewayTimeout
+
+		case ERR_BAD_REQUEST, ERR_UNTYPED:
+			return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
@@ -19,16 +19,106 @@
 
 
 	
-package managers_test
+package managers
 
 import "testing"
 import "fmt"
 import "os"
+import "strings"
+import "sync"
+
+import "github.com/att/gopkgs/bleater"
+import "github.com/att/gopkgs/ipc"
 
 
 func TestMan_util( t *testing.T ) {
-	str = "udp:42"
-	pv, port = managers.proto2val_port( &str )
-	fmt.Fprintf( os.Stderr, "%d %d\n", pv, port )
+	str := "udp:42"
+	id := "r1"
+	fq := Mk_fqreq( &id )
+	set_proto_port( fq, &str, true )
+	fmt.Fprintf( os.Stderr, "%s %s\n", *fq.Protocol, *fq.Match.Tpdport )
+	if *fq.Protocol != "udp" || *fq.Match.Tpdport != "42" {
+		t.Fail()
+	}
+}
+
+/*
+	Correlation ids made on many goroutines must all differ, and the id given to a request
+	must be found by the manager that receives it.
+*/
+func TestMan_cid( t *testing.T ) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	seen := make( map[string]bool )
+	for i := 0; i < 8; i++ {
+		wg.Add( 1 )
+		go func( ) {
+			defer wg.Done( )
+			for j := 0; j < 100; j++ {
+				c := mk_cid( )
+				mu.Lock( )
+				seen[c] = true
+				mu.Unlock( )
+			}
+		}( )
+	}
+	wg.Wait( )
+
+	if len( seen ) != 800 {
+		fmt.Fprintf( os.Stderr, "[FAIL] expected 800 distinct correlation ids, got %d\n", len( seen ) )
+		t.Fail()
+	}
+
+	ch := make( chan *ipc.Chmsg, 1 )
+	req := ipc.Mk_chmsg( )
+	req.Send_req( ch, nil, REQ_NOOP, nil, "c1_00042" )
+	if cid := req_cid( <- ch ); cid != "c1_00042" {
+		fmt.Fprintf( os.Stderr, "[FAIL] correlation id not carried on the request: %q\n", cid )
+		t.Fail()
+	}
+
+	req = ipc.Mk_chmsg( )
+	req.Send_req( ch, nil, REQ_NOOP, nil, nil )
+	if cid := req_cid( <- ch ); cid != "" {
+		fmt.Fprintf( os.Stderr, "[FAIL] correlation id found on a request without one: %q\n", cid )
+		t.Fail()
+	}
+
+	ctx, cancel := nw_ctx( nil, "c1_00043" )						// cancellable requests carry it in the context
+	defer cancel( )
+	go func( ) {
+		req := <- ch
+		req.Response_data = req_cid( req )
+		req.Response_ch <- req
+	}( )
+	if req = ctx_req( ctx, ch, REQ_NOOP, nil, nil ); req.Response_data != "c1_00043" {
+		fmt.Fprintf( os.Stderr, "[FAIL] correlation id not carried in the request context: %v\n", req.Response_data )
+		t.Fail()
+	}
 }
 
+/*
+	A spot that the ticker has no room for must be reported as critical rather than being
+	silently dropped.
+*/
+func TestMan_add_spot( t *testing.T ) {
+	var log strings.Builder
+
+	sheep := bleater.Mk_bleater( 0, &log )
+	tk := mk_mem_ticker( )
+	tk.max = 1
+	ch := make( chan *ipc.Chmsg, 1 )
+
+	add_spot( tk, sheep, "TGUXXX000", "first check", 5, ch, REQ_NOOP, ipc.FOREVER )
+	if log.Len( ) != 0 {
+		fmt.Fprintf( os.Stderr, "[FAIL] message logged for a spot that was added: %s\n", log.String( ) )
+		t.Fail()
+	}
+
+	add_spot( tk, sheep, "TGUXXX000", "second check", 5, ch, REQ_NOOP, ipc.FOREVER )
+	if m := log.String( ); !strings.Contains( m, "CRI:" ) || !strings.Contains( m, "second check" ) || !strings.Contains( m, "TGUXXX000" ) {
+		fmt.Fprintf( os.Stderr, "[FAIL] full ticker not reported as critical: %q\n", m )
+		t.Fail()
+	}
+}